@@ -0,0 +1,303 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/saveio/themis/cmd/utils"
+	"github.com/saveio/themis/common"
+)
+
+var ChannelCommand = cli.Command{
+	Name:        "channel",
+	Usage:       "Manage micropayment channels",
+	Description: "Channel commands can open, deposit, close, settle and query micropayment channels.",
+	Subcommands: []cli.Command{
+		{
+			Action:      channelOpen,
+			Name:        "open",
+			Usage:       "Open a channel with partner",
+			ArgsUsage:   " ",
+			Description: "Open a channel between the account and partner. Using 'channel id' to get the channel id after transaction confirmed.",
+			Flags: append([]cli.Flag{
+				utils.ChannelPartnerFlag,
+				utils.ChannelSettleTimeoutFlag,
+			}, nativeTxFlags...),
+		},
+		{
+			Action:      channelDeposit,
+			Name:        "deposit",
+			Usage:       "Set total deposit of the account in channel",
+			ArgsUsage:   " ",
+			Description: "Set total deposit of the account in channel. Total deposit can only be increased, the difference is transferred from the account.",
+			Flags: append([]cli.Flag{
+				utils.ChannelIdFlag,
+				utils.ChannelPartnerFlag,
+				utils.ChannelTotalDepositFlag,
+			}, nativeTxFlags...),
+		},
+		{
+			Action:    channelClose,
+			Name:      "close",
+			Usage:     "Close a channel",
+			ArgsUsage: " ",
+			Flags: append([]cli.Flag{
+				utils.ChannelIdFlag,
+				utils.ChannelPartnerFlag,
+			}, nativeTxFlags...),
+		},
+		{
+			Action:      channelSettle,
+			Name:        "settle",
+			Usage:       "Settle a closed channel",
+			ArgsUsage:   " ",
+			Description: "Settle a closed channel after settle timeout, deposits are returned to participants according to transferred amounts.",
+			Flags: append([]cli.Flag{
+				utils.ChannelIdFlag,
+				utils.ChannelPartnerFlag,
+				utils.ChannelTransferredFlag,
+				utils.ChannelPartnerTransferredFlag,
+			}, nativeTxFlags...),
+		},
+		{
+			Action:    channelGetId,
+			Name:      "id",
+			Usage:     "Display channel id of two participants",
+			ArgsUsage: "<address1> <address2>",
+			Flags: []cli.Flag{
+				utils.RPCPortFlag,
+				utils.WalletFileFlag,
+			},
+		},
+		{
+			Action:    channelInfo,
+			Name:      "info",
+			Usage:     "Display info of a channel",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				utils.RPCPortFlag,
+				utils.ChannelIdFlag,
+			},
+		},
+	},
+}
+
+func channelOpen(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	partner, err := getChannelPartner(ctx)
+	if err != nil || partner == common.ADDRESS_EMPTY {
+		return err
+	}
+	settleTimeout := ctx.Uint64(utils.GetFlagName(utils.ChannelSettleTimeoutFlag))
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	txHash, err := utils.OpenChannel(gasPrice, gasLimit, signer, partner, settleTimeout)
+	if err != nil {
+		return fmt.Errorf("open channel error:%s", err)
+	}
+	PrintInfoMsg("Open channel:")
+	PrintInfoMsg("  Participant1:%s", signer.Address.ToBase58())
+	PrintInfoMsg("  Participant2:%s", partner.ToBase58())
+	PrintInfoMsg("  SettleTimeout:%d", settleTimeout)
+	printTxHash(txHash)
+	PrintInfoMsg("  Using './themis channel id %s %s' to query channel id.", signer.Address.ToBase58(), partner.ToBase58())
+	return nil
+}
+
+func channelDeposit(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	channelID, partner, err := getChannelIdAndPartner(ctx)
+	if err != nil || partner == common.ADDRESS_EMPTY {
+		return err
+	}
+	totalStr := ctx.String(utils.GetFlagName(utils.ChannelTotalDepositFlag))
+	if totalStr == "" {
+		PrintErrorMsg("Missing %s argument.", utils.ChannelTotalDepositFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	total := utils.ParseUsdt(totalStr)
+	if err := utils.CheckAssetAmount(utils.ASSET_USDT, total); err != nil {
+		return err
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	txHash, err := utils.SetTotalDeposit(gasPrice, gasLimit, signer, channelID, partner, total)
+	if err != nil {
+		return fmt.Errorf("set total deposit error:%s", err)
+	}
+	PrintInfoMsg("Set total deposit of channel:%d", channelID)
+	PrintInfoMsg("  Participant:%s", signer.Address.ToBase58())
+	PrintInfoMsg("  TotalDeposit:%s", utils.FormatUsdt(total))
+	printTxHash(txHash)
+	return nil
+}
+
+func channelClose(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	channelID, partner, err := getChannelIdAndPartner(ctx)
+	if err != nil || partner == common.ADDRESS_EMPTY {
+		return err
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	txHash, err := utils.CloseChannel(gasPrice, gasLimit, signer, channelID, partner)
+	if err != nil {
+		return fmt.Errorf("close channel error:%s", err)
+	}
+	PrintInfoMsg("Close channel:%d", channelID)
+	printTxHash(txHash)
+	return nil
+}
+
+func channelSettle(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	channelID, partner, err := getChannelIdAndPartner(ctx)
+	if err != nil || partner == common.ADDRESS_EMPTY {
+		return err
+	}
+	transferred, err := parseChannelAmount(ctx, utils.ChannelTransferredFlag)
+	if err != nil {
+		return err
+	}
+	partnerTransferred, err := parseChannelAmount(ctx, utils.ChannelPartnerTransferredFlag)
+	if err != nil {
+		return err
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	txHash, err := utils.SettleChannel(gasPrice, gasLimit, signer, channelID, partner, transferred, partnerTransferred)
+	if err != nil {
+		return fmt.Errorf("settle channel error:%s", err)
+	}
+	PrintInfoMsg("Settle channel:%d", channelID)
+	PrintInfoMsg("  Transferred:%s", utils.FormatUsdt(transferred))
+	PrintInfoMsg("  PartnerTransferred:%s", utils.FormatUsdt(partnerTransferred))
+	printTxHash(txHash)
+	return nil
+}
+
+func channelGetId(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	if ctx.NArg() < 2 {
+		PrintErrorMsg("Missing address1 or address2 argument.")
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	addr1, err := parseAddress(ctx, ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	addr2, err := parseAddress(ctx, ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	channelID, err := utils.GetChannelId(addr1, addr2)
+	if err != nil {
+		return err
+	}
+	if channelID == 0 {
+		PrintInfoMsg("Channel of %s and %s does not exist.", addr1.ToBase58(), addr2.ToBase58())
+		return nil
+	}
+	PrintInfoMsg("ChannelId:%d", channelID)
+	return nil
+}
+
+func channelInfo(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	channelID := ctx.Uint64(utils.GetFlagName(utils.ChannelIdFlag))
+	if channelID == 0 {
+		PrintErrorMsg("Missing %s argument.", utils.ChannelIdFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	state, err := utils.GetChannelInfo(channelID)
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("Channel:%d", channelID)
+	PrintInfoMsg("  State:%s", utils.GetChannelStateName(state.State))
+	PrintInfoMsg("  SettleBlockHeight:%d", state.SettleBlockHeight)
+	participants := []struct {
+		addr     common.Address
+		partner  common.Address
+		isCloser bool
+	}{
+		{state.Participant1, state.Participant2, state.P1IsCloser},
+		{state.Participant2, state.Participant1, state.P2IsCloser},
+	}
+	for i, p := range participants {
+		PrintInfoMsg("  Participant%d:%s", i+1, p.addr.ToBase58())
+		PrintInfoMsg("    IsCloser:%v", p.isCloser)
+		info, err := utils.GetChannelParticipantInfo(channelID, p.addr, p.partner)
+		if err != nil {
+			PrintWarnMsg("    Get participant info error:%s", err)
+			continue
+		}
+		PrintInfoMsg("    Deposit:%s", utils.FormatUsdt(info.Deposit))
+		PrintInfoMsg("    Withdrawn:%s", utils.FormatUsdt(info.WithDrawAmount))
+		PrintInfoMsg("    Nonce:%d", info.Nonce)
+	}
+	return nil
+}
+
+//getChannelPartner return empty address if the partner argument is missing
+func getChannelPartner(ctx *cli.Context) (common.Address, error) {
+	partner := ctx.String(utils.GetFlagName(utils.ChannelPartnerFlag))
+	if partner == "" {
+		PrintErrorMsg("Missing %s argument.", utils.ChannelPartnerFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return common.ADDRESS_EMPTY, nil
+	}
+	return parseAddress(ctx, partner)
+}
+
+func getChannelIdAndPartner(ctx *cli.Context) (uint64, common.Address, error) {
+	channelID := ctx.Uint64(utils.GetFlagName(utils.ChannelIdFlag))
+	if channelID == 0 {
+		PrintErrorMsg("Missing %s argument.", utils.ChannelIdFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return 0, common.ADDRESS_EMPTY, nil
+	}
+	partner, err := getChannelPartner(ctx)
+	return channelID, partner, err
+}
+
+func parseChannelAmount(ctx *cli.Context, flag cli.StringFlag) (uint64, error) {
+	amountStr := ctx.String(utils.GetFlagName(flag))
+	if amountStr == "" {
+		return 0, nil
+	}
+	amount := utils.ParseUsdt(amountStr)
+	if err := utils.CheckAssetAmount(utils.ASSET_USDT, amount); err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
@@ -20,6 +20,8 @@ package cmd
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/saveio/themis/cmd/utils"
 	"github.com/saveio/themis/common"
@@ -37,13 +39,18 @@ func SetThemisConfig(ctx *cli.Context) (*config.ThemisConfig, error) {
 	}
 	setCommonConfig(ctx, cfg.Common)
 	setConsensusConfig(ctx, cfg.Consensus)
+	err = setTxPoolConfig(ctx, cfg.TxPool)
+	if err != nil {
+		return nil, fmt.Errorf("setTxPoolConfig error:%s", err)
+	}
 	setPoCMiningConfig(ctx, cfg.PoC)
 	setP2PNodeConfig(ctx, cfg.P2PNode)
 	setRpcConfig(ctx, cfg.Rpc)
 	setRestfulConfig(ctx, cfg.Restful)
 	setGraphQLConfig(ctx, cfg.GraphQL)
 	setWebSocketConfig(ctx, cfg.Ws)
-	if cfg.Genesis.ConsensusType == config.CONSENSUS_TYPE_SOLO {
+	if cfg.Genesis.ConsensusType == config.CONSENSUS_TYPE_SOLO ||
+		cfg.Genesis.ConsensusType == config.CONSENSUS_TYPE_DEVNET {
 		cfg.Ws.EnableHttpWs = true
 		cfg.Restful.EnableHttpRestful = true
 		cfg.GraphQL.EnableGraphQL = true
@@ -66,6 +73,15 @@ func SetThemisConfig(ctx *cli.Context) (*config.ThemisConfig, error) {
 		}
 	}
 
+	if cfg.Common.LightMode {
+		//light client holds no state, can neither produce blocks nor serve snapshots
+		cfg.Consensus.EnableConsensus = false
+		cfg.Common.StateSnapshotInterval = 0
+		cfg.P2PNode.EnableStateSync = false
+		cfg.Common.ArchiveMode = false
+		cfg.Common.StateRetention = 0
+	}
+
 	enableWasmJitVerify := ctx.GlobalBool(utils.GetFlagName(utils.WasmVerifyMethodFlag))
 	if enableWasmJitVerify {
 		log.Infof("Enable wasm jit verifier")
@@ -90,6 +106,10 @@ func setGenesis(ctx *cli.Context, cfg *config.ThemisConfig) error {
 		if cfg.Genesis.SOLO.GenBlockTime <= 1 {
 			cfg.Genesis.SOLO.GenBlockTime = config.DEFAULT_GEN_BLOCK_TIME
 		}
+		cfg.Genesis.SOLO.BlockMode = ctx.String(utils.GetFlagName(utils.TestModeGenBlockModeFlag))
+		if !config.IsValidGenBlockMode(cfg.Genesis.SOLO.BlockMode) {
+			return fmt.Errorf("unknown testmode block mode:%s", cfg.Genesis.SOLO.BlockMode)
+		}
 		return nil
 	}
 
@@ -126,6 +146,26 @@ func setGenesis(ctx *cli.Context, cfg *config.ThemisConfig) error {
 		if len(cfg.Genesis.VBFT.Peers) < config.VBFT_MIN_NODE_NUM {
 			return fmt.Errorf("VBFT consensus at least need %d peers in config", config.VBFT_MIN_NODE_NUM)
 		}
+	case config.CONSENSUS_TYPE_DEVNET:
+		if len(cfg.Genesis.DEVNET.Validators) < config.DEVNET_MIN_NODE_NUM {
+			return fmt.Errorf("DEVNET consensus at least need %d validators in config", config.DEVNET_MIN_NODE_NUM)
+		}
+		if _, err = cfg.Genesis.DEVNET.ValidatorPublicKeys(); err != nil {
+			return fmt.Errorf("DEVNET config error %v", err)
+		}
+		if cfg.Genesis.DEVNET.BlockMode == "" {
+			cfg.Genesis.DEVNET.BlockMode = config.GEN_BLOCK_MODE_INTERVAL
+		}
+		if !config.IsValidGenBlockMode(cfg.Genesis.DEVNET.BlockMode) {
+			return fmt.Errorf("DEVNET unknown block mode:%s", cfg.Genesis.DEVNET.BlockMode)
+		}
+		if cfg.Genesis.DEVNET.GenBlockTime <= 0 {
+			cfg.Genesis.DEVNET.GenBlockTime = config.DEFAULT_GEN_BLOCK_TIME
+		}
+		// governance contract is initialized from vbft config, use the same one as test mode if not given
+		if len(cfg.Genesis.VBFT.Peers) == 0 {
+			cfg.Genesis.VBFT = config.MainNetConfig.VBFT.Copy()
+		}
 	default:
 		return fmt.Errorf("Unknow consensus:%s", cfg.Genesis.ConsensusType)
 	}
@@ -139,6 +179,11 @@ func setCommonConfig(ctx *cli.Context, cfg *config.CommonConfig) {
 	cfg.GasLimit = ctx.Uint64(utils.GetFlagName(utils.GasLimitFlag))
 	cfg.GasPrice = ctx.Uint64(utils.GetFlagName(utils.GasPriceFlag))
 	cfg.DataDir = ctx.String(utils.GetFlagName(utils.DataDirFlag))
+	cfg.StateSnapshotInterval = ctx.Uint(utils.GetFlagName(utils.StateSnapshotIntervalFlag))
+	cfg.LightMode = ctx.Bool(utils.GetFlagName(utils.LightModeFlag))
+	cfg.ArchiveMode = ctx.Bool(utils.GetFlagName(utils.ArchiveModeFlag))
+	cfg.StateRetention = ctx.Uint(utils.GetFlagName(utils.StateRetentionFlag))
+	cfg.StoreBackend = ctx.String(utils.GetFlagName(utils.StoreBackendFlag))
 }
 
 func setConsensusConfig(ctx *cli.Context, cfg *config.ConsensusConfig) {
@@ -146,8 +191,38 @@ func setConsensusConfig(ctx *cli.Context, cfg *config.ConsensusConfig) {
 	cfg.MaxTxInBlock = ctx.Uint(utils.GetFlagName(utils.MaxTxInBlockFlag))
 }
 
+func setTxPoolConfig(ctx *cli.Context, cfg *config.TxPoolConfig) error {
+	cfg.MaxPoolSize = ctx.Uint(utils.GetFlagName(utils.TxPoolMaxSizeFlag))
+	cfg.MaxPendingPerPayer = ctx.Uint(utils.GetFlagName(utils.TxPoolMaxPayerPendingFlag))
+	cfg.ContractQuota = ctx.Uint(utils.GetFlagName(utils.TxPoolContractQuotaFlag))
+
+	quotas := ctx.String(utils.GetFlagName(utils.TxPoolContractQuotasFlag))
+	if quotas == "" {
+		return nil
+	}
+	cfg.ContractQuotas = make(map[string]uint)
+	for _, item := range strings.Split(quotas, ",") {
+		kv := strings.Split(strings.TrimSpace(item), "=")
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid contract quota %s", item)
+		}
+		if _, err := common.AddressFromHexString(kv[0]); err != nil {
+			return fmt.Errorf("invalid contract address %s: %s", kv[0], err)
+		}
+		quota, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid quota %s: %s", kv[1], err)
+		}
+		cfg.ContractQuotas[kv[0]] = uint(quota)
+	}
+	return nil
+}
+
 func setPoCMiningConfig(ctx *cli.Context, cfg *config.PoCMiningConfig) {
 	cfg.PlotDir = ctx.String(utils.GetFlagName(utils.PlotDirFlag))
+	cfg.EnableMining = ctx.Bool(utils.GetFlagName(utils.EnableMiningFlag))
+	cfg.NumWorkTask = ctx.Int(utils.GetFlagName(utils.MiningThreadsFlag))
+	cfg.TargetDeadline = ctx.Uint64(utils.GetFlagName(utils.MiningTargetDeadlineFlag))
 }
 
 func setP2PNodeConfig(ctx *cli.Context, cfg *config.P2PNodeConfig) {
@@ -161,6 +236,11 @@ func setP2PNodeConfig(ctx *cli.Context, cfg *config.P2PNodeConfig) {
 	cfg.MaxConnInBound = ctx.Uint(utils.GetFlagName(utils.MaxConnInBoundFlag))
 	cfg.MaxConnOutBound = ctx.Uint(utils.GetFlagName(utils.MaxConnOutBoundFlag))
 	cfg.MaxConnInBoundForSingleIP = ctx.Uint(utils.GetFlagName(utils.MaxConnInBoundForSingleIPFlag))
+	cfg.EnableStateSync = ctx.Bool(utils.GetFlagName(utils.EnableStateSyncFlag))
+	cfg.PeerBanThreshold = ctx.Uint(utils.GetFlagName(utils.PeerBanThresholdFlag))
+	cfg.PeerBanTime = ctx.Uint(utils.GetFlagName(utils.PeerBanTimeFlag))
+	cfg.TxGossipFanout = ctx.Uint(utils.GetFlagName(utils.TxGossipFanoutFlag))
+	cfg.NAT = ctx.String(utils.GetFlagName(utils.NATFlag))
 
 	rsvfile := ctx.String(utils.GetFlagName(utils.ReservedPeersFileFlag))
 	if cfg.ReservedPeersOnly {
@@ -0,0 +1,228 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/urfave/cli"
+
+	"github.com/saveio/themis/cmd/utils"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/core/store/ledgerstore"
+)
+
+var DbCommand = cli.Command{
+	Name:  "db",
+	Usage: "Manage the ledger databases of a stopped node",
+	Subcommands: []cli.Command{
+		{
+			Action:    dbUsage,
+			Name:      "usage",
+			Usage:     "Display the disk usage of ledger databases",
+			ArgsUsage: "",
+			Flags: []cli.Flag{
+				utils.DataDirFlag,
+				utils.ConfigFlag,
+				utils.NetworkIdFlag,
+				utils.DbCompactFlag,
+			},
+			Description: `Display the approximate size of blocks, states, events, state history and so on in the ledger databases.
+The node should be stopped first. With --compact the databases are compacted to reclaim the space of pruned data.`,
+		},
+		{
+			Action:    dbMigrate,
+			Name:      "migrate",
+			Usage:     "Copy the ledger to another storage engine",
+			ArgsUsage: "",
+			Flags: []cli.Flag{
+				utils.DataDirFlag,
+				utils.ConfigFlag,
+				utils.NetworkIdFlag,
+				utils.LightModeFlag,
+				utils.DbTargetFlag,
+			},
+			Description: `Copy all the blocks, states, events and cross chain messages of the ledger to the storage engine specified by --to,
+leveldb or boltdb. The node should be stopped first. The original ledger is kept in a backup dir, which could be
+removed after the node runs well with the migrated ledger.`,
+		},
+		{
+			Action:    dbVerify,
+			Name:      "verify",
+			Usage:     "Verify the integrity of the ledger",
+			ArgsUsage: "",
+			Flags: []cli.Flag{
+				utils.DataDirFlag,
+				utils.ConfigFlag,
+				utils.NetworkIdFlag,
+			},
+			Description: `Walk the chain from genesis, recompute the transactions roots, block roots and state merkle roots, and check
+they are consistent with the stored headers and merkle trees. The first inconsistent height is reported, the ledger
+could be rolled back to a height below it with "db rollback". The node should be stopped first.`,
+		},
+		{
+			Action:    dbRollback,
+			Name:      "rollback",
+			Usage:     "Roll back the ledger to a block height",
+			ArgsUsage: "",
+			Flags: []cli.Flag{
+				utils.DataDirFlag,
+				utils.ConfigFlag,
+				utils.NetworkIdFlag,
+				utils.DbTargetFlag,
+			},
+			Description: `Truncate the blocks, events, cross chain messages and states above the block height specified by --to.
+The state is reverted with the state history kept in archive mode, otherwise the latest state snapshot not above
+the height is restored, and the blocks after the snapshot are executed again when the node starts.
+The node should be stopped first.`,
+		},
+	},
+	Description: `Database command inspects the ledger databases of a stopped node.`,
+}
+
+func dbUsage(ctx *cli.Context) error {
+	_, err := SetThemisConfig(ctx)
+	if err != nil {
+		PrintErrorMsg("SetThemisConfig error:%s", err)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	dbDir := utils.GetStoreDirPath(config.DefConfig.Common.DataDir, config.DefConfig.P2PNode.NetworkName)
+	compact := ctx.Bool(utils.GetFlagName(utils.DbCompactFlag))
+	if compact {
+		PrintInfoMsg("Compacting databases in %s, it may take a while", dbDir)
+	}
+	items, err := ledgerstore.GetDiskUsage(dbDir, compact)
+	if err != nil {
+		return fmt.Errorf("get disk usage error:%s", err)
+	}
+	PrintInfoMsg("Disk usage of %s:", dbDir)
+	PrintInfoMsg("%-16s %-32s %12s", "STORE", "CATEGORY", "SIZE")
+	for _, item := range items {
+		PrintInfoMsg("%-16s %-32s %12s", item.Store, item.Category, formatDiskSize(item.Size))
+	}
+	return nil
+}
+
+func dbMigrate(ctx *cli.Context) error {
+	_, err := SetThemisConfig(ctx)
+	if err != nil {
+		PrintErrorMsg("SetThemisConfig error:%s", err)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	backend := ctx.String(utils.GetFlagName(utils.DbTargetFlag))
+	if backend == "" {
+		PrintErrorMsg("Missing argument --%s", utils.GetFlagName(utils.DbTargetFlag))
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	dbDir := utils.GetStoreDirPath(config.DefConfig.Common.DataDir, config.DefConfig.P2PNode.NetworkName)
+	if config.DefConfig.Common.LightMode {
+		dbDir += "_light"
+	}
+	PrintInfoMsg("Migrating ledger in %s to %s, it may take a while", dbDir, backend)
+	result, err := ledgerstore.MigrateStore(dbDir, backend)
+	if err != nil {
+		return fmt.Errorf("migrate ledger error:%s", err)
+	}
+	for _, name := range []string{ledgerstore.DBDirBlock, ledgerstore.DBDirState, ledgerstore.DBDirEvent, ledgerstore.DBDirCrossChain} {
+		if count, ok := result.Keys[name]; ok {
+			PrintInfoMsg("%-16s %d keys", name, count)
+		}
+	}
+	PrintInfoMsg("Ledger migrated from %s to %s", result.From, result.To)
+	PrintInfoMsg("The original ledger is kept in %s, remove it after the node runs well", result.Backup)
+	return nil
+}
+
+func dbVerify(ctx *cli.Context) error {
+	_, err := SetThemisConfig(ctx)
+	if err != nil {
+		PrintErrorMsg("SetThemisConfig error:%s", err)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	dbDir := utils.GetStoreDirPath(config.DefConfig.Common.DataDir, config.DefConfig.P2PNode.NetworkName)
+	stateHashHeight := config.GetStateHashCheckHeight(config.DefConfig.P2PNode.NetworkId)
+	PrintInfoMsg("Verifying ledger in %s", dbDir)
+	result, err := ledgerstore.VerifyLedger(dbDir, stateHashHeight, func(height uint32) {
+		if height > 0 {
+			PrintInfoMsg("Verified to height %d", height)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("verify ledger error:%s", err)
+	}
+	PrintInfoMsg("Block height:%d, state height:%d, event height:%d", result.BlockHeight, result.StateHeight, result.EventHeight)
+	if result.BlockPrunedHeight > 0 || result.StatePrunedHeight > 0 {
+		PrintInfoMsg("Blocks pruned to height %d, state records pruned to height %d",
+			result.BlockPrunedHeight, result.StatePrunedHeight)
+	}
+	if result.Corrupted {
+		PrintErrorMsg("Ledger is inconsistent at height %d: %s", result.CorruptedHeight, result.Reason)
+		if result.CorruptedHeight > 0 {
+			PrintErrorMsg("Roll back to a height below it with \"themis db rollback --to <height>\"")
+		}
+		return fmt.Errorf("ledger verification failed")
+	}
+	PrintInfoMsg("Ledger is consistent, %d blocks verified", result.Verified)
+	return nil
+}
+
+func dbRollback(ctx *cli.Context) error {
+	_, err := SetThemisConfig(ctx)
+	if err != nil {
+		PrintErrorMsg("SetThemisConfig error:%s", err)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	target := ctx.String(utils.GetFlagName(utils.DbTargetFlag))
+	height, err := strconv.ParseUint(target, 10, 32)
+	if err != nil {
+		PrintErrorMsg("Invalid argument --%s, should be a block height", utils.GetFlagName(utils.DbTargetFlag))
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	dbDir := utils.GetStoreDirPath(config.DefConfig.Common.DataDir, config.DefConfig.P2PNode.NetworkName)
+	stateHashHeight := config.GetStateHashCheckHeight(config.DefConfig.P2PNode.NetworkId)
+	result, err := ledgerstore.RollbackLedger(dbDir, stateHashHeight, uint32(height))
+	if err != nil {
+		return fmt.Errorf("rollback ledger error:%s", err)
+	}
+	PrintInfoMsg("Ledger rolled back from height %d to %d", result.From, result.To)
+	if result.SnapshotHeight > 0 && result.SnapshotHeight < result.To {
+		PrintInfoMsg("State snapshot at height %d restored, blocks %d to %d will be executed again when node starts",
+			result.SnapshotHeight, result.SnapshotHeight+1, result.To)
+	}
+	return nil
+}
+
+func formatDiskSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.2f %s", value, units[i])
+}
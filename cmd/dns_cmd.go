@@ -0,0 +1,250 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/urfave/cli"
+
+	"github.com/saveio/themis/cmd/utils"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/smartcontract/service/native/dns"
+)
+
+var DnsCommand = cli.Command{
+	Name:        "dns",
+	Usage:       "Manage dns names and nodes",
+	Description: "Dns commands can register, transfer and query names, and register dns nodes.",
+	Subcommands: []cli.Command{
+		{
+			Action:      dnsRegisterName,
+			Name:        "register",
+			Usage:       "Register a name",
+			ArgsUsage:   " ",
+			Description: "Register a name owned by the account. If url is not specified, a url is generated by the contract. If header is not specified, using dsp header.",
+			Flags: append([]cli.Flag{
+				utils.DnsNameFlag,
+				utils.DnsHeaderFlag,
+				utils.DnsUrlFlag,
+				utils.DnsDescFlag,
+				utils.DnsTTLFlag,
+			}, nativeTxFlags...),
+		},
+		{
+			Action:    dnsTransferName,
+			Name:      "transfer",
+			Usage:     "Transfer a name to another account",
+			ArgsUsage: " ",
+			Flags: append([]cli.Flag{
+				utils.DnsHeaderFlag,
+				utils.DnsUrlFlag,
+				utils.TransactionToFlag,
+			}, nativeTxFlags...),
+		},
+		{
+			Action:    dnsQueryName,
+			Name:      "query",
+			Usage:     "Display info of a name",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				utils.RPCPortFlag,
+				utils.DnsHeaderFlag,
+				utils.DnsUrlFlag,
+			},
+		},
+		{
+			Name:  "node",
+			Usage: "Manage dns nodes",
+			Subcommands: []cli.Command{
+				{
+					Action:      dnsNodeRegister,
+					Name:        "register",
+					Usage:       "Register account as a dns node candidate",
+					ArgsUsage:   " ",
+					Description: "Register account as a dns node candidate. Init deposit is transferred from the account, and the candidate takes effect after approved.",
+					Flags: append([]cli.Flag{
+						utils.DnsNodeIPFlag,
+						utils.DnsNodePortFlag,
+						utils.DnsNodeDepositFlag,
+						utils.DnsNodePubkeyFlag,
+					}, nativeTxFlags...),
+				},
+				{
+					Action:    dnsNodeList,
+					Name:      "list",
+					Usage:     "List all dns nodes",
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						utils.RPCPortFlag,
+					},
+				},
+			},
+		},
+	},
+}
+
+func dnsRegisterName(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	name := ctx.String(utils.GetFlagName(utils.DnsNameFlag))
+	if len(name) < dns.MIN_NAME_LEN {
+		PrintErrorMsg("Missing %s argument or it is shorter than %d characters.", utils.DnsNameFlag.Name, dns.MIN_NAME_LEN)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	req := utils.NewDnsRequestName(signer.Address,
+		ctx.String(utils.GetFlagName(utils.DnsHeaderFlag)),
+		ctx.String(utils.GetFlagName(utils.DnsUrlFlag)),
+		name,
+		ctx.String(utils.GetFlagName(utils.DnsDescFlag)),
+		ctx.Uint64(utils.GetFlagName(utils.DnsTTLFlag)))
+	txHash, err := utils.DnsRegisterName(gasPrice, gasLimit, signer, req)
+	if err != nil {
+		return fmt.Errorf("register name error:%s", err)
+	}
+	PrintInfoMsg("Register name:%s", name)
+	PrintInfoMsg("  Owner:%s", signer.Address.ToBase58())
+	PrintInfoMsg("  Header:%s", req.Header)
+	if len(req.URL) > 0 {
+		PrintInfoMsg("  Url:%s", req.URL)
+	}
+	printTxHash(txHash)
+	return nil
+}
+
+func dnsTransferName(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	url := ctx.String(utils.GetFlagName(utils.DnsUrlFlag))
+	to := ctx.String(utils.GetFlagName(utils.TransactionToFlag))
+	if url == "" || to == "" {
+		PrintErrorMsg("Missing %s or %s argument.", utils.DnsUrlFlag.Name, utils.TransactionToFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	header := getDnsHeader(ctx)
+	toAddr, err := parseAddress(ctx, to)
+	if err != nil {
+		return err
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	txHash, err := utils.DnsTransferName(gasPrice, gasLimit, signer, header, url, toAddr)
+	if err != nil {
+		return fmt.Errorf("transfer name error:%s", err)
+	}
+	PrintInfoMsg("Transfer name:%s://%s", header, url)
+	PrintInfoMsg("  From:%s", signer.Address.ToBase58())
+	PrintInfoMsg("  To:%s", toAddr.ToBase58())
+	printTxHash(txHash)
+	return nil
+}
+
+func dnsQueryName(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	url := ctx.String(utils.GetFlagName(utils.DnsUrlFlag))
+	if url == "" {
+		PrintErrorMsg("Missing %s argument.", utils.DnsUrlFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	header := getDnsHeader(ctx)
+	nameInfo, err := utils.GetDnsName(header, url)
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("Name:%s://%s", nameInfo.Header, nameInfo.URL)
+	PrintInfoMsg("  Name:%s", nameInfo.Name)
+	PrintInfoMsg("  Owner:%s", nameInfo.NameOwner.ToBase58())
+	PrintInfoMsg("  Desc:%s", nameInfo.Desc)
+	PrintInfoMsg("  BlockHeight:%d", nameInfo.BlockHeight)
+	PrintInfoMsg("  TTL:%d", nameInfo.TTL)
+	return nil
+}
+
+func dnsNodeRegister(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	ip := ctx.String(utils.GetFlagName(utils.DnsNodeIPFlag))
+	port := ctx.String(utils.GetFlagName(utils.DnsNodePortFlag))
+	depositStr := ctx.String(utils.GetFlagName(utils.DnsNodeDepositFlag))
+	if ip == "" || port == "" || depositStr == "" {
+		PrintErrorMsg("Missing %s %s or %s argument.", utils.DnsNodeIPFlag.Name, utils.DnsNodePortFlag.Name, utils.DnsNodeDepositFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	deposit := utils.ParseUsdt(depositStr)
+	if err := utils.CheckAssetAmount(utils.ASSET_USDT, deposit); err != nil {
+		return err
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	pubkey := ctx.String(utils.GetFlagName(utils.DnsNodePubkeyFlag))
+	if pubkey == "" {
+		pubkey = fmt.Sprintf("%x", keypair.SerializePublicKey(signer.PublicKey))
+	}
+	txHash, err := utils.DnsNodeRegister(gasPrice, gasLimit, signer, ip, port, deposit, pubkey)
+	if err != nil {
+		return fmt.Errorf("register dns node error:%s", err)
+	}
+	PrintInfoMsg("Register dns node:")
+	PrintInfoMsg("  WalletAddr:%s", signer.Address.ToBase58())
+	PrintInfoMsg("  Addr:%s:%s", ip, port)
+	PrintInfoMsg("  Deposit:%s", utils.FormatUsdt(deposit))
+	PrintInfoMsg("  Pubkey:%s", pubkey)
+	printTxHash(txHash)
+	return nil
+}
+
+func dnsNodeList(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	nodes, err := utils.GetAllDnsNodes()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	PrintInfoMsg("Dns nodes:%d", len(nodes))
+	for i, key := range keys {
+		node := nodes[key]
+		PrintInfoMsg("Index:%d", i+1)
+		PrintInfoMsg("  WalletAddr:%s", node.WalletAddr.ToBase58())
+		PrintInfoMsg("  Addr:%s:%s", node.IP, node.Port)
+		PrintInfoMsg("  Deposit:%s", utils.FormatUsdt(node.InitDeposit))
+		PrintInfoMsg("  Pubkey:%s", node.PeerPubKey)
+	}
+	return nil
+}
+
+func getDnsHeader(ctx *cli.Context) string {
+	header := ctx.String(utils.GetFlagName(utils.DnsHeaderFlag))
+	if header == "" {
+		return string(dns.DSP_HEADER)
+	}
+	return header
+}
@@ -0,0 +1,661 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	cmdcom "github.com/saveio/themis/cmd/common"
+	"github.com/saveio/themis/cmd/utils"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/smartcontract/service/native/savefs"
+)
+
+var FsCommand = cli.Command{
+	Name:        "fs",
+	Usage:       "Manage savefs storage nodes, files and user spaces",
+	Description: "Savefs commands can register storage nodes, query settings and fees, and manage files, user spaces and sectors.",
+	Subcommands: []cli.Command{
+		{
+			Action:    fsSetting,
+			Name:      "setting",
+			Usage:     "Display global setting of savefs",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				utils.RPCPortFlag,
+			},
+		},
+		{
+			Action:      fsFee,
+			Name:        "fee",
+			Usage:       "Display the storage fee of uploading a file",
+			ArgsUsage:   " ",
+			Description: "Display the storage fee of uploading a file. Professional storage pays for space and validation until the expired height.",
+			Flags: []cli.Flag{
+				utils.RPCPortFlag,
+				utils.FsFileSizeFlag,
+				utils.FsCopyNumFlag,
+				utils.FsProveIntervalFlag,
+				utils.FsExpiredHeightFlag,
+				utils.FsProfessionalFlag,
+			},
+		},
+		{
+			Name:  "node",
+			Usage: "Manage storage nodes",
+			Subcommands: []cli.Command{
+				{
+					Action:      fsNodeRegister,
+					Name:        "register",
+					Usage:       "Register account as a storage node",
+					ArgsUsage:   " ",
+					Description: "Register account as a storage node. Pledge is transferred from the account according to volume.",
+					Flags: append([]cli.Flag{
+						utils.FsNodeVolumeFlag,
+						utils.FsNodeServiceTimeFlag,
+						utils.FsNodeAddrFlag,
+					}, nativeTxFlags...),
+				},
+				{
+					Action:      fsNodeUpdate,
+					Name:        "update",
+					Usage:       "Update volume, service time and address of storage node",
+					ArgsUsage:   " ",
+					Description: "Update volume, service time and address of storage node. Pledge is adjusted according to the new volume.",
+					Flags: append([]cli.Flag{
+						utils.FsNodeVolumeFlag,
+						utils.FsNodeServiceTimeFlag,
+						utils.FsNodeAddrFlag,
+					}, nativeTxFlags...),
+				},
+				{
+					Action:      fsNodeCancel,
+					Name:        "cancel",
+					Usage:       "Cancel storage node",
+					ArgsUsage:   " ",
+					Description: "Cancel storage node. Pledge and profit are returned to the account, and all sectors of node are deleted.",
+					Flags:       nativeTxFlags,
+				},
+				{
+					Action:    fsNodeInfo,
+					Name:      "info",
+					Usage:     "Display info of storage node",
+					ArgsUsage: "<address|label|index>",
+					Flags: []cli.Flag{
+						utils.RPCPortFlag,
+						utils.WalletFileFlag,
+					},
+				},
+				{
+					Action:    fsNodeList,
+					Name:      "list",
+					Usage:     "List all storage nodes",
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						utils.RPCPortFlag,
+					},
+				},
+			},
+		},
+		{
+			Name:  "file",
+			Usage: "Manage files",
+			Subcommands: []cli.Command{
+				{
+					Action:    fsFileList,
+					Name:      "list",
+					Usage:     "List files of account",
+					ArgsUsage: "<address|label|index>",
+					Flags: []cli.Flag{
+						utils.RPCPortFlag,
+						utils.WalletFileFlag,
+					},
+				},
+				{
+					Action:    fsFileInfo,
+					Name:      "info",
+					Usage:     "Display info of file",
+					ArgsUsage: "<hash>",
+					Flags: []cli.Flag{
+						utils.RPCPortFlag,
+					},
+				},
+				{
+					Action:      fsFileRenew,
+					Name:        "renew",
+					Usage:       "Renew file",
+					ArgsUsage:   " ",
+					Description: "Renew file of professional storage type. Expired height is extended by times of prove interval.",
+					Flags: append([]cli.Flag{
+						utils.FsFileHashFlag,
+						utils.FsRenewTimesFlag,
+					}, nativeTxFlags...),
+				},
+				{
+					Action:    fsFileDelete,
+					Name:      "delete",
+					Usage:     "Delete files",
+					ArgsUsage: "<hash> [<hash>...]",
+					Flags:     nativeTxFlags,
+				},
+				{
+					Action:    fsFileTransfer,
+					Name:      "transfer",
+					Usage:     "Transfer file to another account",
+					ArgsUsage: " ",
+					Flags: append([]cli.Flag{
+						utils.FsFileHashFlag,
+						utils.TransactionToFlag,
+					}, nativeTxFlags...),
+				},
+			},
+		},
+		{
+			Name:  "userspace",
+			Usage: "Manage user spaces",
+			Subcommands: []cli.Command{
+				{
+					Action:    fsUserSpaceInfo,
+					Name:      "info",
+					Usage:     "Display user space of account",
+					ArgsUsage: "<address|label|index>",
+					Flags: []cli.Flag{
+						utils.RPCPortFlag,
+						utils.WalletFileFlag,
+					},
+				},
+				{
+					Action:      fsUserSpaceCost,
+					Name:        "cost",
+					Usage:       "Display the cost of changing user space",
+					ArgsUsage:   " ",
+					Description: "Display the transfer needed to add or revoke size and blocks of user space.",
+					Flags: []cli.Flag{
+						utils.RPCPortFlag,
+						utils.WalletFileFlag,
+						utils.AccountAddressFlag,
+						utils.FsSpaceOwnerFlag,
+						utils.FsSpaceSizeFlag,
+						utils.FsSpaceBlocksFlag,
+						utils.FsSpaceRevokeFlag,
+					},
+				},
+				{
+					Action:      fsUserSpaceManage,
+					Name:        "manage",
+					Usage:       "Add or revoke size and blocks of user space",
+					ArgsUsage:   " ",
+					Description: "Add or revoke size and blocks of user space. The account pays for added space and receives refund of revoked space.",
+					Flags: append([]cli.Flag{
+						utils.FsSpaceOwnerFlag,
+						utils.FsSpaceSizeFlag,
+						utils.FsSpaceBlocksFlag,
+						utils.FsSpaceRevokeFlag,
+					}, nativeTxFlags...),
+				},
+			},
+		},
+		{
+			Name:  "sector",
+			Usage: "Manage sectors",
+			Subcommands: []cli.Command{
+				{
+					Action:    fsSectorList,
+					Name:      "list",
+					Usage:     "List sectors of storage node",
+					ArgsUsage: "<address|label|index>",
+					Flags: []cli.Flag{
+						utils.RPCPortFlag,
+						utils.WalletFileFlag,
+					},
+				},
+			},
+		},
+	},
+}
+
+func fsSetting(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	setting, err := utils.GetFsSetting()
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("Savefs setting:")
+	PrintInfoMsg("  FsGasPrice:%d", setting.FsGasPrice)
+	PrintInfoMsg("  GasPerGBPerBlock:%d", setting.GasPerGBPerBlock)
+	PrintInfoMsg("  GasPerKBForRead:%d", setting.GasPerKBForRead)
+	PrintInfoMsg("  GasForChallenge:%d", setting.GasForChallenge)
+	PrintInfoMsg("  MaxProveBlockNum:%d", setting.MaxProveBlockNum)
+	PrintInfoMsg("  MinVolume:%s", formatFsSize(setting.MinVolume))
+	PrintInfoMsg("  DefaultProvePeriod:%d", setting.DefaultProvePeriod)
+	PrintInfoMsg("  DefaultProveLevel:%d", setting.DefaultProveLevel)
+	PrintInfoMsg("  DefaultCopyNum:%d", setting.DefaultCopyNum)
+	return nil
+}
+
+func fsFee(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	fileSize := ctx.Uint64(utils.GetFlagName(utils.FsFileSizeFlag))
+	if fileSize == 0 {
+		PrintErrorMsg("Missing %s argument.", utils.FsFileSizeFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	opt := &savefs.UploadOption{
+		FileSize:      fileSize,
+		CopyNum:       ctx.Uint64(utils.GetFlagName(utils.FsCopyNumFlag)),
+		ProveInterval: ctx.Uint64(utils.GetFlagName(utils.FsProveIntervalFlag)),
+		ExpiredHeight: ctx.Uint64(utils.GetFlagName(utils.FsExpiredHeightFlag)),
+		StorageType:   uint64(savefs.FileStoreTypeNormal),
+	}
+	if ctx.Bool(utils.GetFlagName(utils.FsProfessionalFlag)) {
+		height, err := utils.GetBlockCount()
+		if err != nil {
+			return err
+		}
+		if opt.ExpiredHeight <= uint64(height) {
+			PrintErrorMsg("Argument %s should be greater than current height:%d.", utils.FsExpiredHeightFlag.Name, height)
+			return nil
+		}
+		opt.StorageType = uint64(savefs.FileStoreTypeProfessional)
+	}
+	fee, err := utils.GetFsStorageFee(opt)
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("Storage fee:")
+	PrintInfoMsg("  TxnFee:%s", utils.FormatUsdt(fee.TxnFee))
+	PrintInfoMsg("  SpaceFee:%s", utils.FormatUsdt(fee.SpaceFee))
+	PrintInfoMsg("  ValidationFee:%s", utils.FormatUsdt(fee.ValidationFee))
+	PrintInfoMsg("  Total:%s", utils.FormatUsdt(fee.Sum()))
+	return nil
+}
+
+func fsNodeRegister(ctx *cli.Context) error {
+	return fsNodeSet(ctx, false)
+}
+
+func fsNodeUpdate(ctx *cli.Context) error {
+	return fsNodeSet(ctx, true)
+}
+
+func fsNodeSet(ctx *cli.Context, update bool) error {
+	SetRpcPort(ctx)
+	volume := ctx.Uint64(utils.GetFlagName(utils.FsNodeVolumeFlag))
+	serviceTime := ctx.Uint64(utils.GetFlagName(utils.FsNodeServiceTimeFlag))
+	nodeAddr := ctx.String(utils.GetFlagName(utils.FsNodeAddrFlag))
+	if volume == 0 || serviceTime == 0 || nodeAddr == "" {
+		PrintErrorMsg("Missing %s %s or %s argument.", utils.FsNodeVolumeFlag.Name, utils.FsNodeServiceTimeFlag.Name, utils.FsNodeAddrFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	var txHash string
+	if update {
+		txHash, err = utils.FsNodeUpdate(gasPrice, gasLimit, signer, volume, serviceTime, nodeAddr)
+	} else {
+		txHash, err = utils.FsNodeRegister(gasPrice, gasLimit, signer, volume, serviceTime, nodeAddr)
+	}
+	if err != nil {
+		return fmt.Errorf("set storage node error:%s", err)
+	}
+	if update {
+		PrintInfoMsg("Update storage node:")
+	} else {
+		PrintInfoMsg("Register storage node:")
+	}
+	PrintInfoMsg("  WalletAddr:%s", signer.Address.ToBase58())
+	PrintInfoMsg("  NodeAddr:%s", nodeAddr)
+	PrintInfoMsg("  Volume:%s", formatFsSize(volume))
+	PrintInfoMsg("  ServiceTime:%d", serviceTime)
+	printTxHash(txHash)
+	return nil
+}
+
+func fsNodeCancel(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	txHash, err := utils.FsNodeCancel(gasPrice, gasLimit, signer)
+	if err != nil {
+		return fmt.Errorf("cancel storage node error:%s", err)
+	}
+	PrintInfoMsg("Cancel storage node:")
+	PrintInfoMsg("  WalletAddr:%s", signer.Address.ToBase58())
+	printTxHash(txHash)
+	return nil
+}
+
+func fsNodeInfo(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	walletAddr, err := parseAddressArg(ctx)
+	if err != nil || walletAddr == common.ADDRESS_EMPTY {
+		return err
+	}
+	nodeInfo, err := utils.GetFsNodeInfo(walletAddr)
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("Storage node:")
+	printFsNodeInfo(nodeInfo)
+	return nil
+}
+
+func fsNodeList(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	nodesInfo, err := utils.GetFsNodeList()
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("Storage nodes:%d", nodesInfo.NodeNum)
+	for i := range nodesInfo.NodeInfo {
+		PrintInfoMsg("Index:%d", i+1)
+		printFsNodeInfo(&nodesInfo.NodeInfo[i])
+	}
+	return nil
+}
+
+func printFsNodeInfo(nodeInfo *savefs.FsNodeInfo) {
+	PrintInfoMsg("  WalletAddr:%s", nodeInfo.WalletAddr.ToBase58())
+	PrintInfoMsg("  NodeAddr:%s", nodeInfo.NodeAddr)
+	PrintInfoMsg("  Volume:%s", formatFsSize(nodeInfo.Volume))
+	PrintInfoMsg("  RestVol:%s", formatFsSize(nodeInfo.RestVol))
+	PrintInfoMsg("  ServiceTime:%d", nodeInfo.ServiceTime)
+	PrintInfoMsg("  Pledge:%s", utils.FormatUsdt(nodeInfo.Pledge))
+	PrintInfoMsg("  Profit:%s", utils.FormatUsdt(nodeInfo.Profit))
+}
+
+func fsFileList(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	walletAddr, err := parseAddressArg(ctx)
+	if err != nil || walletAddr == common.ADDRESS_EMPTY {
+		return err
+	}
+	fileList, err := utils.GetFsFileList(walletAddr)
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("Files of %s:%d", walletAddr.ToBase58(), fileList.FileNum)
+	for _, fileHash := range fileList.List {
+		PrintInfoMsg("  %s", fileHash.Hash)
+	}
+	return nil
+}
+
+func fsFileInfo(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	if ctx.NArg() < 1 {
+		PrintErrorMsg("Missing file hash argument.")
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	fileInfo, err := utils.GetFsFileInfo(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	storageType := "useSpace"
+	if fileInfo.StorageType == savefs.FileStorageTypeCustom {
+		storageType = "custom"
+	}
+	PrintInfoMsg("File:%s", fileInfo.FileHash)
+	PrintInfoMsg("  Owner:%s", fileInfo.FileOwner.ToBase58())
+	PrintInfoMsg("  Desc:%s", fileInfo.FileDesc)
+	PrintInfoMsg("  Url:%s", fileInfo.Url)
+	PrintInfoMsg("  Size:%s", formatFsSize(fileInfo.RealFileSize))
+	PrintInfoMsg("  BlockNum:%d", fileInfo.FileBlockNum)
+	PrintInfoMsg("  BlockSize:%d", fileInfo.FileBlockSize)
+	PrintInfoMsg("  Privilege:%d", fileInfo.Privilege)
+	PrintInfoMsg("  StorageType:%s", storageType)
+	PrintInfoMsg("  CopyNum:%d", fileInfo.CopyNum)
+	PrintInfoMsg("  ProveLevel:%d", fileInfo.ProveLevel)
+	PrintInfoMsg("  ProveInterval:%d", fileInfo.ProveInterval)
+	PrintInfoMsg("  ProveTimes:%d", fileInfo.ProveTimes)
+	PrintInfoMsg("  BlockHeight:%d", fileInfo.BlockHeight)
+	PrintInfoMsg("  ExpiredHeight:%d", fileInfo.ExpiredHeight)
+	PrintInfoMsg("  Deposit:%s", utils.FormatUsdt(fileInfo.Deposit))
+	PrintInfoMsg("  Valid:%t", fileInfo.ValidFlag)
+	PrintInfoMsg("  IsPlotFile:%t", fileInfo.IsPlotFile)
+	PrintInfoMsg("  PrimaryNodes:")
+	for _, addr := range fileInfo.PrimaryNodes.AddrList {
+		PrintInfoMsg("    %s", addr.ToBase58())
+	}
+	PrintInfoMsg("  CandidateNodes:")
+	for _, addr := range fileInfo.CandidateNodes.AddrList {
+		PrintInfoMsg("    %s", addr.ToBase58())
+	}
+	return nil
+}
+
+func fsFileRenew(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	fileHash := ctx.String(utils.GetFlagName(utils.FsFileHashFlag))
+	times := ctx.Uint64(utils.GetFlagName(utils.FsRenewTimesFlag))
+	if fileHash == "" || times == 0 {
+		PrintErrorMsg("Missing %s or %s argument.", utils.FsFileHashFlag.Name, utils.FsRenewTimesFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	txHash, err := utils.FsFileRenew(gasPrice, gasLimit, signer, fileHash, times)
+	if err != nil {
+		return fmt.Errorf("renew file error:%s", err)
+	}
+	PrintInfoMsg("Renew file:%s", fileHash)
+	PrintInfoMsg("  Times:%d", times)
+	printTxHash(txHash)
+	return nil
+}
+
+func fsFileDelete(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	if ctx.NArg() < 1 {
+		PrintErrorMsg("Missing file hash argument.")
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	fileHashes := []string(ctx.Args())
+	txHash, err := utils.FsDeleteFiles(gasPrice, gasLimit, signer, fileHashes)
+	if err != nil {
+		return fmt.Errorf("delete files error:%s", err)
+	}
+	PrintInfoMsg("Delete files:")
+	for _, fileHash := range fileHashes {
+		PrintInfoMsg("  %s", fileHash)
+	}
+	printTxHash(txHash)
+	return nil
+}
+
+func fsFileTransfer(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	fileHash := ctx.String(utils.GetFlagName(utils.FsFileHashFlag))
+	to := ctx.String(utils.GetFlagName(utils.TransactionToFlag))
+	if fileHash == "" || to == "" {
+		PrintErrorMsg("Missing %s or %s argument.", utils.FsFileHashFlag.Name, utils.TransactionToFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	newOwner, err := parseAddress(ctx, to)
+	if err != nil {
+		return err
+	}
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	txHash, err := utils.FsChangeFileOwner(gasPrice, gasLimit, signer, fileHash, newOwner)
+	if err != nil {
+		return fmt.Errorf("transfer file error:%s", err)
+	}
+	PrintInfoMsg("Transfer file:%s", fileHash)
+	PrintInfoMsg("  From:%s", signer.Address.ToBase58())
+	PrintInfoMsg("  To:%s", newOwner.ToBase58())
+	printTxHash(txHash)
+	return nil
+}
+
+func fsUserSpaceInfo(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	walletAddr, err := parseAddressArg(ctx)
+	if err != nil || walletAddr == common.ADDRESS_EMPTY {
+		return err
+	}
+	userSpace, err := utils.GetFsUserSpace(walletAddr)
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("User space of %s:", walletAddr.ToBase58())
+	PrintInfoMsg("  Used:%s", formatFsSize(userSpace.Used))
+	PrintInfoMsg("  Remain:%s", formatFsSize(userSpace.Remain))
+	PrintInfoMsg("  ExpireHeight:%d", userSpace.ExpireHeight)
+	PrintInfoMsg("  UpdateHeight:%d", userSpace.UpdateHeight)
+	PrintInfoMsg("  Balance:%s", utils.FormatUsdt(userSpace.Balance))
+	return nil
+}
+
+func fsUserSpaceCost(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	address := ctx.String(utils.GetFlagName(utils.AccountAddressFlag))
+	if address == "" {
+		wallet, err := cmdcom.OpenWallet(ctx)
+		if err != nil {
+			return err
+		}
+		acc := wallet.GetDefaultAccountMetadata()
+		if acc == nil {
+			return fmt.Errorf("cannot get default account")
+		}
+		address = acc.Address
+	}
+	walletAddr, err := parseAddress(ctx, address)
+	if err != nil {
+		return err
+	}
+	params, err := getFsUserSpaceParams(ctx, walletAddr)
+	if err != nil || params == nil {
+		return err
+	}
+	state, err := utils.GetFsUserSpaceCost(params)
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("User space cost of %s:", params.Owner.ToBase58())
+	PrintInfoMsg("  From:%s", state.From.ToBase58())
+	PrintInfoMsg("  To:%s", state.To.ToBase58())
+	PrintInfoMsg("  Amount:%s", utils.FormatUsdt(state.Value))
+	return nil
+}
+
+func fsUserSpaceManage(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	signer, gasPrice, gasLimit, err := getNativeTxParams(ctx)
+	if err != nil {
+		return err
+	}
+	params, err := getFsUserSpaceParams(ctx, signer.Address)
+	if err != nil || params == nil {
+		return err
+	}
+	txHash, err := utils.FsManageUserSpace(gasPrice, gasLimit, signer, params)
+	if err != nil {
+		return fmt.Errorf("manage user space error:%s", err)
+	}
+	if ctx.Bool(utils.GetFlagName(utils.FsSpaceRevokeFlag)) {
+		PrintInfoMsg("Revoke user space of %s:", params.Owner.ToBase58())
+	} else {
+		PrintInfoMsg("Add user space of %s:", params.Owner.ToBase58())
+	}
+	PrintInfoMsg("  Size:%s", formatFsSize(params.Size.Value))
+	PrintInfoMsg("  Blocks:%d", params.BlockCount.Value)
+	printTxHash(txHash)
+	return nil
+}
+
+//getFsUserSpaceParams return nil params if neither size nor blocks specified
+func getFsUserSpaceParams(ctx *cli.Context, walletAddr common.Address) (*savefs.UserSpaceParams, error) {
+	size := ctx.Uint64(utils.GetFlagName(utils.FsSpaceSizeFlag))
+	blocks := ctx.Uint64(utils.GetFlagName(utils.FsSpaceBlocksFlag))
+	if size == 0 && blocks == 0 {
+		PrintErrorMsg("Missing %s or %s argument.", utils.FsSpaceSizeFlag.Name, utils.FsSpaceBlocksFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil, nil
+	}
+	owner := walletAddr
+	if ownerArg := ctx.String(utils.GetFlagName(utils.FsSpaceOwnerFlag)); ownerArg != "" {
+		var err error
+		owner, err = parseAddress(ctx, ownerArg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	revoke := ctx.Bool(utils.GetFlagName(utils.FsSpaceRevokeFlag))
+	return utils.NewFsUserSpaceParams(walletAddr, owner, size, blocks, revoke), nil
+}
+
+func fsSectorList(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	nodeAddr, err := parseAddressArg(ctx)
+	if err != nil || nodeAddr == common.ADDRESS_EMPTY {
+		return err
+	}
+	sectorInfos, err := utils.GetFsSectorsForNode(nodeAddr)
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("Sectors of %s:%d", nodeAddr.ToBase58(), sectorInfos.SectorCount)
+	for _, sector := range sectorInfos.Sectors {
+		PrintInfoMsg("SectorID:%d", sector.SectorID)
+		PrintInfoMsg("  Size:%s", formatFsSize(sector.Size))
+		PrintInfoMsg("  Used:%s", formatFsSize(sector.Used))
+		PrintInfoMsg("  ProveLevel:%d", sector.ProveLevel)
+		PrintInfoMsg("  FirstProveHeight:%d", sector.FirstProveHeight)
+		PrintInfoMsg("  NextProveHeight:%d", sector.NextProveHeight)
+		PrintInfoMsg("  FileNum:%d", sector.FileNum)
+		PrintInfoMsg("  IsPlots:%t", sector.IsPlots)
+	}
+	return nil
+}
+
+//formatFsSize format size in KB to human readable string
+func formatFsSize(kb uint64) string {
+	units := []string{"KB", "MB", "GB", "TB", "PB"}
+	size := float64(kb)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d KB", kb)
+	}
+	return fmt.Sprintf("%.2f %s", size, units[i])
+}
@@ -73,6 +73,16 @@ var InfoCommand = cli.Command{
 				utils.RPCPortFlag,
 			},
 		},
+		{
+			Action:      miningStats,
+			Name:        "mining",
+			Usage:       "Display status of the built-in miner",
+			ArgsUsage:   "",
+			Description: `Display status of the built-in miner, such as plot files, current view and best deadline.`,
+			Flags: []cli.Flag{
+				utils.RPCPortFlag,
+			},
+		},
 	},
 	Description: `Query information command can query information such as blocks, transactions, and transaction executions. 
 You can use the ./Ontology info block --help command to view help information.`,
@@ -166,6 +176,17 @@ func curBlockHeight(ctx *cli.Context) error {
 	return nil
 }
 
+func miningStats(ctx *cli.Context) error {
+	SetRpcPort(ctx)
+	stats, err := utils.GetMiningStats()
+	if err != nil {
+		return fmt.Errorf("GetMiningStats error:%s", err)
+	}
+	PrintInfoMsg("Mining status:")
+	PrintJsonData(stats)
+	return nil
+}
+
 func showTx(ctx *cli.Context) error {
 	SetRpcPort(ctx)
 	if ctx.NArg() < 1 {
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"github.com/urfave/cli"
+
+	"github.com/saveio/themis/account"
+	cmdcom "github.com/saveio/themis/cmd/common"
+	"github.com/saveio/themis/cmd/utils"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+)
+
+//nativeTxFlags are flags of commands which sign and send native contract transactions
+var nativeTxFlags = []cli.Flag{
+	utils.RPCPortFlag,
+	utils.TransactionGasPriceFlag,
+	utils.TransactionGasLimitFlag,
+	utils.AccountAddressFlag,
+	utils.WalletFileFlag,
+}
+
+func getNativeTxParams(ctx *cli.Context) (*account.Account, uint64, uint64, error) {
+	gasPrice := ctx.Uint64(utils.TransactionGasPriceFlag.Name)
+	gasLimit := ctx.Uint64(utils.TransactionGasLimitFlag.Name)
+	networkId, err := utils.GetNetworkId()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if networkId == config.NETWORK_ID_SOLO_NET {
+		gasPrice = 0
+	}
+	signer, err := cmdcom.GetAccount(ctx)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return signer, gasPrice, gasLimit, nil
+}
+
+//parseAddressArg return empty address if the address argument is missing
+func parseAddressArg(ctx *cli.Context) (common.Address, error) {
+	if ctx.NArg() < 1 {
+		PrintErrorMsg("Missing account argument.")
+		cli.ShowSubcommandHelp(ctx)
+		return common.ADDRESS_EMPTY, nil
+	}
+	return parseAddress(ctx, ctx.Args().First())
+}
+
+func parseAddress(ctx *cli.Context, address string) (common.Address, error) {
+	addr, err := cmdcom.ParseAddress(address, ctx)
+	if err != nil {
+		return common.ADDRESS_EMPTY, err
+	}
+	return common.AddressFromBase58(addr)
+}
+
+func printTxHash(txHash string) {
+	PrintInfoMsg("  TxHash:%s", txHash)
+	PrintInfoMsg("\nTip:")
+	PrintInfoMsg("  Using './themis info status %s' to query transaction status.", txHash)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/saveio/themis/cmd/utils"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/miner"
+)
+
+var PlotCommand = cli.Command{
+	Name:        "plot",
+	Usage:       "Generate and verify plot files",
+	Description: "Plot commands can generate plot files of account for PoC mining and savefs, and verify existing plot files.",
+	Subcommands: []cli.Command{
+		{
+			Action:    plotGenerate,
+			Name:      "generate",
+			Usage:     "Generate a plot file of account",
+			ArgsUsage: "<address|label|index>",
+			Description: "Generate a plot file of account for nonces from start. The file is named <numeric id>_<start nonce>_<nonces>. " +
+				"Generation can be interrupted by Ctrl+C, and resumed by running the same command.",
+			Flags: []cli.Flag{
+				utils.PlotFileDirFlag,
+				utils.PlotStartNonceFlag,
+				utils.PlotNoncesFlag,
+				utils.PlotThreadsFlag,
+				utils.PlotBatchNoncesFlag,
+				utils.WalletFileFlag,
+			},
+		},
+		{
+			Action:      plotVerify,
+			Name:        "verify",
+			Usage:       "Verify plot files",
+			ArgsUsage:   "<file>...",
+			Description: "Verify nonces in plot files against generated ones.",
+			Flags: []cli.Flag{
+				utils.PlotVerifySamplesFlag,
+			},
+		},
+	},
+}
+
+func plotGenerate(ctx *cli.Context) error {
+	addr, err := parseAddressArg(ctx)
+	if err != nil || addr == common.ADDRESS_EMPTY {
+		return err
+	}
+	nonces := ctx.Uint64(utils.GetFlagName(utils.PlotNoncesFlag))
+	if nonces == 0 {
+		PrintErrorMsg("Missing %s argument.", utils.PlotNoncesFlag.Name)
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	threads := ctx.Int(utils.GetFlagName(utils.PlotThreadsFlag))
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	generator := &miner.PlotGenerator{
+		Dir:         ctx.String(utils.GetFlagName(utils.PlotFileDirFlag)),
+		AccountId:   uint64(utils.WalletAddressToId([]byte(addr.ToBase58()))),
+		StartNonce:  ctx.Uint64(utils.GetFlagName(utils.PlotStartNonceFlag)),
+		Nonces:      nonces,
+		Threads:     threads,
+		BatchNonces: ctx.Uint64(utils.GetFlagName(utils.PlotBatchNoncesFlag)),
+	}
+	path := generator.Path()
+	resumed := generator.Progress()
+	if resumed == nonces {
+		PrintInfoMsg("Plot file %s already exists.", path)
+		return nil
+	}
+	PrintInfoMsg("Generate plot file:%s", path)
+	PrintInfoMsg("  Address:%s", addr.ToBase58())
+	PrintInfoMsg("  NumericID:%d", generator.AccountId)
+	PrintInfoMsg("  StartNonce:%d", generator.StartNonce)
+	PrintInfoMsg("  Nonces:%d", nonces)
+	PrintInfoMsg("  Size:%s", formatFsSize(nonces*types.PLOT_SIZE/1024))
+	PrintInfoMsg("  Threads:%d", threads)
+	if resumed > 0 {
+		PrintInfoMsg("  Resume from:%d", resumed)
+	}
+
+	//stop generation after the current batch when interrupted
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	defer close(finished)
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sc)
+	go func() {
+		select {
+		case <-sc:
+			close(stop)
+		case <-finished:
+		}
+	}()
+
+	start := time.Now()
+	err = generator.Generate(func(done uint64) {
+		speed := float64(done-resumed) / time.Since(start).Minutes()
+		fmt.Printf("\rGenerated %d/%d nonces, %.0f nonces/min", done, nonces, speed)
+	}, stop)
+	fmt.Println()
+	if err == miner.ErrPlotInterrupted {
+		PrintWarnMsg("Plot generation interrupted at %d/%d nonces. Run the same command to resume.", generator.Progress(), nonces)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("generate plot file error:%s", err)
+	}
+	PrintInfoMsg("Plot file generated in %s.", time.Since(start).Round(time.Second))
+	return nil
+}
+
+func plotVerify(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		PrintErrorMsg("Missing file argument.")
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	samples := ctx.Uint64(utils.GetFlagName(utils.PlotVerifySamplesFlag))
+	failed := 0
+	for _, path := range ctx.Args() {
+		plot, err := miner.NewPlotFile(path)
+		if err != nil {
+			PrintErrorMsg("Plot file %s:%s", path, err)
+			failed++
+			continue
+		}
+		checked, err := miner.VerifyPlotFile(plot, samples)
+		if err != nil {
+			PrintErrorMsg("Plot file %s:%s", path, err)
+			failed++
+			continue
+		}
+		PrintInfoMsg("Plot file %s: %d of %d nonces verified.", path, checked, plot.Nonces)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d plot files failed to verify", failed, ctx.NArg())
+	}
+	return nil
+}
@@ -18,8 +18,10 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/hex"
 	"fmt"
+	"os"
 	"strings"
 
 	cmdcom "github.com/saveio/themis/cmd/common"
@@ -63,12 +65,14 @@ var SigTxCommand = cli.Command{
 	Name:        "sigtx",
 	Usage:       "Sign to transaction",
 	ArgsUsage:   "<rawtx>",
-	Description: "Sign to transaction.",
+	Description: "Sign to transaction. With --envelope, the intent of the transaction envelope built by buildtx is displayed for approval before signing, and the signature is written back to the envelope. Signatures of multi-signature address are collected in the envelope by each signer in turn.",
 	Action:      sigToTx,
 	Flags: []cli.Flag{
 		utils.RPCPortFlag,
 		utils.WalletFileFlag,
 		utils.AccountAddressFlag,
+		utils.TxEnvelopeFlag,
+		utils.ForceSignTxFlag,
 		utils.SendTxFlag,
 		utils.PrepareExecTransactionFlag,
 	},
@@ -126,40 +130,16 @@ func genMultiSigAddress(ctx *cli.Context) error {
 
 func multiSigToTx(ctx *cli.Context) error {
 	SetRpcPort(ctx)
-	pkstr := strings.TrimSpace(strings.Trim(ctx.String(utils.GetFlagName(utils.AccountMultiPubKeyFlag)), ","))
-	m := ctx.Uint(utils.GetFlagName(utils.AccountMultiMFlag))
-	if pkstr == "" || m == 0 {
+	if !ctx.IsSet(utils.GetFlagName(utils.AccountMultiPubKeyFlag)) || ctx.Uint(utils.GetFlagName(utils.AccountMultiMFlag)) == 0 {
 		PrintErrorMsg("Missing argument. %s or %s expected.",
 			utils.GetFlagName(utils.AccountMultiMFlag),
 			utils.GetFlagName(utils.AccountMultiPubKeyFlag))
 		cli.ShowSubcommandHelp(ctx)
 		return nil
 	}
-
-	pks := strings.Split(pkstr, ",")
-	pubKeys := make([]keypair.PublicKey, 0, len(pks))
-	for _, pk := range pks {
-		pk := strings.TrimSpace(pk)
-		if pk == "" {
-			continue
-		}
-		data, err := hex.DecodeString(pk)
-		if err != nil {
-			return err
-		}
-		pubKey, err := keypair.DeserializePublicKey(data)
-		if err != nil {
-			return fmt.Errorf("invalid pub key:%s", pk)
-		}
-		pubKeys = append(pubKeys, pubKey)
-	}
-	pkSize := len(pubKeys)
-	if !(1 <= m && int(m) <= pkSize && pkSize > 1 && pkSize <= constants.MULTI_SIG_MAX_PUBKEY_SIZE) {
-		PrintErrorMsg("Invalid argument. %s must > 1 and <= %d, and m must > 0 and < number of pub key.",
-			utils.GetFlagName(utils.AccountMultiPubKeyFlag),
-			constants.MULTI_SIG_MAX_PUBKEY_SIZE)
-		cli.ShowSubcommandHelp(ctx)
-		return nil
+	m, pubKeys, err := parseMultiSigPubKeys(ctx)
+	if err != nil {
+		return err
 	}
 
 	if ctx.NArg() < 1 {
@@ -186,7 +166,7 @@ func multiSigToTx(ctx *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("GetAccount error:%s", err)
 	}
-	err = utils.MultiSigTransaction(mutTx, uint16(m), pubKeys, acc)
+	err = utils.MultiSigTransaction(mutTx, m, pubKeys, acc)
 	if err != nil {
 		return fmt.Errorf("MultiSigTransaction error:%s", err)
 	}
@@ -203,35 +183,14 @@ func multiSigToTx(ctx *cli.Context) error {
 	PrintInfoMsg(rawTx)
 	PrintInfoMsg("")
 
-	if ctx.IsSet(utils.GetFlagName(utils.PrepareExecTransactionFlag)) {
-		preResult, err := utils.PrepareSendRawTransaction(rawTx)
-		if err != nil {
-			return err
-		}
-		if preResult.State == 0 {
-			return fmt.Errorf("prepare execute transaction failed. %v", preResult)
-		}
-		PrintInfoMsg("Prepare execute transaction success.")
-		PrintInfoMsg("Gas limit:%d", preResult.Gas)
-		PrintInfoMsg("Result:%v", preResult.Result)
-		return nil
-	}
-
-	if ctx.IsSet(utils.GetFlagName(utils.SendTxFlag)) {
-		txHash, err := utils.SendRawTransactionData(rawTx)
-		if err != nil {
-			return err
-		}
-		PrintInfoMsg("Send transaction success.")
-		PrintInfoMsg("  TxHash:%s", txHash)
-		PrintInfoMsg("\nTip:")
-		PrintInfoMsg("  Using './themis info status %s' to query transaction status.", txHash)
-	}
-	return nil
+	return prepareOrSendRawTx(ctx, rawTx)
 }
 
 func sigToTx(ctx *cli.Context) error {
 	SetRpcPort(ctx)
+	if ctx.IsSet(utils.GetFlagName(utils.TxEnvelopeFlag)) {
+		return sigToEnvelope(ctx)
+	}
 	if ctx.NArg() < 1 {
 		PrintErrorMsg("Missing <rawtx> argument.")
 		cli.ShowSubcommandHelp(ctx)
@@ -274,29 +233,178 @@ func sigToTx(ctx *cli.Context) error {
 	PrintInfoMsg(rawTx)
 	PrintInfoMsg("")
 
-	if ctx.IsSet(utils.GetFlagName(utils.PrepareExecTransactionFlag)) {
-		preResult, err := utils.PrepareSendRawTransaction(rawTx)
+	return prepareOrSendRawTx(ctx, rawTx)
+}
+
+func sigToEnvelope(ctx *cli.Context) error {
+	file := ctx.String(utils.GetFlagName(utils.TxEnvelopeFlag))
+	envelope, err := utils.ReadTxEnvelope(file)
+	if err != nil {
+		return err
+	}
+	checked, err := envelope.Verify()
+	if err != nil {
+		return fmt.Errorf("envelope verify failed:%s", err)
+	}
+	printTxEnvelope(envelope, checked)
+	if !checked && !ctx.Bool(utils.GetFlagName(utils.ForceSignTxFlag)) {
+		return fmt.Errorf("params of action %s cannot be checked against the raw transaction, using %s flag to sign it anyway",
+			envelope.Intent.Action, utils.GetFlagName(utils.ForceSignTxFlag))
+	}
+
+	acc, err := cmdcom.GetAccount(ctx)
+	if err != nil {
+		return fmt.Errorf("GetAccount error:%s", err)
+	}
+	PrintInfoMsg("\nSigner:%s", acc.Address.ToBase58())
+	fmt.Print("Approve and sign the transaction? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		PrintWarnMsg("Transaction is not approved.")
+		return nil
+	}
+
+	mutTx, err := envelope.Transaction()
+	if err != nil {
+		return err
+	}
+	if envelope.MultiSig != nil {
+		m, pubKeys, err := envelope.MultiSigPubKeys()
 		if err != nil {
 			return err
 		}
-		if preResult.State == 0 {
-			return fmt.Errorf("prepare execute transaction failed. %v", preResult)
+		err = utils.MultiSigTransaction(mutTx, m, pubKeys, acc)
+		if err != nil {
+			return fmt.Errorf("MultiSigTransaction error:%s", err)
+		}
+	} else {
+		err = utils.SignTransaction(acc, mutTx)
+		if err != nil {
+			return fmt.Errorf("SignTransaction error:%s", err)
 		}
-		PrintInfoMsg("Prepare execute transaction success.")
-		PrintInfoMsg("Gas limit:%d", preResult.Gas)
-		PrintInfoMsg("Result:%v", preResult.Result)
-		return nil
 	}
+	err = envelope.SetTransaction(mutTx)
+	if err != nil {
+		return err
+	}
+	err = utils.WriteTxEnvelope(file, envelope)
+	if err != nil {
+		return fmt.Errorf("write envelope error:%s", err)
+	}
+	PrintInfoMsg("Envelope signed and written to %s", file)
 
-	if ctx.IsSet(utils.GetFlagName(utils.SendTxFlag)) {
-		txHash, err := utils.SendRawTransactionData(rawTx)
+	if envelope.MultiSig != nil {
+		collected, required, err := envelope.SignatureStatus()
 		if err != nil {
 			return err
 		}
-		PrintInfoMsg("Send transaction success.")
-		PrintInfoMsg("  TxHash:%s", txHash)
-		PrintInfoMsg("\nTip:")
-		PrintInfoMsg("  Using './themis info status %s' to query transaction status.", txHash)
+		PrintInfoMsg("Multi signatures collected:%d/%d", collected, required)
+		if collected < required {
+			PrintInfoMsg("\nTip:")
+			PrintInfoMsg("  Pass envelope %s to the other signers to collect signatures.", file)
+			return nil
+		}
+	}
+	PrintInfoMsg("RawTx after signed:")
+	PrintInfoMsg(envelope.RawTx)
+	PrintInfoMsg("")
+
+	return prepareOrSendRawTx(ctx, envelope.RawTx)
+}
+
+func printTxEnvelope(envelope *utils.TxEnvelope, checked bool) {
+	intent := envelope.Intent
+	PrintInfoMsg("Transaction envelope:")
+	PrintInfoMsg("  Action:%s", intent.Action)
+	PrintInfoMsg("  Contract:%s", intent.Contract)
+	PrintInfoMsg("  Method:%s", intent.Method)
+	PrintInfoMsg("  Params:")
+	for _, param := range intent.Params {
+		PrintInfoMsg("    %s:%s", param.Name, param.Value)
+	}
+	PrintInfoMsg("  Payer:%s", intent.Payer)
+	PrintInfoMsg("  GasPrice:%d", intent.GasPrice)
+	PrintInfoMsg("  GasLimit:%d", intent.GasLimit)
+	PrintInfoMsg("  MaxFee:%s", utils.FormatUsdt(intent.GasPrice*intent.GasLimit))
+	if envelope.MultiSig != nil {
+		addr, _ := envelope.MultiSigAddress()
+		PrintInfoMsg("  MultiSigAddress:%s", addr.ToBase58())
+		PrintInfoMsg("  MultiSigM:%d", envelope.MultiSig.M)
+		for i, pk := range envelope.MultiSig.PubKeys {
+			PrintInfoMsg("  PubKey %d:%s", i+1, pk)
+		}
+		collected, required, err := envelope.SignatureStatus()
+		if err == nil {
+			PrintInfoMsg("  Signatures:%d/%d", collected, required)
+		}
+	}
+	if !checked {
+		PrintWarnMsg("Params of action %s cannot be checked against the raw transaction, review them carefully.", intent.Action)
+	}
+}
+
+//parseMultiSigPubKeys return m and pub keys of multi signature address from flags
+func parseMultiSigPubKeys(ctx *cli.Context) (uint16, []keypair.PublicKey, error) {
+	pkstr := strings.TrimSpace(strings.Trim(ctx.String(utils.GetFlagName(utils.AccountMultiPubKeyFlag)), ","))
+	m := ctx.Uint(utils.GetFlagName(utils.AccountMultiMFlag))
+	pubKeys := make([]keypair.PublicKey, 0)
+	for _, pk := range strings.Split(pkstr, ",") {
+		pk := strings.TrimSpace(pk)
+		if pk == "" {
+			continue
+		}
+		data, err := hex.DecodeString(pk)
+		if err != nil {
+			return 0, nil, err
+		}
+		pubKey, err := keypair.DeserializePublicKey(data)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid pub key:%s", pk)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	pkSize := len(pubKeys)
+	if !(1 <= m && int(m) <= pkSize && pkSize > 1 && pkSize <= constants.MULTI_SIG_MAX_PUBKEY_SIZE) {
+		return 0, nil, fmt.Errorf("invalid argument. %s must > 1 and <= %d, and m must > 0 and < number of pub key",
+			utils.GetFlagName(utils.AccountMultiPubKeyFlag), constants.MULTI_SIG_MAX_PUBKEY_SIZE)
+	}
+	return uint16(m), pubKeys, nil
+}
+
+//prepareOrSendRawTx prepare execute the signed raw tx, or send it to ledger if required
+func prepareOrSendRawTx(ctx *cli.Context, rawTx string) error {
+	if ctx.IsSet(utils.GetFlagName(utils.PrepareExecTransactionFlag)) {
+		return prepareRawTx(rawTx)
+	}
+	if ctx.IsSet(utils.GetFlagName(utils.SendTxFlag)) {
+		return sendRawTx(rawTx)
+	}
+	return nil
+}
+
+func prepareRawTx(rawTx string) error {
+	preResult, err := utils.PrepareSendRawTransaction(rawTx)
+	if err != nil {
+		return err
+	}
+	if preResult.State == 0 {
+		return fmt.Errorf("prepare execute transaction failed. %v", preResult)
+	}
+	PrintInfoMsg("Prepare execute transaction success.")
+	PrintInfoMsg("Gas limit:%d", preResult.Gas)
+	PrintInfoMsg("Result:%v", preResult.Result)
+	return nil
+}
+
+func sendRawTx(rawTx string) error {
+	txHash, err := utils.SendRawTransactionData(rawTx)
+	if err != nil {
+		return err
 	}
+	PrintInfoMsg("Send transaction success.")
+	PrintInfoMsg("  TxHash:%s", txHash)
+	PrintInfoMsg("\nTip:")
+	PrintInfoMsg("  Using './themis info status %s' to query transaction status.", txHash)
 	return nil
 }
@@ -25,9 +25,8 @@ import (
 	cmdcom "github.com/saveio/themis/cmd/common"
 	"github.com/saveio/themis/cmd/utils"
 	"github.com/saveio/themis/common"
-	cutils "github.com/saveio/themis/core/utils"
+	"github.com/saveio/themis/core/types"
 	gov "github.com/saveio/themis/smartcontract/service/native/governance"
-	nutils "github.com/saveio/themis/smartcontract/service/native/utils"
 	"github.com/urfave/cli"
 )
 
@@ -39,42 +38,42 @@ var SendTxCommand = cli.Command{
 	Action:      sendTx,
 	Flags: []cli.Flag{
 		utils.RPCPortFlag,
+		utils.TxEnvelopeFlag,
 		utils.PrepareExecTransactionFlag,
 	},
 }
 
 func sendTx(ctx *cli.Context) error {
 	SetRpcPort(ctx)
-	if ctx.NArg() < 1 {
-		PrintErrorMsg("Missing raw tx argument.")
-		cli.ShowSubcommandHelp(ctx)
-		return nil
-	}
-	rawTx := ctx.Args().First()
-
-	isPre := ctx.IsSet(utils.GetFlagName(utils.PrepareExecTransactionFlag))
-	if isPre {
-		preResult, err := utils.PrepareSendRawTransaction(rawTx)
+	var rawTx string
+	if ctx.IsSet(utils.GetFlagName(utils.TxEnvelopeFlag)) {
+		envelope, err := utils.ReadTxEnvelope(ctx.String(utils.GetFlagName(utils.TxEnvelopeFlag)))
 		if err != nil {
 			return err
 		}
-		if preResult.State == 0 {
-			return fmt.Errorf("prepare execute transaction failed. %v", preResult)
+		if envelope.MultiSig != nil {
+			collected, required, err := envelope.SignatureStatus()
+			if err != nil {
+				return err
+			}
+			if collected < required {
+				return fmt.Errorf("multi signatures not enough, collected:%d required:%d", collected, required)
+			}
 		}
-		PrintInfoMsg("Prepare execute transaction success.")
-		PrintInfoMsg("Gas limit:%d", preResult.Gas)
-		PrintInfoMsg("Result:%v", preResult.Result)
-		return nil
+		rawTx = envelope.RawTx
+	} else {
+		if ctx.NArg() < 1 {
+			PrintErrorMsg("Missing raw tx argument.")
+			cli.ShowSubcommandHelp(ctx)
+			return nil
+		}
+		rawTx = ctx.Args().First()
 	}
-	txHash, err := utils.SendRawTransactionData(rawTx)
-	if err != nil {
-		return err
+
+	if ctx.IsSet(utils.GetFlagName(utils.PrepareExecTransactionFlag)) {
+		return prepareRawTx(rawTx)
 	}
-	PrintInfoMsg("Send transaction success.")
-	PrintInfoMsg("  TxHash:%s", txHash)
-	PrintInfoMsg("\nTip:")
-	PrintInfoMsg("  Using './themis info status %s' to query transaction status.", txHash)
-	return nil
+	return sendRawTx(rawTx)
 }
 
 var TxCommond = cli.Command{
@@ -100,6 +99,9 @@ var TransferTxCommond = cli.Command{
 		utils.WalletFileFlag,
 		utils.TransactionGasPriceFlag,
 		utils.TransactionGasLimitFlag,
+		utils.TxEnvelopeFlag,
+		utils.AccountMultiMFlag,
+		utils.AccountMultiPubKeyFlag,
 		utils.TransactionPayerFlag,
 		utils.TransactionAssetFlag,
 		utils.TransactionFromFlag,
@@ -117,6 +119,9 @@ var ApproveTxCommond = cli.Command{
 		utils.WalletFileFlag,
 		utils.TransactionGasPriceFlag,
 		utils.TransactionGasLimitFlag,
+		utils.TxEnvelopeFlag,
+		utils.AccountMultiMFlag,
+		utils.AccountMultiPubKeyFlag,
 		utils.TransactionPayerFlag,
 		utils.ApproveAssetFlag,
 		utils.ApproveAssetFromFlag,
@@ -134,6 +139,9 @@ var TransferFromTxCommond = cli.Command{
 		utils.WalletFileFlag,
 		utils.TransactionGasPriceFlag,
 		utils.TransactionGasLimitFlag,
+		utils.TxEnvelopeFlag,
+		utils.AccountMultiMFlag,
+		utils.AccountMultiPubKeyFlag,
 		utils.ApproveAssetFlag,
 		utils.TransactionPayerFlag,
 		utils.TransferFromSenderFlag,
@@ -152,6 +160,9 @@ var ApproveCandidateTxCommond = cli.Command{
 		utils.WalletFileFlag,
 		utils.TransactionGasPriceFlag,
 		utils.TransactionGasLimitFlag,
+		utils.TxEnvelopeFlag,
+		utils.AccountMultiMFlag,
+		utils.AccountMultiPubKeyFlag,
 		utils.TransactionPayerFlag,
 		utils.RejectCandidateFlag,
 		utils.ApproveCandidatePubkeyFlag,
@@ -168,6 +179,9 @@ var UpdateConfigTxCommond = cli.Command{
 		utils.WalletFileFlag,
 		utils.TransactionGasPriceFlag,
 		utils.TransactionGasLimitFlag,
+		utils.TxEnvelopeFlag,
+		utils.AccountMultiMFlag,
+		utils.AccountMultiPubKeyFlag,
 		utils.TransactionPayerFlag,
 		utils.ConfigNFlag,
 		utils.ConfigCFlag,
@@ -189,6 +203,9 @@ var RegisterSipTxCommond = cli.Command{
 		utils.WalletFileFlag,
 		utils.TransactionGasPriceFlag,
 		utils.TransactionGasLimitFlag,
+		utils.TxEnvelopeFlag,
+		utils.AccountMultiMFlag,
+		utils.AccountMultiPubKeyFlag,
 		utils.TransactionPayerFlag,
 
 		utils.SipHeightFlag,
@@ -261,16 +278,13 @@ func transferTx(ctx *cli.Context) error {
 		return err
 	}
 	mutTx.Payer = payer
-
-	tx, err := mutTx.IntoImmutable()
-	if err != nil {
-		return fmt.Errorf("IntoImmutable error:%s", err)
+	params := []*utils.TxParam{
+		{Name: utils.ENVELOPE_PARAM_ASSET, Value: asset},
+		{Name: utils.ENVELOPE_PARAM_FROM, Value: fromAddr},
+		{Name: utils.ENVELOPE_PARAM_TO, Value: toAddr},
+		{Name: utils.ENVELOPE_PARAM_AMOUNT, Value: amountStr},
 	}
-	sink := common.ZeroCopySink{}
-	tx.Serialization(&sink)
-	PrintInfoMsg("Transfer raw tx:")
-	PrintInfoMsg(hex.EncodeToString(sink.Bytes()))
-	return nil
+	return outputBuiltTx(ctx, "Transfer", utils.ENVELOPE_ACTION_TRANSFER, params, mutTx)
 }
 
 func approveTx(ctx *cli.Context) error {
@@ -333,16 +347,13 @@ func approveTx(ctx *cli.Context) error {
 		return err
 	}
 	mutTx.Payer = payer
-
-	tx, err := mutTx.IntoImmutable()
-	if err != nil {
-		return fmt.Errorf("IntoImmutable error:%s", err)
+	params := []*utils.TxParam{
+		{Name: utils.ENVELOPE_PARAM_ASSET, Value: asset},
+		{Name: utils.ENVELOPE_PARAM_FROM, Value: fromAddr},
+		{Name: utils.ENVELOPE_PARAM_TO, Value: toAddr},
+		{Name: utils.ENVELOPE_PARAM_AMOUNT, Value: amountStr},
 	}
-	sink := common.ZeroCopySink{}
-	tx.Serialization(&sink)
-	PrintInfoMsg("Approve raw tx:")
-	PrintInfoMsg(hex.EncodeToString(sink.Bytes()))
-	return nil
+	return outputBuiltTx(ctx, "Approve", utils.ENVELOPE_ACTION_APPROVE, params, mutTx)
 }
 
 func transferFromTx(ctx *cli.Context) error {
@@ -416,16 +427,14 @@ func transferFromTx(ctx *cli.Context) error {
 		return err
 	}
 	mutTx.Payer = payer
-
-	tx, err := mutTx.IntoImmutable()
-	if err != nil {
-		return fmt.Errorf("IntoImmutable error:%s", err)
-	}
-	sink := common.ZeroCopySink{}
-	tx.Serialization(&sink)
-	PrintInfoMsg("TransferFrom raw tx:")
-	PrintInfoMsg(hex.EncodeToString(sink.Bytes()))
-	return nil
+	params := []*utils.TxParam{
+		{Name: utils.ENVELOPE_PARAM_ASSET, Value: asset},
+		{Name: utils.ENVELOPE_PARAM_SENDER, Value: sendAddr},
+		{Name: utils.ENVELOPE_PARAM_FROM, Value: fromAddr},
+		{Name: utils.ENVELOPE_PARAM_TO, Value: toAddr},
+		{Name: utils.ENVELOPE_PARAM_AMOUNT, Value: amountStr},
+	}
+	return outputBuiltTx(ctx, "TransferFrom", utils.ENVELOPE_ACTION_TRANSFER_FROM, params, mutTx)
 }
 
 func approveCandidateTx(ctx *cli.Context) error {
@@ -464,20 +473,16 @@ func approveCandidateTx(ctx *cli.Context) error {
 	}
 
 	mutTx.Payer = payer
-
-	tx, err := mutTx.IntoImmutable()
-	if err != nil {
-		return fmt.Errorf("IntoImmutable error:%s", err)
+	params := []*utils.TxParam{
+		{Name: utils.ENVELOPE_PARAM_ROLE, Value: role},
+		{Name: utils.ENVELOPE_PARAM_PEER_PUBKEY, Value: peerPubkey},
+		{Name: utils.ENVELOPE_PARAM_REJECT, Value: fmt.Sprintf("%v", reject)},
 	}
-	sink := common.ZeroCopySink{}
-	tx.Serialization(&sink)
+	title := fmt.Sprintf("Approve %s candidate", role)
 	if reject {
-		PrintInfoMsg("Reject %s candidate raw tx:", role)
-	} else {
-		PrintInfoMsg("Approve %s candidate raw tx:", role)
+		title = fmt.Sprintf("Reject %s candidate", role)
 	}
-	PrintInfoMsg(hex.EncodeToString(sink.Bytes()))
-	return nil
+	return outputBuiltTx(ctx, title, utils.ENVELOPE_ACTION_APPROVE_CANDIDATE, params, mutTx)
 }
 
 func updateConfigTx(ctx *cli.Context) error {
@@ -515,25 +520,23 @@ func updateConfigTx(ctx *cli.Context) error {
 		MaxBlockChangeView:   uint32(ctx.Uint64(utils.ConfigMaxBlockChangeViewFlag.Name)),
 	}
 
-	invokeCode, err := cutils.BuildNativeInvokeCode(nutils.GovernanceContractAddress,
-		utils.VERSION_TRANSACTION, gov.UPDATE_CONFIG, []interface{}{configure})
-
+	mutTx, err := utils.UpdateConfigTx(gasPrice, gasLimit, configure)
 	if err != nil {
-		return fmt.Errorf("build invoke code error:%s", err)
+		return err
 	}
-	mutTx := utils.NewInvokeTransaction(gasPrice, gasLimit, invokeCode)
 
 	mutTx.Payer = payer
-	tx, err := mutTx.IntoImmutable()
-	if err != nil {
-		return fmt.Errorf("IntoImmutable error:%s", err)
-	}
-	sink := common.ZeroCopySink{}
-	tx.Serialization(&sink)
-
-	PrintInfoMsg("Update config raw tx:")
-	PrintInfoMsg(hex.EncodeToString(sink.Bytes()))
-	return nil
+	params := []*utils.TxParam{
+		{Name: utils.ENVELOPE_PARAM_N, Value: fmt.Sprintf("%d", configure.N)},
+		{Name: utils.ENVELOPE_PARAM_C, Value: fmt.Sprintf("%d", configure.C)},
+		{Name: utils.ENVELOPE_PARAM_K, Value: fmt.Sprintf("%d", configure.K)},
+		{Name: utils.ENVELOPE_PARAM_L, Value: fmt.Sprintf("%d", configure.L)},
+		{Name: utils.ENVELOPE_PARAM_BLOCK_MSG_DELAY, Value: fmt.Sprintf("%d", configure.BlockMsgDelay)},
+		{Name: utils.ENVELOPE_PARAM_HASH_MSG_DELAY, Value: fmt.Sprintf("%d", configure.HashMsgDelay)},
+		{Name: utils.ENVELOPE_PARAM_PEER_HANDSHAKE_TIMEOUT, Value: fmt.Sprintf("%d", configure.PeerHandshakeTimeout)},
+		{Name: utils.ENVELOPE_PARAM_MAX_BLOCK_CHANGE_VIEW, Value: fmt.Sprintf("%d", configure.MaxBlockChangeView)},
+	}
+	return outputBuiltTx(ctx, "Update config", utils.ENVELOPE_ACTION_UPDATE_CONFIG, params, mutTx)
 }
 
 //sip cmd
@@ -579,15 +582,58 @@ func registerSipTx(ctx *cli.Context) error {
 	}
 
 	mutTx.Payer = payer
+	params := []*utils.TxParam{
+		{Name: utils.ENVELOPE_PARAM_HEIGHT, Value: fmt.Sprintf("%d", height)},
+		{Name: utils.ENVELOPE_PARAM_DETAIL, Value: detail},
+		{Name: utils.ENVELOPE_PARAM_MIN_VOTES, Value: fmt.Sprintf("%d", minVotes)},
+		{Name: utils.ENVELOPE_PARAM_BONUS, Value: utils.FormatUsdt(bonus)},
+	}
+	return outputBuiltTx(ctx, "Register Sip", utils.ENVELOPE_ACTION_REGISTER_SIP, params, mutTx)
+}
 
-	tx, err := mutTx.IntoImmutable()
+//outputBuiltTx print raw tx of built transaction, and write envelope for offline signing if required
+func outputBuiltTx(ctx *cli.Context, title, action string, params []*utils.TxParam, mutTx *types.MutableTransaction) error {
+	file := ctx.String(utils.GetFlagName(utils.TxEnvelopeFlag))
+	if file == "" {
+		tx, err := mutTx.IntoImmutable()
+		if err != nil {
+			return fmt.Errorf("IntoImmutable error:%s", err)
+		}
+		sink := common.ZeroCopySink{}
+		tx.Serialization(&sink)
+		PrintInfoMsg("%s raw tx:", title)
+		PrintInfoMsg(hex.EncodeToString(sink.Bytes()))
+		return nil
+	}
+	envelope, err := utils.NewTxEnvelope(action, params, mutTx)
 	if err != nil {
-		return fmt.Errorf("IntoImmutable error:%s", err)
+		return err
 	}
-	sink := common.ZeroCopySink{}
-	tx.Serialization(&sink)
+	PrintInfoMsg("%s raw tx:", title)
+	PrintInfoMsg(envelope.RawTx)
 
-	PrintInfoMsg("Register Sip raw tx:")
-	PrintInfoMsg(hex.EncodeToString(sink.Bytes()))
+	if ctx.IsSet(utils.GetFlagName(utils.AccountMultiPubKeyFlag)) {
+		m, pubKeys, err := parseMultiSigPubKeys(ctx)
+		if err != nil {
+			return err
+		}
+		err = envelope.SetMultiSig(m, pubKeys)
+		if err != nil {
+			return err
+		}
+	}
+	err = utils.WriteTxEnvelope(file, envelope)
+	if err != nil {
+		return fmt.Errorf("write envelope error:%s", err)
+	}
+	compact, err := envelope.Compact()
+	if err != nil {
+		return err
+	}
+	PrintInfoMsg("\nEnvelope written to %s", file)
+	PrintInfoMsg("Compact envelope for QR code:")
+	PrintInfoMsg(compact)
+	PrintInfoMsg("\nTip:")
+	PrintInfoMsg("  Using './themis sigtx --envelope %s' to review and sign on the offline signer.", file)
 	return nil
 }
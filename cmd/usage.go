@@ -99,6 +99,11 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.DisableLogFileFlag,
 			utils.DisableEventLogFlag,
 			utils.DataDirFlag,
+			utils.StateSnapshotIntervalFlag,
+			utils.LightModeFlag,
+			utils.ArchiveModeFlag,
+			utils.StateRetentionFlag,
+			utils.StoreBackendFlag,
 			utils.WasmVerifyMethodFlag,
 		},
 	},
@@ -136,6 +141,10 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "POC",
 		Flags: []cli.Flag{
 			utils.PocBlockPerViewFlag,
+			utils.PlotDirFlag,
+			utils.EnableMiningFlag,
+			utils.MiningThreadsFlag,
+			utils.MiningTargetDeadlineFlag,
 		},
 	},
 	{
@@ -146,6 +155,11 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TxpoolPreExecDisableFlag,
 			utils.DisableSyncVerifyTxFlag,
 			utils.DisableBroadcastNetTxFlag,
+			utils.DisableTxPoolJournalFlag,
+			utils.TxPoolMaxSizeFlag,
+			utils.TxPoolMaxPayerPendingFlag,
+			utils.TxPoolContractQuotaFlag,
+			utils.TxPoolContractQuotasFlag,
 		},
 	},
 	{
@@ -162,6 +176,11 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.EnableProxyFlag,
 			utils.ProxyServerListFlag,
 			utils.ProxyServerIdListFlag,
+			utils.EnableStateSyncFlag,
+			utils.PeerBanThresholdFlag,
+			utils.PeerBanTimeFlag,
+			utils.TxGossipFanoutFlag,
+			utils.NATFlag,
 		},
 	},
 	{
@@ -201,6 +220,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.EnableTestModeFlag,
 			utils.TestModeGenBlockTimeFlag,
+			utils.TestModeGenBlockModeFlag,
 		},
 	},
 	{
@@ -239,6 +259,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.ForceSendTxFlag,
 			utils.TransactionPayerFlag,
 			utils.PrepareExecTransactionFlag,
+			utils.TxEnvelopeFlag,
+			utils.ForceSignTxFlag,
 			utils.TransferFromAmountFlag,
 		},
 	},
@@ -265,6 +287,68 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.ImportEndHeightFlag,
 		},
 	},
+	{
+		Name: "DATABASE",
+		Flags: []cli.Flag{
+			utils.DbCompactFlag,
+			utils.DbTargetFlag,
+		},
+	},
+	{
+		Name: "SAVEFS",
+		Flags: []cli.Flag{
+			utils.FsNodeVolumeFlag,
+			utils.FsNodeServiceTimeFlag,
+			utils.FsNodeAddrFlag,
+			utils.FsFileHashFlag,
+			utils.FsRenewTimesFlag,
+			utils.FsFileSizeFlag,
+			utils.FsCopyNumFlag,
+			utils.FsProveIntervalFlag,
+			utils.FsExpiredHeightFlag,
+			utils.FsProfessionalFlag,
+			utils.FsSpaceOwnerFlag,
+			utils.FsSpaceSizeFlag,
+			utils.FsSpaceBlocksFlag,
+			utils.FsSpaceRevokeFlag,
+		},
+	},
+	{
+		Name: "DNS",
+		Flags: []cli.Flag{
+			utils.DnsHeaderFlag,
+			utils.DnsUrlFlag,
+			utils.DnsNameFlag,
+			utils.DnsDescFlag,
+			utils.DnsTTLFlag,
+			utils.DnsNodeIPFlag,
+			utils.DnsNodePortFlag,
+			utils.DnsNodeDepositFlag,
+			utils.DnsNodePubkeyFlag,
+		},
+	},
+	{
+		Name: "CHANNEL",
+		Flags: []cli.Flag{
+			utils.ChannelIdFlag,
+			utils.ChannelPartnerFlag,
+			utils.ChannelSettleTimeoutFlag,
+			utils.ChannelTotalDepositFlag,
+			utils.ChannelTransferredFlag,
+			utils.ChannelPartnerTransferredFlag,
+		},
+	},
+	{
+		Name: "PLOT",
+		Flags: []cli.Flag{
+			utils.PlotFileDirFlag,
+			utils.PlotStartNonceFlag,
+			utils.PlotNoncesFlag,
+			utils.PlotThreadsFlag,
+			utils.PlotBatchNoncesFlag,
+			utils.PlotVerifySamplesFlag,
+		},
+	},
 	{
 		Name: "MISC",
 	},
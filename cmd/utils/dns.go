@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/smartcontract/service/native/dns"
+	"github.com/saveio/themis/smartcontract/service/native/utils"
+)
+
+//NewDnsRequestName return request of registering name. The request type depends on whether header and url are specified
+func NewDnsRequestName(owner common.Address, header, url, name, desc string, ttl uint64) *dns.RequestName {
+	req := &dns.RequestName{
+		Type:      dns.SYSTEM,
+		Header:    []byte(header),
+		URL:       []byte(url),
+		Name:      []byte(name),
+		NameOwner: owner,
+		Desc:      []byte(desc),
+		DesireTTL: ttl,
+	}
+	switch {
+	case header != "" && url != "":
+		req.Type = dns.CUSTOM_HEADER_URL
+	case header != "":
+		req.Type = dns.CUSTOM_HEADER
+	case url != "":
+		req.Type = dns.CUSTOM_URL
+		req.Header = dns.DSP_HEADER
+	default:
+		req.Header = dns.DSP_HEADER
+	}
+	return req
+}
+
+//DnsRegisterName register a name owned by signer
+func DnsRegisterName(gasPrice, gasLimit uint64, signer *account.Account, req *dns.RequestName) (string, error) {
+	return invokeDnsContract(gasPrice, gasLimit, signer, dns.REGISTER_NAME, []interface{}{req})
+}
+
+//DnsTransferName transfer a name owned by signer to another account
+func DnsTransferName(gasPrice, gasLimit uint64, signer *account.Account, header, url string, to common.Address) (string, error) {
+	transferInfo := &dns.TranferInfo{
+		Header: []byte(header),
+		URL:    []byte(url),
+		From:   signer.Address,
+		To:     to,
+	}
+	return invokeDnsContract(gasPrice, gasLimit, signer, dns.TRANSFER_NAME, []interface{}{transferInfo})
+}
+
+//DnsNodeRegister register signer as a dns node candidate with init deposit
+func DnsNodeRegister(gasPrice, gasLimit uint64, signer *account.Account, ip, port string, initDeposit uint64, peerPubkey string) (string, error) {
+	nodeInfo := &dns.DNSNodeInfo{
+		WalletAddr:  signer.Address,
+		IP:          []byte(ip),
+		Port:        []byte(port),
+		InitDeposit: initDeposit,
+		PeerPubKey:  peerPubkey,
+	}
+	return invokeDnsContract(gasPrice, gasLimit, signer, dns.DNS_NODE_REG, []interface{}{nodeInfo})
+}
+
+//GetDnsName return name info of header and url
+func GetDnsName(header, url string) (*dns.NameInfo, error) {
+	req := &dns.ReqInfo{
+		Header: []byte(header),
+		URL:    []byte(url),
+	}
+	data, err := prepareInvokeDnsContract(dns.GET_DNS_NAME, []interface{}{req})
+	if err != nil {
+		return nil, err
+	}
+	nameInfo := &dns.NameInfo{}
+	if err = nameInfo.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("name info deserialize error:%s", err)
+	}
+	return nameInfo, nil
+}
+
+//GetAllDnsNodes return all registered dns nodes, keyed by hex wallet address
+func GetAllDnsNodes() (map[string]dns.DNSNodeInfo, error) {
+	data, err := prepareInvokeDnsContract(dns.GET_ALL_DNSNODES, []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	return ParseDnsNodes(data)
+}
+
+//ParseDnsNodes parse return value of GetAllDnsNodes
+func ParseDnsNodes(data []byte) (map[string]dns.DNSNodeInfo, error) {
+	nodes := make(map[string]dns.DNSNodeInfo)
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal dns nodes error:%s", err)
+	}
+	return nodes, nil
+}
+
+func invokeDnsContract(gasPrice, gasLimit uint64, signer *account.Account, method string, params []interface{}) (string, error) {
+	return InvokeNativeContract(gasPrice, gasLimit, signer, utils.OntDNSAddress, dns.VERSION_CONTRACT_DNS, method, params)
+}
+
+func prepareInvokeDnsContract(method string, params []interface{}) ([]byte, error) {
+	return prepareInvokeNative(utils.OntDNSAddress, dns.VERSION_CONTRACT_DNS, method, params)
+}
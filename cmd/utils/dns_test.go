@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/smartcontract/service/native/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDnsRequestName(t *testing.T) {
+	owner := common.Address{1}
+	req := NewDnsRequestName(owner, "", "", "name", "", 0)
+	assert.Equal(t, dns.SYSTEM, req.Type)
+	assert.Equal(t, dns.DSP_HEADER, req.Header)
+
+	req = NewDnsRequestName(owner, "", "save.io", "name", "", 0)
+	assert.Equal(t, dns.CUSTOM_URL, req.Type)
+	assert.Equal(t, dns.DSP_HEADER, req.Header)
+
+	req = NewDnsRequestName(owner, "http", "", "name", "", 0)
+	assert.Equal(t, dns.CUSTOM_HEADER, req.Type)
+
+	req = NewDnsRequestName(owner, "http", "save.io", "name", "desc", 10)
+	assert.Equal(t, dns.CUSTOM_HEADER_URL, req.Type)
+	assert.Equal(t, []byte("save.io"), req.URL)
+	assert.Equal(t, owner, req.NameOwner)
+}
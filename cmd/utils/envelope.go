@@ -0,0 +1,459 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/constants"
+	"github.com/saveio/themis/core/payload"
+	"github.com/saveio/themis/core/types"
+	cutils "github.com/saveio/themis/core/utils"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/smartcontract/service/native/governance"
+	vm "github.com/saveio/themis/vm/neovm"
+)
+
+const (
+	TX_ENVELOPE_VERSION = byte(1)
+	TX_ENVELOPE_PREFIX  = "themistx:" //prefix of compact envelope, suitable for QR code
+)
+
+//Envelope actions which params can be rebuilt and checked against the raw transaction
+const (
+	ENVELOPE_ACTION_TRANSFER          = "transfer"
+	ENVELOPE_ACTION_APPROVE           = "approve"
+	ENVELOPE_ACTION_TRANSFER_FROM     = "transferfrom"
+	ENVELOPE_ACTION_APPROVE_CANDIDATE = "approvecand"
+	ENVELOPE_ACTION_UPDATE_CONFIG     = "updateconfig"
+	ENVELOPE_ACTION_REGISTER_SIP      = "regsip"
+)
+
+//Envelope param names
+const (
+	ENVELOPE_PARAM_ASSET  = "asset"
+	ENVELOPE_PARAM_SENDER = "sender"
+	ENVELOPE_PARAM_FROM   = "from"
+	ENVELOPE_PARAM_TO     = "to"
+	ENVELOPE_PARAM_AMOUNT = "amount"
+
+	ENVELOPE_PARAM_ROLE        = "role"
+	ENVELOPE_PARAM_PEER_PUBKEY = "peerpubkey"
+	ENVELOPE_PARAM_REJECT      = "reject"
+
+	ENVELOPE_PARAM_N                      = "n"
+	ENVELOPE_PARAM_C                      = "c"
+	ENVELOPE_PARAM_K                      = "k"
+	ENVELOPE_PARAM_L                      = "l"
+	ENVELOPE_PARAM_BLOCK_MSG_DELAY        = "blockmsgdelay"
+	ENVELOPE_PARAM_HASH_MSG_DELAY         = "hashmsgdelay"
+	ENVELOPE_PARAM_PEER_HANDSHAKE_TIMEOUT = "peerhandshaketimeout"
+	ENVELOPE_PARAM_MAX_BLOCK_CHANGE_VIEW  = "maxblockchangeview"
+
+	ENVELOPE_PARAM_HEIGHT    = "height"
+	ENVELOPE_PARAM_DETAIL    = "detail"
+	ENVELOPE_PARAM_MIN_VOTES = "minvotes"
+	ENVELOPE_PARAM_BONUS     = "bonus"
+)
+
+type TxParam struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+//TxIntent is the human readable intent of an unsigned transaction
+type TxIntent struct {
+	Action   string     `json:"action"`
+	Contract string     `json:"contract"`
+	Method   string     `json:"method"`
+	Params   []*TxParam `json:"params"`
+	Payer    string     `json:"payer"`
+	GasPrice uint64     `json:"gasprice"`
+	GasLimit uint64     `json:"gaslimit"`
+}
+
+//TxMultiSig describe the multi signature address which collect signatures in envelope
+type TxMultiSig struct {
+	M       uint16   `json:"m"`
+	PubKeys []string `json:"pubkeys"`
+}
+
+//TxEnvelope is a portable transaction for offline signing
+type TxEnvelope struct {
+	Version  byte        `json:"version"`
+	Intent   *TxIntent   `json:"intent"`
+	MultiSig *TxMultiSig `json:"multisig,omitempty"`
+	RawTx    string      `json:"rawtx"`
+}
+
+type envelopeCodeBuilder func(params map[string]string) ([]byte, error)
+
+var envelopeCodeBuilders = map[string]envelopeCodeBuilder{
+	ENVELOPE_ACTION_TRANSFER: func(params map[string]string) ([]byte, error) {
+		mutTx, err := TransferTx(0, 0, params[ENVELOPE_PARAM_ASSET], params[ENVELOPE_PARAM_FROM],
+			params[ENVELOPE_PARAM_TO], ParseUsdt(params[ENVELOPE_PARAM_AMOUNT]))
+		if err != nil {
+			return nil, err
+		}
+		return mutTx.Payload.(*payload.InvokeCode).Code, nil
+	},
+	ENVELOPE_ACTION_APPROVE: func(params map[string]string) ([]byte, error) {
+		mutTx, err := ApproveTx(0, 0, params[ENVELOPE_PARAM_ASSET], params[ENVELOPE_PARAM_FROM],
+			params[ENVELOPE_PARAM_TO], ParseUsdt(params[ENVELOPE_PARAM_AMOUNT]))
+		if err != nil {
+			return nil, err
+		}
+		return mutTx.Payload.(*payload.InvokeCode).Code, nil
+	},
+	ENVELOPE_ACTION_TRANSFER_FROM: func(params map[string]string) ([]byte, error) {
+		mutTx, err := TransferFromTx(0, 0, params[ENVELOPE_PARAM_ASSET], params[ENVELOPE_PARAM_SENDER],
+			params[ENVELOPE_PARAM_FROM], params[ENVELOPE_PARAM_TO], ParseUsdt(params[ENVELOPE_PARAM_AMOUNT]))
+		if err != nil {
+			return nil, err
+		}
+		return mutTx.Payload.(*payload.InvokeCode).Code, nil
+	},
+	ENVELOPE_ACTION_APPROVE_CANDIDATE: func(params map[string]string) ([]byte, error) {
+		reject, err := strconv.ParseBool(params[ENVELOPE_PARAM_REJECT])
+		if err != nil {
+			return nil, fmt.Errorf("invalid param %s:%s", ENVELOPE_PARAM_REJECT, params[ENVELOPE_PARAM_REJECT])
+		}
+		mutTx, err := ApproveCandidateTx(0, 0, reject, params[ENVELOPE_PARAM_PEER_PUBKEY], params[ENVELOPE_PARAM_ROLE])
+		if err != nil {
+			return nil, err
+		}
+		return mutTx.Payload.(*payload.InvokeCode).Code, nil
+	},
+	ENVELOPE_ACTION_UPDATE_CONFIG: func(params map[string]string) ([]byte, error) {
+		values, err := parseUint32Params(params, ENVELOPE_PARAM_N, ENVELOPE_PARAM_C, ENVELOPE_PARAM_K, ENVELOPE_PARAM_L,
+			ENVELOPE_PARAM_BLOCK_MSG_DELAY, ENVELOPE_PARAM_HASH_MSG_DELAY, ENVELOPE_PARAM_PEER_HANDSHAKE_TIMEOUT,
+			ENVELOPE_PARAM_MAX_BLOCK_CHANGE_VIEW)
+		if err != nil {
+			return nil, err
+		}
+		mutTx, err := UpdateConfigTx(0, 0, &governance.Configuration{
+			N:                    values[0],
+			C:                    values[1],
+			K:                    values[2],
+			L:                    values[3],
+			BlockMsgDelay:        values[4],
+			HashMsgDelay:         values[5],
+			PeerHandshakeTimeout: values[6],
+			MaxBlockChangeView:   values[7],
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mutTx.Payload.(*payload.InvokeCode).Code, nil
+	},
+	ENVELOPE_ACTION_REGISTER_SIP: func(params map[string]string) ([]byte, error) {
+		values, err := parseUint32Params(params, ENVELOPE_PARAM_HEIGHT, ENVELOPE_PARAM_MIN_VOTES)
+		if err != nil {
+			return nil, err
+		}
+		mutTx, err := RegisterSipTx(0, 0, values[0], params[ENVELOPE_PARAM_DETAIL], values[1],
+			ParseUsdt(params[ENVELOPE_PARAM_BONUS]))
+		if err != nil {
+			return nil, err
+		}
+		return mutTx.Payload.(*payload.InvokeCode).Code, nil
+	},
+}
+
+func parseUint32Params(params map[string]string, names ...string) ([]uint32, error) {
+	values := make([]uint32, 0, len(names))
+	for _, name := range names {
+		value, err := strconv.ParseUint(params[name], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid param %s:%s", name, params[name])
+		}
+		values = append(values, uint32(value))
+	}
+	return values, nil
+}
+
+//NewTxEnvelope return envelope of unsigned transaction, contract and method are decoded from invoke code
+func NewTxEnvelope(action string, params []*TxParam, mutTx *types.MutableTransaction) (*TxEnvelope, error) {
+	code, err := invokeCodeOfTx(mutTx)
+	if err != nil {
+		return nil, err
+	}
+	contract, method, err := ParseNativeInvokeCode(code)
+	if err != nil {
+		return nil, err
+	}
+	envelope := &TxEnvelope{
+		Version: TX_ENVELOPE_VERSION,
+		Intent: &TxIntent{
+			Action:   action,
+			Contract: contract.ToBase58(),
+			Method:   method,
+			Params:   params,
+			Payer:    mutTx.Payer.ToBase58(),
+			GasPrice: mutTx.GasPrice,
+			GasLimit: mutTx.GasLimit,
+		},
+	}
+	err = envelope.SetTransaction(mutTx)
+	if err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+//SetMultiSig set the multi signature address whose signatures are collected in envelope
+func (this *TxEnvelope) SetMultiSig(m uint16, pubKeys []keypair.PublicKey) error {
+	pkSize := len(pubKeys)
+	if m == 0 || int(m) > pkSize || pkSize > constants.MULTI_SIG_MAX_PUBKEY_SIZE {
+		return fmt.Errorf("invalid multi signature params")
+	}
+	pks := make([]string, 0, pkSize)
+	for _, pk := range pubKeys {
+		pks = append(pks, hex.EncodeToString(keypair.SerializePublicKey(pk)))
+	}
+	this.MultiSig = &TxMultiSig{M: m, PubKeys: pks}
+	return nil
+}
+
+//MultiSigPubKeys return m and pub keys of multi signature address
+func (this *TxEnvelope) MultiSigPubKeys() (uint16, []keypair.PublicKey, error) {
+	if this.MultiSig == nil {
+		return 0, nil, fmt.Errorf("envelope has no multi signature address")
+	}
+	pubKeys := make([]keypair.PublicKey, 0, len(this.MultiSig.PubKeys))
+	for _, pk := range this.MultiSig.PubKeys {
+		data, err := hex.DecodeString(pk)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid pub key:%s", pk)
+		}
+		pubKey, err := keypair.DeserializePublicKey(data)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid pub key:%s", pk)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	return this.MultiSig.M, pubKeys, nil
+}
+
+//MultiSigAddress return address of multi signature in envelope
+func (this *TxEnvelope) MultiSigAddress() (common.Address, error) {
+	m, pubKeys, err := this.MultiSigPubKeys()
+	if err != nil {
+		return common.ADDRESS_EMPTY, err
+	}
+	return types.AddressFromMultiPubKeys(pubKeys, int(m))
+}
+
+//Transaction return the mutable transaction in envelope
+func (this *TxEnvelope) Transaction() (*types.MutableTransaction, error) {
+	txData, err := hex.DecodeString(this.RawTx)
+	if err != nil {
+		return nil, fmt.Errorf("RawTx hex decode error:%s", err)
+	}
+	tx, err := types.TransactionFromRawBytes(txData)
+	if err != nil {
+		return nil, fmt.Errorf("TransactionFromRawBytes error:%s", err)
+	}
+	return tx.IntoMutable()
+}
+
+//SetTransaction update the raw transaction in envelope, normally after signed
+func (this *TxEnvelope) SetTransaction(mutTx *types.MutableTransaction) error {
+	tx, err := mutTx.IntoImmutable()
+	if err != nil {
+		return fmt.Errorf("IntoImmutable error:%s", err)
+	}
+	sink := common.ZeroCopySink{}
+	tx.Serialization(&sink)
+	this.RawTx = hex.EncodeToString(sink.Bytes())
+	return nil
+}
+
+//Verify check the intent of envelope is consistent with raw transaction.
+//Return false if the params of the action cannot be checked
+func (this *TxEnvelope) Verify() (bool, error) {
+	if this.Version != TX_ENVELOPE_VERSION {
+		return false, fmt.Errorf("unsupport envelope version:%d", this.Version)
+	}
+	if this.Intent == nil {
+		return false, fmt.Errorf("envelope has no intent")
+	}
+	mutTx, err := this.Transaction()
+	if err != nil {
+		return false, err
+	}
+	intent := this.Intent
+	if mutTx.Payer.ToBase58() != intent.Payer {
+		return false, fmt.Errorf("payer mismatch, intent:%s tx:%s", intent.Payer, mutTx.Payer.ToBase58())
+	}
+	if mutTx.GasPrice != intent.GasPrice || mutTx.GasLimit != intent.GasLimit {
+		return false, fmt.Errorf("gas mismatch, intent:%d/%d tx:%d/%d", intent.GasPrice, intent.GasLimit,
+			mutTx.GasPrice, mutTx.GasLimit)
+	}
+	code, err := invokeCodeOfTx(mutTx)
+	if err != nil {
+		return false, err
+	}
+	contract, method, err := ParseNativeInvokeCode(code)
+	if err != nil {
+		return false, err
+	}
+	if contract.ToBase58() != intent.Contract || method != intent.Method {
+		return false, fmt.Errorf("invoke mismatch, intent:%s.%s tx:%s.%s", intent.Contract, intent.Method,
+			contract.ToBase58(), method)
+	}
+	if this.MultiSig != nil {
+		if _, err = this.MultiSigAddress(); err != nil {
+			return false, err
+		}
+	}
+	builder, ok := envelopeCodeBuilders[intent.Action]
+	if !ok {
+		return false, nil
+	}
+	params := make(map[string]string, len(intent.Params))
+	for _, param := range intent.Params {
+		params[param.Name] = param.Value
+	}
+	expect, err := builder(params)
+	if err != nil {
+		return false, fmt.Errorf("rebuild invoke code error:%s", err)
+	}
+	if !bytes.Equal(expect, code) {
+		return false, fmt.Errorf("params mismatch with invoke code of transaction")
+	}
+	return true, nil
+}
+
+//SignatureStatus return count of collected and required signatures of multi signature address
+func (this *TxEnvelope) SignatureStatus() (int, int, error) {
+	m, pubKeys, err := this.MultiSigPubKeys()
+	if err != nil {
+		return 0, 0, err
+	}
+	mutTx, err := this.Transaction()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, sig := range mutTx.Sigs {
+		if pubKeysEqual(sig.PubKeys, pubKeys) {
+			return len(sig.SigData), int(m), nil
+		}
+	}
+	return 0, int(m), nil
+}
+
+//Compact return envelope in one line string, which can be transferred by QR code
+func (this *TxEnvelope) Compact() (string, error) {
+	data, err := json.Marshal(this)
+	if err != nil {
+		return "", err
+	}
+	return TX_ENVELOPE_PREFIX + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+//ParseTxEnvelope parse envelope in json or compact format
+func ParseTxEnvelope(data []byte) (*TxEnvelope, error) {
+	str := strings.TrimSpace(string(data))
+	if strings.HasPrefix(str, TX_ENVELOPE_PREFIX) {
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(str, TX_ENVELOPE_PREFIX))
+		if err != nil {
+			return nil, fmt.Errorf("compact envelope decode error:%s", err)
+		}
+		data = decoded
+	}
+	envelope := &TxEnvelope{}
+	err := json.Unmarshal(data, envelope)
+	if err != nil {
+		return nil, fmt.Errorf("envelope unmarshal error:%s", err)
+	}
+	return envelope, nil
+}
+
+func ReadTxEnvelope(file string) (*TxEnvelope, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read envelope file:%s error:%s", file, err)
+	}
+	return ParseTxEnvelope(data)
+}
+
+func WriteTxEnvelope(file string, envelope *TxEnvelope) error {
+	data, err := json.MarshalIndent(envelope, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+//ParseNativeInvokeCode return contract address and method of native invoke code built by BuildNativeInvokeCode
+func ParseNativeInvokeCode(code []byte) (common.Address, string, error) {
+	//code tail: method, contract address, version, SYSCALL, NATIVE_INVOKE_NAME
+	name := []byte(cutils.NATIVE_INVOKE_NAME)
+	tail := append([]byte{byte(vm.SYSCALL), byte(len(name))}, name...)
+	if !bytes.HasSuffix(code, tail) {
+		return common.ADDRESS_EMPTY, "", fmt.Errorf("not native invoke code")
+	}
+	end := len(code) - len(tail) - 1 //skip version
+	start := end - common.ADDR_LEN
+	if start < 1 || code[start-1] != byte(common.ADDR_LEN) {
+		return common.ADDRESS_EMPTY, "", fmt.Errorf("invalid contract address in invoke code")
+	}
+	contract, err := common.AddressParseFromBytes(code[start:end])
+	if err != nil {
+		return common.ADDRESS_EMPTY, "", err
+	}
+	end = start - 1
+	//method is pushed with PUSHBYTES; printable chars are larger than any method length
+	for l := 1; l < int(' ') && l < end; l++ {
+		if int(code[end-l-1]) != l {
+			continue
+		}
+		method := code[end-l : end]
+		if isPrintable(method) {
+			return contract, string(method), nil
+		}
+	}
+	return common.ADDRESS_EMPTY, "", fmt.Errorf("invalid method in invoke code")
+}
+
+func invokeCodeOfTx(mutTx *types.MutableTransaction) ([]byte, error) {
+	invoke, ok := mutTx.Payload.(*payload.InvokeCode)
+	if !ok {
+		return nil, fmt.Errorf("transaction is not invoke transaction")
+	}
+	return invoke.Code, nil
+}
+
+func isPrintable(data []byte) bool {
+	for _, b := range data {
+		if b < ' ' || b > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/signature"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/smartcontract/service/native/governance"
+	"github.com/saveio/themis/smartcontract/service/native/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTransferEnvelope(t *testing.T, from, to string) *TxEnvelope {
+	mutTx, err := TransferTx(1, 20000, ASSET_USDT, from, to, ParseUsdt("12.5"))
+	assert.Nil(t, err)
+	mutTx.Payer, _ = common.AddressFromBase58(from)
+	params := []*TxParam{
+		{Name: ENVELOPE_PARAM_ASSET, Value: ASSET_USDT},
+		{Name: ENVELOPE_PARAM_FROM, Value: from},
+		{Name: ENVELOPE_PARAM_TO, Value: to},
+		{Name: ENVELOPE_PARAM_AMOUNT, Value: "12.5"},
+	}
+	envelope, err := NewTxEnvelope(ENVELOPE_ACTION_TRANSFER, params, mutTx)
+	assert.Nil(t, err)
+	return envelope
+}
+
+func TestParseNativeInvokeCode(t *testing.T) {
+	from := account.NewAccount("").Address.ToBase58()
+	to := account.NewAccount("").Address.ToBase58()
+	mutTx, err := TransferFromTx(0, 0, ASSET_USDT, to, from, to, 1)
+	assert.Nil(t, err)
+	code, err := invokeCodeOfTx(mutTx)
+	assert.Nil(t, err)
+
+	contract, method, err := ParseNativeInvokeCode(code)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.UsdtContractAddress, contract)
+	assert.Equal(t, CONTRACT_TRANSFER_FROM, method)
+
+	_, _, err = ParseNativeInvokeCode(code[:len(code)-1])
+	assert.NotNil(t, err)
+}
+
+func TestTxEnvelopeVerify(t *testing.T) {
+	from := account.NewAccount("").Address.ToBase58()
+	to := account.NewAccount("").Address.ToBase58()
+	envelope := newTestTransferEnvelope(t, from, to)
+	assert.Equal(t, utils.UsdtContractAddress.ToBase58(), envelope.Intent.Contract)
+	assert.Equal(t, CONTRACT_TRANSFER, envelope.Intent.Method)
+
+	compact, err := envelope.Compact()
+	assert.Nil(t, err)
+	envelope, err = ParseTxEnvelope([]byte(compact))
+	assert.Nil(t, err)
+	checked, err := envelope.Verify()
+	assert.Nil(t, err)
+	assert.True(t, checked)
+
+	envelope.Intent.Params[3].Value = "99"
+	_, err = envelope.Verify()
+	assert.NotNil(t, err)
+	envelope.Intent.Params[3].Value = "12.5"
+
+	envelope.Intent.Payer = to
+	_, err = envelope.Verify()
+	assert.NotNil(t, err)
+	envelope.Intent.Payer = from
+
+	envelope.Intent.Action = "unknown"
+	checked, err = envelope.Verify()
+	assert.Nil(t, err)
+	assert.False(t, checked)
+}
+
+func TestTxEnvelopeVerifyGovernance(t *testing.T) {
+	payer := account.NewAccount("")
+	peerPubkey := hex.EncodeToString(keypair.SerializePublicKey(account.NewAccount("").PublicKey))
+	config := &governance.Configuration{N: 7, C: 2, K: 7, L: 112, BlockMsgDelay: 10000, HashMsgDelay: 10000,
+		PeerHandshakeTimeout: 10, MaxBlockChangeView: 120000}
+	approveTx, err := ApproveCandidateTx(0, 0, false, peerPubkey, KIND_CONSENSUS)
+	assert.Nil(t, err)
+	configTx, err := UpdateConfigTx(0, 0, config)
+	assert.Nil(t, err)
+	sipTx, err := RegisterSipTx(0, 0, 100, "sip detail", 3, ParseUsdt("10"))
+	assert.Nil(t, err)
+
+	tests := []struct {
+		action string
+		params []*TxParam
+		mutTx  *types.MutableTransaction
+	}{
+		{ENVELOPE_ACTION_APPROVE_CANDIDATE, []*TxParam{
+			{Name: ENVELOPE_PARAM_ROLE, Value: KIND_CONSENSUS},
+			{Name: ENVELOPE_PARAM_PEER_PUBKEY, Value: peerPubkey},
+			{Name: ENVELOPE_PARAM_REJECT, Value: "false"},
+		}, approveTx},
+		{ENVELOPE_ACTION_UPDATE_CONFIG, []*TxParam{
+			{Name: ENVELOPE_PARAM_N, Value: "7"},
+			{Name: ENVELOPE_PARAM_C, Value: "2"},
+			{Name: ENVELOPE_PARAM_K, Value: "7"},
+			{Name: ENVELOPE_PARAM_L, Value: "112"},
+			{Name: ENVELOPE_PARAM_BLOCK_MSG_DELAY, Value: "10000"},
+			{Name: ENVELOPE_PARAM_HASH_MSG_DELAY, Value: "10000"},
+			{Name: ENVELOPE_PARAM_PEER_HANDSHAKE_TIMEOUT, Value: "10"},
+			{Name: ENVELOPE_PARAM_MAX_BLOCK_CHANGE_VIEW, Value: "120000"},
+		}, configTx},
+		{ENVELOPE_ACTION_REGISTER_SIP, []*TxParam{
+			{Name: ENVELOPE_PARAM_HEIGHT, Value: "100"},
+			{Name: ENVELOPE_PARAM_DETAIL, Value: "sip detail"},
+			{Name: ENVELOPE_PARAM_MIN_VOTES, Value: "3"},
+			{Name: ENVELOPE_PARAM_BONUS, Value: "10"},
+		}, sipTx},
+	}
+	for _, test := range tests {
+		test.mutTx.Payer = payer.Address
+		envelope, err := NewTxEnvelope(test.action, test.params, test.mutTx)
+		assert.Nil(t, err)
+		compact, err := envelope.Compact()
+		assert.Nil(t, err)
+		envelope, err = ParseTxEnvelope([]byte(compact))
+		assert.Nil(t, err)
+		checked, err := envelope.Verify()
+		assert.Nil(t, err, test.action)
+		assert.True(t, checked, test.action)
+
+		envelope.Intent.Params[0].Value = "1"
+		_, err = envelope.Verify()
+		assert.NotNil(t, err, test.action)
+	}
+}
+
+func TestTxEnvelopeMultiSig(t *testing.T) {
+	accs := []*account.Account{account.NewAccount(""), account.NewAccount(""), account.NewAccount("")}
+	pubKeys := make([]keypair.PublicKey, 0, len(accs))
+	for _, acc := range accs {
+		pubKeys = append(pubKeys, acc.PublicKey)
+	}
+	multiAddr, err := types.AddressFromMultiPubKeys(pubKeys, 2)
+	assert.Nil(t, err)
+
+	envelope := newTestTransferEnvelope(t, multiAddr.ToBase58(), accs[0].Address.ToBase58())
+	assert.Nil(t, envelope.SetMultiSig(2, pubKeys))
+	addr, err := envelope.MultiSigAddress()
+	assert.Nil(t, err)
+	assert.Equal(t, multiAddr, addr)
+
+	//signers collect signatures in any order, sign again is ignored
+	for _, signer := range []*account.Account{accs[2], accs[2], accs[0]} {
+		m, pks, err := envelope.MultiSigPubKeys()
+		assert.Nil(t, err)
+		mutTx, err := envelope.Transaction()
+		assert.Nil(t, err)
+		assert.Nil(t, MultiSigTransaction(mutTx, m, pks, signer))
+		assert.Nil(t, envelope.SetTransaction(mutTx))
+	}
+	collected, required, err := envelope.SignatureStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, collected)
+	assert.Equal(t, 2, required)
+
+	mutTx, err := envelope.Transaction()
+	assert.Nil(t, err)
+	hash := mutTx.Hash()
+	sig := mutTx.Sigs[0]
+	assert.Nil(t, signature.VerifyMultiSignature(hash.ToArray(), sig.PubKeys, int(sig.M), sig.SigData))
+}
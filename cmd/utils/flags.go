@@ -82,6 +82,26 @@ var (
 		Usage: "Block data storage `<path>`",
 		Value: config.DEFAULT_DATA_DIR,
 	}
+	StateSnapshotIntervalFlag = cli.UintFlag{
+		Name:  "state-snapshot-interval",
+		Usage: "Save state snapshot for peers every `<number>` blocks, a multiple of state checkpoint interval 10000, 0 disables it",
+	}
+	LightModeFlag = cli.BoolFlag{
+		Name:  "light",
+		Usage: "Run as light client, only sync headers and fetch transactions, events and storage from peers on demand. Events and storage have no proof, they are agreed by peers and marked unverified",
+	}
+	StateRetentionFlag = cli.UintFlag{
+		Name:  "state-retention",
+		Usage: "Prune the write set hashes, cross chain messages and state history older than the latest `<number>` blocks, 0 keeps all, at least 1000",
+	}
+	StoreBackendFlag = cli.StringFlag{
+		Name:  "store-backend",
+		Usage: "Storage `<engine>` of ledger, leveldb or boltdb. Default is the engine of the existing ledger, or leveldb for a new one",
+	}
+	ArchiveModeFlag = cli.BoolFlag{
+		Name:  "archive",
+		Usage: "Keep the state history, so that storage, balance and pre-execution can be queried at the heights since enabled",
+	}
 	//Consensus setting
 	EnableConsensusFlag = cli.BoolFlag{
 		Name:  "enable-consensus",
@@ -106,7 +126,20 @@ var (
 	// PoC setting
 	PlotDirFlag = cli.StringFlag{
 		Name:  "plot-dir",
-		Usage: "Plots file dir `<path>`",
+		Usage: "Plots file dir `<path>`. Separate multiple dirs with comma",
+	}
+	EnableMiningFlag = cli.BoolFlag{
+		Name:  "enable-mining",
+		Usage: "Start the built-in miner, which scans plot files of the account in plot dirs and submits nonces",
+	}
+	MiningThreadsFlag = cli.IntFlag{
+		Name:  "mining-threads",
+		Usage: "Number of `<threads>` scanning plot files",
+		Value: 2,
+	}
+	MiningTargetDeadlineFlag = cli.Uint64Flag{
+		Name:  "mining-target-deadline",
+		Usage: "Max `<deadline>` to submit. 0 means no limit",
 	}
 	PocBlockPerViewFlag = cli.IntFlag{
 		Name:  "poc-block-per-view",
@@ -123,6 +156,11 @@ var (
 		Usage: "Block-out `<time>`(s) in test mode.",
 		Value: config.DEFAULT_GEN_BLOCK_TIME,
 	}
+	TestModeGenBlockModeFlag = cli.StringFlag{
+		Name:  "testmode-gen-block-mode",
+		Usage: "Block-out `<mode>` in test mode. interval: every gen block time, instant: when tx pool is not empty, manual: by local rpc only",
+		Value: config.GEN_BLOCK_MODE_INTERVAL,
+	}
 
 	//P2P setting
 	ReservedPeersOnlyFlag = cli.BoolFlag{
@@ -190,6 +228,30 @@ var (
 		Name:  "proxy-server-id-list",
 		Usage: "Id list of proxy servers",
 	}
+	EnableStateSyncFlag = cli.BoolFlag{
+		Name:  "enable-state-sync",
+		Usage: "Bootstrap ledger from the state snapshot of peers before block sync",
+	}
+	PeerBanThresholdFlag = cli.UintFlag{
+		Name:  "peer-ban-threshold",
+		Usage: "Ban a peer when its misbehavior score reaches `<score>`, 0 means never",
+		Value: config.DEFAULT_PEER_BAN_THRESHOLD,
+	}
+	PeerBanTimeFlag = cli.UintFlag{
+		Name:  "peer-ban-time",
+		Usage: "Ban time `<seconds>` of the misbehaving peer",
+		Value: config.DEFAULT_PEER_BAN_TIME,
+	}
+	TxGossipFanoutFlag = cli.UintFlag{
+		Name:  "tx-gossip-fanout",
+		Usage: "Announce transaction to `<number>` peers, 0 means all peers",
+		Value: config.DEFAULT_TX_GOSSIP_FANOUT,
+	}
+	NATFlag = cli.StringFlag{
+		Name:  "nat",
+		Usage: "Port mapping `<mechanism>`: none|any|upnp|pmp|pmp:<IP>|extip:<IP>",
+		Value: config.DEFAULT_NAT,
+	}
 
 	// RPC settings
 	RPCDisabledFlag = cli.BoolFlag{
@@ -474,6 +536,14 @@ var (
 		Name:  "raw-tx",
 		Usage: "Raw `<transaction>` encode with hex string",
 	}
+	TxEnvelopeFlag = cli.StringFlag{
+		Name:  "envelope",
+		Usage: "Transaction envelope `<file>` for offline signing",
+	}
+	ForceSignTxFlag = cli.BoolFlag{
+		Name:  "force,f",
+		Usage: "Sign the envelope even if the params of its action cannot be checked against the raw transaction",
+	}
 	PrepareExecTransactionFlag = cli.BoolFlag{
 		Name:  "prepare,p",
 		Usage: "Prepare execute transaction, without commit to ledger",
@@ -527,6 +597,16 @@ var (
 		Value: "m",
 	}
 
+	//Database setting
+	DbCompactFlag = cli.BoolFlag{
+		Name:  "compact",
+		Usage: "Compact the databases to reclaim the space of pruned data before reporting",
+	}
+	DbTargetFlag = cli.StringFlag{
+		Name:  "to",
+		Usage: "The `<target>` of database command, the storage engine to migrate to, or the block height to roll back to",
+	}
+
 	//PreExecute switcher
 	TxpoolPreExecDisableFlag = cli.BoolFlag{
 		Name:  "disable-tx-pool-pre-exec",
@@ -544,6 +624,31 @@ var (
 		Usage: "Disable broadcast tx from network in tx pool",
 	}
 
+	DisableTxPoolJournalFlag = cli.BoolFlag{
+		Name:  "disable-tx-pool-journal",
+		Usage: "Disable journaling pending transactions and poc params of tx pool to disk",
+	}
+
+	//Tx pool admission policy
+	TxPoolMaxSizeFlag = cli.UintFlag{
+		Name:  "tx-pool-max-size",
+		Usage: "Max transaction `<number>` in tx pool, the lowest gas price ones are evicted when full",
+		Value: config.DEFAULT_TXPOOL_MAX_SIZE,
+	}
+	TxPoolMaxPayerPendingFlag = cli.UintFlag{
+		Name:  "tx-pool-max-payer-pending",
+		Usage: "Max transaction `<number>` in tx pool for a payer, 0 means unlimited",
+		Value: config.DEFAULT_TXPOOL_MAX_PAYER_PENDING,
+	}
+	TxPoolContractQuotaFlag = cli.UintFlag{
+		Name:  "tx-pool-contract-quota",
+		Usage: "Max transaction `<number>` in tx pool invoking a contract, 0 means unlimited",
+	}
+	TxPoolContractQuotasFlag = cli.StringFlag{
+		Name:  "tx-pool-contract-quotas",
+		Usage: "Quota for specific contracts. Format: `<contract>=<number>` in hex, separated by comma",
+	}
+
 	NonOptionFlag = cli.StringFlag{
 		Name:  "option",
 		Usage: "this command does not need option, please run directly",
@@ -624,6 +729,159 @@ var (
 		Usage: "Total `<bonus>` for sip vote. Float number",
 	}
 
+	//savefs setting
+	FsNodeVolumeFlag = cli.Uint64Flag{
+		Name:  "volume",
+		Usage: "Storage `<volume>` of the node in KB",
+	}
+	FsNodeServiceTimeFlag = cli.Uint64Flag{
+		Name:  "servicetime",
+		Usage: "Service `<time>` of the node",
+	}
+	FsNodeAddrFlag = cli.StringFlag{
+		Name:  "nodeaddr",
+		Usage: "Network `<address>` of the node, such as tcp://127.0.0.1:10338",
+	}
+	FsFileHashFlag = cli.StringFlag{
+		Name:  "hash",
+		Usage: "File `<hash>`",
+	}
+	FsRenewTimesFlag = cli.Uint64Flag{
+		Name:  "times",
+		Usage: "Number of prove `<times>` to renew the file",
+	}
+	FsFileSizeFlag = cli.Uint64Flag{
+		Name:  "filesize",
+		Usage: "File `<size>` in KB",
+	}
+	FsCopyNumFlag = cli.Uint64Flag{
+		Name:  "copynum",
+		Usage: "Copy `<number>` of the file",
+		Value: 2,
+	}
+	FsProveIntervalFlag = cli.Uint64Flag{
+		Name:  "interval",
+		Usage: "Prove `<interval>` in blocks. If not specified, using interval of default prove level",
+	}
+	FsExpiredHeightFlag = cli.Uint64Flag{
+		Name:  "expire",
+		Usage: "Block `<height>` the file expired at",
+	}
+	FsProfessionalFlag = cli.BoolFlag{
+		Name:  "professional",
+		Usage: "Using professional storage type which pays for space and validation",
+	}
+	FsSpaceOwnerFlag = cli.StringFlag{
+		Name:  "owner",
+		Usage: "Owner `<address>` of the user space. If not specified, using the signer account",
+	}
+	FsSpaceSizeFlag = cli.Uint64Flag{
+		Name:  "size",
+		Usage: "`<size>` of the user space in KB",
+	}
+	FsSpaceBlocksFlag = cli.Uint64Flag{
+		Name:  "blocks",
+		Usage: "Number of `<blocks>` the user space lasts",
+	}
+	FsSpaceRevokeFlag = cli.BoolFlag{
+		Name:  "revoke",
+		Usage: "Revoke size and blocks from the user space instead of adding",
+	}
+
+	//dns setting
+	DnsHeaderFlag = cli.StringFlag{
+		Name:  "header",
+		Usage: "`<header>` of the name, such as dsp",
+	}
+	DnsUrlFlag = cli.StringFlag{
+		Name:  "url",
+		Usage: "`<url>` of the name",
+	}
+	DnsNameFlag = cli.StringFlag{
+		Name:  "name",
+		Usage: "`<name>` to register, at least 4 characters",
+	}
+	DnsDescFlag = cli.StringFlag{
+		Name:  "desc",
+		Usage: "Description of the name",
+	}
+	DnsTTLFlag = cli.Uint64Flag{
+		Name:  "ttl",
+		Usage: "Time to live of the name in blocks. 0 means never expire",
+	}
+	DnsNodeIPFlag = cli.StringFlag{
+		Name:  "ip",
+		Usage: "Public `<ip>` of the dns node",
+	}
+	DnsNodePortFlag = cli.StringFlag{
+		Name:  "port",
+		Usage: "Service `<port>` of the dns node",
+	}
+	DnsNodeDepositFlag = cli.StringFlag{
+		Name:  "deposit",
+		Usage: "Init deposit `<amount>` of the dns node",
+	}
+	DnsNodePubkeyFlag = cli.StringFlag{
+		Name:  "pubkey",
+		Usage: "Peer `<pubkey>` of the dns node. If not specified, using public key of the account",
+	}
+
+	//micropayment setting
+	ChannelIdFlag = cli.Uint64Flag{
+		Name:  "id",
+		Usage: "Channel `<id>`",
+	}
+	ChannelPartnerFlag = cli.StringFlag{
+		Name:  "partner",
+		Usage: "Partner `<address>` of the channel",
+	}
+	ChannelSettleTimeoutFlag = cli.Uint64Flag{
+		Name:  "settletimeout",
+		Usage: "Number of `<blocks>` to wait after the channel is closed before it can be settled",
+		Value: 50,
+	}
+	ChannelTotalDepositFlag = cli.StringFlag{
+		Name:  "total",
+		Usage: "Total deposit `<amount>` of the account in channel",
+	}
+	ChannelTransferredFlag = cli.StringFlag{
+		Name:  "transferred",
+		Usage: "Transferred `<amount>` of the account to partner",
+	}
+	ChannelPartnerTransferredFlag = cli.StringFlag{
+		Name:  "partnertransferred",
+		Usage: "Transferred `<amount>` of the partner to the account",
+	}
+
+	//plot setting
+	PlotFileDirFlag = cli.StringFlag{
+		Name:  "dir",
+		Usage: "Plot file `<path>`",
+		Value: "plots",
+	}
+	PlotStartNonceFlag = cli.Uint64Flag{
+		Name:  "start",
+		Usage: "Start `<nonce>` of plot file",
+	}
+	PlotNoncesFlag = cli.Uint64Flag{
+		Name:  "nonces",
+		Usage: "`<number>` of nonces in plot file. Each nonce takes 256KB",
+	}
+	PlotThreadsFlag = cli.IntFlag{
+		Name:  "threads",
+		Usage: "Number of `<threads>` generating nonces. 0 means number of CPUs",
+	}
+	PlotBatchNoncesFlag = cli.Uint64Flag{
+		Name:  "batch",
+		Usage: "`<number>` of nonces generated in memory before written to file",
+		Value: 64,
+	}
+	PlotVerifySamplesFlag = cli.Uint64Flag{
+		Name:  "samples",
+		Usage: "`<number>` of nonces verified evenly in plot file. 0 means all nonces",
+		Value: 16,
+	}
+
 	//network config
 	PublicAddrFlag = cli.StringFlag{
 		Name:  "public-addr",
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/smartcontract/service/native/micropayment"
+	"github.com/saveio/themis/smartcontract/service/native/utils"
+)
+
+const VERSION_CONTRACT_MICROPAY = byte(0)
+
+//ChannelState is the state of channel returned by GetChannelInfo
+type ChannelState struct {
+	ChannelID         uint64
+	SettleBlockHeight uint64
+	State             uint64
+	Participant1      common.Address
+	P1IsCloser        bool
+	Participant2      common.Address
+	P2IsCloser        bool
+}
+
+//OpenChannel open a channel between signer and partner
+func OpenChannel(gasPrice, gasLimit uint64, signer *account.Account, partner common.Address, settleBlockHeight uint64) (string, error) {
+	openInfo := &micropayment.OpenChannelInfo{
+		Participant1WalletAddr: signer.Address,
+		Participant1PubKey:     keypair.SerializePublicKey(signer.PublicKey),
+		Participant2WalletAddr: partner,
+		SettleBlockHeight:      settleBlockHeight,
+	}
+	return invokeMicroPayContract(gasPrice, gasLimit, signer, micropayment.MP_OPEN_CHANNEL, []interface{}{openInfo})
+}
+
+//SetTotalDeposit set total deposit of signer in channel
+func SetTotalDeposit(gasPrice, gasLimit uint64, signer *account.Account, channelID uint64, partner common.Address, totalDeposit uint64) (string, error) {
+	depositInfo := &micropayment.SetTotalDepositInfo{
+		ChannelID:             channelID,
+		ParticipantWalletAddr: signer.Address,
+		PartnerWalletAddr:     partner,
+		SetTotalDeposit:       totalDeposit,
+	}
+	return invokeMicroPayContract(gasPrice, gasLimit, signer, micropayment.MP_SET_TOTALDEPOSIT, []interface{}{depositInfo})
+}
+
+//CloseChannel close channel by signer without partner balance proof
+func CloseChannel(gasPrice, gasLimit uint64, signer *account.Account, channelID uint64, partner common.Address) (string, error) {
+	closeInfo := &micropayment.CloseChannelInfo{
+		ChannelID:          channelID,
+		ParticipantAddress: signer.Address,
+		PartnerAddress:     partner,
+	}
+	return invokeMicroPayContract(gasPrice, gasLimit, signer, micropayment.MP_CLOSE_CHANNEL, []interface{}{closeInfo})
+}
+
+//SettleChannel settle a closed channel with transferred amounts of both participants. Locked amounts are not supported
+func SettleChannel(gasPrice, gasLimit uint64, signer *account.Account, channelID uint64, partner common.Address, transferred, partnerTransferred uint64) (string, error) {
+	settleInfo := &micropayment.SettleChannelInfo{
+		ChanID:              channelID,
+		Participant1:        signer.Address,
+		P1TransferredAmount: transferred,
+		Participant2:        partner,
+		P2TransferredAmount: partnerTransferred,
+	}
+	return invokeMicroPayContract(gasPrice, gasLimit, signer, micropayment.MP_SETTLE_CHANNEL, []interface{}{settleInfo})
+}
+
+//GetChannelId return id of channel between participants, 0 if not exist
+func GetChannelId(participant1, participant2 common.Address) (uint64, error) {
+	param := &micropayment.GetChannelId{
+		Participant1WalletAddr: participant1,
+		Participant2WalletAddr: participant2,
+	}
+	data, err := prepareInvokeNative(utils.MicroPayContractAddress, VERSION_CONTRACT_MICROPAY, micropayment.MP_GET_CHANNELID, []interface{}{param})
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, fmt.Errorf("invalid channel id:%x", data)
+	}
+	return binary.LittleEndian.Uint64(data), nil
+}
+
+//GetChannelInfo return state of channel
+func GetChannelInfo(channelID uint64) (*ChannelState, error) {
+	param := &micropayment.GetChanInfo{ChannelID: channelID}
+	data, err := prepareInvokeNative(utils.MicroPayContractAddress, VERSION_CONTRACT_MICROPAY, micropayment.MP_GET_CHANNELINFO, []interface{}{param})
+	if err != nil {
+		return nil, err
+	}
+	return ParseChannelState(data)
+}
+
+//ParseChannelState parse return value of GetChannelInfo
+func ParseChannelState(data []byte) (*ChannelState, error) {
+	source := common.NewZeroCopySource(data)
+	state := &ChannelState{}
+	var err error
+	if state.ChannelID, err = utils.DecodeVarUint(source); err != nil {
+		return nil, fmt.Errorf("decode channel id error:%s", err)
+	}
+	if state.SettleBlockHeight, err = utils.DecodeVarUint(source); err != nil {
+		return nil, fmt.Errorf("decode settle block height error:%s", err)
+	}
+	if state.State, err = utils.DecodeVarUint(source); err != nil {
+		return nil, fmt.Errorf("decode channel state error:%s", err)
+	}
+	if state.Participant1, err = utils.DecodeAddress(source); err != nil {
+		return nil, fmt.Errorf("decode participant1 error:%s", err)
+	}
+	if state.P1IsCloser, err = utils.DecodeBool(source); err != nil {
+		return nil, fmt.Errorf("decode participant1 closer error:%s", err)
+	}
+	if state.Participant2, err = utils.DecodeAddress(source); err != nil {
+		return nil, fmt.Errorf("decode participant2 error:%s", err)
+	}
+	if state.P2IsCloser, err = utils.DecodeBool(source); err != nil {
+		return nil, fmt.Errorf("decode participant2 closer error:%s", err)
+	}
+	return state, nil
+}
+
+//GetChannelParticipantInfo return info of participant in channel
+func GetChannelParticipantInfo(channelID uint64, participant, partner common.Address) (*micropayment.Participant, error) {
+	param := &micropayment.GetChanInfo{
+		ChannelID:    channelID,
+		Participant1: participant,
+		Participant2: partner,
+	}
+	data, err := prepareInvokeNative(utils.MicroPayContractAddress, VERSION_CONTRACT_MICROPAY, micropayment.MP_GET_CHANNEL_PARTICIPANTINFO, []interface{}{param})
+	if err != nil {
+		return nil, err
+	}
+	info := &micropayment.Participant{}
+	if err = info.Deserialization(common.NewZeroCopySource(data)); err != nil {
+		return nil, fmt.Errorf("participant info deserialize error:%s", err)
+	}
+	return info, nil
+}
+
+//GetChannelStateName return readable name of channel state
+func GetChannelStateName(state uint64) string {
+	switch state {
+	case micropayment.Opened:
+		return "opened"
+	case micropayment.Closed:
+		return "closed"
+	case micropayment.Settled:
+		return "settled"
+	case micropayment.Removed:
+		return "removed"
+	default:
+		return "nonexistent"
+	}
+}
+
+func invokeMicroPayContract(gasPrice, gasLimit uint64, signer *account.Account, method string, params []interface{}) (string, error) {
+	return InvokeNativeContract(gasPrice, gasLimit, signer, utils.MicroPayContractAddress, VERSION_CONTRACT_MICROPAY, method, params)
+}
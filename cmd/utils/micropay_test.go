@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/smartcontract/service/native/micropayment"
+	"github.com/saveio/themis/smartcontract/service/native/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChannelState(t *testing.T) {
+	p1 := common.Address{1}
+	p2 := common.Address{2}
+	sink := common.NewZeroCopySink(nil)
+	utils.EncodeVarUint(sink, 3)
+	utils.EncodeVarUint(sink, 100)
+	utils.EncodeVarUint(sink, micropayment.Closed)
+	utils.EncodeAddress(sink, p1)
+	utils.EncodeBool(sink, true)
+	utils.EncodeAddress(sink, p2)
+	utils.EncodeBool(sink, false)
+
+	state, err := ParseChannelState(sink.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), state.ChannelID)
+	assert.Equal(t, uint64(100), state.SettleBlockHeight)
+	assert.Equal(t, "closed", GetChannelStateName(state.State))
+	assert.Equal(t, p1, state.Participant1)
+	assert.True(t, state.P1IsCloser)
+	assert.Equal(t, p2, state.Participant2)
+	assert.False(t, state.P2IsCloser)
+
+	_, err = ParseChannelState(sink.Bytes()[:10])
+	assert.NotNil(t, err)
+}
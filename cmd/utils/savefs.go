@@ -0,0 +1,267 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/smartcontract/service/native/savefs"
+	"github.com/saveio/themis/smartcontract/service/native/usdt"
+	"github.com/saveio/themis/smartcontract/service/native/utils"
+)
+
+const VERSION_CONTRACT_FS = byte(0)
+
+//FsNodeRegister register signer as a storage node with volume(KB), service time and node network address
+func FsNodeRegister(gasPrice, gasLimit uint64, signer *account.Account, volume, serviceTime uint64, nodeAddr string) (string, error) {
+	nodeInfo := &savefs.FsNodeInfo{
+		Volume:      volume,
+		ServiceTime: serviceTime,
+		WalletAddr:  signer.Address,
+		NodeAddr:    []byte(nodeAddr),
+	}
+	return invokeFsContract(gasPrice, gasLimit, signer, savefs.FS_NODE_REGISTER, []interface{}{nodeInfo})
+}
+
+//FsNodeUpdate update volume, service time and node network address of signer's storage node
+func FsNodeUpdate(gasPrice, gasLimit uint64, signer *account.Account, volume, serviceTime uint64, nodeAddr string) (string, error) {
+	nodeInfo := &savefs.FsNodeInfo{
+		Volume:      volume,
+		ServiceTime: serviceTime,
+		WalletAddr:  signer.Address,
+		NodeAddr:    []byte(nodeAddr),
+	}
+	return invokeFsContract(gasPrice, gasLimit, signer, savefs.FS_NODE_UPDATE, []interface{}{nodeInfo})
+}
+
+//FsNodeCancel cancel signer's storage node, pledge and profit will be returned
+func FsNodeCancel(gasPrice, gasLimit uint64, signer *account.Account) (string, error) {
+	return invokeFsContract(gasPrice, gasLimit, signer, savefs.FS_NODE_CANCEL, []interface{}{signer.Address})
+}
+
+//FsFileRenew renew a file for renewTimes prove intervals
+func FsFileRenew(gasPrice, gasLimit uint64, signer *account.Account, fileHash string, renewTimes uint64) (string, error) {
+	fileReNew := &savefs.FileReNew{
+		FileHash:   []byte(fileHash),
+		FromAddr:   signer.Address,
+		ReNewTimes: renewTimes,
+	}
+	return invokeFsContract(gasPrice, gasLimit, signer, savefs.FS_FILE_RENEW, []interface{}{fileReNew})
+}
+
+//FsDeleteFiles delete files owned by signer
+func FsDeleteFiles(gasPrice, gasLimit uint64, signer *account.Account, fileHashes []string) (string, error) {
+	fileList := &savefs.FileList{}
+	for _, fileHash := range fileHashes {
+		fileList.List = append(fileList.List, savefs.FileHash{Hash: []byte(fileHash)})
+		fileList.FileNum++
+	}
+	bf := new(bytes.Buffer)
+	if err := fileList.Serialize(bf); err != nil {
+		return "", fmt.Errorf("serialize file list error:%s", err)
+	}
+	return invokeFsContract(gasPrice, gasLimit, signer, savefs.FS_DELETE_FILES, []interface{}{bf.Bytes()})
+}
+
+//FsChangeFileOwner transfer a file owned by signer to new owner
+func FsChangeFileOwner(gasPrice, gasLimit uint64, signer *account.Account, fileHash string, newOwner common.Address) (string, error) {
+	ownerChange := &savefs.OwnerChange{
+		FileHash: []byte(fileHash),
+		CurOwner: signer.Address,
+		NewOwner: newOwner,
+	}
+	return invokeFsContract(gasPrice, gasLimit, signer, savefs.FS_CHANGE_FILE_OWNER, []interface{}{ownerChange})
+}
+
+//NewFsUserSpaceParams return params to add or revoke size(KB) and block count of owner's user space
+func NewFsUserSpaceParams(walletAddr, owner common.Address, size, blockCount uint64, revoke bool) *savefs.UserSpaceParams {
+	opType := uint64(savefs.UserSpaceAdd)
+	if revoke {
+		opType = uint64(savefs.UserSpaceRevoke)
+	}
+	params := &savefs.UserSpaceParams{
+		WalletAddr: walletAddr,
+		Owner:      owner,
+		Size:       &savefs.UserSpaceOperation{Type: uint64(savefs.UserSpaceNone)},
+		BlockCount: &savefs.UserSpaceOperation{Type: uint64(savefs.UserSpaceNone)},
+	}
+	if size > 0 {
+		params.Size = &savefs.UserSpaceOperation{Type: opType, Value: size}
+	}
+	if blockCount > 0 {
+		params.BlockCount = &savefs.UserSpaceOperation{Type: opType, Value: blockCount}
+	}
+	return params
+}
+
+//FsManageUserSpace add or revoke user space, signer pays for or receives the changes
+func FsManageUserSpace(gasPrice, gasLimit uint64, signer *account.Account, params *savefs.UserSpaceParams) (string, error) {
+	return invokeFsContract(gasPrice, gasLimit, signer, savefs.NEW_FS_MANAGE_USER_SPACE, []interface{}{params})
+}
+
+//GetFsSetting return global setting of savefs contract
+func GetFsSetting() (*savefs.FsSetting, error) {
+	data, err := prepareInvokeFsContract(savefs.FS_GETSETTING, []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	setting := &savefs.FsSetting{}
+	if err = setting.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
+
+//GetFsStorageFee return the storage fee of uploading a file with upload option
+func GetFsStorageFee(opt *savefs.UploadOption) (*savefs.StorageFee, error) {
+	bf := new(bytes.Buffer)
+	if err := opt.Serialize(bf); err != nil {
+		return nil, fmt.Errorf("serialize upload option error:%s", err)
+	}
+	data, err := prepareInvokeFsContract(savefs.FS_GETSTORAGEFEE, []interface{}{bf.Bytes()})
+	if err != nil {
+		return nil, err
+	}
+	fee := &savefs.StorageFee{}
+	if err = fee.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return fee, nil
+}
+
+//GetFsNodeInfo return storage node info of wallet address
+func GetFsNodeInfo(walletAddr common.Address) (*savefs.FsNodeInfo, error) {
+	data, err := prepareInvokeFsContract(savefs.FS_NODE_QUERY, []interface{}{walletAddr})
+	if err != nil {
+		return nil, err
+	}
+	nodeInfo := &savefs.FsNodeInfo{}
+	if err = nodeInfo.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return nodeInfo, nil
+}
+
+//GetFsNodeList return all registered storage nodes
+func GetFsNodeList() (*savefs.FsNodesInfo, error) {
+	data, err := prepareInvokeFsContract(savefs.FS_GET_NODE_LIST, []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	nodesInfo := &savefs.FsNodesInfo{}
+	if len(data) == 0 {
+		return nodesInfo, nil
+	}
+	if err = nodesInfo.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return nodesInfo, nil
+}
+
+//GetFsFileList return file hashes owned by wallet address
+func GetFsFileList(walletAddr common.Address) (*savefs.FileList, error) {
+	data, err := prepareInvokeFsContract(savefs.FS_GET_FILE_LIST, []interface{}{walletAddr})
+	if err != nil {
+		return nil, err
+	}
+	fileList := &savefs.FileList{}
+	if err = fileList.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return fileList, nil
+}
+
+//GetFsFileInfo return file info of file hash
+func GetFsFileInfo(fileHash string) (*savefs.FileInfo, error) {
+	data, err := prepareInvokeFsContract(savefs.FS_GET_FILE_INFO, []interface{}{[]byte(fileHash)})
+	if err != nil {
+		return nil, err
+	}
+	fileInfo := &savefs.FileInfo{}
+	if err = fileInfo.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return fileInfo, nil
+}
+
+//GetFsUserSpace return user space of wallet address
+func GetFsUserSpace(walletAddr common.Address) (*savefs.UserSpace, error) {
+	data, err := prepareInvokeFsContract(savefs.FS_GET_USER_SPACE, []interface{}{walletAddr})
+	if err != nil {
+		return nil, err
+	}
+	userSpace := &savefs.UserSpace{}
+	if err = userSpace.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return userSpace, nil
+}
+
+//GetFsUserSpaceCost return the transfer needed by a user space change
+func GetFsUserSpaceCost(params *savefs.UserSpaceParams) (*usdt.State, error) {
+	data, err := prepareInvokeFsContract(savefs.FS_GET_USER_SPACE_COST, []interface{}{params})
+	if err != nil {
+		return nil, err
+	}
+	state := &usdt.State{}
+	if err = state.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+//GetFsSectorsForNode return sectors of storage node
+func GetFsSectorsForNode(nodeAddr common.Address) (*savefs.SectorInfos, error) {
+	data, err := prepareInvokeFsContract(savefs.FS_GET_SECTORS_FOR_NODE, []interface{}{nodeAddr})
+	if err != nil {
+		return nil, err
+	}
+	sectorInfos := &savefs.SectorInfos{}
+	if err = sectorInfos.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return sectorInfos, nil
+}
+
+func invokeFsContract(gasPrice, gasLimit uint64, signer *account.Account, method string, params []interface{}) (string, error) {
+	return InvokeNativeContract(gasPrice, gasLimit, signer, utils.OntFSContractAddress, VERSION_CONTRACT_FS, method, params)
+}
+
+func prepareInvokeFsContract(method string, params []interface{}) ([]byte, error) {
+	data, err := prepareInvokeNative(utils.OntFSContractAddress, VERSION_CONTRACT_FS, method, params)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFsContractReturn(method, data)
+}
+
+//ParseFsContractReturn return the info of savefs contract return value, or error if contract return false
+func ParseFsContractReturn(method string, data []byte) ([]byte, error) {
+	retInfo := &savefs.RetInfo{}
+	if err := retInfo.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("%s return value deserialize error:%s", method, err)
+	}
+	if !retInfo.Ret {
+		return nil, fmt.Errorf("%s error:%s", method, retInfo.Info)
+	}
+	return retInfo.Info, nil
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/smartcontract/service/native/savefs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFsContractReturn(t *testing.T) {
+	info, err := ParseFsContractReturn(savefs.FS_GET_FILE_INFO, savefs.EncRet(true, []byte("info")))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("info"), info)
+
+	_, err = ParseFsContractReturn(savefs.FS_GET_FILE_INFO, savefs.EncRet(false, []byte("not found")))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not found")
+
+	_, err = ParseFsContractReturn(savefs.FS_GET_FILE_INFO, []byte{})
+	assert.NotNil(t, err)
+}
+
+func TestNewFsUserSpaceParams(t *testing.T) {
+	walletAddr := common.Address{1}
+	owner := common.Address{2}
+
+	params := NewFsUserSpaceParams(walletAddr, owner, 1024, 0, false)
+	assert.Equal(t, walletAddr, params.WalletAddr)
+	assert.Equal(t, owner, params.Owner)
+	assert.Equal(t, uint64(savefs.UserSpaceAdd), params.Size.Type)
+	assert.Equal(t, uint64(1024), params.Size.Value)
+	assert.Equal(t, uint64(savefs.UserSpaceNone), params.BlockCount.Type)
+
+	params = NewFsUserSpaceParams(walletAddr, owner, 0, 100, true)
+	assert.Equal(t, uint64(savefs.UserSpaceNone), params.Size.Type)
+	assert.Equal(t, uint64(savefs.UserSpaceRevoke), params.BlockCount.Type)
+	assert.Equal(t, uint64(100), params.BlockCount.Value)
+}
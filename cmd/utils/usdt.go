@@ -339,6 +339,16 @@ func RegisterSipTx(gasPrice, gasLimit uint64, height uint32, detail string, minV
 	return mutableTx, nil
 }
 
+func UpdateConfigTx(gasPrice, gasLimit uint64, configure *governance.Configuration) (*types.MutableTransaction, error) {
+	invokeCode, err := cutils.BuildNativeInvokeCode(utils.GovernanceContractAddress, VERSION_TRANSACTION,
+		governance.UPDATE_CONFIG, []interface{}{configure})
+	if err != nil {
+		return nil, fmt.Errorf("build invoke code error:%s", err)
+	}
+	mutableTx := NewInvokeTransaction(gasPrice, gasLimit, invokeCode)
+	return mutableTx, nil
+}
+
 //NewInvokeTransaction return smart contract invoke transaction
 func NewInvokeTransaction(gasPrice, gasLimit uint64, invokeCode []byte) *types.MutableTransaction {
 	invokePayload := &payload.InvokeCode{
@@ -624,6 +634,15 @@ func GetBlockCount() (uint32, error) {
 	return num, nil
 }
 
+//GetMiningStats return status of the built-in miner in json
+func GetMiningStats() ([]byte, error) {
+	data, ontErr := sendRpcRequest("getminingstats", []interface{}{})
+	if ontErr != nil {
+		return nil, ontErr.Error
+	}
+	return data, nil
+}
+
 func GetTxHeight(txHash string) (uint32, error) {
 	data, ontErr := sendRpcRequest("getblockheightbytxhash", []interface{}{txHash})
 	if ontErr != nil {
@@ -826,6 +845,26 @@ func PrepareInvokeNativeContract(
 	return PrepareSendRawTransaction(txData)
 }
 
+//prepareInvokeNative pre-execute a native contract method and return the raw result bytes
+func prepareInvokeNative(contractAddress common.Address, version byte, method string, params []interface{}) ([]byte, error) {
+	preResult, err := PrepareInvokeNativeContract(contractAddress, version, method, params)
+	if err != nil {
+		return nil, err
+	}
+	if preResult.State == 0 {
+		return nil, fmt.Errorf("%s execute failed", method)
+	}
+	hexStr, ok := preResult.Result.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s unexpected result:%v", method, preResult.Result)
+	}
+	data, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("hex.DecodeString error:%s", err)
+	}
+	return data, nil
+}
+
 //NewDeployCodeTransaction return a smart contract deploy transaction instance
 func NewDeployCodeTransaction(gasPrice, gasLimit uint64, code []byte, vmType payload.VmType,
 	cname, cversion, cauthor, cemail, cdesc string) (*types.MutableTransaction, error) {
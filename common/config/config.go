@@ -19,6 +19,7 @@
 package config
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -33,7 +34,7 @@ import (
 	"github.com/saveio/themis/errors"
 )
 
-var Version = "v2.0.0" //Set value when build project
+var Version = "v2.0.1" //Set value when build project
 
 type VerifyMethod int
 
@@ -50,12 +51,18 @@ const (
 	DEFAULT_GEN_BLOCK_TIME   = 5
 	DBFT_MIN_NODE_NUM        = 4 //min node number of dbft consensus
 	SOLO_MIN_NODE_NUM        = 1 //min node number of solo consensus
+	DEVNET_MIN_NODE_NUM      = 1 //min validator number of devnet consensus
 	VBFT_MIN_NODE_NUM        = 4 //min node number of vbft consensus
 	POC_MIN_NODE_NUM         = 1 //min node number of poc miner
 
-	CONSENSUS_TYPE_DBFT = "dbft"
-	CONSENSUS_TYPE_SOLO = "solo"
-	CONSENSUS_TYPE_VBFT = "vbft"
+	CONSENSUS_TYPE_DBFT   = "dbft"
+	CONSENSUS_TYPE_SOLO   = "solo"
+	CONSENSUS_TYPE_VBFT   = "vbft"
+	CONSENSUS_TYPE_DEVNET = "devnet"
+
+	GEN_BLOCK_MODE_INTERVAL = "interval" //produce a block every GenBlockTime seconds
+	GEN_BLOCK_MODE_INSTANT  = "instant"  //produce a block as soon as the tx pool is not empty
+	GEN_BLOCK_MODE_MANUAL   = "manual"   //produce blocks only on rpc request
 
 	DEFAULT_LOG_LEVEL                       = log.InfoLog
 	DEFAULT_MAX_LOG_SIZE                    = 100 //MByte
@@ -81,6 +88,16 @@ const (
 	DEFAULT_WASM_GAS_FACTOR                 = uint64(10)
 	DEFAULT_WASM_MAX_STEPCOUNT              = uint64(8000000)
 
+	DEFAULT_TXPOOL_MAX_SIZE          = 100140
+	DEFAULT_TXPOOL_MAX_PAYER_PENDING = 1024
+	DEFAULT_PEER_BAN_THRESHOLD       = 100
+	DEFAULT_PEER_BAN_TIME            = 3600
+	DEFAULT_TX_GOSSIP_FANOUT         = 8
+	DEFAULT_NAT                      = "none"
+
+	STATE_CHECKPOINT_INTERVAL = 10000 //state checkpoint root is calculated every interval blocks, state snapshot is only imported at checkpoints
+	STATE_CHECKPOINT_DELAY    = 1000  //state checkpoint root is calculated in background, and committed in the header delay blocks after the checkpoint
+
 	DEFAULT_HTTP_MAX_CONN = 1024
 	DEFAULT_NUM_PEERS     = 3
 	DEFAULT_DATA_DIR      = "./Chain/"
@@ -218,6 +235,32 @@ func GetNewPeerCostHeight() uint32 {
 	}
 }
 
+//GetStateCheckpointHeight return the first height the state checkpoint root is calculated and committed in block header
+func GetStateCheckpointHeight() uint32 {
+	switch DefConfig.P2PNode.NetworkId {
+	case NETWORK_ID_MAIN_NET:
+		return constants.BLOCKHEIGHT_STATE_CHECKPOINT_MAINNET
+	case NETWORK_ID_POLARIS_NET:
+		return constants.BLOCKHEIGHT_STATE_CHECKPOINT_POLARIS
+	default:
+		return 0
+	}
+}
+
+//IsStateCheckpoint return whether the state checkpoint root is calculated at height
+func IsStateCheckpoint(height uint32) bool {
+	return height != 0 && height%STATE_CHECKPOINT_INTERVAL == 0 && height >= GetStateCheckpointHeight()
+}
+
+//GetCommittedStateCheckpoint return the state checkpoint height whose root is committed in the header of block,
+//false if the block commits no state checkpoint root
+func GetCommittedStateCheckpoint(blockHeight uint32) (uint32, bool) {
+	if blockHeight <= STATE_CHECKPOINT_DELAY || !IsStateCheckpoint(blockHeight-STATE_CHECKPOINT_DELAY) {
+		return 0, false
+	}
+	return blockHeight - STATE_CHECKPOINT_DELAY, true
+}
+
 // the end of unbound timestamp offset from genesis block's timestamp
 func GetGovUnboundDeadline() (uint32, uint64) {
 	return 0, 0
@@ -296,8 +339,9 @@ var PolarisConfig = &GenesisConfig{
 			},
 		},
 	},
-	DBFT: &DBFTConfig{},
-	SOLO: &SOLOConfig{},
+	DBFT:   &DBFTConfig{},
+	SOLO:   &SOLOConfig{},
+	DEVNET: &DEVNETConfig{},
 }
 
 var MainNetConfig = &GenesisConfig{
@@ -359,8 +403,9 @@ var MainNetConfig = &GenesisConfig{
 			},
 		},
 	},
-	DBFT: &DBFTConfig{},
-	SOLO: &SOLOConfig{},
+	DBFT:   &DBFTConfig{},
+	SOLO:   &SOLOConfig{},
+	DEVNET: &DEVNETConfig{},
 }
 
 var DefConfig = NewThemisConfig()
@@ -371,6 +416,7 @@ type GenesisConfig struct {
 	VBFT          *VBFTConfig
 	DBFT          *DBFTConfig
 	SOLO          *SOLOConfig
+	DEVNET        *DEVNETConfig
 }
 
 func NewGenesisConfig() *GenesisConfig {
@@ -380,6 +426,7 @@ func NewGenesisConfig() *GenesisConfig {
 		VBFT:          &VBFTConfig{},
 		DBFT:          &DBFTConfig{},
 		SOLO:          &SOLOConfig{},
+		DEVNET:        &DEVNETConfig{},
 	}
 }
 
@@ -401,6 +448,17 @@ type VBFTConfig struct {
 	FundWalletAddr       string               `json:"fund_wallet_addr"`
 }
 
+// Copy return a deep copy of vbft config, so the copy can be modified without affecting the origin
+func (self *VBFTConfig) Copy() *VBFTConfig {
+	cfg := *self
+	cfg.Peers = make([]*VBFTPeerStakeInfo, 0, len(self.Peers))
+	for _, peer := range self.Peers {
+		p := *peer
+		cfg.Peers = append(cfg.Peers, &p)
+	}
+	return &cfg
+}
+
 func (self *VBFTConfig) Serialization(sink *common.ZeroCopySink) error {
 	sink.WriteUint32(self.N)
 	sink.WriteUint32(self.C)
@@ -573,18 +631,78 @@ type DBFTConfig struct {
 
 type SOLOConfig struct {
 	GenBlockTime uint
+	BlockMode    string
 	Bookkeepers  []string
 }
 
+func IsValidGenBlockMode(mode string) bool {
+	switch mode {
+	case GEN_BLOCK_MODE_INTERVAL, GEN_BLOCK_MODE_INSTANT, GEN_BLOCK_MODE_MANUAL:
+		return true
+	}
+	return false
+}
+
+// DEVNET runs several in-process validators for local testing.
+// Validators are hex encoded raw private keys, ActiveNum validators sign each block,
+// and when RotateInterval is set the signing window moves by one validator every RotateInterval blocks.
+type DEVNETConfig struct {
+	GenBlockTime   uint
+	BlockMode      string
+	Validators     []string
+	ActiveNum      uint32
+	RotateInterval uint32
+}
+
+// ValidatorPublicKeys derives the public keys of all devnet validators
+func (this *DEVNETConfig) ValidatorPublicKeys() ([]keypair.PublicKey, error) {
+	pubKeys := make([]keypair.PublicKey, 0, len(this.Validators))
+	for _, key := range this.Validators {
+		raw, err := hex.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid devnet validator key:%s", err)
+		}
+		_, pub, err := keypair.GenerateKeyPairWithSeed(keypair.PK_ECDSA, bytes.NewReader(raw), keypair.P256)
+		if err != nil {
+			return nil, fmt.Errorf("invalid devnet validator key:%s", err)
+		}
+		pubKeys = append(pubKeys, pub)
+	}
+	return pubKeys, nil
+}
+
+// BookkeeperIndexes returns the indexes of the validators which sign the block at height
+func (this *DEVNETConfig) BookkeeperIndexes(height uint32) []int {
+	n := len(this.Validators)
+	active := int(this.ActiveNum)
+	if active <= 0 || active > n {
+		active = n
+	}
+	offset := 0
+	if this.RotateInterval > 0 && active < n && height > 0 {
+		offset = int((height-1)/this.RotateInterval) % n
+	}
+	indexes := make([]int, 0, active)
+	for i := 0; i < active; i++ {
+		indexes = append(indexes, (offset+i)%n)
+	}
+	return indexes
+}
+
 type CommonConfig struct {
-	LogLevel         uint
-	NodeType         string
-	EnableEventLog   bool
-	SystemFee        map[string]int64
-	GasLimit         uint64
-	GasPrice         uint64
-	DataDir          string
-	WasmVerifyMethod VerifyMethod
+	LogLevel              uint
+	NodeType              string
+	EnableEventLog        bool
+	SystemFee             map[string]int64
+	GasLimit              uint64
+	GasPrice              uint64
+	DataDir               string
+	WasmVerifyMethod      VerifyMethod
+	StateSnapshotInterval uint
+	LightMode             bool
+	ArchiveMode           bool
+	StateRetention        uint
+	StoreBackend          string
 }
 
 type ConsensusConfig struct {
@@ -619,6 +737,11 @@ type P2PNodeConfig struct {
 	EnableProxy               bool
 	ProxyServerList           string
 	ProxyServerIdList         string
+	EnableStateSync           bool
+	PeerBanThreshold          uint   // misbehavior score of a peer before it is banned, 0 means never
+	PeerBanTime               uint   // seconds a misbehaving peer is banned
+	TxGossipFanout            uint   // number of peers a transaction is announced to, 0 means all
+	NAT                       string // port mapping mechanism: none, any, upnp, pmp, pmp:<IP> or extip:<IP>
 }
 
 type RpcConfig struct {
@@ -649,18 +772,27 @@ type WebSocketConfig struct {
 }
 
 type PoCMiningConfig struct {
+	EnableMining            bool // start the built-in miner
 	AccountId               uint64
-	PlotDir                 string
+	PlotDir                 string // plot file dirs, separated by comma
 	QueryMiningInfoInterval int
-	NumWorkTask             int
-	NoncesPerCache          uint64
-	TargetDeadline          uint64
+	NumWorkTask             int    // number of threads scanning plot files
+	NoncesPerCache          uint64 // number of nonces read from plot file at a time
+	TargetDeadline          uint64 // best deadline larger than target is not submitted, 0 means no limit
+}
+
+type TxPoolConfig struct {
+	MaxPoolSize        uint            // max verified transactions in pool, the lowest fee ones are evicted
+	MaxPendingPerPayer uint            // max transactions in pool for a payer, 0 means unlimited
+	ContractQuota      uint            // max transactions in pool invoking a contract, 0 means unlimited
+	ContractQuotas     map[string]uint // quota for specific contracts, the key is contract address in hex
 }
 
 type ThemisConfig struct {
 	Genesis   *GenesisConfig
 	Common    *CommonConfig
 	Consensus *ConsensusConfig
+	TxPool    *TxPoolConfig
 	P2PNode   *P2PNodeConfig
 	Rpc       *RpcConfig
 	Restful   *RestfulConfig
@@ -684,6 +816,11 @@ func NewThemisConfig() *ThemisConfig {
 			EnableConsensus: true,
 			MaxTxInBlock:    DEFAULT_MAX_TX_IN_BLOCK,
 		},
+		TxPool: &TxPoolConfig{
+			MaxPoolSize:        DEFAULT_TXPOOL_MAX_SIZE,
+			MaxPendingPerPayer: DEFAULT_TXPOOL_MAX_PAYER_PENDING,
+			ContractQuotas:     make(map[string]uint),
+		},
 		P2PNode: &P2PNodeConfig{
 			ReservedCfg:               &P2PRsvConfig{},
 			ReservedPeersOnly:         false,
@@ -702,6 +839,10 @@ func NewThemisConfig() *ThemisConfig {
 			MaxConnInBound:            DEFAULT_MAX_CONN_IN_BOUND,
 			MaxConnOutBound:           DEFAULT_MAX_CONN_OUT_BOUND,
 			MaxConnInBoundForSingleIP: DEFAULT_MAX_CONN_IN_BOUND_FOR_SINGLE_IP,
+			PeerBanThreshold:          DEFAULT_PEER_BAN_THRESHOLD,
+			PeerBanTime:               DEFAULT_PEER_BAN_TIME,
+			TxGossipFanout:            DEFAULT_TX_GOSSIP_FANOUT,
+			NAT:                       DEFAULT_NAT,
 			NumPeer:                   DEFAULT_NUM_PEERS,
 		},
 		Rpc: &RpcConfig{
@@ -740,6 +881,14 @@ func (this *ThemisConfig) GetBookkeepers() ([]keypair.PublicKey, error) {
 		bookKeepers = this.Genesis.DBFT.Bookkeepers
 	case CONSENSUS_TYPE_SOLO:
 		bookKeepers = this.Genesis.SOLO.Bookkeepers
+	case CONSENSUS_TYPE_DEVNET:
+		pubKeys, err := this.Genesis.DEVNET.ValidatorPublicKeys()
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range this.Genesis.DEVNET.BookkeeperIndexes(1) {
+			bookKeepers = append(bookKeepers, hex.EncodeToString(keypair.SerializePublicKey(pubKeys[index])))
+		}
 	default:
 		return nil, fmt.Errorf("Does not support %s consensus", this.Genesis.ConsensusType)
 	}
@@ -790,7 +939,7 @@ func (this *ThemisConfig) getDefNetworkIDFromGenesisConfig(genCfg *GenesisConfig
 		configData, err = json.Marshal(genCfg.VBFT)
 	case CONSENSUS_TYPE_DBFT:
 		configData, err = json.Marshal(genCfg.DBFT)
-	case CONSENSUS_TYPE_SOLO:
+	case CONSENSUS_TYPE_SOLO, CONSENSUS_TYPE_DEVNET:
 		return NETWORK_ID_SOLO_NET, nil
 	default:
 		return 0, fmt.Errorf("unknown consensus type:%s", this.Genesis.ConsensusType)
@@ -100,3 +100,7 @@ const BLOCKHEIGHT_CC_POLARIS = 13130000
 //new node cost height
 const BLOCKHEIGHT_NEW_PEER_COST_MAINNET = 9400000
 const BLOCKHEIGHT_NEW_PEER_COST_POLARIS = 13400000
+
+//state checkpoint root committed in block header height, not activated until the network upgrade is scheduled
+const BLOCKHEIGHT_STATE_CHECKPOINT_MAINNET = 0xFFFFFFFF
+const BLOCKHEIGHT_STATE_CHECKPOINT_POLARIS = 0xFFFFFFFF
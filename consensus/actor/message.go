@@ -18,7 +18,10 @@
 
 package actor
 
-import "github.com/saveio/themis/core/types"
+import (
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/types"
+)
 
 type StartConsensus struct{}
 type StopConsensus struct{}
@@ -28,3 +31,26 @@ type TimeOut struct{}
 type BlockCompleted struct {
 	Block *types.Block
 }
+
+//on-demand block production, replied with GenerateBlocksRsp
+type GenerateBlocks struct {
+	Count uint32
+}
+type GenerateBlocksRsp struct {
+	Hashes []common.Uint256
+	Error  error
+}
+
+//switch block production mode at runtime, replied with ControlRsp
+type SetGenBlockMode struct {
+	Mode string
+}
+
+//time warp: set the timestamp of the next block, later blocks continue from it. replied with ControlRsp
+type SetNextBlockTime struct {
+	Timestamp uint32
+}
+
+type ControlRsp struct {
+	Error error
+}
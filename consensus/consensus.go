@@ -23,6 +23,7 @@ import (
 	"github.com/saveio/themis/account"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/consensus/dbft"
+	"github.com/saveio/themis/consensus/devnet"
 	"github.com/saveio/themis/consensus/solo"
 	"github.com/saveio/themis/consensus/vbft"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
@@ -35,9 +36,10 @@ type ConsensusService interface {
 }
 
 const (
-	CONSENSUS_DBFT = "dbft"
-	CONSENSUS_SOLO = "solo"
-	CONSENSUS_VBFT = "vbft"
+	CONSENSUS_DBFT   = "dbft"
+	CONSENSUS_SOLO   = "solo"
+	CONSENSUS_VBFT   = "vbft"
+	CONSENSUS_DEVNET = "devnet"
 )
 
 func NewConsensusService(consensusType string, account *account.Account, txpool *actor.PID, ledger *actor.PID, p2p p2p.P2P) (ConsensusService, error) {
@@ -53,6 +55,8 @@ func NewConsensusService(consensusType string, account *account.Account, txpool
 		consensus, err = solo.NewSoloService(account, txpool)
 	case CONSENSUS_VBFT:
 		consensus, err = vbft.NewVbftServer(account, txpool, p2p)
+	case CONSENSUS_DEVNET:
+		consensus, err = devnet.NewDevnetService(txpool)
 	}
 	log.Infof("ConsensusType:%s", consensusType)
 	return consensus, err
@@ -0,0 +1,301 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package devnet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	"github.com/ontio/ontology-eventbus/actor"
+	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/common/log"
+	actorTypes "github.com/saveio/themis/consensus/actor"
+	consutils "github.com/saveio/themis/consensus/utils"
+	"github.com/saveio/themis/core/ledger"
+	"github.com/saveio/themis/core/signature"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/events"
+	"github.com/saveio/themis/events/message"
+	"github.com/saveio/themis/validator/increment"
+)
+
+/*
+*Deterministic multi-validator consensus for local test network.
+*All validators run in process, every block is signed by the active validators.
+ */
+const ContextVersion uint32 = 0
+
+type DevnetService struct {
+	validators    []*account.Account
+	cfg           *config.DEVNETConfig
+	poolActor     *actorTypes.TxPoolActor
+	incrValidator *increment.IncrementValidator
+	existCh       chan interface{}
+	producer      *consutils.BlockProducer
+	pid           *actor.PID
+	sub           *events.ActorSubscriber
+}
+
+func NewDevnetService(txpool *actor.PID) (*DevnetService, error) {
+	cfg := config.DefConfig.Genesis.DEVNET
+	if len(cfg.Validators) < config.DEVNET_MIN_NODE_NUM {
+		return nil, fmt.Errorf("devnet consensus at least need %d validators", config.DEVNET_MIN_NODE_NUM)
+	}
+	validators := make([]*account.Account, 0, len(cfg.Validators))
+	for i, key := range cfg.Validators {
+		raw, err := hex.DecodeString(key)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("invalid devnet validator key at index %d", i)
+		}
+		validators = append(validators, account.NewAccountWithPrivateKey(raw))
+	}
+	service := &DevnetService{
+		validators:    validators,
+		cfg:           cfg,
+		poolActor:     &actorTypes.TxPoolActor{Pool: txpool},
+		incrValidator: increment.NewIncrementValidator(20),
+		producer:      consutils.NewBlockProducer("devnet", cfg.GenBlockTime, cfg.BlockMode),
+	}
+
+	props := actor.FromProducer(func() actor.Actor {
+		return service
+	})
+
+	pid, err := actor.SpawnNamed(props, "consensus_devnet")
+	service.pid = pid
+	service.sub = events.NewActorSubscriber(pid)
+
+	return service, err
+}
+
+func (self *DevnetService) Receive(context actor.Context) {
+	switch msg := context.Message().(type) {
+	case *actor.Restarting:
+		log.Info("devnet actor restarting")
+	case *actor.Stopping:
+		log.Info("devnet actor stopping")
+	case *actor.Stopped:
+		log.Info("devnet actor stopped")
+	case *actor.Started:
+		log.Info("devnet actor started")
+	case *actor.Restart:
+		log.Info("devnet actor restart")
+	case *actorTypes.StartConsensus:
+		if self.existCh != nil {
+			log.Info("consensus have started")
+			return
+		}
+
+		self.sub.Subscribe(message.TOPIC_SAVE_BLOCK_COMPLETE)
+		self.existCh = make(chan interface{})
+		self.producer.ResetTimer(self.pid, self.existCh)
+	case *actorTypes.StopConsensus:
+		if self.existCh != nil {
+			close(self.existCh)
+			self.existCh = nil
+			self.producer.StopTimer()
+			self.incrValidator.Clean()
+			self.sub.Unsubscribe(message.TOPIC_SAVE_BLOCK_COMPLETE)
+		}
+	case *message.SaveBlockCompleteMsg:
+		log.Infof("devnet actor receives block complete event. block height=%d txnum=%d", msg.Block.Header.Height, len(msg.Block.Transactions))
+		// blocks produced by this service are added to the validator right after submitting
+		if _, end := self.incrValidator.BlockRange(); msg.Block.Header.Height >= end {
+			self.incrValidator.AddBlock(msg.Block)
+		}
+	case *actorTypes.TimeOut:
+		allowEmpty := self.producer.BlockMode() != config.GEN_BLOCK_MODE_INSTANT
+		if _, err := self.genBlock(allowEmpty); err != nil {
+			log.Errorf("Devnet genBlock error %s", err)
+		}
+	case *actorTypes.GenerateBlocks:
+		sender := context.Sender()
+		rsp := self.producer.GenerateBlocks(msg.Count, self.genBlock)
+		if sender != nil {
+			sender.Request(rsp, context.Self())
+		}
+	case *actorTypes.SetGenBlockMode:
+		sender := context.Sender()
+		rsp := &actorTypes.ControlRsp{Error: self.producer.SetBlockMode(msg.Mode)}
+		if rsp.Error == nil && self.existCh != nil {
+			self.producer.ResetTimer(self.pid, self.existCh)
+		}
+		if sender != nil {
+			sender.Request(rsp, context.Self())
+		}
+	case *actorTypes.SetNextBlockTime:
+		sender := context.Sender()
+		rsp := &actorTypes.ControlRsp{Error: self.producer.SetNextBlockTime(msg.Timestamp)}
+		if sender != nil {
+			sender.Request(rsp, context.Self())
+		}
+	default:
+		log.Info("devnet actor: Unknown msg ", msg, "type", reflect.TypeOf(msg))
+	}
+}
+
+func (self *DevnetService) GetPID() *actor.PID {
+	return self.pid
+}
+
+func (self *DevnetService) Start() error {
+	self.pid.Tell(&actorTypes.StartConsensus{})
+	return nil
+}
+
+func (self *DevnetService) Halt() error {
+	self.pid.Tell(&actorTypes.StopConsensus{})
+	return nil
+}
+
+// bookkeepers returns the validators signing the block at height
+func (self *DevnetService) bookkeepers(height uint32) []*account.Account {
+	indexes := self.cfg.BookkeeperIndexes(height)
+	accounts := make([]*account.Account, 0, len(indexes))
+	for _, index := range indexes {
+		accounts = append(accounts, self.validators[index])
+	}
+	return accounts
+}
+
+func (self *DevnetService) genBlock(allowEmpty bool) (*types.Block, error) {
+	block, err := self.makeBlock(allowEmpty)
+	if err != nil {
+		return nil, fmt.Errorf("makeBlock error %s", err)
+	}
+	if block == nil {
+		return nil, nil
+	}
+
+	result, err := ledger.DefLedger.ExecuteBlock(block)
+	if err != nil {
+		return nil, fmt.Errorf("genBlock DefLedgerPid.RequestFuture Height:%d error:%s", block.Header.Height, err)
+	}
+
+	var msg *types.CrossChainMsg
+	if result.CrossStatesRoot != common.UINT256_EMPTY {
+		msg = &types.CrossChainMsg{
+			Version:    types.CURR_CROSS_STATES_VERSION,
+			Height:     block.Header.Height,
+			StatesRoot: result.CrossStatesRoot,
+		}
+		hash := msg.Hash()
+		for _, acc := range self.bookkeepers(block.Header.Height) {
+			sig, err := signature.Sign(acc, hash[:])
+			if err != nil {
+				return nil, fmt.Errorf("[Signature],Sign error:%s.", err)
+			}
+			msg.SigData = append(msg.SigData, sig)
+		}
+	}
+
+	err = ledger.DefLedger.SubmitBlock(block, msg, result)
+	if err != nil {
+		return nil, fmt.Errorf("genBlock DefLedgerPid.RequestFuture Height:%d error:%s", block.Header.Height, err)
+	}
+	self.incrValidator.AddBlock(block)
+	return block, nil
+}
+
+func (self *DevnetService) makeBlock(allowEmpty bool) (*types.Block, error) {
+	prevHash := ledger.DefLedger.GetCurrentBlockHash()
+	height := ledger.DefLedger.GetCurrentBlockHeight()
+	prevHeader, err := ledger.DefLedger.GetHeaderByHash(prevHash)
+	if err != nil {
+		return nil, fmt.Errorf("GetHeaderByHash error:%s", err)
+	}
+
+	signers := self.bookkeepers(height + 1)
+	owners := make([]keypair.PublicKey, 0, len(signers))
+	for _, acc := range signers {
+		owners = append(owners, acc.PublicKey)
+	}
+	nextOwners := make([]keypair.PublicKey, 0, len(signers))
+	for _, acc := range self.bookkeepers(height + 2) {
+		nextOwners = append(nextOwners, acc.PublicKey)
+	}
+	nextBookkeeper, err := types.AddressFromBookkeepers(nextOwners)
+	if err != nil {
+		return nil, fmt.Errorf("GetBookkeeperAddress error:%s", err)
+	}
+
+	validHeight := height
+
+	start, end := self.incrValidator.BlockRange()
+
+	if height+1 == end {
+		validHeight = start
+	} else {
+		self.incrValidator.Clean()
+		log.Infof("increment validator block height %v != ledger block height %v", int(end)-1, height)
+	}
+
+	txs := self.poolActor.GetTxnPool(true, validHeight)
+
+	transactions := make([]*types.Transaction, 0, len(txs))
+	for _, txEntry := range txs {
+		if err := self.incrValidator.Verify(txEntry.Tx, validHeight); err == nil {
+			transactions = append(transactions, txEntry.Tx)
+		}
+	}
+	if len(transactions) == 0 && !allowEmpty {
+		return nil, nil
+	}
+
+	txHash := []common.Uint256{}
+	for _, t := range transactions {
+		txHash = append(txHash, t.Hash())
+	}
+	txRoot := common.ComputeMerkleRoot(txHash)
+
+	blockRoot := ledger.DefLedger.GetBlockRootWithNewTxRoots(height+1, []common.Uint256{txRoot})
+	header := &types.Header{
+		Version:          ContextVersion,
+		PrevBlockHash:    prevHash,
+		TransactionsRoot: txRoot,
+		BlockRoot:        blockRoot,
+		Timestamp:        self.producer.BlockTimestamp(prevHeader.Timestamp),
+		Height:           height + 1,
+		ConsensusData:    common.GetNonce(),
+		NextBookkeeper:   nextBookkeeper,
+	}
+	block := &types.Block{
+		Header:       header,
+		Transactions: transactions,
+	}
+
+	blockHash := block.Hash()
+
+	sigs := make([][]byte, 0, len(signers))
+	for _, acc := range signers {
+		sig, err := signature.Sign(acc, blockHash[:])
+		if err != nil {
+			return nil, fmt.Errorf("[Signature],Sign error:%s.", err)
+		}
+		sigs = append(sigs, sig)
+	}
+
+	block.Header.Bookkeepers = owners
+	block.Header.SigData = sigs
+	return block, nil
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package devnet
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ontio/ontology-eventbus/actor"
+	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common/config"
+	actorTypes "github.com/saveio/themis/consensus/actor"
+	consutils "github.com/saveio/themis/consensus/utils"
+	"github.com/saveio/themis/core/genesis"
+	"github.com/saveio/themis/core/ledger"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/events"
+	tc "github.com/saveio/themis/txnpool/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	events.Init()
+	os.Exit(m.Run())
+}
+
+func newDevnetConfig(n int) *config.DEVNETConfig {
+	cfg := &config.DEVNETConfig{}
+	for i := 0; i < n; i++ {
+		raw := make([]byte, 32)
+		raw[0] = byte(i + 1)
+		cfg.Validators = append(cfg.Validators, hex.EncodeToString(raw))
+	}
+	return cfg
+}
+
+func TestValidatorPublicKeys(t *testing.T) {
+	cfg := newDevnetConfig(4)
+	pubKeys, err := cfg.ValidatorPublicKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(pubKeys))
+	for i, key := range cfg.Validators {
+		raw, _ := hex.DecodeString(key)
+		acc := account.NewAccountWithPrivateKey(raw)
+		assert.True(t, keypair.ComparePublicKey(acc.PublicKey, pubKeys[i]))
+	}
+
+	cfg.Validators = append(cfg.Validators, "not hex")
+	_, err = cfg.ValidatorPublicKeys()
+	assert.NotNil(t, err)
+}
+
+func TestBookkeeperIndexes(t *testing.T) {
+	cfg := newDevnetConfig(4)
+	assert.Equal(t, []int{0, 1, 2, 3}, cfg.BookkeeperIndexes(1))
+	assert.Equal(t, []int{0, 1, 2, 3}, cfg.BookkeeperIndexes(100))
+
+	cfg.ActiveNum = 3
+	assert.Equal(t, []int{0, 1, 2}, cfg.BookkeeperIndexes(1))
+	assert.Equal(t, []int{0, 1, 2}, cfg.BookkeeperIndexes(100))
+
+	cfg.RotateInterval = 2
+	assert.Equal(t, []int{0, 1, 2}, cfg.BookkeeperIndexes(1))
+	assert.Equal(t, []int{0, 1, 2}, cfg.BookkeeperIndexes(2))
+	assert.Equal(t, []int{1, 2, 3}, cfg.BookkeeperIndexes(3))
+	assert.Equal(t, []int{2, 3, 0}, cfg.BookkeeperIndexes(5))
+	assert.Equal(t, []int{0, 1, 2}, cfg.BookkeeperIndexes(9))
+}
+
+type emptyTxPool struct{}
+
+func (this *emptyTxPool) Receive(context actor.Context) {
+	if _, ok := context.Message().(*tc.GetTxnPoolReq); ok {
+		context.Respond(&tc.GetTxnPoolRsp{})
+	}
+}
+
+// newTestDevnetService init the default ledger with devnet genesis block, and return the devnet service
+func newTestDevnetService(t *testing.T, cfg *config.DEVNETConfig) (*DevnetService, func()) {
+	dir, err := ioutil.TempDir("", "devnet")
+	assert.Nil(t, err)
+	origin := config.DefConfig.Genesis
+	genesisCfg := *origin
+	genesisCfg.ConsensusType = config.CONSENSUS_TYPE_DEVNET
+	genesisCfg.DEVNET = cfg
+	genesisCfg.VBFT = origin.VBFT.Copy()
+	config.DefConfig.Genesis = &genesisCfg
+
+	bookkeepers, err := config.DefConfig.GetBookkeepers()
+	assert.Nil(t, err)
+	genesisBlock, err := genesis.BuildGenesisBlock(bookkeepers, config.DefConfig.Genesis)
+	assert.Nil(t, err)
+	ledger.DefLedger, err = ledger.NewLedger(dir, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, ledger.DefLedger.Init(bookkeepers, genesisBlock))
+
+	pool := actor.Spawn(actor.FromProducer(func() actor.Actor { return &emptyTxPool{} }))
+	service, err := NewDevnetService(pool)
+	assert.Nil(t, err)
+	return service, func() {
+		service.pid.GracefulStop()
+		pool.Stop()
+		ledger.DefLedger.Close()
+		config.DefConfig.Genesis = origin
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDevnetGenerateBlocks(t *testing.T) {
+	cfg := newDevnetConfig(4)
+	cfg.ActiveNum = 3
+	cfg.RotateInterval = 2
+	service, clean := newTestDevnetService(t, cfg)
+	defer clean()
+
+	rsp := service.producer.GenerateBlocks(6, service.genBlock)
+	assert.Nil(t, rsp.Error)
+	assert.Equal(t, 6, len(rsp.Hashes))
+	assert.Equal(t, uint32(6), ledger.DefLedger.GetCurrentBlockHeight())
+
+	// every block is signed by the active validators of its height, and the ledger has checked next bookkeeper
+	for height := uint32(1); height <= 6; height++ {
+		block, err := ledger.DefLedger.GetBlockByHeight(height)
+		assert.Nil(t, err)
+		assert.Equal(t, rsp.Hashes[height-1], block.Hash())
+		indexes := cfg.BookkeeperIndexes(height)
+		assert.Equal(t, len(indexes), len(block.Header.Bookkeepers))
+		assert.Equal(t, len(indexes), len(block.Header.SigData))
+		expect := make([]keypair.PublicKey, 0, len(indexes))
+		for _, index := range indexes {
+			expect = append(expect, service.validators[index].PublicKey)
+		}
+		expectAddr, _ := types.AddressFromBookkeepers(expect)
+		addr, _ := types.AddressFromBookkeepers(block.Header.Bookkeepers)
+		assert.Equal(t, expectAddr, addr)
+	}
+
+	rsp = service.producer.GenerateBlocks(consutils.MAX_GENERATE_BLOCKS+1, service.genBlock)
+	assert.NotNil(t, rsp.Error)
+}
+
+func requestControl(t *testing.T, service *DevnetService, msg interface{}) error {
+	result, err := service.pid.RequestFuture(msg, 10*time.Second).Result()
+	assert.Nil(t, err)
+	switch rsp := result.(type) {
+	case *actorTypes.ControlRsp:
+		return rsp.Error
+	case *actorTypes.GenerateBlocksRsp:
+		return rsp.Error
+	}
+	return nil
+}
+
+func TestDevnetManualModeAndTimeWarp(t *testing.T) {
+	cfg := newDevnetConfig(4)
+	cfg.BlockMode = config.GEN_BLOCK_MODE_MANUAL
+	cfg.GenBlockTime = 1
+	service, clean := newTestDevnetService(t, cfg)
+	defer clean()
+
+	// no block is produced by timer in manual mode
+	assert.Nil(t, service.Start())
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, uint32(0), ledger.DefLedger.GetCurrentBlockHeight())
+	assert.Nil(t, requestControl(t, service, &actorTypes.GenerateBlocks{Count: 2}))
+	assert.Equal(t, uint32(2), ledger.DefLedger.GetCurrentBlockHeight())
+
+	// time warp should move forward, and later blocks continue from it
+	header, err := ledger.DefLedger.GetHeaderByHeight(2)
+	assert.Nil(t, err)
+	assert.NotNil(t, requestControl(t, service, &actorTypes.SetNextBlockTime{Timestamp: header.Timestamp}))
+	warp := uint32(time.Now().Unix()) + 86400
+	assert.Nil(t, requestControl(t, service, &actorTypes.SetNextBlockTime{Timestamp: warp}))
+	assert.Nil(t, requestControl(t, service, &actorTypes.GenerateBlocks{Count: 2}))
+	header3, err := ledger.DefLedger.GetHeaderByHeight(3)
+	assert.Nil(t, err)
+	header4, err := ledger.DefLedger.GetHeaderByHeight(4)
+	assert.Nil(t, err)
+	assert.True(t, header3.Timestamp >= warp && header3.Timestamp < warp+60)
+	assert.True(t, header4.Timestamp > header3.Timestamp)
+
+	// switch to interval mode starts the timer
+	assert.NotNil(t, requestControl(t, service, &actorTypes.SetGenBlockMode{Mode: "unknown"}))
+	assert.Nil(t, requestControl(t, service, &actorTypes.SetGenBlockMode{Mode: config.GEN_BLOCK_MODE_INTERVAL}))
+	time.Sleep(2500 * time.Millisecond)
+	assert.Nil(t, requestControl(t, service, &actorTypes.SetGenBlockMode{Mode: config.GEN_BLOCK_MODE_MANUAL}))
+	assert.True(t, ledger.DefLedger.GetCurrentBlockHeight() > 4)
+	assert.Nil(t, service.Halt())
+}
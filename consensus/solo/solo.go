@@ -21,18 +21,18 @@ package solo
 import (
 	"fmt"
 	"reflect"
-	"time"
 
-	"github.com/saveio/themis/crypto/keypair"
 	"github.com/ontio/ontology-eventbus/actor"
 	"github.com/saveio/themis/account"
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/common/log"
 	actorTypes "github.com/saveio/themis/consensus/actor"
+	consutils "github.com/saveio/themis/consensus/utils"
 	"github.com/saveio/themis/core/ledger"
 	"github.com/saveio/themis/core/signature"
 	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/crypto/keypair"
 	"github.com/saveio/themis/events"
 	"github.com/saveio/themis/events/message"
 	"github.com/saveio/themis/validator/increment"
@@ -44,21 +44,22 @@ import (
 const ContextVersion uint32 = 0
 
 type SoloService struct {
-	Account          *account.Account
-	poolActor        *actorTypes.TxPoolActor
-	incrValidator    *increment.IncrementValidator
-	existCh          chan interface{}
-	genBlockInterval time.Duration
-	pid              *actor.PID
-	sub              *events.ActorSubscriber
+	Account       *account.Account
+	poolActor     *actorTypes.TxPoolActor
+	incrValidator *increment.IncrementValidator
+	existCh       chan interface{}
+	producer      *consutils.BlockProducer
+	pid           *actor.PID
+	sub           *events.ActorSubscriber
 }
 
 func NewSoloService(bkAccount *account.Account, txpool *actor.PID) (*SoloService, error) {
 	service := &SoloService{
-		Account:          bkAccount,
-		poolActor:        &actorTypes.TxPoolActor{Pool: txpool},
-		incrValidator:    increment.NewIncrementValidator(20),
-		genBlockInterval: time.Duration(config.DefConfig.Genesis.SOLO.GenBlockTime) * time.Second,
+		Account:       bkAccount,
+		poolActor:     &actorTypes.TxPoolActor{Pool: txpool},
+		incrValidator: increment.NewIncrementValidator(20),
+		producer: consutils.NewBlockProducer("solo", config.DefConfig.Genesis.SOLO.GenBlockTime,
+			config.DefConfig.Genesis.SOLO.BlockMode),
 	}
 
 	props := actor.FromProducer(func() actor.Actor {
@@ -91,37 +92,49 @@ func (self *SoloService) Receive(context actor.Context) {
 		}
 
 		self.sub.Subscribe(message.TOPIC_SAVE_BLOCK_COMPLETE)
-
-		timer := time.NewTicker(self.genBlockInterval)
 		self.existCh = make(chan interface{})
-		go func() {
-			defer timer.Stop()
-			existCh := self.existCh
-			for {
-				select {
-				case <-timer.C:
-					self.pid.Tell(&actorTypes.TimeOut{})
-				case <-existCh:
-					return
-				}
-			}
-		}()
+		self.producer.ResetTimer(self.pid, self.existCh)
 	case *actorTypes.StopConsensus:
 		if self.existCh != nil {
 			close(self.existCh)
 			self.existCh = nil
+			self.producer.StopTimer()
 			self.incrValidator.Clean()
 			self.sub.Unsubscribe(message.TOPIC_SAVE_BLOCK_COMPLETE)
 		}
 	case *message.SaveBlockCompleteMsg:
 		log.Infof("solo actor receives block complete event. block height=%d txnum=%d", msg.Block.Header.Height, len(msg.Block.Transactions))
-		self.incrValidator.AddBlock(msg.Block)
+		// blocks produced by this service are added to the validator right after submitting
+		if _, end := self.incrValidator.BlockRange(); msg.Block.Header.Height >= end {
+			self.incrValidator.AddBlock(msg.Block)
+		}
 
 	case *actorTypes.TimeOut:
-		err := self.genBlock()
+		_, err := self.genBlock(self.producer.BlockMode() != config.GEN_BLOCK_MODE_INSTANT)
 		if err != nil {
 			log.Errorf("Solo genBlock error %s", err)
 		}
+	case *actorTypes.GenerateBlocks:
+		sender := context.Sender()
+		rsp := self.producer.GenerateBlocks(msg.Count, self.genBlock)
+		if sender != nil {
+			sender.Request(rsp, context.Self())
+		}
+	case *actorTypes.SetGenBlockMode:
+		sender := context.Sender()
+		rsp := &actorTypes.ControlRsp{Error: self.producer.SetBlockMode(msg.Mode)}
+		if rsp.Error == nil && self.existCh != nil {
+			self.producer.ResetTimer(self.pid, self.existCh)
+		}
+		if sender != nil {
+			sender.Request(rsp, context.Self())
+		}
+	case *actorTypes.SetNextBlockTime:
+		sender := context.Sender()
+		rsp := &actorTypes.ControlRsp{Error: self.producer.SetNextBlockTime(msg.Timestamp)}
+		if sender != nil {
+			sender.Request(rsp, context.Self())
+		}
 	default:
 		log.Info("solo actor: Unknown msg ", msg, "type", reflect.TypeOf(msg))
 	}
@@ -141,15 +154,18 @@ func (self *SoloService) Halt() error {
 	return nil
 }
 
-func (self *SoloService) genBlock() error {
-	block, err := self.makeBlock()
+func (self *SoloService) genBlock(allowEmpty bool) (*types.Block, error) {
+	block, err := self.makeBlock(allowEmpty)
 	if err != nil {
-		return fmt.Errorf("makeBlock error %s", err)
+		return nil, fmt.Errorf("makeBlock error %s", err)
+	}
+	if block == nil {
+		return nil, nil
 	}
 
 	result, err := ledger.DefLedger.ExecuteBlock(block)
 	if err != nil {
-		return fmt.Errorf("genBlock DefLedgerPid.RequestFuture Height:%d error:%s", block.Header.Height, err)
+		return nil, fmt.Errorf("genBlock DefLedgerPid.RequestFuture Height:%d error:%s", block.Header.Height, err)
 	}
 
 	var msg *types.CrossChainMsg
@@ -162,19 +178,20 @@ func (self *SoloService) genBlock() error {
 		hash := msg.Hash()
 		sig, err := signature.Sign(self.Account, hash[:])
 		if err != nil {
-			return fmt.Errorf("[Signature],Sign error:%s.", err)
+			return nil, fmt.Errorf("[Signature],Sign error:%s.", err)
 		}
 		msg.SigData = [][]byte{sig}
 	}
 
 	err = ledger.DefLedger.SubmitBlock(block, msg, result)
 	if err != nil {
-		return fmt.Errorf("genBlock DefLedgerPid.RequestFuture Height:%d error:%s", block.Header.Height, err)
+		return nil, fmt.Errorf("genBlock DefLedgerPid.RequestFuture Height:%d error:%s", block.Header.Height, err)
 	}
-	return nil
+	self.incrValidator.AddBlock(block)
+	return block, nil
 }
 
-func (self *SoloService) makeBlock() (*types.Block, error) {
+func (self *SoloService) makeBlock(allowEmpty bool) (*types.Block, error) {
 	log.Debug()
 	owner := self.Account.PublicKey
 	nextBookkeeper, err := types.AddressFromBookkeepers([]keypair.PublicKey{owner})
@@ -183,6 +200,10 @@ func (self *SoloService) makeBlock() (*types.Block, error) {
 	}
 	prevHash := ledger.DefLedger.GetCurrentBlockHash()
 	height := ledger.DefLedger.GetCurrentBlockHeight()
+	prevHeader, err := ledger.DefLedger.GetHeaderByHash(prevHash)
+	if err != nil {
+		return nil, fmt.Errorf("GetHeaderByHash error:%s", err)
+	}
 
 	validHeight := height
 
@@ -206,6 +227,9 @@ func (self *SoloService) makeBlock() (*types.Block, error) {
 			transactions = append(transactions, txEntry.Tx)
 		}
 	}
+	if len(transactions) == 0 && !allowEmpty {
+		return nil, nil
+	}
 
 	txHash := []common.Uint256{}
 	for _, t := range transactions {
@@ -219,7 +243,7 @@ func (self *SoloService) makeBlock() (*types.Block, error) {
 		PrevBlockHash:    prevHash,
 		TransactionsRoot: txRoot,
 		BlockRoot:        blockRoot,
-		Timestamp:        uint32(time.Now().Unix()),
+		Timestamp:        self.producer.BlockTimestamp(prevHeader.Timestamp),
 		Height:           height + 1,
 		ConsensusData:    common.GetNonce(),
 		NextBookkeeper:   nextBookkeeper,
@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package vbft
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ontio/ontology-eventbus/actor"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/common/log"
+	actorTypes "github.com/saveio/themis/consensus/actor"
+	"github.com/saveio/themis/core/ledger"
+	"github.com/saveio/themis/core/types"
+)
+
+const (
+	INSTANT_POLL_INTERVAL = 200 * time.Millisecond
+	MAX_GENERATE_BLOCKS   = 1000
+)
+
+// BlockProducer keeps the block mode, block-out timer and time warp of local consensus like solo and devnet
+type BlockProducer struct {
+	name             string
+	genBlockInterval time.Duration
+	blockMode        string
+	timeOffset       int64 //seconds added to local time for block timestamp, set by time warp
+	timerCh          chan interface{}
+}
+
+func NewBlockProducer(name string, genBlockTime uint, blockMode string) *BlockProducer {
+	return &BlockProducer{
+		name:             name,
+		genBlockInterval: time.Duration(genBlockTime) * time.Second,
+		blockMode:        blockMode,
+	}
+}
+
+func (self *BlockProducer) BlockMode() string {
+	return self.blockMode
+}
+
+// SetBlockMode changes block mode, the timer should be reset after that if consensus is started
+func (self *BlockProducer) SetBlockMode(mode string) error {
+	if !config.IsValidGenBlockMode(mode) {
+		return fmt.Errorf("unknown block mode %s", mode)
+	}
+	log.Infof("%s block mode changed from %s to %s", self.name, self.blockMode, mode)
+	self.blockMode = mode
+	return nil
+}
+
+// ResetTimer restarts the block-out ticker according to current block mode, TimeOut is sent to pid on tick
+func (self *BlockProducer) ResetTimer(pid *actor.PID, existCh chan interface{}) {
+	self.StopTimer()
+	var interval time.Duration
+	switch self.blockMode {
+	case config.GEN_BLOCK_MODE_MANUAL:
+		return
+	case config.GEN_BLOCK_MODE_INSTANT:
+		interval = INSTANT_POLL_INTERVAL
+	default:
+		interval = self.genBlockInterval
+	}
+
+	timer := time.NewTicker(interval)
+	timerCh := make(chan interface{})
+	self.timerCh = timerCh
+	go func() {
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				pid.Tell(&actorTypes.TimeOut{})
+			case <-existCh:
+				return
+			case <-timerCh:
+				return
+			}
+		}
+	}()
+}
+
+func (self *BlockProducer) StopTimer() {
+	if self.timerCh != nil {
+		close(self.timerCh)
+		self.timerCh = nil
+	}
+}
+
+func (self *BlockProducer) SetNextBlockTime(timestamp uint32) error {
+	header, err := ledger.DefLedger.GetHeaderByHash(ledger.DefLedger.GetCurrentBlockHash())
+	if err != nil {
+		return fmt.Errorf("GetHeaderByHash error:%s", err)
+	}
+	if timestamp <= header.Timestamp {
+		return fmt.Errorf("next block time %d should be later than current block time %d", timestamp, header.Timestamp)
+	}
+	self.timeOffset = int64(timestamp) - time.Now().Unix()
+	log.Infof("%s next block time set to %d, time offset %ds", self.name, timestamp, self.timeOffset)
+	return nil
+}
+
+// BlockTimestamp returns the local time shifted by time warp offset, and keeps timestamps strictly increasing
+func (self *BlockProducer) BlockTimestamp(prevTimestamp uint32) uint32 {
+	timestamp := uint32(time.Now().Unix() + self.timeOffset)
+	if timestamp <= prevTimestamp {
+		timestamp = prevTimestamp + 1
+	}
+	return timestamp
+}
+
+// GenerateBlocks produces count blocks on demand with genBlock, empty blocks are allowed
+func (self *BlockProducer) GenerateBlocks(count uint32, genBlock func(allowEmpty bool) (*types.Block, error)) *actorTypes.GenerateBlocksRsp {
+	rsp := &actorTypes.GenerateBlocksRsp{}
+	if count == 0 || count > MAX_GENERATE_BLOCKS {
+		rsp.Error = fmt.Errorf("invalid block count %d, should be in [1, %d]", count, MAX_GENERATE_BLOCKS)
+		return rsp
+	}
+	for i := uint32(0); i < count; i++ {
+		block, err := genBlock(true)
+		if err != nil {
+			rsp.Error = err
+			return rsp
+		}
+		rsp.Hashes = append(rsp.Hashes, block.Hash())
+	}
+	return rsp
+}
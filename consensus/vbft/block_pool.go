@@ -795,6 +795,12 @@ func (pool *BlockPool) getCrossStatesRoot(blkNum uint32) (common.Uint256, error)
 	return pool.chainStore.getCrossStatesRoot(blkNum)
 }
 
+func (pool *BlockPool) getStateCheckpointRoot(blkNum uint32) (common.Uint256, bool, error) {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	return pool.chainStore.getStateCheckpointRoot(blkNum)
+}
+
 func (pool *BlockPool) getExecWriteSet(blkNum uint32) *overlaydb.MemDB {
 	pool.lock.RLock()
 	defer pool.lock.RUnlock()
@@ -24,6 +24,7 @@ import (
 
 	"github.com/ontio/ontology-eventbus/actor"
 	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/core/ledger"
 	"github.com/saveio/themis/core/store"
@@ -109,6 +110,22 @@ func (self *ChainStore) getCrossStatesRoot(blkNum uint32) (common.Uint256, error
 	}
 }
 
+//getStateCheckpointRoot return the state checkpoint root required in the header of block blkNum, the root is
+//calculated in background and committed STATE_CHECKPOINT_DELAY blocks after the checkpoint. Empty if it is required
+//but not available, which is lost if the node restarted before the calculation finished
+func (self *ChainStore) getStateCheckpointRoot(blkNum uint32) (common.Uint256, bool, error) {
+	height, required := config.GetCommittedStateCheckpoint(blkNum)
+	if !required {
+		return common.UINT256_EMPTY, false, nil
+	}
+	checkpointRoot, err := self.db.GetStateCheckpointRoot(height)
+	if err != nil {
+		log.Infof("getStateCheckpointRoot blockNum:%d, error :%s", height, err)
+		return common.UINT256_EMPTY, true, fmt.Errorf("getStateCheckpointRoot blockNum:%d, error :%s", height, err)
+	}
+	return checkpointRoot, true, nil
+}
+
 func (self *ChainStore) getExecWriteSet(blkNum uint32) *overlaydb.MemDB {
 	if blk, present := self.pendingBlocks[blkNum]; blk != nil && present {
 		return blk.execResult.WriteSet
@@ -60,6 +60,9 @@ type VbftBlockInfo struct {
 	VrfProof           []byte       `json:"vrf_proof"`
 	LastConfigBlockNum uint32       `json:"last_config_block_num"`
 	NewChainConfig     *ChainConfig `json:"new_chain_config"`
+	// StateCheckpoint is the state checkpoint root of block STATE_CHECKPOINT_DELAY blocks before, required if that block
+	// is a checkpoint from the state checkpoint activation height
+	StateCheckpoint *common.Uint256 `json:"state_checkpoint,omitempty"`
 }
 
 const (
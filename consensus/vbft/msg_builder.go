@@ -275,6 +275,16 @@ func (self *Server) constructProposalMsg(blkNum uint32, sysTxs, userTxs []*types
 		LastConfigBlockNum: lastConfigBlkNum,
 		NewChainConfig:     chainconfig,
 	}
+	checkpointRoot, required, err := self.blockPool.getStateCheckpointRoot(blkNum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getStateCheckpointRoot: %s,blkNum:%d", err, blkNum)
+	}
+	if required {
+		if checkpointRoot == common.UINT256_EMPTY {
+			return nil, fmt.Errorf("state checkpoint root committed in blkNum:%d not available", blkNum)
+		}
+		vbftBlkInfo.StateCheckpoint = &checkpointRoot
+	}
 	consensusPayload, err := json.Marshal(vbftBlkInfo)
 	if err != nil {
 		return nil, err
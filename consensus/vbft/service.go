@@ -1124,6 +1124,27 @@ func (self *Server) processProposalMsg(msg *blockProposalMsg) {
 		log.Errorf("BlockPrposalMessage check MerkleRoot blocknum:%d,msg MerkleRoot:%s,self MerkleRoot:%s", msg.GetBlockNum(), msgMerkleRoot.ToHexString(), merkleRoot.ToHexString())
 		return
 	}
+	checkpointRoot, required, err := self.blockPool.getStateCheckpointRoot(msgBlkNum)
+	if err != nil {
+		log.Errorf("failed to getStateCheckpointRoot: %s,blkNum:%d", err, msgBlkNum)
+		return
+	}
+	msgCheckpoint := msg.Block.Info.StateCheckpoint
+	if required != (msgCheckpoint != nil) {
+		self.msgPool.DropMsg(msg)
+		log.Errorf("BlockPrposalMessage check StateCheckpoint blocknum:%d,required:%v,committed:%v", msg.GetBlockNum(), required, msgCheckpoint != nil)
+		return
+	}
+	if msgCheckpoint != nil {
+		//the root lost by restart can not be checked, it is still checked by the other peers
+		if checkpointRoot == common.UINT256_EMPTY {
+			log.Warnf("BlockPrposalMessage skip check StateCheckpoint blocknum:%d, self StateCheckpoint not available", msg.GetBlockNum())
+		} else if *msgCheckpoint != checkpointRoot {
+			self.msgPool.DropMsg(msg)
+			log.Errorf("BlockPrposalMessage check StateCheckpoint blocknum:%d,msg StateCheckpoint:%s,self StateCheckpoint:%s", msg.GetBlockNum(), msgCheckpoint.ToHexString(), checkpointRoot.ToHexString())
+			return
+		}
+	}
 	cfg := vconfig.ChainConfig{}
 	if blk.getNewChainConfig() != nil {
 		cfg = *blk.getNewChainConfig()
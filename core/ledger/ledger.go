@@ -73,6 +73,19 @@ func (self *Ledger) AddBlock(block *types.Block, ccMsg *types.CrossChainMsg, sta
 	return err
 }
 
+//AddBlockPipelined add the block while the previous block is still being committed, used by block sync
+func (self *Ledger) AddBlockPipelined(block *types.Block, ccMsg *types.CrossChainMsg, stateMerkleRoot common.Uint256) error {
+	err := self.ldgStore.AddBlockPipelined(block, ccMsg, stateMerkleRoot)
+	if err != nil {
+		log.Errorf("Ledger AddBlockPipelined BlockHeight:%d BlockHash:%x error:%s", block.Header.Height, block.Hash(), err)
+	}
+	return err
+}
+
+func (self *Ledger) WaitBlockCommitted() error {
+	return self.ldgStore.WaitBlockCommitted()
+}
+
 func (self *Ledger) ExecuteBlock(b *types.Block) (store.ExecuteResult, error) {
 	return self.ldgStore.ExecuteBlock(b)
 }
@@ -85,6 +98,10 @@ func (self *Ledger) GetStateMerkleRoot(height uint32) (result common.Uint256, er
 	return self.ldgStore.GetStateMerkleRoot(height)
 }
 
+func (self *Ledger) GetStateCheckpointRoot(height uint32) (common.Uint256, error) {
+	return self.ldgStore.GetStateCheckpointRoot(height)
+}
+
 func (self *Ledger) GetCrossStatesRoot(height uint32) (common.Uint256, error) {
 	return self.ldgStore.GetCrossStatesRoot(height)
 }
@@ -168,6 +185,22 @@ func (self *Ledger) GetStorageItem(codeHash common.Address, key []byte) ([]byte,
 	return storageItem.Value, nil
 }
 
+//GetStorageItemAtHeight return the storage value at height, archive mode required
+func (self *Ledger) GetStorageItemAtHeight(codeHash common.Address, key []byte, height uint32) ([]byte, error) {
+	storageKey := &states.StorageKey{
+		ContractAddress: codeHash,
+		Key:             key,
+	}
+	storageItem, err := self.ldgStore.GetStorageItemAtHeight(storageKey, height)
+	if err != nil {
+		return nil, err
+	}
+	if storageItem == nil {
+		return nil, nil
+	}
+	return storageItem.Value, nil
+}
+
 func (self *Ledger) GetContractState(contractHash common.Address) (*payload.DeployCode, error) {
 	return self.ldgStore.GetContractState(contractHash)
 }
@@ -184,6 +217,10 @@ func (self *Ledger) PreExecuteContractBatch(txes []*types.Transaction, atomic bo
 	return self.ldgStore.PreExecuteContractBatch(txes, atomic)
 }
 
+func (self *Ledger) PreExecuteContractAtHeight(tx *types.Transaction, height uint32) (*cstate.PreExecResult, error) {
+	return self.ldgStore.PreExecuteContractAtHeight(tx, height)
+}
+
 func (self *Ledger) GetEventNotifyByTx(tx common.Uint256) (*event.ExecuteNotify, error) {
 	return self.ldgStore.GetEventNotifyByTx(tx)
 }
@@ -208,6 +245,47 @@ func (self *Ledger) EnableBlockPrune(numBeforeCurr uint32) {
 	self.ldgStore.EnableBlockPrune(numBeforeCurr)
 }
 
+func (self *Ledger) EnableStatePrune(numBeforeCurr uint32) {
+	self.ldgStore.EnableStatePrune(numBeforeCurr)
+}
+
+func (self *Ledger) EnableLightMode() {
+	self.ldgStore.EnableLightMode()
+}
+
+func (self *Ledger) IsLightMode() bool {
+	return self.ldgStore.IsLightMode()
+}
+
+func (self *Ledger) EnableArchiveMode() error {
+	return self.ldgStore.EnableArchiveMode()
+}
+
+func (self *Ledger) IsArchiveMode() bool {
+	return self.ldgStore.IsArchiveMode()
+}
+
+//GetArchiveRange return the first and last height of which state can be queried
+func (self *Ledger) GetArchiveRange() (uint32, uint32, bool) {
+	return self.ldgStore.GetArchiveRange()
+}
+
+func (self *Ledger) EnableStateSnapshot(interval uint32) {
+	self.ldgStore.EnableStateSnapshot(interval)
+}
+
+func (self *Ledger) GetStateSnapshot(height uint32) (*types.StateSnapshot, error) {
+	return self.ldgStore.GetStateSnapshot(height)
+}
+
+func (self *Ledger) GetStateSnapshotChunk(height, index uint32) ([]byte, error) {
+	return self.ldgStore.GetStateSnapshotChunk(height, index)
+}
+
+func (self *Ledger) ImportStateSnapshot(block *types.Block, snapshot *types.StateSnapshot, chunks [][]byte) error {
+	return self.ldgStore.ImportStateSnapshot(block, snapshot, chunks)
+}
+
 func (self *Ledger) GetEventNotifyByEventId(contractAddress common.Address, address common.Address, eventId uint32) (
 	[]*event.ExecuteNotify, error) {
 	return self.ldgStore.GetEventNotifyByEventId(contractAddress, address, eventId)
@@ -216,3 +294,7 @@ func (self *Ledger) GetEventNotifyByEventIdAndHeight(contractAddress common.Addr
 	eventId, startHeight, endHeight uint32) ([]*event.ExecuteNotify, error) {
 	return self.ldgStore.GetEventNotifyByEventIdAndHeights(contractAddress, address, eventId, startHeight, endHeight)
 }
+
+func (self *Ledger) QueryEventNotify(query *store.EventQuery) (*store.EventQueryResult, error) {
+	return self.ldgStore.QueryEventNotify(query)
+}
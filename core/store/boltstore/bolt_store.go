@@ -0,0 +1,374 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package boltstore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/saveio/themis/core/store/common"
+	bolt "go.etcd.io/bbolt"
+)
+
+//BoltDB store, all the keys are kept in one bucket of the db file in the store directory
+type BoltDBStore struct {
+	db    *bolt.DB
+	batch []*batchOp
+}
+
+const (
+	DB_FILE_NAME = "bolt.db"
+	//the store is opened by a running node if the lock is not available in time
+	OPEN_TIMEOUT = 3 * time.Second
+	//max number of items loaded by iterator in a read transaction, a long running read
+	//transaction blocks the remapping of a growing db, so keys are read in chunks
+	ITERATOR_CHUNK_SIZE = 1024
+	//the db file is mapped with the size at least, a commit growing the db over the mapped size remaps the
+	//file, which waits for the open read transactions
+	INITIAL_MMAP_SIZE = 1 << 30
+)
+
+var bucketName = []byte("ledger")
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+//NewBoltDBStore return BoltDBStore instance, the db file is created in the dir if not exist
+func NewBoltDBStore(dir string) (*BoltDBStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(dir, DB_FILE_NAME), 0644, &bolt.Options{Timeout: OPEN_TIMEOUT, InitialMmapSize: INITIAL_MMAP_SIZE})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltDBStore{
+		db: db,
+	}, nil
+}
+
+//Put a key-value pair to boltdb
+func (self *BoltDBStore) Put(key []byte, value []byte) error {
+	return self.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Put(key, value)
+	})
+}
+
+//Get the value of a key from boltdb
+func (self *BoltDBStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := self.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketName).Get(key)
+		if v == nil {
+			return common.ErrNotFound
+		}
+		//the value is only valid in the transaction
+		value = append([]byte{}, v...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+//Has return whether the key is exist in boltdb
+func (self *BoltDBStore) Has(key []byte) (bool, error) {
+	_, err := self.Get(key)
+	if err == common.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//Delete the key in boltdb
+func (self *BoltDBStore) Delete(key []byte) error {
+	return self.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Delete(key)
+	})
+}
+
+//NewBatch start commit batch
+func (self *BoltDBStore) NewBatch() {
+	self.batch = make([]*batchOp, 0)
+}
+
+//BatchPut put a key-value pair to batch, the key and value are copied since the caller may reuse them before commit
+func (self *BoltDBStore) BatchPut(key []byte, value []byte) {
+	self.batch = append(self.batch, &batchOp{key: append([]byte{}, key...), value: append([]byte{}, value...)})
+}
+
+//BatchDelete delete a key in batch
+func (self *BoltDBStore) BatchDelete(key []byte) {
+	self.batch = append(self.batch, &batchOp{key: append([]byte{}, key...), delete: true})
+}
+
+//BatchCommit commit batch to boltdb in one transaction
+func (self *BoltDBStore) BatchCommit() error {
+	err := self.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		for _, op := range self.batch {
+			var err error
+			if op.delete {
+				err = bucket.Delete(op.key)
+			} else {
+				err = bucket.Put(op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	self.batch = nil
+	return nil
+}
+
+//Close boltdb
+func (self *BoltDBStore) Close() error {
+	return self.db.Close()
+}
+
+//NewIterator return a iterator of boltdb with the key prefix. The keys are loaded in chunks by several read
+//transactions, so the iterator is not a consistent view if the db is written meanwhile, use NewReadSnapshot for that
+func (self *BoltDBStore) NewIterator(prefix []byte) common.StoreIterator {
+	return self.NewSeekIterator(prefix, prefix)
+}
+
+//NewSeekIterator return a iterator of boltdb with the key prefix, which starts from the key start
+func (self *BoltDBStore) NewSeekIterator(prefix, start []byte) common.StoreIterator {
+	if bytes.Compare(start, prefix) < 0 {
+		start = prefix
+	}
+	return &boltIterator{
+		db:     self.db,
+		prefix: prefix,
+		start:  start,
+		from:   start,
+		pos:    -1,
+	}
+}
+
+//SizeOf return the size of the keys and values with the prefix
+func (self *BoltDBStore) SizeOf(prefix []byte) (int64, error) {
+	var size int64
+	err := self.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			size += int64(len(k) + len(v))
+		}
+		return nil
+	})
+	return size, err
+}
+
+//NewReadSnapshot return a consistent read only view of boltdb in one read transaction. The db file could not be
+//remapped while the snapshot is open, so a commit growing the db over the mapped size waits until the snapshot
+//is released
+func (self *BoltDBStore) NewReadSnapshot() (common.ReadSnapshot, error) {
+	tx, err := self.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	return &boltSnapshot{tx: tx}, nil
+}
+
+type boltSnapshot struct {
+	tx *bolt.Tx
+}
+
+//Get the value of a key from boltdb snapshot
+func (self *boltSnapshot) Get(key []byte) ([]byte, error) {
+	v := self.tx.Bucket(bucketName).Get(key)
+	if v == nil {
+		return nil, common.ErrNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+//NewIterator return a iterator of boltdb snapshot with the key prefix, the key and value are valid until Next
+func (self *boltSnapshot) NewIterator(prefix []byte) common.StoreIterator {
+	return &boltTxIterator{cursor: self.tx.Bucket(bucketName).Cursor(), prefix: prefix}
+}
+
+//Release the boltdb snapshot
+func (self *boltSnapshot) Release() {
+	self.tx.Rollback()
+}
+
+//boltTxIterator iterate the keys with the prefix in a read transaction
+type boltTxIterator struct {
+	cursor  *bolt.Cursor
+	prefix  []byte
+	started bool
+	key     []byte
+	value   []byte
+}
+
+//Next item. If item available return true, otherwise return false
+func (self *boltTxIterator) Next() bool {
+	if !self.started {
+		return self.First()
+	}
+	if self.key == nil {
+		return false
+	}
+	self.set(self.cursor.Next())
+	return self.key != nil
+}
+
+//First item. If item available return true, otherwise return false
+func (self *boltTxIterator) First() bool {
+	self.started = true
+	self.set(self.cursor.Seek(self.prefix))
+	return self.key != nil
+}
+
+func (self *boltTxIterator) set(key, value []byte) {
+	if key == nil || !bytes.HasPrefix(key, self.prefix) {
+		key, value = nil, nil
+	}
+	self.key, self.value = key, value
+}
+
+//Key return the current item key
+func (self *boltTxIterator) Key() []byte {
+	return self.key
+}
+
+//Value return the current item value
+func (self *boltTxIterator) Value() []byte {
+	return self.value
+}
+
+//Release the iterator
+func (self *boltTxIterator) Release() {
+	self.key, self.value = nil, nil
+	self.started = true
+}
+
+//Error returns any accumulated error
+func (self *boltTxIterator) Error() error {
+	return nil
+}
+
+//boltIterator load the keys with the prefix in chunks, each chunk in a read transaction
+type boltIterator struct {
+	db     *bolt.DB
+	prefix []byte
+	start  []byte
+	from   []byte //the key to load the next chunk from
+	done   bool   //no more chunk to load
+	keys   [][]byte
+	values [][]byte
+	pos    int
+	err    error
+}
+
+func (self *boltIterator) load() {
+	self.keys = self.keys[:0]
+	self.values = self.values[:0]
+	self.pos = -1
+	self.err = self.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+		k, v := c.Seek(self.from)
+		for ; k != nil && bytes.HasPrefix(k, self.prefix); k, v = c.Next() {
+			if len(self.keys) == ITERATOR_CHUNK_SIZE {
+				self.from = append([]byte{}, k...)
+				return nil
+			}
+			self.keys = append(self.keys, append([]byte{}, k...))
+			self.values = append(self.values, append([]byte{}, v...))
+		}
+		self.done = true
+		return nil
+	})
+	if self.err != nil {
+		self.done = true
+	}
+}
+
+//Next item. If item available return true, otherwise return false
+func (self *boltIterator) Next() bool {
+	self.pos++
+	if self.pos < len(self.keys) {
+		return true
+	}
+	if self.done {
+		self.pos = len(self.keys)
+		return false
+	}
+	self.load()
+	self.pos++
+	return self.pos < len(self.keys)
+}
+
+//First item. If item available return true, otherwise return false
+func (self *boltIterator) First() bool {
+	self.from = self.start
+	self.done = false
+	self.keys = nil
+	self.values = nil
+	self.pos = -1
+	return self.Next()
+}
+
+//Key return the current item key
+func (self *boltIterator) Key() []byte {
+	if self.pos < 0 || self.pos >= len(self.keys) {
+		return nil
+	}
+	return self.keys[self.pos]
+}
+
+//Value return the current item value
+func (self *boltIterator) Value() []byte {
+	if self.pos < 0 || self.pos >= len(self.values) {
+		return nil
+	}
+	return self.values[self.pos]
+}
+
+//Release the iterator
+func (self *boltIterator) Release() {
+	self.keys = nil
+	self.values = nil
+	self.done = true
+}
+
+//Error returns any accumulated error
+func (self *boltIterator) Error() error {
+	return self.err
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package boltstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/saveio/themis/core/store/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) (*BoltDBStore, func()) {
+	dir := "./test"
+	store, err := NewBoltDBStore(dir)
+	assert.Nil(t, err)
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltDB(t *testing.T) {
+	store, clean := newTestStore(t)
+	defer clean()
+
+	assert.Nil(t, store.Put([]byte("foo"), []byte("bar")))
+	v, err := store.Get([]byte("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bar"), v)
+	assert.Nil(t, store.Delete([]byte("foo")))
+	ok, err := store.Has([]byte("foo"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = store.Get([]byte("foo"))
+	assert.Equal(t, common.ErrNotFound, err)
+}
+
+func TestBatch(t *testing.T) {
+	store, clean := newTestStore(t)
+	defer clean()
+
+	store.NewBatch()
+	store.BatchPut([]byte("foo1"), []byte("bar1"))
+	store.BatchPut([]byte("foo2"), []byte("bar2"))
+	store.BatchDelete([]byte("foo1"))
+	assert.Nil(t, store.BatchCommit())
+
+	ok, err := store.Has([]byte("foo1"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	v, err := store.Get([]byte("foo2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bar2"), v)
+}
+
+func TestIterator(t *testing.T) {
+	store, clean := newTestStore(t)
+	defer clean()
+
+	//more keys than a chunk, so the iterator loads several times
+	count := ITERATOR_CHUNK_SIZE*2 + 10
+	store.NewBatch()
+	for i := 0; i < count; i++ {
+		store.BatchPut([]byte(fmt.Sprintf("a%06d", i)), []byte{byte(i)})
+	}
+	store.BatchPut([]byte("b"), []byte("b"))
+	assert.Nil(t, store.BatchCommit())
+
+	iter := store.NewIterator([]byte("a"))
+	n := 0
+	for iter.Next() {
+		assert.Equal(t, fmt.Sprintf("a%06d", n), string(iter.Key()))
+		assert.Equal(t, []byte{byte(n)}, iter.Value())
+		n++
+	}
+	assert.Equal(t, count, n)
+	assert.True(t, iter.First())
+	assert.Equal(t, "a000000", string(iter.Key()))
+	iter.Release()
+
+	iter = store.NewSeekIterator([]byte("a"), []byte("a001500"))
+	n = 0
+	for iter.Next() {
+		n++
+	}
+	iter.Release()
+	assert.Equal(t, count-1500, n)
+
+	size, err := store.SizeOf([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), size)
+}
+
+func TestReadSnapshot(t *testing.T) {
+	store, clean := newTestStore(t)
+	defer clean()
+
+	key, value := []byte("a1"), []byte("v1")
+	store.NewBatch()
+	store.BatchPut(key, value)
+	store.BatchPut([]byte("b"), []byte("b"))
+	//the batch is not changed by reusing the slices
+	key[1], value[1] = '2', '2'
+	assert.Nil(t, store.BatchCommit())
+	v, err := store.Get([]byte("a1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), v)
+
+	var snapshot common.ReadSnapshot
+	snapshot, err = store.NewReadSnapshot()
+	assert.Nil(t, err)
+	//the writes after the snapshot are not visible in snapshot
+	assert.Nil(t, store.Put([]byte("a2"), []byte("v2")))
+	assert.Nil(t, store.Delete([]byte("a1")))
+	v, err = snapshot.Get([]byte("a1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), v)
+	_, err = snapshot.Get([]byte("a2"))
+	assert.Equal(t, common.ErrNotFound, err)
+
+	iter := snapshot.NewIterator([]byte("a"))
+	keys := make([]string, 0)
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	assert.False(t, iter.Next())
+	assert.Equal(t, []string{"a1"}, keys)
+	assert.True(t, iter.First())
+	assert.Equal(t, []byte("v1"), iter.Value())
+	iter.Release()
+	snapshot.Release()
+}
@@ -26,7 +26,7 @@ const (
 	DATA_BLOCK_HASH        DataEntryPrefix = 0x00 //Block height => block hash key prefix
 	DATA_HEADER                            = 0x01 //Block hash => block header+txhashes key prefix
 	DATA_TRANSACTION                       = 0x02 //Transction hash => transaction key prefix
-	DATA_STATE_MERKLE_ROOT                 = 0x21 // block height => write set hash + state merkle root
+	DATA_STATE_MERKLE_ROOT                 = 0x21 // block height => write set hash + state merkle root, the state merkle root only once pruned
 
 	// Transaction
 	ST_BOOKKEEPER DataEntryPrefix = 0x03 //BookKeeper state key prefix
@@ -42,8 +42,18 @@ const (
 	SYS_BLOCK_MERKLE_TREE    DataEntryPrefix = 0x13 // Block merkle tree root key prefix
 	SYS_STATE_MERKLE_TREE    DataEntryPrefix = 0x20 // state merkle tree root key prefix
 	SYS_CROSS_CHAIN_MSG      DataEntryPrefix = 0x22 // state merkle tree root key prefix
+	SYS_ARCHIVE_RANGE        DataEntryPrefix = 0x23 // first and last height of the archived state history
 
-	EVENT_NOTIFY DataEntryPrefix = 0x14 //Event notify key prefix
+	ST_HISTORY       DataEntryPrefix = 0x24 // state key + block height => state value before the block, saved in archive mode
+	ST_HISTORY_INDEX DataEntryPrefix = 0x25 // block height => state keys of the history saved by the block
+
+	SYS_STATE_CHECKPOINT DataEntryPrefix = 0x26 // block height => state checkpoint root, saved at state checkpoint heights
+
+	EVENT_NOTIFY         DataEntryPrefix = 0x14 //Event notify key prefix
+	EVENT_INDEX          DataEntryPrefix = 0x15 //contract + event id + participant + height + tx index => tx hash
+	EVENT_INDEX_CONTRACT DataEntryPrefix = 0x16 //contract + event id + height + tx index => tx hash
+	SYS_EVENT_INDEX      DataEntryPrefix = 0x17 //Event index version, the index is rebuilt from event notifies if absent
 
 	DATA_BLOCK_PRUNE_HEIGHT DataEntryPrefix = 0x80 //  last pruned block height, genesis block can not be pruned
+	DATA_STATE_PRUNE_HEIGHT DataEntryPrefix = 0x81 //  last height of which state merkle root, cross states and state history are pruned
 )
@@ -28,6 +28,9 @@ import (
 
 var ErrNotFound = errors.New("not found")
 
+//ErrCommitBlock is wrapped by the errors of saving a valid block to the local store, such as a failed commit
+var ErrCommitBlock = errors.New("commit block error")
+
 //Store iterator for iterate store
 type StoreIterator interface {
 	Next() bool //Next item. If item available return true, otherwise return false
@@ -55,6 +58,33 @@ type PersistStore interface {
 	NewIterator(prefix []byte) StoreIterator //Return the iterator of store
 }
 
+//SeekableStore is a persist store which could iterate the keys with prefix from a start key
+type SeekableStore interface {
+	NewSeekIterator(prefix, start []byte) StoreIterator
+}
+
+//SizedStore is a persist store which could report the size of the keys with prefix
+type SizedStore interface {
+	SizeOf(prefix []byte) (int64, error)
+}
+
+//CompactableStore is a persist store which could reclaim the space of deleted keys
+type CompactableStore interface {
+	Compact() error
+}
+
+//SnapshotStore is a persist store which could take a consistent read only view of current data
+type SnapshotStore interface {
+	NewReadSnapshot() (ReadSnapshot, error)
+}
+
+//ReadSnapshot is a consistent read only view of persist store, which must be released after use
+type ReadSnapshot interface {
+	Get(key []byte) ([]byte, error)          //Get the value if key in snapshot
+	NewIterator(prefix []byte) StoreIterator //Return the iterator of snapshot
+	Release()                                //Release the snapshot
+}
+
 //StateStore save result of smart contract execution, before commit to store
 type StateStore interface {
 	//Add key-value pair to store
@@ -87,6 +117,8 @@ type MemoryCacheStore interface {
 type EventStore interface {
 	//SaveEventNotifyByTx save event notify gen by smart contract execution
 	SaveEventNotifyByTx(txHash common.Uint256, notify *event.ExecuteNotify) error
+	//SaveEventIndex index the event notify of transaction by contract, event id and participants
+	SaveEventIndex(height, txIndex uint32, notify *event.ExecuteNotify)
 	//Save transaction hashes which have event notify gen
 	SaveEventNotifyByBlock(height uint32, txHashs []common.Uint256)
 	//GetEventNotifyByTx return event notify by transaction hash
@@ -27,20 +27,19 @@ import (
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/serialization"
 	scom "github.com/saveio/themis/core/store/common"
-	"github.com/saveio/themis/core/store/leveldbstore"
 	"github.com/saveio/themis/core/types"
 )
 
 //Block store save the data of block & transaction
 type BlockStore struct {
-	enableCache bool                       //Is enable lru cache
-	dbDir       string                     //The path of store file
-	cache       *BlockCache                //The cache of block, if have.
-	store       *leveldbstore.LevelDBStore //block store handler
+	enableCache bool              //Is enable lru cache
+	dbDir       string            //The path of store file
+	cache       *BlockCache       //The cache of block, if have.
+	store       scom.PersistStore //block store handler
 }
 
 //NewBlockStore return the block store instance
-func NewBlockStore(dbDir string, enableCache bool) (*BlockStore, error) {
+func NewBlockStore(backend, dbDir string, enableCache bool) (*BlockStore, error) {
 	var cache *BlockCache
 	var err error
 	if enableCache {
@@ -50,7 +49,7 @@ func NewBlockStore(dbDir string, enableCache bool) (*BlockStore, error) {
 		}
 	}
 
-	store, err := leveldbstore.NewLevelDBStore(dbDir)
+	store, err := NewPersistStore(backend, dbDir)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/saveio/themis/common"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/smartcontract/service/native/utils"
+)
+
+var dataEntryPrefixNames = map[byte]string{
+	byte(scom.DATA_BLOCK_HASH):          "block hash",
+	byte(scom.DATA_HEADER):              "header",
+	byte(scom.DATA_TRANSACTION):         "transaction",
+	byte(scom.DATA_STATE_MERKLE_ROOT):   "write set hash & state root",
+	byte(scom.ST_BOOKKEEPER):            "bookkeeper",
+	byte(scom.ST_CONTRACT):              "contract",
+	byte(scom.ST_STORAGE):               "storage",
+	byte(scom.IX_HEADER_HASH_LIST):      "header hash list",
+	byte(scom.SYS_CURRENT_BLOCK):        "current block",
+	byte(scom.SYS_VERSION):              "version",
+	byte(scom.SYS_CURRENT_CROSS_STATES): "cross states",
+	byte(scom.SYS_BLOCK_MERKLE_TREE):    "block merkle tree",
+	byte(scom.SYS_STATE_MERKLE_TREE):    "state merkle tree",
+	byte(scom.SYS_CROSS_CHAIN_MSG):      "cross chain msg",
+	byte(scom.SYS_ARCHIVE_RANGE):        "archive range",
+	byte(scom.ST_HISTORY):               "state history",
+	byte(scom.ST_HISTORY_INDEX):         "state history index",
+	byte(scom.SYS_STATE_CHECKPOINT):     "state checkpoint",
+	byte(scom.EVENT_NOTIFY):             "event notify",
+	byte(scom.EVENT_INDEX):              "event index",
+	byte(scom.EVENT_INDEX_CONTRACT):     "event index by contract",
+	byte(scom.SYS_EVENT_INDEX):          "event index version",
+	byte(scom.DATA_BLOCK_PRUNE_HEIGHT):  "block pruned height",
+	byte(scom.DATA_STATE_PRUNE_HEIGHT):  "state pruned height",
+}
+
+var nativeContractNames = []struct {
+	name    string
+	address common.Address
+}{
+	{"usdt", utils.UsdtContractAddress},
+	{"ontid", utils.OntIDContractAddress},
+	{"param", utils.ParamContractAddress},
+	{"auth", utils.AuthContractAddress},
+	{"governance", utils.GovernanceContractAddress},
+	{"savefs", utils.OntFSContractAddress},
+	{"micropayment", utils.MicroPayContractAddress},
+	{"dns", utils.OntDNSAddress},
+	{"film", utils.FilmContractAddress},
+	{"cross chain", utils.CrossChainContractAddress},
+	{"lock proxy", utils.LockProxyContractAddress},
+	{"header sync", utils.HeaderSyncContractAddress},
+}
+
+//DiskUsageItem is the approximate size of a kind of data in a store
+type DiskUsageItem struct {
+	Store    string
+	Category string
+	Size     int64
+}
+
+//GetDiskUsage report the size of every store of ledger by key prefix, and the size of files on disk.
+//The stores are opened, so the node using dataDir should be stopped. The stores are compacted first if compact
+func GetDiskUsage(dataDir string, compact bool) ([]*DiskUsageItem, error) {
+	backend, err := ResolveStoreBackend(dataDir, "")
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*DiskUsageItem, 0)
+	for _, dir := range []string{DBDirBlock, DBDirState, DBDirEvent, DBDirCrossChain} {
+		path := filepath.Join(dataDir, dir)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		dbItems, err := getStoreUsage(backend, path, dir, compact)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, dbItems...)
+	}
+	for _, name := range []string{DBDirBlock, DBDirState, DBDirEvent, DBDirCrossChain, MerkleTreeStorePath, DBDirSnapshot} {
+		size, err := dirSize(filepath.Join(dataDir, name))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &DiskUsageItem{Store: name, Category: "on disk", Size: size})
+	}
+	return items, nil
+}
+
+func getStoreUsage(backend, path, name string, compact bool) ([]*DiskUsageItem, error) {
+	persistStore, err := NewPersistStore(backend, path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s error %s, is the node running?", path, err)
+	}
+	defer persistStore.Close()
+	store, ok := persistStore.(scom.SizedStore)
+	if !ok {
+		return nil, fmt.Errorf("%s store does not support size report", backend)
+	}
+	if compact {
+		compactable, ok := persistStore.(scom.CompactableStore)
+		if !ok {
+			return nil, fmt.Errorf("%s store does not support compaction", backend)
+		}
+		if err := compactable.Compact(); err != nil {
+			return nil, fmt.Errorf("compact %s error %s", path, err)
+		}
+	}
+
+	items := make([]*DiskUsageItem, 0)
+	for prefix := 0; prefix < 256; prefix++ {
+		size, err := store.SizeOf([]byte{byte(prefix)})
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			continue
+		}
+		category, ok := dataEntryPrefixNames[byte(prefix)]
+		if !ok {
+			category = fmt.Sprintf("prefix 0x%02x", prefix)
+		}
+		items = append(items, &DiskUsageItem{Store: name, Category: category, Size: size})
+		if byte(prefix) != byte(scom.ST_STORAGE) {
+			continue
+		}
+		//break the storage down by native contracts, savefs is usually the largest
+		for _, contract := range nativeContractNames {
+			size, err := store.SizeOf(append([]byte{byte(prefix)}, contract.address[:]...))
+			if err != nil {
+				return nil, err
+			}
+			if size == 0 {
+				continue
+			}
+			items = append(items, &DiskUsageItem{Store: name, Category: category + "/" + contract.name, Size: size})
+		}
+	}
+	return items, nil
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return size, err
+}
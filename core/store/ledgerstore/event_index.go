@@ -0,0 +1,414 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/log"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/smartcontract/event"
+)
+
+//Event notifies are indexed by contract + event id (+ participant) + position, the position is the block height
+//and the tx index in block, so the events are iterated in chain order and a height range is a key range.
+//Each notify is indexed under its event id and under event id 0 which matches any event id.
+
+const (
+	eventIndexVersion    = 1
+	legacyEventKeyLength = 2*common.ADDR_LEN + 8 //contract + address + event id + random, the index before version 1
+	rebuildBatchSize     = 1000
+)
+
+type eventIndexEntry struct {
+	position uint64
+	txHash   common.Uint256
+}
+
+func genEventPosition(height, txIndex uint32) uint64 {
+	return uint64(height)<<32 | uint64(txIndex)
+}
+
+func encodeEventCursor(position uint64) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, position)
+	return hex.EncodeToString(buf)
+}
+
+func decodeEventCursor(cursor string) (uint64, error) {
+	buf, err := hex.DecodeString(cursor)
+	if err != nil || len(buf) != 8 {
+		return 0, fmt.Errorf("invalid event cursor %s", cursor)
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func genEventIndexPrefix(contract common.Address, eventId uint32, participant *common.Address) []byte {
+	key := make([]byte, 0, 1+2*common.ADDR_LEN+4)
+	if participant == nil {
+		key = append(key, byte(scom.EVENT_INDEX_CONTRACT))
+	} else {
+		key = append(key, byte(scom.EVENT_INDEX))
+	}
+	key = append(key, contract[:]...)
+	key = append(key, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(key[len(key)-4:], eventId)
+	if participant != nil {
+		key = append(key, participant[:]...)
+	}
+	return key
+}
+
+func genEventIndexKey(prefix []byte, position uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], position)
+	return key
+}
+
+func genEventIndexVersionKey() []byte {
+	return []byte{byte(scom.SYS_EVENT_INDEX)}
+}
+
+//SaveEventIndex put the index entries of the event notify of the tx at height and txIndex to batch
+func (this *EventStore) SaveEventIndex(height, txIndex uint32, notify *event.ExecuteNotify) {
+	for _, key := range genEventIndexKeys(height, txIndex, notify) {
+		this.store.BatchPut(key, notify.TxHash[:])
+	}
+}
+
+//pruneEventIndex put the deletion of the index entries of the txs in block to batch
+func (this *EventStore) pruneEventIndex(height uint32) {
+	txHashes, err := this.getEventTxHashesByBlock(height)
+	if err != nil {
+		return
+	}
+	for txIndex, txHash := range txHashes {
+		notify, err := this.GetEventNotifyByTx(txHash)
+		if err != nil {
+			continue
+		}
+		for _, key := range genEventIndexKeys(height, uint32(txIndex), notify) {
+			this.store.BatchDelete(key)
+		}
+	}
+}
+
+func genEventIndexKeys(height, txIndex uint32, notify *event.ExecuteNotify) [][]byte {
+	if notify == nil {
+		return nil
+	}
+	position := genEventPosition(height, txIndex)
+	keys := make([][]byte, 0)
+	exist := make(map[string]struct{})
+	put := func(prefix []byte) {
+		key := genEventIndexKey(prefix, position)
+		if _, ok := exist[string(key)]; ok {
+			return
+		}
+		exist[string(key)] = struct{}{}
+		keys = append(keys, key)
+	}
+	for _, notifyInfo := range notify.Notify {
+		// event id 0 means no need to store
+		if notifyInfo.EventIdentifier == 0 {
+			continue
+		}
+		addresses := notifyInfo.Addresses
+		if len(addresses) == 0 {
+			addresses = []common.Address{common.ADDRESS_EMPTY}
+		}
+		for _, eventId := range []uint32{notifyInfo.EventIdentifier, 0} {
+			put(genEventIndexPrefix(notifyInfo.ContractAddress, eventId, nil))
+			for i := range addresses {
+				put(genEventIndexPrefix(notifyInfo.ContractAddress, eventId, &addresses[i]))
+			}
+		}
+	}
+	return keys
+}
+
+//QueryEventIndex return the index entries in positions [start, end], ordered by position. At most limit entries
+//are returned if limit is not 0, and whether there are more entries
+func (this *EventStore) QueryEventIndex(contract common.Address, eventId uint32, participant *common.Address,
+	start, end uint64, limit uint32) ([]*eventIndexEntry, bool, error) {
+	prefix := genEventIndexPrefix(contract, eventId, participant)
+	iter := newSeekIterator(this.store, prefix, genEventIndexKey(prefix, start))
+	defer iter.Release()
+
+	entries := make([]*eventIndexEntry, 0)
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(prefix)+8 {
+			continue
+		}
+		position := binary.BigEndian.Uint64(key[len(prefix):])
+		if position > end {
+			break
+		}
+		if limit != 0 && uint32(len(entries)) == limit {
+			return entries, true, nil
+		}
+		txHash, err := common.Uint256ParseFromBytes(iter.Value())
+		if err != nil {
+			return nil, false, err
+		}
+		entries = append(entries, &eventIndexEntry{position: position, txHash: txHash})
+	}
+	if err := iter.Error(); err != nil {
+		return nil, false, err
+	}
+	return entries, false, nil
+}
+
+//eventIndexProgress is the progress of building the event index from the event notifies saved before the event
+//index is introduced, the blocks in [next, end] are not indexed yet
+type eventIndexProgress struct {
+	next uint32
+	end  uint32
+}
+
+//the version key holds the version once the index is built, or 0 + next + end while building
+func encodeEventIndexProgress(progress *eventIndexProgress) []byte {
+	sink := common.NewZeroCopySink(nil)
+	sink.WriteByte(0)
+	sink.WriteUint32(progress.next)
+	sink.WriteUint32(progress.end)
+	return sink.Bytes()
+}
+
+//getEventIndexProgress return the progress of building the event index, nil if the index is built
+func (this *EventStore) getEventIndexProgress() (*eventIndexProgress, error) {
+	data, err := this.store.Get(genEventIndexVersionKey())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 1 && data[0] >= eventIndexVersion {
+		return nil, nil
+	}
+	source := common.NewZeroCopySource(data)
+	version, eof := source.NextByte()
+	if eof || version != 0 {
+		return nil, fmt.Errorf("invalid event index version %x", data)
+	}
+	progress := &eventIndexProgress{}
+	progress.next, eof = source.NextUint32()
+	if eof {
+		return nil, io.ErrUnexpectedEOF
+	}
+	progress.end, eof = source.NextUint32()
+	if eof {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return progress, nil
+}
+
+//SaveEventIndexVersion mark the event index built, the event notifies of a new chain are indexed when saved
+func (this *EventStore) SaveEventIndexVersion() error {
+	this.NewBatch()
+	this.store.BatchPut(genEventIndexVersionKey(), []byte{eventIndexVersion})
+	return this.CommitTo()
+}
+
+//PrepareEventIndex check whether the event index need to be built, the blocks up to currHeight are saved to be
+//indexed if the index has never been built. The blocks saved later are indexed when saved
+func (this *EventStore) PrepareEventIndex(currHeight uint32) (bool, error) {
+	progress, err := this.getEventIndexProgress()
+	if err == nil {
+		return progress != nil, nil
+	}
+	if err != scom.ErrNotFound {
+		return false, err
+	}
+	this.NewBatch()
+	this.store.BatchPut(genEventIndexVersionKey(), encodeEventIndexProgress(&eventIndexProgress{end: currHeight}))
+	if err := this.CommitTo(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//BuildEventIndex index the event notifies saved before the event index is introduced, and delete the legacy index.
+//The index is built batch by batch and the progress is saved with each batch, so the building is resumed after
+//restart. lock is called before writing a batch, and the building stops if lock returns false. Return whether
+//the index is built
+func (this *EventStore) BuildEventIndex(lock func() bool, unlock func()) (bool, error) {
+	if !lock() {
+		return false, nil
+	}
+	progress, err := this.getEventIndexProgress()
+	unlock()
+	if err != nil || progress == nil {
+		return err == nil, err
+	}
+	if progress.next <= progress.end {
+		log.Infof("building event index of blocks from %d to %d", progress.next, progress.end)
+	}
+	for progress.next <= progress.end {
+		if !lock() {
+			return false, nil
+		}
+		err := this.indexEventsOfBlocks(progress)
+		unlock()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	//the legacy keys are never written again, so they are collected outside the lock even if the iterator is not
+	//a consistent view of the store
+	iter := this.store.NewIterator(nil)
+	defer iter.Release()
+	keys := make([][]byte, 0, rebuildBatchSize)
+	//deleteKeys delete the collected legacy keys, and mark the index built if done. Return false if stopped
+	deleteKeys := func(done bool) (bool, error) {
+		if !lock() {
+			return false, nil
+		}
+		defer unlock()
+		this.NewBatch()
+		for _, key := range keys {
+			this.store.BatchDelete(key)
+		}
+		if done {
+			this.store.BatchPut(genEventIndexVersionKey(), []byte{eventIndexVersion})
+		}
+		keys = keys[:0]
+		return true, this.CommitTo()
+	}
+	for iter.Next() {
+		if !isLegacyEventKey(iter.Key(), iter.Value()) {
+			continue
+		}
+		keys = append(keys, append([]byte{}, iter.Key()...))
+		if len(keys) == rebuildBatchSize {
+			if ok, err := deleteKeys(false); !ok || err != nil {
+				return false, err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return false, err
+	}
+	if ok, err := deleteKeys(true); !ok || err != nil {
+		return false, err
+	}
+	log.Infof("event index built")
+	return true, nil
+}
+
+//indexEventsOfBlocks index the event notifies of a batch of blocks from progress.next, and save the progress
+func (this *EventStore) indexEventsOfBlocks(progress *eventIndexProgress) error {
+	this.NewBatch()
+	next := progress.next
+	for ; next <= progress.end && next-progress.next < rebuildBatchSize; next++ {
+		txHashes, err := this.getEventTxHashesByBlock(next)
+		if err != nil && err != scom.ErrNotFound {
+			return err
+		}
+		for txIndex, txHash := range txHashes {
+			notify, err := this.GetEventNotifyByTx(txHash)
+			if err != nil {
+				continue
+			}
+			this.SaveEventIndex(next, uint32(txIndex), notify)
+		}
+		if next == math.MaxUint32 {
+			break
+		}
+	}
+	updated := &eventIndexProgress{next: next, end: progress.end}
+	this.store.BatchPut(genEventIndexVersionKey(), encodeEventIndexProgress(updated))
+	if err := this.CommitTo(); err != nil {
+		return err
+	}
+	*progress = *updated
+	return nil
+}
+
+//isLegacyEventKey check whether key is an entry of the index before version 1, which is contract + address +
+//event id + random => tx hash without a prefix. The first byte is not checked since the contract address may start
+//with any byte, no other key of event store has the same length
+func isLegacyEventKey(key, value []byte) bool {
+	if len(key) != legacyEventKeyLength || len(value) != common.UINT256_SIZE {
+		return false
+	}
+	//the event id 0 is never indexed
+	return binary.LittleEndian.Uint32(key[2*common.ADDR_LEN:]) != 0
+}
+
+//getEventTxHashesByBlock return the hashes of transactions in block in order
+func (this *EventStore) getEventTxHashesByBlock(height uint32) ([]common.Uint256, error) {
+	data, err := this.store.Get(genEventNotifyByBlockKey(height))
+	if err != nil {
+		return nil, err
+	}
+	source := common.NewZeroCopySource(data)
+	size, eof := source.NextUint32()
+	if eof {
+		return nil, io.ErrUnexpectedEOF
+	}
+	txHashes := make([]common.Uint256, 0, size)
+	for i := uint32(0); i < size; i++ {
+		txHash, eof := source.NextHash()
+		if eof {
+			return nil, io.ErrUnexpectedEOF
+		}
+		txHashes = append(txHashes, txHash)
+	}
+	return txHashes, nil
+}
+
+//startEventIndexBuild build the event index in background if the index has not been built. The saving block lock
+//is held while writing each batch, so the event store batch is not shared with block saving
+func (this *LedgerStoreImp) startEventIndexBuild() error {
+	building, err := this.eventStore.PrepareEventIndex(this.GetCurrentBlockHeight())
+	if err != nil || !building {
+		return err
+	}
+	lock := func() bool {
+		select {
+		case <-this.quit:
+			return false
+		case this.savingBlockSemaphore <- true:
+		}
+		select {
+		case <-this.quit:
+			this.releaseSavingBlockLock()
+			return false
+		default:
+			return true
+		}
+	}
+	this.eventIndexWg.Add(1)
+	go func() {
+		defer this.eventIndexWg.Done()
+		built, err := this.eventStore.BuildEventIndex(lock, this.releaseSavingBlockLock)
+		if err != nil {
+			log.Errorf("build event index error: %s", err)
+		} else if !built {
+			log.Infof("event index building stopped, it will be resumed after restart")
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"math"
+	"testing"
+
+	"github.com/saveio/themis/common"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/smartcontract/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventIndex(t *testing.T) {
+	store, err := NewEventStore(STORE_BACKEND_LEVELDB, "test/event_index")
+	assert.Nil(t, err)
+	defer store.Close()
+
+	contract := common.Address{1}
+	alice, bob := common.Address{2}, common.Address{3}
+	newNotify := func(txHash common.Uint256, eventId uint32, addresses ...common.Address) *event.ExecuteNotify {
+		return &event.ExecuteNotify{
+			TxHash: txHash,
+			Notify: []*event.NotifyEventInfo{{ContractAddress: contract, EventIdentifier: eventId, Addresses: addresses}},
+		}
+	}
+	//height 1: tx0 alice event 1, tx1 bob event 2; height 2: tx0 alice and bob event 1
+	blocks := map[uint32][]*event.ExecuteNotify{
+		1: {newNotify(common.Uint256{1}, 1, alice), newNotify(common.Uint256{2}, 2, bob)},
+		2: {newNotify(common.Uint256{3}, 1, alice, bob)},
+	}
+	store.NewBatch()
+	for height, notifies := range blocks {
+		txHashes := make([]common.Uint256, 0)
+		for i, notify := range notifies {
+			assert.Nil(t, store.SaveEventNotifyByTx(notify.TxHash, notify))
+			store.SaveEventIndex(height, uint32(i), notify)
+			txHashes = append(txHashes, notify.TxHash)
+		}
+		store.SaveEventNotifyByBlock(height, txHashes)
+	}
+	assert.Nil(t, store.CommitTo())
+
+	txHashesOf := func(entries []*eventIndexEntry) []common.Uint256 {
+		hashes := make([]common.Uint256, 0, len(entries))
+		for _, entry := range entries {
+			hashes = append(hashes, entry.txHash)
+		}
+		return hashes
+	}
+	entries, more, err := store.QueryEventIndex(contract, 1, &alice, 0, math.MaxUint64, 0)
+	assert.Nil(t, err)
+	assert.False(t, more)
+	assert.Equal(t, []common.Uint256{{1}, {3}}, txHashesOf(entries))
+
+	entries, _, _ = store.QueryEventIndex(contract, 0, &bob, 0, math.MaxUint64, 0)
+	assert.Equal(t, []common.Uint256{{2}, {3}}, txHashesOf(entries))
+
+	entries, _, _ = store.QueryEventIndex(contract, 0, nil, 0, math.MaxUint64, 0)
+	assert.Equal(t, []common.Uint256{{1}, {2}, {3}}, txHashesOf(entries))
+
+	entries, _, _ = store.QueryEventIndex(contract, 1, nil, genEventPosition(2, 0), genEventPosition(2, math.MaxUint32), 0)
+	assert.Equal(t, []common.Uint256{{3}}, txHashesOf(entries))
+
+	//pagination
+	entries, more, _ = store.QueryEventIndex(contract, 0, nil, 0, math.MaxUint64, 2)
+	assert.True(t, more)
+	assert.Equal(t, []common.Uint256{{1}, {2}}, txHashesOf(entries))
+	cursor, err := decodeEventCursor(encodeEventCursor(entries[1].position))
+	assert.Nil(t, err)
+	entries, more, _ = store.QueryEventIndex(contract, 0, nil, cursor+1, math.MaxUint64, 2)
+	assert.False(t, more)
+	assert.Equal(t, []common.Uint256{{3}}, txHashesOf(entries))
+
+	//the index is rebuilt from event notifies and the legacy index is deleted
+	store.NewBatch()
+	iter := store.store.NewIterator(nil)
+	for iter.Next() {
+		if len(iter.Key()) > 1 && (iter.Key()[0] == byte(scom.EVENT_INDEX) || iter.Key()[0] == byte(scom.EVENT_INDEX_CONTRACT)) {
+			store.store.BatchDelete(iter.Key())
+		}
+	}
+	iter.Release()
+	store.store.BatchDelete(genEventIndexVersionKey())
+	legacyKey := make([]byte, legacyEventKeyLength)
+	legacyKey[2*common.ADDR_LEN] = 1
+	store.store.BatchPut(legacyKey, make([]byte, common.UINT256_SIZE))
+	//the contract address of legacy key may start with the prefixes of event store
+	prefixedKeys := make([][]byte, 0)
+	for _, prefix := range []scom.DataEntryPrefix{scom.SYS_CURRENT_BLOCK, scom.EVENT_NOTIFY, scom.EVENT_INDEX,
+		scom.EVENT_INDEX_CONTRACT, scom.SYS_EVENT_INDEX} {
+		key := make([]byte, legacyEventKeyLength)
+		key[0] = byte(prefix)
+		key[2*common.ADDR_LEN] = 1
+		store.store.BatchPut(key, make([]byte, common.UINT256_SIZE))
+		prefixedKeys = append(prefixedKeys, key)
+	}
+	assert.Nil(t, store.CommitTo())
+
+	building, err := store.PrepareEventIndex(2)
+	assert.Nil(t, err)
+	assert.True(t, building)
+	unlock := func() {}
+	//the building stopped is resumed from the saved progress
+	built, err := store.BuildEventIndex(func() bool { return false }, unlock)
+	assert.Nil(t, err)
+	assert.False(t, built)
+	building, err = store.PrepareEventIndex(3)
+	assert.Nil(t, err)
+	assert.True(t, building)
+	progress, err := store.getEventIndexProgress()
+	assert.Nil(t, err)
+	assert.Equal(t, &eventIndexProgress{next: 0, end: 2}, progress)
+
+	built, err = store.BuildEventIndex(func() bool { return true }, unlock)
+	assert.Nil(t, err)
+	assert.True(t, built)
+	entries, _, _ = store.QueryEventIndex(contract, 0, nil, 0, math.MaxUint64, 0)
+	assert.Equal(t, []common.Uint256{{1}, {2}, {3}}, txHashesOf(entries))
+	has, err := store.store.Has(legacyKey)
+	assert.Nil(t, err)
+	assert.False(t, has)
+	for _, key := range prefixedKeys {
+		has, err = store.store.Has(key)
+		assert.Nil(t, err)
+		assert.False(t, has)
+	}
+	building, err = store.PrepareEventIndex(3)
+	assert.Nil(t, err)
+	assert.False(t, building)
+
+	//the index of pruned block is deleted
+	store.NewBatch()
+	store.PruneBlock(1, []common.Uint256{{1}, {2}})
+	assert.Nil(t, store.CommitTo())
+	entries, _, _ = store.QueryEventIndex(contract, 0, nil, 0, math.MaxUint64, 0)
+	assert.Equal(t, []common.Uint256{{3}}, txHashesOf(entries))
+}
@@ -23,25 +23,23 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/common/serialization"
 	scom "github.com/saveio/themis/core/store/common"
-	"github.com/saveio/themis/core/store/leveldbstore"
 	"github.com/saveio/themis/smartcontract/event"
 )
 
 //Saving event notifies gen by smart contract execution
 type EventStore struct {
-	dbDir string                     //Store path
-	store *leveldbstore.LevelDBStore //Store handler
+	dbDir string            //Store path
+	store scom.PersistStore //Store handler
 }
 
 //NewEventStore return event store instance
-func NewEventStore(dbDir string) (*EventStore, error) {
-	store, err := leveldbstore.NewLevelDBStore(dbDir)
+func NewEventStore(backend, dbDir string) (*EventStore, error) {
+	store, err := NewPersistStore(backend, dbDir)
 	if err != nil {
 		return nil, err
 	}
@@ -64,136 +62,9 @@ func (this *EventStore) SaveEventNotifyByTx(txHash common.Uint256, notify *event
 	}
 	key := genEventNotifyByTxKey(txHash)
 	this.store.BatchPut(key, result)
-
-	return this.SaveEventNofityByEventID(txHash, notify)
-}
-
-func (this *EventStore) SaveEventNofityByEventID(txHash common.Uint256, notify *event.ExecuteNotify) error {
-	if notify == nil {
-		return fmt.Errorf("notify is nil")
-	}
-
-	exist := make(map[string]struct{}, 0)
-	for _, notifyInfo := range notify.Notify {
-		// event id 0 means no need to store
-		if notifyInfo.EventIdentifier == 0 {
-			continue
-		}
-
-		var addresses []common.Address
-
-		if len(notifyInfo.Addresses) == 0 {
-			addresses = append(addresses, common.ADDRESS_EMPTY)
-		} else {
-			addresses = notifyInfo.Addresses
-		}
-
-		for _, address := range addresses {
-			existKey := fmt.Sprintf("%s-%s-%d", notifyInfo.ContractAddress.ToBase58(), address.ToBase58(), notifyInfo.EventIdentifier)
-			if _, ok := exist[existKey]; ok {
-				continue
-			}
-			// use random to distinguish events with same event id
-			random := rand.Uint32()
-			key := this.getEventNotifyByEventIDKey(notifyInfo.ContractAddress, address, notifyInfo.EventIdentifier, random)
-
-			value := bytes.NewBuffer(nil)
-			txHash.Serialize(value)
-
-			this.store.BatchPut(key, value.Bytes())
-			exist[existKey] = struct{}{}
-		}
-	}
 	return nil
 }
 
-func (this *EventStore) getEventNotifyByEventIDKey(contractAddress common.Address, address common.Address, eventId uint32, random uint32) []byte {
-	prefix := this.getEventNotifyByEventIDKeyPrefix(contractAddress, address, eventId)
-	sink := common.ZeroCopySink{}
-	sink.WriteBytes(prefix)
-	sink.WriteUint32(random)
-	return sink.Bytes()
-}
-
-func (this *EventStore) getEventNotifyByEventIDKeyPrefix(contractAddress common.Address, address common.Address, eventId uint32) []byte {
-	sink := common.ZeroCopySink{}
-	contractAddress.Serialization(&sink)
-	address.Serialization(&sink)
-	// eventId 0 means find all the events
-	if eventId != 0 {
-		sink.WriteUint32(eventId)
-	}
-	return sink.Bytes()
-}
-
-func (this *EventStore) getAllEventNotifyKeyPrefix(contractAddress common.Address) []byte {
-	sink := common.ZeroCopySink{}
-	contractAddress.Serialization(&sink)
-	return sink.Bytes()
-}
-
-func (this *EventStore) GetEventNotifyTxHashByHeights(contractAddress common.Address, addressBytes []byte, eventId uint32) ([]common.Uint256, error) {
-	var txHashes []common.Uint256
-
-	var prefix []byte
-	if addressBytes != nil {
-		var address common.Address
-		copy(address[:], addressBytes[:])
-		prefix = this.getEventNotifyByEventIDKeyPrefix(contractAddress, address, eventId)
-
-	} else {
-		prefix = this.getAllEventNotifyKeyPrefix(contractAddress)
-	}
-
-	iter := this.store.NewIterator(prefix)
-
-	defer iter.Release()
-	for iter.Next() {
-		var txHash common.Uint256
-
-		reader := bytes.NewBuffer(iter.Value())
-		err := txHash.Deserialize(reader)
-		if err != nil {
-			return nil, fmt.Errorf("ReadUint32 error %s", err)
-		}
-
-		txHashes = append(txHashes, txHash)
-	}
-
-	if err := iter.Error(); err != nil {
-		return nil, err
-	}
-
-	return txHashes, nil
-}
-
-func (this *EventStore) GetEventNotifyTxHashByEventID(contractAddress common.Address, address common.Address, eventId uint32) ([]common.Uint256, error) {
-	var txHashes []common.Uint256
-
-	prefix := this.getEventNotifyByEventIDKeyPrefix(contractAddress, address, eventId)
-
-	iter := this.store.NewIterator(prefix)
-
-	defer iter.Release()
-	for iter.Next() {
-		var txHash common.Uint256
-
-		reader := bytes.NewBuffer(iter.Value())
-		err := txHash.Deserialize(reader)
-		if err != nil {
-			return nil, fmt.Errorf("ReadUint32 error %s", err)
-		}
-
-		txHashes = append(txHashes, txHash)
-	}
-
-	if err := iter.Error(); err != nil {
-		return nil, err
-	}
-
-	return txHashes, nil
-}
-
 //SaveEventNotifyByBlock persist transaction hash which have event notify to store
 func (this *EventStore) SaveEventNotifyByBlock(height uint32, txHashs []common.Uint256) {
 	key := genEventNotifyByBlockKey(height)
@@ -249,6 +120,7 @@ func (this *EventStore) GetEventNotifyByBlock(height uint32) ([]*event.ExecuteNo
 }
 
 func (this *EventStore) PruneBlock(height uint32, hashes []common.Uint256) {
+	this.pruneEventIndex(height)
 	key := genEventNotifyByBlockKey(height)
 	this.store.BatchDelete(key)
 	for _, hash := range hashes {
@@ -0,0 +1,344 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/saveio/themis/common"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/merkle"
+)
+
+//The state is rolled back by reverting the blocks above the target height with the state history saved in
+//archive mode. Otherwise the latest state snapshot not above the target height is restored, and the blocks from
+//the snapshot to the target height are executed again when the ledger starts.
+
+//RollbackResult is the outcome of ledger rollback
+type RollbackResult struct {
+	From           uint32 //Block height before rollback
+	To             uint32 //Block height after rollback
+	SnapshotHeight uint32 //Height of the state snapshot restored, 0 if state is reverted by history
+}
+
+//RollbackLedger truncate the stores of ledger in dataDir to height. The node using dataDir should be stopped
+func RollbackLedger(dataDir string, stateHashCheckHeight uint32, height uint32) (*RollbackResult, error) {
+	stores, err := openLedgerStores(dataDir, stateHashCheckHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer stores.close()
+	return stores.rollback(height)
+}
+
+func (self *ledgerStores) rollback(target uint32) (*RollbackResult, error) {
+	_, blockHeight, err := self.blockStore.GetCurrentBlock()
+	if err != nil {
+		return nil, fmt.Errorf("blockStore.GetCurrentBlock error %s", err)
+	}
+	if target >= blockHeight {
+		return nil, fmt.Errorf("height %d is not below current block height %d", target, blockHeight)
+	}
+	blockPruned, err := self.blockStore.GetBlockPrunedHeight()
+	if err != nil {
+		return nil, err
+	}
+	if blockPruned != 0 && target <= blockPruned {
+		return nil, fmt.Errorf("blocks not above height %d are pruned", blockPruned)
+	}
+	targetHash, err := self.blockStore.GetBlockHash(target)
+	if err != nil {
+		return nil, fmt.Errorf("block hash of height %d error %s", target, err)
+	}
+	result := &RollbackResult{From: blockHeight, To: target}
+
+	//the stores are committed in the reverse order of saving block, so the rollback could be run again if interrupted
+	_, stateHeight, err := self.stateStore.GetCurrentBlock()
+	if err != nil {
+		return nil, fmt.Errorf("stateStore.GetCurrentBlock error %s", err)
+	}
+	if stateHeight > target {
+		reverted, err := self.stateStore.revertTo(target, stateHeight, targetHash)
+		if err != nil {
+			return nil, fmt.Errorf("revert state error %s", err)
+		}
+		if !reverted {
+			result.SnapshotHeight, err = self.restoreSnapshot(target, blockPruned)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, eventHeight, err := self.eventStore.GetCurrentBlock()
+	if err != nil && err != scom.ErrNotFound {
+		return nil, fmt.Errorf("eventStore.GetCurrentBlock error %s", err)
+	}
+	if eventHeight > target {
+		self.eventStore.NewBatch()
+		for height := target + 1; height <= eventHeight; height++ {
+			txHashes, err := self.getBlockTxHashes(height)
+			if err != nil {
+				return nil, err
+			}
+			self.eventStore.PruneBlock(height, txHashes)
+		}
+		self.eventStore.SaveCurrentBlock(target, targetHash)
+		if err := self.eventStore.CommitTo(); err != nil {
+			return nil, fmt.Errorf("eventStore.CommitTo error %s", err)
+		}
+	}
+
+	for height := target + 1; height <= blockHeight; height++ {
+		if err := self.crossChainStore.DeleteCrossChainMsg(height); err != nil {
+			return nil, fmt.Errorf("delete cross chain msg of height %d error %s", height, err)
+		}
+	}
+
+	self.blockStore.NewBatch()
+	for height := target + 1; height <= blockHeight; height++ {
+		blockHash, err := self.blockStore.GetBlockHash(height)
+		if err != nil {
+			return nil, fmt.Errorf("block hash of height %d error %s", height, err)
+		}
+		self.blockStore.PruneBlock(blockHash)
+		self.blockStore.store.BatchDelete(genBlockHashKey(height))
+	}
+	if err := self.blockStore.truncateHeaderIndexList(target); err != nil {
+		return nil, err
+	}
+	self.blockStore.SaveCurrentBlock(target, targetHash)
+	if err := self.blockStore.CommitTo(); err != nil {
+		return nil, fmt.Errorf("blockStore.CommitTo error %s", err)
+	}
+
+	//the snapshots above are not the state of the chain any more
+	snapshotDir := filepath.Join(self.dataDir, DBDirSnapshot)
+	for _, height := range listSnapshotHeights(snapshotDir) {
+		if height > target {
+			os.RemoveAll(filepath.Join(snapshotDir, strconv.Itoa(int(height))))
+		}
+	}
+	return result, nil
+}
+
+func (self *ledgerStores) getBlockTxHashes(height uint32) ([]common.Uint256, error) {
+	blockHash, err := self.blockStore.GetBlockHash(height)
+	if err != nil {
+		return nil, fmt.Errorf("block hash of height %d error %s", height, err)
+	}
+	_, txHashes, err := self.blockStore.loadHeaderWithTx(blockHash)
+	if err != nil {
+		return nil, fmt.Errorf("block of height %d error %s", height, err)
+	}
+	return txHashes, nil
+}
+
+//truncateHeaderIndexList put the deletion of the header index lists containing heights above height to batch,
+//they are saved again when the blocks are added
+func (this *BlockStore) truncateHeaderIndexList(height uint32) error {
+	iter := this.store.NewIterator([]byte{byte(scom.IX_HEADER_HASH_LIST)})
+	defer iter.Release()
+	for iter.Next() {
+		startHeight, err := genStartHeightByHeaderIndexKey(iter.Key())
+		if err != nil {
+			return fmt.Errorf("genStartHeightByHeaderIndexKey error %s", err)
+		}
+		count, eof := common.NewZeroCopySource(iter.Value()).NextUint32()
+		if eof {
+			return io.ErrUnexpectedEOF
+		}
+		if startHeight+count > height+1 {
+			this.store.BatchDelete(genHeaderIndexListKey(startHeight))
+		}
+	}
+	return iter.Error()
+}
+
+//revertTo revert the state from height to target with the state history, return false if the history
+//or the merkle trees at target are not available
+func (self *StateStore) revertTo(target, height uint32, targetHash common.Uint256) (bool, error) {
+	if err := self.EnableArchive(); err != nil {
+		return false, err
+	}
+	start, tip, ok := self.GetArchiveRange()
+	if !ok || start > target || tip < height {
+		return false, nil
+	}
+	//the state merkle tree is rebuilt from the write set hashes
+	pruned, err := self.GetStatePrunedHeight()
+	if err != nil {
+		return false, err
+	}
+	if target >= self.stateHashCheckHeight && pruned != 0 && pruned >= self.stateHashCheckHeight {
+		return false, nil
+	}
+	//the block merkle tree is loaded from the hash store
+	if _, err := os.Stat(self.merklePath); err != nil {
+		return false, nil
+	}
+	hashStore, err := merkle.NewFileHashStore(self.merklePath, height+1)
+	if err != nil {
+		return false, nil
+	}
+	blockTree, err := merkle.NewTreeFromStore(target+1, hashStore)
+	hashStore.Close()
+	if err != nil {
+		return false, nil
+	}
+
+	self.NewBatch()
+	//the history of a key is reverted from the top, so the value saved by the lowest block is kept
+	for h := height; h > target; h-- {
+		if err := self.revertHeight(h); err != nil {
+			return false, fmt.Errorf("revert height %d error %s", h, err)
+		}
+	}
+	if self.archive.start > target {
+		self.store.BatchDelete(self.genArchiveRangeKey())
+	} else {
+		self.archive.tip = target
+		self.saveArchiveRange()
+	}
+	self.store.BatchPut(self.genBlockMerkleTreeKey(), encodeMerkleTree(blockTree))
+	if target >= self.stateHashCheckHeight {
+		stateTree := merkle.NewTree(0, nil, nil)
+		var root common.Uint256
+		for h := self.stateHashCheckHeight; h <= target; h++ {
+			var writeSetHash common.Uint256
+			writeSetHash, root, err = self.getStateMerkleRootEntry(h)
+			if err != nil {
+				return false, fmt.Errorf("state merkle root of height %d error %s", h, err)
+			}
+			stateTree.AppendHash(writeSetHash)
+		}
+		if stateTree.Root() != root {
+			return false, fmt.Errorf("rebuilt state merkle tree mismatch state merkle root of height %d", target)
+		}
+		self.store.BatchPut(self.genStateMerkleTreeKey(), encodeMerkleTree(stateTree))
+	} else {
+		self.store.BatchDelete(self.genStateMerkleTreeKey())
+	}
+	self.SaveCurrentBlock(target, targetHash)
+	if err := self.CommitTo(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//revertHeight put the values overwritten by the block of height to batch, and the deletion of the state
+//records of height
+func (self *StateStore) revertHeight(height uint32) error {
+	data, err := self.store.Get(genStateHistoryIndexKey(height))
+	if err != nil {
+		return err
+	}
+	source := common.NewZeroCopySource(data)
+	for source.Len() > 0 {
+		key, _, irregular, eof := source.NextVarBytes()
+		if irregular || eof {
+			return io.ErrUnexpectedEOF
+		}
+		historyKey := genStateHistoryKey(key, height)
+		old, err := self.store.Get(historyKey)
+		if err != nil {
+			return err
+		}
+		if len(old) == 0 {
+			self.store.BatchDelete(key)
+		} else {
+			self.store.BatchPut(key, old)
+		}
+		self.store.BatchDelete(historyKey)
+	}
+	self.store.BatchDelete(genStateHistoryIndexKey(height))
+	self.store.BatchDelete(self.genStateMerkleRootKey(height))
+	self.store.BatchDelete(self.genCrossStatesKey(height))
+	self.store.BatchDelete(self.genStateCheckpointKey(height))
+	return nil
+}
+
+//restoreSnapshot replace the state with the latest snapshot not above target, whose blocks are not pruned.
+//The blocks above snapshot are executed again when ledger starts
+func (self *ledgerStores) restoreSnapshot(target, blockPruned uint32) (uint32, error) {
+	snapshotDir := filepath.Join(self.dataDir, DBDirSnapshot)
+	heights := listSnapshotHeights(snapshotDir)
+	for i := len(heights) - 1; i >= 0; i-- {
+		height := heights[i]
+		if height > target {
+			continue
+		}
+		if height < blockPruned {
+			break
+		}
+		snapshot, err := readSnapshotManifest(snapshotDir, height)
+		if err != nil {
+			continue
+		}
+		if blockHash, err := self.blockStore.GetBlockHash(height); err != nil || blockHash != snapshot.BlockHash {
+			continue
+		}
+		chunks := make([][]byte, 0, len(snapshot.ChunkHashes))
+		for index, hash := range snapshot.ChunkHashes {
+			chunk, err := ioutil.ReadFile(filepath.Join(snapshotDir, strconv.Itoa(int(height)), strconv.Itoa(index)))
+			if err != nil || types.StateChunkHash(chunk) != hash {
+				chunks = nil
+				break
+			}
+			chunks = append(chunks, chunk)
+		}
+		if chunks == nil {
+			continue
+		}
+		if err := self.stateStore.importSnapshot(snapshot, chunks); err != nil {
+			return 0, fmt.Errorf("restore state snapshot at height %d error %s", height, err)
+		}
+		return height, nil
+	}
+	return 0, fmt.Errorf("state at height %d can not be restored, neither the state history nor a state snapshot "+
+		"not above it is available", target)
+}
+
+//importSnapshot replace the state with the snapshot. The merkle hash store is kept, the hashes of the block merkle
+//tree above the snapshot height are ignored when the hash store is opened with the tree size of snapshot
+func (self *StateStore) importSnapshot(snapshot *types.StateSnapshot, chunks [][]byte) error {
+	self.NewBatch()
+	if err := self.clearBatch(); err != nil {
+		return err
+	}
+	for i, chunk := range chunks {
+		err := types.ForEachStateChunkEntry(chunk, func(key, value []byte) {
+			self.BatchPutRawKeyVal(key, value)
+		})
+		if err != nil {
+			return fmt.Errorf("snapshot chunk %d error %s", i, err)
+		}
+	}
+	self.SaveCurrentBlock(snapshot.Height, snapshot.BlockHash)
+	//the write set hashes and state history below the snapshot are not available, same as pruned
+	if snapshot.Height > 0 {
+		self.SaveStatePrunedHeight(snapshot.Height - 1)
+	}
+	return self.CommitTo()
+}
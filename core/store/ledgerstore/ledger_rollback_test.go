@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"os"
+	"testing"
+
+	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/core/genesis"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/merkle"
+	"github.com/stretchr/testify/assert"
+)
+
+//newTestChain add empty blocks to a new ledger, the state history is kept in archive mode, otherwise state
+//snapshot is saved every 4 blocks
+func newTestChain(t *testing.T, dataDir string, height uint32, archive bool) {
+	store, err := NewLedgerStore(dataDir, 0)
+	assert.Nil(t, err)
+	defer store.Close()
+	bookkeepers := []keypair.PublicKey{account.NewAccount("").PublicKey}
+	block, err := genesis.BuildGenesisBlock(bookkeepers, config.DefConfig.Genesis)
+	assert.Nil(t, err)
+	assert.Nil(t, store.InitLedgerStoreWithGenesisBlock(block, bookkeepers))
+	if archive {
+		assert.Nil(t, store.EnableArchiveMode())
+	} else {
+		store.EnableStateSnapshot(4)
+	}
+	for h := uint32(1); h <= height; h++ {
+		txRoot := common.ComputeMerkleRoot(nil)
+		header := &types.Header{
+			PrevBlockHash:    store.GetCurrentBlockHash(),
+			TransactionsRoot: txRoot,
+			BlockRoot:        store.GetBlockRootWithNewTxRoots(h, []common.Uint256{txRoot}),
+			Timestamp:        block.Header.Timestamp + h,
+			Height:           h,
+		}
+		assert.Nil(t, store.saveBlock(&types.Block{Header: header}, nil, common.UINT256_EMPTY))
+	}
+}
+
+func TestVerifyAndRollbackLedger(t *testing.T) {
+	dataDir := "test/rollback"
+	defer os.RemoveAll(dataDir)
+	newTestChain(t, dataDir, 10, true)
+
+	result, err := VerifyLedger(dataDir, 0, nil)
+	assert.Nil(t, err)
+	assert.False(t, result.Corrupted, result.Reason)
+	assert.Equal(t, uint32(10), result.BlockHeight)
+	assert.Equal(t, uint32(11), result.Verified)
+
+	rollback, err := RollbackLedger(dataDir, 0, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(10), rollback.From)
+	assert.Equal(t, uint32(0), rollback.SnapshotHeight)
+	_, err = RollbackLedger(dataDir, 0, 6)
+	assert.NotNil(t, err)
+
+	result, err = VerifyLedger(dataDir, 0, nil)
+	assert.Nil(t, err)
+	assert.False(t, result.Corrupted, result.Reason)
+	assert.Equal(t, uint32(6), result.BlockHeight)
+	assert.Equal(t, uint32(6), result.StateHeight)
+
+	//the ledger continues from the height rolled back to
+	store, err := NewLedgerStore(dataDir, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, store.init())
+	assert.Equal(t, uint32(6), store.GetCurrentBlockHeight())
+	txRoot := common.ComputeMerkleRoot(nil)
+	header := &types.Header{
+		PrevBlockHash:    store.GetCurrentBlockHash(),
+		TransactionsRoot: txRoot,
+		BlockRoot:        store.GetBlockRootWithNewTxRoots(7, []common.Uint256{txRoot}),
+		Height:           7,
+	}
+	assert.Nil(t, store.saveBlock(&types.Block{Header: header}, nil, common.UINT256_EMPTY))
+	assert.Nil(t, store.Close())
+
+	stores, err := openLedgerStores(dataDir, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, stores.stateStore.store.Delete(stores.stateStore.genStateMerkleRootKey(3)))
+	result, err = stores.verify(nil)
+	stores.close()
+	assert.Nil(t, err)
+	assert.True(t, result.Corrupted)
+	assert.Equal(t, uint32(3), result.CorruptedHeight)
+}
+
+func TestRollbackLedgerWithSnapshot(t *testing.T) {
+	dataDir := "test/rollback_snapshot"
+	defer os.RemoveAll(dataDir)
+	newTestChain(t, dataDir, 10, false)
+
+	rollback, err := RollbackLedger(dataDir, 0, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), rollback.SnapshotHeight)
+	assert.Equal(t, []uint32{4}, listSnapshotHeights(dataDir+"/"+DBDirSnapshot))
+
+	//the blocks above snapshot are executed again
+	store, err := NewLedgerStore(dataDir, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, store.init())
+	assert.Equal(t, uint32(6), store.GetCurrentBlockHeight())
+	_, stateHeight, err := store.stateStore.GetCurrentBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(6), stateHeight)
+	assert.Nil(t, store.Close())
+
+	//the merkle hash store is kept and consistent with the block merkle tree rolled back
+	stores, err := openLedgerStores(dataDir, 0)
+	assert.Nil(t, err)
+	result, err := stores.verify(nil)
+	assert.Nil(t, err)
+	assert.False(t, result.Corrupted, result.Reason)
+	treeSize, hashes, err := stores.stateStore.GetBlockMerkleTree()
+	stores.close()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(7), treeSize)
+	hashStore, err := merkle.NewFileHashStore(dataDir+"/"+MerkleTreeStorePath, treeSize)
+	assert.Nil(t, err)
+	tree, err := merkle.NewTreeFromStore(treeSize, hashStore)
+	hashStore.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, merkle.NewTree(treeSize, hashes, nil).Root(), tree.Root())
+}
@@ -21,7 +21,6 @@ package ledgerstore
 import (
 	"bytes"
 	"crypto/sha256"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"hash"
@@ -35,7 +34,6 @@ import (
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/common/log"
-	"github.com/saveio/themis/common/serialization"
 	vconfig "github.com/saveio/themis/consensus/vbft/config"
 	"github.com/saveio/themis/core/payload"
 	"github.com/saveio/themis/core/signature"
@@ -95,25 +93,60 @@ type LedgerStoreImp struct {
 	savingBlockSemaphore       chan bool
 	closing                    bool
 	preserveBlockHistoryLength uint32 // block could be pruned if blockHeight + preserveBlockHistoryLength < currHeight , disable prune if equals 0
+	preserveStateHistoryLength uint32 // state records of height could be pruned if height + preserveStateHistoryLength < currHeight, disable prune if equals 0
+	snapshotDir                string // state snapshot save path
+	snapshotInterval           uint32 // save state snapshot every snapshotInterval blocks, disable snapshot if equals 0
+	stateCheckpointInterval    uint32 // calculate state checkpoint root every stateCheckpointInterval blocks
+	snapshotSaving             int32  // whether a state snapshot is saving in background
+	snapshotWg                 sync.WaitGroup
+	lightMode                  bool          // only headers are saved, transactions and states are not available
+	quit                       chan struct{} // closed when ledger is closing, stop the jobs running in background
+	eventIndexWg               sync.WaitGroup
+	checkpointLock             sync.Mutex
+	checkpointTasks            map[uint32]chan struct{} // state checkpoint height => closed when the root calculated in background
+	checkpointWg               sync.WaitGroup
+
+	pipelineLock sync.Mutex     // serialize the blocks added in pipeline
+	pending      *pendingCommit // the block being committed in background, nil if none
+}
+
+//pendingCommit is a block executed and being committed to leveldb in background
+type pendingCommit struct {
+	height   uint32
+	writeSet *overlaydb.MemDB
+	done     chan struct{}
+	err      error
 }
 
 //NewLedgerStore return LedgerStoreImp instance
 func NewLedgerStore(dataDir string, stateHashHeight uint32) (*LedgerStoreImp, error) {
+	backend, err := ResolveStoreBackend(dataDir, config.DefConfig.Common.StoreBackend)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveStoreBackend(dataDir, backend); err != nil {
+		return nil, fmt.Errorf("SaveStoreBackend error %s", err)
+	}
 	ledgerStore := &LedgerStoreImp{
 		headerIndex:          make(map[uint32]common.Uint256),
 		headerCache:          make(map[common.Uint256]*types.Header, 0),
 		vbftPeerInfoMap:      make(map[uint32]map[string]uint32),
 		savingBlockSemaphore: make(chan bool, 1),
+		quit:                 make(chan struct{}),
+		checkpointTasks:      make(map[uint32]chan struct{}),
 		stateHashCheckHeight: stateHashHeight,
+		snapshotDir:          fmt.Sprintf("%s%s%s", dataDir, string(os.PathSeparator), DBDirSnapshot),
+
+		stateCheckpointInterval: config.STATE_CHECKPOINT_INTERVAL,
 	}
 
-	blockStore, err := NewBlockStore(fmt.Sprintf("%s%s%s", dataDir, string(os.PathSeparator), DBDirBlock), true)
+	blockStore, err := NewBlockStore(backend, fmt.Sprintf("%s%s%s", dataDir, string(os.PathSeparator), DBDirBlock), true)
 	if err != nil {
 		return nil, fmt.Errorf("NewBlockStore error %s", err)
 	}
 	ledgerStore.blockStore = blockStore
 
-	crossChainStore, err := NewCrossChainStore(dataDir)
+	crossChainStore, err := NewCrossChainStore(backend, dataDir)
 	if err != nil {
 		return nil, fmt.Errorf("NewBlockStore error %s", err)
 	}
@@ -121,13 +154,13 @@ func NewLedgerStore(dataDir string, stateHashHeight uint32) (*LedgerStoreImp, er
 
 	dbPath := fmt.Sprintf("%s%s%s", dataDir, string(os.PathSeparator), DBDirState)
 	merklePath := fmt.Sprintf("%s%s%s", dataDir, string(os.PathSeparator), MerkleTreeStorePath)
-	stateStore, err := NewStateStore(dbPath, merklePath, stateHashHeight)
+	stateStore, err := NewStateStore(backend, dbPath, merklePath, stateHashHeight)
 	if err != nil {
 		return nil, fmt.Errorf("NewStateStore error %s", err)
 	}
 	ledgerStore.stateStore = stateStore
 
-	eventState, err := NewEventStore(fmt.Sprintf("%s%s%s", dataDir, string(os.PathSeparator), DBDirEvent))
+	eventState, err := NewEventStore(backend, fmt.Sprintf("%s%s%s", dataDir, string(os.PathSeparator), DBDirEvent))
 	if err != nil {
 		return nil, fmt.Errorf("NewEventStore error %s", err)
 	}
@@ -177,6 +210,10 @@ func (this *LedgerStoreImp) InitLedgerStoreWithGenesisBlock(genesisBlock *types.
 		if err != nil {
 			return fmt.Errorf("init error %s", err)
 		}
+		err = this.eventStore.SaveEventIndexVersion()
+		if err != nil {
+			return fmt.Errorf("SaveEventIndexVersion error %s", err)
+		}
 		genHash := genesisBlock.Hash()
 		log.Infof("GenesisBlock init success. GenesisBlock hash:%s\n", genHash.ToHexString())
 	} else {
@@ -265,6 +302,11 @@ func (this *LedgerStoreImp) init() error {
 	if err != nil {
 		return fmt.Errorf("recoverStore error %s", err)
 	}
+	err = this.startEventIndexBuild()
+	if err != nil {
+		return fmt.Errorf("startEventIndexBuild error %s", err)
+	}
+	this.resumeStateCheckpoint()
 	return nil
 }
 
@@ -311,7 +353,9 @@ func (this *LedgerStoreImp) recoverStore() error {
 	if err != nil {
 		return fmt.Errorf("stateStore.GetCurrentBlock error %s", err)
 	}
-	for i := stateHeight; i < blockHeight; i++ {
+	//the block store is committed before the state store, so the blocks after the state height up to the block
+	//height are saved but not executed if the node crashed in between. The block at state height is executed already
+	for i := stateHeight + 1; i <= blockHeight; i++ {
 		blockHash, err := this.blockStore.GetBlockHash(i)
 		if err != nil {
 			return fmt.Errorf("blockStore.GetBlockHash height:%d error:%s", i, err)
@@ -560,6 +604,9 @@ func (this *LedgerStoreImp) AddHeader(header *types.Header) error {
 	if err != nil {
 		return fmt.Errorf("verifyHeader error %s", err)
 	}
+	if this.IsLightMode() {
+		return this.saveLightHeader(header)
+	}
 	this.addHeaderCache(header)
 	this.setHeaderIndex(header.Height, header.Hash())
 	return nil
@@ -619,6 +666,9 @@ func (this *LedgerStoreImp) SubmitBlock(block *types.Block, ccMsg *types.CrossCh
 		return fmt.Errorf("block height %d not equal next block height %d", blockHeight, nextBlockHeight)
 	}
 
+	if this.IsLightMode() {
+		return this.AddHeader(block.Header)
+	}
 	err := this.verifyHeader(block.Header)
 	if err != nil {
 		return fmt.Errorf("verifyHeader error %s", err)
@@ -686,12 +736,156 @@ func (this *LedgerStoreImp) AddBlock(block *types.Block, ccMsg *types.CrossChain
 	}
 	err = this.saveBlock(block, ccMsg, stateMerkleRoot)
 	if err != nil {
-		return fmt.Errorf("saveBlock error %s", err)
+		return fmt.Errorf("saveBlock error %w", err)
 	}
 	this.delHeaderCache(block.Hash())
 	return nil
 }
 
+//AddBlockPipelined add the next block while the previous one is still being committed. The block is
+//executed on top of the write set of the committing block, then committed in background once the
+//previous commit finished, so execution of block N+1 overlaps with the commit of block N.
+//The error of the background commit is returned by the next call or WaitBlockCommitted.
+func (this *LedgerStoreImp) AddBlockPipelined(block *types.Block, ccMsg *types.CrossChainMsg, stateMerkleRoot common.Uint256) error {
+	this.pipelineLock.Lock()
+	defer this.pipelineLock.Unlock()
+
+	var pendingWriteSet *overlaydb.MemDB
+	currBlockHeight := this.GetCurrentBlockHeight()
+	if p := this.pending; p != nil {
+		currBlockHeight = p.height
+		pendingWriteSet = p.writeSet
+	}
+	blockHeight := block.Header.Height
+	if blockHeight <= currBlockHeight {
+		return nil
+	}
+	if blockHeight != currBlockHeight+1 {
+		return fmt.Errorf("block height %d not equal next block height %d", blockHeight, currBlockHeight+1)
+	}
+	//cross chain msg and light mode need the committed states, fallback to add block serially
+	if ccMsg != nil || this.IsLightMode() {
+		if err := this.waitPendingCommit(); err != nil {
+			return err
+		}
+		return this.AddBlock(block, ccMsg, stateMerkleRoot)
+	}
+	err := this.verifyHeader(block.Header)
+	if err != nil {
+		return fmt.Errorf("verifyHeader error %s", err)
+	}
+	result, err := this.executeBlockOn(block, pendingWriteSet)
+	if err != nil {
+		return err
+	}
+	//empty block does not check stateMerkleRoot
+	if len(block.Transactions) != 0 && result.MerkleRoot != stateMerkleRoot {
+		return fmt.Errorf("state merkle root mismatch. expected: %s, got: %s",
+			result.MerkleRoot.ToHexString(), stateMerkleRoot.ToHexString())
+	}
+	if err := this.waitPendingCommit(); err != nil {
+		return err
+	}
+
+	this.getSavingBlockLock()
+	if this.closing {
+		this.releaseSavingBlockLock()
+		return fmt.Errorf("%w, ledger is closing", scom.ErrCommitBlock)
+	}
+	if blockHeight != this.GetCurrentBlockHeight()+1 {
+		this.releaseSavingBlockLock()
+		return fmt.Errorf("%w, block height %d not equal next block height %d", scom.ErrCommitBlock,
+			blockHeight, this.GetCurrentBlockHeight()+1)
+	}
+	err = this.prepareBlock(block, nil, result)
+	if err != nil {
+		this.releaseSavingBlockLock()
+		return fmt.Errorf("saveBlock error %w", err)
+	}
+	p := &pendingCommit{
+		height:   blockHeight,
+		writeSet: result.WriteSet,
+		done:     make(chan struct{}),
+	}
+	this.pending = p
+	//the saving lock is held until the commit finished, and released by the commit goroutine. It is a
+	//channel semaphore, so it is not bound to the goroutine taking it
+	go func() {
+		defer close(p.done)
+		defer this.releaseSavingBlockLock()
+		p.err = this.commitBlock(block)
+		if p.err != nil {
+			log.Errorf("commit block height:%d error:%s", blockHeight, p.err)
+			return
+		}
+		this.delHeaderCache(block.Hash())
+	}()
+	return nil
+}
+
+//WaitBlockCommitted wait until the block added by AddBlockPipelined is committed
+func (this *LedgerStoreImp) WaitBlockCommitted() error {
+	this.pipelineLock.Lock()
+	defer this.pipelineLock.Unlock()
+	return this.waitPendingCommit()
+}
+
+func (this *LedgerStoreImp) waitPendingCommit() error {
+	p := this.pending
+	if p == nil {
+		return nil
+	}
+	<-p.done
+	this.pending = nil
+	if p.err != nil {
+		return fmt.Errorf("commit block height:%d error %w", p.height, p.err)
+	}
+	return nil
+}
+
+//saveLightHeader saves the verified header as the current block in light mode, the transactions are not saved.
+//The current block of state store is moved along, so the header only blocks are never executed
+func (this *LedgerStoreImp) saveLightHeader(header *types.Header) error {
+	this.getSavingBlockLock()
+	defer this.releaseSavingBlockLock()
+	if this.closing {
+		return errors.NewErr("save header error: ledger is closing")
+	}
+	blockHash := header.Hash()
+	blockHeight := header.Height
+
+	this.blockStore.NewBatch()
+	this.stateStore.NewBatch()
+	this.setHeaderIndex(blockHeight, blockHash)
+	err := this.saveHeaderIndexList()
+	if err != nil {
+		return fmt.Errorf("saveHeaderIndexList error %s", err)
+	}
+	err = this.blockStore.SaveCurrentBlock(blockHeight, blockHash)
+	if err != nil {
+		return fmt.Errorf("SaveCurrentBlock error %s", err)
+	}
+	this.blockStore.SaveBlockHash(blockHeight, blockHash)
+	err = this.blockStore.SaveHeader(&types.Block{Header: header}, 0)
+	if err != nil {
+		return fmt.Errorf("SaveHeader height %d hash %s error %s", blockHeight, blockHash.ToHexString(), err)
+	}
+	err = this.stateStore.SaveCurrentBlock(blockHeight, blockHash)
+	if err != nil {
+		return fmt.Errorf("SaveCurrentBlock error %s", err)
+	}
+	err = this.blockStore.CommitTo()
+	if err != nil {
+		return fmt.Errorf("blockStore.CommitTo height:%d error %s", blockHeight, err)
+	}
+	err = this.stateStore.CommitTo()
+	if err != nil {
+		return fmt.Errorf("stateStore.CommitTo height:%d error %s", blockHeight, err)
+	}
+	this.setCurrentBlock(blockHeight, blockHash)
+	return nil
+}
+
 func (this *LedgerStoreImp) saveBlockToBlockStore(block *types.Block) error {
 	blockHash := block.Hash()
 	blockHeight := block.Header.Height
@@ -714,7 +908,20 @@ func (this *LedgerStoreImp) saveBlockToBlockStore(block *types.Block) error {
 }
 
 func (this *LedgerStoreImp) executeBlock(block *types.Block) (result store.ExecuteResult, err error) {
-	overlay := this.stateStore.NewOverlayDB()
+	return this.executeBlockOn(block, nil)
+}
+
+//newStateOverlay return the overlay reading the pending write set of the block being committed first
+func (this *LedgerStoreImp) newStateOverlay(pending *overlaydb.MemDB) *overlaydb.OverlayDB {
+	if pending == nil {
+		return this.stateStore.NewOverlayDB()
+	}
+	return overlaydb.NewOverlayDB(overlaydb.NewLayeredStore(this.stateStore.store, pending))
+}
+
+//executeBlockOn execute the block on top of the pending write set, pending is nil if no block is being committed
+func (this *LedgerStoreImp) executeBlockOn(block *types.Block, pending *overlaydb.MemDB) (result store.ExecuteResult, err error) {
+	overlay := this.newStateOverlay(pending)
 	if block.Header.Height != 0 {
 		config := &smartcontract.Config{
 			Time:   block.Header.Timestamp,
@@ -722,7 +929,7 @@ func (this *LedgerStoreImp) executeBlock(block *types.Block) (result store.Execu
 			Tx:     &types.Transaction{},
 		}
 
-		err = refreshGlobalParam(config, storage.NewCacheDB(this.stateStore.NewOverlayDB()), this)
+		err = refreshGlobalParam(config, storage.NewCacheDB(this.newStateOverlay(pending)), this)
 		if err != nil {
 			return
 		}
@@ -807,8 +1014,12 @@ func (this *LedgerStoreImp) saveBlockToStateStore(block *types.Block, result sto
 	blockHash := block.Hash()
 	blockHeight := block.Header.Height
 
+	txIndex := make(map[common.Uint256]uint32, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txIndex[tx.Hash()] = uint32(i)
+	}
 	for _, notify := range result.Notify {
-		SaveNotify(this.eventStore, notify.TxHash, notify)
+		SaveNotify(this.eventStore, blockHeight, txIndex[notify.TxHash], notify.TxHash, notify)
 	}
 
 	err := this.stateStore.AddStateMerkleTreeRoot(blockHeight, result.Hash)
@@ -833,6 +1044,11 @@ func (this *LedgerStoreImp) saveBlockToStateStore(block *types.Block, result sto
 
 	log.Debugf("the state transition hash of block %d is:%s", blockHeight, result.Hash.ToHexString())
 
+	err = this.stateStore.saveStateHistory(blockHeight, result.WriteSet)
+	if err != nil {
+		return fmt.Errorf("saveStateHistory error %s", err)
+	}
+
 	result.WriteSet.ForEach(func(key, val []byte) {
 		if len(val) == 0 {
 			this.stateStore.BatchDeleteRawKey(key)
@@ -908,9 +1124,53 @@ func (this *LedgerStoreImp) tryPruneBlock(header *types.Header) bool {
 	return true
 }
 
+//tryPruneState prune the state records older than the preserved history, at most pruneBatchSize heights each block
+func (this *LedgerStoreImp) tryPruneState(header *types.Header) bool {
+	if this.preserveStateHistoryLength == 0 || header.Height <= this.preserveStateHistoryLength {
+		return false
+	}
+	height := this.maxAllowedPruneHeight(header)
+	if height+this.preserveStateHistoryLength >= header.Height {
+		height = header.Height - this.preserveStateHistoryLength
+	}
+	pruned, err := this.stateStore.GetStatePrunedHeight()
+	if err != nil {
+		return false
+	}
+	if pruned >= height {
+		return false
+	}
+
+	pruneHeight := pruned + 1
+	for ; pruneHeight-pruned <= pruneBatchSize && pruneHeight <= height; pruneHeight++ {
+		if err := this.stateStore.PruneHeight(pruneHeight); err != nil {
+			log.Errorf("prune state at height %d error: %s", pruneHeight, err)
+			break
+		}
+		if err := this.crossChainStore.DeleteCrossChainMsg(pruneHeight); err != nil {
+			log.Errorf("prune cross chain msg at height %d error: %s", pruneHeight, err)
+			break
+		}
+	}
+	if pruneHeight-1 == pruned {
+		return false
+	}
+	this.stateStore.SaveStatePrunedHeight(pruneHeight - 1)
+	return true
+}
+
 //saveBlock do the job of execution samrt contract and commit block to store.
 func (this *LedgerStoreImp) submitBlock(block *types.Block, crossChainMsg *types.CrossChainMsg, result store.ExecuteResult) error {
-	blockHash := block.Hash()
+	err := this.prepareBlock(block, crossChainMsg, result)
+	if err != nil {
+		return err
+	}
+	return this.commitBlock(block)
+}
+
+//prepareBlock write the block and its execution result to the store batches, the in memory merkle trees are updated.
+//Must hold the saving block lock, so the stores read by pruning are not written meanwhile
+func (this *LedgerStoreImp) prepareBlock(block *types.Block, crossChainMsg *types.CrossChainMsg, result store.ExecuteResult) error {
 	blockHeight := block.Header.Height
 	blockRoot := this.GetBlockRootWithNewTxRoots(block.Header.Height, []common.Uint256{block.Header.TransactionsRoot})
 	if block.Header.Height != 0 && blockRoot != block.Header.BlockRoot {
@@ -923,32 +1183,42 @@ func (this *LedgerStoreImp) submitBlock(block *types.Block, crossChainMsg *types
 	this.eventStore.NewBatch()
 	err := this.saveBlockToBlockStore(block)
 	if err != nil {
-		return fmt.Errorf("save to block store height:%d error:%s", blockHeight, err)
+		return fmt.Errorf("%w, save to block store height:%d: %s", scom.ErrCommitBlock, blockHeight, err)
 	}
 	this.tryPruneBlock(block.Header)
+	this.tryPruneState(block.Header)
 	err = this.crossChainStore.SaveMsgToCrossChainStore(crossChainMsg)
 	if err != nil {
-		return fmt.Errorf("save to msg cross chain store height:%d error:%s", blockHeight, err)
+		return fmt.Errorf("%w, save to msg cross chain store height:%d: %s", scom.ErrCommitBlock, blockHeight, err)
 	}
 	err = this.saveBlockToStateStore(block, result)
 	if err != nil {
-		return fmt.Errorf("save to state store height:%d error:%s", blockHeight, err)
+		return fmt.Errorf("%w, save to state store height:%d: %s", scom.ErrCommitBlock, blockHeight, err)
 	}
 	this.saveBlockToEventStore(block)
-	err = this.blockStore.CommitTo()
+	return nil
+}
+
+//commitBlock commit the batches prepared by prepareBlock to leveldb and move the current block forward
+func (this *LedgerStoreImp) commitBlock(block *types.Block) error {
+	blockHash := block.Hash()
+	blockHeight := block.Header.Height
+	err := this.blockStore.CommitTo()
 	if err != nil {
-		return fmt.Errorf("blockStore.CommitTo height:%d error %s", blockHeight, err)
+		return fmt.Errorf("%w, blockStore.CommitTo height:%d: %s", scom.ErrCommitBlock, blockHeight, err)
 	}
 	// event store is idempotent to re-save when in recovering process, so save first before stateStore
 	err = this.eventStore.CommitTo()
 	if err != nil {
-		return fmt.Errorf("eventStore.CommitTo height:%d error %s", blockHeight, err)
+		return fmt.Errorf("%w, eventStore.CommitTo height:%d: %s", scom.ErrCommitBlock, blockHeight, err)
 	}
 	err = this.stateStore.CommitTo()
 	if err != nil {
-		return fmt.Errorf("stateStore.CommitTo height:%d error %s", blockHeight, err)
+		return fmt.Errorf("%w, stateStore.CommitTo height:%d: %s", scom.ErrCommitBlock, blockHeight, err)
 	}
 	this.setCurrentBlock(blockHeight, blockHash)
+	this.trySaveStateSnapshot(blockHeight, blockHash)
+	this.startStateCheckpoint(blockHeight)
 
 	if events.DefActorPublisher != nil {
 		events.DefActorPublisher.Publish(
@@ -969,7 +1239,7 @@ func (this *LedgerStoreImp) saveBlock(block *types.Block, ccMsg *types.CrossChai
 	this.getSavingBlockLock()
 	defer this.releaseSavingBlockLock()
 	if this.closing {
-		return errors.NewErr("save block error: ledger is closing")
+		return fmt.Errorf("%w, ledger is closing", scom.ErrCommitBlock)
 	}
 	if blockHeight > 0 && blockHeight != (this.GetCurrentBlockHeight()+1) {
 		return nil
@@ -1168,6 +1438,27 @@ func (this *LedgerStoreImp) GetStorageItem(key *states.StorageKey) (*states.Stor
 	return this.stateStore.GetStorageState(key)
 }
 
+//GetStorageItemAtHeight return the storage value of the key at height, archive mode required
+func (this *LedgerStoreImp) GetStorageItemAtHeight(key *states.StorageKey, height uint32) (*states.StorageItem, error) {
+	return this.stateStore.GetStorageStateAt(key, height)
+}
+
+//EnableArchiveMode keep the state history, so that state at the heights since enabled can be queried
+func (this *LedgerStoreImp) EnableArchiveMode() error {
+	this.getSavingBlockLock()
+	defer this.releaseSavingBlockLock()
+	return this.stateStore.EnableArchive()
+}
+
+func (this *LedgerStoreImp) IsArchiveMode() bool {
+	return this.stateStore.IsArchiveEnabled()
+}
+
+//GetArchiveRange return the first and last height of which state can be queried
+func (this *LedgerStoreImp) GetArchiveRange() (uint32, uint32, bool) {
+	return this.stateStore.GetArchiveRange()
+}
+
 //GetEventNotifyByTx return the events notify gen by executing of smart contract.  Wrap function of EventStore.GetEventNotifyByTx
 func (this *LedgerStoreImp) GetEventNotifyByTx(tx common.Uint256) (*event.ExecuteNotify, error) {
 	return this.eventStore.GetEventNotifyByTx(tx)
@@ -1201,6 +1492,25 @@ func (this *LedgerStoreImp) PreExecuteContractBatch(txes []*types.Transaction, a
 //PreExecuteContract return the result of smart contract execution without commit to store
 func (this *LedgerStoreImp) PreExecuteContractWithParam(tx *types.Transaction, preParam PrexecuteParam) (*sstate.PreExecResult, error) {
 	height := this.GetCurrentBlockHeight()
+	return this.preExecuteContract(tx, preParam, height, this.stateStore.NewOverlayDB())
+}
+
+//PreExecuteContractAtHeight return the result of smart contract execution on the state at height, archive mode required
+func (this *LedgerStoreImp) PreExecuteContractAtHeight(tx *types.Transaction, height uint32) (*sstate.PreExecResult, error) {
+	overlay, err := this.stateStore.NewOverlayDBAt(height)
+	if err != nil {
+		return nil, err
+	}
+	param := PrexecuteParam{
+		JitMode:    false,
+		WasmFactor: 0,
+		MinGas:     true,
+	}
+	return this.preExecuteContract(tx, param, height, overlay)
+}
+
+func (this *LedgerStoreImp) preExecuteContract(tx *types.Transaction, preParam PrexecuteParam, height uint32,
+	overlay *overlaydb.OverlayDB) (*sstate.PreExecResult, error) {
 	// use previous block time to make it predictable for easy test
 	blockTime := uint32(time.Now().Unix())
 	if header, err := this.GetHeaderByHeight(height); err == nil {
@@ -1215,7 +1525,6 @@ func (this *LedgerStoreImp) PreExecuteContractWithParam(tx *types.Transaction, p
 		BlockHash: this.GetBlockHash(height),
 	}
 
-	overlay := this.stateStore.NewOverlayDB()
 	cache := storage.NewCacheDB(overlay)
 	gasTable := make(map[string]uint64)
 	neovm.GAS_TABLE.Range(func(k, value interface{}) bool {
@@ -1310,160 +1619,101 @@ func (this *LedgerStoreImp) PreExecuteContract(tx *types.Transaction) (*sstate.P
 	return this.PreExecuteContractWithParam(tx, param)
 }
 
-type EventInfo struct {
-	txHash common.Uint256
-	height uint32
-}
-
+//GetEventNotifyByEventId return all the event notifies of contract with event id and participant address
 func (this *LedgerStoreImp) GetEventNotifyByEventId(contractAddress common.Address, address common.Address, eventId uint32) ([]*event.ExecuteNotify, error) {
-	txHashes, err := this.eventStore.GetEventNotifyTxHashByEventID(contractAddress, address, eventId)
+	entries, _, err := this.eventStore.QueryEventIndex(contractAddress, eventId, &address, 0, math.MaxUint64, 0)
 	if err != nil {
 		return nil, err
 	}
+	return this.getEventNotifyByIndex(entries), nil
+}
 
-	//map from block height to txHash
-	infos := []*EventInfo{}
-
-	for _, txHash := range txHashes {
-		// no way to get the block height in the event store
-		_, height, err := this.GetTransaction(txHash)
-		if err != nil {
-			return nil, err
-		}
-
-		info := &EventInfo{txHash, height}
-		infos = append(infos, info)
+//GetEventNotifyByEventIdAndHeights return the event notifies of contract with event id in heights, any participant
+//address matches if address is nil, and any height matches if endBlockHeight is 0
+func (this *LedgerStoreImp) GetEventNotifyByEventIdAndHeights(contractAddress common.Address, address []byte, eventId, startBlockHeight, endBlockHeight uint32) ([]*event.ExecuteNotify, error) {
+	var participant *common.Address
+	if address != nil {
+		participant = new(common.Address)
+		copy(participant[:], address)
 	}
-
-	// sort according to block height
-	sort.SliceStable(infos, func(i, j int) bool {
-		if infos[i].height < infos[j].height {
-			return true
-		}
-		// for txHashes who has the same block height, need to order correctly
-		return this.eventStore.GetEventNotifyOrderInBlock(infos[i].height, infos[i].txHash, infos[j].txHash)
-	})
-
-	evtNotifies := make([]*event.ExecuteNotify, 0)
-	for _, info := range infos {
-		evtNotify, err := this.GetEventNotifyByTx(info.txHash)
-		if err != nil {
-			log.Errorf("getEventNotifyByTx Height:%d by txhash:%s error:%s", info.height, info.txHash.ToHexString(), err)
-			continue
-		}
-		evtNotifies = append(evtNotifies, evtNotify)
+	start, end := uint64(0), uint64(math.MaxUint64)
+	if endBlockHeight > 0 {
+		start, end = genEventPosition(startBlockHeight, 0), genEventPosition(endBlockHeight, math.MaxUint32)
+	}
+	entries, _, err := this.eventStore.QueryEventIndex(contractAddress, eventId, participant, start, end, 0)
+	if err != nil {
+		return nil, err
 	}
-	return evtNotifies, nil
+	return this.getEventNotifyByIndex(entries), nil
 }
 
-func (this *EventStore) GetEventNotifyOrderInBlock(height uint32, hash1 common.Uint256, hash2 common.Uint256) bool {
-	key, err := this.getEventNotifyByBlockKey(height)
-	if err != nil {
-		return false
+//QueryEventNotify return a page of the event notifies matching the query
+func (this *LedgerStoreImp) QueryEventNotify(query *store.EventQuery) (*store.EventQueryResult, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = store.DEFAULT_EVENT_QUERY_LIMIT
+	} else if limit > store.MAX_EVENT_QUERY_LIMIT {
+		limit = store.MAX_EVENT_QUERY_LIMIT
 	}
-	data, err := this.store.Get(key)
-	if err != nil {
-		return false
+	endHeight := query.EndHeight
+	if endHeight == 0 {
+		endHeight = math.MaxUint32
 	}
-	reader := bytes.NewBuffer(data)
-	size, err := serialization.ReadUint32(reader)
-	if err != nil {
-		return false
+	if query.StartHeight > endHeight {
+		return nil, fmt.Errorf("start height %d is larger than end height %d", query.StartHeight, endHeight)
 	}
-
-	count := 0
-	index1 := 0
-	index2 := 0
-	for i := 0; i < int(size); i++ {
-		var txHash common.Uint256
-		err = txHash.Deserialize(reader)
+	start := genEventPosition(query.StartHeight, 0)
+	if query.Cursor != "" {
+		position, err := decodeEventCursor(query.Cursor)
 		if err != nil {
-			return false
+			return nil, err
 		}
-
-		if txHash == hash1 {
-			count++
-			index1 = i
-		} else if txHash == hash2 {
-			count++
-			index2 = i
-		}
-
-		if count == 2 {
-			return index1 < index2
+		if position+1 > start {
+			start = position + 1
 		}
 	}
-	return false
-}
-
-func (this *LedgerStoreImp) GetEventNotifyByEventIdAndHeights(contractAddress common.Address, address []byte, eventId, startBlockHeight, endBlockHeight uint32) ([]*event.ExecuteNotify, error) {
-	txHashes, err := this.eventStore.GetEventNotifyTxHashByHeights(contractAddress, address, eventId)
+	entries, more, err := this.eventStore.QueryEventIndex(query.Contract, query.EventId, query.Participant, start,
+		genEventPosition(endHeight, math.MaxUint32), limit)
 	if err != nil {
 		return nil, err
 	}
-
-	//map from block height to txHash
-	infos := []*EventInfo{}
-	txMap := make(map[common.Uint256]struct{}, 0)
-	for _, txHash := range txHashes {
-		// no way to get the block height in the event store
-		_, height, err := this.GetTransaction(txHash)
-		if err != nil {
-			return nil, err
-		}
-		if (startBlockHeight >= 0 && endBlockHeight > 0) && (height < startBlockHeight || height > endBlockHeight) {
-			continue
-		}
-
-		if _, ok := txMap[txHash]; ok {
-			continue
-		}
-
-		info := &EventInfo{txHash, height}
-		infos = append(infos, info)
-		txMap[txHash] = struct{}{}
+	result := &store.EventQueryResult{Events: this.getEventNotifyByIndex(entries)}
+	if more {
+		result.Cursor = encodeEventCursor(entries[len(entries)-1].position)
 	}
+	return result, nil
+}
 
-	// sort according to block height
-	sort.SliceStable(infos, func(i, j int) bool {
-		if infos[i].height < infos[j].height {
-			return true
-		}
-		// for txHashes who has the same block height, need to order correctly
-		return this.eventStore.GetEventNotifyOrderInBlock(infos[i].height, infos[i].txHash, infos[j].txHash)
-	})
-
-	evtNotifies := make([]*event.ExecuteNotify, 0)
-	for _, info := range infos {
-		evtNotify, err := this.GetEventNotifyByTx(info.txHash)
+func (this *LedgerStoreImp) getEventNotifyByIndex(entries []*eventIndexEntry) []*event.ExecuteNotify {
+	evtNotifies := make([]*event.ExecuteNotify, 0, len(entries))
+	for _, entry := range entries {
+		evtNotify, err := this.GetEventNotifyByTx(entry.txHash)
 		if err != nil {
-			log.Errorf("getEventNotifyByTx Height:%d by txhash:%s error:%s", info.height, info.txHash.ToHexString(), err)
+			log.Errorf("getEventNotifyByTx Height:%d by txhash:%s error:%s", entry.position>>32, entry.txHash.ToHexString(), err)
 			continue
 		}
-		if eventId != 0 {
-			eventIdNoMatch := false
-			for _, notify := range evtNotify.Notify {
-				if notify.ContractAddress.ToBase58() == contractAddress.ToBase58() && notify.EventIdentifier != eventId {
-					eventIdNoMatch = true
-					break
-				}
-			}
-			if eventIdNoMatch {
-				continue
-			}
-		}
 		evtNotifies = append(evtNotifies, evtNotify)
 	}
-	return evtNotifies, nil
+	return evtNotifies
 }
 
 //Close ledger store.
 func (this *LedgerStoreImp) Close() error {
+	// stop building event index, which get the saving block lock batch by batch
+	select {
+	case <-this.quit:
+	default:
+		close(this.quit)
+	}
+	this.eventIndexWg.Wait()
+
 	// wait block saving complete, and get the lock to avoid subsequent block saving
 	this.getSavingBlockLock()
 	defer this.releaseSavingBlockLock()
 
 	this.closing = true
+	this.snapshotWg.Wait()
+	this.checkpointWg.Wait()
 
 	err := this.blockStore.Close()
 	if err != nil {
@@ -1477,6 +1727,10 @@ func (this *LedgerStoreImp) Close() error {
 	if err != nil {
 		return fmt.Errorf("stateStore close error %s", err)
 	}
+	err = this.crossChainStore.Close()
+	if err != nil {
+		return fmt.Errorf("crossChainStore close error %s", err)
+	}
 	return nil
 }
 
@@ -1492,6 +1746,33 @@ func (this *LedgerStoreImp) EnableBlockPrune(numBeforeCurr uint32) {
 	this.preserveBlockHistoryLength = numBeforeCurr
 }
 
+//EnableStatePrune keep the write set hashes, cross chain messages and state history of the latest numBeforeCurr
+//blocks only
+func (this *LedgerStoreImp) EnableStatePrune(numBeforeCurr uint32) {
+	if numBeforeCurr < minPruneBlocksBeforeCurr {
+		numBeforeCurr = minPruneBlocksBeforeCurr
+	}
+	this.getSavingBlockLock()
+	defer this.releaseSavingBlockLock()
+
+	this.preserveStateHistoryLength = numBeforeCurr
+}
+
+//EnableLightMode only saves the verified headers since then. The light client fetches transactions and
+//states from full nodes on demand
+func (this *LedgerStoreImp) EnableLightMode() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.lightMode = true
+}
+
+//IsLightMode return whether the ledger only saves headers
+func (this *LedgerStoreImp) IsLightMode() bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.lightMode
+}
+
 func (this *LedgerStoreImp) maxAllowedPruneHeight(currHeader *types.Header) uint32 {
 	if currHeader.Height <= config.GetContractApiDeprecateHeight() {
 		return 0
@@ -1510,10 +1791,3 @@ func (this *LedgerStoreImp) maxAllowedPruneHeight(currHeader *types.Header) uint
 	}
 	return lastReferHeight - 1
 }
-
-func (this *EventStore) getEventNotifyByBlockKey(height uint32) ([]byte, error) {
-	key := make([]byte, 5, 5)
-	key[0] = byte(scom.EVENT_NOTIFY)
-	binary.LittleEndian.PutUint32(key[1:], height)
-	return key, nil
-}
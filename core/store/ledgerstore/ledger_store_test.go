@@ -19,15 +19,24 @@
 package ledgerstore
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 
-	"github.com/saveio/themis/crypto/keypair"
 	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/core/genesis"
+	"github.com/saveio/themis/core/payload"
+	"github.com/saveio/themis/core/signature"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/core/utils"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/smartcontract/event"
+	"github.com/stretchr/testify/assert"
 )
 
 var testBlockStore *BlockStore
@@ -45,14 +54,14 @@ func TestMain(m *testing.M) {
 	}
 
 	testBlockDir := "test/block"
-	testBlockStore, err = NewBlockStore(testBlockDir, false)
+	testBlockStore, err = NewBlockStore(STORE_BACKEND_LEVELDB, testBlockDir, false)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "NewBlockStore error %s\n", err)
 		return
 	}
 	testStateDir := "test/state"
 	merklePath := "test/" + MerkleTreeStorePath
-	testStateStore, err = NewStateStore(testStateDir, merklePath, 1000)
+	testStateStore, err = NewStateStore(STORE_BACKEND_LEVELDB, testStateDir, merklePath, 1000)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "NewStateStore error %s\n", err)
 		return
@@ -138,3 +147,220 @@ func TestInitLedgerStoreWithGenesisBlock(t *testing.T) {
 		return
 	}
 }
+
+//failCommitStore fails the batch commit when fail is set, used to simulate a crash in the middle of block saving
+type failCommitStore struct {
+	scom.PersistStore
+	fail bool
+}
+
+func (this *failCommitStore) BatchCommit() error {
+	if this.fail {
+		return errors.New("commit failed")
+	}
+	return this.PersistStore.BatchCommit()
+}
+
+//newSoloTestStore init a ledger with the genesis block, whose headers are signed by the single bookkeeper
+func newSoloTestStore(t *testing.T, dataDir string, genesisBlock *types.Block, bookkeepers []keypair.PublicKey) *LedgerStoreImp {
+	store, err := NewLedgerStore(dataDir, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, store.InitLedgerStoreWithGenesisBlock(genesisBlock, bookkeepers))
+	return store
+}
+
+//newDeployBlock build the next block of store deploying contracts, the block has no transaction if count is 0
+func newDeployBlock(t *testing.T, store *LedgerStoreImp, acc *account.Account, count int) *types.Block {
+	height := store.GetCurrentBlockHeight() + 1
+	txs := make([]*types.Transaction, 0, count)
+	txHashes := make([]common.Uint256, 0, count)
+	for i := 0; i < count; i++ {
+		code := []byte(fmt.Sprintf("contract %d-%d", height, i))
+		mutable, err := utils.NewDeployTransaction(code, "test", "1", "", "", "", payload.NEOVM_TYPE)
+		assert.Nil(t, err)
+		mutable.Payer = acc.Address
+		tx, err := mutable.IntoImmutable()
+		assert.Nil(t, err)
+		txs = append(txs, tx)
+		txHashes = append(txHashes, tx.Hash())
+	}
+	prevHeader, err := store.GetHeaderByHeight(height - 1)
+	assert.Nil(t, err)
+	txRoot := common.ComputeMerkleRoot(txHashes)
+	header := &types.Header{
+		PrevBlockHash:    prevHeader.Hash(),
+		TransactionsRoot: txRoot,
+		BlockRoot:        store.GetBlockRootWithNewTxRoots(height, []common.Uint256{txRoot}),
+		Timestamp:        prevHeader.Timestamp + 1,
+		Height:           height,
+		NextBookkeeper:   prevHeader.NextBookkeeper,
+		Bookkeepers:      []keypair.PublicKey{acc.PublicKey},
+	}
+	hash := header.Hash()
+	sig, err := signature.Sign(acc, hash[:])
+	assert.Nil(t, err)
+	header.SigData = [][]byte{sig}
+	return &types.Block{Header: header, Transactions: txs}
+}
+
+func TestRecoverStore(t *testing.T) {
+	serialDir, crashDir := "test/recover_serial", "test/recover"
+	defer os.RemoveAll(serialDir)
+	defer os.RemoveAll(crashDir)
+
+	acc := account.NewAccount("")
+	bookkeepers := []keypair.PublicKey{acc.PublicKey}
+	genesisBlock, err := genesis.BuildGenesisBlock(bookkeepers, config.DefConfig.Genesis)
+	assert.Nil(t, err)
+	//the headers are verified by the signature of the single bookkeeper
+	origin := config.DefConfig.Genesis
+	genesisCfg := *origin
+	genesisCfg.ConsensusType = config.CONSENSUS_TYPE_SOLO
+	config.DefConfig.Genesis = &genesisCfg
+	defer func() { config.DefConfig.Genesis = origin }()
+
+	const blockCount = 4
+	serial := newSoloTestStore(t, serialDir, genesisBlock, bookkeepers)
+	defer serial.Close()
+	blocks := make([]*types.Block, 0, blockCount)
+	stateRoots := make([]common.Uint256, 0, blockCount)
+	for i := 0; i < blockCount; i++ {
+		block := newDeployBlock(t, serial, acc, 2)
+		result, err := serial.executeBlock(block)
+		assert.Nil(t, err)
+		assert.Nil(t, serial.AddBlock(block, nil, result.MerkleRoot))
+		blocks = append(blocks, block)
+		stateRoots = append(stateRoots, result.MerkleRoot)
+	}
+
+	//the node crashes after the last block is committed to block store but before to state store
+	crashed := newSoloTestStore(t, crashDir, genesisBlock, bookkeepers)
+	for i := 0; i < blockCount-1; i++ {
+		assert.Nil(t, crashed.AddBlock(blocks[i], nil, stateRoots[i]))
+	}
+	failStore := &failCommitStore{PersistStore: crashed.stateStore.store, fail: true}
+	crashed.stateStore.store = failStore
+	assert.NotNil(t, crashed.AddBlock(blocks[blockCount-1], nil, stateRoots[blockCount-1]))
+	failStore.fail = false
+	assert.Nil(t, crashed.Close())
+
+	//the state is recovered by executing the blocks after the state height up to the block height, the block
+	//at state height is not executed again
+	crashed = newSoloTestStore(t, crashDir, genesisBlock, bookkeepers)
+	defer crashed.Close()
+	_, stateHeight, err := crashed.stateStore.GetCurrentBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, serial.GetCurrentBlockHeight(), stateHeight)
+	treeSize, _, err := crashed.stateStore.GetStateMerkleTree()
+	assert.Nil(t, err)
+	expectSize, _, err := serial.stateStore.GetStateMerkleTree()
+	assert.Nil(t, err)
+	assert.Equal(t, expectSize, treeSize)
+	for _, block := range blocks {
+		height := block.Header.Height
+		expectRoot, err := serial.GetStateMerkleRoot(height)
+		assert.Nil(t, err)
+		root, err := crashed.GetStateMerkleRoot(height)
+		assert.Nil(t, err)
+		assert.Equal(t, expectRoot, root, "height %d", height)
+		for _, tx := range block.Transactions {
+			contract, err := crashed.GetContractState(tx.Payload.(*payload.DeployCode).Address())
+			assert.Nil(t, err)
+			assert.NotNil(t, contract)
+		}
+	}
+}
+
+func TestAddBlockPipelined(t *testing.T) {
+	serialDir, pipelineDir := "test/pipeline_serial", "test/pipeline"
+	defer os.RemoveAll(serialDir)
+	defer os.RemoveAll(pipelineDir)
+
+	acc := account.NewAccount("")
+	bookkeepers := []keypair.PublicKey{acc.PublicKey}
+	genesisBlock, err := genesis.BuildGenesisBlock(bookkeepers, config.DefConfig.Genesis)
+	assert.Nil(t, err)
+	//the headers are verified by the signature of the single bookkeeper
+	origin := config.DefConfig.Genesis
+	genesisCfg := *origin
+	genesisCfg.ConsensusType = config.CONSENSUS_TYPE_SOLO
+	config.DefConfig.Genesis = &genesisCfg
+	defer func() { config.DefConfig.Genesis = origin }()
+
+	//add the blocks serially, the empty blocks are in between
+	const blockCount = 12
+	serial := newSoloTestStore(t, serialDir, genesisBlock, bookkeepers)
+	defer serial.Close()
+	blocks := make([]*types.Block, 0, blockCount)
+	stateRoots := make([]common.Uint256, 0, blockCount)
+	for i := 0; i < blockCount; i++ {
+		block := newDeployBlock(t, serial, acc, (i%3)*2)
+		result, err := serial.executeBlock(block)
+		assert.Nil(t, err)
+		assert.Nil(t, serial.AddBlock(block, nil, result.MerkleRoot))
+		blocks = append(blocks, block)
+		stateRoots = append(stateRoots, result.MerkleRoot)
+	}
+
+	//the same blocks are added in pipeline, the commit of a block fails partway
+	const failIndex = 7
+	pipeline := newSoloTestStore(t, pipelineDir, genesisBlock, bookkeepers)
+	for i := 0; i < failIndex; i++ {
+		assert.Nil(t, pipeline.AddBlockPipelined(blocks[i], nil, stateRoots[i]))
+	}
+	assert.Nil(t, pipeline.WaitBlockCommitted())
+	failStore := &failCommitStore{PersistStore: pipeline.blockStore.store, fail: true}
+	pipeline.blockStore.store = failStore
+	assert.Nil(t, pipeline.AddBlockPipelined(blocks[failIndex], nil, stateRoots[failIndex]))
+	err = pipeline.AddBlockPipelined(blocks[failIndex+1], nil, stateRoots[failIndex+1])
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "commit failed")
+	assert.True(t, errors.Is(err, scom.ErrCommitBlock))
+	assert.Equal(t, blocks[failIndex-1].Header.Height, pipeline.GetCurrentBlockHeight())
+	//the error is reported once, and the saving lock taken by the failed commit is released
+	assert.Nil(t, pipeline.WaitBlockCommitted())
+	assert.False(t, pipeline.tryGetSavingBlockLock())
+	pipeline.releaseSavingBlockLock()
+	failStore.fail = false
+	assert.Nil(t, pipeline.Close())
+
+	//the ledger recovers from the last committed block and continues the pipeline
+	pipeline = newSoloTestStore(t, pipelineDir, genesisBlock, bookkeepers)
+	defer pipeline.Close()
+	assert.Equal(t, blocks[failIndex-1].Header.Height, pipeline.GetCurrentBlockHeight())
+	//invalid block is not a commit error
+	err = pipeline.AddBlockPipelined(blocks[failIndex], nil, common.UINT256_EMPTY)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, scom.ErrCommitBlock))
+	for i := failIndex; i < blockCount; i++ {
+		assert.Nil(t, pipeline.AddBlockPipelined(blocks[i], nil, stateRoots[i]))
+	}
+	assert.Nil(t, pipeline.WaitBlockCommitted())
+
+	assert.Equal(t, serial.GetCurrentBlockHeight(), pipeline.GetCurrentBlockHeight())
+	assert.Equal(t, serial.GetCurrentBlockHash(), pipeline.GetCurrentBlockHash())
+	nextHeight := serial.GetCurrentBlockHeight() + 1
+	assert.Equal(t, serial.GetBlockRootWithNewTxRoots(nextHeight, nil), pipeline.GetBlockRootWithNewTxRoots(nextHeight, nil))
+	for _, block := range blocks {
+		height := block.Header.Height
+		expectRoot, err := serial.GetStateMerkleRoot(height)
+		assert.Nil(t, err)
+		root, err := pipeline.GetStateMerkleRoot(height)
+		assert.Nil(t, err)
+		assert.Equal(t, expectRoot, root, "height %d", height)
+
+		//no event of the empty block
+		expectEvents, expectErr := serial.GetEventNotifyByBlock(height)
+		events, err := pipeline.GetEventNotifyByBlock(height)
+		assert.Equal(t, expectErr, err, "height %d", height)
+		assert.Equal(t, expectEvents, events, "height %d", height)
+		for _, tx := range block.Transactions {
+			notify, err := pipeline.GetEventNotifyByTx(tx.Hash())
+			assert.Nil(t, err)
+			assert.Equal(t, event.CONTRACT_STATE_SUCCESS, notify.State)
+			contract, err := pipeline.GetContractState(tx.Payload.(*payload.DeployCode).Address())
+			assert.Nil(t, err)
+			assert.NotNil(t, contract)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/saveio/themis/common"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/merkle"
+)
+
+//ledgerStores are the stores of a stopped ledger, opened without recovering, so that they can be inspected and repaired
+type ledgerStores struct {
+	dataDir         string
+	blockStore      *BlockStore
+	stateStore      *StateStore
+	eventStore      *EventStore
+	crossChainStore *CrossChainStore
+}
+
+func openLedgerStores(dataDir string, stateHashCheckHeight uint32) (*ledgerStores, error) {
+	backend, err := ResolveStoreBackend(dataDir, "")
+	if err != nil {
+		return nil, err
+	}
+	stores := &ledgerStores{dataDir: dataDir}
+	blockDir := filepath.Join(dataDir, DBDirBlock)
+	stores.blockStore, err = NewBlockStore(backend, blockDir, false)
+	if err != nil {
+		return nil, fmt.Errorf("open %s error %s, is the node running?", blockDir, err)
+	}
+	stateDir := filepath.Join(dataDir, DBDirState)
+	store, err := NewPersistStore(backend, stateDir)
+	if err != nil {
+		stores.close()
+		return nil, fmt.Errorf("open %s error %s", stateDir, err)
+	}
+	//the merkle trees are not loaded, they may be inconsistent with the stores
+	stores.stateStore = &StateStore{
+		dbDir:                stateDir,
+		store:                store,
+		merklePath:           filepath.Join(dataDir, MerkleTreeStorePath),
+		stateHashCheckHeight: stateHashCheckHeight,
+	}
+	eventDir := filepath.Join(dataDir, DBDirEvent)
+	stores.eventStore, err = NewEventStore(backend, eventDir)
+	if err != nil {
+		stores.close()
+		return nil, fmt.Errorf("open %s error %s", eventDir, err)
+	}
+	stores.crossChainStore, err = NewCrossChainStore(backend, dataDir)
+	if err != nil {
+		stores.close()
+		return nil, err
+	}
+	return stores, nil
+}
+
+func (self *ledgerStores) close() {
+	if self.blockStore != nil {
+		self.blockStore.Close()
+	}
+	if self.stateStore != nil {
+		self.stateStore.Close()
+	}
+	if self.eventStore != nil {
+		self.eventStore.Close()
+	}
+	if self.crossChainStore != nil {
+		self.crossChainStore.Close()
+	}
+}
+
+//getStateMerkleRootEntry return the write set hash and the state merkle root saved at height
+func (self *StateStore) getStateMerkleRootEntry(height uint32) (common.Uint256, common.Uint256, error) {
+	value, err := self.store.Get(self.genStateMerkleRootKey(height))
+	if err != nil {
+		return common.Uint256{}, common.Uint256{}, err
+	}
+	source := common.NewZeroCopySource(value)
+	writeSetHash, eof := source.NextHash()
+	if eof {
+		return common.Uint256{}, common.Uint256{}, io.ErrUnexpectedEOF
+	}
+	root, eof := source.NextHash()
+	if eof {
+		return common.Uint256{}, common.Uint256{}, io.ErrUnexpectedEOF
+	}
+	return writeSetHash, root, nil
+}
+
+//VerifyResult is the outcome of ledger verification
+type VerifyResult struct {
+	BlockHeight       uint32 //Current block height of block store
+	StateHeight       uint32 //Current block height of state store
+	EventHeight       uint32 //Current block height of event store
+	BlockPrunedHeight uint32
+	StatePrunedHeight uint32
+	Verified          uint32 //Number of heights verified
+	Corrupted         bool   //Whether an inconsistency is found
+	CorruptedHeight   uint32 //The first inconsistent height
+	Reason            string //The inconsistency found at CorruptedHeight
+}
+
+func (self *VerifyResult) corrupt(height uint32, format string, args ...interface{}) *VerifyResult {
+	self.Corrupted = true
+	self.CorruptedHeight = height
+	self.Reason = fmt.Sprintf(format, args...)
+	return self
+}
+
+//VerifyLedger walk the chain in dataDir from genesis, check the stored headers, transactions roots, block roots
+//and state merkle roots are consistent, and report the first inconsistent height. The blocks and state records
+//pruned are skipped. The node using dataDir should be stopped. progress is called with the verified height
+func VerifyLedger(dataDir string, stateHashCheckHeight uint32, progress func(height uint32)) (*VerifyResult, error) {
+	stores, err := openLedgerStores(dataDir, stateHashCheckHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer stores.close()
+	return stores.verify(progress)
+}
+
+func (self *ledgerStores) verify(progress func(height uint32)) (*VerifyResult, error) {
+	result := &VerifyResult{}
+	var err error
+	_, result.BlockHeight, err = self.blockStore.GetCurrentBlock()
+	if err != nil {
+		return nil, fmt.Errorf("blockStore.GetCurrentBlock error %s", err)
+	}
+	_, result.StateHeight, err = self.stateStore.GetCurrentBlock()
+	if err != nil {
+		return nil, fmt.Errorf("stateStore.GetCurrentBlock error %s", err)
+	}
+	_, result.EventHeight, err = self.eventStore.GetCurrentBlock()
+	if err != nil && err != scom.ErrNotFound {
+		return nil, fmt.Errorf("eventStore.GetCurrentBlock error %s", err)
+	}
+	if result.BlockPrunedHeight, err = self.blockStore.GetBlockPrunedHeight(); err != nil {
+		return nil, err
+	}
+	if result.StatePrunedHeight, err = self.stateStore.GetStatePrunedHeight(); err != nil {
+		return nil, err
+	}
+	//the stores behind block store are recovered when ledger starts, the stores ahead can not be
+	if result.StateHeight > result.BlockHeight {
+		return result.corrupt(result.BlockHeight+1, "state store is at height %d, above block store", result.StateHeight), nil
+	}
+	if result.EventHeight > result.BlockHeight {
+		return result.corrupt(result.BlockHeight+1, "event store is at height %d, above block store", result.EventHeight), nil
+	}
+	headerIndex, err := self.blockStore.GetHeaderIndexList()
+	if err != nil {
+		return nil, err
+	}
+
+	//the block merkle tree is rebuilt from genesis if no block is pruned, otherwise the tree before the first
+	//unpruned block is loaded from the hash store
+	var blockTree *merkle.CompactMerkleTree
+	var hashStore merkle.HashStore
+	if result.BlockPrunedHeight == 0 {
+		blockTree = merkle.NewTree(0, nil, nil)
+	} else if _, err := os.Stat(self.stateStore.merklePath); err == nil {
+		hashStore, err = merkle.NewFileHashStore(self.stateStore.merklePath, result.StateHeight+1)
+		if err != nil {
+			return result.corrupt(result.StateHeight, "merkle hash store error %s", err), nil
+		}
+		defer hashStore.Close()
+	}
+	//the state merkle tree could only be rebuilt if no write set hash is pruned
+	checkHeight := self.stateStore.stateHashCheckHeight
+	var stateTree *merkle.CompactMerkleTree
+	if result.StatePrunedHeight == 0 || result.StatePrunedHeight < checkHeight {
+		stateTree = merkle.NewTree(0, nil, nil)
+	}
+
+	prevHash := common.UINT256_EMPTY
+	for height := uint32(0); height <= result.BlockHeight; height++ {
+		if progress != nil && height%10000 == 0 {
+			progress(height)
+		}
+		blockHash, err := self.blockStore.GetBlockHash(height)
+		if err != nil {
+			return result.corrupt(height, "block hash not found: %s", err), nil
+		}
+		if hash, ok := headerIndex[height]; ok && hash != blockHash {
+			return result.corrupt(height, "header index %s mismatch block hash %s",
+				hash.ToHexString(), blockHash.ToHexString()), nil
+		}
+		if height != 0 && height <= result.BlockPrunedHeight {
+			prevHash = blockHash
+			continue
+		}
+		block, err := self.blockStore.GetBlock(blockHash)
+		if err != nil {
+			return result.corrupt(height, "block %s not found: %s", blockHash.ToHexString(), err), nil
+		}
+		header := block.Header
+		if hash := header.Hash(); hash != blockHash {
+			return result.corrupt(height, "header hash %s mismatch block hash %s", hash.ToHexString(), blockHash.ToHexString()), nil
+		}
+		if header.Height != height {
+			return result.corrupt(height, "header height is %d", header.Height), nil
+		}
+		if height != 0 && prevHash != common.UINT256_EMPTY && header.PrevBlockHash != prevHash {
+			return result.corrupt(height, "prev block hash %s mismatch block hash %s of height %d",
+				header.PrevBlockHash.ToHexString(), prevHash.ToHexString(), height-1), nil
+		}
+		txHashes := make([]common.Uint256, 0, len(block.Transactions))
+		for _, tx := range block.Transactions {
+			txHashes = append(txHashes, tx.Hash())
+		}
+		if txRoot := common.ComputeMerkleRoot(txHashes); txRoot != header.TransactionsRoot {
+			return result.corrupt(height, "transactions root %s mismatch header %s",
+				txRoot.ToHexString(), header.TransactionsRoot.ToHexString()), nil
+		}
+		prevHash = blockHash
+
+		if blockTree == nil && hashStore != nil && height <= result.StateHeight {
+			tree, err := merkle.NewTreeFromStore(height, hashStore)
+			if err != nil {
+				return result.corrupt(height, "load block merkle tree error %s", err), nil
+			}
+			//the hash store is only read
+			blockTree = merkle.NewTree(tree.TreeSize(), tree.Hashes(), nil)
+		}
+		if blockTree != nil && height <= result.StateHeight {
+			blockTree.AppendHash(header.TransactionsRoot)
+			if root := blockTree.Root(); height != 0 && root != header.BlockRoot {
+				return result.corrupt(height, "block root %s mismatch header %s",
+					root.ToHexString(), header.BlockRoot.ToHexString()), nil
+			}
+		}
+		if stateTree != nil && height >= checkHeight && height <= result.StateHeight {
+			writeSetHash, root, err := self.stateStore.getStateMerkleRootEntry(height)
+			if err != nil {
+				return result.corrupt(height, "state merkle root not found: %s", err), nil
+			}
+			stateTree.AppendHash(writeSetHash)
+			if rebuilt := stateTree.Root(); rebuilt != root {
+				return result.corrupt(height, "state merkle root %s mismatch rebuilt %s",
+					root.ToHexString(), rebuilt.ToHexString()), nil
+			}
+		}
+		result.Verified++
+	}
+
+	//the merkle trees of current state must be the rebuilt ones
+	height := result.StateHeight
+	if blockTree != nil && blockTree.TreeSize() == height+1 {
+		treeSize, hashes, err := self.stateStore.GetBlockMerkleTree()
+		if err != nil {
+			return result.corrupt(height, "block merkle tree not found: %s", err), nil
+		}
+		if stored := merkle.NewTree(treeSize, hashes, nil); treeSize != height+1 || stored.Root() != blockTree.Root() {
+			return result.corrupt(height, "stored block merkle tree of size %d mismatch rebuilt", treeSize), nil
+		}
+	}
+	if stateTree != nil && height >= checkHeight {
+		treeSize, hashes, err := self.stateStore.GetStateMerkleTree()
+		if err != nil {
+			return result.corrupt(height, "state merkle tree not found: %s", err), nil
+		}
+		if stored := merkle.NewTree(treeSize, hashes, nil); treeSize != stateTree.TreeSize() || stored.Root() != stateTree.Root() {
+			return result.corrupt(height, "stored state merkle tree of size %d mismatch rebuilt", treeSize), nil
+		}
+	}
+	return result, nil
+}
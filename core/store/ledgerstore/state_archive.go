@@ -0,0 +1,287 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ledgerstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/core/states"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/core/store/overlaydb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+//In archive mode the value of every state key before it is overwritten by a block is saved as
+//ST_HISTORY + key + height, i.e. reverse diffs. The value of key at height h is the value saved by
+//the first block above h which wrote the key, or the current value if the key is not written since.
+
+//archiveRange is the range of heights the state history is continuous
+type archiveRange struct {
+	lock   sync.RWMutex
+	start  uint32 //state at height start-1 and later can be queried
+	tip    uint32 //last archived block
+	active bool   //any block archived
+}
+
+//trimTo drop the heights not above prunedHeight from range, must hold the lock
+func (self *archiveRange) trimTo(prunedHeight uint32) {
+	if !self.active || self.start > prunedHeight {
+		return
+	}
+	if prunedHeight >= self.tip {
+		self.active = false
+		return
+	}
+	self.start = prunedHeight + 1
+}
+
+func (self *StateStore) genArchiveRangeKey() []byte {
+	return []byte{byte(scom.SYS_ARCHIVE_RANGE)}
+}
+
+func genStateHistoryKey(key []byte, height uint32) []byte {
+	buf := make([]byte, 1+len(key)+4)
+	buf[0] = byte(scom.ST_HISTORY)
+	copy(buf[1:], key)
+	binary.BigEndian.PutUint32(buf[1+len(key):], height)
+	return buf
+}
+
+func genStateHistoryIndexKey(height uint32) []byte {
+	key := make([]byte, 5)
+	key[0] = byte(scom.ST_HISTORY_INDEX)
+	binary.BigEndian.PutUint32(key[1:], height)
+	return key
+}
+
+//EnableArchive load the archived range and start archiving the state history
+func (self *StateStore) EnableArchive() error {
+	data, err := self.store.Get(self.genArchiveRangeKey())
+	if err != nil && err != scom.ErrNotFound {
+		return err
+	}
+	self.archive = &archiveRange{}
+	if err == nil {
+		if len(data) != 8 {
+			return fmt.Errorf("invalid archive range length %d", len(data))
+		}
+		self.archive.start = binary.BigEndian.Uint32(data)
+		self.archive.tip = binary.BigEndian.Uint32(data[4:])
+		self.archive.active = true
+	}
+	//the history may be pruned when archive mode was disabled
+	pruned, err := self.GetStatePrunedHeight()
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		self.archive.trimTo(pruned)
+	}
+	return nil
+}
+
+func (self *StateStore) IsArchiveEnabled() bool {
+	return self.archive != nil
+}
+
+//GetArchiveRange return the heights of which state can be queried
+func (self *StateStore) GetArchiveRange() (uint32, uint32, bool) {
+	if self.archive == nil {
+		return 0, 0, false
+	}
+	self.archive.lock.RLock()
+	defer self.archive.lock.RUnlock()
+	if !self.archive.active {
+		return 0, 0, false
+	}
+	start := self.archive.start
+	if start > 0 {
+		start -= 1
+	}
+	return start, self.archive.tip, true
+}
+
+//saveStateHistory put the values overwritten by the write set of block to batch
+func (self *StateStore) saveStateHistory(height uint32, writeSet *overlaydb.MemDB) error {
+	if self.archive == nil {
+		return nil
+	}
+	var err error
+	index := common.NewZeroCopySink(nil)
+	writeSet.ForEach(func(key, val []byte) {
+		if err != nil {
+			return
+		}
+		old, e := self.store.Get(key)
+		if e != nil && e != scom.ErrNotFound {
+			err = e
+			return
+		}
+		//a key not existed is saved as empty value
+		self.store.BatchPut(genStateHistoryKey(key, height), old)
+		index.WriteVarBytes(key)
+	})
+	if err != nil {
+		return err
+	}
+	//the index is used to prune the history by height
+	self.store.BatchPut(genStateHistoryIndexKey(height), index.Bytes())
+	self.archive.lock.Lock()
+	defer self.archive.lock.Unlock()
+	//the history is not continuous, e.g. archive mode was disabled or state snapshot imported
+	if !self.archive.active || self.archive.tip+1 != height {
+		if self.archive.active {
+			log.Warnf("state history is not continuous, archive from height %d", height)
+		}
+		self.archive.start = height
+		self.archive.active = true
+	}
+	self.archive.tip = height
+	self.saveArchiveRange()
+	return nil
+}
+
+//saveArchiveRange put the archive range to batch, must hold the archive lock
+func (self *StateStore) saveArchiveRange() {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint32(value, self.archive.start)
+	binary.BigEndian.PutUint32(value[4:], self.archive.tip)
+	self.store.BatchPut(self.genArchiveRangeKey(), value)
+}
+
+//getStateAt return the raw value of state key at height, scom.ErrNotFound if not existed
+func (self *StateStore) getStateAt(key []byte, height uint32) ([]byte, error) {
+	start, tip, ok := self.GetArchiveRange()
+	if !ok || height < start || height > tip {
+		return nil, fmt.Errorf("state at height %d is not archived", height)
+	}
+	if height < tip {
+		prefix := genStateHistoryKey(key, 0)
+		prefix = prefix[:len(prefix)-4]
+		iter := self.store.NewIterator(prefix)
+		defer iter.Release()
+		var has bool
+		if seeker, ok := iter.(interface{ Seek(key []byte) bool }); ok {
+			has = seeker.Seek(genStateHistoryKey(key, height+1))
+		} else {
+			has = iter.First()
+		}
+		//keys with the same prefix are iterated as well, only the exact length entries belong to the key
+		for ; has; has = iter.Next() {
+			hkey := iter.Key()
+			if len(hkey) != len(prefix)+4 || binary.BigEndian.Uint32(hkey[len(prefix):]) <= height {
+				continue
+			}
+			value := iter.Value()
+			if len(value) == 0 {
+				return nil, scom.ErrNotFound
+			}
+			return append([]byte{}, value...), nil
+		}
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return self.store.Get(key)
+}
+
+//GetStorageStateAt return the storage item at height
+func (self *StateStore) GetStorageStateAt(key *states.StorageKey, height uint32) (*states.StorageItem, error) {
+	storeKey, err := self.getStorageKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := self.getStateAt(storeKey, height)
+	if err != nil {
+		return nil, err
+	}
+	storageState := new(states.StorageItem)
+	err = storageState.Deserialization(common.NewZeroCopySource(data))
+	if err != nil {
+		return nil, err
+	}
+	return storageState, nil
+}
+
+//historyStore is the read only view of the state at a height, used to pre-execute contract on history state
+type historyStore struct {
+	scom.PersistStore
+	state  *StateStore
+	height uint32
+}
+
+func (self *historyStore) Get(key []byte) ([]byte, error) {
+	return self.state.getStateAt(key, self.height)
+}
+
+func (self *historyStore) Has(key []byte) (bool, error) {
+	_, err := self.Get(key)
+	if err == scom.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//NewIterator collect the keys existed now or overwritten since the height, and iterate their values at height
+func (self *historyStore) NewIterator(prefix []byte) scom.StoreIterator {
+	memdb := overlaydb.NewMemDB(0, 0)
+	seen := make(map[string]bool)
+	collect := func(key []byte) {
+		if seen[string(key)] {
+			return
+		}
+		seen[string(key)] = true
+		value, err := self.Get(key)
+		if err == nil {
+			memdb.Put(append([]byte{}, key...), value)
+		}
+	}
+
+	iter := self.PersistStore.NewIterator(prefix)
+	for has := iter.First(); has; has = iter.Next() {
+		collect(iter.Key())
+	}
+	iter.Release()
+
+	histPrefix := append([]byte{byte(scom.ST_HISTORY)}, prefix...)
+	iter = self.PersistStore.NewIterator(histPrefix)
+	for has := iter.First(); has; has = iter.Next() {
+		hkey := iter.Key()
+		if binary.BigEndian.Uint32(hkey[len(hkey)-4:]) <= self.height {
+			continue
+		}
+		collect(hkey[1 : len(hkey)-4])
+	}
+	iter.Release()
+
+	return memdb.NewIterator(util.BytesPrefix(prefix))
+}
+
+//NewOverlayDBAt return the overlay db reading the state at height
+func (self *StateStore) NewOverlayDBAt(height uint32) (*overlaydb.OverlayDB, error) {
+	start, tip, ok := self.GetArchiveRange()
+	if !ok || height < start || height > tip {
+		return nil, fmt.Errorf("state at height %d is not archived", height)
+	}
+	return overlaydb.NewOverlayDB(&historyStore{PersistStore: self.store, state: self, height: height}), nil
+}
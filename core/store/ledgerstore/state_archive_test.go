@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ledgerstore
+
+import (
+	"testing"
+
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func commitArchivedBlock(t *testing.T, store *StateStore, height uint32, writes map[string]string) {
+	overlay := store.NewOverlayDB()
+	for k, v := range writes {
+		if v == "" {
+			overlay.Delete([]byte(k))
+		} else {
+			overlay.Put([]byte(k), []byte(v))
+		}
+	}
+	store.NewBatch()
+	assert.Nil(t, store.saveStateHistory(height, overlay.GetWriteSet()))
+	overlay.CommitTo()
+	assert.Nil(t, store.CommitTo())
+}
+
+func TestStateArchive(t *testing.T) {
+	store := NewMemStateStore(0)
+	key := func(s string) string { return string([]byte{byte(scom.ST_STORAGE)}) + s }
+	//state before archive mode is enabled
+	store.NewBatch()
+	store.BatchPutRawKeyVal([]byte(key("a")), []byte("a0"))
+	assert.Nil(t, store.CommitTo())
+
+	assert.Nil(t, store.EnableArchive())
+	_, _, ok := store.GetArchiveRange()
+	assert.False(t, ok)
+	commitArchivedBlock(t, store, 10, map[string]string{key("a"): "a10", key("ab"): "ab10"})
+	commitArchivedBlock(t, store, 11, map[string]string{key("b"): "b11"})
+	commitArchivedBlock(t, store, 12, map[string]string{key("a"): "", key("ab"): "ab12"})
+	start, tip, ok := store.GetArchiveRange()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(9), start)
+	assert.Equal(t, uint32(12), tip)
+
+	expects := map[uint32]map[string]string{
+		9:  {"a": "a0", "ab": "", "b": ""},
+		10: {"a": "a10", "ab": "ab10", "b": ""},
+		11: {"a": "a10", "ab": "ab10", "b": "b11"},
+		12: {"a": "", "ab": "ab12", "b": "b11"},
+	}
+	for height, values := range expects {
+		for k, v := range values {
+			value, err := store.getStateAt([]byte(key(k)), height)
+			if v == "" {
+				assert.Equal(t, scom.ErrNotFound, err, "height %d key %s", height, k)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, v, string(value), "height %d key %s", height, k)
+			}
+		}
+	}
+	_, err := store.getStateAt([]byte(key("a")), 8)
+	assert.NotNil(t, err)
+	_, err = store.getStateAt([]byte(key("a")), 13)
+	assert.NotNil(t, err)
+
+	//iterate the state at height, deleted keys are restored and new keys are hidden
+	overlay, err := store.NewOverlayDBAt(10)
+	assert.Nil(t, err)
+	iter := overlay.NewIterator([]byte(key("")))
+	values := make(map[string]string)
+	for has := iter.First(); has; has = iter.Next() {
+		values[string(iter.Key())] = string(iter.Value())
+	}
+	iter.Release()
+	assert.Equal(t, map[string]string{key("a"): "a10", key("ab"): "ab10"}, values)
+
+	//a gap in history restarts the archive
+	commitArchivedBlock(t, store, 20, map[string]string{key("b"): "b20"})
+	start, tip, _ = store.GetArchiveRange()
+	assert.Equal(t, uint32(19), start)
+	assert.Equal(t, uint32(20), tip)
+	_, err = store.getStateAt([]byte(key("b")), 12)
+	assert.NotNil(t, err)
+
+	//the range is reloaded when enabled again
+	assert.Nil(t, store.EnableArchive())
+	start, tip, _ = store.GetArchiveRange()
+	assert.Equal(t, uint32(19), start)
+	assert.Equal(t, uint32(20), tip)
+}
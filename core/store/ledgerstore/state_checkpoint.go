@@ -0,0 +1,240 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ledgerstore
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/common/log"
+	vconfig "github.com/saveio/themis/consensus/vbft/config"
+	scom "github.com/saveio/themis/core/store/common"
+)
+
+//stateCheckpointPrefixes are the state key prefixes committed by state checkpoint root, in the order of snapshot export
+var stateCheckpointPrefixes = []scom.DataEntryPrefix{
+	scom.ST_BOOKKEEPER,
+	scom.ST_CONTRACT,
+	scom.ST_STORAGE,
+}
+
+//stateCheckpointHasher accumulate the state merkle root and all the state entries in key order into a checkpoint root
+type stateCheckpointHasher struct {
+	hasher hash.Hash
+}
+
+func newStateCheckpointHasher(stateMerkleRoot common.Uint256) *stateCheckpointHasher {
+	hasher := sha256.New()
+	hasher.Write(stateMerkleRoot[:])
+	return &stateCheckpointHasher{hasher: hasher}
+}
+
+func (self *stateCheckpointHasher) write(key, value []byte) {
+	sink := common.NewZeroCopySink(make([]byte, 0, len(key)+len(value)+18))
+	sink.WriteVarBytes(key)
+	sink.WriteVarBytes(value)
+	self.hasher.Write(sink.Bytes())
+}
+
+func (self *stateCheckpointHasher) sum() (result common.Uint256) {
+	self.hasher.Sum(result[:0])
+	return
+}
+
+//isStateCheckpointKey return whether the key is committed by state checkpoint root
+func isStateCheckpointKey(key []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+	for _, prefix := range stateCheckpointPrefixes {
+		if key[0] == byte(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+//calculateStateCheckpointRoot iterate the whole state of reader, it is as expensive as the total state hash at
+//state hash check height, so it is calculated in background and stopped when quit is closed
+func calculateStateCheckpointRoot(reader stateReader, stateMerkleRoot common.Uint256, quit <-chan struct{}) (common.Uint256, error) {
+	hasher := newStateCheckpointHasher(stateMerkleRoot)
+	for _, prefix := range stateCheckpointPrefixes {
+		iter := reader.NewIterator([]byte{byte(prefix)})
+		for iter.Next() {
+			select {
+			case <-quit:
+				iter.Release()
+				return common.UINT256_EMPTY, fmt.Errorf("ledger is closing")
+			default:
+			}
+			hasher.write(iter.Key(), iter.Value())
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return common.UINT256_EMPTY, err
+		}
+	}
+	return hasher.sum(), nil
+}
+
+func (self *StateStore) genStateCheckpointKey(height uint32) []byte {
+	key := make([]byte, 5)
+	key[0] = byte(scom.SYS_STATE_CHECKPOINT)
+	binary.LittleEndian.PutUint32(key[1:], height)
+	return key
+}
+
+//SaveStateCheckpointRoot put the state checkpoint root of height to batch
+func (self *StateStore) SaveStateCheckpointRoot(height uint32, root common.Uint256) {
+	self.store.BatchPut(self.genStateCheckpointKey(height), root[:])
+}
+
+//PutStateCheckpointRoot write the state checkpoint root of height to store directly, not in the batch of block saving
+func (self *StateStore) PutStateCheckpointRoot(height uint32, root common.Uint256) error {
+	return self.store.Put(self.genStateCheckpointKey(height), root[:])
+}
+
+//GetStateCheckpointRoot return the state checkpoint root of height
+func (self *StateStore) GetStateCheckpointRoot(height uint32) (common.Uint256, error) {
+	value, err := self.store.Get(self.genStateCheckpointKey(height))
+	if err != nil {
+		return common.UINT256_EMPTY, err
+	}
+	return common.Uint256ParseFromBytes(value)
+}
+
+//isStateCheckpoint return whether the state checkpoint root is calculated at height
+func (this *LedgerStoreImp) isStateCheckpoint(height uint32) bool {
+	return height != 0 && this.stateCheckpointInterval != 0 && height%this.stateCheckpointInterval == 0 &&
+		height >= config.GetStateCheckpointHeight()
+}
+
+//startStateCheckpoint calculate the state checkpoint root of height from a consistent view of state store in
+//background, so block saving is not blocked. Must hold the saving block lock.
+func (this *LedgerStoreImp) startStateCheckpoint(height uint32) {
+	if !this.isStateCheckpoint(height) {
+		return
+	}
+	stateRoot, err := this.stateStore.GetStateMerkleRoot(height)
+	if err != nil {
+		log.Errorf("calculate state checkpoint root at height %d error: GetStateMerkleRoot error %s", height, err)
+		return
+	}
+	reader, err := this.stateStore.newReadSnapshot()
+	if err != nil {
+		log.Errorf("calculate state checkpoint root at height %d error: %s", height, err)
+		return
+	}
+	done := make(chan struct{})
+	this.checkpointLock.Lock()
+	this.checkpointTasks[height] = done
+	this.checkpointLock.Unlock()
+	if reader == nil {
+		this.saveStateCheckpoint(this.stateStore.store, height, stateRoot, done)
+		return
+	}
+	this.checkpointWg.Add(1)
+	go func() {
+		defer this.checkpointWg.Done()
+		defer reader.Release()
+		this.saveStateCheckpoint(reader, height, stateRoot, done)
+	}()
+}
+
+//saveStateCheckpoint calculate the state checkpoint root of reader and save it, done is closed when finished
+func (this *LedgerStoreImp) saveStateCheckpoint(reader stateReader, height uint32, stateRoot common.Uint256, done chan struct{}) {
+	defer func() {
+		this.checkpointLock.Lock()
+		delete(this.checkpointTasks, height)
+		this.checkpointLock.Unlock()
+		close(done)
+	}()
+	root, err := calculateStateCheckpointRoot(reader, stateRoot, this.quit)
+	if err == nil {
+		err = this.stateStore.PutStateCheckpointRoot(height, root)
+	}
+	if err != nil {
+		log.Errorf("calculate state checkpoint root at height %d error: %s", height, err)
+		return
+	}
+	log.Infof("state checkpoint root at height %d calculated: %s", height, root.ToHexString())
+}
+
+//resumeStateCheckpoint restart the calculation stopped by closing, only possible if the ledger is still at the
+//checkpoint. The root of an earlier checkpoint is lost, this node can not propose the block committing it
+func (this *LedgerStoreImp) resumeStateCheckpoint() {
+	height := this.GetCurrentBlockHeight()
+	if !this.isStateCheckpoint(height) {
+		return
+	}
+	if _, err := this.stateStore.GetStateCheckpointRoot(height); err != scom.ErrNotFound {
+		return
+	}
+	this.getSavingBlockLock()
+	defer this.releaseSavingBlockLock()
+	this.startStateCheckpoint(height)
+}
+
+//GetStateCheckpointRoot return the state checkpoint root of height, wait if it is still calculating in background.
+//Empty if height is not a checkpoint or the root is not calculated
+func (this *LedgerStoreImp) GetStateCheckpointRoot(height uint32) (common.Uint256, error) {
+	if !this.isStateCheckpoint(height) {
+		return common.UINT256_EMPTY, nil
+	}
+	this.checkpointLock.Lock()
+	done := this.checkpointTasks[height]
+	this.checkpointLock.Unlock()
+	if done != nil {
+		<-done
+	}
+	root, err := this.stateStore.GetStateCheckpointRoot(height)
+	if err == scom.ErrNotFound {
+		return common.UINT256_EMPTY, nil
+	}
+	return root, err
+}
+
+//getCommittedStateCheckpoint return the state checkpoint root of height committed in the header STATE_CHECKPOINT_DELAY
+//blocks after it, which is verified with the signatures of bookkeepers when the header is synced
+func (this *LedgerStoreImp) getCommittedStateCheckpoint(height uint32) (common.Uint256, error) {
+	if !this.isStateCheckpoint(height) {
+		return common.UINT256_EMPTY, fmt.Errorf("height %d is not a state checkpoint", height)
+	}
+	if strings.ToLower(config.DefConfig.Genesis.ConsensusType) != config.CONSENSUS_TYPE_VBFT {
+		return common.UINT256_EMPTY, fmt.Errorf("state checkpoint is only committed in vbft block header")
+	}
+	committedHeight := height + config.STATE_CHECKPOINT_DELAY
+	header := this.getHeaderCache(this.getHeaderIndex(committedHeight))
+	if header == nil {
+		return common.UINT256_EMPTY, fmt.Errorf("header at height %d not synced", committedHeight)
+	}
+	blkInfo, err := vconfig.VbftBlock(header)
+	if err != nil {
+		return common.UINT256_EMPTY, err
+	}
+	if blkInfo.StateCheckpoint == nil {
+		return common.UINT256_EMPTY, fmt.Errorf("state checkpoint of height %d not committed in header", height)
+	}
+	return *blkInfo.StateCheckpoint, nil
+}
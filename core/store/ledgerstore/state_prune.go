@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"io"
+
+	"github.com/saveio/themis/common"
+	scom "github.com/saveio/themis/core/store/common"
+)
+
+//State pruning removes the per height records which are only needed to serve old heights: the cross states,
+//the cross chain message and the state history saved in archive mode. The write set hash of the height is
+//dropped, but the state merkle root is kept, since it is sent along with the block to syncing peers.
+//The current state and the compact state merkle tree are kept, so the pruned node still validates new blocks.
+//
+//Not covered by state pruning: the entries of deleted files in the savefs contract storage are part of the
+//state merkle root, removing them is a contract change. The block merkle hash store keeps all transaction
+//roots, which are needed to prove the transactions of any height.
+
+func genStatePruneHeightKey() []byte {
+	return []byte{byte(scom.DATA_STATE_PRUNE_HEIGHT)}
+}
+
+//GetStatePrunedHeight return the last height of which state records are pruned, 0 if never pruned
+func (self *StateStore) GetStatePrunedHeight() (uint32, error) {
+	data, err := self.store.Get(genStatePruneHeightKey())
+	if err != nil {
+		if err == scom.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	height, eof := common.NewZeroCopySource(data).NextUint32()
+	if eof {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return height, nil
+}
+
+//SaveStatePrunedHeight put the pruned height to batch
+func (self *StateStore) SaveStatePrunedHeight(height uint32) {
+	sink := common.NewZeroCopySink(make([]byte, 0, 4))
+	sink.WriteUint32(height)
+	self.store.BatchPut(genStatePruneHeightKey(), sink.Bytes())
+}
+
+//PruneHeight put the deletion of the state records of height to batch
+func (self *StateStore) PruneHeight(height uint32) error {
+	if err := self.compactStateMerkleRoot(height); err != nil {
+		return err
+	}
+	self.store.BatchDelete(self.genCrossStatesKey(height))
+	return self.pruneStateHistory(height)
+}
+
+//compactStateMerkleRoot put the state merkle root of height without the write set hash to batch
+func (self *StateStore) compactStateMerkleRoot(height uint32) error {
+	key := self.genStateMerkleRootKey(height)
+	value, err := self.store.Get(key)
+	if err == scom.ErrNotFound || (err == nil && len(value) == common.UINT256_SIZE) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, root, err := self.getStateMerkleRootEntry(height)
+	if err != nil {
+		return err
+	}
+	self.store.BatchPut(key, root[:])
+	return nil
+}
+
+//pruneStateHistory put the deletion of the state history saved by block of height to batch, and move the
+//archive range forward
+func (self *StateStore) pruneStateHistory(height uint32) error {
+	indexKey := genStateHistoryIndexKey(height)
+	data, err := self.store.Get(indexKey)
+	if err != nil && err != scom.ErrNotFound {
+		return err
+	}
+	if err == nil {
+		source := common.NewZeroCopySource(data)
+		for source.Len() > 0 {
+			key, _, irregular, eof := source.NextVarBytes()
+			if irregular || eof {
+				return io.ErrUnexpectedEOF
+			}
+			self.store.BatchDelete(genStateHistoryKey(key, height))
+		}
+		self.store.BatchDelete(indexKey)
+	}
+	if self.archive == nil {
+		return nil
+	}
+	self.archive.lock.Lock()
+	defer self.archive.lock.Unlock()
+	self.archive.trimTo(height)
+	if self.archive.active {
+		self.saveArchiveRange()
+	} else {
+		self.store.BatchDelete(self.genArchiveRangeKey())
+	}
+	return nil
+}
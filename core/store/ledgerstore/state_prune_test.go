@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"testing"
+
+	"github.com/saveio/themis/common"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatePrune(t *testing.T) {
+	store := NewMemStateStore(0)
+	key := func(s string) string { return string([]byte{byte(scom.ST_STORAGE)}) + s }
+	assert.Nil(t, store.EnableArchive())
+	for height := uint32(1); height <= 5; height++ {
+		commitArchivedBlock(t, store, height, map[string]string{key("a"): string([]byte{'a', '0' + byte(height)})})
+		store.NewBatch()
+		assert.Nil(t, store.AddStateMerkleTreeRoot(height, common.Uint256{byte(height)}))
+		assert.Nil(t, store.CommitTo())
+	}
+
+	root2, err := store.GetStateMerkleRoot(2)
+	assert.Nil(t, err)
+
+	store.NewBatch()
+	for height := uint32(1); height <= 2; height++ {
+		assert.Nil(t, store.PruneHeight(height))
+	}
+	store.SaveStatePrunedHeight(2)
+	assert.Nil(t, store.CommitTo())
+
+	pruned, err := store.GetStatePrunedHeight()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), pruned)
+	//the state merkle root is kept without the write set hash
+	root, err := store.GetStateMerkleRoot(2)
+	assert.Nil(t, err)
+	assert.Equal(t, root2, root)
+	_, _, err = store.getStateMerkleRootEntry(2)
+	assert.NotNil(t, err)
+	_, err = store.GetStateMerkleRoot(3)
+	assert.Nil(t, err)
+	_, _, err = store.getStateMerkleRootEntry(3)
+	assert.Nil(t, err)
+	//prune the compacted height again
+	store.NewBatch()
+	assert.Nil(t, store.PruneHeight(2))
+	assert.Nil(t, store.CommitTo())
+	root, err = store.GetStateMerkleRoot(2)
+	assert.Nil(t, err)
+	assert.Equal(t, root2, root)
+
+	//only the history saved by blocks above the pruned height is left
+	iter := store.store.NewIterator([]byte{byte(scom.ST_HISTORY)})
+	count := 0
+	for has := iter.First(); has; has = iter.Next() {
+		count++
+	}
+	iter.Release()
+	assert.Equal(t, 3, count)
+
+	start, tip, ok := store.GetArchiveRange()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(2), start)
+	assert.Equal(t, uint32(5), tip)
+	value, err := store.getStateAt([]byte(key("a")), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "a2", string(value))
+	_, err = store.getStateAt([]byte(key("a")), 1)
+	assert.NotNil(t, err)
+
+	//the pruned range is kept when archive mode is enabled again
+	assert.Nil(t, store.EnableArchive())
+	start, _, _ = store.GetArchiveRange()
+	assert.Equal(t, uint32(2), start)
+}
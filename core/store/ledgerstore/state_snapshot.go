@@ -0,0 +1,530 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ledgerstore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/common/log"
+	vconfig "github.com/saveio/themis/consensus/vbft/config"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/errors"
+	"github.com/saveio/themis/merkle"
+)
+
+const (
+	STATE_SNAPSHOT_CHUNK_SIZE = 1024 * 1024 //Chunk size of state snapshot in bytes
+	STATE_SNAPSHOT_KEEP_COUNT = 2           //Count of latest snapshots kept on disk
+	STATE_SNAPSHOT_MANIFEST   = "manifest"
+)
+
+var DBDirSnapshot = "snapshot"
+
+//snapshotPrefixes are the state store key prefixes exported in state snapshot
+var snapshotPrefixes = []scom.DataEntryPrefix{
+	scom.ST_BOOKKEEPER,
+	scom.ST_CONTRACT,
+	scom.ST_STORAGE,
+	scom.SYS_BLOCK_MERKLE_TREE,
+	scom.SYS_STATE_MERKLE_TREE,
+}
+
+//stateReader is the read access of state store or a consistent snapshot of it
+type stateReader interface {
+	Get(key []byte) ([]byte, error)
+	NewIterator(prefix []byte) scom.StoreIterator
+}
+
+//newReadSnapshot return a consistent view of state store, nil if the store backend does not support it
+func (self *StateStore) newReadSnapshot() (scom.ReadSnapshot, error) {
+	store, ok := self.store.(scom.SnapshotStore)
+	if !ok {
+		return nil, nil
+	}
+	return store.NewReadSnapshot()
+}
+
+//exportSnapshot iterate the state of reader at height, the state merkle root and cross states are only exported at height
+func (self *StateStore) exportSnapshot(reader stateReader, height uint32, fn func(key, value []byte)) error {
+	for _, prefix := range snapshotPrefixes {
+		iter := reader.NewIterator([]byte{byte(prefix)})
+		for iter.Next() {
+			fn(iter.Key(), iter.Value())
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	for _, key := range [][]byte{self.genStateMerkleRootKey(height), self.genCrossStatesKey(height)} {
+		value, err := reader.Get(key)
+		if err == scom.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		fn(key, value)
+	}
+	return nil
+}
+
+//isSnapshotKey return whether the key is allowed in the snapshot of height
+func (self *StateStore) isSnapshotKey(height uint32, key []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+	for _, prefix := range snapshotPrefixes {
+		if key[0] == byte(prefix) {
+			return true
+		}
+	}
+	return bytes.Equal(key, self.genStateMerkleRootKey(height)) || bytes.Equal(key, self.genCrossStatesKey(height))
+}
+
+//clearBatch delete all data of state store in current batch
+func (self *StateStore) clearBatch() error {
+	iter := self.store.NewIterator(nil)
+	for iter.Next() {
+		self.store.BatchDelete(iter.Key())
+	}
+	iter.Release()
+	return iter.Error()
+}
+
+//reloadMerkleTrees reload the merkle trees after snapshot imported. The transactions roots of the blocks
+//skipped by snapshot are appended to the block merkle tree, so the hash store keeps serving merkle proofs
+func (self *StateStore) reloadMerkleTrees(height uint32, txRoots []common.Uint256) error {
+	for _, txRoot := range txRoots {
+		self.merkleTree.AppendHash(txRoot)
+	}
+	if height >= self.stateHashCheckHeight {
+		treeSize, hashes, err := self.GetStateMerkleTree()
+		if err != nil {
+			return err
+		}
+		self.deltaMerkleTree = merkle.NewTree(treeSize, hashes, nil)
+	}
+	return nil
+}
+
+//EnableStateSnapshot save state snapshot every interval blocks, disable if equals 0
+func (this *LedgerStoreImp) EnableStateSnapshot(interval uint32) {
+	this.getSavingBlockLock()
+	defer this.releaseSavingBlockLock()
+
+	this.snapshotInterval = interval
+}
+
+//trySaveStateSnapshot save the snapshot of current state at checkpoint height. Must hold the saving block lock.
+//The state is exported from a consistent view of state store in background, so block saving is not blocked
+func (this *LedgerStoreImp) trySaveStateSnapshot(height uint32, blockHash common.Uint256) {
+	if this.snapshotInterval == 0 || height == 0 || height%this.snapshotInterval != 0 {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&this.snapshotSaving, 0, 1) {
+		log.Warnf("skip state snapshot at height %d, the previous snapshot is still saving", height)
+		return
+	}
+	stateRoot, err := this.stateStore.GetStateMerkleRoot(height)
+	if err != nil {
+		atomic.StoreInt32(&this.snapshotSaving, 0)
+		log.Errorf("save state snapshot at height %d error: GetStateMerkleRoot error %s", height, err)
+		return
+	}
+	reader, err := this.stateStore.newReadSnapshot()
+	if err != nil {
+		atomic.StoreInt32(&this.snapshotSaving, 0)
+		log.Errorf("save state snapshot at height %d error: %s", height, err)
+		return
+	}
+	if reader == nil {
+		this.saveStateSnapshot(this.stateStore.store, height, blockHash, stateRoot)
+		return
+	}
+	this.snapshotWg.Add(1)
+	go func() {
+		defer this.snapshotWg.Done()
+		defer reader.Release()
+		this.saveStateSnapshot(reader, height, blockHash, stateRoot)
+	}()
+}
+
+//saveStateSnapshot write the snapshot of reader to disk and remove stale snapshots, the saving flag is cleared when done
+func (this *LedgerStoreImp) saveStateSnapshot(reader stateReader, height uint32, blockHash, stateRoot common.Uint256) {
+	defer atomic.StoreInt32(&this.snapshotSaving, 0)
+	err := this.writeStateSnapshot(reader, height, blockHash, stateRoot)
+	if err != nil {
+		log.Errorf("save state snapshot at height %d error: %s", height, err)
+		return
+	}
+	log.Infof("state snapshot at height %d saved", height)
+	this.removeStaleSnapshots()
+}
+
+func (this *LedgerStoreImp) writeStateSnapshot(reader stateReader, height uint32, blockHash, stateRoot common.Uint256) error {
+	tmpDir := filepath.Join(this.snapshotDir, fmt.Sprintf("%d.tmp", height))
+	err := os.RemoveAll(tmpDir)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+
+	snapshot := &types.StateSnapshot{
+		Height:          height,
+		BlockHash:       blockHash,
+		StateMerkleRoot: stateRoot,
+	}
+	sink := common.NewZeroCopySink(nil)
+	flush := func() error {
+		index := len(snapshot.ChunkHashes)
+		chunk := sink.Bytes()
+		err := ioutil.WriteFile(filepath.Join(tmpDir, strconv.Itoa(index)), chunk, 0644)
+		if err != nil {
+			return err
+		}
+		snapshot.ChunkHashes = append(snapshot.ChunkHashes, types.StateChunkHash(chunk))
+		sink = common.NewZeroCopySink(nil)
+		return nil
+	}
+	var flushErr error
+	err = this.stateStore.exportSnapshot(reader, height, func(key, value []byte) {
+		if flushErr != nil {
+			return
+		}
+		types.WriteStateChunkEntry(sink, key, value)
+		if sink.Size() >= STATE_SNAPSHOT_CHUNK_SIZE {
+			flushErr = flush()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if flushErr != nil {
+		return flushErr
+	}
+	if sink.Size() > 0 {
+		if err = flush(); err != nil {
+			return err
+		}
+	}
+
+	manifest := common.NewZeroCopySink(nil)
+	snapshot.Serialization(manifest)
+	err = ioutil.WriteFile(filepath.Join(tmpDir, STATE_SNAPSHOT_MANIFEST), manifest.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(this.snapshotDir, strconv.Itoa(int(height)))
+	if err = os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, dir)
+}
+
+//getSnapshotHeights return the heights of saved snapshots in ascending order
+func (this *LedgerStoreImp) getSnapshotHeights() []uint32 {
+	return listSnapshotHeights(this.snapshotDir)
+}
+
+//listSnapshotHeights return the heights of snapshots saved in dir in ascending order
+func listSnapshotHeights(snapshotDir string) []uint32 {
+	files, err := ioutil.ReadDir(snapshotDir)
+	if err != nil {
+		return nil
+	}
+	heights := make([]uint32, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() || strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+		height, err := strconv.ParseUint(file.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		heights = append(heights, uint32(height))
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] < heights[j]
+	})
+	return heights
+}
+
+func (this *LedgerStoreImp) removeStaleSnapshots() {
+	heights := this.getSnapshotHeights()
+	for i := 0; i+STATE_SNAPSHOT_KEEP_COUNT < len(heights); i++ {
+		dir := filepath.Join(this.snapshotDir, strconv.Itoa(int(heights[i])))
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warnf("remove state snapshot %s error: %s", dir, err)
+		}
+	}
+}
+
+//GetStateSnapshot return the manifest of state snapshot at height, return the latest one whose state checkpoint
+//root is committed if height is 0, the others can not be imported until the committing header is synced
+func (this *LedgerStoreImp) GetStateSnapshot(height uint32) (*types.StateSnapshot, error) {
+	if height == 0 {
+		currBlockHeight := this.GetCurrentBlockHeight()
+		heights := this.getSnapshotHeights()
+		for i := len(heights) - 1; i >= 0; i-- {
+			if heights[i]+config.STATE_CHECKPOINT_DELAY <= currBlockHeight {
+				height = heights[i]
+				break
+			}
+		}
+		if height == 0 {
+			return nil, scom.ErrNotFound
+		}
+	}
+	return readSnapshotManifest(this.snapshotDir, height)
+}
+
+//readSnapshotManifest return the manifest of snapshot at height saved in dir
+func readSnapshotManifest(snapshotDir string, height uint32) (*types.StateSnapshot, error) {
+	data, err := ioutil.ReadFile(filepath.Join(snapshotDir, strconv.Itoa(int(height)), STATE_SNAPSHOT_MANIFEST))
+	if os.IsNotExist(err) {
+		return nil, scom.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	snapshot := &types.StateSnapshot{}
+	if err = snapshot.Deserialization(common.NewZeroCopySource(data)); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+//GetStateSnapshotChunk return the chunk of state snapshot at height
+func (this *LedgerStoreImp) GetStateSnapshotChunk(height, index uint32) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(this.snapshotDir, strconv.Itoa(int(height)), strconv.Itoa(int(index))))
+	if os.IsNotExist(err) {
+		return nil, scom.ErrNotFound
+	}
+	return data, err
+}
+
+//ImportStateSnapshot replace the state with snapshot, and continue the ledger from snapshot height.
+//The block of snapshot height and the headers after it up to the one committing the state checkpoint root must be
+//synced in header index, blocks before snapshot are not available. The state is checked against the state checkpoint root committed in the header
+//STATE_CHECKPOINT_DELAY blocks after it
+func (this *LedgerStoreImp) ImportStateSnapshot(block *types.Block, snapshot *types.StateSnapshot, chunks [][]byte) error {
+	this.getSavingBlockLock()
+	defer this.releaseSavingBlockLock()
+	if this.closing {
+		return errors.NewErr("import snapshot error: ledger is closing")
+	}
+	height := snapshot.Height
+	blockHash := block.Hash()
+	if height == 0 || block.Header.Height != height || blockHash != snapshot.BlockHash {
+		return fmt.Errorf("snapshot block mismatch at height %d", height)
+	}
+	currBlockHeight := this.GetCurrentBlockHeight()
+	if height <= currBlockHeight {
+		return fmt.Errorf("snapshot height %d not higher than current block height %d", height, currBlockHeight)
+	}
+	if this.getHeaderIndex(height) != blockHash {
+		return fmt.Errorf("snapshot block %s is not in header index", blockHash.ToHexString())
+	}
+	txRoot := block.Header.TransactionsRoot
+	block.RebuildMerkleRoot()
+	if block.Header.TransactionsRoot != txRoot {
+		block.Header.TransactionsRoot = txRoot
+		return fmt.Errorf("snapshot block transactions root mismatch")
+	}
+	if len(chunks) != len(snapshot.ChunkHashes) {
+		return fmt.Errorf("snapshot chunk count %d, expected %d", len(chunks), len(snapshot.ChunkHashes))
+	}
+	checkpoint, err := this.getCommittedStateCheckpoint(height)
+	if err != nil {
+		return fmt.Errorf("snapshot state checkpoint error %s", err)
+	}
+	txRoots, blockTree, err := this.snapshotBlockMerkleTree(currBlockHeight, block.Header)
+	if err != nil {
+		return err
+	}
+
+	this.stateStore.NewBatch()
+	if err := this.stateStore.clearBatch(); err != nil {
+		return err
+	}
+	var stateTree, stateRoot []byte
+	hasher := newStateCheckpointHasher(snapshot.StateMerkleRoot)
+	for i, chunk := range chunks {
+		if types.StateChunkHash(chunk) != snapshot.ChunkHashes[i] {
+			return fmt.Errorf("snapshot chunk %d hash mismatch", i)
+		}
+		var invalidKey []byte
+		err := types.ForEachStateChunkEntry(chunk, func(key, value []byte) {
+			if !this.stateStore.isSnapshotKey(height, key) {
+				invalidKey = key
+				return
+			}
+			if isStateCheckpointKey(key) {
+				hasher.write(key, value)
+			}
+			switch key[0] {
+			case byte(scom.SYS_STATE_MERKLE_TREE):
+				stateTree = value
+			case byte(scom.DATA_STATE_MERKLE_ROOT):
+				stateRoot = value
+			}
+			this.stateStore.BatchPutRawKeyVal(key, value)
+		})
+		if err != nil {
+			return fmt.Errorf("snapshot chunk %d error %s", i, err)
+		}
+		if invalidKey != nil {
+			return fmt.Errorf("snapshot chunk %d contains invalid key %x", i, invalidKey)
+		}
+	}
+	if root := hasher.sum(); root != checkpoint {
+		return fmt.Errorf("snapshot state checkpoint root mismatch, expected:%s, got:%s",
+			checkpoint.ToHexString(), root.ToHexString())
+	}
+	if err := this.verifySnapshotStateMerkleTree(block.Header, snapshot, stateTree, stateRoot); err != nil {
+		return err
+	}
+	this.stateStore.BatchPutRawKeyVal(this.stateStore.genBlockMerkleTreeKey(), encodeMerkleTree(blockTree))
+	this.stateStore.SaveStateCheckpointRoot(height, checkpoint)
+	this.stateStore.SaveCurrentBlock(height, blockHash)
+
+	this.blockStore.NewBatch()
+	this.eventStore.NewBatch()
+	for i := currBlockHeight + 1; i < height; i++ {
+		this.blockStore.SaveBlockHash(i, this.getHeaderIndex(i))
+	}
+	if err := this.saveSnapshotConfigHeader(block.Header); err != nil {
+		return err
+	}
+	if err := this.saveBlockToBlockStore(block); err != nil {
+		return fmt.Errorf("save to block store height:%d error:%s", height, err)
+	}
+	this.saveBlockToEventStore(block)
+	if err := this.blockStore.CommitTo(); err != nil {
+		return fmt.Errorf("blockStore.CommitTo height:%d error %s", height, err)
+	}
+	if err := this.eventStore.CommitTo(); err != nil {
+		return fmt.Errorf("eventStore.CommitTo height:%d error %s", height, err)
+	}
+	if err := this.stateStore.CommitTo(); err != nil {
+		return fmt.Errorf("stateStore.CommitTo height:%d error %s", height, err)
+	}
+	if err := this.stateStore.reloadMerkleTrees(height, txRoots); err != nil {
+		return fmt.Errorf("reload merkle trees error %s", err)
+	}
+	this.setCurrentBlock(height, blockHash)
+	for i := currBlockHeight + 1; i <= height; i++ {
+		this.delHeaderCache(this.getHeaderIndex(i))
+	}
+	log.Infof("state snapshot at height %d imported, state merkle root %s", height, snapshot.StateMerkleRoot.ToHexString())
+	return nil
+}
+
+//snapshotBlockMerkleTree append the transactions roots of the synced headers up to snapshot height to a copy
+//of current block merkle tree, and check it against the block root of snapshot header. The block merkle tree
+//of snapshot is not trusted, the appended transactions roots are returned to extend the hash store
+func (this *LedgerStoreImp) snapshotBlockMerkleTree(currBlockHeight uint32, header *types.Header) ([]common.Uint256,
+	*merkle.CompactMerkleTree, error) {
+	curr := this.stateStore.merkleTree
+	tree := merkle.NewTree(curr.TreeSize(), append([]common.Uint256{}, curr.Hashes()...), nil)
+	txRoots := make([]common.Uint256, 0, header.Height-currBlockHeight)
+	for i := currBlockHeight + 1; i < header.Height; i++ {
+		h := this.getHeaderCache(this.getHeaderIndex(i))
+		if h == nil {
+			return nil, nil, fmt.Errorf("header at height %d not synced", i)
+		}
+		txRoots = append(txRoots, h.TransactionsRoot)
+	}
+	txRoots = append(txRoots, header.TransactionsRoot)
+	for _, txRoot := range txRoots {
+		tree.AppendHash(txRoot)
+	}
+	if tree.TreeSize() != header.Height+1 {
+		return nil, nil, fmt.Errorf("snapshot block merkle tree size %d, expected %d", tree.TreeSize(), header.Height+1)
+	}
+	if root := tree.Root(); root != header.BlockRoot {
+		return nil, nil, fmt.Errorf("snapshot block root mismatch, expected:%s, got:%s",
+			header.BlockRoot.ToHexString(), root.ToHexString())
+	}
+	return txRoots, tree, nil
+}
+
+//verifySnapshotStateMerkleTree check the state merkle tree against the state merkle root of snapshot
+func (this *LedgerStoreImp) verifySnapshotStateMerkleTree(header *types.Header, snapshot *types.StateSnapshot,
+	stateTree, stateRoot []byte) error {
+	if header.Height < this.stateHashCheckHeight {
+		if snapshot.StateMerkleRoot != common.UINT256_EMPTY {
+			return fmt.Errorf("unexpected snapshot state merkle root before state hash check height")
+		}
+		return nil
+	}
+	if stateTree == nil || stateRoot == nil {
+		return fmt.Errorf("snapshot state merkle tree not found")
+	}
+	treeSize, hashes, err := decodeMerkleTree(stateTree)
+	if err != nil {
+		return fmt.Errorf("snapshot state merkle tree error %s", err)
+	}
+	if treeSize != header.Height-this.stateHashCheckHeight+1 {
+		return fmt.Errorf("snapshot state merkle tree size %d, expected %d", treeSize, header.Height-this.stateHashCheckHeight+1)
+	}
+	if root := merkle.NewTree(treeSize, hashes, nil).Root(); root != snapshot.StateMerkleRoot {
+		return fmt.Errorf("snapshot state merkle root mismatch, expected:%s, got:%s",
+			snapshot.StateMerkleRoot.ToHexString(), root.ToHexString())
+	}
+	source := common.NewZeroCopySource(stateRoot)
+	source.NextHash()
+	root, eof := source.NextHash()
+	if eof || root != snapshot.StateMerkleRoot {
+		return fmt.Errorf("snapshot state merkle root of height %d mismatch", header.Height)
+	}
+	return nil
+}
+
+//saveSnapshotConfigHeader keep the header of last chain config, which is needed to load vbft peers.
+//Only the header is saved, the transactions of config block are not available
+func (this *LedgerStoreImp) saveSnapshotConfigHeader(header *types.Header) error {
+	if strings.ToLower(config.DefConfig.Genesis.ConsensusType) != config.CONSENSUS_TYPE_VBFT {
+		return nil
+	}
+	blkInfo, err := vconfig.VbftBlock(header)
+	if err != nil {
+		return err
+	}
+	if blkInfo.NewChainConfig != nil || blkInfo.LastConfigBlockNum == 0 {
+		return nil
+	}
+	cfgHeader := this.getHeaderCache(this.getHeaderIndex(blkInfo.LastConfigBlockNum))
+	if cfgHeader == nil {
+		return fmt.Errorf("chain config header at height %d not found", blkInfo.LastConfigBlockNum)
+	}
+	return this.blockStore.SaveHeader(&types.Block{Header: cfgHeader}, 0)
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ledgerstore
+
+import (
+	"os"
+	"testing"
+
+	"github.com/saveio/themis/account"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/core/genesis"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/crypto/keypair"
+	"github.com/saveio/themis/merkle"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateSnapshotExport(t *testing.T) {
+	store := NewMemStateStore(0)
+	storageKey := []byte{byte(scom.ST_STORAGE), 1, 2, 3}
+	store.NewBatch()
+	store.BatchPutRawKeyVal(storageKey, []byte("value"))
+	for height := uint32(0); height < 2; height++ {
+		assert.Nil(t, store.AddBlockMerkleTreeRoot(common.Uint256{byte(height)}))
+		assert.Nil(t, store.AddStateMerkleTreeRoot(height, common.Uint256{byte(height + 1)}))
+	}
+	assert.Nil(t, store.SaveCurrentBlock(1, common.Uint256{1}))
+	assert.Nil(t, store.CommitTo())
+
+	entries := make(map[string][]byte)
+	err := store.exportSnapshot(store.store, 1, func(key, value []byte) {
+		assert.True(t, store.isSnapshotKey(1, key))
+		entries[string(key)] = value
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, []byte("value"), entries[string(storageKey)])
+	assert.NotNil(t, entries[string(store.genStateMerkleRootKey(1))])
+	assert.Nil(t, entries[string(store.genStateMerkleRootKey(0))])
+	assert.False(t, store.isSnapshotKey(1, store.genStateMerkleRootKey(0)))
+	assert.False(t, store.isSnapshotKey(1, store.getCurrentBlockKey()))
+
+	treeSize, hashes, err := decodeMerkleTree(entries[string(store.genStateMerkleTreeKey())])
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), treeSize)
+	root, err := store.GetStateMerkleRoot(1)
+	assert.Nil(t, err)
+	assert.Equal(t, root, merkle.NewTree(treeSize, hashes, nil).Root())
+}
+
+func TestStateCheckpointRoot(t *testing.T) {
+	store := NewMemStateStore(0)
+	store.NewBatch()
+	store.BatchPutRawKeyVal([]byte{byte(scom.ST_CONTRACT), 1}, []byte("contract"))
+	store.BatchPutRawKeyVal([]byte{byte(scom.ST_STORAGE), 1, 2}, []byte("value"))
+	store.BatchPutRawKeyVal([]byte{byte(scom.ST_STORAGE), 1, 3}, []byte("value"))
+	assert.Nil(t, store.AddStateMerkleTreeRoot(0, common.Uint256{1}))
+	assert.Nil(t, store.CommitTo())
+	stateRoot, err := store.GetStateMerkleRoot(0)
+	assert.Nil(t, err)
+
+	checkpoint, err := calculateStateCheckpointRoot(store.store, stateRoot, nil)
+	assert.Nil(t, err)
+	quit := make(chan struct{})
+	close(quit)
+	_, err = calculateStateCheckpointRoot(store.store, stateRoot, quit)
+	assert.NotNil(t, err)
+
+	hasher := newStateCheckpointHasher(stateRoot)
+	tampered := newStateCheckpointHasher(stateRoot)
+	err = store.exportSnapshot(store.store, 0, func(key, value []byte) {
+		if !isStateCheckpointKey(key) {
+			return
+		}
+		hasher.write(key, value)
+		if key[0] == byte(scom.ST_STORAGE) {
+			value = []byte("injected")
+		}
+		tampered.write(key, value)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, checkpoint, hasher.sum())
+	assert.NotEqual(t, checkpoint, tampered.sum())
+	assert.NotEqual(t, checkpoint, newStateCheckpointHasher(common.Uint256{2}).sum())
+}
+
+func TestStateCheckpointInBackground(t *testing.T) {
+	dataDir := "test/state_checkpoint"
+	defer os.RemoveAll(dataDir)
+
+	acc := account.NewAccount("")
+	bookkeepers := []keypair.PublicKey{acc.PublicKey}
+	genesisBlock, err := genesis.BuildGenesisBlock(bookkeepers, config.DefConfig.Genesis)
+	assert.Nil(t, err)
+	origin := config.DefConfig.Genesis
+	genesisCfg := *origin
+	genesisCfg.ConsensusType = config.CONSENSUS_TYPE_SOLO
+	config.DefConfig.Genesis = &genesisCfg
+	defer func() { config.DefConfig.Genesis = origin }()
+	//state checkpoint is not activated on main net yet
+	networkId := config.DefConfig.P2PNode.NetworkId
+	config.DefConfig.P2PNode.NetworkId = config.NETWORK_ID_SOLO_NET
+	defer func() { config.DefConfig.P2PNode.NetworkId = networkId }()
+
+	ledger := newSoloTestStore(t, dataDir, genesisBlock, bookkeepers)
+	ledger.stateCheckpointInterval = 2
+	for i := 0; i < 4; i++ {
+		block := newDeployBlock(t, ledger, acc, 1)
+		result, err := ledger.executeBlock(block)
+		assert.Nil(t, err)
+		assert.Nil(t, ledger.AddBlock(block, nil, result.MerkleRoot))
+	}
+
+	//the root is calculated from the state committed at checkpoint, the state after it is not included
+	stateRoot, err := ledger.GetStateMerkleRoot(4)
+	assert.Nil(t, err)
+	expected, err := calculateStateCheckpointRoot(ledger.stateStore.store, stateRoot, nil)
+	assert.Nil(t, err)
+	root, err := ledger.GetStateCheckpointRoot(4)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, root)
+	root, err = ledger.GetStateCheckpointRoot(2)
+	assert.Nil(t, err)
+	assert.NotEqual(t, common.UINT256_EMPTY, root)
+	assert.NotEqual(t, expected, root)
+	root, err = ledger.GetStateCheckpointRoot(3)
+	assert.Nil(t, err)
+	assert.Equal(t, common.UINT256_EMPTY, root)
+	assert.Nil(t, ledger.Close())
+}
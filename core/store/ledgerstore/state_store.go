@@ -51,12 +51,13 @@ type StateStore struct {
 	deltaMerkleTree      *merkle.CompactMerkleTree //Merkle tree of delta state root
 	merkleHashStore      merkle.HashStore
 	stateHashCheckHeight uint32
+	archive              *archiveRange //Range of archived state history, nil if archive mode disabled
 }
 
 //NewStateStore return state store instance
-func NewStateStore(dbDir, merklePath string, stateHashCheckHeight uint32) (*StateStore, error) {
+func NewStateStore(backend, dbDir, merklePath string, stateHashCheckHeight uint32) (*StateStore, error) {
 	var err error
-	store, err := leveldbstore.NewLevelDBStore(dbDir)
+	store, err := NewPersistStore(backend, dbDir)
 	if err != nil {
 		return nil, err
 	}
@@ -146,6 +147,22 @@ func (self *StateStore) getMerkleTree(key []byte) (uint32, []common.Uint256, err
 	if err != nil {
 		return 0, nil, err
 	}
+	return decodeMerkleTree(data)
+}
+
+//encodeMerkleTree encode the merkle tree size and tree node to store
+func encodeMerkleTree(tree *merkle.CompactMerkleTree) []byte {
+	hashes := tree.Hashes()
+	value := common.NewZeroCopySink(make([]byte, 0, 4+len(hashes)*common.UINT256_SIZE))
+	value.WriteUint32(tree.TreeSize())
+	for _, hash := range hashes {
+		value.WriteHash(hash)
+	}
+	return value.Bytes()
+}
+
+//decodeMerkleTree decode the stored merkle tree size and tree node
+func decodeMerkleTree(data []byte) (uint32, []common.Uint256, error) {
 	value := bytes.NewBuffer(data)
 	treeSize, err := serialization.ReadUint32(value)
 	if err != nil {
@@ -155,7 +172,7 @@ func (self *StateStore) getMerkleTree(key []byte) (uint32, []common.Uint256, err
 	hashes := make([]common.Uint256, 0, hashCount)
 	for i := 0; i < hashCount; i++ {
 		var hash = new(common.Uint256)
-		err = hash.Deserialize(value)
+		err := hash.Deserialize(value)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -175,11 +192,13 @@ func (self *StateStore) GetStateMerkleRoot(height uint32) (result common.Uint256
 		return
 	}
 	source := common.NewZeroCopySource(value)
-	_, eof := source.NextHash()
-	if eof {
-		err = io.ErrUnexpectedEOF
+	//the write set hash is dropped by state pruning
+	if len(value) != common.UINT256_SIZE {
+		if _, eof := source.NextHash(); eof {
+			err = io.ErrUnexpectedEOF
+		}
 	}
-	result, eof = source.NextHash()
+	result, eof := source.NextHash()
 	if eof {
 		err = io.ErrUnexpectedEOF
 	}
@@ -195,17 +214,10 @@ func (self *StateStore) AddStateMerkleTreeRoot(blockHeight uint32, writeSetHash
 	key := self.genStateMerkleTreeKey()
 
 	self.deltaMerkleTree.AppendHash(writeSetHash)
-	treeSize := self.deltaMerkleTree.TreeSize()
-	hashes := self.deltaMerkleTree.Hashes()
-	value := common.NewZeroCopySink(make([]byte, 0, 4+len(hashes)*common.UINT256_SIZE))
-	value.WriteUint32(treeSize)
-	for _, hash := range hashes {
-		value.WriteHash(hash)
-	}
-	self.store.BatchPut(key, value.Bytes())
+	self.store.BatchPut(key, encodeMerkleTree(self.deltaMerkleTree))
 
 	key = self.genStateMerkleRootKey(blockHeight)
-	value.Reset()
+	value := common.NewZeroCopySink(make([]byte, 0, 2*common.UINT256_SIZE))
 	value.WriteHash(writeSetHash)
 	value.WriteHash(self.deltaMerkleTree.Root())
 	self.store.BatchPut(key, value.Bytes())
@@ -218,14 +230,7 @@ func (self *StateStore) AddBlockMerkleTreeRoot(txRoot common.Uint256) error {
 	key := self.genBlockMerkleTreeKey()
 
 	self.merkleTree.AppendHash(txRoot)
-	treeSize := self.merkleTree.TreeSize()
-	hashes := self.merkleTree.Hashes()
-	value := common.NewZeroCopySink(make([]byte, 0, 4+len(hashes)*common.UINT256_SIZE))
-	value.WriteUint32(treeSize)
-	for _, hash := range hashes {
-		value.WriteHash(hash)
-	}
-	self.store.BatchPut(key, value.Bytes())
+	self.store.BatchPut(key, encodeMerkleTree(self.merkleTree))
 	return nil
 }
 
@@ -463,7 +468,9 @@ func (self *StateStore) ClearAll() error {
 
 //Close state store
 func (self *StateStore) Close() error {
-	self.merkleHashStore.Close()
+	if self.merkleHashStore != nil {
+		self.merkleHashStore.Close()
+	}
 	return self.store.Close()
 }
 
@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/saveio/themis/core/store/boltstore"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/core/store/leveldbstore"
+)
+
+//Storage engines of ledger
+const (
+	STORE_BACKEND_LEVELDB = "leveldb"
+	STORE_BACKEND_BOLTDB  = "boltdb"
+)
+
+//StoreBackendFile records the storage engine of the ledger in data dir
+const StoreBackendFile = "store_backend"
+
+//NewPersistStore open the store in dbDir with the storage engine
+func NewPersistStore(backend, dbDir string) (scom.PersistStore, error) {
+	switch backend {
+	case STORE_BACKEND_LEVELDB:
+		return leveldbstore.NewLevelDBStore(dbDir)
+	case STORE_BACKEND_BOLTDB:
+		return boltstore.NewBoltDBStore(dbDir)
+	default:
+		return nil, fmt.Errorf("unsupported store backend %s", backend)
+	}
+}
+
+//GetStoreBackend return the storage engine recorded in data dir, empty if not recorded
+func GetStoreBackend(dataDir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, StoreBackendFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+//SaveStoreBackend record the storage engine of the ledger in data dir
+func SaveStoreBackend(dataDir, backend string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dataDir, StoreBackendFile), []byte(backend), 0644)
+}
+
+//ResolveStoreBackend return the storage engine of the ledger in data dir. The ledger created before the engine
+//is recorded is leveldb. If backend is not empty it must be the engine of the existing ledger,
+//a new ledger uses backend or leveldb by default
+func ResolveStoreBackend(dataDir, backend string) (string, error) {
+	if backend != "" {
+		if err := CheckStoreBackend(backend); err != nil {
+			return "", err
+		}
+	}
+	saved, err := GetStoreBackend(dataDir)
+	if err != nil {
+		return "", fmt.Errorf("read store backend error %s", err)
+	}
+	if saved == "" {
+		if _, err := os.Stat(filepath.Join(dataDir, DBDirBlock)); err == nil {
+			saved = STORE_BACKEND_LEVELDB
+		}
+	}
+	switch {
+	case saved == "" && backend == "":
+		return STORE_BACKEND_LEVELDB, nil
+	case saved == "":
+		return backend, nil
+	case backend == "" || backend == saved:
+		return saved, nil
+	default:
+		return "", fmt.Errorf("ledger in %s is stored in %s, run \"themis db migrate --to %s\" to change the store backend",
+			dataDir, saved, backend)
+	}
+}
+
+//CheckStoreBackend return error if backend is not a supported storage engine
+func CheckStoreBackend(backend string) error {
+	switch backend {
+	case STORE_BACKEND_LEVELDB, STORE_BACKEND_BOLTDB:
+		return nil
+	default:
+		return fmt.Errorf("unsupported store backend %s, should be %s or %s",
+			backend, STORE_BACKEND_LEVELDB, STORE_BACKEND_BOLTDB)
+	}
+}
+
+//newSeekIterator return a iterator of store with the key prefix, which starts from the key start
+func newSeekIterator(store scom.PersistStore, prefix, start []byte) scom.StoreIterator {
+	if seekable, ok := store.(scom.SeekableStore); ok {
+		return seekable.NewSeekIterator(prefix, start)
+	}
+	return &skipIterator{StoreIterator: store.NewIterator(prefix), start: start}
+}
+
+//skipIterator skip the keys before start of a prefix iterator
+type skipIterator struct {
+	scom.StoreIterator
+	start []byte
+}
+
+func (self *skipIterator) Next() bool {
+	for self.StoreIterator.Next() {
+		if bytes.Compare(self.Key(), self.start) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *skipIterator) First() bool {
+	if !self.StoreIterator.First() {
+		return false
+	}
+	if bytes.Compare(self.Key(), self.start) >= 0 {
+		return true
+	}
+	return self.Next()
+}
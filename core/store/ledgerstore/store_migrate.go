@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//number of keys written in a batch when migrating store
+const migrateBatchSize = 10000
+
+//MigrateStoreResult is the outcome of a store backend migration
+type MigrateStoreResult struct {
+	From   string            //The storage engine migrated from
+	To     string            //The storage engine migrated to
+	Keys   map[string]uint64 //Number of keys copied of every store
+	Backup string            //The path the original ledger is moved to
+}
+
+//MigrateStore copy the ledger in dataDir to the storage engine backend. The ledger is copied to a new dir,
+//which replaces dataDir after all the stores are copied, and the original ledger is kept in a backup dir.
+//The node using dataDir should be stopped
+func MigrateStore(dataDir, backend string) (*MigrateStoreResult, error) {
+	if err := CheckStoreBackend(backend); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, DBDirBlock)); err != nil {
+		return nil, fmt.Errorf("no ledger found in %s", dataDir)
+	}
+	from, err := ResolveStoreBackend(dataDir, "")
+	if err != nil {
+		return nil, err
+	}
+	if from == backend {
+		return nil, fmt.Errorf("ledger in %s is already stored in %s", dataDir, backend)
+	}
+	result := &MigrateStoreResult{
+		From:   from,
+		To:     backend,
+		Keys:   make(map[string]uint64),
+		Backup: fmt.Sprintf("%s.%s.bak", filepath.Clean(dataDir), from),
+	}
+	if _, err := os.Stat(result.Backup); err == nil {
+		return nil, fmt.Errorf("backup dir %s already exists", result.Backup)
+	}
+	tmpDir := filepath.Clean(dataDir) + ".migrating"
+	//left by an interrupted migration
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	stores := map[string]bool{DBDirBlock: true, DBDirState: true, DBDirEvent: true, DBDirCrossChain: true}
+	for _, entry := range entries {
+		name := entry.Name()
+		src, dst := filepath.Join(dataDir, name), filepath.Join(tmpDir, name)
+		switch {
+		case name == StoreBackendFile:
+			continue
+		case stores[name] && entry.IsDir():
+			count, err := copyStore(from, src, backend, dst)
+			if err != nil {
+				return nil, fmt.Errorf("copy store %s error %s", name, err)
+			}
+			result.Keys[name] = count
+		default:
+			//the merkle tree file and state snapshots are not kept in the stores
+			if err := copyPath(src, dst); err != nil {
+				return nil, fmt.Errorf("copy %s error %s", name, err)
+			}
+		}
+	}
+	if err := SaveStoreBackend(tmpDir, backend); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(dataDir, result.Backup); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpDir, dataDir); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func copyStore(fromBackend, src, toBackend, dst string) (uint64, error) {
+	srcStore, err := NewPersistStore(fromBackend, src)
+	if err != nil {
+		return 0, fmt.Errorf("open %s error %s, is the node running?", src, err)
+	}
+	defer srcStore.Close()
+	dstStore, err := NewPersistStore(toBackend, dst)
+	if err != nil {
+		return 0, fmt.Errorf("open %s error %s", dst, err)
+	}
+	defer dstStore.Close()
+
+	iter := srcStore.NewIterator(nil)
+	defer iter.Release()
+	count := uint64(0)
+	dstStore.NewBatch()
+	for iter.Next() {
+		//the key and value may be reused by iterator
+		key := append([]byte{}, iter.Key()...)
+		value := append([]byte{}, iter.Value()...)
+		dstStore.BatchPut(key, value)
+		count++
+		if count%migrateBatchSize == 0 {
+			if err := dstStore.BatchCommit(); err != nil {
+				return 0, err
+			}
+			dstStore.NewBatch()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if err := dstStore.BatchCommit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func copyPath(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+		return copyFile(path, target, info.Mode())
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
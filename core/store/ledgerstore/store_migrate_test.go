@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package ledgerstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateStore(t *testing.T) {
+	dataDir := "test/migrate"
+	defer os.RemoveAll("test/migrate.migrating")
+	defer os.RemoveAll("test/migrate.leveldb.bak")
+	defer os.RemoveAll(dataDir)
+
+	blockStore, err := NewBlockStore(STORE_BACKEND_LEVELDB, filepath.Join(dataDir, DBDirBlock), false)
+	assert.Nil(t, err)
+	assert.Nil(t, blockStore.store.Put([]byte("key"), []byte("value")))
+	blockStore.Close()
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dataDir, MerkleTreeStorePath), []byte("merkle"), 0644))
+
+	backend, err := ResolveStoreBackend(dataDir, "")
+	assert.Nil(t, err)
+	assert.Equal(t, STORE_BACKEND_LEVELDB, backend)
+	_, err = ResolveStoreBackend(dataDir, STORE_BACKEND_BOLTDB)
+	assert.NotNil(t, err)
+
+	result, err := MigrateStore(dataDir, STORE_BACKEND_BOLTDB)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), result.Keys[DBDirBlock])
+
+	backend, err = ResolveStoreBackend(dataDir, "")
+	assert.Nil(t, err)
+	assert.Equal(t, STORE_BACKEND_BOLTDB, backend)
+	blockStore, err = NewBlockStore(backend, filepath.Join(dataDir, DBDirBlock), false)
+	assert.Nil(t, err)
+	value, err := blockStore.store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	blockStore.Close()
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, MerkleTreeStorePath))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("merkle"), data)
+
+	_, err = MigrateStore(dataDir, STORE_BACKEND_BOLTDB)
+	assert.NotNil(t, err)
+}
@@ -288,13 +288,14 @@ func (self *StateStore) HandleInvokeTransaction(store store.LedgerStore, overlay
 	return sc.CrossHashes, nil
 }
 
-func SaveNotify(eventStore scommon.EventStore, txHash common.Uint256, notify *event.ExecuteNotify) error {
+func SaveNotify(eventStore scommon.EventStore, height, txIndex uint32, txHash common.Uint256, notify *event.ExecuteNotify) error {
 	if !sysconfig.DefConfig.Common.EnableEventLog {
 		return nil
 	}
 	if err := eventStore.SaveEventNotifyByTx(txHash, notify); err != nil {
 		return fmt.Errorf("SaveEventNotifyByTx error %s", err)
 	}
+	eventStore.SaveEventIndex(height, txIndex, notify)
 	event.PushSmartCodeEvent(txHash, 0, event.EVENT_NOTIFY, notify)
 	return nil
 }
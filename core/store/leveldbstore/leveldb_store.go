@@ -157,3 +157,56 @@ func (self *LevelDBStore) NewIterator(prefix []byte) common.StoreIterator {
 
 	return iter
 }
+
+//SizeOf return the approximate disk size of the keys with the prefix
+func (self *LevelDBStore) SizeOf(prefix []byte) (int64, error) {
+	sizes, err := self.db.SizeOf([]util.Range{*util.BytesPrefix(prefix)})
+	if err != nil {
+		return 0, err
+	}
+	return sizes.Sum(), nil
+}
+
+//Compact the whole leveldb, the space of deleted keys is reclaimed
+func (self *LevelDBStore) Compact() error {
+	return self.db.CompactRange(util.Range{})
+}
+
+//NewSeekIterator return a iterator of leveldb with the key prefix, which starts from the key start
+func (self *LevelDBStore) NewSeekIterator(prefix, start []byte) common.StoreIterator {
+	keyRange := util.BytesPrefix(prefix)
+	keyRange.Start = start
+	return self.db.NewIterator(keyRange, nil)
+}
+
+//NewReadSnapshot return a consistent read only view of current data in leveldb
+func (self *LevelDBStore) NewReadSnapshot() (common.ReadSnapshot, error) {
+	snapshot, err := self.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBSnapshot{snapshot: snapshot}, nil
+}
+
+type levelDBSnapshot struct {
+	snapshot *leveldb.Snapshot
+}
+
+//Get the value of a key from leveldb snapshot
+func (self *levelDBSnapshot) Get(key []byte) ([]byte, error) {
+	dat, err := self.snapshot.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, common.ErrNotFound
+	}
+	return dat, err
+}
+
+//NewIterator return a iterator of leveldb snapshot with the key prefix
+func (self *levelDBSnapshot) NewIterator(prefix []byte) common.StoreIterator {
+	return self.snapshot.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+//Release the leveldb snapshot
+func (self *levelDBSnapshot) Release() {
+	self.snapshot.Release()
+}
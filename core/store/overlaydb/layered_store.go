@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package overlaydb
+
+import (
+	"github.com/saveio/themis/core/store/common"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+//LayeredStore reads the write set of a block not yet committed on top of the store,
+//so that the next block can be executed while the previous one is being committed
+type LayeredStore struct {
+	common.PersistStore
+	pending *MemDB
+}
+
+func NewLayeredStore(store common.PersistStore, pending *MemDB) *LayeredStore {
+	return &LayeredStore{
+		PersistStore: store,
+		pending:      pending,
+	}
+}
+
+func (self *LayeredStore) Get(key []byte) ([]byte, error) {
+	value, unknown := self.pending.Get(key)
+	if !unknown {
+		if len(value) == 0 {
+			return nil, common.ErrNotFound
+		}
+		return value, nil
+	}
+	return self.PersistStore.Get(key)
+}
+
+func (self *LayeredStore) Has(key []byte) (bool, error) {
+	_, err := self.Get(key)
+	if err == common.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (self *LayeredStore) NewIterator(prefix []byte) common.StoreIterator {
+	memIter := self.pending.NewIterator(util.BytesPrefix(prefix))
+	return NewJoinIter(memIter, self.PersistStore.NewIterator(prefix))
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package overlaydb
+
+import (
+	"testing"
+
+	"github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/core/store/leveldbstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayeredStore(t *testing.T) {
+	store, err := leveldbstore.NewMemLevelDBStore()
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, store.Put(makeKey(i), []byte{byte(i)}))
+	}
+
+	//write set of the block being committed
+	pending := NewOverlayDB(store)
+	pending.Delete(makeKey(1))
+	pending.Put(makeKey(2), []byte("new"))
+	pending.Put(makeKey(5), []byte{5})
+
+	layered := NewLayeredStore(store, pending.GetWriteSet())
+	val, err := layered.Get(makeKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0}, val)
+	_, err = layered.Get(makeKey(1))
+	assert.Equal(t, common.ErrNotFound, err)
+	val, err = layered.Get(makeKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), val)
+	has, err := layered.Has(makeKey(5))
+	assert.Nil(t, err)
+	assert.True(t, has)
+
+	//the next block is executed on top of the layered store
+	overlay := NewOverlayDB(layered)
+	overlay.Delete(makeKey(3))
+	keys := make([][]byte, 0)
+	iter := overlay.NewIterator([]byte("key"))
+	for has := iter.First(); has; has = iter.Next() {
+		keys = append(keys, append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	assert.Equal(t, [][]byte{makeKey(0), makeKey(2), makeKey(5)}, keys)
+}
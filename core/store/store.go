@@ -38,15 +38,40 @@ type ExecuteResult struct {
 	Notify          []*event.ExecuteNotify
 }
 
+const (
+	DEFAULT_EVENT_QUERY_LIMIT = 100  //default max events returned by one query
+	MAX_EVENT_QUERY_LIMIT     = 1000 //max events could be returned by one query
+)
+
+//EventQuery is the filter of indexed event query, results are ordered by height and tx index in block
+type EventQuery struct {
+	Contract    common.Address
+	EventId     uint32          //0 matches any event id
+	Participant *common.Address //nil matches any participant
+	StartHeight uint32
+	EndHeight   uint32 //0 means no upper bound
+	Cursor      string //cursor returned by the previous page, empty for the first page
+	Limit       uint32 //0 means DEFAULT_EVENT_QUERY_LIMIT
+}
+
+//EventQueryResult is a page of events, Cursor is empty if there is no more
+type EventQueryResult struct {
+	Events []*event.ExecuteNotify
+	Cursor string
+}
+
 // LedgerStore provides func with store package.
 type LedgerStore interface {
 	InitLedgerStoreWithGenesisBlock(genesisblock *types.Block, defaultBookkeeper []keypair.PublicKey) error
 	Close() error
 	AddHeaders(headers []*types.Header) error
 	AddBlock(block *types.Block, ccMsg *types.CrossChainMsg, stateMerkleRoot common.Uint256) error
+	AddBlockPipelined(block *types.Block, ccMsg *types.CrossChainMsg, stateMerkleRoot common.Uint256) error
+	WaitBlockCommitted() error
 	ExecuteBlock(b *types.Block) (ExecuteResult, error)                                       // called by consensus
 	SubmitBlock(b *types.Block, crossChainMsg *types.CrossChainMsg, exec ExecuteResult) error // called by consensus
 	GetStateMerkleRoot(height uint32) (result common.Uint256, err error)
+	GetStateCheckpointRoot(height uint32) (common.Uint256, error)
 	GetCurrentBlockHash() common.Uint256
 	GetCurrentBlockHeight() uint32
 	GetCurrentHeaderHeight() uint32
@@ -65,8 +90,10 @@ type LedgerStore interface {
 	GetContractState(contractHash common.Address) (*payload.DeployCode, error)
 	GetBookkeeperState() (*states.BookkeeperState, error)
 	GetStorageItem(key *states.StorageKey) (*states.StorageItem, error)
+	GetStorageItemAtHeight(key *states.StorageKey, height uint32) (*states.StorageItem, error)
 	PreExecuteContract(tx *types.Transaction) (*cstates.PreExecResult, error)
 	PreExecuteContractBatch(txes []*types.Transaction, atomic bool) ([]*cstates.PreExecResult, uint32, error)
+	PreExecuteContractAtHeight(tx *types.Transaction, height uint32) (*cstates.PreExecResult, error)
 	GetEventNotifyByTx(tx common.Uint256) (*event.ExecuteNotify, error)
 	GetEventNotifyByBlock(height uint32) ([]*event.ExecuteNotify, error)
 
@@ -75,7 +102,20 @@ type LedgerStore interface {
 	GetCrossChainMsg(height uint32) (*types.CrossChainMsg, error)
 	GetCrossStatesProof(height uint32, key []byte) ([]byte, error)
 	EnableBlockPrune(numBeforeCurr uint32)
+	EnableStatePrune(numBeforeCurr uint32)
+	EnableLightMode()
+	IsLightMode() bool
+	EnableArchiveMode() error
+	IsArchiveMode() bool
+	GetArchiveRange() (uint32, uint32, bool)
+
+	//state snapshot
+	EnableStateSnapshot(interval uint32)
+	GetStateSnapshot(height uint32) (*types.StateSnapshot, error)
+	GetStateSnapshotChunk(height, index uint32) ([]byte, error)
+	ImportStateSnapshot(block *types.Block, snapshot *types.StateSnapshot, chunks [][]byte) error
 
 	GetEventNotifyByEventId(contractAddress common.Address, address common.Address, eventId uint32) ([]*event.ExecuteNotify, error)
 	GetEventNotifyByEventIdAndHeights(contractAddress common.Address, address []byte, eventId, startHeight, endHeight uint32) ([]*event.ExecuteNotify, error)
+	QueryEventNotify(query *EventQuery) (*EventQueryResult, error)
 }
@@ -20,6 +20,9 @@ package types
 
 import (
 	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/saveio/themis/common"
 )
@@ -91,6 +94,36 @@ func (self *MiningPlot) GetScoopData(scoop int) []byte {
 	return self.data[scoop*SCOOP_SIZE : scoop*SCOOP_SIZE+SCOOP_SIZE]
 }
 
+//PlotFileName return name of plot file, which is <account id>_<start nonce>_<nonces>
+func PlotFileName(id uint64, startNonce uint64, nonces uint64) string {
+	return fmt.Sprintf("%d_%d_%d", id, startNonce, nonces)
+}
+
+//ParsePlotFileName parse account id, start nonce and number of nonces from plot file name
+func ParsePlotFileName(name string) (id uint64, startNonce uint64, nonces uint64, err error) {
+	parts := strings.Split(name, "_")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("invalid plot file name:%s", name)
+	}
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		if values[i], err = strconv.ParseUint(part, 10, 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid plot file name:%s", name)
+		}
+	}
+	if values[2] == 0 {
+		return 0, 0, 0, fmt.Errorf("invalid plot file name:%s, no nonce", name)
+	}
+	return values[0], values[1], values[2], nil
+}
+
+//PlotScoopOffset return offset of scoop data of a nonce in plot file. Plot file stores
+//scoops in PoC2 order, the same scoop of all nonces are together so that mining a view
+//only reads a continuous part of file
+func PlotScoopOffset(scoop uint32, index uint64, nonces uint64) int64 {
+	return int64((uint64(scoop)*nonces + index) * SCOOP_SIZE)
+}
+
 func arraycopy(src []byte, from int64, dst []byte, to int64, count int64) {
 	var i int64
 
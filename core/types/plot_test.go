@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlotFileName(t *testing.T) {
+	id, startNonce, nonces, err := ParsePlotFileName(PlotFileName(123, 456, 789))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(123), id)
+	assert.Equal(t, uint64(456), startNonce)
+	assert.Equal(t, uint64(789), nonces)
+
+	for _, name := range []string{"123_456", "123_456_0", "a_456_789", "123_456_789.tmp"} {
+		_, _, _, err = ParsePlotFileName(name)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestPlotScoopOffset(t *testing.T) {
+	assert.Equal(t, int64(0), PlotScoopOffset(0, 0, 10))
+	assert.Equal(t, int64(3*SCOOP_SIZE), PlotScoopOffset(0, 3, 10))
+	assert.Equal(t, int64((2*10+3)*SCOOP_SIZE), PlotScoopOffset(2, 3, 10))
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/saveio/themis/common"
+)
+
+//StateSnapshot is the manifest of the state at a checkpoint height. The state is split into chunks,
+//each chunk is a list of raw state store key-value pairs
+type StateSnapshot struct {
+	Height          uint32
+	BlockHash       common.Uint256
+	StateMerkleRoot common.Uint256
+	ChunkHashes     []common.Uint256
+}
+
+func (this *StateSnapshot) Serialization(sink *common.ZeroCopySink) {
+	sink.WriteUint32(this.Height)
+	sink.WriteHash(this.BlockHash)
+	sink.WriteHash(this.StateMerkleRoot)
+	sink.WriteVarUint(uint64(len(this.ChunkHashes)))
+	for _, hash := range this.ChunkHashes {
+		sink.WriteHash(hash)
+	}
+}
+
+func (this *StateSnapshot) Deserialization(source *common.ZeroCopySource) error {
+	var eof bool
+	this.Height, eof = source.NextUint32()
+	if eof {
+		return fmt.Errorf("StateSnapshot, deserialization read height error")
+	}
+	this.BlockHash, eof = source.NextHash()
+	if eof {
+		return fmt.Errorf("StateSnapshot, deserialization read block hash error")
+	}
+	this.StateMerkleRoot, eof = source.NextHash()
+	if eof {
+		return fmt.Errorf("StateSnapshot, deserialization read state merkle root error")
+	}
+	n, _, irr, eof := source.NextVarUint()
+	if irr || eof {
+		return fmt.Errorf("StateSnapshot, deserialization read chunk count error")
+	}
+	if n > uint64(source.Len())/common.UINT256_SIZE {
+		return fmt.Errorf("StateSnapshot, deserialization chunk count %d too large", n)
+	}
+	this.ChunkHashes = make([]common.Uint256, 0, n)
+	for i := uint64(0); i < n; i++ {
+		hash, eof := source.NextHash()
+		if eof {
+			return fmt.Errorf("StateSnapshot, deserialization read chunk hash error")
+		}
+		this.ChunkHashes = append(this.ChunkHashes, hash)
+	}
+	return nil
+}
+
+//Hash identifies the snapshot, peers serving the same state produce the same hash
+func (this *StateSnapshot) Hash() common.Uint256 {
+	sink := common.NewZeroCopySink(nil)
+	this.Serialization(sink)
+	return common.Uint256(sha256.Sum256(sink.Bytes()))
+}
+
+//StateChunkHash return the hash of a snapshot chunk
+func StateChunkHash(chunk []byte) common.Uint256 {
+	return common.Uint256(sha256.Sum256(chunk))
+}
+
+//WriteStateChunkEntry writes a state key-value pair to a chunk
+func WriteStateChunkEntry(sink *common.ZeroCopySink, key, value []byte) {
+	sink.WriteVarBytes(key)
+	sink.WriteVarBytes(value)
+}
+
+//ForEachStateChunkEntry iterates the key-value pairs of a snapshot chunk
+func ForEachStateChunkEntry(chunk []byte, fn func(key, value []byte)) error {
+	source := common.NewZeroCopySource(chunk)
+	for source.Len() > 0 {
+		key, _, irr, eof := source.NextVarBytes()
+		if irr || eof {
+			return fmt.Errorf("state chunk, read key error")
+		}
+		value, _, irr, eof := source.NextVarBytes()
+		if irr || eof {
+			return fmt.Errorf("state chunk, read value error")
+		}
+		fn(key, value)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"testing"
+
+	"github.com/saveio/themis/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateSnapshot(t *testing.T) {
+	snapshot := &StateSnapshot{
+		Height:          100,
+		BlockHash:       common.Uint256{1},
+		StateMerkleRoot: common.Uint256{2},
+		ChunkHashes:     []common.Uint256{{3}, {4}},
+	}
+	sink := common.NewZeroCopySink(nil)
+	snapshot.Serialization(sink)
+
+	var snapshot1 StateSnapshot
+	err := snapshot1.Deserialization(common.NewZeroCopySource(sink.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, *snapshot, snapshot1)
+	assert.Equal(t, snapshot.Hash(), snapshot1.Hash())
+
+	chunk := common.NewZeroCopySink(nil)
+	WriteStateChunkEntry(chunk, []byte{1}, []byte{2})
+	WriteStateChunkEntry(chunk, []byte{3}, []byte{4})
+	entries := make(map[byte]byte)
+	err = ForEachStateChunkEntry(chunk.Bytes(), func(key, value []byte) {
+		entries[key[0]] = value[0]
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[byte]byte{1: 2, 3: 4}, entries)
+	assert.Error(t, ForEachStateChunkEntry(chunk.Bytes()[:3], func(key, value []byte) {}))
+}
@@ -25,3 +25,15 @@ func CalculateScoop(view uint64, gensig []byte) uint32 {
 	scoop := (uint32(newGenSig[30]&0x0F) << 8) | uint32(newGenSig[31])
 	return scoop
 }
+
+//CalculateDeadline return the deadline of scoop data for generation signature, same with burst calculateHit
+func CalculateDeadline(gensig []byte, scoopData []byte) uint64 {
+	data := append([]byte{}, gensig[:]...) // gensig 32 bytes
+	data = append(data, scoopData[:]...)   // scoop 64 bytes
+
+	md := common.NewShabal256()
+	md.Update(data, 0, int64(len(data)))
+	hash := md.Digest()
+
+	return binary.LittleEndian.Uint64(hash)
+}
@@ -49,6 +49,11 @@ func VerifyTransaction(tx *types.Transaction) ontErrors.ErrCode {
 	return ontErrors.ErrNoError
 }
 
+// VerifyTransactionSignatures only checks the signatures of transaction, used for the transactions of synced blocks
+func VerifyTransactionSignatures(tx *types.Transaction) error {
+	return checkTransactionSignatures(tx)
+}
+
 func VerifyTransactionWithLedger(tx *types.Transaction, ledger *ledger.Ledger) ontErrors.ErrCode {
 	//TODO: replay check
 	return ontErrors.ErrNoError
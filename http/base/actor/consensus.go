@@ -19,10 +19,20 @@
 package actor
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/ontio/ontology-eventbus/actor"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/common/log"
 	cactor "github.com/saveio/themis/consensus/actor"
 )
 
+//generating a batch of blocks takes far longer than a normal actor request
+const GENERATE_BLOCKS_TIMEOUT = 120
+
 var consensusSrvPid *actor.PID
 
 func SetConsensusPid(actr *actor.PID) {
@@ -44,3 +54,63 @@ func ConsensusSrvHalt() error {
 	}
 	return nil
 }
+
+//block production control is only supported by solo and devnet consensus
+func checkBlockControl() error {
+	if consensusSrvPid == nil {
+		return errors.New("consensus is not running")
+	}
+	switch config.DefConfig.Genesis.ConsensusType {
+	case config.CONSENSUS_TYPE_SOLO, config.CONSENSUS_TYPE_DEVNET:
+		return nil
+	}
+	return fmt.Errorf("block control is not supported by %s consensus", config.DefConfig.Genesis.ConsensusType)
+}
+
+//generate blocks on demand by consensus actor
+func GenerateBlocks(count uint32) ([]common.Uint256, error) {
+	if err := checkBlockControl(); err != nil {
+		return nil, err
+	}
+	future := consensusSrvPid.RequestFuture(&cactor.GenerateBlocks{Count: count}, GENERATE_BLOCKS_TIMEOUT*time.Second)
+	result, err := future.Result()
+	if err != nil {
+		log.Errorf(ERR_ACTOR_COMM, err)
+		return nil, err
+	}
+	rsp, ok := result.(*cactor.GenerateBlocksRsp)
+	if !ok {
+		return nil, errors.New("fail")
+	}
+	return rsp.Hashes, rsp.Error
+}
+
+//switch block production mode of consensus actor
+func SetGenBlockMode(mode string) error {
+	if err := checkBlockControl(); err != nil {
+		return err
+	}
+	return requestControl(&cactor.SetGenBlockMode{Mode: mode})
+}
+
+//set timestamp of next block produced by consensus actor
+func SetNextBlockTime(timestamp uint32) error {
+	if err := checkBlockControl(); err != nil {
+		return err
+	}
+	return requestControl(&cactor.SetNextBlockTime{Timestamp: timestamp})
+}
+
+func requestControl(msg interface{}) error {
+	future := consensusSrvPid.RequestFuture(msg, REQ_TIMEOUT*time.Second)
+	result, err := future.Result()
+	if err != nil {
+		log.Errorf(ERR_ACTOR_COMM, err)
+		return err
+	}
+	rsp, ok := result.(*cactor.ControlRsp)
+	if !ok {
+		return errors.New("fail")
+	}
+	return rsp.Error
+}
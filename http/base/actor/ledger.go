@@ -22,6 +22,8 @@ import (
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/core/ledger"
 	"github.com/saveio/themis/core/payload"
+	"github.com/saveio/themis/core/store"
+	scom "github.com/saveio/themis/core/store/common"
 	"github.com/saveio/themis/core/types"
 	"github.com/saveio/themis/smartcontract/event"
 	cstate "github.com/saveio/themis/smartcontract/states"
@@ -32,6 +34,25 @@ const (
 	ERR_ACTOR_COMM = "[http] Actor comm error: %v"
 )
 
+//LightClient fetch transactions, events and storage from peers when the ledger only has headers
+type LightClient interface {
+	GetTransaction(txHash common.Uint256) (*types.Transaction, uint32, error)
+	GetEventNotifyByTx(txHash common.Uint256) (*event.ExecuteNotify, error)
+	GetStorageItem(contract common.Address, key []byte) ([]byte, error)
+}
+
+var lightClient LightClient
+
+func SetLightClient(client LightClient) {
+	lightClient = client
+}
+
+//IsUnverified return whether storage values and events are fetched by light client, they have no proof and are
+//only agreed by peers
+func IsUnverified() bool {
+	return lightClient != nil
+}
+
 //GetHeaderByHeight from ledger
 func GetHeaderByHeight(height uint32) (*types.Header, error) {
 	return ledger.DefLedger.GetHeaderByHeight(height)
@@ -64,14 +85,26 @@ func GetCurrentBlockHeight() uint32 {
 
 //GetTransaction from ledger
 func GetTransaction(hash common.Uint256) (*types.Transaction, error) {
+	if lightClient != nil {
+		tx, _, err := lightClient.GetTransaction(hash)
+		return tx, err
+	}
 	return ledger.DefLedger.GetTransaction(hash)
 }
 
 //GetStorageItem from ledger
 func GetStorageItem(address common.Address, key []byte) ([]byte, error) {
+	if lightClient != nil {
+		return lightClient.GetStorageItem(address, key)
+	}
 	return ledger.DefLedger.GetStorageItem(address, key)
 }
 
+//GetStorageItemAtHeight from ledger, the ledger should run in archive mode
+func GetStorageItemAtHeight(address common.Address, key []byte, height uint32) ([]byte, error) {
+	return ledger.DefLedger.GetStorageItemAtHeight(address, key, height)
+}
+
 //GetContractStateFromStore from ledger
 func GetContractStateFromStore(hash common.Address) (*payload.DeployCode, error) {
 	hash = updateNativeSCAddr(hash)
@@ -80,6 +113,10 @@ func GetContractStateFromStore(hash common.Address) (*payload.DeployCode, error)
 
 //GetTxnWithHeightByTxHash from ledger
 func GetTxnWithHeightByTxHash(hash common.Uint256) (uint32, *types.Transaction, error) {
+	if lightClient != nil {
+		tx, height, err := lightClient.GetTransaction(hash)
+		return height, tx, err
+	}
 	tx, height, err := ledger.DefLedger.GetTransactionWithHeight(hash)
 	return height, tx, err
 }
@@ -89,12 +126,24 @@ func PreExecuteContract(tx *types.Transaction) (*cstate.PreExecResult, error) {
 	return ledger.DefLedger.PreExecuteContract(tx)
 }
 
+//PreExecuteContractAtHeight on the state of height, the ledger should run in archive mode
+func PreExecuteContractAtHeight(tx *types.Transaction, height uint32) (*cstate.PreExecResult, error) {
+	return ledger.DefLedger.PreExecuteContractAtHeight(tx, height)
+}
+
 func PreExecuteContractBatch(tx []*types.Transaction, atomic bool) ([]*cstate.PreExecResult, uint32, error) {
 	return ledger.DefLedger.PreExecuteContractBatch(tx, atomic)
 }
 
 //GetEventNotifyByTxHash from ledger
 func GetEventNotifyByTxHash(txHash common.Uint256) (*event.ExecuteNotify, error) {
+	if lightClient != nil {
+		notify, err := lightClient.GetEventNotifyByTx(txHash)
+		if err == nil && notify == nil {
+			return nil, scom.ErrNotFound
+		}
+		return notify, err
+	}
 	return ledger.DefLedger.GetEventNotifyByTx(txHash)
 }
 
@@ -122,3 +171,8 @@ func GetEventNotifyByEventId(contractAddress common.Address, address common.Addr
 func GetEventNotifyByEventIdAndHeights(contractAddress common.Address, address []byte, eventId, startHeight, endHeight uint32) ([]*event.ExecuteNotify, error) {
 	return ledger.DefLedger.GetEventNotifyByEventIdAndHeight(contractAddress, address, eventId, startHeight, endHeight)
 }
+
+//QueryEventNotify return a page of indexed event notifies
+func QueryEventNotify(query *store.EventQuery) (*store.EventQueryResult, error) {
+	return ledger.DefLedger.QueryEventNotify(query)
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package actor
+
+import "errors"
+
+//Miner is the built-in PoC miner of node
+type Miner interface {
+	GetStats() interface{}
+}
+
+var miner Miner
+
+func SetMiner(m Miner) {
+	miner = m
+}
+
+//GetMiningStats from the built-in miner
+func GetMiningStats() (interface{}, error) {
+	if miner == nil {
+		return nil, errors.New("mining is not enabled")
+	}
+	return miner.GetStats(), nil
+}
@@ -19,9 +19,13 @@
 package actor
 
 import (
+	"errors"
+	"time"
+
 	"github.com/ontio/ontology-eventbus/actor"
 	"github.com/saveio/themis/p2pserver/common"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer_score"
 )
 
 var netServer p2p.P2P
@@ -100,3 +104,27 @@ func GetNodeType() uint64 {
 	}
 	return netServer.GetHostInfo().Services
 }
+
+//GetBannedPeers from netSever actor
+func GetBannedPeers() []*peer_score.BannedPeer {
+	if netServer == nil {
+		return []*peer_score.BannedPeer{}
+	}
+	return netServer.PeerScore().GetBannedPeers()
+}
+
+//BanPeer bans the ip of address for the duration
+func BanPeer(addr string, duration time.Duration) error {
+	if netServer == nil {
+		return errors.New("p2p network is not started")
+	}
+	return netServer.PeerScore().Ban(addr, duration, "banned by rpc")
+}
+
+//UnbanPeer lifts the ban of the ip of address
+func UnbanPeer(addr string) bool {
+	if netServer == nil {
+		return false
+	}
+	return netServer.PeerScore().Unban(addr)
+}
@@ -45,7 +45,7 @@ func SetTxnPoolPid(actr *actor.PID) {
 //append transaction to pool to txpool actor
 func AppendTxToPool(txn *types.Transaction) (ontErrors.ErrCode, string) {
 	if DisableSyncVerifyTx {
-		txReq := &tcomn.TxReq{txn, tcomn.HttpSender, nil}
+		txReq := &tcomn.TxReq{Tx: txn, Sender: tcomn.HttpSender}
 		txnPid.Tell(txReq)
 		return ontErrors.ErrNoError, ""
 	}
@@ -55,7 +55,7 @@ func AppendTxToPool(txn *types.Transaction) (ontErrors.ErrCode, string) {
 		return ontErrors.ErrUnknown, err.Error()
 	}
 	ch := make(chan *tcomn.TxResult, 1)
-	txReq := &tcomn.TxReq{txn, tcomn.HttpSender, ch}
+	txReq := &tcomn.TxReq{Tx: txn, Sender: tcomn.HttpSender, TxResultCh: ch}
 	txnPid.Tell(txReq)
 	if msg, ok := <-ch; ok {
 		return msg.Err, msg.Desc
@@ -129,6 +129,25 @@ func GetTxnCount() ([]uint32, error) {
 	return txnCnt.Count, nil
 }
 
+//GetPayerTxsFromPool returns the payer's pending transactions in nonce order
+func GetPayerTxsFromPool(payer common.Address) ([]*types.Transaction, error) {
+	future := txnPid.RequestFuture(&tcomn.GetPayerTxnReq{Payer: payer}, REQ_TIMEOUT*time.Second)
+	result, err := future.Result()
+	if err != nil {
+		log.Errorf(ERR_ACTOR_COMM, err)
+		return nil, err
+	}
+	rsp, ok := result.(*tcomn.GetPayerTxnRsp)
+	if !ok {
+		return nil, errors.New("fail")
+	}
+	txs := make([]*types.Transaction, 0, len(rsp.Txs))
+	for _, entry := range rsp.Txs {
+		txs = append(txs, entry.Tx)
+	}
+	return txs, nil
+}
+
 //GetTxnHashList from txpool actor
 func GetTxnHashList() ([]common.Uint256, error) {
 	future := txnPid.RequestFuture(&tcomn.GetPendingTxnHashReq{}, REQ_TIMEOUT*time.Second)
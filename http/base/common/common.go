@@ -29,6 +29,7 @@ import (
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/core/payload"
+	"github.com/saveio/themis/core/store"
 	"github.com/saveio/themis/core/types"
 	cutils "github.com/saveio/themis/core/utils"
 	"github.com/saveio/themis/crypto/keypair"
@@ -72,6 +73,11 @@ type ExecuteNotify struct {
 	Notify      []NotifyEventInfo
 }
 
+type EventQueryRsp struct {
+	Events []*ExecuteNotify
+	Cursor string
+}
+
 type PreExecuteResult struct {
 	State  byte
 	Gas    uint64
@@ -174,6 +180,28 @@ type TXNEntryInfo struct {
 	State []TXNAttrInfo // the result from each validator
 }
 
+type PayerTxInfo struct {
+	Hash     string
+	Nonce    uint32
+	GasPrice uint64
+	GasLimit uint64
+}
+
+//GetPayerTxInfos converts payer's pool transactions to PayerTxInfo list
+func GetPayerTxInfos(txs []*types.Transaction) []PayerTxInfo {
+	ret := make([]PayerTxInfo, 0, len(txs))
+	for _, tx := range txs {
+		hash := tx.Hash()
+		ret = append(ret, PayerTxInfo{
+			Hash:     hash.ToHexString(),
+			Nonce:    tx.Nonce,
+			GasPrice: tx.GasPrice,
+			GasLimit: tx.GasLimit,
+		})
+	}
+	return ret
+}
+
 func GetLogEvent(obj *event.LogEventArgs) (map[string]bool, LogEventArgs) {
 	hash := obj.TxHash
 	addr := obj.ContractAddress.ToHexString()
@@ -192,6 +220,23 @@ func GetExecuteNotify(obj *event.ExecuteNotify) (map[string]bool, ExecuteNotify)
 	return contractAddrs, ExecuteNotify{txhash, obj.State, obj.GasConsumed, evts}
 }
 
+//QueryEvents return a page of the indexed events matching query
+func QueryEvents(query *store.EventQuery) (*EventQueryRsp, error) {
+	result, err := bactor.QueryEventNotify(query)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &EventQueryRsp{
+		Events: make([]*ExecuteNotify, 0, len(result.Events)),
+		Cursor: result.Cursor,
+	}
+	for _, evt := range result.Events {
+		_, notify := GetExecuteNotify(evt)
+		rsp.Events = append(rsp.Events, &notify)
+	}
+	return rsp, nil
+}
+
 func GetEventForContract(obj *event.ExecuteNotify, address common.Address) []interface{} {
 	evts := []interface{}{}
 
@@ -320,6 +365,32 @@ func GetBalance(address common.Address) (*BalanceOfRsp, error) {
 	}, nil
 }
 
+func GetBalanceAtHeight(address common.Address, height uint32) (*BalanceOfRsp, error) {
+	mutable, err := NewNativeInvokeTransaction(0, 0, utils.UsdtContractAddress, 0, "balanceOf", []interface{}{address[:]})
+	if err != nil {
+		return nil, fmt.Errorf("NewNativeInvokeTransaction error:%s", err)
+	}
+	tx, err := mutable.IntoImmutable()
+	if err != nil {
+		return nil, err
+	}
+	result, err := bactor.PreExecuteContractAtHeight(tx, height)
+	if err != nil {
+		return nil, fmt.Errorf("PrepareInvokeContract error:%s", err)
+	}
+	if result.State == 0 {
+		return nil, fmt.Errorf("prepare invoke failed")
+	}
+	data, err := hex.DecodeString(result.Result.(string))
+	if err != nil {
+		return nil, fmt.Errorf("hex.DecodeString error:%s", err)
+	}
+	return &BalanceOfRsp{
+		Usdt:   fmt.Sprintf("%d", common.BigIntFromNeoBytes(data).Uint64()),
+		Height: fmt.Sprintf("%d", height),
+	}, nil
+}
+
 func GetAllowance(asset string, from, to common.Address) (string, error) {
 	var contractAddr common.Address
 	switch strings.ToLower(asset) {
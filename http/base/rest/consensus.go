@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package rest
+
+import (
+	"math"
+
+	bactor "github.com/saveio/themis/http/base/actor"
+	berr "github.com/saveio/themis/http/base/error"
+)
+
+//generate blocks on demand, only for solo and devnet consensus
+func GenerateBlocks(cmd map[string]interface{}) map[string]interface{} {
+	count := uint32(1)
+	if c, ok := cmd["Count"]; ok {
+		n, ok := c.(float64)
+		if !ok || n < 1 || n > math.MaxUint32 {
+			return ResponsePack(berr.INVALID_PARAMS)
+		}
+		count = uint32(n)
+	}
+	hashes, err := bactor.GenerateBlocks(count)
+	if err != nil {
+		resp := ResponsePack(berr.INTERNAL_ERROR)
+		resp["Result"] = err.Error()
+		return resp
+	}
+	result := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		result = append(result, hash.ToHexString())
+	}
+	resp := ResponsePack(berr.SUCCESS)
+	resp["Result"] = result
+	return resp
+}
+
+//switch block production mode, only for solo and devnet consensus
+func SetGenBlockMode(cmd map[string]interface{}) map[string]interface{} {
+	mode, ok := cmd["Mode"].(string)
+	if !ok {
+		return ResponsePack(berr.INVALID_PARAMS)
+	}
+	if err := bactor.SetGenBlockMode(mode); err != nil {
+		resp := ResponsePack(berr.INTERNAL_ERROR)
+		resp["Result"] = err.Error()
+		return resp
+	}
+	resp := ResponsePack(berr.SUCCESS)
+	resp["Result"] = true
+	return resp
+}
+
+//set timestamp of next block, only for solo and devnet consensus
+func SetNextBlockTime(cmd map[string]interface{}) map[string]interface{} {
+	timestamp, ok := cmd["Timestamp"].(float64)
+	if !ok || timestamp <= 0 || timestamp > math.MaxUint32 {
+		return ResponsePack(berr.INVALID_PARAMS)
+	}
+	if err := bactor.SetNextBlockTime(uint32(timestamp)); err != nil {
+		resp := ResponsePack(berr.INTERNAL_ERROR)
+		resp["Result"] = err.Error()
+		return resp
+	}
+	resp := ResponsePack(berr.SUCCESS)
+	resp["Result"] = true
+	return resp
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/core/store"
 	scom "github.com/saveio/themis/core/store/common"
 	"github.com/saveio/themis/core/types"
 	ontErrors "github.com/saveio/themis/errors"
@@ -33,6 +34,7 @@ import (
 	"github.com/saveio/themis/http/base/sys"
 	"github.com/saveio/themis/smartcontract/event"
 	"github.com/saveio/themis/smartcontract/service/native/utils"
+	cstate "github.com/saveio/themis/smartcontract/states"
 )
  
  const TLS_PORT int = 443
@@ -271,7 +273,16 @@ import (
 	 log.Debugf("SendRawTransaction recv %s", hash.ToHexString())
 	 if txn.TxType == types.InvokeNeo || txn.TxType == types.InvokeWasm || txn.TxType == types.Deploy {
 		 if preExec, ok := cmd["PreExec"].(string); ok && preExec == "1" {
-			 rst, err := bactor.PreExecuteContract(txn)
+			 height, atHeight, err := getOptionalHeight(cmd)
+			 if err != nil {
+				 return ResponsePack(berr.INVALID_PARAMS)
+			 }
+			 var rst *cstate.PreExecResult
+			 if atHeight {
+				 rst, err = bactor.PreExecuteContractAtHeight(txn, height)
+			 } else {
+				 rst, err = bactor.PreExecuteContract(txn)
+			 }
 			 if err != nil {
 				 log.Infof("PreExec: ", err)
 				 resp = ResponsePack(berr.SMARTCODE_ERROR)
@@ -396,6 +407,9 @@ import (
 	 }
 	 _, notify := bcomn.GetExecuteNotify(eventInfo)
 	 resp["Result"] = notify
+	 if bactor.IsUnverified() {
+		 resp["Unverified"] = true
+	 }
 	 return resp
  }
  
@@ -537,6 +551,55 @@ import (
 	 return resp
  }
  
+ //query the indexed events of contract page by page
+ func GetSmartCodeEventByQuery(cmd map[string]interface{}) map[string]interface{} {
+	 resp := ResponsePack(berr.SUCCESS)
+ 
+	 addr, ok := cmd["ContractAddr"].(string)
+	 if !ok {
+		 return ResponsePack(berr.INVALID_PARAMS)
+	 }
+	 contractAddr, err := bcomn.GetAddress(addr)
+	 if err != nil {
+		 return ResponsePack(berr.INVALID_PARAMS)
+	 }
+	 query := &store.EventQuery{Contract: contractAddr}
+	 if addr, ok := cmd["Addr"].(string); ok && len(addr) > 0 {
+		 participant, err := bcomn.GetAddress(addr)
+		 if err != nil {
+			 return ResponsePack(berr.INVALID_PARAMS)
+		 }
+		 query.Participant = &participant
+	 }
+	 numbers := map[string]*uint32{
+		 "EventId":     &query.EventId,
+		 "StartHeight": &query.StartHeight,
+		 "EndHeight":   &query.EndHeight,
+		 "Limit":       &query.Limit,
+	 }
+	 for name, number := range numbers {
+		 param, ok := cmd[name].(string)
+		 if !ok || len(param) == 0 {
+			 continue
+		 }
+		 value, err := strconv.ParseUint(param, 10, 32)
+		 if err != nil {
+			 return ResponsePack(berr.INVALID_PARAMS)
+		 }
+		 *number = uint32(value)
+	 }
+	 query.Cursor, _ = cmd["Cursor"].(string)
+ 
+	 rsp, err := bcomn.QueryEvents(query)
+	 if err != nil {
+		 resp = ResponsePack(berr.INVALID_PARAMS)
+		 resp["Result"] = err.Error()
+		 return resp
+	 }
+	 resp["Result"] = rsp
+	 return resp
+ }
+ 
  //get contract state
  func GetContractState(cmd map[string]interface{}) map[string]interface{} {
 	 resp := ResponsePack(berr.SUCCESS)
@@ -581,7 +644,16 @@ import (
 	 if err != nil {
 		 return ResponsePack(berr.INVALID_PARAMS)
 	 }
-	 value, err := bactor.GetStorageItem(address, item)
+	 height, atHeight, err := getOptionalHeight(cmd)
+	 if err != nil {
+		 return ResponsePack(berr.INVALID_PARAMS)
+	 }
+	 var value []byte
+	 if atHeight {
+		 value, err = bactor.GetStorageItemAtHeight(address, item, height)
+	 } else {
+		 value, err = bactor.GetStorageItem(address, item)
+	 }
 	 if err != nil {
 		 if err == scom.ErrNotFound {
 			 return ResponsePack(berr.SUCCESS)
@@ -589,6 +661,9 @@ import (
 		 return ResponsePack(berr.INTERNAL_ERROR)
 	 }
 	 resp["Result"] = common.ToHexString(value)
+	 if !atHeight && bactor.IsUnverified() {
+		 resp["Unverified"] = true
+	 }
 	 return resp
  }
  
@@ -603,13 +678,35 @@ import (
 	 if err != nil {
 		 return ResponsePack(berr.INVALID_PARAMS)
 	 }
-	 balance, err := bcomn.GetBalance(address)
+	 height, atHeight, err := getOptionalHeight(cmd)
+	 if err != nil {
+		 return ResponsePack(berr.INVALID_PARAMS)
+	 }
+	 var balance *bcomn.BalanceOfRsp
+	 if atHeight {
+		 balance, err = bcomn.GetBalanceAtHeight(address, height)
+	 } else {
+		 balance, err = bcomn.GetBalance(address)
+	 }
 	 if err != nil {
 		 return ResponsePack(berr.INVALID_PARAMS)
 	 }
 	 resp["Result"] = balance
 	 return resp
  }
+
+ //get the optional query height, the current state is queried without it
+ func getOptionalHeight(cmd map[string]interface{}) (uint32, bool, error) {
+	 param, ok := cmd["Height"].(string)
+	 if !ok || len(param) == 0 {
+		 return 0, false, nil
+	 }
+	 height, err := strconv.ParseUint(param, 10, 32)
+	 if err != nil {
+		 return 0, false, err
+	 }
+	 return uint32(height), true, nil
+ }
  
  //get merkle proof by transaction hash
  func GetMerkleProof(cmd map[string]interface{}) map[string]interface{} {
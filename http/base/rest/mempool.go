@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package rest
+
+import (
+	"github.com/saveio/themis/common"
+	bactor "github.com/saveio/themis/http/base/actor"
+	bcomn "github.com/saveio/themis/http/base/common"
+	berr "github.com/saveio/themis/http/base/error"
+)
+
+//get pending transactions of a payer in memory pool, ordered by nonce
+func GetMemPoolPayerTxs(cmd map[string]interface{}) map[string]interface{} {
+	addrBase58, ok := cmd["Addr"].(string)
+	if !ok {
+		return ResponsePack(berr.INVALID_PARAMS)
+	}
+	payer, err := common.AddressFromBase58(addrBase58)
+	if err != nil {
+		return ResponsePack(berr.INVALID_PARAMS)
+	}
+	txs, err := bactor.GetPayerTxsFromPool(payer)
+	if err != nil {
+		return ResponsePack(berr.INTERNAL_ERROR)
+	}
+	resp := ResponsePack(berr.SUCCESS)
+	resp["Result"] = bcomn.GetPayerTxInfos(txs)
+	return resp
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/core/payload"
+	"github.com/saveio/themis/core/store"
 	scom "github.com/saveio/themis/core/store/common"
 	"github.com/saveio/themis/core/types"
 	ontErrors "github.com/saveio/themis/errors"
@@ -34,6 +35,7 @@ import (
 	"github.com/saveio/themis/http/base/sys"
 	"github.com/saveio/themis/smartcontract/event"
 	"github.com/saveio/themis/smartcontract/service/native/utils"
+	cstate "github.com/saveio/themis/smartcontract/states"
 )
 
 //get system status score
@@ -137,6 +139,15 @@ func GetSyncStatus(params []interface{}) map[string]interface{} {
 	return responseSuccess(status)
 }
 
+//get status of the built-in miner
+func GetMiningStats(params []interface{}) map[string]interface{} {
+	stats, err := bactor.GetMiningStats()
+	if err != nil {
+		return responsePack(berr.INTERNAL_ERROR, err.Error())
+	}
+	return responseSuccess(stats)
+}
+
 func GetRawMemPool(params []interface{}) map[string]interface{} {
 	txs := []*bcomn.Transactions{}
 	txpool := bactor.GetTxsFromPool(false)
@@ -194,6 +205,26 @@ func GetMemPoolTxState(params []interface{}) map[string]interface{} {
 	}
 }
 
+//get pending transactions of a payer in memory pool, ordered by nonce
+func GetMemPoolPayerTxs(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return responsePack(berr.INVALID_PARAMS, nil)
+	}
+	addrBase58, ok := params[0].(string)
+	if !ok {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	payer, err := common.AddressFromBase58(addrBase58)
+	if err != nil {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	txs, err := bactor.GetPayerTxsFromPool(payer)
+	if err != nil {
+		return responsePack(berr.INTERNAL_ERROR, nil)
+	}
+	return responseSuccess(bcomn.GetPayerTxInfos(txs))
+}
+
 // get raw transaction in raw or json
 // A JSON example for getrawtransaction method as following:
 //   {"jsonrpc": "2.0", "method": "getrawtransaction", "params": ["transactioin hash in hex"], "id": 0}
@@ -238,7 +269,7 @@ func GetRawTransaction(params []interface{}) map[string]interface{} {
 }
 
 //get storage from contract
-//   {"jsonrpc": "2.0", "method": "getstorage", "params": ["code hash", "key"], "id": 0}
+//   {"jsonrpc": "2.0", "method": "getstorage", "params": ["code hash", "key", height(optional)], "id": 0}
 func GetStorage(params []interface{}) map[string]interface{} {
 	if len(params) < 2 {
 		return responsePack(berr.INVALID_PARAMS, nil)
@@ -269,19 +300,32 @@ func GetStorage(params []interface{}) map[string]interface{} {
 	default:
 		return responsePack(berr.INVALID_PARAMS, "")
 	}
-	value, err := bactor.GetStorageItem(address, key)
+	var value []byte
+	var err error
+	if len(params) > 2 {
+		height, ok := params[2].(float64)
+		if !ok {
+			return responsePack(berr.INVALID_PARAMS, "")
+		}
+		value, err = bactor.GetStorageItemAtHeight(address, key, uint32(height))
+	} else {
+		value, err = bactor.GetStorageItem(address, key)
+	}
 	if err != nil {
 		if err == scom.ErrNotFound {
 			return responseSuccess(nil)
 		}
 		return responsePack(berr.INVALID_PARAMS, "")
 	}
+	if len(params) <= 2 && bactor.IsUnverified() {
+		return responseUnverified(common.ToHexString(value))
+	}
 	return responseSuccess(common.ToHexString(value))
 }
 
 //send raw transaction
 // A JSON example for sendrawtransaction method as following:
-//   {"jsonrpc": "2.0", "method": "sendrawtransaction", "params": ["raw transactioin in hex"], "id": 0}
+//   {"jsonrpc": "2.0", "method": "sendrawtransaction", "params": ["raw transactioin in hex", preExec(optional), height(optional)], "id": 0}
 func SendRawTransaction(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
 		return responsePack(berr.INVALID_PARAMS, nil)
@@ -304,7 +348,17 @@ func SendRawTransaction(params []interface{}) map[string]interface{} {
 			if len(params) > 1 {
 				preExec, ok := params[1].(float64)
 				if ok && preExec == 1 {
-					result, err := bactor.PreExecuteContract(txn)
+					var result *cstate.PreExecResult
+					var err error
+					if len(params) > 2 {
+						height, ok := params[2].(float64)
+						if !ok {
+							return responsePack(berr.INVALID_PARAMS, "")
+						}
+						result, err = bactor.PreExecuteContractAtHeight(txn, uint32(height))
+					} else {
+						result, err = bactor.PreExecuteContract(txn)
+					}
 					if err != nil {
 						log.Infof("PreExec: ", err)
 						return responsePack(berr.SMARTCODE_ERROR, err.Error())
@@ -414,6 +468,9 @@ func GetSmartCodeEvent(params []interface{}) map[string]interface{} {
 			return responsePack(berr.INTERNAL_ERROR, "")
 		}
 		_, notify := bcomn.GetExecuteNotify(eventInfo)
+		if bactor.IsUnverified() {
+			return responseUnverified(notify)
+		}
 		return responseSuccess(notify)
 	default:
 		return responsePack(berr.INVALID_PARAMS, "")
@@ -538,6 +595,61 @@ func GetSmartCodeEventByEventIdAndHeights(params []interface{}) map[string]inter
 	return responseSuccess(eInfos)
 }
 
+//query the indexed events of contract page by page, all the params except contract are optional
+//   {"jsonrpc": "2.0", "method": "getsmartcodeeventbyquery", "params": ["contract", eventId, "address", startHeight, endHeight, "cursor", limit], "id": 0}
+func GetSmartCodeEventByQuery(params []interface{}) map[string]interface{} {
+	if !config.DefConfig.Common.EnableEventLog {
+		return responsePack(berr.INVALID_METHOD, "")
+	}
+	if len(params) < 1 || len(params) > 7 {
+		return responsePack(berr.INVALID_PARAMS, nil)
+	}
+	addr, ok := params[0].(string)
+	if !ok {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	contractAddr, err := bcomn.GetAddress(addr)
+	if err != nil {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	query := &store.EventQuery{Contract: contractAddr}
+
+	numbers := []*uint32{&query.EventId, nil, &query.StartHeight, &query.EndHeight, nil, &query.Limit}
+	for i, param := range params[1:] {
+		switch i {
+		case 1:
+			str, ok := param.(string)
+			if !ok {
+				return responsePack(berr.INVALID_PARAMS, "")
+			}
+			if len(str) > 0 {
+				participant, err := bcomn.GetAddress(str)
+				if err != nil {
+					return responsePack(berr.INVALID_PARAMS, "")
+				}
+				query.Participant = &participant
+			}
+		case 4:
+			query.Cursor, ok = param.(string)
+			if !ok {
+				return responsePack(berr.INVALID_PARAMS, "")
+			}
+		default:
+			number, ok := param.(float64)
+			if !ok || number < 0 {
+				return responsePack(berr.INVALID_PARAMS, "")
+			}
+			*numbers[i] = uint32(number)
+		}
+	}
+
+	rsp, err := bcomn.QueryEvents(query)
+	if err != nil {
+		return responsePack(berr.INVALID_PARAMS, err.Error())
+	}
+	return responseSuccess(rsp)
+}
+
 //get block height by transaction hash
 func GetBlockHeightByTxHash(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
@@ -576,7 +688,16 @@ func GetBalance(params []interface{}) map[string]interface{} {
 	if err != nil {
 		return responsePack(berr.INVALID_PARAMS, "")
 	}
-	rsp, err := bcomn.GetBalance(address)
+	var rsp *bcomn.BalanceOfRsp
+	if len(params) > 1 {
+		height, ok := params[1].(float64)
+		if !ok {
+			return responsePack(berr.INVALID_PARAMS, "")
+		}
+		rsp, err = bcomn.GetBalanceAtHeight(address, uint32(height))
+	} else {
+		rsp, err = bcomn.GetBalance(address)
+	}
 	if err != nil {
 		return responsePack(berr.INVALID_PARAMS, "")
 	}
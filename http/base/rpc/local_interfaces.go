@@ -19,6 +19,7 @@
 package rpc
 
 import (
+	"math"
 	"os"
 	"path/filepath"
 	"time"
@@ -46,6 +47,42 @@ func GetNeighbor(params []interface{}) map[string]interface{} {
 	return responseSuccess(addr)
 }
 
+//list the banned peers
+func GetBannedPeers(params []interface{}) map[string]interface{} {
+	return responseSuccess(bactor.GetBannedPeers())
+}
+
+//ban the ip of peer, params: [address, seconds], address in format ip or ip:port
+func BanPeer(params []interface{}) map[string]interface{} {
+	if len(params) < 2 {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	addr, ok := params[0].(string)
+	if !ok {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	seconds, ok := params[1].(float64)
+	if !ok || seconds < 1 || seconds > math.MaxUint32 {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	if err := bactor.BanPeer(addr, time.Duration(seconds)*time.Second); err != nil {
+		return responsePack(berr.INVALID_PARAMS, err.Error())
+	}
+	return responsePack(berr.SUCCESS, true)
+}
+
+//lift the ban of peer, params: [address]
+func UnbanPeer(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	addr, ok := params[0].(string)
+	if !ok {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	return responsePack(berr.SUCCESS, bactor.UnbanPeer(addr))
+}
+
 func GetNodeState(params []interface{}) map[string]interface{} {
 	t := time.Now().UnixNano()
 	port := bactor.GetNodePort()
@@ -85,6 +122,61 @@ func StopConsensus(params []interface{}) map[string]interface{} {
 	return responsePack(berr.SUCCESS, true)
 }
 
+//generate blocks on demand, params: [count]
+func GenerateBlocks(params []interface{}) map[string]interface{} {
+	count := uint32(1)
+	if len(params) >= 1 {
+		switch c := params[0].(type) {
+		case float64:
+			if c < 1 {
+				return responsePack(berr.INVALID_PARAMS, "")
+			}
+			count = uint32(c)
+		default:
+			return responsePack(berr.INVALID_PARAMS, "")
+		}
+	}
+	hashes, err := bactor.GenerateBlocks(count)
+	if err != nil {
+		return responsePack(berr.INTERNAL_ERROR, err.Error())
+	}
+	result := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		result = append(result, hash.ToHexString())
+	}
+	return responseSuccess(result)
+}
+
+//switch block production mode, params: [mode]
+func SetGenBlockMode(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	mode, ok := params[0].(string)
+	if !ok {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	if err := bactor.SetGenBlockMode(mode); err != nil {
+		return responsePack(berr.INTERNAL_ERROR, err.Error())
+	}
+	return responsePack(berr.SUCCESS, true)
+}
+
+//set timestamp of next block, params: [timestamp]
+func SetNextBlockTime(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	timestamp, ok := params[0].(float64)
+	if !ok || timestamp <= 0 || timestamp > math.MaxUint32 {
+		return responsePack(berr.INVALID_PARAMS, "")
+	}
+	if err := bactor.SetNextBlockTime(uint32(timestamp)); err != nil {
+		return responsePack(berr.INTERNAL_ERROR, err.Error())
+	}
+	return responsePack(berr.SUCCESS, true)
+}
+
 func SetDebugInfo(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
 		return responsePack(berr.INVALID_PARAMS, "")
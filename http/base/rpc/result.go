@@ -25,6 +25,13 @@ import (
 func responseSuccess(result interface{}) map[string]interface{} {
 	return responsePack(Err.SUCCESS, result)
 }
+//responseUnverified mark the result fetched by light client without proof
+func responseUnverified(result interface{}) map[string]interface{} {
+	resp := responseSuccess(result)
+	resp["unverified"] = true
+	return resp
+}
+
 func responsePack(errcode int64, result interface{}) map[string]interface{} {
 	resp := map[string]interface{}{
 		"error":  errcode,
@@ -119,13 +119,17 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		response := function(param)
-		data, err := json.Marshal(map[string]interface{}{
+		result := map[string]interface{}{
 			"jsonrpc": "2.0",
 			"error":   response["error"],
 			"desc":    response["desc"],
 			"result":  response["result"],
 			"id":      request["id"],
-		})
+		}
+		if unverified, ok := response["unverified"]; ok {
+			result["unverified"] = unverified
+		}
+		data, err := json.Marshal(result)
 		if err != nil {
 			log.Error("HTTP JSON RPC Handle - json.Marshal: ", err)
 			return
@@ -40,6 +40,7 @@ func StartRPCServer() error {
 	rpc.HandleFunc("getblockhash", rpc.GetBlockHash)
 	rpc.HandleFunc("getconnectioncount", rpc.GetConnectionCount)
 	rpc.HandleFunc("getsyncstatus", rpc.GetSyncStatus)
+	rpc.HandleFunc("getminingstats", rpc.GetMiningStats)
 	//HandleFunc("getrawmempool", GetRawMemPool)
 
 	rpc.HandleFunc("getrawtransaction", rpc.GetRawTransaction)
@@ -52,9 +53,11 @@ func StartRPCServer() error {
 	rpc.HandleFunc("getmempooltxcount", rpc.GetMemPoolTxCount)
 	rpc.HandleFunc("getmempooltxstate", rpc.GetMemPoolTxState)
 	rpc.HandleFunc("getmempooltxhashlist", rpc.GetMemPoolTxHashList)
+	rpc.HandleFunc("getmempoolpayertxs", rpc.GetMemPoolPayerTxs)
 	rpc.HandleFunc("getsmartcodeevent", rpc.GetSmartCodeEvent)
 	rpc.HandleFunc("getsmartcodeeventbyeventid", rpc.GetSmartCodeEventByEventId)
 	rpc.HandleFunc("getsmartcodeeventbyeventidandheights", rpc.GetSmartCodeEventByEventIdAndHeights)
+	rpc.HandleFunc("getsmartcodeeventbyquery", rpc.GetSmartCodeEventByQuery)
 	rpc.HandleFunc("getblockheightbytxhash", rpc.GetBlockHeightByTxHash)
 
 	rpc.HandleFunc("getbalance", rpc.GetBalance)
@@ -40,9 +40,15 @@ func StartLocalServer() error {
 
 	rpc.HandleFunc("getneighbor", rpc.GetNeighbor)
 	rpc.HandleFunc("getnodestate", rpc.GetNodeState)
+	rpc.HandleFunc("getbannedpeers", rpc.GetBannedPeers)
+	rpc.HandleFunc("banpeer", rpc.BanPeer)
+	rpc.HandleFunc("unbanpeer", rpc.UnbanPeer)
 	rpc.HandleFunc("startconsensus", rpc.StartConsensus)
 	rpc.HandleFunc("stopconsensus", rpc.StopConsensus)
 	rpc.HandleFunc("setdebuginfo", rpc.SetDebugInfo)
+	rpc.HandleFunc("generateblocks", rpc.GenerateBlocks)
+	rpc.HandleFunc("setgenblockmode", rpc.SetGenBlockMode)
+	rpc.HandleFunc("setnextblocktime", rpc.SetNextBlockTime)
 
 	// TODO: only listen to local host
 	err := http.ListenAndServe(LOCAL_HOST+":"+strconv.Itoa(int(cfg.DefConfig.Rpc.HttpLocalPort)), nil)
@@ -59,11 +59,37 @@ var (
 		Name: "ontology_p2p_reconnect_count",
 		Help: "ontology p2p reconnect count",
 	})
+
+	syncDownloadSpeedMetric = prom.NewGauge(prom.GaugeOpts{
+		Name: "ontology_block_sync_download_speed",
+		Help: "ontology block sync download speed in kB/s",
+	})
+
+	syncSaveSpeedMetric = prom.NewGauge(prom.GaugeOpts{
+		Name: "ontology_block_sync_save_speed",
+		Help: "ontology block sync saved blocks per second",
+	})
+
+	syncFlightBlocksMetric = prom.NewGauge(prom.GaugeOpts{
+		Name: "ontology_block_sync_flight_blocks",
+		Help: "ontology block sync requested blocks waiting for response",
+	})
+
+	syncCachedBlocksMetric = prom.NewGauge(prom.GaugeOpts{
+		Name: "ontology_block_sync_cached_blocks",
+		Help: "ontology block sync blocks waiting for saving",
+	})
+
+	syncSavedBlocksMetric = prom.NewGauge(prom.GaugeOpts{
+		Name: "ontology_block_sync_saved_blocks",
+		Help: "ontology block sync total saved blocks",
+	})
 )
 
 var (
 	metrics = []prom.Collector{nodePortMetric, blockHeightMetric, inboundsCountMetric,
-		outboundsCountMetric, peerStatusMetric, reconnectCountMetric}
+		outboundsCountMetric, peerStatusMetric, reconnectCountMetric, syncDownloadSpeedMetric,
+		syncSaveSpeedMetric, syncFlightBlocksMetric, syncCachedBlocksMetric, syncSavedBlocksMetric}
 )
 
 func initMetric() error {
@@ -104,6 +130,15 @@ func metricUpdate(n p2p.P2P) {
 	}
 
 	reconnectCountMetric.Set(float64(mh.ReconnectService().ReconnectCount()))
+
+	if syncMgr := mh.BlockSyncMgr(); syncMgr != nil {
+		stats := syncMgr.GetSyncStats()
+		syncDownloadSpeedMetric.Set(stats.DownloadSpeed)
+		syncSaveSpeedMetric.Set(stats.SaveSpeed)
+		syncFlightBlocksMetric.Set(float64(stats.FlightBlocks))
+		syncCachedBlocksMetric.Set(float64(stats.CachedBlocks))
+		syncSavedBlocksMetric.Set(float64(stats.SavedBlocks))
+	}
 }
 
 func updateMetric(n p2p.P2P) {
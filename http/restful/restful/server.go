@@ -77,13 +77,18 @@ const (
 	GET_MEMPOOL_TXCOUNT        = "/api/v1/mempool/txcount"
 	GET_MEMPOOL_TXSTATE        = "/api/v1/mempool/txstate/:hash"
 	GET_MEMPOOL_TXHASHS        = "/api/v1/mempool/txhashlist"
+	GET_MEMPOOL_PAYERTXS       = "/api/v1/mempool/payertxs/:addr"
 	GET_VERSION                = "/api/v1/version"
 	GET_NETWORKID              = "/api/v1/networkid"
 	GET_SYS_STATUS_SCORE       = "/api/v1/getsysstatusscore"
 	GET_SMTCOCE_EVT_ID         = "/api/v1/smartcode/event/eventid/:contract/:addr/:id"
 	GET_SMTCOCE_EVT_ID_HEIGHTS = "/api/v1/smartcode/event/heights/:contract/:id/:start/:end/:addr"
 	GET_SMTCOCE_EVT_ADDR       = "/api/v1/smartcode/event/height/address/:height/:addr"
+	GET_SMTCOCE_EVT_QUERY      = "/api/v1/smartcode/event/query/:contract"
 	POST_RAW_TX                = "/api/v1/transaction"
+	POST_GENERATE_BLOCKS       = "/api/v1/consensus/generateblocks"
+	POST_GEN_BLOCK_MODE        = "/api/v1/consensus/genblockmode"
+	POST_NEXT_BLOCK_TIME       = "/api/v1/consensus/nextblocktime"
 )
 
 //init restful server
@@ -173,16 +178,21 @@ func (this *restServer) registryMethod() {
 		GET_MEMPOOL_TXCOUNT:        {name: "getmempooltxcount", handler: rest.GetMemPoolTxCount},
 		GET_MEMPOOL_TXSTATE:        {name: "getmempooltxstate", handler: rest.GetMemPoolTxState},
 		GET_MEMPOOL_TXHASHS:        {name: "getmempooltxhashlist", handler: rest.GetMemPoolTxHashList},
+		GET_MEMPOOL_PAYERTXS:       {name: "getmempoolpayertxs", handler: rest.GetMemPoolPayerTxs},
 		GET_VERSION:                {name: "getversion", handler: rest.GetNodeVersion},
 		GET_NETWORKID:              {name: "getnetworkid", handler: rest.GetNetworkId},
 		GET_SYS_STATUS_SCORE:       {name: "getsysstatusscore", handler: rest.GetSysStatusScore},
 		GET_SMTCOCE_EVT_ADDR:       {name: "getsmartcodeeventbyheightaddr", handler: rest.GetSmartCodeEventByHeightAndAddress},
 		GET_SMTCOCE_EVT_ID:         {name: "getsmartcodeeventbyeventid", handler: rest.GetSmartCodeEventByEventId},
 		GET_SMTCOCE_EVT_ID_HEIGHTS: {name: "getsmartcodeeventbyeventidandheights", handler: rest.GetSmartCodeEventByEventIdAndHeights},
+		GET_SMTCOCE_EVT_QUERY:      {name: "getsmartcodeeventbyquery", handler: rest.GetSmartCodeEventByQuery},
 	}
 
 	postMethodMap := map[string]Action{
-		POST_RAW_TX: {name: "sendrawtransaction", handler: rest.SendRawTransaction},
+		POST_RAW_TX:          {name: "sendrawtransaction", handler: rest.SendRawTransaction},
+		POST_GENERATE_BLOCKS: {name: "generateblocks", handler: rest.GenerateBlocks},
+		POST_GEN_BLOCK_MODE:  {name: "setgenblockmode", handler: rest.SetGenBlockMode},
+		POST_NEXT_BLOCK_TIME: {name: "setnextblocktime", handler: rest.SetNextBlockTime},
 	}
 	this.postMap = postMethodMap
 	this.getMap = getMethodMap
@@ -222,6 +232,8 @@ func (this *restServer) getPath(url string) string {
 		return GET_GRANTONG
 	} else if strings.Contains(url, strings.TrimRight(GET_MEMPOOL_TXSTATE, ":hash")) {
 		return GET_MEMPOOL_TXSTATE
+	} else if strings.Contains(url, strings.TrimRight(GET_MEMPOOL_PAYERTXS, ":addr")) {
+		return GET_MEMPOOL_PAYERTXS
 	} else if strings.Contains(url, strings.TrimRight(GET_SMTCOCE_EVT_ADDR, ":height/:addr")) {
 		return GET_SMTCOCE_EVT_ADDR
 	} else if strings.Contains(url, strings.TrimRight(GET_SMTCOCE_EVTS, ":hash")) {
@@ -230,6 +242,8 @@ func (this *restServer) getPath(url string) string {
 		return GET_SMTCOCE_EVT_ID
 	} else if strings.Contains(url, strings.TrimRight(GET_SMTCOCE_EVT_ID_HEIGHTS, ":contract/:id/:start/:end/:addr")) {
 		return GET_SMTCOCE_EVT_ID_HEIGHTS
+	} else if strings.Contains(url, strings.TrimRight(GET_SMTCOCE_EVT_QUERY, ":contract")) {
+		return GET_SMTCOCE_EVT_QUERY
 	}
 	return url
 }
@@ -252,9 +266,10 @@ func (this *restServer) getParams(r *http.Request, url string, req map[string]in
 	case GET_CONTRACT_STATE:
 		req["Hash"], req["Raw"] = getParam(r, "hash"), r.FormValue("raw")
 	case POST_RAW_TX:
-		req["PreExec"] = r.FormValue("preExec")
+		req["PreExec"], req["Height"] = r.FormValue("preExec"), r.FormValue("height")
 	case GET_STORAGE:
 		req["Hash"], req["Key"] = getParam(r, "hash"), getParam(r, "key")
+		req["Height"] = r.FormValue("height")
 	case GET_SMTCOCE_EVT_TXS:
 		req["Height"] = getParam(r, "height")
 	case GET_SMTCOCE_EVTS:
@@ -262,7 +277,7 @@ func (this *restServer) getParams(r *http.Request, url string, req map[string]in
 	case GET_BLK_HGT_BY_TXHASH:
 		req["Hash"] = getParam(r, "hash")
 	case GET_BALANCE:
-		req["Addr"] = getParam(r, "addr")
+		req["Addr"], req["Height"] = getParam(r, "addr"), r.FormValue("height")
 	case GET_MERKLE_PROOF:
 		req["Hash"] = getParam(r, "hash")
 	case GET_ALLOWANCE:
@@ -274,6 +289,8 @@ func (this *restServer) getParams(r *http.Request, url string, req map[string]in
 		req["Addr"] = getParam(r, "addr")
 	case GET_MEMPOOL_TXSTATE:
 		req["Hash"] = getParam(r, "hash")
+	case GET_MEMPOOL_PAYERTXS:
+		req["Addr"] = getParam(r, "addr")
 	case GET_SMTCOCE_EVT_ADDR:
 		req["Height"], req["Addr"] = getParam(r, "height"), getParam(r, "addr")
 	case GET_SMTCOCE_EVT_ID:
@@ -286,6 +303,11 @@ func (this *restServer) getParams(r *http.Request, url string, req map[string]in
 		req["StartHeight"] = getParam(r, "start")
 		req["EndHeight"] = getParam(r, "end")
 		req["Addr"] = getParam(r, "addr")
+	case GET_SMTCOCE_EVT_QUERY:
+		req["ContractAddr"] = getParam(r, "contract")
+		req["EventId"], req["Addr"] = r.FormValue("id"), r.FormValue("addr")
+		req["StartHeight"], req["EndHeight"] = r.FormValue("start"), r.FormValue("end")
+		req["Cursor"], req["Limit"] = r.FormValue("cursor"), r.FormValue("limit")
 	default:
 	}
 	return req
@@ -200,12 +200,14 @@ func (self *WsServer) registryMethod() {
 		"getmempooltxcount":                    {handler: rest.GetMemPoolTxCount},
 		"getmempooltxstate":                    {handler: rest.GetMemPoolTxState},
 		"getmempooltxhashlist":                 {handler: rest.GetMemPoolTxHashList},
+		"getmempoolpayertxs":                   {handler: rest.GetMemPoolPayerTxs},
 		"getversion":                           {handler: rest.GetNodeVersion},
 		"getnetworkid":                         {handler: rest.GetNetworkId},
 		"getsysstatusscore":                    {handler: rest.GetSysStatusScore},
 		"getsmartcodeeventbyheightaddr":        {handler: rest.GetSmartCodeEventByHeightAndAddress},
 		"getsmartcodeeventbyeventid":           {handler: rest.GetSmartCodeEventByEventId},
 		"getsmartcodeeventbyeventidandheights": {handler: rest.GetSmartCodeEventByEventIdAndHeights},
+		"getsmartcodeeventbyquery":             {handler: rest.GetSmartCodeEventByQuery},
 
 		"getsessioncount": {handler: getsessioncount},
 	}
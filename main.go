@@ -42,6 +42,11 @@ func setupAPP() *cli.App {
 		cmd.ContractCommand,
 		cmd.ImportCommand,
 		cmd.ExportCommand,
+		cmd.DbCommand,
+		cmd.FsCommand,
+		cmd.DnsCommand,
+		cmd.ChannelCommand,
+		cmd.PlotCommand,
 		cmd.TxCommond,
 		cmd.SigTxCommand,
 		cmd.MultiSigAddrCommand,
@@ -57,6 +62,11 @@ func setupAPP() *cli.App {
 		utils.DisableLogFileFlag,
 		utils.DisableEventLogFlag,
 		utils.DataDirFlag,
+		utils.StateSnapshotIntervalFlag,
+		utils.LightModeFlag,
+		utils.ArchiveModeFlag,
+		utils.StateRetentionFlag,
+		utils.StoreBackendFlag,
 		utils.WasmVerifyMethodFlag,
 		//account setting
 		utils.WalletFileFlag,
@@ -67,12 +77,21 @@ func setupAPP() *cli.App {
 		utils.MaxTxInBlockFlag,
 		//poc setting
 		utils.PocBlockPerViewFlag,
+		utils.PlotDirFlag,
+		utils.EnableMiningFlag,
+		utils.MiningThreadsFlag,
+		utils.MiningTargetDeadlineFlag,
 		//txpool setting
 		utils.GasPriceFlag,
 		utils.GasLimitFlag,
 		utils.TxpoolPreExecDisableFlag,
 		utils.DisableSyncVerifyTxFlag,
 		utils.DisableBroadcastNetTxFlag,
+		utils.DisableTxPoolJournalFlag,
+		utils.TxPoolMaxSizeFlag,
+		utils.TxPoolMaxPayerPendingFlag,
+		utils.TxPoolContractQuotaFlag,
+		utils.TxPoolContractQuotasFlag,
 		//p2p setting
 		utils.ReservedPeersOnlyFlag,
 		utils.ReservedPeersFileFlag,
@@ -86,10 +105,16 @@ func setupAPP() *cli.App {
 		utils.EnableProxyFlag,
 		utils.ProxyServerListFlag,
 		utils.ProxyServerIdListFlag,
+		utils.EnableStateSyncFlag,
+		utils.PeerBanThresholdFlag,
+		utils.PeerBanTimeFlag,
+		utils.TxGossipFanoutFlag,
+		utils.NATFlag,
 
 		//test mode setting
 		utils.EnableTestModeFlag,
 		utils.TestModeGenBlockTimeFlag,
+		utils.TestModeGenBlockModeFlag,
 		//rpc setting
 		utils.RPCDisabledFlag,
 		utils.RPCPortFlag,
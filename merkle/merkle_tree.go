@@ -58,6 +58,20 @@ func NewTree(tree_size uint32, hashes []common.Uint256, store HashStore) *Compac
 	return tree
 }
 
+// NewTreeFromStore returns the compact merkle tree of the first tree_size leaves, the subtree hashes are read from store
+func NewTreeFromStore(tree_size uint32, store HashStore) (*CompactMerkleTree, error) {
+	hashespos := getSubTreePos(tree_size)
+	hashes := make([]common.Uint256, len(hashespos))
+	for i, pos := range hashespos {
+		hash, err := store.GetHash(pos - 1)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hash
+	}
+	return NewTree(tree_size, hashes, store), nil
+}
+
 func (self *CompactMerkleTree) Hashes() []common.Uint256 {
 	return self.hashes
 }
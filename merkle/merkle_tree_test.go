@@ -154,6 +154,21 @@ func TestMerkleRoot(t *testing.T) {
 
 }
 
+func TestNewTreeFromStore(t *testing.T) {
+	store := NewMemHashStore()
+	tree := NewTree(0, nil, store)
+	roots := make([]common.Uint256, 0)
+	for i := 0; i < 50; i++ {
+		tree.Append([]byte{byte(i + 1)})
+		roots = append(roots, tree.Root())
+	}
+	for i := 0; i < 50; i++ {
+		sub, err := NewTreeFromStore(uint32(i+1), store)
+		assert.Nil(t, err)
+		assert.Equal(t, roots[i], sub.Root())
+	}
+}
+
 func TestGetSubTreeSize(t *testing.T) {
 	sizes := getSubTreeSize(7)
 	fmt.Println("sub tree size", sizes)
@@ -0,0 +1,279 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package miner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ontio/ontology-eventbus/actor"
+	"github.com/saveio/themis/account"
+	cutils "github.com/saveio/themis/cmd/utils"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/common/log"
+	consutils "github.com/saveio/themis/consensus/utils"
+	"github.com/saveio/themis/core/utils"
+	gov "github.com/saveio/themis/smartcontract/service/native/governance"
+	tc "github.com/saveio/themis/txnpool/common"
+)
+
+//MiningStats is the status of miner
+type MiningStats struct {
+	Address        string
+	AccountId      int64
+	PlotFiles      int
+	Nonces         uint64
+	PlotSize       uint64 // bytes of plot files
+	View           uint32
+	Scoop          uint32
+	Scanning       bool
+	ScanTime       int64 // milliseconds used by the last scan
+	BestNonce      uint64
+	BestDeadline   uint64
+	BestPlot       string
+	Submitted      uint64 // number of nonces submitted
+	LastSubmitView uint32
+}
+
+//Miner scans plot files of account for the best deadline of each mining view,
+//and submits the nonce to poc pool
+type Miner struct {
+	account        *account.Account
+	accountId      int64
+	plotDirs       []string
+	threads        int
+	noncesPerRead  uint64
+	targetDeadline uint64
+	interval       time.Duration
+	txPoolPid      *actor.PID
+
+	mu     sync.RWMutex
+	stats  MiningStats
+	cancel chan struct{} // cancel scan of current view
+	stopCh chan struct{}
+}
+
+func NewMiner(acc *account.Account, cfg *config.PoCMiningConfig, txPoolPid *actor.PID) (*Miner, error) {
+	accountId := cutils.WalletAddressToId([]byte(acc.Address.ToBase58()))
+	if cfg.AccountId != 0 && cfg.AccountId != uint64(accountId) {
+		return nil, fmt.Errorf("account id %d doesn't match id %d of account %s", cfg.AccountId, accountId, acc.Address.ToBase58())
+	}
+	if cfg.PlotDir == "" {
+		return nil, fmt.Errorf("plot dir is not specified")
+	}
+	threads := cfg.NumWorkTask
+	if threads <= 0 {
+		threads = 1
+	}
+	interval := cfg.QueryMiningInfoInterval
+	if interval <= 0 {
+		interval = 1
+	}
+	return &Miner{
+		account:        acc,
+		accountId:      accountId,
+		plotDirs:       strings.Split(cfg.PlotDir, ","),
+		threads:        threads,
+		noncesPerRead:  cfg.NoncesPerCache,
+		targetDeadline: cfg.TargetDeadline,
+		interval:       time.Duration(interval) * time.Second,
+		txPoolPid:      txPoolPid,
+		stats: MiningStats{
+			Address:   acc.Address.ToBase58(),
+			AccountId: accountId,
+		},
+		stopCh: make(chan struct{}),
+	}, nil
+}
+
+//Start query mining info periodically and mine for each new view
+func (this *Miner) Start() {
+	log.Infof("[miner] start mining for account %s, id %d, plot dirs %v", this.stats.Address, this.accountId, this.plotDirs)
+	go this.loop()
+}
+
+func (this *Miner) Stop() {
+	close(this.stopCh)
+	this.mu.Lock()
+	if this.cancel != nil {
+		close(this.cancel)
+		this.cancel = nil
+	}
+	this.mu.Unlock()
+}
+
+//GetStats return a copy of mining status
+func (this *Miner) GetStats() interface{} {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	stats := this.stats
+	return &stats
+}
+
+func (this *Miner) loop() {
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+	this.checkMiningInfo()
+	for {
+		select {
+		case <-ticker.C:
+			this.checkMiningInfo()
+		case <-this.stopCh:
+			return
+		}
+	}
+}
+
+//checkMiningInfo start mining if view changed, the scan of previous view is canceled
+func (this *Miner) checkMiningInfo() {
+	miningInfo, err := consutils.GetMiningInfo()
+	if err != nil {
+		log.Warnf("[miner] get mining info error:%s", err)
+		return
+	}
+	this.mu.Lock()
+	if miningInfo.View <= this.stats.View {
+		this.mu.Unlock()
+		return
+	}
+	if this.cancel != nil {
+		close(this.cancel)
+	}
+	cancel := make(chan struct{})
+	this.cancel = cancel
+	scoop := utils.CalculateScoop(uint64(miningInfo.View), miningInfo.GenerationSignature.ToArray())
+	this.stats.View = miningInfo.View
+	this.stats.Scoop = scoop
+	this.stats.Scanning = true
+	this.stats.BestNonce = 0
+	this.stats.BestDeadline = 0
+	this.stats.BestPlot = ""
+	this.mu.Unlock()
+
+	go this.mine(miningInfo, scoop, cancel)
+}
+
+func (this *Miner) mine(miningInfo *gov.MiningInfo, scoop uint32, cancel chan struct{}) {
+	start := time.Now()
+	plots, err := LoadPlotFiles(this.plotDirs, uint64(this.accountId))
+	if err != nil {
+		log.Errorf("[miner] load plot files error:%s", err)
+		this.updateStats(miningInfo.View, func(stats *MiningStats) {
+			stats.Scanning = false
+		})
+		return
+	}
+
+	best := this.scan(plots, scoop, miningInfo.GenerationSignature.ToArray(), cancel)
+	select {
+	case <-cancel:
+		log.Infof("[miner] scan of view %d is canceled", miningInfo.View)
+		return
+	default:
+	}
+
+	this.updateStats(miningInfo.View, func(stats *MiningStats) {
+		stats.PlotFiles = len(plots)
+		stats.Nonces = 0
+		stats.PlotSize = 0
+		for _, plot := range plots {
+			stats.Nonces += plot.Nonces
+			stats.PlotSize += plot.Size()
+		}
+		stats.Scanning = false
+		stats.ScanTime = time.Since(start).Nanoseconds() / int64(time.Millisecond)
+		if best != nil {
+			stats.BestNonce = best.Nonce
+			stats.BestDeadline = best.Deadline
+			stats.BestPlot = best.Plot.Name()
+		}
+	})
+
+	if best == nil {
+		log.Infof("[miner] no nonce found for view %d in %d plot files", miningInfo.View, len(plots))
+		return
+	}
+	if this.targetDeadline > 0 && best.Deadline > this.targetDeadline {
+		log.Infof("[miner] best deadline %d of view %d is larger than target %d", best.Deadline, miningInfo.View, this.targetDeadline)
+		return
+	}
+	this.submit(miningInfo.View, best)
+}
+
+//scan plot files by threads and return the best deadline
+func (this *Miner) scan(plots []*PlotFile, scoop uint32, gensig []byte, cancel chan struct{}) *Deadline {
+	plotCh := make(chan *PlotFile, len(plots))
+	for _, plot := range plots {
+		plotCh <- plot
+	}
+	close(plotCh)
+
+	var best *Deadline
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < this.threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for plot := range plotCh {
+				deadline, err := ScanPlotFile(plot, scoop, gensig, this.noncesPerRead, cancel)
+				if err != nil {
+					log.Errorf("[miner] scan plot file %s error:%s", plot.Path, err)
+					continue
+				}
+				lock.Lock()
+				if deadline != nil && (best == nil || deadline.Deadline < best.Deadline) {
+					best = deadline
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return best
+}
+
+func (this *Miner) submit(view uint32, best *Deadline) {
+	param := &gov.SubmitNonceParam{
+		View:     view,
+		Address:  this.account.Address,
+		Id:       this.accountId,
+		Nonce:    best.Nonce,
+		Deadline: best.Deadline,
+		PlotName: best.Plot.Name(),
+	}
+	this.txPoolPid.Tell(&tc.PoCReq{Param: param, Sender: tc.MinerSender})
+	log.Infof("[miner] submit nonce %d of plot %s for view %d, deadline %d", best.Nonce, best.Plot.Name(), view, best.Deadline)
+
+	this.mu.Lock()
+	this.stats.Submitted++
+	this.stats.LastSubmitView = view
+	this.mu.Unlock()
+}
+
+//updateStats update mining status if view is not changed
+func (this *Miner) updateStats(view uint32, update func(stats *MiningStats)) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.stats.View == view {
+		update(&this.stats)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package miner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/core/utils"
+)
+
+//PlotFile is a plot file of account, named <account id>_<start nonce>_<nonces>
+type PlotFile struct {
+	Path       string
+	AccountId  uint64
+	StartNonce uint64
+	Nonces     uint64
+}
+
+//Name return file name of plot, which is submitted as plot name of nonce
+func (this *PlotFile) Name() string {
+	return filepath.Base(this.Path)
+}
+
+//Size return bytes of plot data
+func (this *PlotFile) Size() uint64 {
+	return this.Nonces * types.PLOT_SIZE
+}
+
+//Deadline is the best deadline found in plot files
+type Deadline struct {
+	Nonce    uint64
+	Deadline uint64
+	Plot     *PlotFile
+}
+
+//LoadPlotFiles return plot files of account in dirs. Files of other accounts or
+//with incomplete size are skipped
+func LoadPlotFiles(dirs []string, accountId uint64) ([]*PlotFile, error) {
+	plots := make([]*PlotFile, 0)
+	for _, dir := range dirs {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("read plot dir %s error:%s", dir, err)
+		}
+		for _, info := range infos {
+			if info.IsDir() {
+				continue
+			}
+			id, startNonce, nonces, err := types.ParsePlotFileName(info.Name())
+			if err != nil || id != accountId {
+				continue
+			}
+			plot := &PlotFile{
+				Path:       filepath.Join(dir, info.Name()),
+				AccountId:  id,
+				StartNonce: startNonce,
+				Nonces:     nonces,
+			}
+			if uint64(info.Size()) < plot.Size() {
+				log.Warnf("[miner] skip incomplete plot file %s, size %d, expected %d", plot.Path, info.Size(), plot.Size())
+				continue
+			}
+			plots = append(plots, plot)
+		}
+	}
+	return plots, nil
+}
+
+//ScanPlotFile read scoop of all nonces in plot file and return the best deadline.
+//noncesPerRead limits the memory used, and the scan returns early when cancel is closed
+func ScanPlotFile(plot *PlotFile, scoop uint32, gensig []byte, noncesPerRead uint64, cancel <-chan struct{}) (*Deadline, error) {
+	file, err := os.Open(plot.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if noncesPerRead == 0 || noncesPerRead > plot.Nonces {
+		noncesPerRead = plot.Nonces
+	}
+	buf := make([]byte, noncesPerRead*types.SCOOP_SIZE)
+	var best *Deadline
+	for index := uint64(0); index < plot.Nonces; index += noncesPerRead {
+		select {
+		case <-cancel:
+			return best, nil
+		default:
+		}
+		count := noncesPerRead
+		if index+count > plot.Nonces {
+			count = plot.Nonces - index
+		}
+		data := buf[:count*types.SCOOP_SIZE]
+		if _, err := file.ReadAt(data, types.PlotScoopOffset(scoop, index, plot.Nonces)); err != nil {
+			return nil, fmt.Errorf("read plot file %s error:%s", plot.Path, err)
+		}
+		for i := uint64(0); i < count; i++ {
+			deadline := utils.CalculateDeadline(gensig, data[i*types.SCOOP_SIZE:(i+1)*types.SCOOP_SIZE])
+			if best == nil || deadline < best.Deadline {
+				best = &Deadline{
+					Nonce:    plot.StartNonce + index + i,
+					Deadline: deadline,
+					Plot:     plot,
+				}
+			}
+		}
+	}
+	return best, nil
+}
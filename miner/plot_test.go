@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package miner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/core/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePlotFile(t *testing.T, dir string, id uint64, startNonce uint64, nonces uint64) string {
+	plots := make([]*types.MiningPlot, nonces)
+	for i := range plots {
+		plots[i] = types.NewMiningPlot(int64(id), startNonce+uint64(i))
+	}
+	data := make([]byte, 0, nonces*types.PLOT_SIZE)
+	for scoop := 0; scoop < types.SCOOPS_PER_PLOT; scoop++ {
+		for _, plot := range plots {
+			data = append(data, plot.GetScoopData(scoop)...)
+		}
+	}
+	path := filepath.Join(dir, types.PlotFileName(id, startNonce, nonces))
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+	return path
+}
+
+func TestScanPlotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plots")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	id := uint64(12345)
+	writePlotFile(t, dir, id, 10, 3)
+	writePlotFile(t, dir, id+1, 0, 1)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, types.PlotFileName(id, 100, 2)), []byte("incomplete"), 0644))
+
+	plots, err := LoadPlotFiles([]string{dir}, id)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(plots))
+	assert.Equal(t, uint64(10), plots[0].StartNonce)
+	assert.Equal(t, uint64(3), plots[0].Nonces)
+
+	gensig := make([]byte, 32)
+	gensig[0] = 1
+	scoop := uint32(1234)
+	var expected *Deadline
+	for nonce := uint64(10); nonce < 13; nonce++ {
+		deadline := utils.CalculateDeadline(gensig, types.NewMiningPlot(int64(id), nonce).GetScoopData(int(scoop)))
+		if expected == nil || deadline < expected.Deadline {
+			expected = &Deadline{Nonce: nonce, Deadline: deadline}
+		}
+	}
+
+	for _, noncesPerRead := range []uint64{0, 1, 2} {
+		best, err := ScanPlotFile(plots[0], scoop, gensig, noncesPerRead, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, expected.Nonce, best.Nonce)
+		assert.Equal(t, expected.Deadline, best.Deadline)
+	}
+}
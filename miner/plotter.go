@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package miner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/types"
+)
+
+const (
+	PLOTTING_FILE_SUFFIX      = ".plotting" // suffix of plot file being generated
+	PLOT_PROGRESS_FILE_SUFFIX = ".progress" // suffix of file recording generated nonces
+)
+
+//ErrPlotInterrupted is returned when generation is stopped, it can be resumed later
+var ErrPlotInterrupted = errors.New("plot generation interrupted")
+
+//PlotGenerator generates plot file of account. Nonces are generated batch by batch,
+//the progress is saved after each batch so that generation can resume after interruption
+type PlotGenerator struct {
+	Dir         string
+	AccountId   uint64
+	StartNonce  uint64
+	Nonces      uint64
+	Threads     int
+	BatchNonces uint64 // nonces generated in memory before written to file
+}
+
+//Path return path of the generated plot file
+func (this *PlotGenerator) Path() string {
+	return filepath.Join(this.Dir, types.PlotFileName(this.AccountId, this.StartNonce, this.Nonces))
+}
+
+//Progress return number of nonces already generated
+func (this *PlotGenerator) Progress() uint64 {
+	path := this.Path()
+	if common.FileExisted(path) {
+		return this.Nonces
+	}
+	data, err := ioutil.ReadFile(path + PLOT_PROGRESS_FILE_SUFFIX)
+	if err != nil || !common.FileExisted(path+PLOTTING_FILE_SUFFIX) {
+		return 0
+	}
+	done, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || done > this.Nonces {
+		return 0
+	}
+	return done
+}
+
+//Generate generates the plot file, progress is called after each batch written.
+//It returns ErrPlotInterrupted after the current batch if stop is closed
+func (this *PlotGenerator) Generate(progress func(done uint64), stop <-chan struct{}) error {
+	if this.Nonces == 0 {
+		return fmt.Errorf("no nonce to generate")
+	}
+	path := this.Path()
+	if common.FileExisted(path) {
+		return fmt.Errorf("plot file %s already exists", path)
+	}
+	if err := os.MkdirAll(this.Dir, 0755); err != nil {
+		return err
+	}
+	done := this.Progress()
+	file, err := os.OpenFile(path+PLOTTING_FILE_SUFFIX, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = file.Truncate(int64(this.Nonces * types.PLOT_SIZE)); err != nil {
+		return err
+	}
+
+	batch := this.BatchNonces
+	if batch == 0 {
+		batch = 1
+	}
+	for done < this.Nonces {
+		select {
+		case <-stop:
+			return ErrPlotInterrupted
+		default:
+		}
+		count := batch
+		if done+count > this.Nonces {
+			count = this.Nonces - done
+		}
+		plots := this.generateNonces(this.StartNonce+done, count)
+		if err = this.writeNonces(file, plots, done); err != nil {
+			return err
+		}
+		done += count
+		err = ioutil.WriteFile(path+PLOT_PROGRESS_FILE_SUFFIX, []byte(strconv.FormatUint(done, 10)), 0644)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(done)
+		}
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(path+PLOTTING_FILE_SUFFIX, path); err != nil {
+		return err
+	}
+	return os.Remove(path + PLOT_PROGRESS_FILE_SUFFIX)
+}
+
+//generateNonces generates nonces by threads
+func (this *PlotGenerator) generateNonces(startNonce uint64, count uint64) []*types.MiningPlot {
+	plots := make([]*types.MiningPlot, count)
+	indexCh := make(chan uint64, count)
+	for i := uint64(0); i < count; i++ {
+		indexCh <- i
+	}
+	close(indexCh)
+
+	threads := this.Threads
+	if threads <= 0 {
+		threads = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexCh {
+				plots[index] = types.NewMiningPlot(int64(this.AccountId), startNonce+index)
+			}
+		}()
+	}
+	wg.Wait()
+	return plots
+}
+
+//writeNonces writes scoops of nonces to plot file, the same scoop of nonces are continuous in file
+func (this *PlotGenerator) writeNonces(file *os.File, plots []*types.MiningPlot, index uint64) error {
+	buf := make([]byte, 0, len(plots)*types.SCOOP_SIZE)
+	for scoop := 0; scoop < types.SCOOPS_PER_PLOT; scoop++ {
+		buf = buf[:0]
+		for _, plot := range plots {
+			buf = append(buf, plot.GetScoopData(scoop)...)
+		}
+		if _, err := file.WriteAt(buf, types.PlotScoopOffset(uint32(scoop), index, this.Nonces)); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+//NewPlotFile return plot file of path, the file name must be a valid plot file name
+func NewPlotFile(path string) (*PlotFile, error) {
+	id, startNonce, nonces, err := types.ParsePlotFileName(filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	plot := &PlotFile{
+		Path:       path,
+		AccountId:  id,
+		StartNonce: startNonce,
+		Nonces:     nonces,
+	}
+	if uint64(info.Size()) != plot.Size() {
+		return nil, fmt.Errorf("size of plot file %s is %d, expected %d", path, info.Size(), plot.Size())
+	}
+	return plot, nil
+}
+
+//VerifyPlotFile checks nonces in plot file against generated ones. Samples nonces are
+//checked evenly from the first to the last one, 0 means checking all nonces
+func VerifyPlotFile(plot *PlotFile, samples uint64) (uint64, error) {
+	file, err := os.Open(plot.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if samples == 0 || samples > plot.Nonces {
+		samples = plot.Nonces
+	}
+	data := make([]byte, types.SCOOP_SIZE)
+	for i := uint64(0); i < samples; i++ {
+		index := uint64(0)
+		if samples > 1 {
+			index = i * (plot.Nonces - 1) / (samples - 1)
+		}
+		expected := types.NewMiningPlot(int64(plot.AccountId), plot.StartNonce+index)
+		for scoop := 0; scoop < types.SCOOPS_PER_PLOT; scoop++ {
+			if _, err := file.ReadAt(data, types.PlotScoopOffset(uint32(scoop), index, plot.Nonces)); err != nil {
+				return i, fmt.Errorf("read nonce %d error:%s", plot.StartNonce+index, err)
+			}
+			if !bytes.Equal(data, expected.GetScoopData(scoop)) {
+				return i, fmt.Errorf("nonce %d scoop %d mismatch", plot.StartNonce+index, scoop)
+			}
+		}
+	}
+	return samples, nil
+}
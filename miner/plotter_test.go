@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package miner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlotGenerator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plots")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	generator := &PlotGenerator{
+		Dir:         dir,
+		AccountId:   12345,
+		StartNonce:  10,
+		Nonces:      3,
+		Threads:     2,
+		BatchNonces: 2,
+	}
+	stop := make(chan struct{})
+	err = generator.Generate(func(done uint64) {
+		close(stop)
+	}, stop)
+	assert.Equal(t, ErrPlotInterrupted, err)
+	assert.Equal(t, uint64(2), generator.Progress())
+	assert.False(t, common.FileExisted(generator.Path()))
+
+	//resume generation
+	assert.Nil(t, generator.Generate(nil, nil))
+	assert.Equal(t, uint64(3), generator.Progress())
+	assert.False(t, common.FileExisted(generator.Path()+PLOTTING_FILE_SUFFIX))
+	assert.False(t, common.FileExisted(generator.Path()+PLOT_PROGRESS_FILE_SUFFIX))
+	assert.NotNil(t, generator.Generate(nil, nil))
+
+	expectedDir := filepath.Join(dir, "expected")
+	assert.Nil(t, os.Mkdir(expectedDir, 0755))
+	expected, err := ioutil.ReadFile(writePlotFile(t, expectedDir, 12345, 10, 3))
+	assert.Nil(t, err)
+	data, err := ioutil.ReadFile(generator.Path())
+	assert.Nil(t, err)
+	assert.Equal(t, expected, data)
+
+	plot, err := NewPlotFile(generator.Path())
+	assert.Nil(t, err)
+	checked, err := VerifyPlotFile(plot, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), checked)
+
+	//corrupt the last nonce
+	data[types.PlotScoopOffset(100, 2, 3)]++
+	assert.Nil(t, ioutil.WriteFile(generator.Path(), data, 0644))
+	_, err = VerifyPlotFile(plot, 0)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "nonce 12 scoop 100")
+}
@@ -39,8 +39,8 @@ func SetTxnPoolPid(txnPid *actor.PID) {
 	txnPoolPid = txnPid
 }
 
-//add txn to txnpool
-func AddTransaction(transaction *types.Transaction) {
+//add txn relayed by peer to txnpool
+func AddTransaction(transaction *types.Transaction, peerId p2pComn.PeerId) {
 	if txnPoolPid == nil {
 		log.Error("[p2p]net_server AddTransaction(): txnpool pid is nil")
 		return
@@ -49,6 +49,7 @@ func AddTransaction(transaction *types.Transaction) {
 		Tx:         transaction,
 		Sender:     tc.NetSender,
 		TxResultCh: nil,
+		PeerId:     peerId,
 	}
 	txnPoolPid.Tell(txReq)
 }
@@ -31,6 +31,7 @@ import (
 
 	"github.com/saveio/themis/account"
 	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/signature"
 	"github.com/saveio/themis/core/types"
 	"github.com/saveio/themis/crypto/keypair"
 )
@@ -71,6 +72,8 @@ type PeerKeyId struct {
 	PublicKey keypair.PublicKey
 
 	Id PeerId
+
+	signer signature.Signer // nil if the key id is received from remote peer
 }
 
 func (self PeerId) GenRandPeerId(prefix uint) PeerId {
@@ -131,6 +134,14 @@ func (self PeerId) IsPseudoPeerId() bool {
 	return true
 }
 
+func PeerIdFromHexString(s string) (PeerId, error) {
+	val, err := common.AddressFromHexString(s)
+	if err != nil {
+		return PeerId{}, err
+	}
+	return PeerId{val: val}, nil
+}
+
 func PseudoPeerIdFromUint64(data uint64) PeerId {
 	id := common.ADDRESS_EMPTY
 	binary.LittleEndian.PutUint64(id[:], data)
@@ -179,9 +190,23 @@ func RandPeerKeyId() *PeerKeyId {
 	return &PeerKeyId{
 		PublicKey: acc.PublicKey,
 		Id:        kid,
+		signer:    acc,
 	}
 }
 
+//Sign signs data with the private key behind the key id, only the local key id can sign
+func (this *PeerKeyId) Sign(data []byte) ([]byte, error) {
+	if this.signer == nil {
+		return nil, errors.New("peer key id has no private key")
+	}
+	return signature.Sign(this.signer, data)
+}
+
+//Verify checks the signature of data is signed by the key id
+func (this *PeerKeyId) Verify(data, sig []byte) error {
+	return signature.Verify(this.PublicKey, data, sig)
+}
+
 func validatePublicKey(pubKey keypair.PublicKey) bool {
 	pub := keypair.SerializePublicKey(pubKey)
 	res := sha256.Sum256(pub)
@@ -20,6 +20,8 @@ package common
 
 import (
 	"net"
+
+	"github.com/blang/semver"
 )
 
 //peer capability
@@ -29,6 +31,10 @@ const (
 )
 
 const MIN_VERSION_FOR_DHT = "1.9.1-beta"
+const MIN_VERSION_FOR_AUTH = "2.0.1"      //prove the ownership of kad id with a signed nonce in handshake
+const MIN_VERSION_FOR_ENCRYPT = "2.0.1"   //encrypt the link with the keys negotiated in handshake
+const MIN_VERSION_FOR_COMPRESS = "2.0.1"  //compress message payload and transfer large blocks in chunks
+const MIN_VERSION_FOR_TX_GOSSIP = "2.0.1" //announce transactions in batched inventory and fetch the unknown ones
 
 //link and concurrent const
 const (
@@ -49,6 +55,9 @@ const (
 	MAX_BLK_HDR_CNT = 500              //hdr count once when sync header
 	MAX_MSG_LEN     = 30 * 1024 * 1024 //the maximum message length
 	MAX_PAYLOAD_LEN = MAX_MSG_LEN - MSG_HDR_LEN
+
+	COMPRESS_MIN_LEN = 1024       //payload shorter than it is not compressed
+	BLOCK_CHUNK_SIZE = 256 * 1024 //block message longer than it is transferred in chunks
 )
 
 //msg type const
@@ -83,6 +92,15 @@ const (
 	RECENT_FILE_NAME = "peers.recent"
 )
 
+//address book const
+const (
+	PEERS_BOOK_SAVE_INTERVAL = 60
+	PEERS_BOOK_FILE_NAME     = "peers.book"
+)
+
+//banned peer const
+const BANNED_FILE_NAME = "peers.banned"
+
 //PeerAddr represent peer`s net information
 type PeerAddr struct {
 	Time     int64    //latest timestamp
@@ -114,12 +132,48 @@ const (
 	FINDNODE_TYPE      = "findnode"    // find node using dht
 	FINDNODE_RESP_TYPE = "findnodeack" // find node using dht
 	UPDATE_KADID_TYPE  = "updatekadid" //update node kadid
+	PEER_AUTH_TYPE     = "peerauth"    //prove the ownership of kadid
+	NOISE_KEY_TYPE     = "noisekey"    //ephemeral key for link encryption
+	COMPRESS_TYPE      = "snappy"      //snappy compressed message
+	BLOCK_CHUNK_TYPE   = "blockchunk"  //chunk of large block
 
 	GET_SUBNET_MEMBERS_TYPE = "getmembers"       // request subnet members
 	SUBNET_MEMBERS_TYPE     = "members"          // response subnet members
 	SUBMIT_NONECE_PARAM     = "submitnonceparam" // submit nonce param
+
+	GET_SNAPSHOT_TYPE    = "getsnapshot" // req state snapshot manifest
+	SNAPSHOT_TYPE        = "snapshot"    // state snapshot manifest
+	GET_STATE_CHUNK_TYPE = "getstchunk"  // req state snapshot chunk
+	STATE_CHUNK_TYPE     = "statechunk"  // state snapshot chunk
+
+	GET_TX_PROOF_TYPE = "gettxproof" // req transaction with inclusion proof
+	TX_PROOF_TYPE     = "txproof"    // transaction with inclusion proof
+	GET_STORAGE_TYPE  = "getstorage" // req storage value
+	STORAGE_TYPE      = "storage"    // storage value
+
+	RELAY_REG_TYPE    = "relayreg"  // req peer to relay connection for unreachable node
+	RELAY_ACK_TYPE    = "relayack"  // resp of relay register
+	RELAY_CONN_TYPE   = "relayconn" // req relay to ask the unreachable node connecting back
+	CONNECT_BACK_TYPE = "connback"  // ask the unreachable node connecting back
 )
 
+//SupportVersion checks whether the soft version of peer is not lower than minVersion
+func SupportVersion(version, minVersion string) bool {
+	if version == "" {
+		return false
+	}
+	v1, err := semver.ParseTolerant(version)
+	if err != nil {
+		return false
+	}
+	min, err := semver.ParseTolerant(minVersion)
+	if err != nil {
+		panic(err) // enforced by testcase
+	}
+
+	return v1.GTE(min)
+}
+
 //ParseIPAddr return ip address
 func ParseIPAddr(s string) (string, error) {
 	host, _, err := net.SplitHostPort(s)
@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/saveio/themis/p2pserver/common"
 	"github.com/saveio/themis/p2pserver/handshake"
@@ -34,7 +35,10 @@ import (
 const INBOUND_INDEX = 0
 const OUTBOUND_INDEX = 1
 
+var AUTH_FAILED_BAN_DURATION = 10 * time.Minute // ip failed to prove its kad id is refused within this duration
+
 var ErrHandshakeSelf = errors.New("the node handshake with itself")
+var ErrDialFailed = errors.New("dial failed")
 
 type connectedPeer struct {
 	connectId uint64
@@ -182,8 +186,9 @@ func (self *ConnectController) AcceptConnect(conn net.Conn) (*peer.PeerInfo, net
 		return nil, nil, err
 	}
 
-	peerInfo, err := handshake.HandshakeServer(self.peerInfo, self.selfId, conn)
+	peerInfo, conn, err := handshake.HandshakeServer(self.peerInfo, self.selfId, conn)
 	if err != nil {
+		self.checkAuthFailed(addr, err)
 		return nil, nil, err
 	}
 
@@ -213,14 +218,16 @@ func (self *ConnectController) Connect(addr string) (*peer.PeerInfo, net.Conn, e
 
 	conn, err := self.dialer.Dial(addr)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("%w: %v", ErrDialFailed, err)
 	}
 
-	peerInfo, err := handshake.HandshakeClient(self.peerInfo, self.selfId, conn)
+	peerInfo, secured, err := handshake.HandshakeClient(self.peerInfo, self.selfId, conn)
 	if err != nil {
 		_ = conn.Close()
+		self.checkAuthFailed(addr, err)
 		return nil, nil, err
 	}
+	conn = secured
 
 	err = self.afterHandshakeCheck(peerInfo, conn.RemoteAddr().String())
 	if err != nil {
@@ -239,6 +246,10 @@ func (self *ConnectController) afterHandshakeCheck(remotePeer *peer.PeerInfo, re
 		return err
 	}
 
+	if self.PeerScore != nil && self.PeerScore.IsPeerBanned(remotePeer.Id, remoteAddr) {
+		return fmt.Errorf("[p2p] peer %s is banned for misbehavior", remoteAddr)
+	}
+
 	return self.checkPeerIdAndIP(remotePeer, remoteAddr)
 }
 
@@ -256,6 +267,10 @@ func (self *ConnectController) beforeHandshakeCheck(addr string, index int) erro
 		return fmt.Errorf("connecting with self address %s", addr)
 	}
 
+	if self.BannedPeers.Contains(addr) {
+		return fmt.Errorf("[p2p] peer %s is banned for misbehavior", addr)
+	}
+
 	if self.isBoundFull(index) {
 		return fmt.Errorf("[p2p] bound %d connections reach max limit", index)
 	}
@@ -274,6 +289,18 @@ func (self *ConnectController) beforeHandshakeCheck(addr string, index int) erro
 	return nil
 }
 
+//checkAuthFailed bans the ip of remote peer if it failed to prove the ownership of its kad id. The ip is banned
+//rather than the id, since the id may be impersonated
+func (self *ConnectController) checkAuthFailed(addr string, err error) {
+	if self.PeerScore == nil || !errors.Is(err, handshake.ErrPeerAuthFailed) {
+		return
+	}
+	if e := self.PeerScore.Ban(addr, AUTH_FAILED_BAN_DURATION, "failed to prove its kad id"); e != nil {
+		return
+	}
+	self.logger.Warnf("[p2p] ban peer %s for %v: %s", addr, AUTH_FAILED_BAN_DURATION, err)
+}
+
 func (self *ConnectController) isHandWithSelf(remotePeer *peer.PeerInfo, remoteAddr string) error {
 	addrIp, err := common.ParseIPAddr(remoteAddr)
 	if err != nil {
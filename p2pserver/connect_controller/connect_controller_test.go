@@ -18,6 +18,7 @@
 package connect_controller
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -27,6 +28,7 @@ import (
 	"github.com/saveio/themis/p2pserver/common"
 	"github.com/saveio/themis/p2pserver/handshake"
 	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/peer_score"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -108,7 +110,7 @@ func TestConnectController_CanDetectSelfAddress(t *testing.T) {
 
 		c, s := trans.Pipe()
 		go func() {
-			_, _ = handshake.HandshakeClient(server.peerInfo, server.Key, c)
+			_, _, _ = handshake.HandshakeClient(server.peerInfo, server.Key, c)
 		}()
 
 		_, _, err := server.AcceptConnect(s)
@@ -132,7 +134,7 @@ func TestConnectController_AcceptConnect_MaxInBound(t *testing.T) {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			_, err := handshake.HandshakeClient(client.peerInfo, client.Key, conn1)
+			_, _, err := handshake.HandshakeClient(client.peerInfo, client.Key, conn1)
 			if i < int(maxInboud) {
 				assert.Nil(t, err)
 			} else {
@@ -194,7 +196,7 @@ func TestConnCtrlOption_MaxInBoundPerIp(t *testing.T) {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			_, err := handshake.HandshakeClient(client.peerInfo, client.Key, conn1)
+			_, _, err := handshake.HandshakeClient(client.peerInfo, client.Key, conn1)
 			if i < int(maxInBoundPerIp) {
 				assert.Nil(t, err)
 			} else {
@@ -214,6 +216,51 @@ func TestConnCtrlOption_MaxInBoundPerIp(t *testing.T) {
 	assert.Equal(t, server.inoutbounds[INBOUND_INDEX].Size(), 0)
 }
 
+func TestConnectController_AuthFailedBan(t *testing.T) {
+	trans := NewTransport(t)
+	score := peer_score.NewPeerScore(0, time.Minute)
+	server := NewNode(NewConnCtrlOption().WithBannedPeers(score).WithPeerScore(score))
+	client := NewNode(NewConnCtrlOption())
+	server.Info.SoftVersion = common.MIN_VERSION_FOR_AUTH
+	client.Info.SoftVersion = common.MIN_VERSION_FOR_AUTH
+
+	//client claims the kad id of another node without owning its private key
+	victim := common.RandPeerKeyId()
+	fake := *client.Key
+	fake.PublicKey = victim.PublicKey
+	fake.Id = victim.Id
+	info := *client.Info
+	info.Id = victim.Id
+	c, s := trans.Pipe()
+	go func() {
+		_, _, _ = handshake.HandshakeClient(&info, &fake, c)
+		_ = c.Close()
+	}()
+	_, _, err := server.AcceptConnect(s)
+	assert.True(t, errors.Is(err, handshake.ErrPeerAuthFailed))
+
+	//the ip is banned in the peer score, so it is listed and refused before handshake
+	banned := score.GetBannedPeers()
+	assert.Equal(t, 1, len(banned))
+	assert.Equal(t, "127.0.0.1", banned[0].Ip)
+	c, s = trans.Pipe()
+	_, _, err = server.AcceptConnect(s)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "banned")
+	_ = c.Close()
+
+	//the ban can be lifted
+	assert.True(t, score.Unban("127.0.0.1"))
+	c, s = trans.Pipe()
+	go func() {
+		_, _, err := handshake.HandshakeClient(client.Info, client.Key, c)
+		assert.Nil(t, err)
+	}()
+	_, conn, err := server.AcceptConnect(s)
+	assert.Nil(t, err)
+	_ = conn.Close()
+}
+
 func checkServer(t *testing.T, client, server *Node, clientConns chan<- net.Conn, i int, conn2 net.Conn, maxLimit int, isCheck bool) {
 	info, conn, err := server.AcceptConnect(conn2)
 	if i >= maxLimit && isCheck == false {
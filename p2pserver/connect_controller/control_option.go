@@ -20,6 +20,7 @@ package connect_controller
 import (
 	"github.com/saveio/themis/common/config"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer_score"
 )
 
 type ConnCtrlOption struct {
@@ -27,6 +28,8 @@ type ConnCtrlOption struct {
 	MaxConnInBound      uint
 	MaxConnInBoundPerIP uint
 	ReservedPeers       p2p.AddressFilter // enabled if not empty
+	BannedPeers         p2p.AddressFilter
+	PeerScore           *peer_score.PeerScore // bans misbehaving peers, checked after handshake, nil means none
 	dialer              Dialer
 }
 
@@ -36,6 +39,7 @@ func NewConnCtrlOption() ConnCtrlOption {
 		MaxConnOutBound:     config.DEFAULT_MAX_CONN_OUT_BOUND,
 		MaxConnInBoundPerIP: config.DEFAULT_MAX_CONN_IN_BOUND_FOR_SINGLE_IP,
 		ReservedPeers:       p2p.AllAddrFilter(),
+		BannedPeers:         p2p.NoneAddrFilter(),
 		dialer:              &noTlsDialer{},
 	}
 }
@@ -60,6 +64,16 @@ func (self ConnCtrlOption) ReservedOnly(peers []string) ConnCtrlOption {
 	return self
 }
 
+func (self ConnCtrlOption) WithBannedPeers(filter p2p.AddressFilter) ConnCtrlOption {
+	self.BannedPeers = filter
+	return self
+}
+
+func (self ConnCtrlOption) WithPeerScore(score *peer_score.PeerScore) ConnCtrlOption {
+	self.PeerScore = score
+	return self
+}
+
 func (self ConnCtrlOption) WithDialer(dialer Dialer) ConnCtrlOption {
 	self.dialer = dialer
 	return self
@@ -76,6 +90,7 @@ func ConnCtrlOptionFromConfig(config *config.P2PNodeConfig, reserveFilter p2p.Ad
 		MaxConnInBound:      config.MaxConnInBound,
 		MaxConnInBoundPerIP: config.MaxConnInBoundForSingleIP,
 		ReservedPeers:       reserveFilter,
+		BannedPeers:         p2p.NoneAddrFilter(),
 
 		dialer: dialer,
 	}, nil
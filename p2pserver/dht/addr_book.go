@@ -0,0 +1,260 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dht
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/saveio/themis/p2pserver/common"
+)
+
+//AddrSource tells where an address of the book was learned from
+type AddrSource uint8
+
+const (
+	SourceDiscovery AddrSource = iota //reported by another peer through find node or addr messages
+	SourceSeed                        //configured seed
+	SourceRoute                       //restored from the saved routing table
+	SourcePeer                        //we have been connected with it
+)
+
+const (
+	MAX_BOOK_SIZE     = 1000               //max addresses kept in the book
+	BOOK_MAX_FAILURES = 5                  //failures before a stale address is dropped
+	BOOK_STALE_TIME   = 7 * 24 * time.Hour //addresses not seen for this long may be dropped
+	BOOK_BASE_BACKOFF = 30 * time.Second   //retry delay after the first failure
+	BOOK_MAX_BACKOFF  = time.Hour          //upper bound of the retry delay
+)
+
+var sourceScore = map[AddrSource]int{
+	SourceDiscovery: 0,
+	SourceSeed:      10,
+	SourceRoute:     20,
+	SourcePeer:      30,
+}
+
+//KnownAddress is an address book entry
+type KnownAddress struct {
+	ID          common.PeerId
+	Address     string
+	Source      AddrSource
+	LastSeen    int64 //unix time of the last established connection
+	LastAttempt int64 //unix time of the last dial
+	Failures    uint32
+	Successes   uint32
+}
+
+//Score ranks the address, higher is better
+func (this *KnownAddress) Score(now int64) int {
+	score := sourceScore[this.Source]
+	if this.LastSeen != 0 {
+		age := time.Duration(now-this.LastSeen) * time.Second
+		switch {
+		case age < time.Hour:
+			score += 100
+		case age < 24*time.Hour:
+			score += 50
+		case age < BOOK_STALE_TIME:
+			score += 20
+		}
+		succ := this.Successes
+		if succ > 10 {
+			succ = 10
+		}
+		score += int(succ) * 5
+	}
+	score -= int(this.Failures) * 25
+	return score
+}
+
+//backoff returns whether the address was dialed too recently to be retried
+func (this *KnownAddress) backoff(now int64) bool {
+	if this.Failures == 0 || this.LastAttempt == 0 {
+		return false
+	}
+	delay := BOOK_BASE_BACKOFF << (this.Failures - 1)
+	if delay > BOOK_MAX_BACKOFF || delay <= 0 {
+		delay = BOOK_MAX_BACKOFF
+	}
+	return time.Duration(now-this.LastAttempt)*time.Second < delay
+}
+
+func (this *KnownAddress) stale(now int64) bool {
+	return this.Failures >= BOOK_MAX_FAILURES &&
+		(this.LastSeen == 0 || time.Duration(now-this.LastSeen)*time.Second > BOOK_STALE_TIME)
+}
+
+//AddrBook keeps scored addresses of known peers so that a restarted node
+//can reconnect to the network without relying on the seeds
+type AddrBook struct {
+	lock  sync.RWMutex
+	addrs map[string]*KnownAddress
+	now   func() int64
+}
+
+func NewAddrBook() *AddrBook {
+	return &AddrBook{
+		addrs: make(map[string]*KnownAddress),
+		now:   func() int64 { return time.Now().Unix() },
+	}
+}
+
+//Add records an address learned from source, known entries only get their id and source upgraded
+func (this *AddrBook) Add(id common.PeerId, addr string, source AddrSource) {
+	if addr == "" {
+		return
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if ka, ok := this.addrs[addr]; ok {
+		if !id.IsEmpty() {
+			ka.ID = id
+		}
+		if source > ka.Source {
+			ka.Source = source
+		}
+		return
+	}
+	if len(this.addrs) >= MAX_BOOK_SIZE && !this.evictWorst() {
+		return
+	}
+	this.addrs[addr] = &KnownAddress{ID: id, Address: addr, Source: source}
+}
+
+//evictWorst removes the lowest scored address, it must be called with the lock held
+func (this *AddrBook) evictWorst() bool {
+	now := this.now()
+	var worst *KnownAddress
+	for _, ka := range this.addrs {
+		if worst == nil || ka.Score(now) < worst.Score(now) {
+			worst = ka
+		}
+	}
+	if worst == nil {
+		return false
+	}
+	delete(this.addrs, worst.Address)
+	return true
+}
+
+//MarkAttempt records a dial to addr
+func (this *AddrBook) MarkAttempt(addr string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if ka, ok := this.addrs[addr]; ok {
+		ka.LastAttempt = this.now()
+	}
+}
+
+//MarkGood records an established connection with the peer
+func (this *AddrBook) MarkGood(id common.PeerId, addr string) {
+	this.Add(id, addr, SourcePeer)
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if ka, ok := this.addrs[addr]; ok {
+		ka.LastSeen = this.now()
+		ka.Failures = 0
+		ka.Successes += 1
+	}
+}
+
+//MarkFailed records a failed dial, stale addresses that keep failing are dropped
+func (this *AddrBook) MarkFailed(addr string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	ka, ok := this.addrs[addr]
+	if !ok {
+		return
+	}
+	now := this.now()
+	ka.LastAttempt = now
+	ka.Failures += 1
+	if ka.stale(now) {
+		delete(this.addrs, addr)
+	}
+}
+
+func (this *AddrBook) Get(addr string) *KnownAddress {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if ka, ok := this.addrs[addr]; ok {
+		cp := *ka
+		return &cp
+	}
+	return nil
+}
+
+func (this *AddrBook) Size() int {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return len(this.addrs)
+}
+
+//Best returns at most count dialable addresses ordered by score, skip filters out
+//addresses the caller is not interested in, e.g. connected ones
+func (this *AddrBook) Best(count int, skip func(ka *KnownAddress) bool) []*KnownAddress {
+	this.lock.RLock()
+	now := this.now()
+	cands := make([]*KnownAddress, 0, len(this.addrs))
+	for _, ka := range this.addrs {
+		if ka.backoff(now) || (skip != nil && skip(ka)) {
+			continue
+		}
+		cp := *ka
+		cands = append(cands, &cp)
+	}
+	this.lock.RUnlock()
+
+	sort.Slice(cands, func(i, j int) bool {
+		si, sj := cands[i].Score(now), cands[j].Score(now)
+		if si != sj {
+			return si > sj
+		}
+		return cands[i].Address < cands[j].Address
+	})
+	if len(cands) > count {
+		cands = cands[:count]
+	}
+	return cands
+}
+
+func (this *AddrBook) list() []*KnownAddress {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	ret := make([]*KnownAddress, 0, len(this.addrs))
+	for _, ka := range this.addrs {
+		cp := *ka
+		ret = append(ret, &cp)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Address < ret[j].Address })
+	return ret
+}
+
+func (this *AddrBook) restore(addrs []*KnownAddress) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, ka := range addrs {
+		if ka.Address == "" || len(this.addrs) >= MAX_BOOK_SIZE {
+			continue
+		}
+		this.addrs[ka.Address] = ka
+	}
+}
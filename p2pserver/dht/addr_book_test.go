@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dht
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/saveio/themis/p2pserver/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddrBook_Score(t *testing.T) {
+	now := time.Now().Unix()
+	book := NewAddrBook()
+	book.now = func() int64 { return now }
+
+	good := common.RandPeerKeyId().Id
+	book.Add(common.PeerId{}, "127.0.0.1:1", SourceDiscovery)
+	book.Add(common.PeerId{}, "127.0.0.1:2", SourceSeed)
+	book.Add(good, "127.0.0.1:3", SourceDiscovery)
+	book.MarkGood(good, "127.0.0.1:3")
+	assert.Equal(t, book.Size(), 3)
+	assert.Equal(t, book.Get("127.0.0.1:3").ID, good)
+	assert.Equal(t, book.Get("127.0.0.1:3").Source, SourcePeer)
+
+	best := book.Best(3, nil)
+	assert.Equal(t, len(best), 3)
+	assert.Equal(t, best[0].Address, "127.0.0.1:3")
+	assert.Equal(t, best[1].Address, "127.0.0.1:2")
+
+	//a failed address is backed off then ranked lower
+	book.MarkFailed("127.0.0.1:2")
+	best = book.Best(3, nil)
+	assert.Equal(t, len(best), 2)
+	now += int64(BOOK_BASE_BACKOFF / time.Second)
+	best = book.Best(3, nil)
+	assert.Equal(t, len(best), 3)
+	assert.Equal(t, best[2].Address, "127.0.0.1:2")
+
+	best = book.Best(3, func(ka *KnownAddress) bool { return ka.ID == good })
+	assert.Equal(t, len(best), 2)
+}
+
+func TestAddrBook_DropStale(t *testing.T) {
+	book := NewAddrBook()
+	book.Add(common.PeerId{}, "127.0.0.1:1", SourceDiscovery)
+	for i := 0; i < BOOK_MAX_FAILURES-1; i++ {
+		book.MarkFailed("127.0.0.1:1")
+	}
+	assert.NotNil(t, book.Get("127.0.0.1:1"))
+	book.MarkFailed("127.0.0.1:1")
+	assert.Nil(t, book.Get("127.0.0.1:1"))
+
+	//recently seen addresses are kept
+	id := common.RandPeerKeyId().Id
+	book.MarkGood(id, "127.0.0.1:2")
+	for i := 0; i < BOOK_MAX_FAILURES; i++ {
+		book.MarkFailed("127.0.0.1:2")
+	}
+	assert.NotNil(t, book.Get("127.0.0.1:2"))
+}
+
+func TestDHT_Persist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dht")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "peers.book")
+
+	local := common.RandPeerKeyId().Id
+	dht := NewDHT(local)
+	route := common.RandPeerKeyId().Id
+	assert.True(t, dht.Update(route, "127.0.0.1:20338"))
+	dht.AddrBook().MarkGood(route, "127.0.0.1:20338")
+	dht.AddrBook().Add(common.PeerId{}, "127.0.0.1:20339", SourceSeed)
+	assert.Nil(t, dht.SaveToFile(file, 1))
+
+	other := NewDHT(local)
+	assert.Nil(t, other.SaveToFile(file, 2))
+
+	restored := NewDHT(local)
+	routes, err := restored.LoadFromFile(file, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, routes, []common.PeerIDAddressPair{{ID: route, Address: "127.0.0.1:20338"}})
+	assert.Equal(t, restored.AddrBook().Size(), 2)
+	ka := restored.AddrBook().Get("127.0.0.1:20338")
+	assert.Equal(t, ka.ID, route)
+	assert.Equal(t, ka.Successes, uint32(1))
+	assert.Equal(t, restored.AddrBook().Get("127.0.0.1:20339").Source, SourceSeed)
+
+	routes, err = NewDHT(local).LoadFromFile(filepath.Join(dir, "none"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, len(routes), 0)
+}
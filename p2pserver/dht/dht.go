@@ -39,6 +39,7 @@ type DHT struct {
 	localId    common.PeerId
 	bucketSize int
 	routeTable *kb.RouteTable // Array of routing tables for differently distanced nodes
+	addrBook   *AddrBook
 
 	AutoRefresh     bool
 	RtRefreshPeriod time.Duration
@@ -49,6 +50,11 @@ func (dht *DHT) RouteTable() *kb.RouteTable {
 	return dht.routeTable
 }
 
+// AddrBook return dht's address book
+func (dht *DHT) AddrBook() *AddrBook {
+	return dht.addrBook
+}
+
 // NewDHT creates a new DHT with the specified host and options.
 func NewDHT(id common.PeerId) *DHT {
 	bucketSize := KValue
@@ -65,6 +71,7 @@ func NewDHT(id common.PeerId) *DHT {
 	return &DHT{
 		localId:         id,
 		routeTable:      rt,
+		addrBook:        NewAddrBook(),
 		bucketSize:      bucketSize,
 		AutoRefresh:     true,
 		RtRefreshPeriod: 10 * time.Second,
@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dht
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	common2 "github.com/saveio/themis/common"
+	"github.com/saveio/themis/p2pserver/common"
+)
+
+type persistAddr struct {
+	ID          string `json:",omitempty"`
+	Address     string
+	Source      AddrSource
+	LastSeen    int64
+	LastAttempt int64
+	Failures    uint32
+	Successes   uint32
+}
+
+//persistNet is the saved state of a network
+type persistNet struct {
+	Routes []persistAddr
+	Book   []persistAddr
+}
+
+func toPersistAddr(ka *KnownAddress) persistAddr {
+	pa := persistAddr{
+		Address:     ka.Address,
+		Source:      ka.Source,
+		LastSeen:    ka.LastSeen,
+		LastAttempt: ka.LastAttempt,
+		Failures:    ka.Failures,
+		Successes:   ka.Successes,
+	}
+	if !ka.ID.IsEmpty() {
+		pa.ID = ka.ID.ToHexString()
+	}
+	return pa
+}
+
+func fromPersistAddr(pa persistAddr) (*KnownAddress, error) {
+	ka := &KnownAddress{
+		Address:     pa.Address,
+		Source:      pa.Source,
+		LastSeen:    pa.LastSeen,
+		LastAttempt: pa.LastAttempt,
+		Failures:    pa.Failures,
+		Successes:   pa.Successes,
+	}
+	if pa.ID != "" {
+		id, err := common.PeerIdFromHexString(pa.ID)
+		if err != nil {
+			return nil, err
+		}
+		ka.ID = id
+	}
+	return ka, nil
+}
+
+func readPersistFile(file string) (map[uint32]*persistNet, error) {
+	nets := make(map[uint32]*persistNet)
+	if !common2.FileExisted(file) {
+		return nets, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(buf, &nets); err != nil {
+		return nil, err
+	}
+	return nets, nil
+}
+
+// SaveToFile persists the routing table and the address book of network netID,
+// the saved state of other networks in the file is kept.
+func (dht *DHT) SaveToFile(file string, netID uint32) error {
+	nets, err := readPersistFile(file)
+	if err != nil {
+		//a broken file is overwritten
+		nets = make(map[uint32]*persistNet)
+	}
+	state := &persistNet{}
+	for _, pair := range dht.routeTable.ListPeers() {
+		state.Routes = append(state.Routes, toPersistAddr(&KnownAddress{ID: pair.ID, Address: pair.Address}))
+	}
+	for _, ka := range dht.addrBook.list() {
+		state.Book = append(state.Book, toPersistAddr(ka))
+	}
+	nets[netID] = state
+
+	buf, err := json.Marshal(nets)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, buf, os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// LoadFromFile restores the address book of network netID and returns the saved
+// routing table. The table only tracks connected peers, so the returned peers
+// should be dialed and will enter the table once connected.
+func (dht *DHT) LoadFromFile(file string, netID uint32) ([]common.PeerIDAddressPair, error) {
+	nets, err := readPersistFile(file)
+	if err != nil {
+		return nil, err
+	}
+	state, ok := nets[netID]
+	if !ok || state == nil {
+		return nil, nil
+	}
+	book := make([]*KnownAddress, 0, len(state.Book))
+	for _, pa := range state.Book {
+		ka, err := fromPersistAddr(pa)
+		if err != nil {
+			continue
+		}
+		book = append(book, ka)
+	}
+	dht.addrBook.restore(book)
+
+	routes := make([]common.PeerIDAddressPair, 0, len(state.Routes))
+	for _, pa := range state.Routes {
+		ka, err := fromPersistAddr(pa)
+		if err != nil || ka.ID.IsEmpty() || ka.ID == dht.localId {
+			continue
+		}
+		routes = append(routes, common.PeerIDAddressPair{ID: ka.ID, Address: ka.Address})
+		dht.addrBook.Add(ka.ID, ka.Address, SourceRoute)
+	}
+	return routes, nil
+}
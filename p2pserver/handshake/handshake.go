@@ -18,11 +18,13 @@
 package handshake
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"net"
 	"time"
 
-	"github.com/blang/semver"
 	common2 "github.com/saveio/themis/common"
 	"github.com/saveio/themis/p2pserver/common"
 	"github.com/saveio/themis/p2pserver/message/types"
@@ -31,10 +33,18 @@ import (
 
 var HANDSHAKE_DURATION = 10 * time.Second // handshake time can not exceed this duration, or will treat as attack.
 
-func HandshakeClient(info *peer.PeerInfo, selfId *common.PeerKeyId, conn net.Conn) (*peer.PeerInfo, error) {
+const AUTH_NONCE_LEN = 32 // length of the challenge for proving kad id ownership
+
+var authDomain = []byte("themis p2p handshake auth")
+
+//ErrPeerAuthFailed is returned when remote peer can not prove the ownership of its kad id
+var ErrPeerAuthFailed = errors.New("peer authentication failed")
+
+//HandshakeClient returns the info of remote peer, and the connection encrypted if both peers support link encryption
+func HandshakeClient(info *peer.PeerInfo, selfId *common.PeerKeyId, conn net.Conn) (*peer.PeerInfo, net.Conn, error) {
 	version := newVersion(info)
 	if err := conn.SetDeadline(time.Now().Add(HANDSHAKE_DURATION)); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer func() {
 		_ = conn.SetDeadline(time.Time{}) //reset back
@@ -43,62 +53,84 @@ func HandshakeClient(info *peer.PeerInfo, selfId *common.PeerKeyId, conn net.Con
 	// 1. sendMsg version
 	err := sendMsg(conn, version)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// 2. read version
 	msg, _, err := types.ReadMessage(conn)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	receivedVersion, ok := msg.(*types.Version)
 	if !ok {
-		return nil, fmt.Errorf("expected version message, but got message type: %s", msg.CmdType())
+		return nil, nil, fmt.Errorf("expected version message, but got message type: %s", msg.CmdType())
 	}
 
 	// 3. update kadId
+	var session *noiseSession
 	kid := common.PseudoPeerIdFromUint64(receivedVersion.P.Nonce)
 	if useDHT(receivedVersion.P.SoftVersion, info.SoftVersion) {
 		err = sendMsg(conn, &types.UpdatePeerKeyId{KadKeyId: selfId})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		// 4. read kadkeyid
 		msg, _, err = types.ReadMessage(conn)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		kadKeyId, ok := msg.(*types.UpdatePeerKeyId)
 		if !ok {
-			return nil, fmt.Errorf("handshake failed, expect kad id message, got %s", msg.CmdType())
+			return nil, nil, fmt.Errorf("handshake failed, expect kad id message, got %s", msg.CmdType())
 		}
 
 		kid = kadKeyId.KadKeyId.Id
+
+		// 5. challenge remote kad id and answer the challenge
+		if useAuth(receivedVersion.P.SoftVersion, info.SoftVersion) {
+			err = authClient(conn, selfId, kadKeyId.KadKeyId)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// 6. negotiate link encryption keys
+		if useEncrypt(receivedVersion.P.SoftVersion, info.SoftVersion) {
+			session, err = noiseClient(conn, selfId, kadKeyId.KadKeyId)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 	}
 
-	// 5. sendMsg ack
+	// 7. sendMsg ack
 	err = sendMsg(conn, &types.VerACK{})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	msg, _, err = types.ReadMessage(conn)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// 6. receive verack
+	// 8. receive verack
 	if _, ok := msg.(*types.VerACK); !ok {
-		return nil, fmt.Errorf("handshake failed, expect verack message, got %s", msg.CmdType())
+		return nil, nil, fmt.Errorf("handshake failed, expect verack message, got %s", msg.CmdType())
 	}
 
-	return createPeerInfo(receivedVersion, kid, conn.RemoteAddr().String()), nil
+	peerInfo := createPeerInfo(receivedVersion, kid, conn.RemoteAddr().String())
+	if session != nil {
+		return peerInfo, newSecureConn(conn, session), nil
+	}
+	return peerInfo, conn, nil
 }
 
-func HandshakeServer(info *peer.PeerInfo, selfId *common.PeerKeyId, conn net.Conn) (*peer.PeerInfo, error) {
+//HandshakeServer returns the info of remote peer, and the connection encrypted if both peers support link encryption
+func HandshakeServer(info *peer.PeerInfo, selfId *common.PeerKeyId, conn net.Conn) (*peer.PeerInfo, net.Conn, error) {
 	ver := newVersion(info)
 	if err := conn.SetDeadline(time.Now().Add(HANDSHAKE_DURATION)); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer func() {
 		_ = conn.SetDeadline(time.Time{}) //reset back
@@ -107,54 +139,166 @@ func HandshakeServer(info *peer.PeerInfo, selfId *common.PeerKeyId, conn net.Con
 	// 1. read version
 	msg, _, err := types.ReadMessage(conn)
 	if err != nil {
-		return nil, fmt.Errorf("[HandshakeServer] ReadMessage failed, error: %s", err)
+		return nil, nil, fmt.Errorf("[HandshakeServer] ReadMessage failed, error: %s", err)
 	}
 	if msg.CmdType() != common.VERSION_TYPE {
-		return nil, fmt.Errorf("[HandshakeServer] expected version message")
+		return nil, nil, fmt.Errorf("[HandshakeServer] expected version message")
 	}
 	version := msg.(*types.Version)
 
 	// 2. sendMsg version
 	err = sendMsg(conn, ver)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// 3. read update kadkey id
+	var session *noiseSession
 	kid := common.PseudoPeerIdFromUint64(version.P.Nonce)
 	if useDHT(version.P.SoftVersion, info.SoftVersion) {
 		msg, _, err := types.ReadMessage(conn)
 		if err != nil {
-			return nil, fmt.Errorf("[HandshakeServer] ReadMessage failed, error: %s", err)
+			return nil, nil, fmt.Errorf("[HandshakeServer] ReadMessage failed, error: %s", err)
 		}
 		kadkeyId, ok := msg.(*types.UpdatePeerKeyId)
 		if !ok {
-			return nil, fmt.Errorf("[HandshakeServer] expected update kadkeyid message")
+			return nil, nil, fmt.Errorf("[HandshakeServer] expected update kadkeyid message")
 		}
 		kid = kadkeyId.KadKeyId.Id
 		// 4. sendMsg update kadkey id
 		err = sendMsg(conn, &types.UpdatePeerKeyId{KadKeyId: selfId})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+
+		// 5. answer the challenge and challenge remote kad id
+		if useAuth(version.P.SoftVersion, info.SoftVersion) {
+			err = authServer(conn, selfId, kadkeyId.KadKeyId)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// 6. negotiate link encryption keys
+		if useEncrypt(version.P.SoftVersion, info.SoftVersion) {
+			session, err = noiseServer(conn, selfId, kadkeyId.KadKeyId)
+			if err != nil {
+				return nil, nil, err
+			}
 		}
 	}
 
-	// 5. read version ack
+	// 7. read version ack
 	msg, _, err = types.ReadMessage(conn)
 	if err != nil {
-		return nil, fmt.Errorf("[HandshakeServer] ReadMessage failed, error: %s", err)
+		return nil, nil, fmt.Errorf("[HandshakeServer] ReadMessage failed, error: %s", err)
 	}
 	if msg.CmdType() != common.VERACK_TYPE {
-		return nil, fmt.Errorf("[HandshakeServer] expected version ack message")
+		return nil, nil, fmt.Errorf("[HandshakeServer] expected version ack message")
 	}
 
-	// 6. sendMsg ack
+	// 8. sendMsg ack
 	err = sendMsg(conn, &types.VerACK{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	peerInfo := createPeerInfo(version, kid, conn.RemoteAddr().String())
+	if session != nil {
+		return peerInfo, newSecureConn(conn, session), nil
+	}
+	return peerInfo, conn, nil
+}
+
+//authClient sends a fresh challenge, verifies the answer of remote peer, then answers the challenge of remote peer
+func authClient(conn net.Conn, selfId, remoteId *common.PeerKeyId) error {
+	nonce, err := newAuthNonce()
+	if err != nil {
+		return err
+	}
+	err = sendMsg(conn, &types.PeerAuth{Nonce: nonce})
+	if err != nil {
+		return err
+	}
+	auth, err := readPeerAuth(conn)
+	if err != nil {
+		return err
+	}
+	err = remoteId.Verify(authData(nonce, remoteId.Id, selfId.Id), auth.Signature)
+	if err != nil {
+		return fmt.Errorf("%w, kad id %s: %s", ErrPeerAuthFailed, remoteId.Id.ToHexString(), err)
+	}
+	if len(auth.Nonce) != AUTH_NONCE_LEN {
+		return fmt.Errorf("handshake failed, invalid auth nonce length %d", len(auth.Nonce))
+	}
+	sig, err := selfId.Sign(authData(auth.Nonce, selfId.Id, remoteId.Id))
+	if err != nil {
+		return err
+	}
+	return sendMsg(conn, &types.PeerAuth{Signature: sig})
+}
+
+//authServer answers the challenge of remote peer with a fresh challenge, then verifies the answer of remote peer
+func authServer(conn net.Conn, selfId, remoteId *common.PeerKeyId) error {
+	auth, err := readPeerAuth(conn)
+	if err != nil {
+		return err
+	}
+	if len(auth.Nonce) != AUTH_NONCE_LEN {
+		return fmt.Errorf("[HandshakeServer] invalid auth nonce length %d", len(auth.Nonce))
+	}
+	sig, err := selfId.Sign(authData(auth.Nonce, selfId.Id, remoteId.Id))
+	if err != nil {
+		return err
+	}
+	nonce, err := newAuthNonce()
+	if err != nil {
+		return err
+	}
+	err = sendMsg(conn, &types.PeerAuth{Nonce: nonce, Signature: sig})
+	if err != nil {
+		return err
+	}
+	auth, err = readPeerAuth(conn)
+	if err != nil {
+		return err
+	}
+	err = remoteId.Verify(authData(nonce, remoteId.Id, selfId.Id), auth.Signature)
+	if err != nil {
+		return fmt.Errorf("%w, kad id %s: %s", ErrPeerAuthFailed, remoteId.Id.ToHexString(), err)
+	}
+	return nil
+}
+
+func readPeerAuth(conn net.Conn) (*types.PeerAuth, error) {
+	msg, _, err := types.ReadMessage(conn)
 	if err != nil {
 		return nil, err
 	}
+	auth, ok := msg.(*types.PeerAuth)
+	if !ok {
+		return nil, fmt.Errorf("handshake failed, expect peer auth message, got %s", msg.CmdType())
+	}
+	return auth, nil
+}
 
-	return createPeerInfo(version, kid, conn.RemoteAddr().String()), nil
+func newAuthNonce() ([]byte, error) {
+	nonce := make([]byte, AUTH_NONCE_LEN)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+//authData binds the challenge to both kad ids, so the answer can not be used in other handshakes
+func authData(nonce []byte, signer, verifier common.PeerId) []byte {
+	sink := common2.NewZeroCopySink(nil)
+	sink.WriteBytes(authDomain)
+	sink.WriteBytes(nonce)
+	signer.Serialization(sink)
+	verifier.Serialization(sink)
+	hash := sha256.Sum256(sink.Bytes())
+	return hash[:]
 }
 
 func sendMsg(conn net.Conn, msg types.Message) error {
@@ -209,17 +353,23 @@ func useDHT(client, server string) bool {
 }
 
 func supportDHT(version string) bool {
-	if version == "" {
-		return false
-	}
-	v1, err := semver.ParseTolerant(version)
-	if err != nil {
-		return false
-	}
-	min, err := semver.ParseTolerant(common.MIN_VERSION_FOR_DHT)
-	if err != nil {
-		panic(err) // enforced by testcase
-	}
+	return common.SupportVersion(version, common.MIN_VERSION_FOR_DHT)
+}
+
+//useAuth is symmetric as useDHT, the kad id of old version peer is not authenticated
+func useAuth(client, server string) bool {
+	return supportAuth(client) && supportAuth(server)
+}
+
+func supportAuth(version string) bool {
+	return common.SupportVersion(version, common.MIN_VERSION_FOR_AUTH)
+}
+
+//useEncrypt is symmetric as useDHT, plaintext is used if any peer is of old version
+func useEncrypt(client, server string) bool {
+	return supportEncrypt(client) && supportEncrypt(server)
+}
 
-	return v1.GTE(min)
+func supportEncrypt(version string) bool {
+	return common.SupportVersion(version, common.MIN_VERSION_FOR_ENCRYPT)
 }
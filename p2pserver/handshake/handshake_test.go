@@ -18,6 +18,8 @@
 package handshake
 
 import (
+	"errors"
+	"io"
 	"math/rand"
 	"net"
 	"sync"
@@ -76,13 +78,13 @@ func TestHandshakeNormal(t *testing.T) {
 			err  error
 		}, 2)
 		go func() {
-			info, err := HandshakeClient(client.Info, client.Id, client.Conn)
+			info, _, err := HandshakeClient(client.Info, client.Id, client.Conn)
 			result[0].err = err
 			result[0].info = [2]*peer.PeerInfo{info, server.Info}
 			wg.Done()
 		}()
 		go func() {
-			info, err := HandshakeServer(server.Info, server.Id, server.Conn)
+			info, _, err := HandshakeServer(server.Info, server.Id, server.Conn)
 			result[1].err = err
 			result[1].info = [2]*peer.PeerInfo{info, client.Info}
 			wg.Done()
@@ -99,7 +101,7 @@ func TestHandshakeNormal(t *testing.T) {
 func TestHandshakeTimeout(t *testing.T) {
 	client, _ := NewPair()
 
-	_, err := HandshakeClient(client.Info, client.Id, client.Conn)
+	_, _, err := HandshakeClient(client.Info, client.Id, client.Conn)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "deadline exceeded")
 }
@@ -111,7 +113,7 @@ func TestHandshakeWrongMsg(t *testing.T) {
 		assert.Nil(t, err)
 	}()
 
-	_, err := HandshakeServer(server.Info, server.Id, server.Conn)
+	_, _, err := HandshakeServer(server.Info, server.Id, server.Conn)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "expected version message")
 }
@@ -131,4 +133,142 @@ func TestVersion(t *testing.T) {
 	assert.False(t, supportDHT("1.9.1-alpha"))
 	assert.False(t, supportDHT("1.8.0-beta-9-geeaeewwf"))
 	assert.False(t, supportDHT("1.8.0"))
+
+	assert.True(t, supportAuth(common.MIN_VERSION_FOR_AUTH))
+	assert.True(t, supportAuth("v2.1.0"))
+	assert.False(t, supportAuth("v2.0.0"))
+	assert.False(t, supportAuth("v1.9.1"))
+
+	assert.True(t, supportEncrypt(common.MIN_VERSION_FOR_ENCRYPT))
+	assert.True(t, supportEncrypt("v2.1.0"))
+	assert.False(t, supportEncrypt("v2.0.0"))
+}
+
+func TestHandshakeImpersonate(t *testing.T) {
+	client, server := NewPair()
+	// client claims the kad id of another node without owning its private key
+	victim := common.RandPeerKeyId()
+	fake := *client.Id
+	fake.PublicKey = victim.PublicKey
+	fake.Id = victim.Id
+	client.Info.Id = victim.Id
+	client.Info.SoftVersion = common.MIN_VERSION_FOR_AUTH
+	server.Info.SoftVersion = common.MIN_VERSION_FOR_AUTH
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		_, _, _ = HandshakeClient(client.Info, &fake, client.Conn)
+		wg.Done()
+	}()
+	_, _, err := HandshakeServer(server.Info, server.Id, server.Conn)
+	wg.Wait()
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, ErrPeerAuthFailed))
+}
+
+func TestAuthData(t *testing.T) {
+	a, b := common.RandPeerKeyId(), common.RandPeerKeyId()
+	nonce, err := newAuthNonce()
+	assert.Nil(t, err)
+	sig, err := a.Sign(authData(nonce, a.Id, b.Id))
+	assert.Nil(t, err)
+	assert.Nil(t, a.Verify(authData(nonce, a.Id, b.Id), sig))
+	// answer can not be replayed for other peers or challenges
+	assert.NotNil(t, a.Verify(authData(nonce, a.Id, a.Id), sig))
+	nonce2, _ := newAuthNonce()
+	assert.NotNil(t, a.Verify(authData(nonce2, a.Id, b.Id), sig))
+	// remote key id can not sign
+	remote := &common.PeerKeyId{PublicKey: a.PublicKey, Id: a.Id}
+	_, err = remote.Sign(nonce)
+	assert.NotNil(t, err)
+}
+
+func TestHandshakeEncrypt(t *testing.T) {
+	for _, version := range []string{"v2.0.0", "v2.0.1"} {
+		client, server := NewPair()
+		client.Info.SoftVersion = "v2.0.1"
+		server.Info.SoftVersion = version
+
+		var clientConn net.Conn
+		var clientErr error
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			_, clientConn, clientErr = HandshakeClient(client.Info, client.Id, client.Conn)
+			wg.Done()
+		}()
+		_, serverConn, err := HandshakeServer(server.Info, server.Id, server.Conn)
+		wg.Wait()
+		assert.Nil(t, err)
+		assert.Nil(t, clientErr)
+
+		_, clientSecure := clientConn.(*SecureConn)
+		_, serverSecure := serverConn.(*SecureConn)
+		assert.Equal(t, supportEncrypt(version), clientSecure)
+		assert.Equal(t, supportEncrypt(version), serverSecure)
+
+		// messages larger than a frame are split
+		data := make([]byte, MAX_NOISE_FRAME_LEN*2+100)
+		rand.Read(data)
+		go func() {
+			_, err := clientConn.Write(data)
+			assert.Nil(t, err)
+		}()
+		received := make([]byte, len(data))
+		_, err = io.ReadFull(serverConn, received)
+		assert.Nil(t, err)
+		assert.Equal(t, data, received)
+	}
+}
+
+//oldVersionClient runs the handshake of the peer before kad id authentication
+func oldVersionClient(node Node) error {
+	err := sendMsg(node.Conn, newVersion(node.Info))
+	if err != nil {
+		return err
+	}
+	if _, _, err = types.ReadMessage(node.Conn); err != nil {
+		return err
+	}
+	err = sendMsg(node.Conn, &types.UpdatePeerKeyId{KadKeyId: node.Id})
+	if err != nil {
+		return err
+	}
+	if _, _, err = types.ReadMessage(node.Conn); err != nil {
+		return err
+	}
+	err = sendMsg(node.Conn, &types.VerACK{})
+	if err != nil {
+		return err
+	}
+	msg, _, err := types.ReadMessage(node.Conn)
+	if err != nil {
+		return err
+	}
+	if _, ok := msg.(*types.VerACK); !ok {
+		return errors.New("expect verack message")
+	}
+	return nil
+}
+
+func TestHandshakeOldVersionPeer(t *testing.T) {
+	client, server := NewPair()
+	client.Info.SoftVersion = "v2.0.0"
+	server.Info.SoftVersion = "v2.0.1"
+
+	var clientErr error
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		clientErr = oldVersionClient(client)
+		wg.Done()
+	}()
+	info, conn, err := HandshakeServer(server.Info, server.Id, server.Conn)
+	wg.Wait()
+	assert.Nil(t, err)
+	assert.Nil(t, clientErr)
+	assert.Equal(t, client.Id.Id, info.Id)
+	_, secure := conn.(*SecureConn)
+	assert.False(t, secure)
 }
@@ -0,0 +1,247 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package handshake
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	common2 "github.com/saveio/themis/common"
+	"github.com/saveio/themis/p2pserver/common"
+	"github.com/saveio/themis/p2pserver/message/types"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const MAX_NOISE_FRAME_LEN = 65535 // max length of an encrypted frame, as noise protocol defined
+
+var noiseDomain = []byte("themis p2p noise key")
+var noiseInfo = []byte("themis p2p transport")
+
+//noiseKeyPair is the ephemeral curve25519 key pair of a handshake
+type noiseKeyPair struct {
+	private [32]byte
+	public  []byte
+}
+
+func newNoiseKeyPair() (*noiseKeyPair, error) {
+	key := &noiseKeyPair{}
+	if _, err := rand.Read(key.private[:]); err != nil {
+		return nil, err
+	}
+	pub, err := curve25519.X25519(key.private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	key.public = pub
+	return key, nil
+}
+
+//noiseClient sends the signed ephemeral key, then reads and verifies the ephemeral key of remote peer
+func noiseClient(conn net.Conn, selfId, remoteId *common.PeerKeyId) (*noiseSession, error) {
+	key, err := sendNoiseKey(conn, selfId, remoteId)
+	if err != nil {
+		return nil, err
+	}
+	remoteKey, err := readNoiseKey(conn, selfId, remoteId)
+	if err != nil {
+		return nil, err
+	}
+	return newNoiseSession(key, remoteKey, true)
+}
+
+//noiseServer reads and verifies the ephemeral key of remote peer, then sends the signed ephemeral key
+func noiseServer(conn net.Conn, selfId, remoteId *common.PeerKeyId) (*noiseSession, error) {
+	remoteKey, err := readNoiseKey(conn, selfId, remoteId)
+	if err != nil {
+		return nil, err
+	}
+	key, err := sendNoiseKey(conn, selfId, remoteId)
+	if err != nil {
+		return nil, err
+	}
+	return newNoiseSession(key, remoteKey, false)
+}
+
+func sendNoiseKey(conn net.Conn, selfId, remoteId *common.PeerKeyId) (*noiseKeyPair, error) {
+	key, err := newNoiseKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := selfId.Sign(noiseKeyData(key.public, selfId.Id, remoteId.Id))
+	if err != nil {
+		return nil, err
+	}
+	err = sendMsg(conn, &types.NoiseKey{EphemeralKey: key.public, Signature: sig})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func readNoiseKey(conn net.Conn, selfId, remoteId *common.PeerKeyId) ([]byte, error) {
+	msg, _, err := types.ReadMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+	noiseKey, ok := msg.(*types.NoiseKey)
+	if !ok {
+		return nil, fmt.Errorf("handshake failed, expect noise key message, got %s", msg.CmdType())
+	}
+	if len(noiseKey.EphemeralKey) != curve25519.PointSize {
+		return nil, fmt.Errorf("handshake failed, invalid ephemeral key length %d", len(noiseKey.EphemeralKey))
+	}
+	err = remoteId.Verify(noiseKeyData(noiseKey.EphemeralKey, remoteId.Id, selfId.Id), noiseKey.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w, kad id %s ephemeral key: %s", ErrPeerAuthFailed, remoteId.Id.ToHexString(), err)
+	}
+	return noiseKey.EphemeralKey, nil
+}
+
+//noiseKeyData binds the ephemeral key to both kad ids
+func noiseKeyData(key []byte, signer, verifier common.PeerId) []byte {
+	sink := common2.NewZeroCopySink(nil)
+	sink.WriteBytes(noiseDomain)
+	sink.WriteBytes(key)
+	signer.Serialization(sink)
+	verifier.Serialization(sink)
+	hash := sha256.Sum256(sink.Bytes())
+	return hash[:]
+}
+
+//noiseSession holds the ciphers of both directions
+type noiseSession struct {
+	send cipher.AEAD
+	recv cipher.AEAD
+}
+
+func newNoiseSession(key *noiseKeyPair, remoteKey []byte, initiator bool) (*noiseSession, error) {
+	shared, err := curve25519.X25519(key.private[:], remoteKey)
+	if err != nil {
+		return nil, err
+	}
+	clientKey, serverKey := key.public, remoteKey
+	if !initiator {
+		clientKey, serverKey = remoteKey, key.public
+	}
+	salt := sha256.Sum256(append(append([]byte{}, clientKey...), serverKey...))
+	kdf := hkdf.New(sha256.New, shared, salt[:], noiseInfo)
+	var c2s, s2c [chacha20poly1305.KeySize]byte
+	if _, err := io.ReadFull(kdf, c2s[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(kdf, s2c[:]); err != nil {
+		return nil, err
+	}
+	c2sAead, err := chacha20poly1305.New(c2s[:])
+	if err != nil {
+		return nil, err
+	}
+	s2cAead, err := chacha20poly1305.New(s2c[:])
+	if err != nil {
+		return nil, err
+	}
+	if initiator {
+		return &noiseSession{send: c2sAead, recv: s2cAead}, nil
+	}
+	return &noiseSession{send: s2cAead, recv: c2sAead}, nil
+}
+
+//SecureConn encrypts the link with the keys negotiated in handshake. Data is sent in frames of
+//2 bytes big endian length and chacha20-poly1305 sealed payload, the nonce is the frame counter
+type SecureConn struct {
+	net.Conn
+
+	sendLock  sync.Mutex
+	send      cipher.AEAD
+	sendNonce uint64
+
+	recvLock  sync.Mutex
+	recv      cipher.AEAD
+	recvNonce uint64
+	recvBuf   []byte
+}
+
+func newSecureConn(conn net.Conn, session *noiseSession) *SecureConn {
+	return &SecureConn{
+		Conn: conn,
+		send: session.send,
+		recv: session.recv,
+	}
+}
+
+func frameNonce(counter uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+func (this *SecureConn) Write(b []byte) (int, error) {
+	this.sendLock.Lock()
+	defer this.sendLock.Unlock()
+
+	maxPayload := MAX_NOISE_FRAME_LEN - this.send.Overhead()
+	written := 0
+	for written < len(b) {
+		n := len(b) - written
+		if n > maxPayload {
+			n = maxPayload
+		}
+		frame := make([]byte, 2, 2+n+this.send.Overhead())
+		frame = this.send.Seal(frame, frameNonce(this.sendNonce), b[written:written+n], nil)
+		binary.BigEndian.PutUint16(frame[:2], uint16(len(frame)-2))
+		this.sendNonce++
+		if _, err := this.Conn.Write(frame); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func (this *SecureConn) Read(b []byte) (int, error) {
+	this.recvLock.Lock()
+	defer this.recvLock.Unlock()
+
+	for len(this.recvBuf) == 0 {
+		var head [2]byte
+		if _, err := io.ReadFull(this.Conn, head[:]); err != nil {
+			return 0, err
+		}
+		frame := make([]byte, binary.BigEndian.Uint16(head[:]))
+		if _, err := io.ReadFull(this.Conn, frame); err != nil {
+			return 0, err
+		}
+		plain, err := this.recv.Open(frame[:0], frameNonce(this.recvNonce), frame, nil)
+		if err != nil {
+			return 0, fmt.Errorf("decrypt frame %d error: %s", this.recvNonce, err)
+		}
+		this.recvNonce++
+		this.recvBuf = plain
+	}
+	n := copy(b, this.recvBuf)
+	this.recvBuf = this.recvBuf[n:]
+	return n, nil
+}
@@ -87,10 +87,11 @@ func (this *Link) GetRXTime() int64 {
 	return atomic.LoadInt64(&this.time)
 }
 
-func (this *Link) Rx() {
+//Rx reads messages until the connection is broken, and returns the read error
+func (this *Link) Rx() error {
 	conn := this.GetConn()
 	if conn == nil {
-		return
+		return nil
 	}
 
 	reader := bufio.NewReaderSize(conn, common.MAX_BUF_LEN)
@@ -99,7 +100,8 @@ func (this *Link) Rx() {
 		msg, payloadSize, err := types.ReadMessage(reader)
 		if err != nil {
 			log.Infof("[p2p]error read from %s :%s", this.GetAddr(), err.Error())
-			break
+			this.CloseConn()
+			return err
 		}
 
 		if unknown, ok := msg.(*types.UnknownMessage); ok {
@@ -124,8 +126,6 @@ func (this *Link) Rx() {
 		}
 
 	}
-
-	this.CloseConn()
 }
 
 //close connection
@@ -192,3 +192,63 @@ func NewSubmitNonce(param *gov.SubmitNonceParam) mt.Message {
 
 	return &msg
 }
+
+//state snapshot manifest request package
+func NewStateSnapshotReq(height uint32) mt.Message {
+	log.Trace()
+	return &mt.StateSnapshotReq{Height: height}
+}
+
+//state snapshot manifest package
+func NewStateSnapshot(snapshot *ct.StateSnapshot) mt.Message {
+	log.Trace()
+	return &mt.StateSnapshot{Snapshot: *snapshot}
+}
+
+//state snapshot chunk request package
+func NewStateChunkReq(height, index uint32) mt.Message {
+	log.Trace()
+	return &mt.StateChunkReq{Height: height, Index: index}
+}
+
+//state snapshot chunk package
+func NewStateChunk(height, index uint32, data []byte) mt.Message {
+	log.Trace()
+	return &mt.StateChunk{Height: height, Index: index, Data: data}
+}
+
+//transaction proof request package
+func NewTxProofReq(txHash common.Uint256, rootHeight uint32) mt.Message {
+	log.Trace()
+	return &mt.TxProofReq{TxHash: txHash, RootHeight: rootHeight}
+}
+
+//storage request package
+func NewStorageReq(contract common.Address, key []byte) mt.Message {
+	log.Trace()
+	return &mt.StorageReq{Contract: contract, Key: key}
+}
+
+//block chunks package, the serialized block message is split into chunks of BLOCK_CHUNK_SIZE
+func NewBlockChunks(blk *mt.Block) []*mt.BlockChunk {
+	log.Trace()
+	sink := common.NewZeroCopySink(nil)
+	blk.Serialization(sink)
+	data := sink.Bytes()
+	total := (len(data) + msgCommon.BLOCK_CHUNK_SIZE - 1) / msgCommon.BLOCK_CHUNK_SIZE
+	chunks := make([]*mt.BlockChunk, 0, total)
+	hash := blk.Blk.Hash()
+	for i := 0; i < total; i++ {
+		end := (i + 1) * msgCommon.BLOCK_CHUNK_SIZE
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, &mt.BlockChunk{
+			Hash:  hash,
+			Index: uint32(i),
+			Total: uint32(total),
+			Data:  data[i*msgCommon.BLOCK_CHUNK_SIZE : end],
+		})
+	}
+	return chunks
+}
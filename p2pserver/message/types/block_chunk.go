@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"errors"
+	"io"
+
+	"github.com/saveio/themis/common"
+	comm "github.com/saveio/themis/p2pserver/common"
+)
+
+//BlockChunk is a part of the serialized block message, large blocks are transferred in chunks
+type BlockChunk struct {
+	Hash  common.Uint256
+	Index uint32
+	Total uint32
+	Data  []byte
+}
+
+//Serialize message payload
+func (this *BlockChunk) Serialization(sink *common.ZeroCopySink) {
+	sink.WriteHash(this.Hash)
+	sink.WriteUint32(this.Index)
+	sink.WriteUint32(this.Total)
+	sink.WriteVarBytes(this.Data)
+}
+
+func (this *BlockChunk) Deserialization(source *common.ZeroCopySource) error {
+	var eof, irregular bool
+	this.Hash, eof = source.NextHash()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Index, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Total, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	if this.Total == 0 || this.Index >= this.Total || this.Total > comm.MAX_PAYLOAD_LEN/comm.BLOCK_CHUNK_SIZE+1 {
+		return errors.New("invalid block chunk index")
+	}
+	this.Data, _, irregular, eof = source.NextVarBytes()
+	if irregular {
+		return common.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	if len(this.Data) > comm.BLOCK_CHUNK_SIZE {
+		return errors.New("block chunk data too large")
+	}
+	return nil
+}
+
+func (this *BlockChunk) CmdType() string {
+	return comm.BLOCK_CHUNK_TYPE
+}
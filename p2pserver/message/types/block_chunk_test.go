@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"testing"
+
+	"github.com/saveio/themis/common"
+	comm "github.com/saveio/themis/p2pserver/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockChunkSerializationDeserialization(t *testing.T) {
+	msg := &BlockChunk{Hash: common.Uint256{1, 2, 3}, Index: 2, Total: 3, Data: []byte("chunk")}
+	MessageTest(t, msg)
+
+	msg.Index = 3
+	sink := common.NewZeroCopySink(nil)
+	msg.Serialization(sink)
+	assert.NotNil(t, new(BlockChunk).Deserialization(common.NewZeroCopySource(sink.Bytes())))
+
+	msg.Index = 0
+	msg.Data = make([]byte, comm.BLOCK_CHUNK_SIZE+1)
+	sink = common.NewZeroCopySink(nil)
+	msg.Serialization(sink)
+	assert.NotNil(t, new(BlockChunk).Deserialization(common.NewZeroCopySource(sink.Bytes())))
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"io"
+
+	comm "github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/p2pserver/common"
+)
+
+//TxProofReq request a transaction with the proof of its inclusion in the block root at RootHeight
+type TxProofReq struct {
+	TxHash     comm.Uint256
+	RootHeight uint32
+}
+
+//Serialize message payload
+func (this *TxProofReq) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteHash(this.TxHash)
+	sink.WriteUint32(this.RootHeight)
+}
+
+func (this *TxProofReq) CmdType() string {
+	return common.GET_TX_PROOF_TYPE
+}
+
+//Deserialize message payload
+func (this *TxProofReq) Deserialization(source *comm.ZeroCopySource) error {
+	var eof bool
+	this.TxHash, eof = source.NextHash()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.RootHeight, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+//TxProof is the response of TxProofReq, Tx is nil if the transaction is not found
+type TxProof struct {
+	TxHash     comm.Uint256
+	Tx         *types.Transaction
+	Height     uint32
+	TxHashes   []comm.Uint256 // hashes of all transactions in block, rebuild the transactions root
+	RootHeight uint32
+	Proof      []comm.Uint256 // audit path of the transactions root in the block root at RootHeight
+	Notify     []byte         // json encoded execute notify of the transaction
+}
+
+//Serialize message payload
+func (this *TxProof) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteHash(this.TxHash)
+	sink.WriteBool(this.Tx != nil)
+	if this.Tx == nil {
+		return
+	}
+	this.Tx.Serialization(sink)
+	sink.WriteUint32(this.Height)
+	writeHashes(sink, this.TxHashes)
+	sink.WriteUint32(this.RootHeight)
+	writeHashes(sink, this.Proof)
+	sink.WriteVarBytes(this.Notify)
+}
+
+func (this *TxProof) CmdType() string {
+	return common.TX_PROOF_TYPE
+}
+
+//Deserialize message payload
+func (this *TxProof) Deserialization(source *comm.ZeroCopySource) error {
+	var eof, irregular, found bool
+	this.TxHash, eof = source.NextHash()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	found, irregular, eof = source.NextBool()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	if !found {
+		return nil
+	}
+	this.Tx = &types.Transaction{}
+	if err := this.Tx.Deserialization(source); err != nil {
+		return err
+	}
+	this.Height, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	var err error
+	if this.TxHashes, err = readHashes(source); err != nil {
+		return err
+	}
+	this.RootHeight, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	if this.Proof, err = readHashes(source); err != nil {
+		return err
+	}
+	this.Notify, _, irregular, eof = source.NextVarBytes()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+//StorageReq request the storage value of contract
+type StorageReq struct {
+	Contract comm.Address
+	Key      []byte
+}
+
+//Serialize message payload
+func (this *StorageReq) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteAddress(this.Contract)
+	sink.WriteVarBytes(this.Key)
+}
+
+func (this *StorageReq) CmdType() string {
+	return common.GET_STORAGE_TYPE
+}
+
+//Deserialize message payload
+func (this *StorageReq) Deserialization(source *comm.ZeroCopySource) error {
+	var eof, irregular bool
+	this.Contract, eof = source.NextAddress()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Key, _, irregular, eof = source.NextVarBytes()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+//Storage is the response of StorageReq, Height is the block height the value is read at
+type Storage struct {
+	Contract comm.Address
+	Key      []byte
+	Value    []byte // empty if not found
+	Height   uint32
+}
+
+//Serialize message payload
+func (this *Storage) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteAddress(this.Contract)
+	sink.WriteVarBytes(this.Key)
+	sink.WriteVarBytes(this.Value)
+	sink.WriteUint32(this.Height)
+}
+
+func (this *Storage) CmdType() string {
+	return common.STORAGE_TYPE
+}
+
+//Deserialize message payload
+func (this *Storage) Deserialization(source *comm.ZeroCopySource) error {
+	var eof, irregular bool
+	this.Contract, eof = source.NextAddress()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Key, _, irregular, eof = source.NextVarBytes()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Value, _, irregular, eof = source.NextVarBytes()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Height, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func writeHashes(sink *comm.ZeroCopySink, hashes []comm.Uint256) {
+	sink.WriteVarUint(uint64(len(hashes)))
+	for _, hash := range hashes {
+		sink.WriteHash(hash)
+	}
+}
+
+func readHashes(source *comm.ZeroCopySource) ([]comm.Uint256, error) {
+	n, _, irregular, eof := source.NextVarUint()
+	if irregular {
+		return nil, comm.ErrIrregularData
+	}
+	if eof {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if n > source.Len()/comm.UINT256_SIZE {
+		return nil, io.ErrUnexpectedEOF
+	}
+	hashes := make([]comm.Uint256, 0, n)
+	for i := uint64(0); i < n; i++ {
+		hash, eof := source.NextHash()
+		if eof {
+			return nil, io.ErrUnexpectedEOF
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
@@ -20,14 +20,19 @@ package types
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 
+	"github.com/golang/snappy"
 	comm "github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/p2pserver/common"
 )
 
+//ErrMalformedMessage is wrapped by the errors of message which is corrupted or can not be decoded
+var ErrMalformedMessage = errors.New("malformed message")
+
 type Message interface {
 	Serialization(sink *comm.ZeroCopySink)
 	Deserialization(source *comm.ZeroCopySource) error
@@ -119,6 +124,59 @@ func WriteMessage(sink *comm.ZeroCopySink, msg Message) {
 	sink.NextBytes(payLen)
 }
 
+//WriteCompressedMessage writes msg with snappy compressed payload, it is used only if remote peer supports compression.
+//The payload of compressed message is the command of msg followed by the compressed payload of msg
+func WriteCompressedMessage(sink *comm.ZeroCopySink, msg Message) {
+	payload := comm.NewZeroCopySink(nil)
+	msg.Serialization(payload)
+	if payload.Size() < common.COMPRESS_MIN_LEN {
+		writeMessagePayload(sink, msg.CmdType(), payload.Bytes())
+		return
+	}
+
+	compressed := make([]byte, common.MSG_CMD_LEN, common.MSG_CMD_LEN+snappy.MaxEncodedLen(int(payload.Size())))
+	copy(compressed, msg.CmdType())
+	compressed = append(compressed, snappy.Encode(nil, payload.Bytes())...)
+	if len(compressed) >= int(payload.Size()) {
+		writeMessagePayload(sink, msg.CmdType(), payload.Bytes())
+		return
+	}
+	writeMessagePayload(sink, common.COMPRESS_TYPE, compressed)
+}
+
+func writeMessagePayload(sink *comm.ZeroCopySink, cmd string, payload []byte) {
+	hdr := newMessageHeader(cmd, uint32(len(payload)), common.Checksum(payload))
+	writeMessageHeaderInto(sink, hdr)
+	sink.WriteBytes(payload)
+}
+
+//decompressPayload returns the command and the payload of the compressed message
+func decompressPayload(buf []byte) (string, []byte, error) {
+	if len(buf) < common.MSG_CMD_LEN {
+		return "", nil, fmt.Errorf("compressed message too short")
+	}
+	cmdType := parseCmdType(buf[:common.MSG_CMD_LEN])
+	if cmdType == common.COMPRESS_TYPE {
+		return "", nil, fmt.Errorf("nested compressed message")
+	}
+	n, err := snappy.DecodedLen(buf[common.MSG_CMD_LEN:])
+	if err != nil {
+		return "", nil, err
+	}
+	if n > common.MAX_PAYLOAD_LEN {
+		return "", nil, fmt.Errorf("msg decompressed length:%d exceed max payload size: %d", n, common.MAX_PAYLOAD_LEN)
+	}
+	payload, err := snappy.Decode(nil, buf[common.MSG_CMD_LEN:])
+	if err != nil {
+		return "", nil, err
+	}
+	return cmdType, payload, nil
+}
+
+func parseCmdType(cmd []byte) string {
+	return string(bytes.TrimRight(cmd, "\x00"))
+}
+
 func ReadMessage(reader io.Reader) (Message, uint32, error) {
 	hdr, err := readMessageHeader(reader)
 	if err != nil {
@@ -143,17 +201,23 @@ func ReadMessage(reader io.Reader) (Message, uint32, error) {
 
 	checksum := common.Checksum(buf)
 	if checksum != hdr.Checksum {
-		return nil, 0, fmt.Errorf("message checksum mismatch: %x != %x ", hdr.Checksum, checksum)
+		return nil, 0, fmt.Errorf("%w, checksum mismatch: %x != %x ", ErrMalformedMessage, hdr.Checksum, checksum)
 	}
 
-	cmdType := string(bytes.TrimRight(hdr.CMD[:], string(0)))
+	cmdType := parseCmdType(hdr.CMD[:])
+	if cmdType == common.COMPRESS_TYPE {
+		cmdType, buf, err = decompressPayload(buf)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w, decompress error: %s", ErrMalformedMessage, err)
+		}
+	}
 	msg := makeEmptyMessage(cmdType)
 
 	// the buf is referenced by msg to avoid reallocation, so can not reused
 	source := comm.NewZeroCopySource(buf)
 	err = msg.Deserialization(source)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, fmt.Errorf("%w, %s deserialization error: %s", ErrMalformedMessage, cmdType, err)
 	}
 
 	return msg, hdr.Length, nil
@@ -197,10 +261,40 @@ func makeEmptyMessage(cmdType string) Message {
 		return &FindNodeResp{}
 	case common.UPDATE_KADID_TYPE:
 		return &UpdatePeerKeyId{}
+	case common.PEER_AUTH_TYPE:
+		return &PeerAuth{}
+	case common.NOISE_KEY_TYPE:
+		return &NoiseKey{}
+	case common.BLOCK_CHUNK_TYPE:
+		return &BlockChunk{}
 	case common.GET_SUBNET_MEMBERS_TYPE:
 		return &SubnetMembersRequest{}
 	case common.SUBNET_MEMBERS_TYPE:
 		return &SubnetMembers{}
+	case common.GET_SNAPSHOT_TYPE:
+		return &StateSnapshotReq{}
+	case common.SNAPSHOT_TYPE:
+		return &StateSnapshot{}
+	case common.GET_STATE_CHUNK_TYPE:
+		return &StateChunkReq{}
+	case common.STATE_CHUNK_TYPE:
+		return &StateChunk{}
+	case common.GET_TX_PROOF_TYPE:
+		return &TxProofReq{}
+	case common.TX_PROOF_TYPE:
+		return &TxProof{}
+	case common.GET_STORAGE_TYPE:
+		return &StorageReq{}
+	case common.STORAGE_TYPE:
+		return &Storage{}
+	case common.RELAY_REG_TYPE:
+		return &RelayRegister{}
+	case common.RELAY_ACK_TYPE:
+		return &RelayAck{}
+	case common.RELAY_CONN_TYPE:
+		return &RelayConnect{}
+	case common.CONNECT_BACK_TYPE:
+		return &ConnectBack{}
 	default:
 		return &UnknownMessage{Cmd: cmdType}
 	}
@@ -90,3 +90,26 @@ func BenchmarkReadMessageBinaryRead(b *testing.B) {
 		readMessageHeader_old(bytes.NewBuffer(sink.Bytes()))
 	}
 }
+
+func TestCompressedMessage(t *testing.T) {
+	small := &BlockChunk{Hash: common2.Uint256{1}, Index: 0, Total: 1, Data: []byte{1, 2, 3}}
+	large := &BlockChunk{Hash: common2.Uint256{2}, Index: 1, Total: 2, Data: make([]byte, 64*1024)}
+	for _, msg := range []*BlockChunk{small, large} {
+		sink := common2.NewZeroCopySink(nil)
+		WriteCompressedMessage(sink, msg)
+		plain := common2.NewZeroCopySink(nil)
+		WriteMessage(plain, msg)
+		if msg == large {
+			assert.True(t, sink.Size() < plain.Size())
+		} else {
+			assert.Equal(t, plain.Bytes(), sink.Bytes())
+		}
+
+		demsg, _, err := ReadMessage(bytes.NewBuffer(sink.Bytes()))
+		assert.Nil(t, err)
+		assert.Equal(t, msg, demsg)
+	}
+
+	_, _, err := decompressPayload([]byte(common.COMPRESS_TYPE))
+	assert.NotNil(t, err)
+}
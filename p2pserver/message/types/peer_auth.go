@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"io"
+
+	common2 "github.com/saveio/themis/common"
+	"github.com/saveio/themis/p2pserver/common"
+)
+
+//PeerAuth carries the challenge for remote peer, and the signature of the challenge received from remote peer
+type PeerAuth struct {
+	Nonce     []byte
+	Signature []byte
+}
+
+//Serialize message payload
+func (this *PeerAuth) Serialization(sink *common2.ZeroCopySink) {
+	sink.WriteVarBytes(this.Nonce)
+	sink.WriteVarBytes(this.Signature)
+}
+
+func (this *PeerAuth) Deserialization(source *common2.ZeroCopySource) error {
+	var irregular, eof bool
+	this.Nonce, _, irregular, eof = source.NextVarBytes()
+	if irregular {
+		return common2.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Signature, _, irregular, eof = source.NextVarBytes()
+	if irregular {
+		return common2.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (this *PeerAuth) CmdType() string {
+	return common.PEER_AUTH_TYPE
+}
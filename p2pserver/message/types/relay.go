@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"io"
+
+	comm "github.com/saveio/themis/common"
+	"github.com/saveio/themis/p2pserver/common"
+)
+
+//RelayRegister request peer to relay connections for the unreachable sender
+type RelayRegister struct{}
+
+//Serialize message payload
+func (this *RelayRegister) Serialization(sink *comm.ZeroCopySink) {
+}
+
+func (this *RelayRegister) CmdType() string {
+	return common.RELAY_REG_TYPE
+}
+
+//Deserialize message payload
+func (this *RelayRegister) Deserialization(source *comm.ZeroCopySource) error {
+	return nil
+}
+
+//RelayAck is the response of RelayRegister
+type RelayAck struct {
+	Accepted bool
+}
+
+//Serialize message payload
+func (this *RelayAck) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteBool(this.Accepted)
+}
+
+func (this *RelayAck) CmdType() string {
+	return common.RELAY_ACK_TYPE
+}
+
+//Deserialize message payload
+func (this *RelayAck) Deserialization(source *comm.ZeroCopySource) error {
+	var irregular, eof bool
+	this.Accepted, irregular, eof = source.NextBool()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+//RelayConnect request relay to ask the unreachable node listening on Target connecting back to sender
+type RelayConnect struct {
+	Target string
+}
+
+//Serialize message payload
+func (this *RelayConnect) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteString(this.Target)
+}
+
+func (this *RelayConnect) CmdType() string {
+	return common.RELAY_CONN_TYPE
+}
+
+//Deserialize message payload
+func (this *RelayConnect) Deserialization(source *comm.ZeroCopySource) error {
+	var irregular, eof bool
+	this.Target, _, irregular, eof = source.NextString()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+//ConnectBack ask the unreachable node to connect the peer listening on Addr
+type ConnectBack struct {
+	Addr string
+}
+
+//Serialize message payload
+func (this *ConnectBack) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteString(this.Addr)
+}
+
+func (this *ConnectBack) CmdType() string {
+	return common.CONNECT_BACK_TYPE
+}
+
+//Deserialize message payload
+func (this *ConnectBack) Deserialization(source *comm.ZeroCopySource) error {
+	var irregular, eof bool
+	this.Addr, _, irregular, eof = source.NextString()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
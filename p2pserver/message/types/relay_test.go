@@ -0,0 +1,30 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"testing"
+)
+
+func TestRelaySerializationDeserialization(t *testing.T) {
+	MessageTest(t, &RelayRegister{})
+	MessageTest(t, &RelayAck{Accepted: true})
+	MessageTest(t, &RelayConnect{Target: "1.2.3.4:20338"})
+	MessageTest(t, &ConnectBack{Addr: "5.6.7.8:20338"})
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"io"
+
+	comm "github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/p2pserver/common"
+)
+
+//StateSnapshotReq request the state snapshot manifest at height, the latest snapshot if height is 0
+type StateSnapshotReq struct {
+	Height uint32
+}
+
+//Serialize message payload
+func (this *StateSnapshotReq) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteUint32(this.Height)
+}
+
+func (this *StateSnapshotReq) CmdType() string {
+	return common.GET_SNAPSHOT_TYPE
+}
+
+//Deserialize message payload
+func (this *StateSnapshotReq) Deserialization(source *comm.ZeroCopySource) error {
+	var eof bool
+	this.Height, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+//StateSnapshot is the response of StateSnapshotReq
+type StateSnapshot struct {
+	Snapshot types.StateSnapshot
+}
+
+//Serialize message payload
+func (this *StateSnapshot) Serialization(sink *comm.ZeroCopySink) {
+	this.Snapshot.Serialization(sink)
+}
+
+func (this *StateSnapshot) CmdType() string {
+	return common.SNAPSHOT_TYPE
+}
+
+//Deserialize message payload
+func (this *StateSnapshot) Deserialization(source *comm.ZeroCopySource) error {
+	return this.Snapshot.Deserialization(source)
+}
+
+//StateChunkReq request a chunk of the state snapshot at height
+type StateChunkReq struct {
+	Height uint32
+	Index  uint32
+}
+
+//Serialize message payload
+func (this *StateChunkReq) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteUint32(this.Height)
+	sink.WriteUint32(this.Index)
+}
+
+func (this *StateChunkReq) CmdType() string {
+	return common.GET_STATE_CHUNK_TYPE
+}
+
+//Deserialize message payload
+func (this *StateChunkReq) Deserialization(source *comm.ZeroCopySource) error {
+	var eof bool
+	this.Height, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Index, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+//StateChunk is the response of StateChunkReq
+type StateChunk struct {
+	Height uint32
+	Index  uint32
+	Data   []byte
+}
+
+//Serialize message payload
+func (this *StateChunk) Serialization(sink *comm.ZeroCopySink) {
+	sink.WriteUint32(this.Height)
+	sink.WriteUint32(this.Index)
+	sink.WriteVarBytes(this.Data)
+}
+
+func (this *StateChunk) CmdType() string {
+	return common.STATE_CHUNK_TYPE
+}
+
+//Deserialize message payload
+func (this *StateChunk) Deserialization(source *comm.ZeroCopySource) error {
+	var eof bool
+	this.Height, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	this.Index, eof = source.NextUint32()
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	var irregular bool
+	this.Data, _, irregular, eof = source.NextVarBytes()
+	if irregular {
+		return comm.ErrIrregularData
+	}
+	if eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package types
+
+import (
+	"testing"
+
+	cm "github.com/saveio/themis/common"
+)
+
+func TestStateSnapshotSerializationDeserialization(t *testing.T) {
+	MessageTest(t, &StateSnapshotReq{Height: 1000})
+
+	var msg StateSnapshot
+	msg.Snapshot.Height = 1000
+	msg.Snapshot.BlockHash, _ = cm.Uint256FromHexString("8932da73f52b1e22f30c609988ed1f693b6144f74fed9a2a20869afa7abfdf5e")
+	msg.Snapshot.ChunkHashes = []cm.Uint256{msg.Snapshot.BlockHash}
+	MessageTest(t, &msg)
+
+	MessageTest(t, &StateChunkReq{Height: 1000, Index: 1})
+	MessageTest(t, &StateChunk{Height: 1000, Index: 1, Data: []byte{1, 2, 3}})
+}
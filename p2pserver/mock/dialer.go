@@ -43,7 +43,8 @@ func (d *dialer) Dial(nodeAddr string) (net.Conn, error) {
 		return nil, errors.New("can not be reached")
 	}
 
-	if _, allow := d.network.canEstablish[combineKey(d.id, l.id)]; !allow {
+	_, allow := d.network.canEstablish[combineKey(d.id, l.id)]
+	if _, allowDial := d.network.canEstablish[dialKey(d.id, l.id)]; !allow && !allowDial {
 		return nil, errors.New("can not be reached")
 	}
 
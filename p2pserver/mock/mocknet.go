@@ -95,6 +95,17 @@ func (n *network) AllowConnect(id1, id2 common.PeerId) {
 	n.canEstablish[combineKey(id1, id2)] = struct{}{}
 }
 
+func (n *network) AllowDial(from, to common.PeerId) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.canEstablish[dialKey(from, to)] = struct{}{}
+}
+
+func dialKey(from, to common.PeerId) string {
+	return from.ToHexString() + ">" + to.ToHexString()
+}
+
 // DeliverRate TODO
 func (n *network) DeliverRate(percent uint) {
 
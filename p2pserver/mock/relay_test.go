@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/saveio/themis/p2pserver/common"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
+	"github.com/saveio/themis/p2pserver/net/netserver"
+	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/protocols/bootstrap"
+	"github.com/saveio/themis/p2pserver/protocols/relay"
+	"github.com/saveio/themis/p2pserver/protocols/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type RelayProtocol struct {
+	seeds     []string
+	bootstrap *bootstrap.BootstrapService
+	relay     *relay.RelayService
+}
+
+func (self *RelayProtocol) start(net p2p.P2P) {
+	seeds, invalid := utils.NewHostsResolver(self.seeds)
+	if len(invalid) != 0 {
+		panic(fmt.Errorf("invalid seed list； %v", invalid))
+	}
+	self.bootstrap = bootstrap.NewBootstrapService(net, seeds)
+	self.relay = relay.NewRelayService(net, 50*time.Millisecond, 100*time.Millisecond)
+	go self.bootstrap.Start()
+	go self.relay.Start()
+}
+
+func (self *RelayProtocol) HandleSystemMessage(net p2p.P2P, msg p2p.SystemMessage) {
+	switch m := msg.(type) {
+	case p2p.NetworkStart:
+		self.start(net)
+	case p2p.PeerConnected:
+		self.bootstrap.OnAddPeer(m.Info)
+	case p2p.PeerDisConnected:
+		self.bootstrap.OnDelPeer(m.Info)
+		self.relay.OnDelPeer(m.Info)
+	case p2p.PeerUnreachable:
+		self.relay.OnPeerUnreachable(m.Addr)
+	case p2p.NetworkStop:
+		self.bootstrap.Stop()
+		self.relay.Stop()
+	}
+}
+
+func (self *RelayProtocol) HandlePeerMessage(ctx *p2p.Context, msg msgTypes.Message) {
+	switch m := msg.(type) {
+	case *msgTypes.RelayRegister:
+		self.relay.OnRelayRegister(ctx)
+	case *msgTypes.RelayAck:
+		self.relay.OnRelayAck(ctx, m)
+	case *msgTypes.RelayConnect:
+		self.relay.OnRelayConnect(ctx, m)
+	case *msgTypes.ConnectBack:
+		self.relay.OnConnectBack(ctx, m)
+	}
+}
+
+func NewRelayNode(seeds []string, net Network) (*netserver.NetServer, *RelayProtocol) {
+	seedId := common.RandPeerKeyId()
+	info := peer.NewPeerInfo(seedId.Id, 0, 0, true, 0,
+		0, 0, "1.10", "")
+
+	proto := &RelayProtocol{seeds: seeds}
+	context := fmt.Sprintf("peer %s:, ", seedId.Id.ToHexString()[:6])
+	logger := common.LoggerWithContext(common.NewGlobalLoggerWrapper(), context)
+	return NewNode(seedId, "", info, proto, net, nil, p2p.AllAddrFilter(), logger), proto
+}
+
+func TestRelayConnectBack(t *testing.T) {
+	//topo: natNode —— seed —— normal, natNode can only dial out
+	net := NewNetwork()
+	seedNode, _ := NewRelayNode(nil, net)
+	go seedNode.Start()
+	seedAddr := seedNode.GetHostInfo().Addr
+
+	natNode, natProto := NewRelayNode([]string{seedAddr}, net)
+	normal, _ := NewRelayNode([]string{seedAddr}, net)
+	net.AllowConnect(seedNode.GetHostInfo().Id, natNode.GetHostInfo().Id)
+	net.AllowConnect(seedNode.GetHostInfo().Id, normal.GetHostInfo().Id)
+	net.AllowDial(natNode.GetHostInfo().Id, normal.GetHostInfo().Id)
+	go natNode.Start()
+	go normal.Start()
+
+	time.Sleep(time.Second)
+	assert.True(t, seedNode.IsReachable())
+	assert.False(t, natNode.IsReachable())
+	assert.True(t, natProto.relay.IsRelayed())
+	assert.Equal(t, uint32(1), normal.GetConnectionCnt())
+
+	//dialing the nat node fails, the seed relays connect back request to it
+	normal.Connect(natNode.GetHostInfo().Addr)
+	time.Sleep(time.Second)
+	assert.Equal(t, uint32(2), normal.GetConnectionCnt())
+	assert.Equal(t, uint32(2), natNode.GetConnectionCnt())
+	assert.True(t, normal.IsReachable())
+}
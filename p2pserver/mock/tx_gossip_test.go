@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mock
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	comm "github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/core/utils"
+	"github.com/saveio/themis/p2pserver/common"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
+	"github.com/saveio/themis/p2pserver/net/netserver"
+	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/protocols/bootstrap"
+	"github.com/saveio/themis/p2pserver/protocols/tx_gossip"
+	protoUtils "github.com/saveio/themis/p2pserver/protocols/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+//TxGossipProtocol relay the received transactions like tx pool
+type TxGossipProtocol struct {
+	seeds     []string
+	bootstrap *bootstrap.BootstrapService
+	gossip    *tx_gossip.TxGossip
+
+	lock     sync.Mutex
+	received map[comm.Uint256]int //Map tx hash => received times
+	invs     int                  //Inventory messages received
+}
+
+func (self *TxGossipProtocol) start(net p2p.P2P) {
+	seeds, invalid := protoUtils.NewHostsResolver(self.seeds)
+	if len(invalid) != 0 {
+		panic(fmt.Errorf("invalid seed list； %v", invalid))
+	}
+	self.bootstrap = bootstrap.NewBootstrapService(net, seeds)
+	self.gossip = tx_gossip.NewTxGossip(net, nil, 0, nil)
+	go self.bootstrap.Start()
+	go self.gossip.Start()
+}
+
+func (self *TxGossipProtocol) HandleSystemMessage(net p2p.P2P, msg p2p.SystemMessage) {
+	switch m := msg.(type) {
+	case p2p.NetworkStart:
+		self.start(net)
+	case p2p.PeerConnected:
+		self.bootstrap.OnAddPeer(m.Info)
+		self.gossip.OnAddPeer(m.Info.Id)
+	case p2p.PeerDisConnected:
+		self.bootstrap.OnDelPeer(m.Info)
+		self.gossip.OnDelPeer(m.Info.Id)
+	case p2p.NetworkStop:
+		self.bootstrap.Stop()
+		self.gossip.Stop()
+	}
+}
+
+func (self *TxGossipProtocol) HandlePeerMessage(ctx *p2p.Context, msg msgTypes.Message) {
+	switch m := msg.(type) {
+	case *msgTypes.Inv:
+		self.lock.Lock()
+		self.invs++
+		self.lock.Unlock()
+		self.gossip.OnInvReceive(ctx, m.P.Blk)
+	case *msgTypes.DataReq:
+		self.gossip.DataReqHandle(ctx, m.Hash)
+	case *msgTypes.Trn:
+		self.gossip.OnTxReceive(ctx.Sender().GetID(), m.Txn.Hash())
+		self.lock.Lock()
+		self.received[m.Txn.Hash()]++
+		self.lock.Unlock()
+		self.gossip.Announce(m.Txn)
+	}
+}
+
+func (self *TxGossipProtocol) receivedTimes(hash comm.Uint256) int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.received[hash]
+}
+
+func (self *TxGossipProtocol) invCount() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.invs
+}
+
+func NewTxGossipNode(seeds []string, net Network, version string) (*netserver.NetServer, *TxGossipProtocol) {
+	seedId := common.RandPeerKeyId()
+	info := peer.NewPeerInfo(seedId.Id, 0, 0, true, 0,
+		0, 0, version, "")
+
+	proto := &TxGossipProtocol{seeds: seeds, received: make(map[comm.Uint256]int)}
+	context := fmt.Sprintf("peer %s:, ", seedId.Id.ToHexString()[:6])
+	logger := common.LoggerWithContext(common.NewGlobalLoggerWrapper(), context)
+	return NewNode(seedId, "", info, proto, net, nil, p2p.AllAddrFilter(), logger), proto
+}
+
+func TestTxGossip(t *testing.T) {
+	//topo: node1 —— seed —— node2
+	net := NewNetwork()
+	seedNode, seedProto := NewTxGossipNode(nil, net, common.MIN_VERSION_FOR_TX_GOSSIP)
+	go seedNode.Start()
+	seedAddr := seedNode.GetHostInfo().Addr
+	var nodes []*netserver.NetServer
+	var protos []*TxGossipProtocol
+	for i := 0; i < 2; i++ {
+		node, proto := NewTxGossipNode([]string{seedAddr}, net, common.MIN_VERSION_FOR_TX_GOSSIP)
+		net.AllowConnect(seedNode.GetHostInfo().Id, node.GetHostInfo().Id)
+		go node.Start()
+		nodes = append(nodes, node)
+		protos = append(protos, proto)
+	}
+	time.Sleep(time.Second)
+	assert.Equal(t, uint32(2), seedNode.GetConnectionCnt())
+
+	var tx *types.Transaction
+	tx, err := utils.NewInvokeTransaction([]byte{1, 2, 3}).IntoImmutable()
+	assert.Nil(t, err)
+	protos[0].gossip.Announce(tx)
+	time.Sleep(time.Second)
+
+	//every node fetch the transaction exactly once, and the announcer never receive it back
+	assert.Equal(t, 1, seedProto.receivedTimes(tx.Hash()))
+	assert.Equal(t, 1, protos[1].receivedTimes(tx.Hash()))
+	assert.Equal(t, 0, protos[0].receivedTimes(tx.Hash()))
+}
+
+func TestTxGossipOldVersionPeer(t *testing.T) {
+	//topo: node —— seed —— old node
+	net := NewNetwork()
+	seedNode, seedProto := NewTxGossipNode(nil, net, common.MIN_VERSION_FOR_TX_GOSSIP)
+	go seedNode.Start()
+	seedAddr := seedNode.GetHostInfo().Addr
+	node, proto := NewTxGossipNode([]string{seedAddr}, net, common.MIN_VERSION_FOR_TX_GOSSIP)
+	oldNode, oldProto := NewTxGossipNode([]string{seedAddr}, net, "1.10")
+	for _, n := range []*netserver.NetServer{node, oldNode} {
+		net.AllowConnect(seedNode.GetHostInfo().Id, n.GetHostInfo().Id)
+		go n.Start()
+	}
+	time.Sleep(time.Second)
+	assert.Equal(t, uint32(2), seedNode.GetConnectionCnt())
+
+	tx, err := utils.NewInvokeTransaction([]byte{1, 2, 3}).IntoImmutable()
+	assert.Nil(t, err)
+	proto.gossip.Announce(tx)
+	time.Sleep(time.Second)
+
+	//the old node receive the full transaction instead of the announcement
+	assert.Equal(t, 1, seedProto.receivedTimes(tx.Hash()))
+	assert.Equal(t, 1, oldProto.receivedTimes(tx.Hash()))
+	assert.Equal(t, 0, oldProto.invCount())
+	assert.Equal(t, 0, proto.receivedTimes(tx.Hash()))
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+//Package nat provides port mapping on the gateway with UPnP or NAT-PMP, so the node behind router can be
+//reached by peers
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saveio/themis/common/log"
+)
+
+const (
+	MAP_LIFETIME      = 20 * time.Minute //Lifetime of port mapping, the mapping expires if node is gone
+	MAP_REFRESH       = 15 * time.Minute //Renew the port mapping every MAP_REFRESH
+	MAP_RETRY         = time.Minute      //Map port again after MAP_RETRY if failed
+	DISCOVERY_TIMEOUT = 3 * time.Second  //Wait at most DISCOVERY_TIMEOUT for the gateway responses
+	MAP_DESCRIPTION   = "themis p2p"
+	MAP_PROTOCOL_TCP  = "tcp"
+	MAP_PROTOCOL_UDP  = "udp"
+)
+
+var ErrNoGateway = errors.New("no NAT gateway found")
+
+//Interface is the port mapping mechanism of gateway
+type Interface interface {
+	//ExternalIP return the external address of gateway
+	ExternalIP() (net.IP, error)
+	//AddMapping map the external port of gateway to internal port of this node, return the external port mapped,
+	//which may differ from extport
+	AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) (int, error)
+	DeleteMapping(protocol string, extport, intport int) error
+	String() string
+}
+
+//Parse the nat config, which is one of:
+//	"" or "none"   no port mapping
+//	"any"          map port by UPnP or NAT-PMP, whichever is found first
+//	"upnp"         map port by UPnP
+//	"pmp"          map port by NAT-PMP, with gateway detected automatically
+//	"pmp:<IP>"     map port by NAT-PMP with the gateway of IP
+//	"extip:<IP>"   no port mapping, the external address is IP
+func Parse(spec string) (Interface, error) {
+	mech, param := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		mech, param = spec[:i], spec[i+1:]
+	}
+	var ip net.IP
+	if param != "" {
+		ip = net.ParseIP(param)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s in nat config", param)
+		}
+	}
+	switch strings.ToLower(mech) {
+	case "", "none":
+		return nil, nil
+	case "any":
+		return Any(), nil
+	case "upnp":
+		return UPnP(), nil
+	case "pmp":
+		return PMP(ip), nil
+	case "extip":
+		if ip == nil {
+			return nil, fmt.Errorf("missing IP address in nat config %s", spec)
+		}
+		return ExtIP(ip), nil
+	default:
+		return nil, fmt.Errorf("unknown nat mechanism %s", mech)
+	}
+}
+
+//ExtIP assumes the node is reachable at the given external address, no port mapping is needed
+type ExtIP net.IP
+
+func (this ExtIP) ExternalIP() (net.IP, error) {
+	return net.IP(this), nil
+}
+
+func (this ExtIP) AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) (int, error) {
+	return extport, nil
+}
+
+func (this ExtIP) DeleteMapping(protocol string, extport, intport int) error {
+	return nil
+}
+
+func (this ExtIP) String() string {
+	return fmt.Sprintf("ExtIP(%v)", net.IP(this))
+}
+
+//Any discovers gateway supporting UPnP or NAT-PMP
+func Any() Interface {
+	return newAutoDiscovery("UPnP or NAT-PMP", func() Interface {
+		found := make(chan Interface, 2)
+		go func() { found <- discoverUPnP() }()
+		go func() { found <- discoverPMP() }()
+		for i := 0; i < cap(found); i++ {
+			if gateway := <-found; gateway != nil {
+				return gateway
+			}
+		}
+		return nil
+	})
+}
+
+//UPnP discovers gateway supporting UPnP
+func UPnP() Interface {
+	return newAutoDiscovery("UPnP", discoverUPnP)
+}
+
+//PMP use NAT-PMP gateway of IP, the gateway is discovered if IP is nil
+func PMP(gateway net.IP) Interface {
+	if gateway != nil {
+		return &pmp{gateway: gateway, port: NATPMP_PORT}
+	}
+	return newAutoDiscovery("NAT-PMP", discoverPMP)
+}
+
+//autoDiscovery discovers the gateway on first use, and discovers again on next use if not found
+type autoDiscovery struct {
+	what     string
+	discover func() Interface
+
+	lock  sync.Mutex
+	found Interface
+}
+
+func newAutoDiscovery(what string, discover func() Interface) *autoDiscovery {
+	return &autoDiscovery{what: what, discover: discover}
+}
+
+func (this *autoDiscovery) gateway() (Interface, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.found == nil {
+		this.found = this.discover()
+		if this.found == nil {
+			return nil, ErrNoGateway
+		}
+		log.Infof("[nat] found gateway %s", this.found)
+	}
+	return this.found, nil
+}
+
+func (this *autoDiscovery) ExternalIP() (net.IP, error) {
+	gateway, err := this.gateway()
+	if err != nil {
+		return nil, err
+	}
+	return gateway.ExternalIP()
+}
+
+func (this *autoDiscovery) AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) (int, error) {
+	gateway, err := this.gateway()
+	if err != nil {
+		return 0, err
+	}
+	return gateway.AddMapping(protocol, extport, intport, name, lifetime)
+}
+
+func (this *autoDiscovery) DeleteMapping(protocol string, extport, intport int) error {
+	gateway, err := this.gateway()
+	if err != nil {
+		return err
+	}
+	return gateway.DeleteMapping(protocol, extport, intport)
+}
+
+func (this *autoDiscovery) String() string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.found != nil {
+		return this.found.String()
+	}
+	return this.what
+}
+
+//Map keeps the port mapped until quit closed, the mapping is deleted then. mapped is called with the external
+//address when the port is mapped, and with nil when the mapping is lost
+func Map(m Interface, quit <-chan bool, protocol string, extport, intport int, name string,
+	mapped func(ip net.IP, port int)) {
+	refresh := time.NewTimer(0)
+	defer refresh.Stop()
+	isMapped := false
+	defer func() {
+		if !isMapped {
+			return
+		}
+		if err := m.DeleteMapping(protocol, extport, intport); err != nil {
+			log.Debugf("[nat] delete port mapping %s %d error: %s", protocol, extport, err)
+		} else {
+			log.Infof("[nat] port mapping %s %d deleted", protocol, extport)
+		}
+	}()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-refresh.C:
+			ip, port, err := mapPort(m, protocol, extport, intport, name)
+			if err != nil {
+				log.Warnf("[nat] map port %s %d by %s error: %s", protocol, intport, m, err)
+				if isMapped {
+					isMapped = false
+					mapped(nil, 0)
+				}
+				refresh.Reset(MAP_RETRY)
+				continue
+			}
+			if !isMapped {
+				log.Infof("[nat] port %s %d mapped to %s by %s", protocol, intport,
+					net.JoinHostPort(ip.String(), fmt.Sprint(port)), m)
+				isMapped = true
+				mapped(ip, port)
+			}
+			refresh.Reset(MAP_REFRESH)
+		}
+	}
+}
+
+func mapPort(m Interface, protocol string, extport, intport int, name string) (net.IP, int, error) {
+	port, err := m.AddMapping(protocol, extport, intport, name, MAP_LIFETIME)
+	if err != nil {
+		return nil, 0, err
+	}
+	ip, err := m.ExternalIP()
+	if err != nil {
+		return nil, 0, err
+	}
+	return ip, port, nil
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse("none")
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+
+	m, err = Parse("extip:1.2.3.4")
+	assert.Nil(t, err)
+	ip, err := m.ExternalIP()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4", ip.String())
+
+	m, err = Parse("pmp:192.168.1.1")
+	assert.Nil(t, err)
+	assert.Equal(t, "NAT-PMP(192.168.1.1)", m.String())
+
+	_, err = Parse("extip")
+	assert.NotNil(t, err)
+	_, err = Parse("pmp:invalid")
+	assert.NotNil(t, err)
+	_, err = Parse("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestParseDefaultGateway(t *testing.T) {
+	route := "Iface\tDestination\tGateway \tFlags\n" +
+		"eth0\t0002A8C0\t00000000\t0001\n" +
+		"eth0\t00000000\t0102A8C0\t0003\n"
+	gateway := parseDefaultGateway(bufio.NewScanner(strings.NewReader(route)))
+	assert.Equal(t, "192.168.2.1", gateway.String())
+}
+
+//fakePMPGateway serves NAT-PMP requests, the external port is mapped to port+1
+func fakePMPGateway(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			resp := make([]byte, 16)
+			resp[1] = buf[1] | 0x80
+			switch {
+			case n == 2 && buf[1] == natpmpOpExternalIP:
+				copy(resp[8:12], net.IPv4(8, 8, 4, 4).To4())
+				resp = resp[:12]
+			case n == 12:
+				copy(resp[8:10], buf[4:6])
+				binary.BigEndian.PutUint16(resp[10:12], binary.BigEndian.Uint16(buf[6:8])+1)
+				copy(resp[12:16], buf[8:12])
+			default:
+				binary.BigEndian.PutUint16(resp[2:4], 5)
+			}
+			conn.WriteToUDP(resp, addr)
+		}
+	}()
+	return conn
+}
+
+func TestPMP(t *testing.T) {
+	gateway := fakePMPGateway(t)
+	defer gateway.Close()
+	client := &pmp{gateway: net.IPv4(127, 0, 0, 1), port: gateway.LocalAddr().(*net.UDPAddr).Port}
+
+	ip, err := client.ExternalIP()
+	assert.Nil(t, err)
+	assert.Equal(t, "8.8.4.4", ip.String())
+
+	port, err := client.AddMapping("tcp", 20338, 20338, MAP_DESCRIPTION, MAP_LIFETIME)
+	assert.Nil(t, err)
+	assert.Equal(t, 20339, port)
+	assert.Nil(t, client.DeleteMapping("tcp", 20338, 20338))
+	_, err = client.AddMapping("sctp", 20338, 20338, MAP_DESCRIPTION, MAP_LIFETIME)
+	assert.NotNil(t, err)
+}
+
+func TestUPnP(t *testing.T) {
+	var actions []string
+	var mapping string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/desc.xml":
+			w.Write([]byte(`<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList><device>
+      <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+      <deviceList><device>
+        <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+        <serviceList><service>
+          <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+          <controlURL>/ctl/IPConn</controlURL>
+        </service></serviceList>
+      </device></deviceList>
+    </device></deviceList>
+  </device>
+</root>`))
+		case "/ctl/IPConn":
+			action := r.Header.Get("SOAPAction")
+			actions = append(actions, action)
+			body, _ := ioutil.ReadAll(r.Body)
+			if strings.Contains(action, "#AddPortMapping") {
+				mapping = string(body)
+			}
+			w.Write([]byte(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` +
+				`<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">` +
+				`<NewExternalIPAddress>8.8.8.8</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	_, err := newUPnP(server.URL + "/notfound.xml")
+	assert.NotNil(t, err)
+	client, err := newUPnP(server.URL + "/desc.xml")
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/ctl/IPConn", client.controlURL)
+
+	quit := make(chan bool)
+	mapped := make(chan net.IP, 1)
+	done := make(chan bool)
+	go func() {
+		Map(client, quit, "tcp", 20338, 20338, MAP_DESCRIPTION, func(ip net.IP, port int) {
+			assert.Equal(t, 20338, port)
+			mapped <- ip
+		})
+		close(done)
+	}()
+	select {
+	case ip := <-mapped:
+		assert.Equal(t, "8.8.8.8", ip.String())
+	case <-time.After(5 * time.Second):
+		t.Fatal("port not mapped")
+	}
+	close(quit)
+	<-done
+
+	assert.Contains(t, mapping, "<NewExternalPort>20338</NewExternalPort><NewProtocol>TCP</NewProtocol>")
+	assert.Contains(t, mapping, "<NewInternalClient>127.0.0.1</NewInternalClient>")
+	assert.Equal(t, []string{
+		`"urn:schemas-upnp-org:service:WANIPConnection:1#AddPortMapping"`,
+		`"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"`,
+		`"urn:schemas-upnp-org:service:WANIPConnection:1#DeletePortMapping"`,
+	}, actions)
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	NATPMP_PORT            = 5351
+	NATPMP_INITIAL_TIMEOUT = 250 * time.Millisecond //Timeout of first request, doubled in each retry as RFC 6886
+	NATPMP_MAX_RETRIES     = 4
+
+	natpmpOpExternalIP = 0
+	natpmpOpMapUDP     = 1
+	natpmpOpMapTCP     = 2
+)
+
+//pmp is the NAT-PMP client of gateway, see RFC 6886
+type pmp struct {
+	gateway net.IP
+	port    int
+}
+
+func (this *pmp) String() string {
+	return fmt.Sprintf("NAT-PMP(%v)", this.gateway)
+}
+
+func (this *pmp) ExternalIP() (net.IP, error) {
+	resp, err := this.request([]byte{0, natpmpOpExternalIP}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(resp[8], resp[9], resp[10], resp[11]), nil
+}
+
+func (this *pmp) AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) (int, error) {
+	resp, err := this.mapping(protocol, extport, intport, uint32(lifetime/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(resp[10:12])), nil
+}
+
+func (this *pmp) DeleteMapping(protocol string, extport, intport int) error {
+	//mapping is deleted by requesting with zero lifetime and zero external port
+	_, err := this.mapping(protocol, 0, intport, 0)
+	return err
+}
+
+func (this *pmp) mapping(protocol string, extport, intport int, lifetime uint32) ([]byte, error) {
+	msg := make([]byte, 12)
+	switch strings.ToLower(protocol) {
+	case MAP_PROTOCOL_TCP:
+		msg[1] = natpmpOpMapTCP
+	case MAP_PROTOCOL_UDP:
+		msg[1] = natpmpOpMapUDP
+	default:
+		return nil, fmt.Errorf("unknown protocol %s", protocol)
+	}
+	binary.BigEndian.PutUint16(msg[4:6], uint16(intport))
+	binary.BigEndian.PutUint16(msg[6:8], uint16(extport))
+	binary.BigEndian.PutUint32(msg[8:12], lifetime)
+	return this.request(msg, 16)
+}
+
+//request send msg to gateway and wait the response of respLen bytes, retry with doubled timeout
+func (this *pmp) request(msg []byte, respLen int) ([]byte, error) {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: this.gateway, Port: this.port})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	timeout := NATPMP_INITIAL_TIMEOUT
+	buf := make([]byte, 16)
+	for i := 0; i < NATPMP_MAX_RETRIES; i++ {
+		err = conn.SetDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return nil, err
+		}
+		if _, err = conn.Write(msg); err != nil {
+			return nil, err
+		}
+		var n int
+		n, err = conn.Read(buf)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				timeout *= 2
+				continue
+			}
+			return nil, err
+		}
+		if n < respLen || buf[0] != 0 || buf[1] != msg[1]|0x80 {
+			return nil, fmt.Errorf("invalid NAT-PMP response")
+		}
+		if code := binary.BigEndian.Uint16(buf[2:4]); code != 0 {
+			return nil, fmt.Errorf("NAT-PMP result code %d", code)
+		}
+		return buf[:n], nil
+	}
+	return nil, err
+}
+
+//discoverPMP try the potential gateways, return the first one responding
+func discoverPMP() Interface {
+	gateways := potentialGateways()
+	found := make(chan *pmp, len(gateways))
+	for _, gateway := range gateways {
+		go func(gateway net.IP) {
+			client := &pmp{gateway: gateway, port: NATPMP_PORT}
+			if _, err := client.ExternalIP(); err != nil {
+				client = nil
+			}
+			found <- client
+		}(gateway)
+	}
+	for range gateways {
+		if client := <-found; client != nil {
+			return client
+		}
+	}
+	return nil
+}
+
+//potentialGateways return the default gateway in route table, or guess the x.x.x.1 of local private networks
+func potentialGateways() []net.IP {
+	if gateway := defaultGateway(); gateway != nil {
+		return []net.IP{gateway}
+	}
+	var gateways []net.IP
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip == nil || !isPrivateIP(ip) {
+			continue
+		}
+		gateway := make(net.IP, len(ip))
+		copy(gateway, ip.Mask(ipnet.Mask))
+		gateway[3] |= 1
+		gateways = append(gateways, gateway)
+	}
+	return gateways
+}
+
+//defaultGateway parse default route of linux route table
+func defaultGateway() net.IP {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	return parseDefaultGateway(bufio.NewScanner(file))
+}
+
+func parseDefaultGateway(scanner *bufio.Scanner) net.IP {
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != net.IPv4len {
+			continue
+		}
+		//route table is in host byte order, which is little endian
+		return net.IPv4(raw[3], raw[2], raw[1], raw[0])
+	}
+	return nil
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"} {
+		_, block, _ := net.ParseCIDR(cidr)
+		if block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,293 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SSDP_ADDR           = "239.255.255.250:1900"
+	UPNP_HTTP_TIMEOUT   = 5 * time.Second
+	UPNP_MAX_DESC_SIZE  = 1 << 20
+	upnpGatewayDevice   = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+	upnpWANIPService    = "urn:schemas-upnp-org:service:WANIPConnection:"
+	upnpWANPPPService   = "urn:schemas-upnp-org:service:WANPPPConnection:"
+	upnpSoapEnvelopeFmt = `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:%s xmlns:u="%s">%s</u:%s></s:Body></s:Envelope>`
+)
+
+//upnp is the client of WANIPConnection or WANPPPConnection service of internet gateway device
+type upnp struct {
+	controlURL  string
+	serviceType string
+	localIP     net.IP //Address of this node in the network of gateway
+	client      *http.Client
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type upnpDevice struct {
+	DeviceType string        `xml:"deviceType"`
+	Services   []upnpService `xml:"serviceList>service"`
+	Devices    []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpRoot struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+//soapArg is the argument of soap action, arguments are sent in order
+type soapArg struct {
+	name  string
+	value string
+}
+
+func (this *upnp) String() string {
+	return fmt.Sprintf("UPnP(%s)", this.controlURL)
+}
+
+func (this *upnp) ExternalIP() (net.IP, error) {
+	resp, err := this.soap("GetExternalIPAddress", nil)
+	if err != nil {
+		return nil, err
+	}
+	value, err := soapValue(resp, "NewExternalIPAddress")
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid external IP address %s", value)
+	}
+	return ip, nil
+}
+
+func (this *upnp) AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) (int, error) {
+	_, err := this.soap("AddPortMapping", []soapArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(extport)},
+		{"NewProtocol", strings.ToUpper(protocol)},
+		{"NewInternalPort", strconv.Itoa(intport)},
+		{"NewInternalClient", this.localIP.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", name},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime / time.Second))},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return extport, nil
+}
+
+func (this *upnp) DeleteMapping(protocol string, extport, intport int) error {
+	_, err := this.soap("DeletePortMapping", []soapArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(extport)},
+		{"NewProtocol", strings.ToUpper(protocol)},
+	})
+	return err
+}
+
+//soap invoke action of the connection service, return the response body
+func (this *upnp) soap(action string, args []soapArg) ([]byte, error) {
+	var body bytes.Buffer
+	for _, arg := range args {
+		body.WriteString("<" + arg.name + ">")
+		if err := xml.EscapeText(&body, []byte(arg.value)); err != nil {
+			return nil, err
+		}
+		body.WriteString("</" + arg.name + ">")
+	}
+	envelope := fmt.Sprintf(upnpSoapEnvelopeFmt, action, this.serviceType, body.String(), action)
+	req, err := http.NewRequest("POST", this.controlURL, strings.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+this.serviceType+"#"+action+`"`)
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, UPNP_MAX_DESC_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("UPnP action %s failed with status %s", action, resp.Status)
+	}
+	return data, nil
+}
+
+//soapValue return the text of element name in soap response
+func soapValue(data []byte, name string) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("element %s not found in soap response", name)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != name {
+			continue
+		}
+		var value string
+		if err := decoder.DecodeElement(&value, &start); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+//discoverUPnP search internet gateway device by SSDP, return the first one with connection service
+func discoverUPnP() Interface {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	ssdp, err := net.ResolveUDPAddr("udp4", SSDP_ADDR)
+	if err != nil {
+		return nil
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + SSDP_ADDR + "\r\n" +
+		"ST: " + upnpGatewayDevice + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), ssdp); err != nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(DISCOVERY_TIMEOUT)
+	tried := make(map[string]bool)
+	buf := make([]byte, 2048)
+	for time.Now().Before(deadline) {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location == "" || tried[location] {
+			continue
+		}
+		tried[location] = true
+		if client, err := newUPnP(location); err == nil {
+			return client
+		}
+	}
+	return nil
+}
+
+//newUPnP fetch device description from location, and create client of its connection service
+func newUPnP(location string) (*upnp, error) {
+	client := &http.Client{Timeout: UPNP_HTTP_TIMEOUT}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get device description failed with status %s", resp.Status)
+	}
+	root := &upnpRoot{}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, UPNP_MAX_DESC_SIZE)).Decode(root); err != nil {
+		return nil, err
+	}
+	service := findConnectionService(&root.Device)
+	if service == nil {
+		return nil, fmt.Errorf("no connection service in device %s", location)
+	}
+
+	base := root.URLBase
+	if base == "" {
+		base = location
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	controlURL, err := baseURL.Parse(service.ControlURL)
+	if err != nil {
+		return nil, err
+	}
+	localIP, err := localIPTo(controlURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return &upnp{
+		controlURL:  controlURL.String(),
+		serviceType: service.ServiceType,
+		localIP:     localIP,
+		client:      client,
+	}, nil
+}
+
+func findConnectionService(device *upnpDevice) *upnpService {
+	for i := range device.Services {
+		serviceType := device.Services[i].ServiceType
+		if strings.HasPrefix(serviceType, upnpWANIPService) || strings.HasPrefix(serviceType, upnpWANPPPService) {
+			return &device.Services[i]
+		}
+	}
+	for i := range device.Devices {
+		if service := findConnectionService(&device.Devices[i]); service != nil {
+			return service
+		}
+	}
+	return nil
+}
+
+//localIPTo return the local address used to reach host
+func localIPTo(host string) (net.IP, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "80")
+	}
+	conn, err := net.Dial("udp4", host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
@@ -87,12 +87,22 @@ func NewNbrPeers() *NbrPeers {
 func (this *NbrPeers) Broadcast(msg types.Message) {
 	sink := comm.NewZeroCopySink(nil)
 	types.WriteMessage(sink, msg)
+	var compressed []byte
 
 	this.RLock()
 	defer this.RUnlock()
 	for _, node := range this.List {
 		if node.Peer.GetRelay() {
-			go node.Peer.SendRaw(msg.CmdType(), sink.Bytes())
+			raw := sink.Bytes()
+			if node.Peer.SupportCompress() {
+				if compressed == nil {
+					compressedSink := comm.NewZeroCopySink(nil)
+					types.WriteCompressedMessage(compressedSink, msg)
+					compressed = compressedSink.Bytes()
+				}
+				raw = compressed
+			}
+			go node.Peer.SendRaw(msg.CmdType(), raw)
 		}
 	}
 }
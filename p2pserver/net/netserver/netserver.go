@@ -22,15 +22,23 @@ import (
 	"encoding/json"
 	"errors"
 	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/common/log"
+	ctypes "github.com/saveio/themis/core/types"
 	"github.com/saveio/themis/p2pserver/common"
 	"github.com/saveio/themis/p2pserver/connect_controller"
+	msgpack "github.com/saveio/themis/p2pserver/message/msg_pack"
 	"github.com/saveio/themis/p2pserver/message/types"
+	"github.com/saveio/themis/p2pserver/nat"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
 	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/peer_score"
 	"github.com/saveio/themis/p2pserver/protocols"
+	"github.com/saveio/themis/p2pserver/protocols/light_client"
 )
 
 //NewNetServer return the net object in p2p
@@ -58,7 +66,15 @@ func NewNetServer(protocol p2p.Protocol, conf *config.P2PNodeConfig, reserveAddr
 
 	log.Infof("[p2p] init peer ID to %s", info.Id.ToHexString())
 
-	return NewCustomNetServer(keyId, info, protocol, listener, option, nil), nil
+	natm, err := nat.Parse(conf.NAT)
+	if err != nil {
+		return nil, err
+	}
+
+	n := NewCustomNetServer(keyId, info, protocol, listener, option, nil)
+	n.score.LoadBannedPeers(common.BANNED_FILE_NAME)
+	n.nat = natm
+	return n, nil
 }
 
 func NewCustomNetServer(id *common.PeerKeyId, info *peer.PeerInfo, proto p2p.Protocol,
@@ -66,6 +82,14 @@ func NewCustomNetServer(id *common.PeerKeyId, info *peer.PeerInfo, proto p2p.Pro
 	if logger == nil {
 		logger = common.NewGlobalLoggerWrapper()
 	}
+	conf := config.DefConfig.P2PNode
+	score := peer_score.NewPeerScore(conf.PeerBanThreshold, time.Duration(conf.PeerBanTime)*time.Second)
+	if opt.BannedPeers != nil {
+		opt = opt.WithBannedPeers(p2p.CombineAddrFilter(opt.BannedPeers, score))
+	} else {
+		opt = opt.WithBannedPeers(score)
+	}
+	opt = opt.WithPeerScore(score)
 	connCtrl := connect_controller.NewConnectController(info, id, opt, logger)
 
 	n := &NetServer{
@@ -77,7 +101,9 @@ func NewCustomNetServer(id *common.PeerKeyId, info *peer.PeerInfo, proto p2p.Pro
 		stopRecvCh: make(chan bool),
 		connCtrl:   connCtrl,
 		logger:     logger,
+		score:      score,
 	}
+	score.SetBanHandler(n.closeBannedPeers)
 
 	return n
 }
@@ -92,7 +118,10 @@ type NetServer struct {
 
 	connCtrl *connect_controller.ConnectController
 	logger   common.Logger
+	score    *peer_score.PeerScore
+	nat      nat.Interface // nil if port mapping disabled
 
+	natMapped  uint32    // 1 if the listen port is mapped on gateway
 	stopRecvCh chan bool // To stop sync channel
 }
 
@@ -124,11 +153,39 @@ func (this *NetServer) Start() error {
 	go this.startNetAccept(this.listener)
 	this.logger.Infof("[p2p]start listen on sync port %d", this.base.Port)
 	go this.processMessage(this.NetChan, this.stopRecvCh)
+	if this.nat != nil {
+		go this.mapPort()
+	}
 
 	this.logger.Debug("[p2p]MessageRouter start to parse p2p message...")
 	return nil
 }
 
+//mapPort keeps the listen port mapped on gateway, and advertises the external address once mapped
+func (this *NetServer) mapPort() {
+	port := int(this.base.Port)
+	nat.Map(this.nat, this.stopRecvCh, nat.MAP_PROTOCOL_TCP, port, port, nat.MAP_DESCRIPTION, func(ip net.IP, extPort int) {
+		if ip == nil {
+			atomic.StoreUint32(&this.natMapped, 0)
+			return
+		}
+		if extPort != port {
+			this.logger.Warnf("[p2p] gateway mapped port %d to %d, peers may fail to reach %d", port, extPort, port)
+		}
+		atomic.StoreUint32(&this.natMapped, 1)
+		listenAddr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+		this.logger.Info("[p2p] node external address mapped: ", listenAddr)
+		this.connCtrl.SetOwnAddress(listenAddr)
+		this.protocol.HandleSystemMessage(this, p2p.HostAddrDetected{ListenAddr: listenAddr})
+	})
+}
+
+//IsReachable return whether the node accepts connections from peers, which is true if the listen port is
+//mapped on gateway or any inbound connection exists
+func (this *NetServer) IsReachable() bool {
+	return atomic.LoadUint32(&this.natMapped) == 1 || this.connCtrl.InboundsCount() != 0
+}
+
 //GetVersion return self peer`s version
 func (this *NetServer) GetHostInfo() *peer.PeerInfo {
 	return this.base
@@ -181,6 +238,16 @@ func (this *NetServer) Broadcast(msg types.Message) {
 	this.Np.Broadcast(msg)
 }
 
+//BroadcastTx announce the transaction to peers, which fetch it if unknown.
+//Fall back to broadcast the full transaction if transaction gossip is not available
+func (this *NetServer) BroadcastTx(tx *ctypes.Transaction) {
+	if handler, ok := this.protocol.(*protocols.MsgHandler); ok && handler.GetTxGossip() != nil {
+		handler.GetTxGossip().Announce(tx)
+		return
+	}
+	this.Np.Broadcast(msgpack.NewTxn(tx))
+}
+
 //Tx sendMsg data buf to peer
 func (this *NetServer) Send(p *peer.Peer, msg types.Message) error {
 	if p != nil {
@@ -202,6 +269,9 @@ func (this *NetServer) Connect(addr string) {
 func (this *NetServer) connect(addr string) error {
 	peerInfo, conn, err := this.connCtrl.Connect(addr)
 	if err != nil {
+		if errors.Is(err, connect_controller.ErrDialFailed) {
+			this.protocol.HandleSystemMessage(this, p2p.PeerUnreachable{Addr: addr})
+		}
 		if err == connect_controller.ErrHandshakeSelf {
 			this.logger.Info("[p2p] node host address detected: ", this.connCtrl.OwnAddress())
 			this.protocol.HandleSystemMessage(this, p2p.HostAddrDetected{ListenAddr: this.connCtrl.OwnAddress()})
@@ -212,7 +282,7 @@ func (this *NetServer) connect(addr string) error {
 	remotePeer := peer.NewPeer(peerInfo, conn, this.NetChan)
 
 	this.ReplacePeer(remotePeer)
-	go remotePeer.Link.Rx()
+	go this.receive(remotePeer)
 
 	this.protocol.HandleSystemMessage(this, p2p.PeerConnected{Info: remotePeer.Info})
 	return nil
@@ -248,11 +318,37 @@ func (this *NetServer) handleClientConnection(conn net.Conn) error {
 	remotePeer := peer.NewPeer(peerInfo, conn, this.NetChan)
 	this.ReplacePeer(remotePeer)
 
-	go remotePeer.Link.Rx()
+	go this.receive(remotePeer)
 	this.protocol.HandleSystemMessage(this, p2p.PeerConnected{Info: remotePeer.Info})
 	return nil
 }
 
+//receive reads messages of the peer, and reports the peer sending malformed message
+func (this *NetServer) receive(remotePeer *peer.Peer) {
+	err := remotePeer.Link.Rx()
+	if errors.Is(err, types.ErrMalformedMessage) {
+		this.score.ReportPeer(remotePeer, peer_score.MisbehaveMalformedMsg, err.Error())
+	}
+}
+
+//PeerScore return the peer score service shared by all protocols
+func (this *NetServer) PeerScore() *peer_score.PeerScore {
+	return this.score
+}
+
+//closeBannedPeers disconnects the banned neighbor with the ip, or all the neighbors with the ip if id is empty
+func (this *NetServer) closeBannedPeers(ip string, id common.PeerId) {
+	for _, p := range this.Np.GetNeighbors() {
+		if !id.IsEmpty() && p.GetID() != id {
+			continue
+		}
+		if remoteIp, err := common.ParseIPAddr(p.GetAddr()); err == nil && remoteIp == ip {
+			this.logger.Infof("[p2p] disconnect banned peer %s", p.GetAddr())
+			p.Close()
+		}
+	}
+}
+
 //startNetAccept accepts the sync connection from the inbound peer
 func (this *NetServer) startNetAccept(listener net.Listener) {
 	for {
@@ -297,6 +393,16 @@ func (this *NetServer) SendTo(p common.PeerId, msg types.Message) {
 	}
 }
 
+//GetLightClient return the light client protocol, nil if not available
+func (self *NetServer) GetLightClient() *light_client.LightClient {
+	handler, ok := self.protocol.(*protocols.MsgHandler)
+	if !ok {
+		return nil
+	}
+
+	return handler.GetLightClient()
+}
+
 func (self *NetServer) GetSubnetMembersInfo() []common.SubnetMemberInfo {
 	handler, ok := self.protocol.(*protocols.MsgHandler)
 	if !ok {
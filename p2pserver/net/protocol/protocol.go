@@ -75,3 +75,9 @@ type HostAddrDetected struct {
 	implSystemMessage
 	ListenAddr string
 }
+
+//PeerUnreachable is sent when dialing the peer address failed
+type PeerUnreachable struct {
+	implSystemMessage
+	Addr string
+}
@@ -20,9 +20,11 @@
 package p2p
 
 import (
+	ctypes "github.com/saveio/themis/core/types"
 	"github.com/saveio/themis/p2pserver/common"
 	"github.com/saveio/themis/p2pserver/message/types"
 	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/peer_score"
 )
 
 //P2P represent the net interface of p2p package
@@ -40,5 +42,8 @@ type P2P interface {
 	SendTo(p common.PeerId, msg types.Message)
 	GetOutConnRecordLen() uint
 	Broadcast(msg types.Message)
+	BroadcastTx(tx *ctypes.Transaction)
 	IsOwnAddress(addr string) bool
+	IsReachable() bool
+	PeerScore() *peer_score.PeerScore
 }
@@ -31,6 +31,7 @@ import (
 	"github.com/saveio/themis/p2pserver/net/netserver"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
 	"github.com/saveio/themis/p2pserver/protocols"
+	"github.com/saveio/themis/p2pserver/protocols/light_client"
 	"github.com/saveio/themis/p2pserver/protocols/utils"
 )
 
@@ -80,6 +81,11 @@ func (self *P2PServer) Stop() {
 	self.network.Stop()
 }
 
+//GetLightClient return the light client protocol, which fetches transactions, events and storage from peers
+func (self *P2PServer) GetLightClient() *light_client.LightClient {
+	return self.network.GetLightClient()
+}
+
 // GetNetwork returns the low level netserver
 func (self *P2PServer) GetNetwork() p2p.P2P {
 	return self.network
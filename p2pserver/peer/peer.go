@@ -275,10 +275,24 @@ func (this *Peer) GetSoftVersion() string {
 	return this.Info.SoftVersion
 }
 
+//SupportCompress return whether peer supports compressed message and block chunks
+func (this *Peer) SupportCompress() bool {
+	return common.SupportVersion(this.Info.SoftVersion, common.MIN_VERSION_FOR_COMPRESS)
+}
+
+//SupportTxGossip return whether peer fetches the transactions announced in batched inventory
+func (this *Peer) SupportTxGossip() bool {
+	return common.SupportVersion(this.Info.SoftVersion, common.MIN_VERSION_FOR_TX_GOSSIP)
+}
+
 //Send transfer buffer by sync or cons link
 func (this *Peer) Send(msg types.Message) error {
 	sink := comm.NewZeroCopySink(nil)
-	types.WriteMessage(sink, msg)
+	if this.SupportCompress() {
+		types.WriteCompressedMessage(sink, msg)
+	} else {
+		types.WriteMessage(sink, msg)
+	}
 
 	return this.SendRaw(msg.CmdType(), sink.Bytes())
 }
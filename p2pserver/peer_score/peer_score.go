@@ -0,0 +1,385 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package peer_score
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	common2 "github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/p2pserver/common"
+	"github.com/saveio/themis/p2pserver/peer"
+)
+
+const (
+	SCORE_HALF_LIFE   = 10 * time.Minute // misbehavior score of a peer halves in this duration
+	MAX_SCORE_RECORDS = 4096             // decayed records are dropped when records exceed this count
+)
+
+//Misbehavior is the kind of misbehavior reported by protocol handlers
+type Misbehavior uint8
+
+const (
+	MisbehaveInvalidTx        Misbehavior = iota // relayed a transaction failed to verify
+	MisbehaveInvalidBlock                        // responded a header or block failed to verify
+	MisbehaveInvalidConsensus                    // sent a consensus payload failed to verify
+	MisbehaveMalformedMsg                        // sent a message with bad checksum or undecodable payload
+)
+
+var misbehaviorPenalty = map[Misbehavior]float64{
+	MisbehaveInvalidTx:        10,
+	MisbehaveInvalidBlock:     20,
+	MisbehaveInvalidConsensus: 20,
+	MisbehaveMalformedMsg:     25,
+}
+
+func (self Misbehavior) String() string {
+	switch self {
+	case MisbehaveInvalidTx:
+		return "invalid transaction"
+	case MisbehaveInvalidBlock:
+		return "invalid block"
+	case MisbehaveInvalidConsensus:
+		return "invalid consensus message"
+	case MisbehaveMalformedMsg:
+		return "malformed message"
+	default:
+		return fmt.Sprintf("misbehavior(%d)", uint8(self))
+	}
+}
+
+//BannedPeer is an entry of the ban list
+type BannedPeer struct {
+	Ip     string
+	Id     string `json:",omitempty"` // hex id of the banned peer, empty means all the peers of the ip are banned
+	Until  int64  // unix time the ban ends
+	Reason string
+}
+
+//key of the ban entry in ban list
+func (self *BannedPeer) key() string {
+	return banKey(self.Ip, self.Id)
+}
+
+func banKey(ip, id string) string {
+	if id == "" {
+		return ip
+	}
+	return ip + "/" + id
+}
+
+type peerRecord struct {
+	score  float64
+	update time.Time
+}
+
+//PeerScore collects the misbehavior of peers reported by all protocols. The score decays over time, and
+//the peer is banned temporarily when its score reaches the threshold. A misbehaving peer is banned by its id
+//and ip, so the other peers behind the same ip are not affected, the ban by rpc applies to the whole ip
+type PeerScore struct {
+	threshold float64
+	banTime   time.Duration
+
+	lock     sync.Mutex
+	onBan    func(ip string, id common.PeerId)
+	scores   map[common.PeerId]*peerRecord
+	bans     map[string]*BannedPeer // map ip or ip/id => ban entry
+	file     string                 // file to persist the ban list, empty means not persisted
+	saveLock sync.Mutex
+}
+
+//NewPeerScore return a peer score service, threshold 0 disables automatic banning
+func NewPeerScore(threshold uint, banTime time.Duration) *PeerScore {
+	return &PeerScore{
+		threshold: float64(threshold),
+		banTime:   banTime,
+		scores:    make(map[common.PeerId]*peerRecord),
+		bans:      make(map[string]*BannedPeer),
+	}
+}
+
+//SetBanHandler set the handler called when a peer or an ip is banned, used to disconnect the banned peers.
+//The id is empty if all the peers of the ip are banned
+func (this *PeerScore) SetBanHandler(handler func(ip string, id common.PeerId)) {
+	this.lock.Lock()
+	this.onBan = handler
+	this.lock.Unlock()
+}
+
+func decay(score float64, elapsed time.Duration) float64 {
+	return score * math.Pow(0.5, float64(elapsed)/float64(SCORE_HALF_LIFE))
+}
+
+//ReportPeer report the misbehavior of a connected peer
+func (this *PeerScore) ReportPeer(p *peer.Peer, kind Misbehavior, detail string) {
+	if p == nil {
+		return
+	}
+	this.Report(p.GetID(), p.GetAddr(), kind, detail)
+}
+
+//Report add the penalty of misbehavior to the score of peer, and ban the peer if the score reaches threshold
+func (this *PeerScore) Report(id common.PeerId, addr string, kind Misbehavior, detail string) {
+	now := time.Now()
+	this.lock.Lock()
+	rec, ok := this.scores[id]
+	if !ok {
+		if len(this.scores) >= MAX_SCORE_RECORDS {
+			this.pruneScores(now)
+		}
+		rec = &peerRecord{update: now}
+		this.scores[id] = rec
+	}
+	rec.score = decay(rec.score, now.Sub(rec.update)) + misbehaviorPenalty[kind]
+	rec.update = now
+	score := rec.score
+	if this.threshold == 0 || score < this.threshold {
+		this.lock.Unlock()
+		log.Debugf("[p2p] peer %s %s score %.2f: %s", id.ToHexString(), kind, score, detail)
+		return
+	}
+	delete(this.scores, id)
+	this.lock.Unlock()
+
+	reason := fmt.Sprintf("%s: %s", kind, detail)
+	log.Warnf("[p2p] ban peer %s %s for %v, score %.2f, %s", id.ToHexString(), addr, this.banTime, score, reason)
+	if err := this.ban(addr, id, this.banTime, reason); err != nil {
+		log.Warnf("[p2p] ban peer %s error: %s", addr, err)
+	}
+}
+
+//pruneScores drop the records decayed to less than 1, called with lock held
+func (this *PeerScore) pruneScores(now time.Time) {
+	for id, rec := range this.scores {
+		if decay(rec.score, now.Sub(rec.update)) < 1 {
+			delete(this.scores, id)
+		}
+	}
+}
+
+//Score return the current score of peer
+func (this *PeerScore) Score(id common.PeerId) float64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	rec, ok := this.scores[id]
+	if !ok {
+		return 0
+	}
+	return decay(rec.score, time.Since(rec.update))
+}
+
+//parseIp accept the address in format ip or ip:port
+func parseIp(addr string) (string, error) {
+	host := addr
+	if net.ParseIP(addr) == nil {
+		h, err := common.ParseIPAddr(addr)
+		if err != nil {
+			return "", fmt.Errorf("invalid peer address %s", addr)
+		}
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", fmt.Errorf("invalid peer ip %s", host)
+	}
+	return ip.String(), nil
+}
+
+//Ban ban all the peers of the ip of address for the duration
+func (this *PeerScore) Ban(addr string, duration time.Duration, reason string) error {
+	return this.ban(addr, common.PeerId{}, duration, reason)
+}
+
+//ban the peer of id and the ip of address, or the whole ip if id is empty
+func (this *PeerScore) ban(addr string, id common.PeerId, duration time.Duration, reason string) error {
+	ip, err := parseIp(addr)
+	if err != nil {
+		return err
+	}
+	if duration <= 0 {
+		return fmt.Errorf("invalid ban duration %v", duration)
+	}
+	ban := &BannedPeer{
+		Ip:     ip,
+		Until:  time.Now().Add(duration).Unix(),
+		Reason: reason,
+	}
+	if !id.IsEmpty() {
+		ban.Id = id.ToHexString()
+	}
+	this.lock.Lock()
+	this.bans[ban.key()] = ban
+	onBan := this.onBan
+	this.lock.Unlock()
+
+	this.saveBannedPeers()
+	if onBan != nil {
+		onBan(ip, id)
+	}
+	return nil
+}
+
+//Unban lift the bans of the ip of address, including the bans of the peers of the ip, return false if it is not banned
+func (this *PeerScore) Unban(addr string) bool {
+	ip, err := parseIp(addr)
+	if err != nil {
+		return false
+	}
+	lifted := false
+	this.lock.Lock()
+	for key, ban := range this.bans {
+		if ban.Ip == ip {
+			delete(this.bans, key)
+			lifted = true
+		}
+	}
+	this.lock.Unlock()
+	if lifted {
+		this.saveBannedPeers()
+		log.Infof("[p2p] lift ban of peer %s", ip)
+	}
+	return lifted
+}
+
+//IsBanned check whether all the peers of the ip of address are banned
+func (this *PeerScore) IsBanned(addr string) bool {
+	ip, err := parseIp(addr)
+	if err != nil {
+		return false
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.isBanned(ip)
+}
+
+//IsPeerBanned check whether the peer of id and address is banned, either by its id or its ip
+func (this *PeerScore) IsPeerBanned(id common.PeerId, addr string) bool {
+	ip, err := parseIp(addr)
+	if err != nil {
+		return false
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.isBanned(ip) || this.isBanned(banKey(ip, id.ToHexString()))
+}
+
+//isBanned check the ban entry of key and lift the expired ban, called with lock held
+func (this *PeerScore) isBanned(key string) bool {
+	ban, ok := this.bans[key]
+	if !ok {
+		return false
+	}
+	if time.Now().Unix() >= ban.Until {
+		delete(this.bans, key)
+		return false
+	}
+	return true
+}
+
+//Contains implements p2p.AddressFilter, the connect controller refuses the banned addresses
+func (this *PeerScore) Contains(addr string) bool {
+	return this.IsBanned(addr)
+}
+
+//GetBannedPeers return the ban list sorted by ip and id
+func (this *PeerScore) GetBannedPeers() []*BannedPeer {
+	now := time.Now().Unix()
+	this.lock.Lock()
+	banned := make([]*BannedPeer, 0, len(this.bans))
+	for key, ban := range this.bans {
+		if now >= ban.Until {
+			delete(this.bans, key)
+			continue
+		}
+		b := *ban
+		banned = append(banned, &b)
+	}
+	this.lock.Unlock()
+	sort.Slice(banned, func(i, j int) bool {
+		return banned[i].key() < banned[j].key()
+	})
+	return banned
+}
+
+func (this *PeerScore) saveBannedPeers() {
+	this.lock.Lock()
+	file := this.file
+	this.lock.Unlock()
+	if file == "" {
+		return
+	}
+	this.saveLock.Lock()
+	defer this.saveLock.Unlock()
+	buf, err := json.Marshal(this.GetBannedPeers())
+	if err != nil {
+		log.Warn("[p2p]package banned peers fail: ", err)
+		return
+	}
+	err = ioutil.WriteFile(file, buf, os.ModePerm)
+	if err != nil {
+		log.Warn("[p2p]write banned peers fail: ", err)
+	}
+}
+
+//LoadBannedPeers loads the ban list from file, and persists the ban list to the file since then
+func (this *PeerScore) LoadBannedPeers(file string) {
+	this.lock.Lock()
+	this.file = file
+	this.lock.Unlock()
+	if !common2.FileExisted(file) {
+		return
+	}
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Warnf("[p2p]read %s fail: %s", file, err)
+		return
+	}
+	var banned []*BannedPeer
+	if err = json.Unmarshal(buf, &banned); err != nil {
+		log.Warn("[p2p]parse banned peers file fail: ", err)
+		return
+	}
+	now := time.Now().Unix()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, ban := range banned {
+		if ban == nil || now >= ban.Until {
+			continue
+		}
+		ip, err := parseIp(ban.Ip)
+		if err != nil {
+			continue
+		}
+		if ban.Id != "" {
+			if _, err := common.PeerIdFromHexString(ban.Id); err != nil {
+				continue
+			}
+		}
+		ban.Ip = ip
+		this.bans[ban.key()] = ban
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package peer_score
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/saveio/themis/p2pserver/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecay(t *testing.T) {
+	assert.Equal(t, 100.0, decay(100, 0))
+	assert.InDelta(t, 50.0, decay(100, SCORE_HALF_LIFE), 1e-9)
+	assert.InDelta(t, 25.0, decay(100, 2*SCORE_HALF_LIFE), 1e-9)
+}
+
+func TestReportAndBan(t *testing.T) {
+	score := NewPeerScore(50, time.Hour)
+	var closed []string
+	score.SetBanHandler(func(ip string, id common.PeerId) {
+		closed = append(closed, ip+"/"+id.ToHexString())
+	})
+	id, other := common.PseudoPeerIdFromUint64(1), common.PseudoPeerIdFromUint64(2)
+	addr := "192.168.1.2:20338"
+
+	score.Report(id, addr, MisbehaveInvalidBlock, "test")
+	score.Report(id, addr, MisbehaveInvalidBlock, "test")
+	assert.InDelta(t, 40.0, score.Score(id), 0.1)
+	assert.False(t, score.IsPeerBanned(id, addr))
+
+	//decayed score
+	score.scores[id].update = time.Now().Add(-SCORE_HALF_LIFE)
+	assert.InDelta(t, 20.0, score.Score(id), 0.1)
+
+	score.Report(id, addr, MisbehaveMalformedMsg, "test")
+	assert.False(t, score.IsPeerBanned(id, addr))
+	score.Report(id, addr, MisbehaveInvalidConsensus, "test")
+	assert.True(t, score.IsPeerBanned(id, addr))
+	assert.True(t, score.IsPeerBanned(id, "192.168.1.2:20339"))
+	assert.False(t, score.IsPeerBanned(id, "192.168.1.3:20338"))
+	//the other peers behind the ip are not banned
+	assert.False(t, score.IsPeerBanned(other, addr))
+	assert.False(t, score.Contains(addr))
+	assert.Equal(t, []string{"192.168.1.2/" + id.ToHexString()}, closed)
+	assert.Equal(t, 0.0, score.Score(id))
+	banned := score.GetBannedPeers()
+	assert.Equal(t, 1, len(banned))
+	assert.Equal(t, id.ToHexString(), banned[0].Id)
+
+	//ban by rpc applies to all the peers of the ip
+	assert.Nil(t, score.Ban("192.168.1.2", time.Hour, "test"))
+	assert.True(t, score.Contains(addr))
+	assert.True(t, score.IsPeerBanned(other, addr))
+	assert.Equal(t, 2, len(score.GetBannedPeers()))
+
+	assert.True(t, score.Unban(addr))
+	assert.False(t, score.Unban(addr))
+	assert.False(t, score.Contains(addr))
+	assert.False(t, score.IsPeerBanned(id, addr))
+}
+
+func TestBanDisabled(t *testing.T) {
+	score := NewPeerScore(0, time.Hour)
+	id := common.PseudoPeerIdFromUint64(1)
+	for i := 0; i < 100; i++ {
+		score.Report(id, "10.0.0.1:20338", MisbehaveMalformedMsg, "test")
+	}
+	assert.False(t, score.Contains("10.0.0.1:20338"))
+}
+
+func TestBanExpireAndPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peer_score")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, common.BANNED_FILE_NAME)
+
+	score := NewPeerScore(100, time.Hour)
+	score.LoadBannedPeers(file)
+	assert.NotNil(t, score.Ban("invalid", time.Hour, "test"))
+	assert.NotNil(t, score.Ban("10.0.0.1", 0, "test"))
+	assert.Nil(t, score.Ban("10.0.0.1", time.Hour, "test"))
+	assert.Nil(t, score.Ban("10.0.0.3", time.Hour, "test"))
+	score.bans["10.0.0.3"].Until = time.Now().Unix() - 1
+	assert.Nil(t, score.Ban("10.0.0.2:20338", time.Hour, "test"))
+	assert.False(t, score.Contains("10.0.0.3:20338"))
+
+	banned := score.GetBannedPeers()
+	assert.Equal(t, 2, len(banned))
+	assert.Equal(t, "10.0.0.1", banned[0].Ip)
+	assert.Equal(t, "10.0.0.2", banned[1].Ip)
+
+	restored := NewPeerScore(100, time.Hour)
+	restored.LoadBannedPeers(file)
+	assert.True(t, restored.Contains("10.0.0.1:20338"))
+	assert.True(t, restored.Contains("10.0.0.2:20339"))
+	assert.False(t, restored.Contains("10.0.0.3:20338"))
+
+	assert.Nil(t, score.ban("10.0.0.4", common.PseudoPeerIdFromUint64(1), time.Hour, "test"))
+	restored = NewPeerScore(100, time.Hour)
+	restored.LoadBannedPeers(file)
+	assert.True(t, restored.IsPeerBanned(common.PseudoPeerIdFromUint64(1), "10.0.0.4:20338"))
+	assert.False(t, restored.IsPeerBanned(common.PseudoPeerIdFromUint64(2), "10.0.0.4:20338"))
+
+	assert.True(t, restored.Unban("10.0.0.1"))
+	restored = NewPeerScore(100, time.Hour)
+	restored.LoadBannedPeers(file)
+	assert.False(t, restored.Contains("10.0.0.1:20338"))
+	assert.True(t, restored.Contains("10.0.0.2:20338"))
+}
@@ -19,7 +19,10 @@
 package block_sync
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"runtime"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -28,17 +31,21 @@ import (
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/core/ledger"
+	scom "github.com/saveio/themis/core/store/common"
 	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/core/validation"
 	p2pComm "github.com/saveio/themis/p2pserver/common"
 	msgpack "github.com/saveio/themis/p2pserver/message/msg_pack"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
 	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/peer_score"
 )
 
 const (
 	SYNC_MAX_HEADER_FORWARD_SIZE = 5000            //keep CurrentHeaderHeight - CurrentBlockHeight <= SYNC_MAX_HEADER_FORWARD_SIZE
 	SYNC_MAX_FLIGHT_HEADER_SIZE  = 1               //Number of headers on flight
-	SYNC_MAX_FLIGHT_BLOCK_SIZE   = 50              //Number of blocks on flight
+	SYNC_MAX_FLIGHT_BLOCK_SIZE   = 128             //Number of blocks on flight
 	SYNC_MAX_BLOCK_CACHE_SIZE    = 500             //Cache size of block wait to commit to ledger
 	SYNC_HEADER_REQUEST_TIMEOUT  = 2 * time.Second //s, Request header timeout time. If header haven't receive after SYNC_HEADER_REQUEST_TIMEOUT second, retry
 	SYNC_BLOCK_REQUEST_TIMEOUT   = 2 * time.Second //s, Request block timeout time. If block haven't received after SYNC_BLOCK_REQUEST_TIMEOUT second, retry
@@ -49,8 +56,16 @@ const (
 	SYNC_NODE_SPEED_INIT         = 100 * 1024      //Init a big speed (100MB/s) for every node in first round
 	SYNC_MAX_ERROR_RESP_TIMES    = 5               //Max error headers/blocks response times, if reaches, delete it
 	SYNC_MAX_HEIGHT_OFFSET       = 5               //Offset of the max height and current height
+	SYNC_MAX_CHUNKED_BLOCKS      = 50              //Number of blocks being assembled from chunks
+	SYNC_BLOCK_WINDOW_SIZE       = 16              //Number of continuous blocks requested from the same node, windows are spread over nodes
+
+	SYNC_MAX_CHUNKED_BYTES       = 64 * 1024 * 1024 //Total bytes of chunks being assembled, the oldest assembling block is dropped if exceeded
+	SYNC_MAX_REQUESTED_BLOCKS    = 128              //Number of blocks requested outside block sync, their chunks are accepted
+	SYNC_REQUESTED_BLOCK_TIMEOUT = 10 * time.Second //Chunks of the block requested outside block sync are accepted within the timeout
 )
 
+const SYNC_STATS_INTERVAL = 10 * time.Second //Interval of sampling the sync speed
+
 //NodeWeight record some params of node, using for sort
 type NodeWeight struct {
 	id           p2pComm.PeerId //NodeID
@@ -236,6 +251,20 @@ type BlockInfo struct {
 	merkleRoot    common.Uint256
 }
 
+//chunkedBlockKey identify the block assembling from the chunks of a node
+type chunkedBlockKey struct {
+	hash   common.Uint256
+	nodeId p2pComm.PeerId
+}
+
+//chunkedBlock is used for assembling the block transferred in chunks
+type chunkedBlock struct {
+	chunks   [][]byte
+	received uint32
+	size     uint64
+	lastTime int64 //The time last chunk received, the flight of streaming block is not timeout
+}
+
 //BlockSyncMgr is the manager class to deal with block sync
 type BlockSyncMgr struct {
 	flightBlocks   map[common.Uint256][]*SyncFlightInfo //Map BlockHash => []SyncFlightInfo, using for manager all of those block flights
@@ -249,6 +278,40 @@ type BlockSyncMgr struct {
 	ledger         *ledger.Ledger                       //ledger
 	lock           sync.RWMutex                         //lock
 	nodeWeights    map[p2pComm.PeerId]*NodeWeight       //Map NodeID => NodeStatus, using for getNextNode
+	blockPaused    int32                                //Block sync is paused while state snapshot syncing, headers are still synced
+	chunkedBlocks  map[chunkedBlockKey]*chunkedBlock    //Blocks being assembled from chunks, chunks of different blocks are received in pipeline
+	chunkedBytes   uint64                               //Total bytes of the chunks being assembled
+	reqBlocks      map[chunkedBlockKey]int64            //Blocks requested outside block sync => request time, chunks are only accepted for requested blocks
+	verifying      map[uint32]bool                      //Map BlockHeight => true, blocks received and verifying signatures
+	verifySem      chan struct{}                        //Limit the blocks verifying concurrently
+	stats          syncStats                            //Throughput of block sync
+}
+
+//syncStats count the throughput of block sync
+type syncStats struct {
+	downloadedBlocks uint64
+	downloadedBytes  uint64
+	verifiedBlocks   uint64
+	savedBlocks      uint64
+
+	lock          sync.Mutex
+	lastSample    time.Time
+	lastBytes     uint64
+	lastSaved     uint64
+	downloadSpeed float64
+	saveSpeed     float64
+}
+
+//SyncStats is the snapshot of block sync throughput
+type SyncStats struct {
+	DownloadedBlocks uint64  //Blocks received from net
+	DownloadedBytes  uint64  //Bytes of the blocks received from net
+	VerifiedBlocks   uint64  //Blocks passed signature verification
+	SavedBlocks      uint64  //Blocks saved to ledger
+	FlightBlocks     int     //Blocks requested and waiting for response
+	CachedBlocks     int     //Blocks waiting for saving to ledger
+	DownloadSpeed    float64 //kB/s of block download in last sampling interval
+	SaveSpeed        float64 //Blocks per second saved to ledger in last sampling interval
 }
 
 //NewBlockSyncMgr return a BlockSyncMgr instance
@@ -261,6 +324,11 @@ func NewBlockSyncMgr(server p2p.P2P, ld *ledger.Ledger) *BlockSyncMgr {
 		ledger:        ld,
 		exitCh:        make(chan interface{}, 1),
 		nodeWeights:   make(map[p2pComm.PeerId]*NodeWeight),
+		chunkedBlocks: make(map[chunkedBlockKey]*chunkedBlock),
+		reqBlocks:     make(map[chunkedBlockKey]int64),
+		verifying:     make(map[uint32]bool),
+		verifySem:     make(chan struct{}, runtime.NumCPU()),
+		stats:         syncStats{lastSample: time.Now()},
 	}
 }
 
@@ -349,6 +417,7 @@ func (this *BlockSyncMgr) Start() {
 		case <-this.exitCh:
 			return
 		case <-ticker.C:
+			this.sampleStats()
 			go this.checkTimeout()
 			go this.sync()
 			go this.saveBlock()
@@ -365,6 +434,7 @@ func (this *BlockSyncMgr) checkTimeout() {
 	now := time.Now().UnixNano()
 	headerTimeoutFlights := make(map[uint32]*SyncFlightInfo)
 	blockTimeoutFlights := make(map[common.Uint256][]*SyncFlightInfo)
+	this.clearStaleChunkedBlocks(now)
 	this.lock.RLock()
 	for height, flightInfo := range this.flightHeaders {
 		if timeDiff(now, flightInfo.GetStartTime()) >= SYNC_HEADER_REQUEST_TIMEOUT {
@@ -373,9 +443,14 @@ func (this *BlockSyncMgr) checkTimeout() {
 	}
 	for blockHash, flightInfos := range this.flightBlocks {
 		for _, flightInfo := range flightInfos {
-			if timeDiff(now, flightInfo.GetStartTime()) >= SYNC_BLOCK_REQUEST_TIMEOUT {
-				blockTimeoutFlights[blockHash] = append(blockTimeoutFlights[blockHash], flightInfo)
+			if timeDiff(now, flightInfo.GetStartTime()) < SYNC_BLOCK_REQUEST_TIMEOUT {
+				continue
+			}
+			cb := this.chunkedBlocks[chunkedBlockKey{hash: blockHash, nodeId: flightInfo.GetNodeId()}]
+			if cb != nil && timeDiff(now, cb.lastTime) < SYNC_BLOCK_REQUEST_TIMEOUT {
+				continue
 			}
+			blockTimeoutFlights[blockHash] = append(blockTimeoutFlights[blockHash], flightInfo)
 		}
 	}
 	this.lock.RUnlock()
@@ -457,7 +532,7 @@ func (this *BlockSyncMgr) syncHeader() {
 
 	curHeaderHeight := this.ledger.GetCurrentHeaderHeight()
 	//Waiting for block catch up header
-	if curHeaderHeight-curBlockHeight >= SYNC_MAX_HEADER_FORWARD_SIZE {
+	if !this.IsBlockSyncPaused() && curHeaderHeight-curBlockHeight >= SYNC_MAX_HEADER_FORWARD_SIZE {
 		return
 	}
 	NextHeaderId := curHeaderHeight + 1
@@ -480,6 +555,9 @@ func (this *BlockSyncMgr) syncHeader() {
 }
 
 func (this *BlockSyncMgr) syncBlock() {
+	if this.IsBlockSyncPaused() {
+		return
+	}
 	if this.tryGetSyncBlockLock() {
 		return
 	}
@@ -503,6 +581,7 @@ func (this *BlockSyncMgr) syncBlock() {
 		count = cacheCap
 	}
 
+	nodes := this.getSyncNodes()
 	counter := 1
 	i := uint32(0)
 	reqTimes := 1
@@ -524,14 +603,20 @@ func (this *BlockSyncMgr) syncBlock() {
 				continue
 			}
 		}
-		if this.isInBlockCache(nextBlockHeight) {
+		if this.isBlockReceived(nextBlockHeight) {
 			continue
 		}
 		if nextBlockHeight <= curBlockHeight+SYNC_NEXT_BLOCKS_HEIGHT {
 			reqTimes = SYNC_NEXT_BLOCK_TIMES
 		}
+		if reqTimes > len(nodes) {
+			reqTimes = len(nodes)
+		}
+		if reqTimes == 0 {
+			return
+		}
 		for t := 0; t < reqTimes; t++ {
-			reqNode := this.getNextNode(nextBlockHeight)
+			reqNode := getWindowNode(nodes, nextBlockHeight, t)
 			if reqNode == nil {
 				return
 			}
@@ -618,6 +703,8 @@ func (this *BlockSyncMgr) OnBlockReceive(fromID p2pComm.PeerId, blockSize uint32
 	height := block.Header.Height
 	blockHash := block.Hash()
 	log.Tracef("[block-sync] OnBlockReceive Height:%d", height)
+	atomic.AddUint64(&this.stats.downloadedBlocks, 1)
+	atomic.AddUint64(&this.stats.downloadedBytes, uint64(blockSize))
 	flightInfo := this.getFlightBlock(blockHash, fromID)
 	if flightInfo != nil {
 		t := (time.Now().UnixNano() - flightInfo.GetStartTime()) / int64(time.Millisecond)
@@ -636,11 +723,254 @@ func (this *BlockSyncMgr) OnBlockReceive(fromID p2pComm.PeerId, blockSize uint32
 		return
 	}
 
-	this.addBlockCache(fromID, block, ccMsg, merkleRoot)
-	go this.saveBlock()
+	if !this.addVerifyingBlock(height) {
+		return
+	}
+	go this.verifyBlock(fromID, block, ccMsg, merkleRoot)
 	this.syncBlock()
 }
 
+//verifyBlock check the transaction signatures of the block and put it in cache for saving.
+//Blocks are verified concurrently while the former blocks are executing
+func (this *BlockSyncMgr) verifyBlock(fromID p2pComm.PeerId, block *types.Block, ccMsg *types.CrossChainMsg,
+	merkleRoot common.Uint256) {
+	height := block.Header.Height
+	this.verifySem <- struct{}{}
+	err := verifyBlockSignatures(block)
+	<-this.verifySem
+	if err != nil {
+		this.delVerifyingBlock(height)
+		log.Warnf("[block-sync] verifyBlock Height:%d from:%s error:%s", height, fromID.ToHexString(), err)
+		this.addErrorRespCnt(fromID)
+		return
+	}
+	atomic.AddUint64(&this.stats.verifiedBlocks, 1)
+	this.lock.Lock()
+	delete(this.verifying, height)
+	this.blocksCache.addBlock(fromID, block, ccMsg, merkleRoot)
+	this.lock.Unlock()
+	this.saveBlock()
+}
+
+//verifyBlockSignatures verify the transaction signatures, the signed addresses are also
+//cached in transactions, so that they are not calculated again when executing
+func verifyBlockSignatures(block *types.Block) error {
+	for _, tx := range block.Transactions {
+		if err := validation.VerifyTransactionSignatures(tx); err != nil {
+			txHash := tx.Hash()
+			return fmt.Errorf("transaction %s: %s", txHash.ToHexString(), err)
+		}
+	}
+	return nil
+}
+
+//addVerifyingBlock mark the block of height verifying, return false if the block has been received
+func (this *BlockSyncMgr) addVerifyingBlock(height uint32) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.verifying[height] || this.blocksCache.isInBlockCache(height) {
+		return false
+	}
+	this.verifying[height] = true
+	return true
+}
+
+func (this *BlockSyncMgr) delVerifyingBlock(height uint32) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.verifying, height)
+}
+
+//isBlockReceived return whether the block is verifying or waiting for saving
+func (this *BlockSyncMgr) isBlockReceived(height uint32) bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.verifying[height] || this.blocksCache.isInBlockCache(height)
+}
+
+//sampleStats update the sync speed every SYNC_STATS_INTERVAL
+func (this *BlockSyncMgr) sampleStats() {
+	s := &this.stats
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elapsed := time.Since(s.lastSample)
+	if elapsed < SYNC_STATS_INTERVAL {
+		return
+	}
+	bytes := atomic.LoadUint64(&s.downloadedBytes)
+	saved := atomic.LoadUint64(&s.savedBlocks)
+	s.downloadSpeed = float64(bytes-s.lastBytes) / 1024 / elapsed.Seconds()
+	s.saveSpeed = float64(saved-s.lastSaved) / elapsed.Seconds()
+	s.lastSample, s.lastBytes, s.lastSaved = time.Now(), bytes, saved
+}
+
+//GetSyncStats return the throughput of block sync
+func (this *BlockSyncMgr) GetSyncStats() *SyncStats {
+	stats := &SyncStats{
+		DownloadedBlocks: atomic.LoadUint64(&this.stats.downloadedBlocks),
+		DownloadedBytes:  atomic.LoadUint64(&this.stats.downloadedBytes),
+		VerifiedBlocks:   atomic.LoadUint64(&this.stats.verifiedBlocks),
+		SavedBlocks:      atomic.LoadUint64(&this.stats.savedBlocks),
+		FlightBlocks:     this.getFlightBlockCount(),
+	}
+	this.lock.RLock()
+	stats.CachedBlocks = len(this.blocksCache.blocksCache)
+	this.lock.RUnlock()
+	this.stats.lock.Lock()
+	stats.DownloadSpeed = this.stats.downloadSpeed
+	stats.SaveSpeed = this.stats.saveSpeed
+	this.stats.lock.Unlock()
+	return stats
+}
+
+// OnBlockChunkReceive receive block chunk from net, return the block and its size when all chunks received
+func (this *BlockSyncMgr) OnBlockChunkReceive(fromID p2pComm.PeerId, chunk *msgTypes.BlockChunk) (*msgTypes.Block, uint32) {
+	key := chunkedBlockKey{hash: chunk.Hash, nodeId: fromID}
+	this.lock.Lock()
+	if !this.isBlockRequested(key) {
+		this.lock.Unlock()
+		log.Debugf("[block-sync] OnBlockChunkReceive drop chunk of unrequested block:%s from:%s",
+			chunk.Hash.ToHexString(), fromID.ToHexString())
+		return nil, 0
+	}
+	cb, ok := this.chunkedBlocks[key]
+	if !ok {
+		if len(this.chunkedBlocks) >= SYNC_MAX_CHUNKED_BLOCKS {
+			this.lock.Unlock()
+			log.Debugf("[block-sync] OnBlockChunkReceive too many chunked blocks, drop chunk of block:%s",
+				chunk.Hash.ToHexString())
+			return nil, 0
+		}
+		cb = &chunkedBlock{chunks: make([][]byte, chunk.Total)}
+		this.chunkedBlocks[key] = cb
+	}
+	if uint32(len(cb.chunks)) != chunk.Total || cb.chunks[chunk.Index] != nil {
+		this.lock.Unlock()
+		return nil, 0
+	}
+	cb.chunks[chunk.Index] = chunk.Data
+	cb.received++
+	cb.size += uint64(len(chunk.Data))
+	cb.lastTime = time.Now().UnixNano()
+	this.chunkedBytes += uint64(len(chunk.Data))
+	if cb.size > p2pComm.MAX_PAYLOAD_LEN {
+		this.delChunkedBlock(key)
+		this.lock.Unlock()
+		log.Warnf("[block-sync] OnBlockChunkReceive block:%s from:%s too large", chunk.Hash.ToHexString(), fromID.ToHexString())
+		this.addErrorRespCnt(fromID)
+		return nil, 0
+	}
+	this.evictChunkedBlocks()
+	if cb.received < chunk.Total || this.chunkedBlocks[key] != cb {
+		this.lock.Unlock()
+		return nil, 0
+	}
+	this.delChunkedBlock(key)
+	delete(this.reqBlocks, key)
+	this.lock.Unlock()
+
+	data := make([]byte, 0, cb.size)
+	for _, c := range cb.chunks {
+		data = append(data, c...)
+	}
+	block := &msgTypes.Block{}
+	err := block.Deserialization(common.NewZeroCopySource(data))
+	if err != nil || block.Blk.Hash() != chunk.Hash {
+		log.Warnf("[block-sync] OnBlockChunkReceive invalid block:%s from:%s", chunk.Hash.ToHexString(), fromID.ToHexString())
+		this.addErrorRespCnt(fromID)
+		return nil, 0
+	}
+	return block, uint32(cb.size)
+}
+
+//OnBlockRequested record the block requested from the node outside block sync, so that its chunks are accepted
+func (this *BlockSyncMgr) OnBlockRequested(nodeId p2pComm.PeerId, blockHash common.Uint256) {
+	key := chunkedBlockKey{hash: blockHash, nodeId: nodeId}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, ok := this.reqBlocks[key]; !ok && len(this.reqBlocks) >= SYNC_MAX_REQUESTED_BLOCKS {
+		var oldest chunkedBlockKey
+		oldestTime := int64(math.MaxInt64)
+		for k, t := range this.reqBlocks {
+			if t < oldestTime {
+				oldest, oldestTime = k, t
+			}
+		}
+		delete(this.reqBlocks, oldest)
+	}
+	this.reqBlocks[key] = time.Now().UnixNano()
+}
+
+//isBlockRequested return whether the block is in flight from the node, caller should hold the lock
+func (this *BlockSyncMgr) isBlockRequested(key chunkedBlockKey) bool {
+	if _, ok := this.reqBlocks[key]; ok {
+		return true
+	}
+	for _, flightInfo := range this.flightBlocks[key.hash] {
+		if flightInfo.GetNodeId() == key.nodeId {
+			return true
+		}
+	}
+	return false
+}
+
+//delChunkedBlock remove the chunked block, caller should hold the lock
+func (this *BlockSyncMgr) delChunkedBlock(key chunkedBlockKey) {
+	if cb, ok := this.chunkedBlocks[key]; ok {
+		this.chunkedBytes -= cb.size
+		delete(this.chunkedBlocks, key)
+	}
+}
+
+//evictChunkedBlocks drop the chunked blocks receiving chunk least recently until the total bytes under
+//SYNC_MAX_CHUNKED_BYTES, caller should hold the lock
+func (this *BlockSyncMgr) evictChunkedBlocks() {
+	for this.chunkedBytes > SYNC_MAX_CHUNKED_BYTES {
+		var oldest chunkedBlockKey
+		oldestTime := int64(math.MaxInt64)
+		for key, cb := range this.chunkedBlocks {
+			if cb.lastTime < oldestTime {
+				oldest, oldestTime = key, cb.lastTime
+			}
+		}
+		log.Debugf("[block-sync] evict chunked block:%s from:%s", oldest.hash.ToHexString(), oldest.nodeId.ToHexString())
+		this.delChunkedBlock(oldest)
+	}
+}
+
+//clearStaleChunkedBlocks remove the chunked blocks no longer receiving chunks and the expired block requests
+func (this *BlockSyncMgr) clearStaleChunkedBlocks(now int64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for key, cb := range this.chunkedBlocks {
+		if timeDiff(now, cb.lastTime) >= 2*SYNC_BLOCK_REQUEST_TIMEOUT {
+			this.delChunkedBlock(key)
+		}
+	}
+	for key, reqTime := range this.reqBlocks {
+		if _, ok := this.chunkedBlocks[key]; !ok && timeDiff(now, reqTime) >= SYNC_REQUESTED_BLOCK_TIMEOUT {
+			delete(this.reqBlocks, key)
+		}
+	}
+}
+
+//PauseBlockSync stop requesting and saving blocks, headers are still synced
+func (this *BlockSyncMgr) PauseBlockSync() {
+	atomic.StoreInt32(&this.blockPaused, 1)
+}
+
+//ResumeBlockSync continue block sync from current block height
+func (this *BlockSyncMgr) ResumeBlockSync() {
+	atomic.StoreInt32(&this.blockPaused, 0)
+	this.clearBlocks(this.ledger.GetCurrentBlockHeight())
+	go this.sync()
+}
+
+//IsBlockSyncPaused return whether block sync is paused
+func (this *BlockSyncMgr) IsBlockSyncPaused() bool {
+	return atomic.LoadInt32(&this.blockPaused) == 1
+}
+
 //OnAddPeer to node list when a new node added
 func (this *BlockSyncMgr) OnAddNode(nodeId p2pComm.PeerId) {
 	log.Debugf("[block-sync] OnAddNode:%s", nodeId.ToHexString())
@@ -735,6 +1065,9 @@ func (this *BlockSyncMgr) releaseSaveBlockLock() {
 }
 
 func (this *BlockSyncMgr) saveBlock() {
+	if this.IsBlockSyncPaused() {
+		return
+	}
 	if this.tryGetSaveBlockLock() {
 		return
 	}
@@ -742,13 +1075,25 @@ func (this *BlockSyncMgr) saveBlock() {
 	curBlockHeight := this.ledger.GetCurrentBlockHeight()
 	nextBlockHeight := curBlockHeight + 1
 	this.clearBlocks(curBlockHeight)
+	//the execution of next block is overlapped with the commit of current block,
+	//wait the last block committed before leaving, so the current block height is up to date
+	defer func() {
+		if err := this.ledger.WaitBlockCommitted(); err != nil {
+			log.Errorf("[block-sync] saveBlock commit error:%s", err)
+		}
+	}()
 	for {
 		fromID, nextBlock, ccMsg, merkleRoot := this.getBlockCache(nextBlockHeight)
 		if nextBlock == nil {
 			return
 		}
-		err := this.ledger.AddBlock(nextBlock, ccMsg, merkleRoot)
+		err := this.ledger.AddBlockPipelined(nextBlock, ccMsg, merkleRoot)
 		this.delBlockCache(nextBlockHeight)
+		if errors.Is(err, scom.ErrCommitBlock) {
+			//the block is not saved for local store failure, it is not the fault of the sender
+			log.Errorf("[block-sync] saveBlock Height:%d commit error:%s", nextBlockHeight, err)
+			return
+		}
 		if err != nil {
 			this.addErrorRespCnt(fromID)
 			n := this.getNodeWeight(fromID)
@@ -771,6 +1116,7 @@ func (this *BlockSyncMgr) saveBlock() {
 			}
 			return
 		}
+		atomic.AddUint64(&this.stats.savedBlocks, 1)
 		nextBlockHeight++
 		this.pingOutsyncNodes(nextBlockHeight - 1)
 	}
@@ -908,6 +1254,36 @@ func (this *BlockSyncMgr) getNextNode(nextBlockHeight uint32) *peer.Peer {
 	}
 }
 
+//getSyncNodes return the connected nodes sorted by weight
+func (this *BlockSyncMgr) getSyncNodes() []*peer.Peer {
+	weights := this.getAllNodeWeights()
+	sort.Sort(sort.Reverse(weights))
+	nodes := make([]*peer.Peer, 0, len(weights))
+	for _, w := range weights {
+		if n := this.server.GetPeer(w.id); n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+//getWindowNode pick the node to request the block of height. Continuous blocks in the same window are
+//requested from the same node and the windows are spread over nodes, so blocks are downloaded from many
+//nodes in parallel. offset picks another node for the duplicated requests of the next blocks
+func getWindowNode(nodes []*peer.Peer, height uint32, offset int) *peer.Peer {
+	cands := make([]*peer.Peer, 0, len(nodes))
+	for _, n := range nodes {
+		if height <= uint32(n.GetHeight()) {
+			cands = append(cands, n)
+		}
+	}
+	if len(cands) == 0 {
+		return nil
+	}
+	index := (int(height/SYNC_BLOCK_WINDOW_SIZE) + offset) % len(cands)
+	return cands[index]
+}
+
 func (this *BlockSyncMgr) getNodeWithMinFailedTimes(flightInfo *SyncFlightInfo, curBlockHeight uint32) *peer.Peer {
 	var minFailedTimes = math.MaxInt64
 	var minFailedTimesNode *peer.Peer
@@ -964,12 +1340,16 @@ func (this *BlockSyncMgr) addTimeoutCnt(nodeId p2pComm.PeerId) {
 	}
 }
 
-//addErrorRespCnt incre a node's error resp count
+//addErrorRespCnt incre a node's error resp count, and reports the node responding invalid header or block
 func (this *BlockSyncMgr) addErrorRespCnt(nodeId p2pComm.PeerId) {
 	n := this.getNodeWeight(nodeId)
 	if n != nil {
 		n.AddErrorRespCnt()
 	}
+	if this.server != nil {
+		this.server.PeerScore().ReportPeer(this.server.GetPeer(nodeId), peer_score.MisbehaveInvalidBlock,
+			"invalid block sync response")
+	}
 }
 
 //appendReqTime append a node's request time
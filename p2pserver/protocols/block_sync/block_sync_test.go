@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package block_sync
+
+import (
+	"testing"
+
+	"github.com/saveio/themis/core/types"
+	p2pComm "github.com/saveio/themis/p2pserver/common"
+	msgpack "github.com/saveio/themis/p2pserver/message/msg_pack"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
+	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newChunkedBlock(height uint32, payloadSize int) *msgTypes.Block {
+	header := &types.Header{Height: height, ConsensusPayload: make([]byte, payloadSize)}
+	return &msgTypes.Block{Blk: &types.Block{Header: header}}
+}
+
+func TestOnBlockChunkReceive(t *testing.T) {
+	syncMgr := NewBlockSyncMgr(nil, nil)
+	nodeA, nodeB := p2pComm.PseudoPeerIdFromUint64(1), p2pComm.PseudoPeerIdFromUint64(2)
+
+	blk1 := newChunkedBlock(1, 3*p2pComm.BLOCK_CHUNK_SIZE)
+	blk2 := newChunkedBlock(2, 2*p2pComm.BLOCK_CHUNK_SIZE)
+	chunks1 := msgpack.NewBlockChunks(blk1)
+	chunks2 := msgpack.NewBlockChunks(blk2)
+	assert.Equal(t, 4, len(chunks1))
+	assert.Equal(t, 3, len(chunks2))
+
+	// chunks of unrequested block or from other node are dropped
+	block, _ := syncMgr.OnBlockChunkReceive(nodeA, chunks1[0])
+	assert.Nil(t, block)
+	assert.Equal(t, 0, len(syncMgr.chunkedBlocks))
+	syncMgr.addFlightBlock(nodeB, 2, blk2.Blk.Hash())
+	block, _ = syncMgr.OnBlockChunkReceive(nodeA, chunks2[0])
+	assert.Nil(t, block)
+	assert.Equal(t, 0, len(syncMgr.chunkedBlocks))
+	syncMgr.OnBlockRequested(nodeA, blk1.Blk.Hash())
+
+	// chunks of different blocks are received in pipeline
+	for i := 0; i < len(chunks1)-1; i++ {
+		block, _ := syncMgr.OnBlockChunkReceive(nodeA, chunks1[i])
+		assert.Nil(t, block)
+		if i < len(chunks2) {
+			block, _ = syncMgr.OnBlockChunkReceive(nodeB, chunks2[i])
+			if i == len(chunks2)-1 {
+				assert.NotNil(t, block)
+				assert.Equal(t, blk2.Blk.Hash(), block.Blk.Hash())
+			} else {
+				assert.Nil(t, block)
+			}
+		}
+	}
+	// duplicated chunk is ignored
+	block, _ = syncMgr.OnBlockChunkReceive(nodeA, chunks1[0])
+	assert.Nil(t, block)
+	block, size := syncMgr.OnBlockChunkReceive(nodeA, chunks1[len(chunks1)-1])
+	assert.NotNil(t, block)
+	assert.Equal(t, blk1.Blk.Hash(), block.Blk.Hash())
+	assert.True(t, size > 3*p2pComm.BLOCK_CHUNK_SIZE)
+	assert.Equal(t, 0, len(syncMgr.chunkedBlocks))
+	assert.Equal(t, uint64(0), syncMgr.chunkedBytes)
+}
+
+func TestChunkedBytesLimit(t *testing.T) {
+	syncMgr := NewBlockSyncMgr(nil, nil)
+	nodeA, nodeB := p2pComm.PseudoPeerIdFromUint64(1), p2pComm.PseudoPeerIdFromUint64(2)
+	blk1 := newChunkedBlock(1, 2*p2pComm.BLOCK_CHUNK_SIZE)
+	blk2 := newChunkedBlock(2, 2*p2pComm.BLOCK_CHUNK_SIZE)
+	chunks1 := msgpack.NewBlockChunks(blk1)
+	chunks2 := msgpack.NewBlockChunks(blk2)
+	syncMgr.OnBlockRequested(nodeA, blk1.Blk.Hash())
+	syncMgr.OnBlockRequested(nodeB, blk2.Blk.Hash())
+
+	block, _ := syncMgr.OnBlockChunkReceive(nodeA, chunks1[0])
+	assert.Nil(t, block)
+	assert.Equal(t, uint64(len(chunks1[0].Data)), syncMgr.chunkedBytes)
+
+	// the least recently assembling block is evicted when the total bytes exceed the limit
+	syncMgr.chunkedBlocks[chunkedBlockKey{hash: blk1.Blk.Hash(), nodeId: nodeA}].size = SYNC_MAX_CHUNKED_BYTES
+	syncMgr.chunkedBytes = SYNC_MAX_CHUNKED_BYTES
+	block, _ = syncMgr.OnBlockChunkReceive(nodeB, chunks2[0])
+	assert.Nil(t, block)
+	assert.Equal(t, 1, len(syncMgr.chunkedBlocks))
+	_, ok := syncMgr.chunkedBlocks[chunkedBlockKey{hash: blk2.Blk.Hash(), nodeId: nodeB}]
+	assert.True(t, ok)
+
+	for i := 1; i < len(chunks2); i++ {
+		block, _ = syncMgr.OnBlockChunkReceive(nodeB, chunks2[i])
+	}
+	assert.NotNil(t, block)
+	assert.Equal(t, 0, len(syncMgr.chunkedBlocks))
+}
+
+func TestGetWindowNode(t *testing.T) {
+	nodes := make([]*peer.Peer, 0)
+	for i, height := range []uint64{100, 1000, 1000} {
+		info := peer.NewPeerInfo(p2pComm.PseudoPeerIdFromUint64(uint64(i+1)), 0, 0, false, 0, 0, height, "", "")
+		nodes = append(nodes, &peer.Peer{Info: info})
+	}
+
+	// continuous blocks in a window are requested from the same node
+	first := getWindowNode(nodes, 1, 0)
+	for h := uint32(2); h < SYNC_BLOCK_WINDOW_SIZE; h++ {
+		assert.Equal(t, first, getWindowNode(nodes, h, 0))
+	}
+	// windows are spread over nodes
+	used := make(map[*peer.Peer]bool)
+	for w := uint32(0); w < 3; w++ {
+		used[getWindowNode(nodes, w*SYNC_BLOCK_WINDOW_SIZE+1, 0)] = true
+	}
+	assert.Equal(t, 3, len(used))
+	// duplicated requests go to another node
+	assert.NotEqual(t, getWindowNode(nodes, 1, 0), getWindowNode(nodes, 1, 1))
+	// only the nodes reaching the height are used
+	for w := uint32(0); w < 3; w++ {
+		n := getWindowNode(nodes, 200+w*SYNC_BLOCK_WINDOW_SIZE, 0)
+		assert.Equal(t, uint64(1000), n.GetHeight())
+	}
+	assert.Nil(t, getWindowNode(nodes, 2000, 0))
+}
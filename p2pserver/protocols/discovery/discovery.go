@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/saveio/themis/common/config"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/p2pserver/common"
 	"github.com/saveio/themis/p2pserver/dht"
@@ -40,6 +41,8 @@ type Discovery struct {
 	quit       chan bool
 	maskSet    *strset.Set
 	maskFilter p2p.AddressFilter //todo : conbine with maskSet
+
+	persistFile string //routing table and address book are saved here if set
 }
 
 func NewDiscovery(net p2p.P2P, maskLst []string, maskFilter p2p.AddressFilter, refleshInterval time.Duration) *Discovery {
@@ -57,17 +60,97 @@ func NewDiscovery(net p2p.P2P, maskLst []string, maskFilter p2p.AddressFilter, r
 	}
 }
 
+//SetPersistFile makes the routing table and the address book survive restarts, must be called before Start
+func (self *Discovery) SetPersistFile(file string) {
+	self.persistFile = file
+}
+
+func (self *Discovery) AddrBook() *dht.AddrBook {
+	return self.dht.AddrBook()
+}
+
 func (self *Discovery) Start() {
+	if self.persistFile != "" {
+		self.loadPersisted()
+		go self.persist()
+	}
 	go self.findSelf()
 	go self.refreshCPL()
 }
 
 func (self *Discovery) Stop() {
 	close(self.quit)
+	if self.persistFile != "" {
+		self.savePersisted()
+	}
+}
+
+func (self *Discovery) loadPersisted() {
+	netID := config.DefConfig.P2PNode.NetworkMagic
+	routes, err := self.dht.LoadFromFile(self.persistFile, netID)
+	if err != nil {
+		log.Warnf("[dht] load %s failed: %s", self.persistFile, err)
+		return
+	}
+	log.Infof("[dht] restored %d routes and %d known addresses", len(routes), self.dht.AddrBook().Size())
+	for _, pair := range routes {
+		if self.net.GetPeer(pair.ID) != nil {
+			continue
+		}
+		self.dial(pair.Address)
+	}
+}
+
+func (self *Discovery) savePersisted() {
+	netID := config.DefConfig.P2PNode.NetworkMagic
+	if err := self.dht.SaveToFile(self.persistFile, netID); err != nil {
+		log.Warnf("[dht] save %s failed: %s", self.persistFile, err)
+	}
+}
+
+//persist saves the routing table and the address book periodically
+func (self *Discovery) persist() {
+	tick := time.NewTicker(common.PEERS_BOOK_SAVE_INTERVAL * time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			self.savePersisted()
+		case <-self.quit:
+			return
+		}
+	}
+}
+
+func (self *Discovery) dial(addr string) {
+	if self.net.IsOwnAddress(addr) {
+		return
+	}
+	self.dht.AddrBook().MarkAttempt(addr)
+	go self.net.Connect(addr)
+}
+
+//dialFromBook connects to the best known addresses accepted by filter
+func (self *Discovery) dialFromBook(count int, filter func(ka *dht.KnownAddress) bool) {
+	skip := func(ka *dht.KnownAddress) bool {
+		if !ka.ID.IsEmpty() && (ka.ID == self.id || self.net.GetPeer(ka.ID) != nil) {
+			return true
+		}
+		return filter != nil && !filter(ka)
+	}
+	for _, ka := range self.dht.AddrBook().Best(count, skip) {
+		log.Debugf("[dht] connect to known address %s", ka.Address)
+		self.dial(ka.Address)
+	}
 }
 
 func (self *Discovery) OnAddPeer(info *peer.PeerInfo) {
 	self.dht.Update(info.Id, info.RemoteListenAddress())
+	self.dht.AddrBook().MarkGood(info.Id, info.RemoteListenAddress())
+}
+
+func (self *Discovery) OnPeerUnreachable(addr string) {
+	self.dht.AddrBook().MarkFailed(addr)
 }
 
 func (self *Discovery) OnDelPeer(info *peer.PeerInfo) {
@@ -106,7 +189,14 @@ func (self *Discovery) refreshCPL() {
 	for {
 		select {
 		case <-tick.C:
-			for curCPL := range self.dht.RouteTable().Buckets {
+			buckets := self.dht.RouteTable().Buckets
+			if self.net.GetConnectionCnt() == 0 {
+				self.dialFromBook(dht.AlphaValue, nil)
+			}
+			for curCPL, bucket := range buckets {
+				if bucket.Len() < dht.AlphaValue {
+					self.refreshBucketFromBook(curCPL, curCPL == len(buckets)-1)
+				}
 				log.Debugf("[dht] start to refresh bucket: %d", curCPL)
 				randPeer := self.dht.RouteTable().GenRandKadId(uint(curCPL))
 				closer := self.dht.BetterPeers(randPeer, dht.AlphaValue)
@@ -127,6 +217,18 @@ func (self *Discovery) refreshCPL() {
 	}
 }
 
+//refreshBucketFromBook dials known addresses falling into the bucket of cpl,
+//the last bucket holds every peer with a longer common prefix
+func (self *Discovery) refreshBucketFromBook(cpl int, last bool) {
+	self.dialFromBook(dht.AlphaValue, func(ka *dht.KnownAddress) bool {
+		if ka.ID.IsEmpty() || ka.ID.IsPseudoPeerId() {
+			return false
+		}
+		kcpl := common.CommonPrefixLen(ka.ID, self.id)
+		return kcpl == cpl || (last && kcpl > cpl)
+	})
+}
+
 func (self *Discovery) FindNodeHandle(ctx *p2p.Context, freq *types.FindNodeReq) {
 	// we recv message must from establised peer
 	remotePeer := ctx.Sender()
@@ -193,16 +295,17 @@ func (self *Discovery) FindNodeResponseHandle(ctx *p2p.Context, fresp *types.Fin
 	p2p := ctx.Network()
 	// we should connect to closer peer to ask them them where should we go
 	for _, curpa := range fresp.CloserPeers {
-		// already connected
-		if p2p.GetPeer(curpa.ID) != nil {
-			continue
-		}
 		// do nothing about
 		if curpa.ID == p2p.GetID() {
 			continue
 		}
+		self.dht.AddrBook().Add(curpa.ID, curpa.Address, dht.SourceDiscovery)
+		// already connected
+		if p2p.GetPeer(curpa.ID) != nil {
+			continue
+		}
 		log.Debugf("[dht] try to connect to another peer by dht: %s ==> %s", curpa.ID.ToHexString(), curpa.Address)
-		go p2p.Connect(curpa.Address)
+		self.dial(curpa.Address)
 	}
 }
 
@@ -283,12 +386,13 @@ func (self *Discovery) AddrHandle(ctx *p2p.Context, msg *types.Addr) {
 		}
 		ip := net.IP(v.IpAddr[:])
 		address := ip.To16().String() + ":" + strconv.Itoa(int(v.Port))
+		self.dht.AddrBook().Add(v.ID, address, dht.SourceDiscovery)
 
 		if self.dht.Contains(v.ID) {
 			continue
 		}
 
 		log.Debug("[p2p]connect ip address:", address)
-		go p2p.Connect(address)
+		self.dial(address)
 	}
 }
@@ -0,0 +1,452 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package light_client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/core/ledger"
+	scom "github.com/saveio/themis/core/store/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/merkle"
+	p2pComm "github.com/saveio/themis/p2pserver/common"
+	msgpack "github.com/saveio/themis/p2pserver/message/msg_pack"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
+	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/peer_score"
+	"github.com/saveio/themis/smartcontract/event"
+)
+
+const (
+	LIGHT_CLIENT_MAX_REQUEST_PEERS = 3               //Number of peers a request is sent to
+	LIGHT_CLIENT_MIN_AGREED_PEERS  = 2               //Unprovable data is accepted when agreed by LIGHT_CLIENT_MIN_AGREED_PEERS distinct peers
+	LIGHT_CLIENT_REQUEST_TIMEOUT   = 5 * time.Second //Give up the request if no acceptable response after LIGHT_CLIENT_REQUEST_TIMEOUT
+)
+
+var ErrNoPeers = errors.New("no peers to request")
+var ErrNotEnoughPeers = errors.New("not enough peers to agree on unverified data")
+
+//response is the reply of a peer to the request on flight
+type response struct {
+	from p2pComm.PeerId
+	msg  msgTypes.Message
+}
+
+//LightClient serve transaction proofs and storage values to light peers, and fetch them on demand from
+//full peers when the ledger is in light mode.
+//
+//Transactions are verified against the block root of the local headers, since the transactions root and
+//block root are committed in headers. The state merkle root and events are not committed in headers, so
+//storage values and events are unverified, they are only accepted when agreed by enough distinct peers.
+type LightClient struct {
+	server p2p.P2P
+	ledger *ledger.Ledger
+
+	lock    sync.Mutex
+	waiters map[string][]chan *response //Map request key => channels of requests on flight
+}
+
+func NewLightClient(server p2p.P2P, ld *ledger.Ledger) *LightClient {
+	return &LightClient{
+		server:  server,
+		ledger:  ld,
+		waiters: make(map[string][]chan *response),
+	}
+}
+
+func txProofKey(txHash common.Uint256) string {
+	return "tx:" + txHash.ToHexString()
+}
+
+func storageKey(contract common.Address, key []byte) string {
+	return fmt.Sprintf("storage:%s:%x", contract.ToHexString(), key)
+}
+
+//GetTransaction fetch transaction and the height of block it is in from peers, the inclusion of transaction is
+//verified by merkle proof against local headers
+func (this *LightClient) GetTransaction(txHash common.Uint256) (*types.Transaction, uint32, error) {
+	proof, err := this.requestTxProof(txHash, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	return proof.Tx, proof.Height, nil
+}
+
+//GetEventNotifyByTx fetch the execute notify of transaction from peers, returns nil if transaction has no notify
+func (this *LightClient) GetEventNotifyByTx(txHash common.Uint256) (*event.ExecuteNotify, error) {
+	proof, err := this.requestTxProof(txHash, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(proof.Notify) == 0 {
+		return nil, nil
+	}
+	notify := &event.ExecuteNotify{}
+	if err := json.Unmarshal(proof.Notify, notify); err != nil {
+		return nil, err
+	}
+	return notify, nil
+}
+
+//GetStorageItem fetch the storage value of contract from peers, returns nil if value is not found. The value is
+//unverified, it is agreed by LIGHT_CLIENT_MIN_AGREED_PEERS distinct peers
+func (this *LightClient) GetStorageItem(contract common.Address, key []byte) ([]byte, error) {
+	peers := this.requestPeers()
+	if len(peers) == 0 {
+		return nil, ErrNoPeers
+	}
+	if len(peers) < LIGHT_CLIENT_MIN_AGREED_PEERS {
+		return nil, fmt.Errorf("%w, get storage from %d peers", ErrNotEnoughPeers, len(peers))
+	}
+	ch := this.register(storageKey(contract, key), len(peers))
+	defer this.unregister(storageKey(contract, key), ch)
+	for _, p := range peers {
+		go this.server.Send(p, msgpack.NewStorageReq(contract, key))
+	}
+
+	votes := newAgreement(peers)
+	timer := time.NewTimer(LIGHT_CLIENT_REQUEST_TIMEOUT)
+	defer timer.Stop()
+	for !votes.finished() {
+		select {
+		case resp := <-ch:
+			if !votes.accept(resp.from) {
+				continue
+			}
+			value := resp.msg.(*msgTypes.Storage).Value
+			if votes.vote(value) {
+				if len(value) == 0 {
+					return nil, nil
+				}
+				return value, nil
+			}
+		case <-timer.C:
+			return nil, fmt.Errorf("get storage timeout")
+		}
+	}
+	return nil, fmt.Errorf("peers disagree on storage value")
+}
+
+//requestTxProof request transaction proof from peers, the notify of returned proof is unverified, it is agreed by
+//LIGHT_CLIENT_MIN_AGREED_PEERS distinct peers if agreeNotify is true. Not found is agreed in the same way
+func (this *LightClient) requestTxProof(txHash common.Uint256, agreeNotify bool) (*msgTypes.TxProof, error) {
+	peers := this.requestPeers()
+	if len(peers) == 0 {
+		return nil, ErrNoPeers
+	}
+	if agreeNotify && len(peers) < LIGHT_CLIENT_MIN_AGREED_PEERS {
+		return nil, fmt.Errorf("%w, get event notify from %d peers", ErrNotEnoughPeers, len(peers))
+	}
+	ch := this.register(txProofKey(txHash), len(peers))
+	defer this.unregister(txProofKey(txHash), ch)
+	rootHeight := this.ledger.GetCurrentBlockHeight()
+	for _, p := range peers {
+		go this.server.Send(p, msgpack.NewTxProofReq(txHash, rootHeight))
+	}
+
+	votes := newAgreement(peers)
+	notFound := 0
+	timer := time.NewTimer(LIGHT_CLIENT_REQUEST_TIMEOUT)
+	defer timer.Stop()
+	for !votes.finished() {
+		select {
+		case resp := <-ch:
+			if !votes.accept(resp.from) {
+				continue
+			}
+			proof := resp.msg.(*msgTypes.TxProof)
+			if proof.Tx == nil {
+				notFound++
+				if notFound >= LIGHT_CLIENT_MIN_AGREED_PEERS {
+					return nil, scom.ErrNotFound
+				}
+				continue
+			}
+			if err := this.verifyTxProof(proof); err != nil {
+				log.Warnf("[light-client] invalid tx proof of %s from peer %s: %s", txHash.ToHexString(),
+					resp.from.ToHexString(), err)
+				this.server.PeerScore().ReportPeer(this.server.GetPeer(resp.from), peer_score.MisbehaveInvalidTx, err.Error())
+				continue
+			}
+			if !agreeNotify {
+				return proof, nil
+			}
+			if votes.vote(proof.Notify) {
+				return proof, nil
+			}
+		case <-timer.C:
+			return nil, fmt.Errorf("get transaction proof timeout")
+		}
+	}
+	return nil, fmt.Errorf("no acceptable transaction proof")
+}
+
+//verifyTxProof verify the proof against local headers
+func (this *LightClient) verifyTxProof(proof *msgTypes.TxProof) error {
+	header, err := this.ledger.GetHeaderByHeight(proof.Height)
+	if err != nil || header == nil {
+		return fmt.Errorf("header of height %d not found", proof.Height)
+	}
+	rootHeader, err := this.ledger.GetHeaderByHeight(proof.RootHeight)
+	if err != nil || rootHeader == nil {
+		return fmt.Errorf("header of root height %d not found", proof.RootHeight)
+	}
+	return VerifyTxProof(proof, header, rootHeader)
+}
+
+//VerifyTxProof verify the transaction is in the block of header, and the block is in the block root of rootHeader
+func VerifyTxProof(proof *msgTypes.TxProof, header, rootHeader *types.Header) error {
+	if proof.Tx == nil {
+		return fmt.Errorf("transaction not found")
+	}
+	if proof.Tx.Hash() != proof.TxHash {
+		return fmt.Errorf("transaction hash mismatch")
+	}
+	if header.Height != proof.Height || rootHeader.Height != proof.RootHeight {
+		return fmt.Errorf("header height mismatch")
+	}
+	found := false
+	for _, hash := range proof.TxHashes {
+		if hash == proof.TxHash {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("transaction not in block")
+	}
+	hashes := make([]common.Uint256, len(proof.TxHashes))
+	copy(hashes, proof.TxHashes)
+	if common.ComputeMerkleRoot(hashes) != header.TransactionsRoot {
+		return fmt.Errorf("transactions root mismatch")
+	}
+	verifier := merkle.NewMerkleVerifier()
+	err := verifier.VerifyLeafHashInclusion(header.TransactionsRoot, proof.Height, proof.Proof, rootHeader.BlockRoot,
+		proof.RootHeight+1)
+	if err != nil {
+		return err
+	}
+	if len(proof.Notify) != 0 {
+		notify := &event.ExecuteNotify{}
+		if err := json.Unmarshal(proof.Notify, notify); err != nil {
+			return err
+		}
+		if notify.TxHash != proof.TxHash {
+			return fmt.Errorf("notify transaction hash mismatch")
+		}
+	}
+	return nil
+}
+
+//requestPeers select the highest neighbors to send request
+func (this *LightClient) requestPeers() []*peer.Peer {
+	peers := this.server.GetNeighbors()
+	height := uint64(this.ledger.GetCurrentBlockHeight())
+	result := make([]*peer.Peer, 0, LIGHT_CLIENT_MAX_REQUEST_PEERS)
+	for _, p := range peers {
+		if p.GetHeight() < height {
+			continue
+		}
+		result = append(result, p)
+		if len(result) >= LIGHT_CLIENT_MAX_REQUEST_PEERS {
+			break
+		}
+	}
+	return result
+}
+
+//agreement count the votes of requested peers on unverified data, each peer responds once
+type agreement struct {
+	requested map[p2pComm.PeerId]bool
+	responded map[p2pComm.PeerId]bool
+	votes     map[string]int
+}
+
+func newAgreement(peers []*peer.Peer) *agreement {
+	requested := make(map[p2pComm.PeerId]bool, len(peers))
+	for _, p := range peers {
+		requested[p.GetID()] = true
+	}
+	return &agreement{
+		requested: requested,
+		responded: make(map[p2pComm.PeerId]bool, len(peers)),
+		votes:     make(map[string]int),
+	}
+}
+
+//accept return false if the peer is not requested or has responded, its response is ignored
+func (this *agreement) accept(from p2pComm.PeerId) bool {
+	if !this.requested[from] || this.responded[from] {
+		return false
+	}
+	this.responded[from] = true
+	return true
+}
+
+//vote return whether the value is agreed by LIGHT_CLIENT_MIN_AGREED_PEERS peers
+func (this *agreement) vote(value []byte) bool {
+	this.votes[string(value)]++
+	return this.votes[string(value)] >= LIGHT_CLIENT_MIN_AGREED_PEERS
+}
+
+//finished return whether all requested peers have responded
+func (this *agreement) finished() bool {
+	return len(this.responded) == len(this.requested)
+}
+
+func (this *LightClient) register(key string, size int) chan *response {
+	ch := make(chan *response, size)
+	this.lock.Lock()
+	this.waiters[key] = append(this.waiters[key], ch)
+	this.lock.Unlock()
+	return ch
+}
+
+func (this *LightClient) unregister(key string, ch chan *response) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	waiters := this.waiters[key]
+	for i, c := range waiters {
+		if c == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(this.waiters, key)
+	} else {
+		this.waiters[key] = waiters
+	}
+}
+
+//dispatch deliver the response to requests on flight, the response is dropped if no request waiting
+func (this *LightClient) dispatch(key string, resp *response) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, ch := range this.waiters[key] {
+		select {
+		case ch <- resp:
+		default:
+		}
+	}
+}
+
+//OnTxProofReceive handles the transaction proof response from peer
+func (this *LightClient) OnTxProofReceive(fromID p2pComm.PeerId, proof *msgTypes.TxProof) {
+	this.dispatch(txProofKey(proof.TxHash), &response{from: fromID, msg: proof})
+}
+
+//OnStorageReceive handles the storage response from peer
+func (this *LightClient) OnStorageReceive(fromID p2pComm.PeerId, storage *msgTypes.Storage) {
+	this.dispatch(storageKey(storage.Contract, storage.Key), &response{from: fromID, msg: storage})
+}
+
+//TxProofReqHandle handles the transaction proof request from peer
+func (this *LightClient) TxProofReqHandle(ctx *p2p.Context, req *msgTypes.TxProofReq) {
+	if this.ledger.IsLightMode() {
+		return
+	}
+	resp := &msgTypes.TxProof{TxHash: req.TxHash}
+	proof, err := this.buildTxProof(req)
+	if err != nil {
+		log.Debugf("[light-client] build tx proof of %s error:%s", req.TxHash.ToHexString(), err)
+	} else {
+		resp = proof
+	}
+	err = ctx.Sender().Send(resp)
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+func (this *LightClient) buildTxProof(req *msgTypes.TxProofReq) (*msgTypes.TxProof, error) {
+	tx, height, err := this.ledger.GetTransactionWithHeight(req.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, scom.ErrNotFound
+	}
+	rootHeight := this.ledger.GetCurrentBlockHeight()
+	if req.RootHeight < rootHeight {
+		rootHeight = req.RootHeight
+	}
+	if rootHeight < height {
+		return nil, fmt.Errorf("root height %d lower than transaction height %d", rootHeight, height)
+	}
+	block, err := this.ledger.GetBlockByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	txHashes := make([]common.Uint256, 0, len(block.Transactions))
+	for _, t := range block.Transactions {
+		txHashes = append(txHashes, t.Hash())
+	}
+	path, err := this.ledger.GetMerkleProof(height, rootHeight)
+	if err != nil {
+		return nil, err
+	}
+	var notify []byte
+	evt, err := this.ledger.GetEventNotifyByTx(req.TxHash)
+	if err != nil && err != scom.ErrNotFound {
+		return nil, err
+	}
+	if evt != nil {
+		if notify, err = json.Marshal(evt); err != nil {
+			return nil, err
+		}
+	}
+	return &msgTypes.TxProof{
+		TxHash:     req.TxHash,
+		Tx:         tx,
+		Height:     height,
+		TxHashes:   txHashes,
+		RootHeight: rootHeight,
+		Proof:      path,
+		Notify:     notify,
+	}, nil
+}
+
+//StorageReqHandle handles the storage request from peer
+func (this *LightClient) StorageReqHandle(ctx *p2p.Context, req *msgTypes.StorageReq) {
+	if this.ledger.IsLightMode() {
+		return
+	}
+	value, err := this.ledger.GetStorageItem(req.Contract, req.Key)
+	if err != nil && err != scom.ErrNotFound {
+		log.Debugf("[light-client] get storage error:%s", err)
+		return
+	}
+	err = ctx.Sender().Send(&msgTypes.Storage{
+		Contract: req.Contract,
+		Key:      req.Key,
+		Value:    value,
+		Height:   this.ledger.GetCurrentBlockHeight(),
+	})
+	if err != nil {
+		log.Warn(err)
+	}
+}
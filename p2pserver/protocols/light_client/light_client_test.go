@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package light_client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/core/utils"
+	"github.com/saveio/themis/merkle"
+	p2pComm "github.com/saveio/themis/p2pserver/common"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
+	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/smartcontract/event"
+	"github.com/stretchr/testify/assert"
+)
+
+//buildTxProof build proof of the second transaction in block 2, the root block is 4
+func buildTxProof(t *testing.T) (*msgTypes.TxProof, *types.Header, *types.Header) {
+	var txs []*types.Transaction
+	var txHashes []common.Uint256
+	for i := 0; i < 3; i++ {
+		tx, err := utils.NewInvokeTransaction([]byte{byte(i)}).IntoImmutable()
+		assert.Nil(t, err)
+		txs = append(txs, tx)
+		txHashes = append(txHashes, tx.Hash())
+	}
+	hashes := make([]common.Uint256, len(txHashes))
+	copy(hashes, txHashes)
+	header := &types.Header{Height: 2, TransactionsRoot: common.ComputeMerkleRoot(hashes)}
+
+	tree := merkle.NewTree(0, nil, merkle.NewMemHashStore())
+	for i := uint32(0); i <= 4; i++ {
+		if i == header.Height {
+			tree.AppendHash(header.TransactionsRoot)
+		} else {
+			tree.AppendHash(common.Uint256{byte(i)})
+		}
+	}
+	rootHeader := &types.Header{Height: 4, BlockRoot: tree.Root()}
+	path, err := tree.InclusionProof(header.Height, rootHeader.Height+1)
+	assert.Nil(t, err)
+
+	notify, err := json.Marshal(&event.ExecuteNotify{TxHash: txHashes[1], State: event.CONTRACT_STATE_SUCCESS})
+	assert.Nil(t, err)
+	proof := &msgTypes.TxProof{
+		TxHash:     txHashes[1],
+		Tx:         txs[1],
+		Height:     header.Height,
+		TxHashes:   txHashes,
+		RootHeight: rootHeader.Height,
+		Proof:      path,
+		Notify:     notify,
+	}
+	return proof, header, rootHeader
+}
+
+func TestVerifyTxProof(t *testing.T) {
+	proof, header, rootHeader := buildTxProof(t)
+	assert.Nil(t, VerifyTxProof(proof, header, rootHeader))
+
+	sink := common.NewZeroCopySink(nil)
+	proof.Serialization(sink)
+	decoded := &msgTypes.TxProof{}
+	assert.Nil(t, decoded.Deserialization(common.NewZeroCopySource(sink.Bytes())))
+	assert.Equal(t, proof.TxHash, decoded.Tx.Hash())
+	assert.Nil(t, VerifyTxProof(decoded, header, rootHeader))
+
+	proof.TxHashes[0], proof.TxHashes[2] = proof.TxHashes[2], proof.TxHashes[0]
+	assert.NotNil(t, VerifyTxProof(proof, header, rootHeader))
+
+	proof, header, rootHeader = buildTxProof(t)
+	proof.Proof[0] = common.Uint256{}
+	assert.NotNil(t, VerifyTxProof(proof, header, rootHeader))
+
+	proof, header, rootHeader = buildTxProof(t)
+	proof.TxHash = proof.TxHashes[0]
+	assert.NotNil(t, VerifyTxProof(proof, header, rootHeader))
+
+	proof, header, rootHeader = buildTxProof(t)
+	proof.Notify, _ = json.Marshal(&event.ExecuteNotify{TxHash: proof.TxHashes[0]})
+	assert.NotNil(t, VerifyTxProof(proof, header, rootHeader))
+}
+
+func TestAgreement(t *testing.T) {
+	ids := []p2pComm.PeerId{p2pComm.PseudoPeerIdFromUint64(1), p2pComm.PseudoPeerIdFromUint64(2),
+		p2pComm.PseudoPeerIdFromUint64(3)}
+	peers := make([]*peer.Peer, 0, len(ids))
+	for _, id := range ids {
+		peers = append(peers, &peer.Peer{Info: &peer.PeerInfo{Id: id}})
+	}
+	votes := newAgreement(peers)
+	//a peer is counted once, repeated responses can not make the value agreed
+	assert.True(t, votes.accept(ids[0]))
+	assert.False(t, votes.vote([]byte("forged")))
+	assert.False(t, votes.accept(ids[0]))
+	//responses from peers not requested are ignored
+	assert.False(t, votes.accept(p2pComm.PseudoPeerIdFromUint64(4)))
+
+	assert.True(t, votes.accept(ids[1]))
+	assert.False(t, votes.vote([]byte("value")))
+	assert.False(t, votes.finished())
+	assert.True(t, votes.accept(ids[2]))
+	assert.True(t, votes.vote([]byte("value")))
+	assert.True(t, votes.finished())
+}
@@ -34,13 +34,19 @@ import (
 	msgpack "github.com/saveio/themis/p2pserver/message/msg_pack"
 	msgTypes "github.com/saveio/themis/p2pserver/message/types"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/peer_score"
 	"github.com/saveio/themis/p2pserver/protocols/block_sync"
 	"github.com/saveio/themis/p2pserver/protocols/bootstrap"
 	"github.com/saveio/themis/p2pserver/protocols/discovery"
 	"github.com/saveio/themis/p2pserver/protocols/heatbeat"
+	"github.com/saveio/themis/p2pserver/protocols/light_client"
 	"github.com/saveio/themis/p2pserver/protocols/recent_peers"
 	"github.com/saveio/themis/p2pserver/protocols/reconnect"
+	"github.com/saveio/themis/p2pserver/protocols/relay"
+	"github.com/saveio/themis/p2pserver/protocols/snapshot_sync"
 	"github.com/saveio/themis/p2pserver/protocols/subnet"
+	"github.com/saveio/themis/p2pserver/protocols/tx_gossip"
 	"github.com/saveio/themis/p2pserver/protocols/utils"
 	gov "github.com/saveio/themis/smartcontract/service/native/governance"
 )
@@ -55,6 +61,10 @@ var txCache, _ = lru.NewARC(msgCommon.MAX_TX_CACHE_SIZE)
 type MsgHandler struct {
 	seeds                    *utils.HostsResolver
 	blockSync                *block_sync.BlockSyncMgr
+	snapshotSync             *snapshot_sync.SnapshotSyncMgr
+	lightClient              *light_client.LightClient
+	txGossip                 *tx_gossip.TxGossip
+	relay                    *relay.RelayService
 	reconnect                *reconnect.ReconnectService
 	discovery                *discovery.Discovery
 	heatBeat                 *heatbeat.HeartBeat
@@ -89,16 +99,35 @@ func (self *MsgHandler) GetSubnetMembersInfo() []msgCommon.SubnetMemberInfo {
 	return self.subnet.GetMembersInfo()
 }
 
+//GetTxGossip return the transaction gossip protocol, nil if not started
+func (self *MsgHandler) GetTxGossip() *tx_gossip.TxGossip {
+	return self.txGossip
+}
+
+//GetLightClient return the light client protocol, nil if not started
+func (self *MsgHandler) GetLightClient() *light_client.LightClient {
+	return self.lightClient
+}
+
 func (self *MsgHandler) start(net p2p.P2P) {
 	self.blockSync = block_sync.NewBlockSyncMgr(net, self.ledger)
+	self.snapshotSync = snapshot_sync.NewSnapshotSyncMgr(net, self.ledger, self.blockSync, config.DefConfig.P2PNode.EnableStateSync)
+	self.lightClient = light_client.NewLightClient(net, self.ledger)
+	self.txGossip = tx_gossip.NewTxGossip(net, self.ledger, config.DefConfig.P2PNode.TxGossipFanout,
+		func(hash common.Uint256) bool { return txCache.Contains(hash) })
+	self.relay = relay.NewRelayService(net, 0, 0)
 	self.reconnect = reconnect.NewReconectService(net, self.staticReserveFilter)
 	maskFilter := self.subnet.GetMaskAddrFilter()
 	self.discovery = discovery.NewDiscovery(net, config.DefConfig.P2PNode.ReservedCfg.MaskPeers, maskFilter, 0)
+	self.discovery.SetPersistFile(msgCommon.PEERS_BOOK_FILE_NAME)
 	self.bootstrap = bootstrap.NewBootstrapService(net, self.seeds)
 	self.heatBeat = heatbeat.NewHeartBeat(net, self.ledger)
 	self.persistRecentPeerService = recent_peers.NewPersistRecentPeerService(net)
 	go self.persistRecentPeerService.Start()
 	go self.blockSync.Start()
+	go self.snapshotSync.Start()
+	go self.txGossip.Start()
+	go self.relay.Start()
 	go self.reconnect.Start()
 	go self.discovery.Start()
 	go self.heatBeat.Start()
@@ -108,6 +137,9 @@ func (self *MsgHandler) start(net p2p.P2P) {
 
 func (self *MsgHandler) stop() {
 	self.blockSync.Stop()
+	self.snapshotSync.Stop()
+	self.txGossip.Stop()
+	self.relay.Stop()
 	self.reconnect.Stop()
 	self.discovery.Stop()
 	self.persistRecentPeerService.Stop()
@@ -122,6 +154,7 @@ func (self *MsgHandler) HandleSystemMessage(net p2p.P2P, msg p2p.SystemMessage)
 		self.start(net)
 	case p2p.PeerConnected:
 		self.blockSync.OnAddNode(m.Info.Id)
+		self.txGossip.OnAddPeer(m.Info.Id)
 		self.reconnect.OnAddPeer(m.Info)
 		self.discovery.OnAddPeer(m.Info)
 		self.bootstrap.OnAddPeer(m.Info)
@@ -129,6 +162,9 @@ func (self *MsgHandler) HandleSystemMessage(net p2p.P2P, msg p2p.SystemMessage)
 		self.subnet.OnAddPeer(net, m.Info)
 	case p2p.PeerDisConnected:
 		self.blockSync.OnDelNode(m.Info.Id)
+		self.snapshotSync.OnDelNode(m.Info.Id)
+		self.txGossip.OnDelPeer(m.Info.Id)
+		self.relay.OnDelPeer(m.Info)
 		self.reconnect.OnDelPeer(m.Info)
 		self.discovery.OnDelPeer(m.Info)
 		self.bootstrap.OnDelPeer(m.Info)
@@ -138,6 +174,9 @@ func (self *MsgHandler) HandleSystemMessage(net p2p.P2P, msg p2p.SystemMessage)
 		self.stop()
 	case p2p.HostAddrDetected:
 		self.subnet.OnHostAddrDetected(m.ListenAddr)
+	case p2p.PeerUnreachable:
+		self.relay.OnPeerUnreachable(m.Addr)
+		self.discovery.OnPeerUnreachable(m.Addr)
 	}
 }
 
@@ -159,23 +198,60 @@ func (self *MsgHandler) HandlePeerMessage(ctx *p2p.Context, msg msgTypes.Message
 	case *msgTypes.BlkHeader:
 		self.blockSync.OnHeaderReceive(ctx.Sender().GetID(), m.BlkHdr)
 	case *msgTypes.Block:
-		self.blockHandle(ctx, m)
+		self.blockHandle(ctx, m, ctx.MsgSize)
+	case *msgTypes.BlockChunk:
+		if block, size := self.blockSync.OnBlockChunkReceive(ctx.Sender().GetID(), m); block != nil {
+			self.blockHandle(ctx, block, size)
+		}
 	case *msgTypes.Consensus:
 		ConsensusHandle(ctx, m)
 	case *msgTypes.Trn:
+		self.txGossip.OnTxReceive(ctx.Sender().GetID(), m.Txn.Hash())
 		TransactionHandle(ctx, m)
 	case *msgTypes.Addr:
 		self.discovery.AddrHandle(ctx, m)
 	case *msgTypes.DataReq:
-		DataReqHandle(ctx, m)
+		if common.InventoryType(m.DataType) == common.TRANSACTION {
+			self.txGossip.DataReqHandle(ctx, m.Hash)
+		} else {
+			DataReqHandle(ctx, m)
+		}
 	case *msgTypes.Inv:
-		InvHandle(ctx, m)
+		if m.P.InvType == common.TRANSACTION {
+			self.txGossip.OnInvReceive(ctx, m.P.Blk)
+		} else {
+			InvHandle(ctx, m, self.blockSync)
+		}
 	case *msgTypes.SubnetMembersRequest:
 		self.subnet.OnMembersRequest(ctx, m)
 	case *msgTypes.SubnetMembers:
 		self.subnet.OnMembersResponse(ctx, m)
 	case *msgTypes.SubmitNonceParam:
 		SubmitNonceParamHandle(ctx, m)
+	case *msgTypes.StateSnapshotReq:
+		self.snapshotSync.SnapshotReqHandle(ctx, m)
+	case *msgTypes.StateSnapshot:
+		self.snapshotSync.OnSnapshotReceive(ctx.Sender().GetID(), &m.Snapshot)
+	case *msgTypes.StateChunkReq:
+		self.snapshotSync.ChunkReqHandle(ctx, m)
+	case *msgTypes.StateChunk:
+		self.snapshotSync.OnChunkReceive(ctx.Sender().GetID(), m)
+	case *msgTypes.TxProofReq:
+		self.lightClient.TxProofReqHandle(ctx, m)
+	case *msgTypes.TxProof:
+		self.lightClient.OnTxProofReceive(ctx.Sender().GetID(), m)
+	case *msgTypes.StorageReq:
+		self.lightClient.StorageReqHandle(ctx, m)
+	case *msgTypes.Storage:
+		self.lightClient.OnStorageReceive(ctx.Sender().GetID(), m)
+	case *msgTypes.RelayRegister:
+		self.relay.OnRelayRegister(ctx)
+	case *msgTypes.RelayAck:
+		self.relay.OnRelayAck(ctx, m)
+	case *msgTypes.RelayConnect:
+		self.relay.OnRelayConnect(ctx, m)
+	case *msgTypes.ConnectBack:
+		self.relay.OnConnectBack(ctx, m)
 	case *msgTypes.NotFound:
 		log.Debug("[p2p]receive notFound message, hash is ", m.Hash)
 	default:
@@ -211,15 +287,19 @@ func HeadersReqHandle(ctx *p2p.Context, headersReq *msgTypes.HeadersReq) {
 }
 
 // blockHandle handles the block message from peer
-func (self *MsgHandler) blockHandle(ctx *p2p.Context, block *msgTypes.Block) {
+func (self *MsgHandler) blockHandle(ctx *p2p.Context, block *msgTypes.Block, blockSize uint32) {
 	stateHashHeight := config.GetStateHashCheckHeight(config.DefConfig.P2PNode.NetworkId)
 	if block.Blk.Header.Height >= stateHashHeight && block.MerkleRoot == common.UINT256_EMPTY {
 		remotePeer := ctx.Sender()
+		ctx.Network().PeerScore().ReportPeer(remotePeer, peer_score.MisbehaveInvalidBlock, "block without merkle root")
 		remotePeer.Close()
 		return
 	}
 
-	self.blockSync.OnBlockReceive(ctx.Sender().GetID(), ctx.MsgSize, block.Blk, block.CCMsg, block.MerkleRoot)
+	if self.snapshotSync.OnBlockReceive(block.Blk) {
+		return
+	}
+	self.blockSync.OnBlockReceive(ctx.Sender().GetID(), blockSize, block.Blk, block.CCMsg, block.MerkleRoot)
 }
 
 // ConsensusHandle handles the consensus message from peer
@@ -228,6 +308,7 @@ func ConsensusHandle(ctx *p2p.Context, consensus *msgTypes.Consensus) {
 	if cpid != nil {
 		if err := consensus.Cons.Verify(); err != nil {
 			log.Warn(err)
+			ctx.Network().PeerScore().ReportPeer(ctx.Sender(), peer_score.MisbehaveInvalidConsensus, err.Error())
 			return
 		}
 		consensus.Cons.PeerId = ctx.Sender().GetID()
@@ -235,11 +316,27 @@ func ConsensusHandle(ctx *p2p.Context, consensus *msgTypes.Consensus) {
 	}
 }
 
+// sendBlock sends large block in chunks if remote peer supports, other messages can be sent between chunks
+func sendBlock(remotePeer *peer.Peer, blk *msgTypes.Block) error {
+	if remotePeer.SupportCompress() {
+		chunks := msgpack.NewBlockChunks(blk)
+		if len(chunks) > 1 {
+			for _, chunk := range chunks {
+				if err := remotePeer.Send(chunk); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return remotePeer.Send(blk)
+}
+
 // TransactionHandle handles the transaction message from peer
 func TransactionHandle(ctx *p2p.Context, trn *msgTypes.Trn) {
 	if !txCache.Contains(trn.Txn.Hash()) {
 		txCache.Add(trn.Txn.Hash(), nil)
-		actor.AddTransaction(trn.Txn)
+		actor.AddTransaction(trn.Txn, ctx.Sender().GetID())
 	} else {
 		log.Tracef("[p2p]receive duplicate Transaction message, txHash: %x\n", trn.Txn.Hash())
 	}
@@ -301,7 +398,7 @@ func DataReqHandle(ctx *p2p.Context, dataReq *msgTypes.DataReq) {
 			msg = msgpack.NewBlock(block, ccMsg, merkleRoot)
 			saveRespCache(reqID, msg)
 		}
-		err := remotePeer.Send(msg)
+		err := sendBlock(remotePeer, msg.(*msgTypes.Block))
 		if err != nil {
 			log.Warn(err)
 			return
@@ -330,7 +427,7 @@ func DataReqHandle(ctx *p2p.Context, dataReq *msgTypes.DataReq) {
 
 // InvHandle handles the inventory message(block,
 // transaction and consensus) from peer.
-func InvHandle(ctx *p2p.Context, inv *msgTypes.Inv) {
+func InvHandle(ctx *p2p.Context, inv *msgTypes.Inv, blockSync *block_sync.BlockSyncMgr) {
 	remotePeer := ctx.Sender()
 	if len(inv.P.Blk) == 0 {
 		log.Debug("[p2p]empty inv payload in InvHandle")
@@ -370,6 +467,7 @@ func InvHandle(ctx *p2p.Context, inv *msgTypes.Inv) {
 				msgTypes.LastInvHash = id
 				// send the block request
 				log.Infof("[p2p]inv request block hash: %x", id)
+				blockSync.OnBlockRequested(remotePeer.GetID(), id)
 				msg := msgpack.NewBlkDataReq(id)
 				err = remotePeer.Send(msg)
 				if err != nil {
@@ -522,3 +620,7 @@ func saveRespCache(key string, value interface{}) {
 func (mh *MsgHandler) ReconnectService() *reconnect.ReconnectService {
 	return mh.reconnect
 }
+
+func (mh *MsgHandler) BlockSyncMgr() *block_sync.BlockSyncMgr {
+	return mh.blockSync
+}
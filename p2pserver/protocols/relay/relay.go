@@ -0,0 +1,234 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/p2pserver/common"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
+	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer"
+)
+
+const (
+	RELAY_CHECK_INTERVAL    = time.Minute     //Check reachability every RELAY_CHECK_INTERVAL
+	RELAY_UNREACHABLE_DELAY = 5 * time.Minute //Node without port mapped or inbound connection after RELAY_UNREACHABLE_DELAY is unreachable
+	RELAY_MAX_RELAYS        = 3               //Max peers relaying for the unreachable node
+	RELAY_MAX_RELAYED       = 64              //Max unreachable peers relayed by the node
+	RELAY_CONNECT_INTERVAL  = time.Minute     //Min interval of relay connect requests for the same address
+)
+
+//RelayService lets the outbound only node be connected by peers. The unreachable node registers itself on
+//reachable neighbors, peers failing to dial it ask their neighbors to relay a connect back request, and the
+//unreachable node dials the requester instead
+type RelayService struct {
+	net              p2p.P2P
+	startTime        time.Time
+	checkInterval    time.Duration
+	unreachableDelay time.Duration
+
+	lock      sync.Mutex
+	relays    map[common.PeerId]bool   //Map relay id => accepted, false if registration pending or rejected
+	relayed   map[common.PeerId]string //Map relayed unreachable peer id => listen address
+	requested map[string]time.Time     //Map target address => time relay connect requested
+	quit      chan bool
+}
+
+//NewRelayService return RelayService, the default interval and delay are used if checkInterval or
+//unreachableDelay is 0
+func NewRelayService(net p2p.P2P, checkInterval, unreachableDelay time.Duration) *RelayService {
+	if checkInterval == 0 {
+		checkInterval = RELAY_CHECK_INTERVAL
+	}
+	if unreachableDelay == 0 {
+		unreachableDelay = RELAY_UNREACHABLE_DELAY
+	}
+	return &RelayService{
+		net:              net,
+		startTime:        time.Now(),
+		checkInterval:    checkInterval,
+		unreachableDelay: unreachableDelay,
+		relays:           make(map[common.PeerId]bool),
+		relayed:          make(map[common.PeerId]string),
+		requested:        make(map[string]time.Time),
+		quit:             make(chan bool),
+	}
+}
+
+func (this *RelayService) Start() {
+	ticker := time.NewTicker(this.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.checkRelays()
+		case <-this.quit:
+			return
+		}
+	}
+}
+
+func (this *RelayService) Stop() {
+	close(this.quit)
+}
+
+//checkRelays registers on neighbors if the node stays unreachable
+func (this *RelayService) checkRelays() {
+	if time.Since(this.startTime) < this.unreachableDelay || this.net.IsReachable() {
+		return
+	}
+	neighbors := this.net.GetNeighbors()
+	this.lock.Lock()
+	accepted := 0
+	for _, ok := range this.relays {
+		if ok {
+			accepted++
+		}
+	}
+	var candidates []*peer.Peer
+	for _, p := range neighbors {
+		if accepted+len(candidates) >= RELAY_MAX_RELAYS {
+			break
+		}
+		if _, ok := this.relays[p.GetID()]; ok {
+			continue
+		}
+		this.relays[p.GetID()] = false
+		candidates = append(candidates, p)
+	}
+	now := time.Now()
+	for addr, t := range this.requested {
+		if now.Sub(t) >= RELAY_CONNECT_INTERVAL {
+			delete(this.requested, addr)
+		}
+	}
+	this.lock.Unlock()
+
+	for _, p := range candidates {
+		log.Debugf("[relay] node unreachable, register relay on %s", p.GetAddr())
+		go this.net.Send(p, &msgTypes.RelayRegister{})
+	}
+}
+
+//IsRelayed return whether the node is relayed by peers
+func (this *RelayService) IsRelayed() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, ok := range this.relays {
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *RelayService) OnDelPeer(info *peer.PeerInfo) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.relays, info.Id)
+	delete(this.relayed, info.Id)
+}
+
+//OnPeerUnreachable ask neighbors to relay a connect back request to the unreachable address
+func (this *RelayService) OnPeerUnreachable(addr string) {
+	this.lock.Lock()
+	if t, ok := this.requested[addr]; ok && time.Since(t) < RELAY_CONNECT_INTERVAL {
+		this.lock.Unlock()
+		return
+	}
+	this.requested[addr] = time.Now()
+	this.lock.Unlock()
+
+	msg := &msgTypes.RelayConnect{Target: addr}
+	for _, p := range this.net.GetNeighbors() {
+		go this.net.Send(p, msg)
+	}
+}
+
+//OnRelayRegister handles the relay register request from unreachable peer, accepted if the node is reachable
+func (this *RelayService) OnRelayRegister(ctx *p2p.Context) {
+	sender := ctx.Sender()
+	accepted := this.net.IsReachable()
+	if accepted {
+		this.lock.Lock()
+		_, exist := this.relayed[sender.GetID()]
+		accepted = exist || len(this.relayed) < RELAY_MAX_RELAYED
+		if accepted {
+			this.relayed[sender.GetID()] = sender.Info.RemoteListenAddress()
+		}
+		this.lock.Unlock()
+	}
+	log.Debugf("[relay] relay register from %s, accepted: %v", sender.GetAddr(), accepted)
+	err := sender.Send(&msgTypes.RelayAck{Accepted: accepted})
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+//OnRelayAck handles the relay register response
+func (this *RelayService) OnRelayAck(ctx *p2p.Context, ack *msgTypes.RelayAck) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, ok := this.relays[ctx.Sender().GetID()]; !ok {
+		return
+	}
+	//rejected relays are kept as false, so they are not asked again until reconnected
+	this.relays[ctx.Sender().GetID()] = ack.Accepted
+}
+
+//OnRelayConnect forward the connect back request to the relayed peer listening on target address
+func (this *RelayService) OnRelayConnect(ctx *p2p.Context, req *msgTypes.RelayConnect) {
+	var target common.PeerId
+	found := false
+	this.lock.Lock()
+	for id, addr := range this.relayed {
+		if addr == req.Target {
+			target, found = id, true
+			break
+		}
+	}
+	this.lock.Unlock()
+	if !found {
+		return
+	}
+	p := this.net.GetPeer(target)
+	if p == nil {
+		return
+	}
+	requester := ctx.Sender().Info.RemoteListenAddress()
+	log.Debugf("[relay] relay connect back request from %s to %s", requester, req.Target)
+	err := p.Send(&msgTypes.ConnectBack{Addr: requester})
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+//OnConnectBack dial the requester, only accepted from relays to avoid being used to dial arbitrary addresses
+func (this *RelayService) OnConnectBack(ctx *p2p.Context, req *msgTypes.ConnectBack) {
+	this.lock.Lock()
+	accepted := this.relays[ctx.Sender().GetID()]
+	this.lock.Unlock()
+	if !accepted || this.net.IsOwnAddress(req.Addr) {
+		return
+	}
+	go this.net.Connect(req.Addr)
+}
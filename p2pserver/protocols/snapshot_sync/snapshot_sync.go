@@ -0,0 +1,408 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package snapshot_sync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/core/ledger"
+	"github.com/saveio/themis/core/types"
+	p2pComm "github.com/saveio/themis/p2pserver/common"
+	msgpack "github.com/saveio/themis/p2pserver/message/msg_pack"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
+	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer"
+	"github.com/saveio/themis/p2pserver/protocols/block_sync"
+)
+
+const (
+	SNAPSHOT_SYNC_MIN_GAP           = 1000             //Only sync snapshot when it is ahead of current block more than SNAPSHOT_SYNC_MIN_GAP
+	SNAPSHOT_SYNC_MIN_AGREED_PEERS  = 2                //Snapshot is accepted when offered by SNAPSHOT_SYNC_MIN_AGREED_PEERS peers, or all peers if less
+	SNAPSHOT_SYNC_DISCOVERY_TIMEOUT = 30 * time.Second //Fall back to block sync if no snapshot accepted after SNAPSHOT_SYNC_DISCOVERY_TIMEOUT
+	SNAPSHOT_SYNC_REQUEST_TIMEOUT   = 10 * time.Second //Request manifest, chunk or block again if no response after SNAPSHOT_SYNC_REQUEST_TIMEOUT
+	SNAPSHOT_SYNC_MAX_FLIGHT_CHUNKS = 8                //Number of chunks on flight
+	SNAPSHOT_SYNC_MAX_FAILED_TIMES  = 3                //Fall back to block sync after importing snapshot failed SNAPSHOT_SYNC_MAX_FAILED_TIMES
+)
+
+type syncState int
+
+const (
+	stateDiscover syncState = iota //Collect snapshot manifests from peers
+	stateDownload                  //Download chunks and block of the accepted snapshot
+	stateDone                      //Snapshot imported or fall back to block sync
+)
+
+//chunkFlight record the chunk request on flight
+type chunkFlight struct {
+	nodeId    p2pComm.PeerId
+	startTime time.Time
+}
+
+//SnapshotSyncMgr serve state snapshot to peers, and bootstrap the ledger from the state snapshot of peers
+//before block sync. Block sync is paused until snapshot imported or sync falls back
+type SnapshotSyncMgr struct {
+	server    p2p.P2P
+	ledger    *ledger.Ledger
+	blockSync *block_sync.BlockSyncMgr
+	enable    bool
+
+	lock         sync.Mutex
+	state        syncState
+	startTime    time.Time
+	failedTimes  int
+	asked        map[p2pComm.PeerId]time.Time            //Map NodeID => manifest request time
+	offers       map[p2pComm.PeerId]*types.StateSnapshot //Map NodeID => offered snapshot
+	rejected     map[common.Uint256]bool                 //Snapshots failed to import
+	snapshot     *types.StateSnapshot                    //The accepted snapshot
+	providers    []p2pComm.PeerId                        //Peers offered the accepted snapshot
+	nextProvider int                                     //Using for polling providers
+	chunks       [][]byte                                //Received chunks of accepted snapshot
+	received     int                                     //Count of received chunks
+	flightChunks map[uint32]*chunkFlight                 //Map chunk index => flight
+	block        *types.Block                            //Block at snapshot height
+	blockReqTime time.Time                               //Last request time of snapshot block
+	exitCh       chan interface{}
+}
+
+//NewSnapshotSyncMgr return a SnapshotSyncMgr instance, snapshot sync is started only if enable is true
+func NewSnapshotSyncMgr(server p2p.P2P, ld *ledger.Ledger, blockSync *block_sync.BlockSyncMgr, enable bool) *SnapshotSyncMgr {
+	state := stateDone
+	if enable {
+		state = stateDiscover
+	}
+	return &SnapshotSyncMgr{
+		server:       server,
+		ledger:       ld,
+		blockSync:    blockSync,
+		enable:       enable,
+		state:        state,
+		asked:        make(map[p2pComm.PeerId]time.Time),
+		offers:       make(map[p2pComm.PeerId]*types.StateSnapshot),
+		rejected:     make(map[common.Uint256]bool),
+		flightChunks: make(map[uint32]*chunkFlight),
+		exitCh:       make(chan interface{}, 1),
+	}
+}
+
+//Start to sync snapshot
+func (this *SnapshotSyncMgr) Start() {
+	if !this.enable {
+		return
+	}
+	this.lock.Lock()
+	this.startTime = time.Now()
+	this.lock.Unlock()
+	this.blockSync.PauseBlockSync()
+	log.Infof("[snapshot-sync] start state snapshot sync")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.exitCh:
+			return
+		case <-ticker.C:
+			if this.step() {
+				return
+			}
+		}
+	}
+}
+
+//Stop to sync
+func (this *SnapshotSyncMgr) Stop() {
+	close(this.exitCh)
+}
+
+//IsSyncing return whether snapshot sync is in progress
+func (this *SnapshotSyncMgr) IsSyncing() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.state != stateDone
+}
+
+//step drive the sync state machine, return true when sync is done
+func (this *SnapshotSyncMgr) step() bool {
+	this.lock.Lock()
+	switch this.state {
+	case stateDiscover:
+		this.discover()
+	case stateDownload:
+		if this.received == len(this.chunks) && this.block != nil {
+			this.lock.Unlock()
+			this.importSnapshot()
+			return !this.IsSyncing()
+		}
+		this.download()
+	}
+	done := this.state == stateDone
+	this.lock.Unlock()
+	return done
+}
+
+//discover request manifests from peers, and accept the highest snapshot agreed by enough peers
+func (this *SnapshotSyncMgr) discover() {
+	if time.Since(this.startTime) >= SNAPSHOT_SYNC_DISCOVERY_TIMEOUT {
+		log.Infof("[snapshot-sync] no state snapshot available, fall back to block sync")
+		this.finishLocked()
+		return
+	}
+	peers := this.server.GetNeighbors()
+	curBlockHeight := this.ledger.GetCurrentBlockHeight()
+	for _, p := range peers {
+		if uint64(curBlockHeight)+SNAPSHOT_SYNC_MIN_GAP > p.GetHeight() {
+			continue
+		}
+		if t, ok := this.asked[p.GetID()]; ok && time.Since(t) < SNAPSHOT_SYNC_REQUEST_TIMEOUT {
+			continue
+		}
+		this.asked[p.GetID()] = time.Now()
+		go this.server.Send(p, msgpack.NewStateSnapshotReq(0))
+	}
+
+	minAgreed := SNAPSHOT_SYNC_MIN_AGREED_PEERS
+	if len(peers) < minAgreed {
+		minAgreed = len(peers)
+	}
+	groups := make(map[common.Uint256][]p2pComm.PeerId)
+	var best *types.StateSnapshot
+	var bestHash common.Uint256
+	for id, snapshot := range this.offers {
+		hash := snapshot.Hash()
+		if this.rejected[hash] || snapshot.Height < curBlockHeight+SNAPSHOT_SYNC_MIN_GAP ||
+			!config.IsStateCheckpoint(snapshot.Height) {
+			continue
+		}
+		groups[hash] = append(groups[hash], id)
+		if minAgreed > 0 && len(groups[hash]) >= minAgreed && (best == nil || snapshot.Height > best.Height) {
+			best, bestHash = snapshot, hash
+		}
+	}
+	if best == nil {
+		return
+	}
+	log.Infof("[snapshot-sync] accept state snapshot height:%d, chunks:%d, state merkle root:%s, offered by %d peers",
+		best.Height, len(best.ChunkHashes), best.StateMerkleRoot.ToHexString(), len(groups[bestHash]))
+	this.snapshot = best
+	this.providers = groups[bestHash]
+	this.nextProvider = 0
+	this.chunks = make([][]byte, len(best.ChunkHashes))
+	this.received = 0
+	this.flightChunks = make(map[uint32]*chunkFlight)
+	this.block = nil
+	this.blockReqTime = time.Time{}
+	this.state = stateDownload
+}
+
+//download request chunks and block of the accepted snapshot from providers
+func (this *SnapshotSyncMgr) download() {
+	if len(this.providers) == 0 {
+		log.Warnf("[snapshot-sync] no provider of state snapshot height:%d", this.snapshot.Height)
+		this.rejectLocked()
+		return
+	}
+	//block hash is known after header synced, headers are verified by block sync. The header STATE_CHECKPOINT_DELAY
+	//blocks after snapshot commits the state checkpoint root, so the block is requested after it synced
+	blockHash := this.ledger.GetBlockHash(this.snapshot.Height)
+	if blockHash != common.UINT256_EMPTY && blockHash != this.snapshot.BlockHash {
+		log.Warnf("[snapshot-sync] state snapshot height:%d block hash mismatch", this.snapshot.Height)
+		this.rejectLocked()
+		return
+	}
+	committedSynced := this.ledger.GetBlockHash(this.snapshot.Height+config.STATE_CHECKPOINT_DELAY) != common.UINT256_EMPTY
+	if committedSynced && this.block == nil && time.Since(this.blockReqTime) >= SNAPSHOT_SYNC_REQUEST_TIMEOUT {
+		if p := this.nextProviderPeer(); p != nil {
+			this.blockReqTime = time.Now()
+			this.blockSync.OnBlockRequested(p.GetID(), blockHash)
+			go this.server.Send(p, msgpack.NewBlkDataReq(blockHash))
+		}
+	}
+
+	for index, flight := range this.flightChunks {
+		if time.Since(flight.startTime) >= SNAPSHOT_SYNC_REQUEST_TIMEOUT {
+			log.Debugf("[snapshot-sync] chunk %d from %s timeout", index, flight.nodeId.ToHexString())
+			delete(this.flightChunks, index)
+		}
+	}
+	for index := range this.chunks {
+		if len(this.flightChunks) >= SNAPSHOT_SYNC_MAX_FLIGHT_CHUNKS {
+			break
+		}
+		if this.chunks[index] != nil || this.flightChunks[uint32(index)] != nil {
+			continue
+		}
+		p := this.nextProviderPeer()
+		if p == nil {
+			return
+		}
+		this.flightChunks[uint32(index)] = &chunkFlight{nodeId: p.GetID(), startTime: time.Now()}
+		go this.server.Send(p, msgpack.NewStateChunkReq(this.snapshot.Height, uint32(index)))
+	}
+}
+
+func (this *SnapshotSyncMgr) importSnapshot() {
+	this.lock.Lock()
+	snapshot, block, chunks := this.snapshot, this.block, this.chunks
+	this.lock.Unlock()
+
+	err := this.ledger.ImportStateSnapshot(block, snapshot, chunks)
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if err != nil {
+		log.Errorf("[snapshot-sync] import state snapshot height:%d error:%s", snapshot.Height, err)
+		this.failedTimes++
+		if this.failedTimes >= SNAPSHOT_SYNC_MAX_FAILED_TIMES {
+			this.finishLocked()
+			return
+		}
+		this.rejectLocked()
+		return
+	}
+	this.finishLocked()
+}
+
+//rejectLocked drop the accepted snapshot and discover again
+func (this *SnapshotSyncMgr) rejectLocked() {
+	this.rejected[this.snapshot.Hash()] = true
+	this.snapshot = nil
+	this.chunks = nil
+	this.block = nil
+	this.state = stateDiscover
+	this.startTime = time.Now()
+}
+
+//finishLocked stop snapshot sync, and continue block sync from current block height
+func (this *SnapshotSyncMgr) finishLocked() {
+	this.state = stateDone
+	this.snapshot = nil
+	this.chunks = nil
+	this.block = nil
+	this.offers = make(map[p2pComm.PeerId]*types.StateSnapshot)
+	this.blockSync.ResumeBlockSync()
+	log.Infof("[snapshot-sync] state snapshot sync finished, continue block sync from height:%d",
+		this.ledger.GetCurrentBlockHeight())
+}
+
+//nextProviderPeer return the next connected provider, using polling for load balance
+func (this *SnapshotSyncMgr) nextProviderPeer() *peer.Peer {
+	for i := 0; i < len(this.providers); i++ {
+		if this.nextProvider >= len(this.providers) {
+			this.nextProvider = 0
+		}
+		id := this.providers[this.nextProvider]
+		this.nextProvider++
+		if p := this.server.GetPeer(id); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+//OnDelNode remove the offer of disconnected node
+func (this *SnapshotSyncMgr) OnDelNode(nodeId p2pComm.PeerId) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.offers, nodeId)
+	delete(this.asked, nodeId)
+	for i, id := range this.providers {
+		if id == nodeId {
+			this.providers = append(this.providers[:i], this.providers[i+1:]...)
+			break
+		}
+	}
+}
+
+//OnSnapshotReceive receive snapshot manifest from peer
+func (this *SnapshotSyncMgr) OnSnapshotReceive(fromID p2pComm.PeerId, snapshot *types.StateSnapshot) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.state != stateDiscover {
+		return
+	}
+	log.Debugf("[snapshot-sync] receive state snapshot height:%d from %s", snapshot.Height, fromID.ToHexString())
+	this.offers[fromID] = snapshot
+}
+
+//OnChunkReceive receive snapshot chunk from peer, the chunk is verified against the hash in manifest
+func (this *SnapshotSyncMgr) OnChunkReceive(fromID p2pComm.PeerId, chunk *msgTypes.StateChunk) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.state != stateDownload || chunk.Height != this.snapshot.Height || chunk.Index >= uint32(len(this.chunks)) {
+		return
+	}
+	if this.chunks[chunk.Index] != nil {
+		return
+	}
+	delete(this.flightChunks, chunk.Index)
+	if types.StateChunkHash(chunk.Data) != this.snapshot.ChunkHashes[chunk.Index] {
+		log.Warnf("[snapshot-sync] chunk %d hash mismatch from %s", chunk.Index, fromID.ToHexString())
+		for i, id := range this.providers {
+			if id == fromID {
+				this.providers = append(this.providers[:i], this.providers[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	this.chunks[chunk.Index] = chunk.Data
+	this.received++
+	log.Debugf("[snapshot-sync] receive chunk %d/%d of state snapshot height:%d", this.received, len(this.chunks), chunk.Height)
+}
+
+//OnBlockReceive receive the block at snapshot height, return true if the block is consumed by snapshot sync
+func (this *SnapshotSyncMgr) OnBlockReceive(block *types.Block) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.state != stateDownload || block.Hash() != this.snapshot.BlockHash {
+		return false
+	}
+	this.block = block
+	return true
+}
+
+//SnapshotReqHandle handles the state snapshot manifest request from peer
+func (this *SnapshotSyncMgr) SnapshotReqHandle(ctx *p2p.Context, req *msgTypes.StateSnapshotReq) {
+	snapshot, err := this.ledger.GetStateSnapshot(req.Height)
+	if err != nil {
+		log.Debugf("[snapshot-sync] get state snapshot height:%d error:%s", req.Height, err)
+		return
+	}
+	err = ctx.Sender().Send(msgpack.NewStateSnapshot(snapshot))
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+//ChunkReqHandle handles the state snapshot chunk request from peer
+func (this *SnapshotSyncMgr) ChunkReqHandle(ctx *p2p.Context, req *msgTypes.StateChunkReq) {
+	data, err := this.ledger.GetStateSnapshotChunk(req.Height, req.Index)
+	if err != nil {
+		log.Debugf("[snapshot-sync] get state snapshot height:%d chunk:%d error:%s", req.Height, req.Index, err)
+		return
+	}
+	err = ctx.Sender().Send(msgpack.NewStateChunk(req.Height, req.Index, data))
+	if err != nil {
+		log.Warn(err)
+	}
+}
@@ -0,0 +1,345 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package tx_gossip
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/core/ledger"
+	"github.com/saveio/themis/core/types"
+	p2pComm "github.com/saveio/themis/p2pserver/common"
+	msgpack "github.com/saveio/themis/p2pserver/message/msg_pack"
+	msgTypes "github.com/saveio/themis/p2pserver/message/types"
+	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer"
+)
+
+const (
+	TX_GOSSIP_KNOWN_CACHE_SIZE = 4096                   //Max transaction hashes remembered as known by each peer
+	TX_GOSSIP_RELAY_CACHE_SIZE = 10000                  //Max transactions kept for serving fetch requests of peers
+	TX_GOSSIP_MAX_QUEUE_SIZE   = 4096                   //Max announcements queued for each peer, new ones are dropped when full
+	TX_GOSSIP_FLUSH_INTERVAL   = 100 * time.Millisecond //Announcements queued are sent in batch every TX_GOSSIP_FLUSH_INTERVAL
+	TX_GOSSIP_FETCH_TIMEOUT    = 5 * time.Second        //Fetch transaction again from other announcer if not received after TX_GOSSIP_FETCH_TIMEOUT
+	TX_GOSSIP_MAX_ANNOUNCERS   = 4                      //Max other announcers remembered for fetching a transaction again
+)
+
+//peerState record the transactions known by peer and the announcements waiting to send
+type peerState struct {
+	known *lru.Cache
+	queue []common.Uint256
+}
+
+//txFetch record the fetching transaction and the other peers announced it
+type txFetch struct {
+	time       time.Time
+	announcers []p2pComm.PeerId //Peers announced the transaction and not fetched from yet
+}
+
+//TxGossip propagate transactions by announcing the hashes with inventory, peers fetch only the unknown
+//transactions with data request. The peers of old version receive the full transactions instead.
+type TxGossip struct {
+	server p2p.P2P
+	ledger *ledger.Ledger
+	fanout int
+	seen   func(hash common.Uint256) bool //Whether transaction has been received
+	relay  *lru.Cache                     //Map tx hash => *types.Transaction announced to peers
+
+	lock      sync.Mutex
+	peers     map[p2pComm.PeerId]*peerState
+	requested map[common.Uint256]*txFetch //Map tx hash => fetching state
+	quit      chan bool
+}
+
+//NewTxGossip return TxGossip, the transaction is announced to at most fanout peers, 0 means all peers.
+//The ledger is optional, only the relayed transactions are known and served if ld is nil
+func NewTxGossip(server p2p.P2P, ld *ledger.Ledger, fanout uint, seen func(hash common.Uint256) bool) *TxGossip {
+	relay, _ := lru.New(TX_GOSSIP_RELAY_CACHE_SIZE)
+	return &TxGossip{
+		server:    server,
+		ledger:    ld,
+		fanout:    int(fanout),
+		seen:      seen,
+		relay:     relay,
+		peers:     make(map[p2pComm.PeerId]*peerState),
+		requested: make(map[common.Uint256]*txFetch),
+		quit:      make(chan bool),
+	}
+}
+
+func (this *TxGossip) Start() {
+	ticker := time.NewTicker(TX_GOSSIP_FLUSH_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.flush()
+		case <-this.quit:
+			return
+		}
+	}
+}
+
+func (this *TxGossip) Stop() {
+	close(this.quit)
+}
+
+func (this *TxGossip) OnAddPeer(id p2pComm.PeerId) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.getPeerLocked(id)
+}
+
+func (this *TxGossip) OnDelPeer(id p2pComm.PeerId) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.peers, id)
+}
+
+func (this *TxGossip) getPeerLocked(id p2pComm.PeerId) *peerState {
+	state, ok := this.peers[id]
+	if !ok {
+		known, _ := lru.New(TX_GOSSIP_KNOWN_CACHE_SIZE)
+		state = &peerState{known: known}
+		this.peers[id] = state
+	}
+	return state
+}
+
+//Announce queue the transaction hash to the peers not knowing it, and keep the transaction for their fetching
+func (this *TxGossip) Announce(tx *types.Transaction) {
+	hash := tx.Hash()
+	this.relay.Add(hash, tx)
+
+	neighbors := this.server.GetNeighbors()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	var targets []*peerState
+	for _, p := range neighbors {
+		state := this.getPeerLocked(p.GetID())
+		if !state.known.Contains(hash) {
+			targets = append(targets, state)
+		}
+	}
+	if this.fanout > 0 && len(targets) > this.fanout {
+		rand.Shuffle(len(targets), func(i, j int) {
+			targets[i], targets[j] = targets[j], targets[i]
+		})
+		targets = targets[:this.fanout]
+	}
+	for _, state := range targets {
+		if len(state.queue) >= TX_GOSSIP_MAX_QUEUE_SIZE {
+			log.Debugf("[tx-gossip] announce queue full, drop tx %s", hash.ToHexString())
+			continue
+		}
+		state.known.Add(hash, nil)
+		state.queue = append(state.queue, hash)
+	}
+}
+
+//flush send the queued announcements to each peer in batch, and fetch the transactions timeout from other announcers
+func (this *TxGossip) flush() {
+	this.lock.Lock()
+	queues := make(map[p2pComm.PeerId][]common.Uint256)
+	for id, state := range this.peers {
+		if len(state.queue) != 0 {
+			queues[id] = state.queue
+			state.queue = nil
+		}
+	}
+	now := time.Now()
+	refetches := make(map[p2pComm.PeerId][]common.Uint256)
+	for hash, fetch := range this.requested {
+		if now.Sub(fetch.time) < TX_GOSSIP_FETCH_TIMEOUT {
+			continue
+		}
+		if len(fetch.announcers) == 0 {
+			delete(this.requested, hash)
+			continue
+		}
+		id := fetch.announcers[0]
+		fetch.announcers = fetch.announcers[1:]
+		fetch.time = now
+		refetches[id] = append(refetches[id], hash)
+	}
+	this.lock.Unlock()
+
+	for id, queue := range queues {
+		p := this.server.GetPeer(id)
+		if p == nil {
+			continue
+		}
+		if !p.SupportTxGossip() {
+			go this.sendTxs(p, queue)
+			continue
+		}
+		go func(queue []common.Uint256) {
+			for len(queue) != 0 {
+				n := len(queue)
+				if n > p2pComm.MAX_INV_BLK_CNT {
+					n = p2pComm.MAX_INV_BLK_CNT
+				}
+				err := this.server.Send(p, msgpack.NewInv(msgpack.NewInvPayload(common.TRANSACTION, queue[:n])))
+				if err != nil {
+					log.Debugf("[tx-gossip] announce to peer %s error: %s", p.GetAddr(), err)
+					return
+				}
+				queue = queue[n:]
+			}
+		}(queue)
+	}
+	for id, hashes := range refetches {
+		if p := this.server.GetPeer(id); p != nil {
+			log.Debugf("[tx-gossip] fetch %d transactions again from peer %s", len(hashes), p.GetAddr())
+			go this.fetch(p, hashes)
+		}
+	}
+}
+
+//sendTxs send the full transactions to the peer of old version, which only fetch the first hash of inventory
+func (this *TxGossip) sendTxs(p *peer.Peer, hashes []common.Uint256) {
+	for _, hash := range hashes {
+		tx, ok := this.relay.Get(hash)
+		if !ok {
+			continue
+		}
+		err := this.server.Send(p, msgpack.NewTxn(tx.(*types.Transaction)))
+		if err != nil {
+			log.Debugf("[tx-gossip] send tx to peer %s error: %s", p.GetAddr(), err)
+			return
+		}
+	}
+}
+
+func (this *TxGossip) fetch(p *peer.Peer, hashes []common.Uint256) {
+	for _, hash := range hashes {
+		err := p.Send(msgpack.NewTxnDataReq(hash))
+		if err != nil {
+			log.Warn(err)
+			return
+		}
+	}
+}
+
+//isKnown return whether the transaction is received or committed, it may query ledger so should not be
+//called with lock held
+func (this *TxGossip) isKnown(hash common.Uint256) bool {
+	if this.relay.Contains(hash) || (this.seen != nil && this.seen(hash)) {
+		return true
+	}
+	if this.ledger == nil {
+		return false
+	}
+	exist, err := this.ledger.IsContainTransaction(hash)
+	return err == nil && exist
+}
+
+//addAnnouncerLocked remember the peer announced the fetching transaction, return false if not fetching
+func (this *TxGossip) addAnnouncerLocked(hash common.Uint256, id p2pComm.PeerId) bool {
+	fetch, ok := this.requested[hash]
+	if !ok {
+		return false
+	}
+	if len(fetch.announcers) < TX_GOSSIP_MAX_ANNOUNCERS {
+		fetch.announcers = append(fetch.announcers, id)
+	}
+	return true
+}
+
+//OnInvReceive handles the transaction announcements from peer, fetch the unknown transactions
+func (this *TxGossip) OnInvReceive(ctx *p2p.Context, hashes []common.Uint256) {
+	remotePeer := ctx.Sender()
+	id := remotePeer.GetID()
+	var unknown []common.Uint256
+	this.lock.Lock()
+	state := this.getPeerLocked(id)
+	for _, hash := range hashes {
+		state.known.Add(hash, nil)
+		if !this.addAnnouncerLocked(hash, id) {
+			unknown = append(unknown, hash)
+		}
+	}
+	this.lock.Unlock()
+
+	var candidates []common.Uint256
+	for _, hash := range unknown {
+		if !this.isKnown(hash) {
+			candidates = append(candidates, hash)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	var fetches []common.Uint256
+	this.lock.Lock()
+	now := time.Now()
+	for _, hash := range candidates {
+		//fetched from another announcer meanwhile
+		if this.addAnnouncerLocked(hash, id) {
+			continue
+		}
+		this.requested[hash] = &txFetch{time: now}
+		fetches = append(fetches, hash)
+	}
+	this.lock.Unlock()
+
+	this.fetch(remotePeer, fetches)
+}
+
+//OnTxReceive record the transaction is known by the sender
+func (this *TxGossip) OnTxReceive(fromID p2pComm.PeerId, hash common.Uint256) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.getPeerLocked(fromID).known.Add(hash, nil)
+	delete(this.requested, hash)
+}
+
+func (this *TxGossip) getLedgerTx(hash common.Uint256) *types.Transaction {
+	if this.ledger == nil {
+		return nil
+	}
+	tx, err := this.ledger.GetTransaction(hash)
+	if err != nil {
+		return nil
+	}
+	return tx
+}
+
+//DataReqHandle handles the transaction fetch request from peer
+func (this *TxGossip) DataReqHandle(ctx *p2p.Context, hash common.Uint256) {
+	remotePeer := ctx.Sender()
+	var msg msgTypes.Message
+	if tx, ok := this.relay.Get(hash); ok {
+		msg = msgpack.NewTxn(tx.(*types.Transaction))
+	} else if tx := this.getLedgerTx(hash); tx != nil {
+		msg = msgpack.NewTxn(tx)
+	} else {
+		log.Debug("[p2p]Can't get transaction by hash: ", hash, " ,send not found message")
+		msg = msgpack.NewNotFound(hash)
+	}
+	err := remotePeer.Send(msg)
+	if err != nil {
+		log.Warn(err)
+	}
+}
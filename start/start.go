@@ -31,6 +31,7 @@ import (
 	"github.com/saveio/themis/http/nodeinfo"
 	"github.com/saveio/themis/http/restful"
 	"github.com/saveio/themis/http/websocket"
+	"github.com/saveio/themis/miner"
 	"github.com/saveio/themis/p2pserver"
 	netreqactor "github.com/saveio/themis/p2pserver/actor/req"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
@@ -83,6 +84,12 @@ func StartThemis(ctx *cli.Context) {
 		return
 	}
 
+	err = InitMiner(ctx, txpool, acc)
+	if err != nil {
+		log.Errorf("initMiner error: %s", err)
+		return
+	}
+
 	err = InitRpc(ctx)
 	if err != nil {
 		log.Errorf("initRpc error: %s", err)
@@ -99,7 +106,7 @@ func StartThemis(ctx *cli.Context) {
 	InitNodeInfo(ctx, p2pSvr)
 
 	go LogCurrBlockHeight()
-	waitToExit(ldg)
+	waitToExit(ldg, txpool)
 }
 
 func initLog(ctx *cli.Context) {
@@ -166,10 +173,18 @@ func InitLedger(ctx *cli.Context, stateHashHeight uint32) (*ledger.Ledger, error
 
 	var err error
 	dbDir := utils.GetStoreDirPath(config.DefConfig.Common.DataDir, config.DefConfig.P2PNode.NetworkName)
+	if config.DefConfig.Common.LightMode {
+		//header only store must not be reused by full node
+		dbDir += "_light"
+	}
 	ledger.DefLedger, err = ledger.NewLedger(dbDir, stateHashHeight)
 	if err != nil {
 		return nil, fmt.Errorf("NewLedger error: %s", err)
 	}
+	if config.DefConfig.Common.LightMode {
+		ledger.DefLedger.EnableLightMode()
+		log.Infof("Ledger runs in light mode")
+	}
 	bookKeepers, err := config.DefConfig.GetBookkeepers()
 	if err != nil {
 		return nil, fmt.Errorf("GetBookkeepers error: %s", err)
@@ -183,6 +198,22 @@ func InitLedger(ctx *cli.Context, stateHashHeight uint32) (*ledger.Ledger, error
 	if err != nil {
 		return nil, fmt.Errorf("init ledger error: %s", err)
 	}
+	if interval := config.DefConfig.Common.StateSnapshotInterval; interval > 0 {
+		if interval%config.STATE_CHECKPOINT_INTERVAL != 0 {
+			return nil, fmt.Errorf("state snapshot interval must be a multiple of %d", config.STATE_CHECKPOINT_INTERVAL)
+		}
+		ledger.DefLedger.EnableStateSnapshot(uint32(interval))
+	}
+	if config.DefConfig.Common.ArchiveMode {
+		if err := ledger.DefLedger.EnableArchiveMode(); err != nil {
+			return nil, fmt.Errorf("enable archive mode error: %s", err)
+		}
+		log.Infof("Ledger runs in archive mode")
+	}
+	if retention := config.DefConfig.Common.StateRetention; retention > 0 {
+		ledger.DefLedger.EnableStatePrune(uint32(retention))
+		log.Infof("Ledger prunes state history older than %d blocks", retention)
+	}
 
 	log.Infof("Ledger init success")
 	return ledger.DefLedger, nil
@@ -203,6 +234,14 @@ func InitTxPool(ctx *cli.Context) (*proc.TXPoolServer, error) {
 	stfValidator, _ := stateful.NewValidator("stateful_validator")
 	stfValidator.Register(txPoolServer.GetPID(tc.VerifyRspActor))
 
+	// reload journal after validators registered, the reloaded items are verified again
+	if !ctx.GlobalBool(utils.GetFlagName(utils.DisableTxPoolJournalFlag)) {
+		dbDir := utils.GetStoreDirPath(config.DefConfig.Common.DataDir, config.DefConfig.P2PNode.NetworkName)
+		if err := txPoolServer.EnableJournal(filepath.Join(dbDir, "txpool")); err != nil {
+			return nil, fmt.Errorf("init txpool journal error: %s", err)
+		}
+	}
+
 	bactor.SetTxnPoolPid(txPoolServer.GetPID(tc.TxPoolActor))
 	bactor.SetTxPid(txPoolServer.GetPID(tc.TxActor))
 
@@ -211,7 +250,8 @@ func InitTxPool(ctx *cli.Context) (*proc.TXPoolServer, error) {
 }
 
 func InitP2PNode(ctx *cli.Context, txpoolSvr *proc.TXPoolServer, acct *account.Account) (*p2pserver.P2PServer, p2p.P2P, error) {
-	if config.DefConfig.Genesis.ConsensusType == config.CONSENSUS_TYPE_SOLO {
+	if config.DefConfig.Genesis.ConsensusType == config.CONSENSUS_TYPE_SOLO ||
+		config.DefConfig.Genesis.ConsensusType == config.CONSENSUS_TYPE_DEVNET {
 		return nil, nil, nil
 	}
 	p2p, err := p2pserver.NewServer(acct)
@@ -226,6 +266,9 @@ func InitP2PNode(ctx *cli.Context, txpoolSvr *proc.TXPoolServer, acct *account.A
 	netreqactor.SetTxnPoolPid(txpoolSvr.GetPID(tc.TxActor))
 	txpoolSvr.Net = p2p.GetNetwork()
 	bactor.SetNetServer(p2p.GetNetwork())
+	if config.DefConfig.Common.LightMode {
+		bactor.SetLightClient(p2p.GetLightClient())
+	}
 	p2p.WaitForPeersStart()
 	log.Infof("P2P init success")
 	return p2p, p2p.GetNetwork(), nil
@@ -251,6 +294,29 @@ func InitConsensus(ctx *cli.Context, p2p p2p.P2P, txpoolSvr *proc.TXPoolServer,
 	return consensusService, nil
 }
 
+func InitMiner(ctx *cli.Context, txpoolSvr *proc.TXPoolServer, acc *account.Account) error {
+	if !config.DefConfig.PoC.EnableMining {
+		return nil
+	}
+	//account is not loaded if consensus is not enabled
+	if acc == nil {
+		var err error
+		acc, err = cmdcom.GetAccount(ctx)
+		if err != nil {
+			return fmt.Errorf("get account error: %s", err)
+		}
+	}
+	m, err := miner.NewMiner(acc, config.DefConfig.PoC, txpoolSvr.GetPID(tc.TxActor))
+	if err != nil {
+		return err
+	}
+	m.Start()
+	bactor.SetMiner(m)
+
+	log.Infof("Miner init success")
+	return nil
+}
+
 func InitRpc(ctx *cli.Context) error {
 	if !config.DefConfig.Rpc.EnableHttpJsonRpc {
 		return nil
@@ -328,8 +394,8 @@ func InitWs(ctx *cli.Context) {
 }
 
 func InitNodeInfo(ctx *cli.Context, p2pSvr *p2pserver.P2PServer) {
-	// testmode has no p2pserver(see function initP2PNode for detail), simply ignore httpInfoPort in testmode
-	if ctx.Bool(utils.GetFlagName(utils.EnableTestModeFlag)) || config.DefConfig.P2PNode.HttpInfoPort == 0 {
+	// testmode and devnet have no p2pserver(see function initP2PNode for detail), simply ignore httpInfoPort
+	if ctx.Bool(utils.GetFlagName(utils.EnableTestModeFlag)) || p2pSvr == nil || config.DefConfig.P2PNode.HttpInfoPort == 0 {
 		return
 	}
 	go nodeinfo.StartServer(p2pSvr.GetNetwork())
@@ -362,13 +428,15 @@ func setMaxOpenFiles() {
 	}
 }
 
-func waitToExit(db *ledger.Ledger) {
+func waitToExit(db *ledger.Ledger, txpool *proc.TXPoolServer) {
 	exit := make(chan bool, 0)
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
 		for sig := range sc {
 			log.Infof("Themis received exit signal: %v.", sig.String())
+			log.Infof("saving tx pool journal...")
+			txpool.CloseJournal()
 			log.Infof("closing ledger...")
 			db.Close()
 			close(exit)
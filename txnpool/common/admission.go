@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"bytes"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/config"
+	"github.com/saveio/themis/common/log"
+	"github.com/saveio/themis/core/payload"
+	"github.com/saveio/themis/core/types"
+	cutils "github.com/saveio/themis/core/utils"
+	"github.com/saveio/themis/smartcontract/states"
+	"github.com/saveio/themis/vm/neovm"
+)
+
+// AdmissionPolicy limits the transactions entering the pool, a zero
+// limit means unlimited.
+type AdmissionPolicy struct {
+	MaxPoolSize        int                    // Max transactions in pool, the lowest fee ones are evicted
+	MaxPendingPerPayer int                    // Max transactions in pool for a payer
+	ContractQuota      int                    // Max transactions in pool invoking a contract
+	ContractQuotas     map[common.Address]int // Quota for specific contracts
+}
+
+// NewAdmissionPolicy creates an admission policy with the tx pool config.
+func NewAdmissionPolicy(cfg *config.TxPoolConfig) *AdmissionPolicy {
+	policy := &AdmissionPolicy{
+		MaxPoolSize:    MAX_CAPACITY,
+		ContractQuotas: make(map[common.Address]int),
+	}
+	if cfg == nil {
+		return policy
+	}
+	if cfg.MaxPoolSize > 0 {
+		policy.MaxPoolSize = int(cfg.MaxPoolSize)
+	}
+	policy.MaxPendingPerPayer = int(cfg.MaxPendingPerPayer)
+	policy.ContractQuota = int(cfg.ContractQuota)
+	for contract, quota := range cfg.ContractQuotas {
+		addr, err := common.AddressFromHexString(contract)
+		if err != nil {
+			log.Warnf("NewAdmissionPolicy: invalid contract address %s: %s", contract, err)
+			continue
+		}
+		policy.ContractQuotas[addr] = int(quota)
+	}
+	return policy
+}
+
+// contractQuota returns the quota of the contract.
+func (policy *AdmissionPolicy) contractQuota(contract common.Address) int {
+	if quota, ok := policy.ContractQuotas[contract]; ok {
+		return quota
+	}
+	return policy.ContractQuota
+}
+
+var nativeInvokeSuffix = append([]byte{byte(neovm.SYSCALL), byte(len(cutils.NATIVE_INVOKE_NAME))},
+	[]byte(cutils.NATIVE_INVOKE_NAME)...)
+
+// GetInvokedContract returns the contract address that a transaction invokes
+// directly, and false if it is not recognized.
+func GetInvokedContract(tx *types.Transaction) (common.Address, bool) {
+	invoke, ok := tx.Payload.(*payload.InvokeCode)
+	if !ok {
+		return common.ADDRESS_EMPTY, false
+	}
+	code := invoke.Code
+
+	switch tx.TxType {
+	case types.InvokeWasm:
+		param := &states.WasmContractParam{}
+		if err := param.Deserialization(common.NewZeroCopySource(code)); err != nil {
+			return common.ADDRESS_EMPTY, false
+		}
+		return param.Address, true
+	case types.InvokeNeo:
+		// native invoke: ... PUSHBYTES20 <address> <version> SYSCALL "Ontology.Native.Invoke"
+		if bytes.HasSuffix(code, nativeInvokeSuffix) {
+			end := len(code) - len(nativeInvokeSuffix) - 1
+			if end-common.ADDR_LEN-1 < 0 || code[end-common.ADDR_LEN-1] != common.ADDR_LEN {
+				return common.ADDRESS_EMPTY, false
+			}
+			addr, err := common.AddressParseFromBytes(code[end-common.ADDR_LEN : end])
+			return addr, err == nil
+		}
+		// neovm invoke: ... APPCALL <address>
+		start := len(code) - common.ADDR_LEN - 1
+		if start >= 0 && code[start] == byte(neovm.APPCALL) {
+			addr, err := common.AddressParseFromBytes(code[start+1:])
+			return addr, err == nil
+		}
+	}
+	return common.ADDRESS_EMPTY, false
+}
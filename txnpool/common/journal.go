@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/saveio/themis/common"
+	"github.com/saveio/themis/common/log"
+)
+
+const (
+	TX_JOURNAL_FILE  = "transactions.journal" // The journal file of the transactions in pool
+	POC_JOURNAL_FILE = "poc.journal"          // The journal file of the poc params in pool
+)
+
+// Journal is an append only file keeping the items accepted by the pool,
+// so that they can be reloaded after the node restarts. Each record is
+// written as var bytes.
+type Journal struct {
+	mu     sync.Mutex
+	path   string
+	writer *os.File
+}
+
+// NewJournal creates a journal with the file path, the file is created
+// when the first record is inserted.
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Load reads all records from the journal file and calls add with each of
+// them. A truncated record at the end of file, which is left by a crash,
+// is ignored.
+func (j *Journal) Load(add func(data []byte)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	buf, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	source := common.NewZeroCopySource(buf)
+	count := 0
+	for source.Len() > 0 {
+		data, _, irregular, eof := source.NextVarBytes()
+		if irregular || eof {
+			log.Warnf("Journal.Load: %s has a broken record at offset %d, ignore the rest",
+				j.path, source.Pos())
+			break
+		}
+		add(data)
+		count++
+	}
+	log.Infof("Journal.Load: load %d records from %s", count, j.path)
+	return nil
+}
+
+// Insert appends a record to the journal file.
+func (j *Journal) Insert(data []byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.writer == nil {
+		if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+			return err
+		}
+		writer, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		j.writer = writer
+	}
+
+	sink := common.NewZeroCopySink(nil)
+	sink.WriteVarBytes(data)
+	_, err := j.writer.Write(sink.Bytes())
+	return err
+}
+
+// Rotate rewrites the journal file with the records, dropping the stale
+// records of the items which have left the pool.
+func (j *Journal) Rotate(records [][]byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.writer != nil {
+		j.writer.Close()
+		j.writer = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+
+	sink := common.NewZeroCopySink(nil)
+	for _, data := range records {
+		sink.WriteVarBytes(data)
+	}
+	tmpPath := j.path + ".new"
+	if err := ioutil.WriteFile(tmpPath, sink.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return err
+	}
+	log.Debugf("Journal.Rotate: rotate %s with %d records", j.path, len(records))
+	return nil
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.writer == nil {
+		return nil
+	}
+	err := j.writer.Close()
+	j.writer = nil
+	return err
+}
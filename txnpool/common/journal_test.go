@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2019 The themis Authors
+ * This file is part of The themis library.
+ *
+ * The themis is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The themis is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The themis.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadJournal(t *testing.T, journal *Journal) [][]byte {
+	records := make([][]byte, 0)
+	err := journal.Load(func(data []byte) {
+		records = append(records, data)
+	})
+	assert.Nil(t, err)
+	return records
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "txpool", TX_JOURNAL_FILE)
+	journal := NewJournal(path)
+	assert.Equal(t, 0, len(loadJournal(t, journal)))
+
+	assert.Nil(t, journal.Insert([]byte{1, 2, 3}))
+	assert.Nil(t, journal.Insert([]byte{4}))
+	assert.Nil(t, journal.Close())
+	assert.Equal(t, [][]byte{{1, 2, 3}, {4}}, loadJournal(t, journal))
+
+	// a record truncated by crash is ignored
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write([]byte{5, 6})
+	assert.Nil(t, err)
+	file.Close()
+	assert.Equal(t, [][]byte{{1, 2, 3}, {4}}, loadJournal(t, journal))
+
+	assert.Nil(t, journal.Rotate([][]byte{{7, 8}}))
+	assert.Nil(t, journal.Insert([]byte{9}))
+	assert.Nil(t, journal.Close())
+	assert.Equal(t, [][]byte{{7, 8}, {9}}, loadJournal(t, journal))
+}
@@ -166,6 +166,21 @@ func (pp *PoCPool) UpdateParam(newView uint32) {
 	pp.view = newView
 }
 
+// GetAllParams returns all poc params in the pool, including the future ones.
+func (pp *PoCPool) GetAllParams() []*gov.SubmitNonceParam {
+	pp.RLock()
+	defer pp.RUnlock()
+
+	params := make([]*gov.SubmitNonceParam, 0, len(pp.pocList)+len(pp.furtureList))
+	for _, entry := range pp.pocList {
+		params = append(params, entry.Param)
+	}
+	for _, entry := range pp.furtureList {
+		params = append(params, entry.Param)
+	}
+	return params
+}
+
 func (pp *PoCPool) AddFuturePoC(entry *PoCEntry) bool {
 	pp.Lock()
 	defer pp.Unlock()
@@ -20,6 +20,8 @@
 package common
 
 import (
+	"container/heap"
+	"fmt"
 	"sort"
 	"sync"
 
@@ -45,10 +47,14 @@ type TXEntry struct {
 // TXPool contains all currently valid transactions. Transactions
 // enter the pool when they are valid from the network,
 // consensus or submitted. They exit the pool when they are included
-// in the ledger.
+// in the ledger. Each payer's transactions are also indexed by nonce,
+// and at most one transaction is kept for a payer and nonce.
 type TXPool struct {
 	sync.RWMutex
-	txList map[common.Uint256]*TXEntry // Transactions which have been verified
+	txList        map[common.Uint256]*TXEntry                  // Transactions which have been verified
+	payerList     map[common.Address]map[uint32]common.Uint256 // Transaction hash indexed by payer and nonce
+	contractCount map[common.Address]int                       // Transaction count indexed by invoked contract
+	policy        *AdmissionPolicy                             // Limits of the transactions entering the pool
 }
 
 // Init creates a new transaction pool to gather.
@@ -56,10 +62,24 @@ func (tp *TXPool) Init() {
 	tp.Lock()
 	defer tp.Unlock()
 	tp.txList = make(map[common.Uint256]*TXEntry)
+	tp.payerList = make(map[common.Address]map[uint32]common.Uint256)
+	tp.contractCount = make(map[common.Address]int)
+	tp.policy = NewAdmissionPolicy(nil)
+}
+
+// SetAdmissionPolicy sets the limits of the transactions entering the pool.
+func (tp *TXPool) SetAdmissionPolicy(policy *AdmissionPolicy) {
+	tp.Lock()
+	defer tp.Unlock()
+	tp.policy = policy
 }
 
 // AddTxList adds a valid transaction to the transaction pool. If the
-// transaction is already in the pool, just return false. Parameter
+// transaction is already in the pool, just return false. If there is
+// a transaction with the same payer and nonce, the new one replaces it
+// only when its gas price is higher, otherwise return false. If the pool
+// is full, the transaction with the lowest gas price is evicted, and the
+// transaction beyond the payer or contract limits is rejected. Parameter
 // txEntry includes transaction, fee, and verified information(height,
 // validator, error code).
 func (tp *TXPool) AddTxList(txEntry *TXEntry) bool {
@@ -71,10 +91,150 @@ func (tp *TXPool) AddTxList(txEntry *TXEntry) bool {
 		return false
 	}
 
+	if old := tp.getPayerNonceTx(txEntry.Tx.Payer, txEntry.Tx.Nonce); old != nil {
+		if txEntry.Tx.GasPrice <= old.GasPrice {
+			log.Infof("AddTxList: transaction %x gas price %d is not higher than %d of %x with the same payer and nonce",
+				txHash, txEntry.Tx.GasPrice, old.GasPrice, old.Hash())
+			return false
+		}
+		log.Infof("AddTxList: transaction %x replaces %x with higher gas price %d",
+			txHash, old.Hash(), txEntry.Tx.GasPrice)
+		tp.delTx(old.Hash())
+	} else {
+		evict, err := tp.checkAdmission(txEntry.Tx)
+		if err != nil {
+			log.Infof("AddTxList: transaction %x is rejected: %s", txHash, err)
+			return false
+		}
+		if evict != nil {
+			log.Infof("AddTxList: pool is full, evict transaction %x with gas price %d",
+				evict.Hash(), evict.GasPrice)
+			tp.delTx(evict.Hash())
+		}
+	}
+
 	tp.txList[txHash] = txEntry
+	if contract, ok := GetInvokedContract(txEntry.Tx); ok {
+		tp.contractCount[contract]++
+	}
+	nonces, ok := tp.payerList[txEntry.Tx.Payer]
+	if !ok {
+		nonces = make(map[uint32]common.Uint256)
+		tp.payerList[txEntry.Tx.Payer] = nonces
+	}
+	nonces[txEntry.Tx.Nonce] = txHash
+	return true
+}
+
+// getPayerNonceTx returns the transaction with the payer and nonce in the
+// pool and nil otherwise.
+func (tp *TXPool) getPayerNonceTx(payer common.Address, nonce uint32) *types.Transaction {
+	hash, ok := tp.payerList[payer][nonce]
+	if !ok {
+		return nil
+	}
+	return tp.txList[hash].Tx
+}
+
+// CheckAdmission checks whether a transaction could enter the pool
+// regarding the admission policy.
+func (tp *TXPool) CheckAdmission(tx *types.Transaction) error {
+	tp.RLock()
+	defer tp.RUnlock()
+	if old := tp.getPayerNonceTx(tx.Payer, tx.Nonce); old != nil {
+		// replacement does not increase the payer's pending transactions
+		return nil
+	}
+	_, err := tp.checkAdmission(tx)
+	return err
+}
+
+// checkAdmission checks the payer and contract limits of a new transaction,
+// and returns the transaction to be evicted if the pool is full. The caller
+// should hold the lock.
+func (tp *TXPool) checkAdmission(tx *types.Transaction) (*types.Transaction, error) {
+	policy := tp.policy
+	if policy.MaxPendingPerPayer > 0 && len(tp.payerList[tx.Payer]) >= policy.MaxPendingPerPayer {
+		return nil, fmt.Errorf("payer %s has %d pending transactions, exceeds the limit",
+			tx.Payer.ToBase58(), len(tp.payerList[tx.Payer]))
+	}
+	if contract, ok := GetInvokedContract(tx); ok {
+		quota := policy.contractQuota(contract)
+		if quota > 0 && tp.contractCount[contract] >= quota {
+			return nil, fmt.Errorf("contract %s has %d pending transactions, exceeds the quota",
+				contract.ToHexString(), tp.contractCount[contract])
+		}
+	}
+	if policy.MaxPoolSize <= 0 || len(tp.txList) < policy.MaxPoolSize {
+		return nil, nil
+	}
+
+	evict := tp.lowestFeeTx()
+	if evict == nil {
+		return nil, fmt.Errorf("pool is full")
+	}
+	if evict.GasPrice >= tx.GasPrice {
+		return nil, fmt.Errorf("pool is full, gas price should > %d", evict.GasPrice)
+	}
+	return evict, nil
+}
+
+// lowestFeeTx returns the transaction with lowest gas price among the
+// payers' last nonce transactions, evicting it leaves no nonce gap.
+func (tp *TXPool) lowestFeeTx() *types.Transaction {
+	var lowest *types.Transaction
+	for _, nonces := range tp.payerList {
+		var last *types.Transaction
+		for nonce, hash := range nonces {
+			if last == nil || nonce > last.Nonce {
+				last = tp.txList[hash].Tx
+			}
+		}
+		if lowest == nil || last.GasPrice < lowest.GasPrice {
+			lowest = last
+		}
+	}
+	return lowest
+}
+
+// delTx removes a transaction from the pool and the payer index, the
+// caller should hold the lock.
+func (tp *TXPool) delTx(hash common.Uint256) bool {
+	txEntry, ok := tp.txList[hash]
+	if !ok {
+		return false
+	}
+	delete(tp.txList, hash)
+	if contract, ok := GetInvokedContract(txEntry.Tx); ok {
+		tp.contractCount[contract]--
+		if tp.contractCount[contract] <= 0 {
+			delete(tp.contractCount, contract)
+		}
+	}
+
+	payer, nonce := txEntry.Tx.Payer, txEntry.Tx.Nonce
+	if nonces, ok := tp.payerList[payer]; ok && nonces[nonce] == hash {
+		delete(nonces, nonce)
+		if len(nonces) == 0 {
+			delete(tp.payerList, payer)
+		}
+	}
 	return true
 }
 
+// CheckReplacement checks whether a transaction could enter the pool
+// regarding the transaction with the same payer and nonce. It returns
+// the transaction to be replaced, and false if the new one is underpriced.
+func (tp *TXPool) CheckReplacement(tx *types.Transaction) (*types.Transaction, bool) {
+	tp.RLock()
+	defer tp.RUnlock()
+	old := tp.getPayerNonceTx(tx.Payer, tx.Nonce)
+	if old == nil || old.Hash() == tx.Hash() {
+		return nil, true
+	}
+	return old, tx.GasPrice > old.GasPrice
+}
+
 // CleanTransactionList cleans the transaction list included in the ledger.
 func (tp *TXPool) CleanTransactionList(txs []*types.Transaction) error {
 	cleaned := 0
@@ -82,8 +242,12 @@ func (tp *TXPool) CleanTransactionList(txs []*types.Transaction) error {
 	tp.Lock()
 	defer tp.Unlock()
 	for _, tx := range txs {
-		if _, ok := tp.txList[tx.Hash()]; ok {
-			delete(tp.txList, tx.Hash())
+		if tp.delTx(tx.Hash()) {
+			cleaned++
+		}
+		// the nonce has been used by the transaction in the ledger
+		if old := tp.getPayerNonceTx(tx.Payer, tx.Nonce); old != nil {
+			tp.delTx(old.Hash())
 			cleaned++
 		}
 	}
@@ -97,12 +261,7 @@ func (tp *TXPool) CleanTransactionList(txs []*types.Transaction) error {
 func (tp *TXPool) DelTxList(tx *types.Transaction) bool {
 	tp.Lock()
 	defer tp.Unlock()
-	txHash := tx.Hash()
-	if _, ok := tp.txList[txHash]; !ok {
-		return false
-	}
-	delete(tp.txList, txHash)
-	return true
+	return tp.delTx(tx.Hash())
 }
 
 // compareTxHeight compares a verifed transaction's height with the next
@@ -121,16 +280,14 @@ func (tp *TXPool) compareTxHeight(txEntry *TXEntry, height uint32) bool {
 // GetTxPool gets the transaction lists from the pool for the consensus,
 // if the byCount is marked, return the configured number at most; if the
 // the byCount is not marked, return all of the current transaction pool.
+// Transactions are ordered by gas price across payers, and each payer's
+// transactions are kept in nonce order.
 func (tp *TXPool) GetTxPool(byCount bool, height uint32) ([]*TXEntry,
 	[]*types.Transaction) {
 	tp.RLock()
 	defer tp.RUnlock()
 
-	orderByFee := make([]*TXEntry, 0, len(tp.txList))
-	for _, txEntry := range tp.txList {
-		orderByFee = append(orderByFee, txEntry)
-	}
-	sort.Sort(OrderByNetWorkFee(orderByFee))
+	orderByFee := tp.orderByFeeAndNonce()
 
 	count := int(config.DefConfig.Consensus.MaxTxInBlock)
 	if count <= 0 {
@@ -158,6 +315,46 @@ func (tp *TXPool) GetTxPool(byCount bool, height uint32) ([]*TXEntry,
 	return txList, oldTxList
 }
 
+// orderByFeeAndNonce merges the payers' nonce ordered queues, always
+// taking the queue head with the highest gas price.
+func (tp *TXPool) orderByFeeAndNonce() []*TXEntry {
+	queues := make(payerQueues, 0, len(tp.payerList))
+	for _, nonces := range tp.payerList {
+		queue := make([]*TXEntry, 0, len(nonces))
+		for _, hash := range nonces {
+			queue = append(queue, tp.txList[hash])
+		}
+		sort.Sort(OrderByNonce(queue))
+		queues = append(queues, queue)
+	}
+	heap.Init(&queues)
+
+	ret := make([]*TXEntry, 0, len(tp.txList))
+	for queues.Len() > 0 {
+		ret = append(ret, queues[0][0])
+		if len(queues[0]) == 1 {
+			heap.Pop(&queues)
+		} else {
+			queues[0] = queues[0][1:]
+			heap.Fix(&queues, 0)
+		}
+	}
+	return ret
+}
+
+// GetPayerTxs returns the transactions of the payer in nonce order.
+func (tp *TXPool) GetPayerTxs(payer common.Address) []*TXEntry {
+	tp.RLock()
+	defer tp.RUnlock()
+	nonces := tp.payerList[payer]
+	ret := make([]*TXEntry, 0, len(nonces))
+	for _, hash := range nonces {
+		ret = append(ret, tp.txList[hash])
+	}
+	sort.Sort(OrderByNonce(ret))
+	return ret
+}
+
 // GetTransaction returns a transaction if it is contained in the pool
 // and nil otherwise.
 func (tp *TXPool) GetTransaction(hash common.Uint256) *types.Transaction {
@@ -224,7 +421,7 @@ func (tp *TXPool) GetUnverifiedTxs(txs []*types.Transaction,
 		}
 
 		if !tp.compareTxHeight(txEntry, height) {
-			delete(tp.txList, tx.Hash())
+			tp.delTx(tx.Hash())
 			res.OldTxs = append(res.OldTxs, txEntry.Tx)
 			continue
 		}
@@ -252,7 +449,7 @@ func (tp *TXPool) RemoveTxsBelowGasPrice(gasPrice uint64) {
 	defer tp.Unlock()
 	for _, txEntry := range tp.txList {
 		if txEntry.Tx.GasPrice < gasPrice {
-			delete(tp.txList, txEntry.Tx.Hash())
+			tp.delTx(txEntry.Tx.Hash())
 		}
 	}
 }
@@ -265,8 +462,10 @@ func (tp *TXPool) Remain() []*types.Transaction {
 	txList := make([]*types.Transaction, 0, len(tp.txList))
 	for _, txEntry := range tp.txList {
 		txList = append(txList, txEntry.Tx)
-		delete(tp.txList, txEntry.Tx.Hash())
 	}
+	tp.txList = make(map[common.Uint256]*TXEntry)
+	tp.payerList = make(map[common.Address]map[uint32]common.Uint256)
+	tp.contractCount = make(map[common.Address]int)
 
 	return txList
 }
@@ -22,9 +22,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/common/log"
 	"github.com/saveio/themis/core/payload"
 	"github.com/saveio/themis/core/types"
+	cutils "github.com/saveio/themis/core/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -99,3 +101,170 @@ func TestTxPool(t *testing.T) {
 		return
 	}
 }
+
+func newPayerTxEntry(t *testing.T, payer common.Address, nonce uint32, gasPrice uint64) *TXEntry {
+	mutable := &types.MutableTransaction{
+		TxType:   types.InvokeNeo,
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Payer:    payer,
+		Payload:  &payload.InvokeCode{Code: []byte{}},
+	}
+	tx, err := mutable.IntoImmutable()
+	assert.Nil(t, err)
+	return &TXEntry{Tx: tx, Attrs: []*TXAttr{}}
+}
+
+func mutableWithCode(t *testing.T, tx *types.Transaction, code []byte) *types.Transaction {
+	mutable, err := tx.IntoMutable()
+	assert.Nil(t, err)
+	mutable.Payload = &payload.InvokeCode{Code: code}
+	tx, err = mutable.IntoImmutable()
+	assert.Nil(t, err)
+	return tx
+}
+
+func TestTxPoolReplaceByFee(t *testing.T) {
+	txPool := &TXPool{}
+	txPool.Init()
+
+	payer := common.Address{1}
+	origin := newPayerTxEntry(t, payer, 1, 500)
+	assert.True(t, txPool.AddTxList(origin))
+
+	underpriced := newPayerTxEntry(t, payer, 1, 500)
+	underpriced.Tx = mutableWithCode(t, underpriced.Tx, []byte{1})
+	_, ok := txPool.CheckReplacement(underpriced.Tx)
+	assert.False(t, ok)
+	assert.False(t, txPool.AddTxList(underpriced))
+
+	replacement := newPayerTxEntry(t, payer, 1, 600)
+	old, ok := txPool.CheckReplacement(replacement.Tx)
+	assert.True(t, ok)
+	assert.Equal(t, origin.Tx.Hash(), old.Hash())
+	assert.True(t, txPool.AddTxList(replacement))
+	assert.Nil(t, txPool.GetTransaction(origin.Tx.Hash()))
+	assert.Equal(t, 1, txPool.GetTransactionCount())
+
+	// a transaction in the ledger consumes the payer's nonce
+	assert.Nil(t, txPool.CleanTransactionList([]*types.Transaction{origin.Tx}))
+	assert.Equal(t, 0, txPool.GetTransactionCount())
+	assert.Equal(t, 0, len(txPool.GetPayerTxs(payer)))
+}
+
+func TestTxPoolNonceOrder(t *testing.T) {
+	txPool := &TXPool{}
+	txPool.Init()
+
+	payerA, payerB := common.Address{1}, common.Address{2}
+	a1 := newPayerTxEntry(t, payerA, 1, 500)
+	a2 := newPayerTxEntry(t, payerA, 2, 2000)
+	a3 := newPayerTxEntry(t, payerA, 3, 700)
+	b1 := newPayerTxEntry(t, payerB, 5, 1000)
+	for _, entry := range []*TXEntry{a3, b1, a2, a1} {
+		assert.True(t, txPool.AddTxList(entry))
+	}
+
+	payerTxs := txPool.GetPayerTxs(payerA)
+	assert.Equal(t, 3, len(payerTxs))
+	for i, entry := range []*TXEntry{a1, a2, a3} {
+		assert.Equal(t, entry.Tx.Hash(), payerTxs[i].Tx.Hash())
+	}
+
+	txList, _ := txPool.GetTxPool(false, 0)
+	assert.Equal(t, 4, len(txList))
+	for i, entry := range []*TXEntry{b1, a1, a2, a3} {
+		assert.Equal(t, entry.Tx.Hash(), txList[i].Tx.Hash())
+	}
+
+	assert.True(t, txPool.DelTxList(a2.Tx))
+	assert.Equal(t, 2, len(txPool.GetPayerTxs(payerA)))
+	assert.Equal(t, 3, len(txPool.Remain()))
+	assert.Equal(t, 0, len(txPool.GetPayerTxs(payerB)))
+}
+
+func TestTxPoolAdmission(t *testing.T) {
+	txPool := &TXPool{}
+	txPool.Init()
+	txPool.SetAdmissionPolicy(&AdmissionPolicy{
+		MaxPoolSize:        3,
+		MaxPendingPerPayer: 2,
+	})
+
+	payerA, payerB, payerC := common.Address{1}, common.Address{2}, common.Address{3}
+	a1 := newPayerTxEntry(t, payerA, 1, 500)
+	a2 := newPayerTxEntry(t, payerA, 2, 100)
+	assert.True(t, txPool.AddTxList(a1))
+	assert.True(t, txPool.AddTxList(a2))
+
+	// payer limit
+	a3 := newPayerTxEntry(t, payerA, 3, 1000)
+	assert.NotNil(t, txPool.CheckAdmission(a3.Tx))
+	assert.False(t, txPool.AddTxList(a3))
+	// replacement is not limited
+	a2Replace := newPayerTxEntry(t, payerA, 2, 200)
+	assert.Nil(t, txPool.CheckAdmission(a2Replace.Tx))
+	assert.True(t, txPool.AddTxList(a2Replace))
+
+	b1 := newPayerTxEntry(t, payerB, 1, 300)
+	assert.True(t, txPool.AddTxList(b1))
+
+	// pool is full, the lowest fee tx at the end of payer's queue is evicted
+	c1 := newPayerTxEntry(t, payerC, 1, 150)
+	assert.NotNil(t, txPool.CheckAdmission(c1.Tx))
+	assert.False(t, txPool.AddTxList(c1))
+	c1 = newPayerTxEntry(t, payerC, 1, 250)
+	assert.Nil(t, txPool.CheckAdmission(c1.Tx))
+	assert.True(t, txPool.AddTxList(c1))
+	assert.Equal(t, 3, txPool.GetTransactionCount())
+	assert.Nil(t, txPool.GetTransaction(a2Replace.Tx.Hash()))
+	assert.NotNil(t, txPool.GetTransaction(a1.Tx.Hash()))
+}
+
+func newInvokeTxEntry(t *testing.T, payer common.Address, nonce uint32, contract common.Address) *TXEntry {
+	code, err := cutils.BuildNativeInvokeCode(contract, 0, "transfer", []interface{}{nonce})
+	assert.Nil(t, err)
+	mutable := &types.MutableTransaction{
+		TxType:  types.InvokeNeo,
+		Nonce:   nonce,
+		Payer:   payer,
+		Payload: &payload.InvokeCode{Code: code},
+	}
+	tx, err := mutable.IntoImmutable()
+	assert.Nil(t, err)
+	return &TXEntry{Tx: tx, Attrs: []*TXAttr{}}
+}
+
+func TestTxPoolContractQuota(t *testing.T) {
+	contractA, contractB := common.Address{0xa}, common.Address{0xb}
+	txPool := &TXPool{}
+	txPool.Init()
+	txPool.SetAdmissionPolicy(&AdmissionPolicy{
+		ContractQuota:  1,
+		ContractQuotas: map[common.Address]int{contractB: 2},
+	})
+
+	a1 := newInvokeTxEntry(t, common.Address{1}, 1, contractA)
+	contract, ok := GetInvokedContract(a1.Tx)
+	assert.True(t, ok)
+	assert.Equal(t, contractA, contract)
+	assert.True(t, txPool.AddTxList(a1))
+	assert.False(t, txPool.AddTxList(newInvokeTxEntry(t, common.Address{2}, 1, contractA)))
+
+	assert.True(t, txPool.AddTxList(newInvokeTxEntry(t, common.Address{1}, 2, contractB)))
+	assert.True(t, txPool.AddTxList(newInvokeTxEntry(t, common.Address{2}, 2, contractB)))
+	assert.False(t, txPool.AddTxList(newInvokeTxEntry(t, common.Address{3}, 2, contractB)))
+
+	assert.True(t, txPool.DelTxList(a1.Tx))
+	assert.True(t, txPool.AddTxList(newInvokeTxEntry(t, common.Address{2}, 1, contractA)))
+
+	neoCode, err := cutils.BuildNeoVMInvokeCode(contractB, []interface{}{"name"})
+	assert.Nil(t, err)
+	neoTx := mutableWithCode(t, a1.Tx, neoCode)
+	contract, ok = GetInvokedContract(neoTx)
+	assert.True(t, ok)
+	assert.Equal(t, contractB, contract)
+
+	_, ok = GetInvokedContract(txn)
+	assert.False(t, ok)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/saveio/themis/common"
 	"github.com/saveio/themis/core/types"
 	"github.com/saveio/themis/errors"
+	p2pcommon "github.com/saveio/themis/p2pserver/common"
 	gov "github.com/saveio/themis/smartcontract/service/native/governance"
 )
 
@@ -38,6 +39,8 @@ const (
 	MAX_LIMITATION   = 10000                            // The length of pending tx from net and http
 	UPDATE_FREQUENCY = 100                              // The frequency to update gas price from global params
 	MAX_TX_SIZE      = 1024 * 1024                      // The max size of a transaction to prevent DOS attacks
+	JOURNAL_INTERVAL = 10 * 60                          // The interval in seconds to rotate the journal files
+	JOURNAL_WAIT     = 10                               // The max seconds to wait for validators before reloading journal
 )
 
 // ActorType enumerates the kind of actor
@@ -56,10 +59,11 @@ const (
 type SenderType uint8
 
 const (
-	NilSender  SenderType = iota
-	NetSender             // Net sends tx req
-	HttpSender            // Http sends tx req
-	PoCSender             // PoC Consensus sends poc
+	NilSender   SenderType = iota
+	NetSender              // Net sends tx req
+	HttpSender             // Http sends tx req
+	PoCSender              // PoC Consensus sends poc
+	MinerSender            // Built-in miner sends poc
 )
 
 func (sender SenderType) Sender() string {
@@ -70,6 +74,8 @@ func (sender SenderType) Sender() string {
 		return "net sender"
 	case HttpSender:
 		return "http sender"
+	case MinerSender:
+		return "miner sender"
 	default:
 		return "unknown sender"
 	}
@@ -116,6 +122,7 @@ type TxReq struct {
 	Tx         *types.Transaction
 	Sender     SenderType
 	TxResultCh chan *TxResult
+	PeerId     p2pcommon.PeerId // The peer relaying the tx if sender is net
 }
 
 // TxRsp returns the result of submitting tx, including
@@ -194,6 +201,17 @@ type GetPendingTxnRsp struct {
 	Txs []*types.Transaction
 }
 
+// GetPayerTxnReq specifies the api that how to get the pending tx queue
+// of a payer in the pool.
+type GetPayerTxnReq struct {
+	Payer common.Address
+}
+
+// GetPayerTxnRsp returns the payer's transactions in nonce order.
+type GetPayerTxnRsp struct {
+	Txs []*TXEntry
+}
+
 // GetPendingTxnHashReq specifies the api that how to get a pending txHash list
 // in the pool.
 type GetPendingTxnHashReq struct {
@@ -283,3 +301,31 @@ func (n OrderByNetWorkFee) Len() int { return len(n) }
 func (n OrderByNetWorkFee) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
 
 func (n OrderByNetWorkFee) Less(i, j int) bool { return n[j].Tx.GasPrice < n[i].Tx.GasPrice }
+
+type OrderByNonce []*TXEntry
+
+func (n OrderByNonce) Len() int { return len(n) }
+
+func (n OrderByNonce) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+
+func (n OrderByNonce) Less(i, j int) bool { return n[i].Tx.Nonce < n[j].Tx.Nonce }
+
+// payerQueues implements heap.Interface, the queue whose head has the
+// highest gas price is on the top
+type payerQueues [][]*TXEntry
+
+func (q payerQueues) Len() int { return len(q) }
+
+func (q payerQueues) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q payerQueues) Less(i, j int) bool { return q[j][0].Tx.GasPrice < q[i][0].Tx.GasPrice }
+
+func (q *payerQueues) Push(x interface{}) { *q = append(*q, x.([]*TXEntry)) }
+
+func (q *payerQueues) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
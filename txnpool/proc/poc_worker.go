@@ -19,7 +19,6 @@
 package proc
 
 import (
-	"encoding/binary"
 	"sync"
 
 	cutils "github.com/saveio/themis/cmd/utils"
@@ -190,16 +189,7 @@ func (worker *pocPoolWorker) verifyParam(pocReq *CheckPoCReq) {
 	scoop := utils.CalculateScoop(uint64(miningInfo.View), gensig)
 
 	scoopData := plot.GetScoopData(int(scoop))
-
-	data := append([]byte{}, gensig[:]...) // gensig 32 bytes
-	data = append(data, scoopData[:]...)   // scoop 64 bytes
-
-	md := common.NewShabal256()
-	md.Update(data, 0, int64(len(data)))
-	hash := md.Digest()
-
-	//same with burst calculateHit
-	deadline := binary.LittleEndian.Uint64(hash)
+	deadline := utils.CalculateDeadline(gensig, scoopData)
 
 	log.Debugf("verifyParam dump param %v", param)
 	log.Debugf("verifyParam for view: %d, from id: %d, nonce: %d, deadline: %d\n", param.View, param.Id, param.Nonce, param.Deadline)
@@ -32,6 +32,7 @@ import (
 	"github.com/saveio/themis/errors"
 	"github.com/saveio/themis/events/message"
 	hComm "github.com/saveio/themis/http/base/common"
+	p2pcommon "github.com/saveio/themis/p2pserver/common"
 	gov "github.com/saveio/themis/smartcontract/service/native/governance"
 	"github.com/saveio/themis/smartcontract/service/native/utils"
 	"github.com/saveio/themis/smartcontract/service/neovm"
@@ -133,10 +134,18 @@ type TxActor struct {
 
 // handleTransaction handles a transaction from network and http
 func (ta *TxActor) handleTransaction(sender tc.SenderType, self *actor.PID,
-	txn *tx.Transaction, txResultCh chan *tc.TxResult) {
+	txn *tx.Transaction, peer p2pcommon.PeerId, txResultCh chan *tc.TxResult) {
 	ta.server.increaseStats(tc.RcvStats)
+	if sender == tc.NetSender && ta.server.isBannedPeer(peer) {
+		log.Debugf("handleTransaction: drop transaction %x from banned peer %s",
+			txn.Hash(), peer.ToHexString())
+		return
+	}
 	if len(txn.ToArray()) > tc.MAX_TX_SIZE {
 		log.Debugf("handleTransaction: reject a transaction due to size over 1M")
+		if sender == tc.NetSender {
+			ta.server.reportInvalidPeer(peer, "size is over 1M")
+		}
 		if sender == tc.HttpSender && txResultCh != nil {
 			replyTxResult(txResultCh, txn.Hash(), errors.ErrUnknown, "size is over 1M")
 		}
@@ -152,14 +161,14 @@ func (ta *TxActor) handleTransaction(sender tc.SenderType, self *actor.PID,
 			replyTxResult(txResultCh, txn.Hash(), errors.ErrDuplicateInput,
 				fmt.Sprintf("transaction %x is already in the tx pool", txn.Hash()))
 		}
-	} else if ta.server.getTransactionCount() >= tc.MAX_CAPACITY {
-		log.Debugf("handleTransaction: transaction pool is full for tx %x",
-			txn.Hash())
+	} else if err := ta.server.txPool.CheckAdmission(txn); err != nil {
+		log.Debugf("handleTransaction: transaction %x is rejected: %s",
+			txn.Hash(), err)
 
 		ta.server.increaseStats(tc.FailureStats)
 		if sender == tc.HttpSender && txResultCh != nil {
 			replyTxResult(txResultCh, txn.Hash(), errors.ErrTxPoolFull,
-				"transaction pool is full")
+				err.Error())
 		}
 	} else {
 		if _, overflow := common.SafeMul(txn.GasLimit, txn.GasPrice); overflow {
@@ -197,6 +206,18 @@ func (ta *TxActor) handleTransaction(sender tc.SenderType, self *actor.PID,
 			return
 		}
 
+		if old, ok := ta.server.txPool.CheckReplacement(txn); !ok {
+			log.Debugf("handleTransaction: transaction %x gas price %d is not higher than %d of %x with the same payer and nonce",
+				txn.Hash(), txn.GasPrice, old.GasPrice, old.Hash())
+			if sender == tc.HttpSender && txResultCh != nil {
+				oldHash := old.Hash()
+				replyTxResult(txResultCh, txn.Hash(), errors.ErrGasPrice,
+					fmt.Sprintf("replacement transaction gasPrice should > %d of %s with the same payer and nonce",
+						old.GasPrice, oldHash.ToHexString()))
+			}
+			return
+		}
+
 		if !ta.server.disablePreExec {
 			if ok, desc := preExecCheck(txn); !ok {
 				log.Debugf("handleTransaction: preExecCheck tx %x failed", txn.Hash())
@@ -208,7 +229,7 @@ func (ta *TxActor) handleTransaction(sender tc.SenderType, self *actor.PID,
 			log.Debugf("handleTransaction: preExecCheck tx %x passed", txn.Hash())
 		}
 		<-ta.server.slots
-		ta.server.assignTxToWorker(txn, sender, txResultCh)
+		ta.server.assignPeerTxToWorker(txn, sender, peer, txResultCh)
 	}
 }
 
@@ -247,7 +268,7 @@ func (ta *TxActor) Receive(context actor.Context) {
 
 		log.Debugf("txpool-tx actor receives tx from %v ", sender.Sender())
 
-		ta.handleTransaction(sender, context.Self(), msg.Tx, msg.TxResultCh)
+		ta.handleTransaction(sender, context.Self(), msg.Tx, msg.PeerId, msg.TxResultCh)
 
 	case *tc.GetTxnReq:
 		sender := context.Sender()
@@ -308,6 +329,15 @@ func (ta *TxActor) Receive(context actor.Context) {
 			sender.Request(&tc.GetTxnCountRsp{Count: res},
 				context.Self())
 		}
+	case *tc.GetPayerTxnReq:
+		sender := context.Sender()
+
+		log.Debugf("txpool-tx actor receives getting payer tx req from %v", sender)
+
+		res := ta.server.getPayerTxs(msg.Payer)
+		if sender != nil {
+			sender.Request(&tc.GetPayerTxnRsp{Txs: res}, context.Self())
+		}
 	case *tc.GetPendingTxnHashReq:
 		sender := context.Sender()
 
@@ -21,8 +21,10 @@
 package proc
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"sync"
@@ -38,8 +40,9 @@ import (
 	tx "github.com/saveio/themis/core/types"
 	"github.com/saveio/themis/errors"
 	httpcom "github.com/saveio/themis/http/base/common"
-	msgpack "github.com/saveio/themis/p2pserver/message/msg_pack"
+	p2pcommon "github.com/saveio/themis/p2pserver/common"
 	p2p "github.com/saveio/themis/p2pserver/net/protocol"
+	"github.com/saveio/themis/p2pserver/peer_score"
 	params "github.com/saveio/themis/smartcontract/service/native/global_params"
 	gov "github.com/saveio/themis/smartcontract/service/native/governance"
 	nutils "github.com/saveio/themis/smartcontract/service/native/utils"
@@ -55,6 +58,7 @@ type txStats struct {
 type serverPendingTx struct {
 	tx     *tx.Transaction   // Pending tx
 	sender tc.SenderType     // Indicate which sender tx is from
+	peer   p2pcommon.PeerId  // The peer relaying the tx if it is from net
 	ch     chan *tc.TxResult // channel to send tx result
 }
 
@@ -109,6 +113,9 @@ type TXPoolServer struct {
 	allPendingParam       map[common.Uint256]*serverPendingParam // The poc that server is processing
 	pocSlots              chan struct{}
 	miningInfo            *gov.MiningInfo
+	txJournal             *tc.Journal   // The journal of the accepted transactions
+	pocJournal            *tc.Journal   // The journal of the accepted poc params
+	journalStopCh         chan struct{} // Stop rotating the journals
 }
 
 // NewTxPoolServer creates a new tx pool server to schedule workers to
@@ -176,6 +183,7 @@ func (s *TXPoolServer) init(num uint8, disablePreExec, disableBroadcastNetTx boo
 	// Initial txnPool
 	s.txPool = &tc.TXPool{}
 	s.txPool.Init()
+	s.txPool.SetAdmissionPolicy(tc.NewAdmissionPolicy(config.DefConfig.TxPool))
 	s.allPendingTxs = make(map[common.Uint256]*serverPendingTx)
 	s.actors = make(map[tc.ActorType]*actor.PID)
 
@@ -279,6 +287,190 @@ func (s *TXPoolServer) monitor() {
 	}
 }
 
+// EnableJournal reloads the transactions and poc params journaled in the
+// directory, and journals the newly accepted ones from then on. The reloaded
+// items which are already in the ledger are skipped, the others are verified
+// again like those from the network, so it should be called after the
+// validators are registered.
+func (s *TXPoolServer) EnableJournal(dir string) error {
+	s.txJournal = tc.NewJournal(filepath.Join(dir, tc.TX_JOURNAL_FILE))
+	s.pocJournal = tc.NewJournal(filepath.Join(dir, tc.POC_JOURNAL_FILE))
+
+	txs := make([]*tx.Transaction, 0)
+	err := s.txJournal.Load(func(data []byte) {
+		t, err := tx.TransactionFromRawBytes(data)
+		if err != nil {
+			log.Warnf("EnableJournal: fail to decode transaction: %s", err)
+			return
+		}
+		if exist, _ := ledger.DefLedger.IsContainTransaction(t.Hash()); exist {
+			return
+		}
+		txs = append(txs, t)
+	})
+	if err != nil {
+		return fmt.Errorf("load transaction journal error: %s", err)
+	}
+
+	params := make([]*gov.SubmitNonceParam, 0)
+	err = s.pocJournal.Load(func(data []byte) {
+		param := &gov.SubmitNonceParam{}
+		if err := param.Deserialize(bytes.NewReader(data)); err != nil {
+			log.Warnf("EnableJournal: fail to decode poc param: %s", err)
+			return
+		}
+		params = append(params, param)
+	})
+	if err != nil {
+		return fmt.Errorf("load poc journal error: %s", err)
+	}
+
+	// Keep the reloaded items in journal until they are verified
+	if err := s.rotateJournal(txs, params); err != nil {
+		return err
+	}
+	if !s.waitForValidators(tc.JOURNAL_WAIT * time.Second) {
+		return fmt.Errorf("reload journal error: validators are not registered")
+	}
+
+	pid := s.GetPID(tc.TxActor)
+	for _, t := range txs {
+		pid.Tell(&tc.TxReq{Tx: t, Sender: tc.NilSender})
+	}
+	for _, param := range params {
+		pid.Tell(&tc.PoCReq{Param: param, Sender: tc.NilSender})
+	}
+	log.Infof("tx pool: reload %d transactions and %d poc params from journal",
+		len(txs), len(params))
+
+	s.journalStopCh = make(chan struct{})
+	go s.journalLoop()
+	return nil
+}
+
+// waitForValidators waits until both stateless and stateful validators are
+// registered, returns false if timeout.
+func (s *TXPoolServer) waitForValidators(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		s.validators.Lock()
+		ready := len(s.validators.entries[types.Stateless]) > 0 &&
+			len(s.validators.entries[types.Stateful]) > 0
+		s.validators.Unlock()
+		if ready {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// journalLoop rotates the journals periodically to drop the items which
+// have left the pool.
+func (s *TXPoolServer) journalLoop() {
+	ticker := time.NewTicker(tc.JOURNAL_INTERVAL * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			txs, params := s.getJournalItems()
+			if err := s.rotateJournal(txs, params); err != nil {
+				log.Errorf("journalLoop: %s", err)
+			}
+		case <-s.journalStopCh:
+			return
+		}
+	}
+}
+
+// getJournalItems returns the transactions and poc params in pool and
+// those in the verifying process.
+func (s *TXPoolServer) getJournalItems() ([]*tx.Transaction, []*gov.SubmitNonceParam) {
+	entries, _ := s.txPool.GetTxPool(false, 0)
+	txs := make([]*tx.Transaction, 0, len(entries))
+	for _, entry := range entries {
+		txs = append(txs, entry.Tx)
+	}
+	txs = append(txs, s.getPendingTxs(false)...)
+
+	params := s.pocPool.GetAllParams()
+	s.mu.RLock()
+	for _, pp := range s.allPendingParam {
+		params = append(params, pp.param)
+	}
+	s.mu.RUnlock()
+	return txs, params
+}
+
+// rotateJournal rewrites the journals with the transactions and poc params
+func (s *TXPoolServer) rotateJournal(txs []*tx.Transaction, params []*gov.SubmitNonceParam) error {
+	records := make([][]byte, 0, len(txs))
+	for _, t := range txs {
+		records = append(records, t.ToArray())
+	}
+	if err := s.txJournal.Rotate(records); err != nil {
+		return fmt.Errorf("rotate transaction journal error: %s", err)
+	}
+
+	records = make([][]byte, 0, len(params))
+	for _, param := range params {
+		buf := new(bytes.Buffer)
+		if err := param.Serialize(buf); err != nil {
+			return fmt.Errorf("serialize poc param error: %s", err)
+		}
+		records = append(records, buf.Bytes())
+	}
+	if err := s.pocJournal.Rotate(records); err != nil {
+		return fmt.Errorf("rotate poc journal error: %s", err)
+	}
+	return nil
+}
+
+// CloseJournal saves the transactions and poc params in pool to the
+// journals and closes them.
+func (s *TXPoolServer) CloseJournal() {
+	if s.txJournal == nil {
+		return
+	}
+	close(s.journalStopCh)
+	txs, params := s.getJournalItems()
+	if err := s.rotateJournal(txs, params); err != nil {
+		log.Errorf("CloseJournal: %s", err)
+	}
+	s.txJournal.Close()
+	s.pocJournal.Close()
+	log.Infof("tx pool: save %d transactions and %d poc params to journal",
+		len(txs), len(params))
+}
+
+// journalTx appends an accepted transaction to the journal
+func (s *TXPoolServer) journalTx(t *tx.Transaction) {
+	if s.txJournal == nil {
+		return
+	}
+	if err := s.txJournal.Insert(t.ToArray()); err != nil {
+		log.Warnf("journalTx: fail to journal transaction %x: %s", t.Hash(), err)
+	}
+}
+
+// journalParam appends an accepted poc param to the journal
+func (s *TXPoolServer) journalParam(param *gov.SubmitNonceParam) {
+	if s.pocJournal == nil {
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err := param.Serialize(buf); err != nil {
+		log.Warnf("journalParam: fail to serialize poc param %x: %s", param.Hash(), err)
+		return
+	}
+	if err := s.pocJournal.Insert(buf.Bytes()); err != nil {
+		log.Warnf("journalParam: fail to journal poc param %x: %s", param.Hash(), err)
+	}
+}
+
 // checkPendingBlockOk checks whether a block from consensus is verified.
 // If some transaction is invalid, return the result directly at once, no
 // need to wait for verifying the complete block.
@@ -345,6 +537,15 @@ func (s *TXPoolServer) getGasPrice() uint64 {
 // is in the block from consensus.
 func (s *TXPoolServer) removePendingTx(hash common.Uint256,
 	err errors.ErrCode) {
+	s.removePendingTxWithBlkErr(hash, err, err)
+}
+
+// removePendingTxWithBlkErr removes a transaction from the pending list
+// like removePendingTx, but uses blkErr as the result for the block from
+// consensus. A valid transaction rejected by the pool policy is still
+// valid in the block.
+func (s *TXPoolServer) removePendingTxWithBlkErr(hash common.Uint256,
+	err, blkErr errors.ErrCode) {
 
 	s.mu.Lock()
 
@@ -357,8 +558,7 @@ func (s *TXPoolServer) removePendingTx(hash common.Uint256,
 	if err == errors.ErrNoError && ((pt.sender == tc.HttpSender) ||
 		(pt.sender == tc.NetSender && !s.disableBroadcastNetTx)) {
 		if s.Net != nil {
-			msg := msgpack.NewTxn(pt.tx)
-			go s.Net.Broadcast(msg)
+			go s.Net.BroadcastTx(pt.tx)
 		}
 	}
 
@@ -366,6 +566,8 @@ func (s *TXPoolServer) removePendingTx(hash common.Uint256,
 		replyTxResult(pt.ch, hash, err, err.Error())
 	}
 
+	invalidPeer := pt.sender == tc.NetSender && isInvalidTxErr(err)
+
 	delete(s.allPendingTxs, hash)
 
 	if len(s.allPendingTxs) < tc.MAX_LIMITATION {
@@ -378,15 +580,51 @@ func (s *TXPoolServer) removePendingTx(hash common.Uint256,
 
 	s.mu.Unlock()
 
+	// Reporting may persist the ban list and disconnect the peer,
+	// so it is done without holding the lock
+	if invalidPeer {
+		s.reportInvalidPeer(pt.peer, err.Error())
+	}
+
 	// Check if the tx is in the pending block and
 	// the pending block is verified
-	s.checkPendingBlockOk(hash, err)
+	s.checkPendingBlockOk(hash, blkErr)
+}
+
+// reportInvalidPeer penalizes a peer relaying an invalid transaction, the
+// peer is banned when its misbehavior score reaches the threshold.
+// It must not be called with s.mu held.
+func (s *TXPoolServer) reportInvalidPeer(peer p2pcommon.PeerId, reason string) {
+	if s.Net == nil || peer.IsEmpty() {
+		return
+	}
+	s.Net.PeerScore().ReportPeer(s.Net.GetPeer(peer), peer_score.MisbehaveInvalidTx, reason)
+}
+
+// isBannedPeer checks whether the peer relaying a transaction is banned
+func (s *TXPoolServer) isBannedPeer(peer p2pcommon.PeerId) bool {
+	if s.Net == nil {
+		return false
+	}
+	p := s.Net.GetPeer(peer)
+	return p != nil && s.Net.PeerScore().IsPeerBanned(peer, p.GetAddr())
+}
+
+// isInvalidTxErr checks whether the error is caused by a stateless failure
+// of the transaction itself. Stateful failures, like a nonce or balance
+// changed by a concurrent transaction, are not the relaying peer's fault.
+func isInvalidTxErr(err errors.ErrCode) bool {
+	switch err {
+	case errors.ErrVerifySignature, errors.ErrTransactionPayload:
+		return true
+	}
+	return false
 }
 
 // setPendingTx adds a transaction to the pending list, if the
 // transaction is already in the pending list, just return false.
 func (s *TXPoolServer) setPendingTx(tx *tx.Transaction,
-	sender tc.SenderType, txResultCh chan *tc.TxResult) bool {
+	sender tc.SenderType, peer p2pcommon.PeerId, txResultCh chan *tc.TxResult) bool {
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -399,6 +637,7 @@ func (s *TXPoolServer) setPendingTx(tx *tx.Transaction,
 	pt := &serverPendingTx{
 		tx:     tx,
 		sender: sender,
+		peer:   peer,
 		ch:     txResultCh,
 	}
 
@@ -409,12 +648,19 @@ func (s *TXPoolServer) setPendingTx(tx *tx.Transaction,
 // assignTxToWorker assigns a new transaction to a worker by LB
 func (s *TXPoolServer) assignTxToWorker(tx *tx.Transaction,
 	sender tc.SenderType, txResultCh chan *tc.TxResult) bool {
+	return s.assignPeerTxToWorker(tx, sender, p2pcommon.PeerId{}, txResultCh)
+}
+
+// assignPeerTxToWorker assigns a new transaction relayed by the peer to
+// a worker by LB
+func (s *TXPoolServer) assignPeerTxToWorker(tx *tx.Transaction,
+	sender tc.SenderType, peer p2pcommon.PeerId, txResultCh chan *tc.TxResult) bool {
 
 	if tx == nil {
 		return false
 	}
 
-	if ok := s.setPendingTx(tx, sender, txResultCh); !ok {
+	if ok := s.setPendingTx(tx, sender, peer, txResultCh); !ok {
 		s.increaseStats(tc.DuplicateStats)
 		if sender == tc.HttpSender && txResultCh != nil {
 			replyTxResult(txResultCh, tx.Hash(), errors.ErrDuplicateInput,
@@ -618,6 +864,11 @@ func (s *TXPoolServer) getPendingTxs(byCount bool) []*tx.Transaction {
 	return ret
 }
 
+// getPayerTxs returns the payer's transactions in the pool in nonce order
+func (s *TXPoolServer) getPayerTxs(payer common.Address) []*tc.TXEntry {
+	return s.txPool.GetPayerTxs(payer)
+}
+
 // getTxHashList returns a currently pending tx hash list
 func (s *TXPoolServer) getTxHashList() []common.Uint256 {
 	s.mu.RLock()
@@ -683,6 +934,8 @@ func (s *TXPoolServer) addTxList(txEntry *tc.TXEntry) bool {
 	ret := s.txPool.AddTxList(txEntry)
 	if !ret {
 		s.increaseStats(tc.DuplicateStats)
+	} else {
+		s.journalTx(txEntry.Tx)
 	}
 	return ret
 }
@@ -742,7 +995,7 @@ func (s *TXPoolServer) getTransactionCount() int {
 
 // reVerifyStateful re-verify a transaction's stateful data.
 func (s *TXPoolServer) reVerifyStateful(tx *tx.Transaction, sender tc.SenderType) {
-	if ok := s.setPendingTx(tx, sender, nil); !ok {
+	if ok := s.setPendingTx(tx, sender, p2pcommon.PeerId{}, nil); !ok {
 		s.increaseStats(tc.DuplicateStats)
 		return
 	}
@@ -929,6 +1182,7 @@ func (s *TXPoolServer) assignParamToWorker(param *gov.SubmitNonceParam,
 			ok := s.pocPool.AddFuturePoC(pocEntry)
 
 			if ok {
+				s.journalParam(param)
 				log.Debugf("assignParamToWorker: add param %v for view %d to future list", param, param.View)
 			}
 			return ok
@@ -956,7 +1210,13 @@ func (s *TXPoolServer) assignParamToWorker(param *gov.SubmitNonceParam,
 
 // addPoCList adds a valid poc puzzle result to the poc pool.
 func (s *TXPoolServer) addPoCList(entry *tc.PoCEntry) bool {
+	hash := entry.Param.Hash()
+	exist := s.pocPool.GetParam(hash) != nil
 	ret := s.pocPool.AddPoC(entry)
+	// Journal the param only when it is newly added to the pool
+	if !exist && s.pocPool.GetParam(hash) != nil {
+		s.journalParam(entry.Param)
+	}
 
 	return ret
 }
@@ -19,14 +19,22 @@
 package proc
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/ontio/ontology-eventbus/actor"
+	"github.com/saveio/themis/account"
 	"github.com/saveio/themis/core/payload"
+	"github.com/saveio/themis/core/signature"
 	"github.com/saveio/themis/core/types"
+	"github.com/saveio/themis/crypto/keypair"
 	"github.com/saveio/themis/errors"
+	gov "github.com/saveio/themis/smartcontract/service/native/governance"
 	tc "github.com/saveio/themis/txnpool/common"
+	"github.com/saveio/themis/validator/stateful"
 	"github.com/saveio/themis/validator/stateless"
 	vt "github.com/saveio/themis/validator/types"
 	"github.com/stretchr/testify/assert"
@@ -285,3 +293,78 @@ func TestValidator(t *testing.T) {
 
 	t.Log("Ending validator testing")
 }
+
+func TestIsInvalidTxErr(t *testing.T) {
+	assert.False(t, isInvalidTxErr(errors.ErrDuplicateInput))
+	assert.True(t, isInvalidTxErr(errors.ErrVerifySignature))
+	assert.True(t, isInvalidTxErr(errors.ErrTransactionPayload))
+	assert.False(t, isInvalidTxErr(errors.ErrTransactionBalance))
+	assert.False(t, isInvalidTxErr(errors.ErrDoubleSpend))
+	assert.False(t, isInvalidTxErr(errors.ErrUnknown))
+}
+
+func newSignedTx(t *testing.T, acc *account.Account) *types.Transaction {
+	mutable := &types.MutableTransaction{
+		TxType:   types.InvokeNeo,
+		Nonce:    uint32(time.Now().UnixNano()),
+		GasLimit: 20000,
+		Payer:    acc.Address,
+		Payload:  &payload.InvokeCode{Code: []byte("ont")},
+	}
+	hash := mutable.Hash()
+	sig, err := signature.Sign(acc, hash[:])
+	assert.Nil(t, err)
+	mutable.Sigs = []types.Sig{{PubKeys: []keypair.PublicKey{acc.PublicKey}, M: 1, SigData: [][]byte{sig}}}
+	tx, err := mutable.IntoImmutable()
+	assert.Nil(t, err)
+	return tx
+}
+
+func TestEnableJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txpool")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// journal a valid and an unsigned transaction
+	validTx := newSignedTx(t, account.NewAccount(""))
+	journal := tc.NewJournal(filepath.Join(dir, tc.TX_JOURNAL_FILE))
+	assert.Nil(t, journal.Insert(validTx.ToArray()))
+	assert.Nil(t, journal.Insert(txn.ToArray()))
+	assert.Nil(t, journal.Close())
+
+	s := NewTxPoolServer(tc.MAX_WORKER_NUM, true, false)
+	defer s.Stop()
+	rspPid := startActor(NewVerifyRspActor(s))
+	s.RegisterActor(tc.VerifyRspActor, rspPid)
+	s.RegisterActor(tc.TxActor, startActor(NewTxActor(s)))
+
+	// reload fails without validators
+	assert.False(t, s.waitForValidators(100*time.Millisecond))
+
+	statelessV, err := stateless.NewValidator("journal_stateless")
+	assert.Nil(t, err)
+	statelessV.Register(rspPid)
+	statefulV, err := stateful.NewValidator("journal_stateful")
+	assert.Nil(t, err)
+	statefulV.Register(rspPid)
+	defer statelessV.UnRegister(rspPid)
+	defer statefulV.UnRegister(rspPid)
+
+	// the reloaded transactions are verified again
+	assert.Nil(t, s.EnableJournal(dir))
+	defer s.CloseJournal()
+	time.Sleep(2 * time.Second)
+	assert.NotNil(t, s.getTransaction(validTx.Hash()))
+	assert.Nil(t, s.getTransaction(txn.Hash()))
+
+	// poc param is journaled once when it is added to pool
+	param := &gov.SubmitNonceParam{View: 1, Deadline: 100}
+	s.addPoCList(&tc.PoCEntry{Param: param, Ret: true})
+	s.addPoCList(&tc.PoCEntry{Param: param, Ret: true})
+	records := 0
+	err = tc.NewJournal(filepath.Join(dir, tc.POC_JOURNAL_FILE)).Load(func(data []byte) {
+		records++
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, records)
+}
@@ -172,7 +172,11 @@ func (worker *txPoolWorker) putTxPool(pt *pendingTx) bool {
 		Tx:    pt.tx,
 		Attrs: pt.ret,
 	}
-	worker.server.addTxList(txEntry)
+	if !worker.server.addTxList(txEntry) {
+		worker.server.removePendingTxWithBlkErr(pt.tx.Hash(), errors.ErrDuplicateInput,
+			errors.ErrNoError)
+		return false
+	}
 	worker.server.removePendingTx(pt.tx.Hash(), errors.ErrNoError)
 	return true
 }